@@ -5,9 +5,9 @@ import (
 	"log"
 	"time"
 
-	"blockchain-wallet/backend/pkg/blockchain"
-	"blockchain-wallet/backend/pkg/tx"
-	"blockchain-wallet/backend/pkg/utxo"
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
 )
 
 func main() {
@@ -0,0 +1,405 @@
+// Command nodectl inspects and repairs a node's stored chain. It works on
+// the database named by DB_DRIVER / DATABASE_URL / SQLITE_PATH (read from
+// the environment or .env, as the server does) and needs no running
+// server. Stop the server before running the commands that write.
+//
+//	nodectl blocks -from 10
+//	nodectl verify
+//	nodectl rebuild utxos -apply
+//	nodectl snapshot export -out chain.json
+//	nodectl prune mempool -older 48h
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"blockchain-wallet/pkg/db"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, c *db.Client, args []string) error
+}
+
+var commands = map[string]command{
+	"blocks":   {"blocks [-from h] [-to h] [-json]", "list stored blocks in height order", cmdBlocks},
+	"verify":   {"verify", "check proof of work, hashes, links and mined transactions", cmdVerify},
+	"utxos":    {"utxos [-asset id|*] [-owner wallet]", "list unspent outputs", cmdUTXOs},
+	"supply":   {"supply", "show the unspent supply of the coin and every asset", cmdSupply},
+	"rebuild":  {"rebuild balances | utxos [-apply] | stats", "recompute derived data from the chain", cmdRebuild},
+	"snapshot": {"snapshot export [-out file] | import file", "write or load the chain data as JSON", cmdSnapshot},
+	"prune":    {"prune logs [-older d] | otps | mempool [-older d]", "delete old logs, expired OTPs or stale pending transactions", cmdPrune},
+}
+
+func main() {
+	_ = godotenv.Load()
+	flag.Usage = usage
+	flag.Parse()
+
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "" && name != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	client, err := db.Open(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ DB connection failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	if err := client.CheckSchemaVersion(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cmd.run(ctx, client, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: nodectl %s\n", cmd.usage)
+			client.Close()
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", name, err)
+		client.Close()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: nodectl command [args]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(out, "  %-9s %s\n", n, commands[n].help)
+	}
+}
+
+var errUsage = errors.New("usage")
+
+// parseFlags parses a command's flags, allowing them after its positional
+// arguments too, and checks the number of positional arguments
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	fs.SetOutput(new(strings.Builder))
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(pos) < min || len(pos) > max {
+		return nil, errUsage
+	}
+	return pos, nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// cmdBlocks lists the stored blocks
+func cmdBlocks(ctx context.Context, c *db.Client, args []string) error {
+	fs := flag.NewFlagSet("blocks", flag.ContinueOnError)
+	from := fs.Int64("from", 0, "lowest height to list")
+	to := fs.Int64("to", -1, "highest height to list; all if negative")
+	asJSON := fs.Bool("json", false, "print the blocks with their entries as JSON")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	blocks, err := c.ChainBlocks(ctx)
+	if err != nil {
+		return err
+	}
+	list := []db.StoredBlock{}
+	for _, b := range blocks {
+		if b.Index >= *from && (*to < 0 || b.Index <= *to) {
+			list = append(list, b)
+		}
+	}
+	if *asJSON {
+		return printJSON(list)
+	}
+	for _, b := range list {
+		miner := b.MinerWalletID
+		if miner == "" {
+			miner = "-"
+		}
+		fmt.Printf("%6d  %s  %s  diff %d  txs %d  miner %s\n",
+			b.Index, b.Hash, b.MinedAt.UTC().Format("2006-01-02 15:04:05"), b.Difficulty, b.TxCount, miner)
+	}
+	return nil
+}
+
+// cmdVerify checks the stored chain and exits non-zero if it finds problems
+func cmdVerify(ctx context.Context, c *db.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	r, err := c.VerifyChain(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d blocks in %d segments", r.Blocks, r.Segments)
+	if r.Unhashed > 0 {
+		fmt.Printf(" (%d stored without contents; hashes not recomputed)", r.Unhashed)
+	}
+	fmt.Println()
+	for _, i := range r.Issues {
+		if i.Hash != "" {
+			fmt.Printf("✗ height %d %s: %s\n", i.Height, i.Hash, i.Problem)
+		} else {
+			fmt.Printf("✗ %s\n", i.Problem)
+		}
+	}
+	if len(r.Issues) > 0 {
+		return fmt.Errorf("%d problems found", len(r.Issues))
+	}
+	fmt.Println("✓ chain verified")
+	return nil
+}
+
+// cmdUTXOs lists unspent outputs
+func cmdUTXOs(ctx context.Context, c *db.Client, args []string) error {
+	fs := flag.NewFlagSet("utxos", flag.ContinueOnError)
+	assetID := fs.String("asset", "", "asset ID, * for all; the native coin if empty")
+	owner := fs.String("owner", "", "only outputs of this wallet")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	list, err := c.UnspentOutputs(ctx, *assetID)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, u := range list {
+		if *owner != "" && u.Owner != *owner {
+			continue
+		}
+		line := fmt.Sprintf("%-72s %-40s %12d", u.UTXOID, u.Owner, u.Amount)
+		if u.Asset != "" {
+			line += "  " + u.Asset
+		}
+		if u.Lock != nil {
+			line += "  locked:" + u.Lock.Kind
+		}
+		fmt.Println(line)
+		total += u.Amount
+	}
+	if *assetID != "*" {
+		fmt.Printf("total %d\n", total)
+	}
+	return nil
+}
+
+// cmdSupply shows the unspent total of the native coin and each asset
+func cmdSupply(ctx context.Context, c *db.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	list, err := c.SupplySummary(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		name := "native"
+		if s.Asset != "" {
+			name = s.Symbol + " " + s.Asset
+		}
+		line := fmt.Sprintf("%-80s %14d  %d outputs, %d holders", name, s.Amount, s.UTXOs, s.Holders)
+		if s.Issued != nil && *s.Issued != s.Amount {
+			line += fmt.Sprintf("  ✗ %d issued", *s.Issued)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// cmdRebuild recomputes balances, outputs or explorer aggregates
+func cmdRebuild(ctx context.Context, c *db.Client, args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	apply := fs.Bool("apply", false, "recreate missing outputs instead of only listing them")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	switch pos[0] {
+	case "balances":
+		n, err := c.ReconcileBalances(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ corrected %d wallet balances\n", n)
+
+	case "utxos":
+		repairs, err := c.RepairOutputs(ctx, *apply)
+		for _, r := range repairs {
+			mark := "✗"
+			if r.Repaired {
+				mark = "✓ recreated"
+			}
+			if r.UTXOID == "" {
+				fmt.Printf("%s transaction %s: %s\n", mark, r.TxID, r.Problem)
+				continue
+			}
+			fmt.Printf("%s %s (%d to %s): %s\n", mark, r.UTXOID, r.Amount, r.Owner, r.Problem)
+		}
+		if err != nil {
+			return err
+		}
+		if len(repairs) == 0 {
+			fmt.Println("✓ every mined transaction has its outputs")
+			return nil
+		}
+		if !*apply {
+			fmt.Println("dry run; rerun with -apply to recreate missing outputs")
+			return nil
+		}
+		if err := c.RebuildStats(ctx); err != nil {
+			return err
+		}
+		n, err := c.ReconcileBalances(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ corrected %d wallet balances\n", n)
+
+	case "stats":
+		if err := c.RebuildStats(ctx); err != nil {
+			return err
+		}
+		fmt.Println("✓ explorer statistics rebuilt")
+
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// cmdSnapshot exports or imports the chain data
+func cmdSnapshot(ctx context.Context, c *db.Client, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	out := fs.String("out", "", "file to export to; standard output if empty")
+	pos, err := parseFlags(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	switch {
+	case pos[0] == "export" && len(pos) == 1:
+		s, err := c.ExportSnapshot(ctx)
+		if err != nil {
+			return err
+		}
+		if *out == "" {
+			return printJSON(s)
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, append(data, '\n'), 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ exported %d blocks, %d transactions, %d outputs and %d assets to %s\n",
+			len(s.Blocks), len(s.Transactions), len(s.UTXOs), len(s.Assets), *out)
+
+	case pos[0] == "import" && len(pos) == 2:
+		data, err := os.ReadFile(pos[1])
+		if err != nil {
+			return err
+		}
+		var s db.Snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%s: %w", pos[1], err)
+		}
+		n, err := c.ImportSnapshot(ctx, &s)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ imported %d blocks, %d transactions, %d outputs and %d assets; updated %d existing rows\n",
+			n.Blocks, n.Transactions, n.UTXOs, n.Assets, n.Updated)
+
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// cmdPrune deletes old logs, expired OTPs or stale mempool entries
+func cmdPrune(ctx context.Context, c *db.Client, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	older := fs.Duration("older", 0, "age to prune beyond (default 720h for logs, 24h for mempool)")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	age := func(def time.Duration) time.Time {
+		if *older > 0 {
+			def = *older
+		}
+		return time.Now().Add(-def)
+	}
+	switch pos[0] {
+	case "logs":
+		n, err := c.PruneLogs(ctx, age(30*24*time.Hour))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ deleted %d log entries\n", n)
+
+	case "otps":
+		n, err := c.DeleteExpiredOTPs(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ deleted %d expired OTPs\n", n)
+
+	case "mempool":
+		dropped, err := c.DropStalePending(ctx, age(24*time.Hour))
+		for _, id := range dropped {
+			fmt.Printf("✓ dropped %s\n", id)
+		}
+		if err != nil {
+			return err
+		}
+		if len(dropped) == 0 {
+			fmt.Println("no stale pending transactions")
+			return nil
+		}
+		if err := c.RebuildStats(ctx); err != nil {
+			return err
+		}
+		if _, err := c.ReconcileBalances(ctx); err != nil {
+			return err
+		}
+
+	default:
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/db"
+)
+
+// openTestDB opens a migrated SQLite database the way nodectl does, from
+// DB_DRIVER and SQLITE_PATH
+func openTestDB(t *testing.T, name string) *db.Client {
+	t.Helper()
+	t.Setenv("DB_DRIVER", db.DriverSQLite)
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), name))
+	ctx := context.Background()
+	c, err := db.Open(ctx)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.MigrateUp(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := c.CheckSchemaVersion(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func seedWallets(t *testing.T, c *db.Client, walletIDs ...string) {
+	t.Helper()
+	ctx := context.Background()
+	for _, id := range walletIDs {
+		userID, err := c.InsertUser(ctx, id+"@example.com", "Test "+id, "12345-1234567-1")
+		if err != nil {
+			t.Fatalf("InsertUser: %v", err)
+		}
+		if err := c.InsertWallet(ctx, userID, id, []byte("pub-"+id), []byte("enc-"+id)); err != nil {
+			t.Fatalf("InsertWallet: %v", err)
+		}
+	}
+}
+
+// seedChain stores a mined block whose transfer of 30 from a deposit of 100
+// lost its change output
+func seedChain(t *testing.T, c *db.Client) {
+	t.Helper()
+	ctx := context.Background()
+	seedWallets(t, c, "wallet-a", "wallet-b")
+	_ = c.InsertUTXO(ctx, "deposit", "wallet-a", 100)
+	_ = c.SpendUTXO(ctx, "deposit", "tx-1")
+	_ = c.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 30)
+	rec := db.TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 30, Signature: []byte("sig")}
+	if err := c.InsertTransaction(ctx, rec); err != nil {
+		t.Fatalf("InsertTransaction: %v", err)
+	}
+	b := &blockchain.Block{Index: 1, Timestamp: time.Now().Unix(), Transactions: []string{"tx-1", "MINING_REWARD:wallet-a"},
+		PreviousHash: "genesis", Miner: "wallet-a"}
+	b.MerkleRoot = blockchain.MerkleRoot(b.Transactions)
+	b.MineBlock(1)
+	if err := c.InsertBlock(ctx, b); err != nil {
+		t.Fatalf("InsertBlock: %v", err)
+	}
+}
+
+// run runs a command against c and returns what it printed
+func run(t *testing.T, c *db.Client, name string, args ...string) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	err = commands[name].run(context.Background(), c, args)
+	w.Close()
+	return <-done, err
+}
+
+func TestRebuildUTXOs(t *testing.T) {
+	c := openTestDB(t, "node.db")
+	seedChain(t, c)
+	ctx := context.Background()
+
+	// A dry run lists the missing output and changes nothing
+	out, err := run(t, c, "rebuild", "utxos")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !strings.Contains(out, "✗ tx-1_change (70 to wallet-a)") || !strings.Contains(out, "dry run") {
+		t.Fatalf("dry run printed:\n%s", out)
+	}
+	if _, err := c.GetUTXOByID(ctx, "tx-1_change"); err == nil {
+		t.Fatal("dry run recreated the output")
+	}
+
+	out, err = run(t, c, "rebuild", "-apply", "utxos")
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if !strings.Contains(out, "✓ recreated tx-1_change") {
+		t.Fatalf("apply printed:\n%s", out)
+	}
+	if u, err := c.GetUTXOByID(ctx, "tx-1_change"); err != nil || u.Owner != "wallet-a" || u.Amount != 70 {
+		t.Fatalf("recreated output = %+v, %v", u, err)
+	}
+	if out, _ := run(t, c, "rebuild", "utxos"); !strings.Contains(out, "every mined transaction has its outputs") {
+		t.Fatalf("after apply printed:\n%s", out)
+	}
+
+	if _, err := run(t, c, "rebuild", "everything"); err != errUsage {
+		t.Fatalf("unknown target: %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	src := openTestDB(t, "src.db")
+	seedChain(t, src)
+	file := filepath.Join(t.TempDir(), "chain.json")
+	if _, err := run(t, src, "snapshot", "export", "-out", file); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	dst := openTestDB(t, "dst.db")
+	seedWallets(t, dst, "wallet-a", "wallet-b")
+	out, err := run(t, dst, "snapshot", "import", file)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if !strings.Contains(out, "imported 1 blocks, 1 transactions, 2 outputs") {
+		t.Fatalf("import printed:\n%s", out)
+	}
+	if out, err := run(t, dst, "verify"); err != nil || !strings.Contains(out, "chain verified") {
+		t.Fatalf("verify after import: %v\n%s", err, out)
+	}
+	ctx := context.Background()
+	for _, wallet := range []string{"wallet-a", "wallet-b"} {
+		want, _ := src.GetBalance(ctx, wallet)
+		if got, err := dst.GetBalance(ctx, wallet); err != nil || got != want {
+			t.Errorf("balance of %s = %d, %v; want %d", wallet, got, err, want)
+		}
+	}
+
+	// Importing the same snapshot again adds nothing
+	if out, err := run(t, dst, "snapshot", "import", file); err != nil || !strings.Contains(out, "imported 0 blocks, 0 transactions, 0 outputs") {
+		t.Fatalf("second import: %v\n%s", err, out)
+	}
+}
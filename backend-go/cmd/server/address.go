@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"blockchain-wallet/pkg/address"
+)
+
+// addressPrefix is the network prefix of addresses this node accepts and
+// shows, from ADDRESS_PREFIX
+var addressPrefix = address.MainPrefix
+
+// initAddressPrefix reads the network prefix from the environment
+func initAddressPrefix() {
+	p := envOr("ADDRESS_PREFIX", address.MainPrefix)
+	if !address.ValidPrefix(p) {
+		log.Fatalf("❌ ADDRESS_PREFIX must be 1 to 16 lower-case letters, got %q", p)
+	}
+	addressPrefix = p
+}
+
+// normalizeAddress turns an address or legacy hex ID into the internal
+// wallet ID. An empty string stays empty.
+func normalizeAddress(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	id, err := address.Normalize(addressPrefix, s)
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", s, err)
+	}
+	return id, nil
+}
+
+// normalizeAddressList is normalizeAddress for each item of a list
+func normalizeAddressList(list []string) ([]string, error) {
+	out := make([]string, len(list))
+	for i, s := range list {
+		id, err := normalizeAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = id
+	}
+	return out, nil
+}
+
+// normalizeAddresses applies normalizeAddress to each field in place. It
+// writes 400 and returns false if a field is not an address.
+func normalizeAddresses(w http.ResponseWriter, fields ...*string) bool {
+	for _, f := range fields {
+		id, err := normalizeAddress(*f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		*f = id
+	}
+	return true
+}
+
+// addressOf is the address of a wallet ID, or "" for system wallets that
+// have none
+func addressOf(walletID string) string {
+	s, err := address.Encode(addressPrefix, walletID)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+// addressValidateHandler checks an address or legacy wallet ID without
+// looking it up, so forms can flag typos as they are entered
+func addressValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	in := r.URL.Query().Get("address")
+	if in == "" {
+		http.Error(w, "missing address param", http.StatusBadRequest)
+		return
+	}
+	id, err := address.Normalize(addressPrefix, in)
+	if err != nil {
+		writeJSON(w, map[string]interface{}{"valid": false, "error": err.Error(), "network": addressPrefix})
+		return
+	}
+	a, _ := address.FromWalletID(addressPrefix, id)
+	writeJSON(w, map[string]interface{}{
+		"valid":     true,
+		"wallet_id": id,
+		"address":   a.String(),
+		"version":   a.Version,
+		"legacy":    address.IsLegacy(strings.ToLower(strings.TrimSpace(in))),
+		"network":   addressPrefix,
+	})
+}
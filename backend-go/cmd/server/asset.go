@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/asset"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/tx"
+)
+
+const (
+	defaultAssetLimit = 100
+	maxAssetLimit     = 1000
+
+	// assetAuthWindow is how far the timestamp of a signed asset
+	// configuration may be from now
+	assetAuthWindow = 5 * time.Minute
+)
+
+// assetBalance is a wallet's holding of one asset in /wallet/balance
+type assetBalance struct {
+	Balance   int64 `json:"balance"`
+	Spendable int64 `json:"spendable"`
+}
+
+// issuerKey returns the public key an issuer acts with: the one given, or
+// the one derived from the private key
+func issuerKey(a CosignerAuth) (ed25519.PublicKey, error) {
+	if a.PublicKey == "" && a.PrivateKey != "" {
+		priv, err := base64.StdEncoding.DecodeString(a.PrivateKey)
+		if err != nil || len(priv) != ed25519.PrivateKeySize {
+			return nil, errors.New("invalid private_key")
+		}
+		return ed25519.PrivateKey(priv).Public().(ed25519.PublicKey), nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(a.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public_key")
+	}
+	return pub, nil
+}
+
+// signedAt fills in the timestamp when the server signs, and otherwise
+// checks the signed one is recent
+func signedAt(a CosignerAuth, timestamp int64) (int64, error) {
+	if timestamp == 0 {
+		if a.PrivateKey == "" {
+			return 0, errors.New("timestamp required with a signature")
+		}
+		return time.Now().Unix(), nil
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > assetAuthWindow || d < -assetAuthWindow {
+		return 0, errors.New("timestamp too far from now")
+	}
+	return timestamp, nil
+}
+
+type CreateAssetReq struct {
+	Symbol    string `json:"symbol"`
+	Name      string `json:"name"`
+	ZakatBPS  int64  `json:"zakat_bps"` // basis points; 0 exempts the asset from Zakat
+	Timestamp int64  `json:"timestamp"` // required with a signature, since it is signed
+	CosignerAuth
+}
+
+// assetCreateHandler registers an asset for the issuer key, which must
+// belong to a wallet. The issuer signs asset.ConfigPayload with the new
+// asset ID and Zakat rate.
+func assetCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateAssetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pub, err := issuerKey(req.CosignerAuth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a := asset.Asset{ID: asset.ID(pub, req.Symbol), Symbol: req.Symbol, Name: req.Name, IssuerKey: pub, ZakatBPS: req.ZakatBPS}
+	if err := a.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	issuerID := crypto.WalletIDFromPub(pub)
+	if _, err := dbClient.GetWalletByID(r.Context(), issuerID); err != nil {
+		http.Error(w, "issuer wallet not found: "+issuerID, http.StatusNotFound)
+		return
+	}
+
+	if err := authorizeIssuer(&a, req.CosignerAuth, req.ZakatBPS, req.Timestamp); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	if _, err := dbClient.GetAsset(r.Context(), a.ID); err == nil {
+		http.Error(w, "asset already registered: "+a.ID, http.StatusConflict)
+		return
+	}
+	if err := dbClient.InsertAsset(r.Context(), a); err != nil {
+		http.Error(w, "failed to register asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), issuerID, "asset_created",
+		fmt.Sprintf("Asset %s (%s), zakat %d bps", a.Symbol, a.ID, a.ZakatBPS), "success", r.RemoteAddr)
+
+	created, err := dbClient.GetAsset(r.Context(), a.ID)
+	if err != nil {
+		http.Error(w, "failed to fetch asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, created)
+}
+
+// authorizeIssuer checks the issuer's signature over a change to the
+// asset's configuration
+func authorizeIssuer(a *asset.Asset, auth CosignerAuth, zakatBPS, timestamp int64) error {
+	ts, err := signedAt(auth, timestamp)
+	if err != nil {
+		return badTransfer("%v", err)
+	}
+	payload := asset.ConfigPayload(a.ID, zakatBPS, ts)
+	sig, err := auth.sign(payload)
+	if err != nil {
+		return badTransfer("%v", err)
+	}
+	if err := a.VerifyIssuer(sig.PublicKey, payload, sig.Signature); err != nil {
+		return &transferError{status: http.StatusForbidden, msg: err.Error()}
+	}
+	return nil
+}
+
+type IssueAssetReq struct {
+	AssetID    string `json:"asset_id"`
+	ReceiverID string `json:"receiver_id"`
+	Amount     int64  `json:"amount"`
+	Note       string `json:"note"`
+	Timestamp  int64  `json:"timestamp"` // required with a signature, since it is signed
+	CosignerAuth
+
+	AllowUnknown bool `json:"allow_unknown"` // issue to a wallet the directory does not list
+}
+
+// assetIssueHandler mints new units of an asset to a wallet. The issuer
+// signs the issuance transaction's payload, as a sender signs a transfer.
+func assetIssueHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req IssueAssetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.ReceiverID) {
+		return
+	}
+	txx, err := issueAsset(r.Context(), &req, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"status":   "accepted",
+		"txid":     txx.ID,
+		"utxo_id":  txx.ID + "_recv",
+		"asset_id": txx.Asset,
+	})
+}
+
+// issueAsset verifies and records an issuance and queues it for mining
+func issueAsset(ctx context.Context, req *IssueAssetReq, ip string) (*tx.Transaction, error) {
+	a, err := dbClient.GetAsset(ctx, req.AssetID)
+	if err != nil {
+		return nil, &transferError{status: http.StatusNotFound, msg: "asset not found"}
+	}
+	external, err := checkRecipient(ctx, req.ReceiverID, req.AllowUnknown)
+	if err != nil {
+		return nil, err
+	}
+	if req.Timestamp == 0 && req.PrivateKey == "" {
+		return nil, badTransfer("timestamp required with a signature")
+	}
+	if err := checkInvoicePayment(ctx, req.ReceiverID, a.ID, req.Note); err != nil {
+		return nil, err
+	}
+
+	txx := tx.NewIssuance(crypto.WalletIDFromPub(a.IssuerKey), a.ID, req.ReceiverID, req.Amount, req.Note)
+	if req.Timestamp != 0 {
+		txx.Timestamp = req.Timestamp
+		txx.ID = txx.ComputeID()
+	}
+	sig, err := req.sign(txx.Payload())
+	if err != nil {
+		return nil, badTransfer("%v", err)
+	}
+	txx.SenderPub, txx.Signature = sig.PublicKey, sig.Signature
+	if err := tx.VerifyIssuance(txx, a.IssuerKey); err != nil {
+		return nil, &transferError{status: http.StatusForbidden, msg: err.Error()}
+	}
+
+	// A replayed issuance has the same ID, so its output already exists
+	if err := dbClient.IssueAsset(ctx, txRecord(txx, ip), txx.ID+"_recv", external); err != nil {
+		if _, getErr := dbClient.GetUTXOByID(ctx, txx.ID+"_recv"); getErr == nil {
+			return nil, &transferError{status: http.StatusConflict, msg: "issuance already recorded"}
+		}
+		return nil, fmt.Errorf("record issuance: %w", err)
+	}
+	utxoMgr.AddAssetUTXO(txx.ReceiverID, txx.Asset, txx.Amount, nil)
+	if err := dbClient.InsertLog(ctx, txx.SenderID, "asset_issued",
+		fmt.Sprintf("Issued %d %s to %s", txx.Amount, a.Symbol, txx.ReceiverID), "confirmed", ip); err != nil {
+		log.Printf("Warning: failed to log action in DB: %v", err)
+	}
+
+	bc.AddPendingTransaction(txx.ID)
+	publishTransfer(ctx, txx)
+	return txx, nil
+}
+
+type AssetZakatReq struct {
+	AssetID   string `json:"asset_id"`
+	ZakatBPS  int64  `json:"zakat_bps"`
+	Timestamp int64  `json:"timestamp"` // required with a signature, since it is signed
+	CosignerAuth
+}
+
+// assetZakatHandler changes the rate at which the Zakat run charges holders
+// of an asset. The issuer signs asset.ConfigPayload with the new rate.
+func assetZakatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AssetZakatReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := asset.ValidZakatBPS(req.ZakatBPS); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a, err := dbClient.GetAsset(r.Context(), req.AssetID)
+	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if err := authorizeIssuer(&a, req.CosignerAuth, req.ZakatBPS, req.Timestamp); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	if err := dbClient.SetAssetZakat(r.Context(), a.ID, req.ZakatBPS); err != nil {
+		http.Error(w, "failed to update asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), crypto.WalletIDFromPub(a.IssuerKey), "asset_zakat_changed",
+		fmt.Sprintf("Asset %s zakat %d -> %d bps", a.Symbol, a.ZakatBPS, req.ZakatBPS), "success", r.RemoteAddr)
+	a.ZakatBPS = req.ZakatBPS
+	writeJSON(w, a)
+}
+
+// assetGetHandler returns an asset by ?asset_id
+func assetGetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("asset_id")
+	if id == "" {
+		http.Error(w, "missing asset_id param", http.StatusBadRequest)
+		return
+	}
+	a, err := dbClient.GetAsset(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to fetch asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, a)
+}
+
+// assetListHandler lists registered assets by symbol
+func assetListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultAssetLimit, maxAssetLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := dbClient.ListAssets(r.Context(), limit)
+	if err != nil {
+		http.Error(w, "failed to fetch assets: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []asset.Asset{}
+	}
+	writeJSON(w, map[string]interface{}{"assets": list})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"blockchain-wallet/pkg/address"
+	"blockchain-wallet/pkg/directory"
+)
+
+// directoryLookupHandler resolves a recipient given as an address, a
+// registered email or an @alias. It tells the sender whether the wallet
+// exists and shows the owner's name masked, for confirmation. It needs a
+// session, so the directory cannot be walked anonymously.
+func directoryLookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireSession(w, r); !ok {
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "missing q param", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	kind := directory.Classify(q)
+	resp := map[string]interface{}{"query": q, "kind": kind, "exists": false}
+	var e directory.Entry
+	var err error
+	switch kind {
+	case directory.KindAlias:
+		alias, aerr := directory.NormalizeAlias(q)
+		if aerr != nil {
+			http.Error(w, aerr.Error(), http.StatusBadRequest)
+			return
+		}
+		e, err = dbClient.GetDirectoryEntryByAlias(ctx, alias)
+	case directory.KindEmail:
+		email, eerr := directory.NormalizeEmail(q)
+		if eerr != nil {
+			http.Error(w, eerr.Error(), http.StatusBadRequest)
+			return
+		}
+		e, err = dbClient.GetDirectoryEntryByEmail(ctx, email)
+	default:
+		id, nerr := normalizeAddress(q)
+		if nerr != nil {
+			http.Error(w, nerr.Error(), http.StatusBadRequest)
+			return
+		}
+		resp["wallet_id"], resp["address"] = id, addressOf(id)
+		e, err = dbClient.GetDirectoryEntry(ctx, id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, resp)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp["exists"] = true
+	resp["wallet_id"] = e.WalletID
+	resp["address"] = addressOf(e.WalletID)
+	resp["name"] = directory.MaskName(e.Name)
+	resp["multisig"] = e.Multisig
+	if e.Alias != "" {
+		resp["alias"] = "@" + e.Alias
+	}
+	writeJSON(w, resp)
+}
+
+type WalletAliasReq struct {
+	WalletID string `json:"wallet_id"`
+	Alias    string `json:"alias"`
+}
+
+// directoryAliasHandler sets (POST) or removes (DELETE) the alias of one of
+// the caller's wallets
+func directoryAliasHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	var req WalletAliasReq
+	switch r.Method {
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		req.WalletID = r.URL.Query().Get("wallet_id")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !normalizeAddresses(w, &req.WalletID) {
+		return
+	}
+	if req.WalletID == "" && len(claims.Wallets) > 0 {
+		req.WalletID = claims.Wallets[0]
+	}
+	if !claims.HasWallet(req.WalletID) {
+		http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	if r.Method == http.MethodDelete {
+		if err := dbClient.DeleteWalletAlias(ctx, req.WalletID); err != nil {
+			http.Error(w, "failed to remove alias: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = dbClient.InsertLog(ctx, req.WalletID, "alias_removed", "Directory alias removed", "success", r.RemoteAddr)
+		writeJSON(w, map[string]interface{}{"status": "removed", "wallet_id": req.WalletID})
+		return
+	}
+
+	alias, err := directory.NormalizeAlias(req.Alias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := dbClient.SetWalletAlias(ctx, req.WalletID, alias); errors.Is(err, directory.ErrAliasTaken) {
+		http.Error(w, "@"+alias+" is taken", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to set alias: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(ctx, req.WalletID, "alias_set", "Directory alias set to @"+alias, "success", r.RemoteAddr)
+	writeJSON(w, map[string]interface{}{
+		"wallet_id": req.WalletID,
+		"address":   addressOf(req.WalletID),
+		"alias":     "@" + alias,
+	})
+}
+
+// checkRecipient refuses a transfer to a wallet the directory does not
+// list, which is most likely a mistyped or stale ID, unless the sender set
+// allowUnknown. It reports whether an allowed recipient is unknown, in which
+// case the caller registers it as an external wallet, so it can own the
+// output, in the database transaction that stores the transfer. Without a
+// database every wallet is accepted.
+func checkRecipient(ctx context.Context, receiverID string, allowUnknown bool) (external bool, err error) {
+	if dbClient == nil {
+		return false, nil
+	}
+	_, err = dbClient.GetDirectoryEntry(ctx, receiverID)
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return false, err
+	case !allowUnknown:
+		return false, badTransfer("receiver %s is not a registered wallet; check it, or set allow_unknown to send anyway", receiverID)
+	}
+	if _, err := address.FromWalletID(addressPrefix, receiverID); err != nil {
+		return false, badTransfer("receiver %q is not a wallet ID", receiverID)
+	}
+	return true, nil
+}
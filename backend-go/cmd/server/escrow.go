@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/db"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+const (
+	defaultEscrowLimit = 50
+	maxEscrowLimit     = 500
+)
+
+// chainHeight is the index of the latest block, against which height locks
+// are checked
+func chainHeight() int64 {
+	return int64(bc.GetChainLength() - 1)
+}
+
+// checkTransferLock vets a lock sent with a transfer. Transfers may
+// time-lock or script-lock the receiver's output; escrows go through
+// /escrow/create.
+func checkTransferLock(l *utxo.Lock) error {
+	if l == nil {
+		return nil
+	}
+	if l.Kind == utxo.LockEscrow {
+		return errors.New("use /escrow/create for escrow")
+	}
+	return l.Validate()
+}
+
+type CreateEscrowReq struct {
+	SenderID     string `json:"sender_id"`
+	SenderPub    string `json:"sender_pub"`  // base64
+	SenderPriv   string `json:"sender_priv"` // base64
+	PayeeID      string `json:"payee_id"`
+	ArbiterID    string `json:"arbiter_id"`
+	Amount       int64  `json:"amount"`
+	Note         string `json:"note"`
+	RefundHeight int64  `json:"refund_height"` // the payer may refund from this block height
+	RefundTime   int64  `json:"refund_time"`   // and from this unix time
+}
+
+// escrowCreateHandler moves funds from the payer into an escrow output. The
+// output stays the payer's but cannot be spent until it is released to the
+// payee or refunded.
+func escrowCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateEscrowReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.SenderID, &req.PayeeID, &req.ArbiterID) {
+		return
+	}
+	lock := &utxo.Lock{
+		Kind:    utxo.LockEscrow,
+		Height:  req.RefundHeight,
+		Time:    req.RefundTime,
+		Payee:   req.PayeeID,
+		Arbiter: req.ArbiterID,
+	}
+	if err := lock.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.SenderID == req.PayeeID || req.SenderID == req.ArbiterID {
+		http.Error(w, "payer must differ from payee and arbiter", http.StatusBadRequest)
+		return
+	}
+	for _, id := range []string{req.PayeeID, req.ArbiterID} {
+		if _, err := dbClient.GetWalletByID(r.Context(), id); err != nil {
+			http.Error(w, "wallet not found: "+id, http.StatusNotFound)
+			return
+		}
+	}
+
+	privBytes, err := base64.StdEncoding.DecodeString(req.SenderPriv)
+	if err != nil {
+		http.Error(w, "invalid sender_priv: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	pubBytes, err := base64.StdEncoding.DecodeString(req.SenderPub)
+	if err != nil {
+		http.Error(w, "invalid sender_pub: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The escrow output is paid to the payer themselves, under the lock
+	txx, err := signAndSubmitTransfer(r.Context(), req.SenderID, req.SenderID, "", req.Amount, req.Note, lock, false, pubBytes, privBytes, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	escrowID := txx.ID + "_recv"
+	_ = dbClient.InsertLog(r.Context(), req.SenderID, "escrow_created",
+		fmt.Sprintf("Escrow %s: %d for %s, arbiter %s", escrowID, req.Amount, req.PayeeID, req.ArbiterID), "held", r.RemoteAddr)
+
+	writeJSON(w, map[string]interface{}{
+		"status":    utxo.EscrowHeld,
+		"escrow_id": escrowID,
+		"txid":      txx.ID,
+		"lock":      lock,
+	})
+}
+
+type SettleEscrowReq struct {
+	EscrowID  string         `json:"escrow_id"`
+	Approvals []CosignerAuth `json:"approvals"`
+}
+
+// escrowReleaseHandler pays an escrow to its payee. The arbiter and either
+// the payer or the payee approve by signing "escrow:release:<escrow_id>".
+func escrowReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	settleEscrowHandler(w, r, tx.EscrowRelease)
+}
+
+// escrowRefundHandler returns an escrow to its payer once the refund height
+// and time have passed. The payer approves by signing
+// "escrow:refund:<escrow_id>".
+func escrowRefundHandler(w http.ResponseWriter, r *http.Request) {
+	settleEscrowHandler(w, r, tx.EscrowRefund)
+}
+
+func settleEscrowHandler(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SettleEscrowReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.EscrowID == "" || len(req.Approvals) == 0 {
+		http.Error(w, "escrow_id and approvals required", http.StatusBadRequest)
+		return
+	}
+
+	payload := tx.EscrowPayload(action, req.EscrowID)
+	approvals := make([]tx.Approval, len(req.Approvals))
+	for i, a := range req.Approvals {
+		sig, err := a.sign(payload)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("approval %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		approvals[i] = tx.Approval(sig)
+	}
+
+	txx, err := settleEscrow(r.Context(), action, req.EscrowID, approvals, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	status := utxo.EscrowReleased
+	if action == tx.EscrowRefund {
+		status = utxo.EscrowRefunded
+	}
+	writeJSON(w, map[string]interface{}{
+		"status":    status,
+		"escrow_id": req.EscrowID,
+		"txid":      txx.ID,
+	})
+}
+
+// settleEscrow spends an escrow output to its payee or back to its payer
+// once the approvals satisfy the lock
+func settleEscrow(ctx context.Context, action, escrowID string, approvals []tx.Approval, ip string) (*tx.Transaction, error) {
+	transferMu.Lock()
+	defer transferMu.Unlock()
+
+	rec, err := dbClient.GetUTXOByID(ctx, escrowID)
+	if err != nil {
+		return nil, &transferError{status: http.StatusNotFound, msg: "escrow not found"}
+	}
+	u := &utxo.UTXO{ID: rec.UTXOID, Owner: rec.Owner, Amount: rec.Amount, Spent: rec.Spent, Lock: rec.Lock}
+	receiver, err := tx.VerifyEscrowSpend(action, u, approvals, chainHeight(), time.Now().Unix())
+	if err != nil {
+		return nil, &transferError{status: http.StatusForbidden, msg: err.Error()}
+	}
+
+	// The approvals are the authorisation, carried in the same key||signature
+	// form as multisig witnesses
+	sigs := make([]multisig.Signature, len(approvals))
+	for i, a := range approvals {
+		sigs[i] = multisig.Signature(a)
+	}
+	txx := tx.NewTransaction(u.Owner, receiver, u.Amount, fmt.Sprintf("Escrow %s of %s", action, escrowID), []string{escrowID})
+	txx.Signature = multisig.EncodeWitness(sigs)
+
+	if err := recordTransfer(ctx, txx, db.Transfer{Outputs: txx.Outputs(u.Amount), InputLock: utxo.LockEscrow}, ip); err != nil {
+		return nil, err
+	}
+	_ = dbClient.InsertLog(ctx, u.Owner, "escrow_"+action, fmt.Sprintf("Escrow %s: %d to %s", escrowID, txx.Amount, receiver), "confirmed", ip)
+
+	bc.AddPendingTransaction(txx.ID)
+	publishTransfer(ctx, txx)
+	return txx, nil
+}
+
+// escrowListHandler lists the escrows a wallet pays into, receives from or
+// arbitrates, newest first, with the current chain height for judging
+// refund locks
+func escrowListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	walletID := q.Get("wallet_id")
+	if walletID == "" {
+		http.Error(w, "missing wallet_id param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"), defaultEscrowLimit, maxEscrowLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := dbClient.GetEscrows(r.Context(), walletID, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch escrows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []db.Escrow{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"escrows": list,
+		"height":  chainHeight(),
+	})
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/events"
+	"blockchain-wallet/pkg/scheduler"
+	"blockchain-wallet/pkg/session"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/webhook"
+)
+
+const (
+	eventKeepAlive  = 25 * time.Second
+	wsPongWait      = 60 * time.Second
+	wsWriteWait     = 10 * time.Second
+	sseRetryMillis  = 3000
+	miningRewardTag = "MINING_REWARD:"
+)
+
+var eventBus = events.NewBus(events.DefaultHistory)
+
+// publishEvent sends an event to subscribers; failures are only logged
+func publishEvent(topic string, wallets []string, data interface{}) {
+	if _, err := eventBus.Publish(topic, wallets, data); err != nil {
+		log.Printf("Warning: failed to publish %s event: %v", topic, err)
+	}
+}
+
+// walletBalance returns the current balance of a wallet for event payloads
+func walletBalance(ctx context.Context, walletID string) int64 {
+	if dbClient != nil {
+		if bal, err := dbClient.GetBalance(ctx, walletID); err == nil {
+			return bal
+		}
+	}
+	return utxoMgr.Balance(walletID)
+}
+
+// publishBalance announces that a wallet's balance moved by delta
+func publishBalance(ctx context.Context, walletID string, delta int64, reason string) {
+	publishEvent(events.BalanceChanged, []string{walletID}, map[string]interface{}{
+		"wallet_id": walletID,
+		"delta":     delta,
+		"balance":   walletBalance(ctx, walletID),
+		"reason":    reason,
+	})
+}
+
+// publishTransfer announces an accepted transfer and the balance changes of
+// both parties
+func publishTransfer(ctx context.Context, txx *tx.Transaction) {
+	data := map[string]interface{}{
+		"tx_id":       txx.ID,
+		"sender_id":   txx.SenderID,
+		"receiver_id": txx.ReceiverID,
+		"amount":      txx.Amount,
+		"note":        txx.Note,
+	}
+	if txx.Asset != "" {
+		data["asset"] = txx.Asset
+	}
+	publishEvent(events.TxAccepted, []string{txx.SenderID, txx.ReceiverID}, data)
+	// Balance events track the native coin
+	if txx.Asset == "" {
+		publishBalance(ctx, txx.SenderID, -txx.Amount, "tx_sent")
+		if txx.ReceiverID != txx.SenderID {
+			publishBalance(ctx, txx.ReceiverID, txx.Amount, "tx_received")
+		}
+	}
+	payment := map[string]interface{}{"status": "pending"}
+	for k, v := range data {
+		payment[k] = v
+	}
+	notifyWebhooks(ctx, txx.ReceiverID, webhook.EventPaymentReceived, txx.ID, payment)
+}
+
+// publishBlock announces a mined block and confirms each stored transaction
+// in it to its parties. Transactions the database does not know, such as
+// the mining reward, are not announced individually.
+func publishBlock(ctx context.Context, block *blockchain.Block) {
+	publishEvent(events.BlockMined, nil, map[string]interface{}{
+		"block_index": block.Index,
+		"block_hash":  block.Hash,
+		"miner":       block.Miner,
+		"difficulty":  block.Difficulty,
+		"tx_count":    len(block.Transactions),
+		"timestamp":   block.Timestamp,
+	})
+	if dbClient == nil {
+		return
+	}
+	for _, txID := range block.Transactions {
+		if strings.HasPrefix(txID, miningRewardTag) {
+			continue
+		}
+		rec, err := dbClient.GetTransactionByID(ctx, txID)
+		if err != nil {
+			continue
+		}
+		publishEvent(events.TxConfirmed, []string{rec.SenderWalletID, rec.ReceiverWalletID}, map[string]interface{}{
+			"tx_id":       rec.TxID,
+			"sender_id":   rec.SenderWalletID,
+			"receiver_id": rec.ReceiverWalletID,
+			"amount":      rec.Amount,
+			"block_index": block.Index,
+			"block_hash":  block.Hash,
+		})
+		notifyWebhooks(ctx, rec.ReceiverWalletID, webhook.EventPaymentConfirmed, rec.TxID, map[string]interface{}{
+			"tx_id":       rec.TxID,
+			"sender_id":   rec.SenderWalletID,
+			"receiver_id": rec.ReceiverWalletID,
+			"amount":      rec.Amount,
+			"status":      "confirmed",
+			"block_index": block.Index,
+			"block_hash":  block.Hash,
+		})
+	}
+}
+
+// publishZakatRun announces a finished Zakat pass and its block
+func publishZakatRun(ctx context.Context, s scheduler.RunSummary) {
+	publishEvent(events.ZakatRun, nil, map[string]interface{}{
+		"run_at":  s.At,
+		"wallets": len(s.Deducted),
+		"total":   s.Total,
+	})
+	for walletID, amount := range s.Deducted {
+		publishEvent(events.ZakatRun, []string{walletID}, map[string]interface{}{
+			"run_at":    s.At,
+			"wallet_id": walletID,
+			"amount":    amount,
+		})
+	}
+	if s.Block != nil {
+		publishBlock(ctx, s.Block)
+	}
+}
+
+// publishSecurity tells a wallet's sessions about sign-ins and key use
+func publishSecurity(walletID, kind, details, ip string) {
+	publishEvent(events.Security, []string{walletID}, map[string]interface{}{
+		"wallet_id":  walletID,
+		"kind":       kind,
+		"details":    details,
+		"ip_address": ip,
+	})
+}
+
+// splitList parses a comma-separated query parameter
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// errForbiddenWallet is returned when a subscription names a wallet the
+// session does not own
+type errForbiddenWallet string
+
+func (e errForbiddenWallet) Error() string {
+	return "session is not authorised for wallet " + string(e)
+}
+
+// subscriptionFilter checks requested topics and wallets against the
+// session. With no wallets only public events are delivered.
+func subscriptionFilter(claims *session.Claims, topics, wallets []string) (events.Filter, error) {
+	for _, t := range topics {
+		if !events.ValidTopic(t) {
+			return events.Filter{}, fmt.Errorf("unknown topic %q", t)
+		}
+	}
+	wallets, err := normalizeAddressList(wallets)
+	if err != nil {
+		return events.Filter{}, err
+	}
+	for _, w := range wallets {
+		if !claims.HasWallet(w) {
+			return events.Filter{}, errForbiddenWallet(w)
+		}
+	}
+	return events.Filter{Topics: topics, Wallets: wallets}, nil
+}
+
+// openSubscription authorises a stream request and subscribes it, writing
+// the error response itself when it fails
+func openSubscription(w http.ResponseWriter, r *http.Request) (*session.Claims, *events.Subscription, bool) {
+	claims, err := requestSession(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	q := r.URL.Query()
+	wallets := splitList(q.Get("wallets"))
+	if len(wallets) == 0 {
+		wallets = claims.Wallets
+	}
+	filter, err := subscriptionFilter(claims, splitList(q.Get("topics")), wallets)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(errForbiddenWallet); ok {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return nil, nil, false
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+	return claims, eventBus.Subscribe(filter, lastID), true
+}
+
+// sessionTimer fires when the session's token expires
+func sessionTimer(claims *session.Claims) *time.Timer {
+	return time.NewTimer(time.Until(time.Unix(claims.ExpiresAt, 0)))
+}
+
+// eventsSSEHandler streams events as Server-Sent Events.
+//
+// Query parameters: topics and wallets (comma-separated), token and
+// last_event_id (or the Last-Event-ID header sent by EventSource on
+// reconnect). A "reset" event means the missed events are gone and the
+// client should reload its state.
+func eventsSSEHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	claims, sub, ok := openSubscription(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	if sub.Reset {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range sub.Replay {
+		writeSSE(w, ev)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	expiry := sessionTimer(claims)
+	defer expiry.Stop()
+
+	for {
+		select {
+		case ev, open := <-sub.C:
+			if !open {
+				// Dropped for falling behind; the client resumes from its last ID
+				return
+			}
+			writeSSE(w, ev)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-expiry.C:
+			fmt.Fprint(w, "event: expired\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE writes one event, named after its topic
+func writeSSE(w http.ResponseWriter, ev events.Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("Warning: failed to encode event %s: %v", ev.ID, err)
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Topic, data)
+}
+
+var wsUpgrader = websocket.Upgrader{
+	// Any origin may connect, as with the REST API; the session token is
+	// what authorises the stream
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsMessage is a frame sent to WebSocket clients
+type wsMessage struct {
+	Type    string        `json:"type"` // event, reset, subscribed, error or expired
+	Event   *events.Event `json:"event,omitempty"`
+	Topics  []string      `json:"topics,omitempty"`
+	Wallets []string      `json:"wallets,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// wsCommand changes a WebSocket subscription. subscribe adds the given
+// topics and wallets, unsubscribe removes them.
+type wsCommand struct {
+	Action  string   `json:"action"`
+	Topics  []string `json:"topics"`
+	Wallets []string `json:"wallets"`
+}
+
+// eventsWSHandler streams events over a WebSocket. It takes the same query
+// parameters as the SSE stream and accepts subscribe/unsubscribe commands.
+func eventsWSHandler(w http.ResponseWriter, r *http.Request) {
+	claims, sub, ok := openSubscription(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+	defer conn.Close()
+
+	send := func(m wsMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(m)
+	}
+
+	// The reader hands commands over so that only this goroutine writes
+	commands := make(chan wsCommand)
+	readErr := make(chan error, 1)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		for {
+			var cmd wsCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case commands <- cmd:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	current := sub.Filter()
+	if err := send(wsMessage{Type: "subscribed", Topics: current.Topics, Wallets: current.Wallets}); err != nil {
+		return
+	}
+	if sub.Reset {
+		if err := send(wsMessage{Type: "reset"}); err != nil {
+			return
+		}
+	}
+	for i := range sub.Replay {
+		if err := send(wsMessage{Type: "event", Event: &sub.Replay[i]}); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(eventKeepAlive)
+	defer ping.Stop()
+	expiry := sessionTimer(claims)
+	defer expiry.Stop()
+
+	for {
+		var err error
+		select {
+		case ev, open := <-sub.C:
+			if !open {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"),
+					time.Now().Add(wsWriteWait))
+				return
+			}
+			err = send(wsMessage{Type: "event", Event: &ev})
+		case cmd := <-commands:
+			err = send(applyWSCommand(claims, sub, cmd))
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+		case <-expiry.C:
+			send(wsMessage{Type: "expired"})
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session expired"),
+				time.Now().Add(wsWriteWait))
+			return
+		case <-readErr:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// applyWSCommand updates the subscription's filter and returns the reply
+func applyWSCommand(claims *session.Claims, sub *events.Subscription, cmd wsCommand) wsMessage {
+	f := sub.Filter()
+	topics, wallets := slices.Clone(f.Topics), slices.Clone(f.Wallets)
+	if len(topics) == 0 {
+		// No topics means all of them; spell that out so it can be narrowed
+		topics = events.Topics()
+	}
+	cmdWallets, err := normalizeAddressList(cmd.Wallets)
+	if err != nil {
+		return wsMessage{Type: "error", Error: err.Error()}
+	}
+	switch cmd.Action {
+	case "subscribe":
+		topics = appendMissing(topics, cmd.Topics)
+		wallets = appendMissing(wallets, cmdWallets)
+	case "unsubscribe":
+		topics = slices.DeleteFunc(topics, func(t string) bool { return slices.Contains(cmd.Topics, t) })
+		wallets = slices.DeleteFunc(wallets, func(wl string) bool { return slices.Contains(cmdWallets, wl) })
+		if len(topics) == 0 {
+			return wsMessage{Type: "error", Error: "cannot unsubscribe from every topic; close the connection instead"}
+		}
+	default:
+		return wsMessage{Type: "error", Error: fmt.Sprintf("unknown action %q", cmd.Action)}
+	}
+
+	next, err := subscriptionFilter(claims, topics, wallets)
+	if err != nil {
+		return wsMessage{Type: "error", Error: err.Error()}
+	}
+	sub.SetFilter(next)
+	return wsMessage{Type: "subscribed", Topics: next.Topics, Wallets: next.Wallets}
+}
+
+// appendMissing appends the items of add that list does not contain yet
+func appendMissing(list, add []string) []string {
+	for _, v := range add {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blockchain-wallet/pkg/db"
+)
+
+const (
+	defaultExplorerLimit = 20
+	maxExplorerLimit     = 100
+	defaultSeriesDays    = 30
+	maxSeriesDays        = 366
+)
+
+// explorerBlocksHandler pages through stored blocks, most recent first.
+//
+// Query parameters: limit and cursor.
+func explorerBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, err := parseLimit(q.Get("limit"), defaultExplorerLimit, maxExplorerLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var after *db.BlockCursor
+	if v := q.Get("cursor"); v != "" {
+		if after, err = db.DecodeBlockCursor(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one extra row to know whether another page follows
+	blocks, err := dbClient.ListBlocks(r.Context(), after, limit+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nextCursor := ""
+	if len(blocks) > limit {
+		blocks = blocks[:limit]
+		nextCursor = db.BlockCursorFor(blocks[len(blocks)-1]).Encode()
+	}
+	if blocks == nil {
+		blocks = []db.BlockRecord{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"blocks":      blocks,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// explorerBlockHandler looks a block up by hash or height
+func explorerBlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var block *db.BlockRecord
+	var err error
+	switch {
+	case q.Get("hash") != "":
+		block, err = dbClient.GetBlockByHash(r.Context(), q.Get("hash"))
+	case q.Get("height") != "":
+		height, perr := strconv.ParseInt(q.Get("height"), 10, 64)
+		if perr != nil || height < 0 {
+			http.Error(w, "height must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		block, err = dbClient.GetBlockByHeight(r.Context(), height)
+	default:
+		http.Error(w, "hash or height required", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "block not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, block)
+}
+
+// explorerAddressHandler summarises a wallet's activity
+func explorerAddressHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	walletID := r.URL.Query().Get("wallet")
+	if walletID == "" {
+		http.Error(w, "missing wallet param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
+	stats, err := dbClient.GetAddressStats(r.Context(), walletID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+// explorerRichListHandler returns the wallets holding the most coins
+func explorerRichListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query().Get("limit"), defaultExplorerLimit, maxExplorerLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := dbClient.GetRichList(r.Context(), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []db.AddressStats{}
+	}
+	writeJSON(w, map[string]interface{}{"addresses": list})
+}
+
+// explorerSeriesHandler returns daily transaction counts, volume, blocks and
+// average difficulty for the last `days` days (default 30), one entry per
+// day with zeros for quiet days
+func explorerSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultSeriesDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSeriesDays {
+			http.Error(w, "days must be between 1 and 366", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -(days - 1))
+	stats, err := dbClient.GetDailyStats(r.Context(), start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byDay := make(map[string]db.DailyStats, len(stats))
+	for _, d := range stats {
+		byDay[d.Day] = d
+	}
+	series := make([]db.DailyStats, 0, days)
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		entry, ok := byDay[key]
+		if !ok {
+			entry = db.DailyStats{Day: key}
+		}
+		series = append(series, entry)
+	}
+
+	writeJSON(w, map[string]interface{}{"days": series})
+}
+
+// explorerStatsHandler reports network-wide figures: supply, counts, average
+// block time, current difficulty and the mempool size
+func explorerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := dbClient.GetChainStats(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"total_supply":   stats.TotalSupply,
+		"utxo_count":     stats.UTXOCount,
+		"tx_count":       stats.TxCount,
+		"block_count":    stats.BlockCount,
+		"first_block_at": stats.FirstBlockAt,
+		"last_block_at":  stats.LastBlockAt,
+		"avg_block_time": stats.AvgBlockTime,
+		"difficulty":     bc.GetDifficulty(),
+		"chain_length":   bc.GetChainLength(),
+		"mempool_size":   len(bc.GetPendingTransactions()),
+	})
+}
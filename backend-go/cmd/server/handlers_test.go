@@ -0,0 +1,1131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/db"
+	"blockchain-wallet/pkg/directory"
+	"blockchain-wallet/pkg/invoice"
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/orders"
+	"blockchain-wallet/pkg/psbt"
+	"blockchain-wallet/pkg/recovery"
+	"blockchain-wallet/pkg/scheduler"
+	"blockchain-wallet/pkg/session"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+	"blockchain-wallet/pkg/webhook"
+)
+
+// memStore is an in-memory db.Store holding what the handlers under test
+// touch. Methods it does not override panic on the nil embedded Store, so a
+// handler reaching for more fails the test loudly.
+type memStore struct {
+	db.Store
+
+	mu       sync.Mutex
+	wallets  map[string]bool
+	external map[string]bool // wallets registered as transfer recipients only
+	utxos    map[string]*db.UTXO
+	txs      []db.TxRecord
+	logs     []string
+
+	blockErr    error // returned by InsertBlock
+	blockWrites int
+
+	userWallets map[string]string // user ID to wallet ID
+	endpoints   []webhook.Endpoint
+	orders      map[string]orders.Order
+	multisigs   map[string]multisig.Wallet
+	proposals   map[string]multisig.Proposal
+	invoices    []invoice.Invoice
+	recoveries  map[string]recovery.Request
+	setups      map[string]recovery.Setup // by wallet ID
+}
+
+func newMemStore() *memStore {
+	return &memStore{wallets: map[string]bool{}, external: map[string]bool{}, utxos: map[string]*db.UTXO{}, userWallets: map[string]string{},
+		orders: map[string]orders.Order{}, multisigs: map[string]multisig.Wallet{}, proposals: map[string]multisig.Proposal{},
+		recoveries: map[string]recovery.Request{}, setups: map[string]recovery.Setup{}}
+}
+
+func (m *memStore) addUTXO(id, owner, assetID string, amount int64, lock *utxo.Lock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.utxos[id] = &db.UTXO{UTXOID: id, Owner: owner, Amount: amount, Lock: lock, Asset: assetID, CreatedAt: time.Now()}
+}
+
+func (m *memStore) InsertUTXO(ctx context.Context, utxoID, owner string, amount int64) error {
+	m.addUTXO(utxoID, owner, "", amount, nil)
+	return nil
+}
+
+func (m *memStore) InsertLockedUTXO(ctx context.Context, utxoID, owner string, amount int64, lock utxo.Lock) error {
+	m.addUTXO(utxoID, owner, "", amount, &lock)
+	return nil
+}
+
+func (m *memStore) InsertAssetUTXO(ctx context.Context, utxoID, owner, assetID string, amount int64, lock *utxo.Lock) error {
+	m.addUTXO(utxoID, owner, assetID, amount, lock)
+	return nil
+}
+
+func (m *memStore) GetUTXOByID(ctx context.Context, utxoID string) (*db.UTXO, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.utxos[utxoID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (m *memStore) GetUnspentUTXOs(ctx context.Context, walletID string) ([]db.UTXO, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []db.UTXO
+	for _, u := range m.utxos {
+		if u.Owner == walletID && !u.Spent {
+			out = append(out, *u)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UTXOID < out[j].UTXOID })
+	return out, nil
+}
+
+func (m *memStore) GetBalance(ctx context.Context, walletID string) (int64, error) {
+	us, _ := m.GetUnspentUTXOs(ctx, walletID)
+	var bal int64
+	for _, u := range us {
+		if u.Asset == "" {
+			bal += u.Amount
+		}
+	}
+	return bal, nil
+}
+
+func (m *memStore) SpendUTXOAt(ctx context.Context, utxoID, txID string, height, now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.utxos[utxoID]
+	if !ok || u.Spent {
+		return errors.New("utxo not found or already spent")
+	}
+	u.Spent, u.SpentInTxID = true, txID
+	return nil
+}
+
+func (m *memStore) InsertTransaction(ctx context.Context, rec db.TxRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	m.txs = append(m.txs, rec)
+	return nil
+}
+
+func (m *memStore) ApplyTransfer(ctx context.Context, t db.Transfer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, in := range t.Inputs {
+		if u, ok := m.utxos[in]; !ok || u.Spent {
+			return fmt.Errorf("spend %s: %w", in, db.ErrUTXOUnavailable)
+		}
+	}
+	for _, o := range t.Outputs {
+		if !m.wallets[o.Owner] && !m.external[o.Owner] && !(t.RegisterReceiver && o.Owner == t.Record.ReceiverWalletID) {
+			return fmt.Errorf("insert output %s: no wallet %s", o.ID, o.Owner)
+		}
+	}
+	if t.RegisterReceiver {
+		m.external[t.Record.ReceiverWalletID] = true
+	}
+	for _, in := range t.Inputs {
+		m.utxos[in].Spent, m.utxos[in].SpentInTxID = true, t.Record.TxID
+	}
+	for _, o := range t.Outputs {
+		m.utxos[o.ID] = &db.UTXO{UTXOID: o.ID, Owner: o.Owner, Amount: o.Amount, Lock: o.Lock, Asset: o.Asset, CreatedAt: time.Now()}
+	}
+	if t.Record.CreatedAt.IsZero() {
+		t.Record.CreatedAt = time.Now()
+	}
+	m.txs = append(m.txs, t.Record)
+	return nil
+}
+
+func (m *memStore) GetTransactionByID(ctx context.Context, txID string) (*db.TxRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.txs {
+		if m.txs[i].TxID == txID {
+			rec := m.txs[i]
+			return &rec, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) InsertLog(ctx context.Context, walletID, action, details, status, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logs = append(m.logs, walletID+" "+action)
+	return nil
+}
+
+func (m *memStore) QueryLogs(ctx context.Context, f db.LogFilter, after *db.LogCursor, limit int) ([]db.LogEntry, error) {
+	return nil, nil
+}
+
+func (m *memStore) ListAudit(ctx context.Context, f audit.Filter, afterSeq int64, limit int) ([]audit.Entry, error) {
+	return nil, nil
+}
+
+func (m *memStore) GetDirectoryEntry(ctx context.Context, walletID string) (directory.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.wallets[walletID] {
+		return directory.Entry{}, sql.ErrNoRows
+	}
+	return directory.Entry{WalletID: walletID}, nil
+}
+
+func (m *memStore) InsertBlock(ctx context.Context, block *blockchain.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blockWrites++
+	return m.blockErr
+}
+
+func (m *memStore) GetUserWalletByUserID(ctx context.Context, userID string) (*db.Wallet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.userWallets[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &db.Wallet{UserID: userID, WalletID: id}, nil
+}
+
+func (m *memStore) InsertWebhookEndpoint(ctx context.Context, e webhook.Endpoint) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = fmt.Sprintf("wh-%d", len(m.endpoints)+1)
+	m.endpoints = append(m.endpoints, e)
+	return e.ID, nil
+}
+
+func (m *memStore) InsertStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if registerReceiver {
+		m.external[o.ReceiverWalletID] = true
+	}
+	o.ID = fmt.Sprintf("so-%d", len(m.orders)+1)
+	m.orders[o.ID] = o
+	return o.ID, nil
+}
+
+func (m *memStore) GetStandingOrder(ctx context.Context, id, userID string) (orders.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[id]
+	if !ok || o.UserID != userID {
+		return orders.Order{}, sql.ErrNoRows
+	}
+	return o, nil
+}
+
+func (m *memStore) UpdateStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if registerReceiver {
+		m.external[o.ReceiverWalletID] = true
+	}
+	m.orders[o.ID] = o
+	return nil
+}
+
+func (m *memStore) InsertInvoice(ctx context.Context, inv invoice.Invoice) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inv.ID = fmt.Sprintf("inv-%d", len(m.invoices)+1)
+	m.invoices = append(m.invoices, inv)
+	return inv.ID, nil
+}
+
+func (m *memStore) GetInvoice(ctx context.Context, id, userID string) (invoice.Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, inv := range m.invoices {
+		if inv.ID == id && inv.UserID == userID {
+			return inv, nil
+		}
+	}
+	return invoice.Invoice{}, sql.ErrNoRows
+}
+
+func (m *memStore) GetInvoices(ctx context.Context, userID, status string, limit int) ([]invoice.Invoice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []invoice.Invoice
+	for _, inv := range m.invoices {
+		if inv.UserID == userID && (status == "" || inv.Status == status) {
+			out = append(out, inv)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) GetInvoicePayments(ctx context.Context, invoiceID string) ([]invoice.Payment, error) {
+	return nil, nil
+}
+
+func (m *memStore) GetMultisigWallet(ctx context.Context, address string) (multisig.Wallet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.multisigs[address]
+	if !ok {
+		return w, sql.ErrNoRows
+	}
+	return w, nil
+}
+
+func (m *memStore) InsertMultisigWallet(ctx context.Context, w multisig.Wallet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.multisigs[w.Address] = w
+	m.wallets[w.Address] = true
+	return nil
+}
+
+func (m *memStore) InsertMultisigProposal(ctx context.Context, p multisig.Proposal) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.ID = fmt.Sprintf("mp-%d", len(m.proposals)+1)
+	m.proposals[p.ID] = p
+	return p.ID, nil
+}
+
+func (m *memStore) GetMultisigProposal(ctx context.Context, id string) (multisig.Proposal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.proposals[id]
+	if !ok {
+		return p, sql.ErrNoRows
+	}
+	p.Signatures = append([]multisig.Signature{}, p.Signatures...)
+	return p, nil
+}
+
+func (m *memStore) AddMultisigSignature(ctx context.Context, proposalID string, s multisig.Signature) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.proposals[proposalID]
+	p.Signatures = append(p.Signatures, s)
+	m.proposals[proposalID] = p
+	return nil
+}
+
+func (m *memStore) CloseMultisigProposal(ctx context.Context, id, status, txID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.proposals[id]
+	if !ok || p.Status != multisig.ProposalPending {
+		return sql.ErrNoRows
+	}
+	p.Status, p.TxID = status, txID
+	m.proposals[id] = p
+	return nil
+}
+
+func (m *memStore) GetUserByWalletID(ctx context.Context, walletID string) (*db.Profile, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) GetRecoverySetup(ctx context.Context, walletID string) (recovery.Setup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.setups[walletID]
+	if !ok {
+		return s, sql.ErrNoRows
+	}
+	return s, nil
+}
+
+func (m *memStore) InsertRecoveryRequest(ctx context.Context, r recovery.Request, ipAddress string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ID = fmt.Sprintf("rr-%d", len(m.recoveries)+1)
+	m.recoveries[r.ID] = r
+	return r.ID, nil
+}
+
+func (m *memStore) GetRecoveryRequest(ctx context.Context, id string) (recovery.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.recoveries[id]
+	if !ok {
+		return r, sql.ErrNoRows
+	}
+	return r, nil
+}
+
+// history returns the transactions matching the wallet and direction of f,
+// newest first
+func (m *memStore) history(f db.HistoryFilter) []db.TxRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []db.TxRecord
+	for _, t := range m.txs {
+		sent, received := t.SenderWalletID == f.WalletID, t.ReceiverWalletID == f.WalletID
+		switch {
+		case f.Direction == db.DirectionSent && !sent,
+			f.Direction == db.DirectionReceived && !received,
+			!sent && !received:
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].TxID > out[j].TxID
+	})
+	return out
+}
+
+func (m *memStore) QueryTransactionHistory(ctx context.Context, f db.HistoryFilter, after *db.HistoryCursor, limit int) ([]db.TxRecord, error) {
+	var page []db.TxRecord
+	for _, t := range m.history(f) {
+		if after != nil && !(t.CreatedAt.Before(after.CreatedAt) ||
+			t.CreatedAt.Equal(after.CreatedAt) && t.TxID < after.TxID) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, t)
+	}
+	return page, nil
+}
+
+func (m *memStore) GetTransactionTotals(ctx context.Context, f db.HistoryFilter) (db.HistoryTotals, error) {
+	var tot db.HistoryTotals
+	for _, t := range m.history(f) {
+		tot.Count++
+		if t.SenderWalletID == f.WalletID {
+			tot.Sent += t.Amount
+		}
+		if t.ReceiverWalletID == f.WalletID {
+			tot.Received += t.Amount
+		}
+	}
+	return tot, nil
+}
+
+// useMemStore points the handlers at a fresh in-memory store and chain for
+// the length of a test
+func useMemStore(t *testing.T) *memStore {
+	t.Helper()
+	m := newMemStore()
+	oldDB, oldBC, oldMgr := dbClient, bc, utxoMgr
+	dbClient, bc, utxoMgr = m, blockchain.NewBlockchain(1), utxo.NewManager()
+	t.Cleanup(func() { dbClient, bc, utxoMgr = oldDB, oldBC, oldMgr })
+	return m
+}
+
+// useSessions gives the handlers a session manager for the length of a test
+func useSessions(t *testing.T) *session.Manager {
+	t.Helper()
+	mgr, err := session.NewManager(bytes.Repeat([]byte{7}, 32), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := sessions
+	sessions = mgr
+	t.Cleanup(func() { sessions = old })
+	return mgr
+}
+
+// serve runs one request through a handler and decodes a 200 JSON reply
+// into out
+func serve(t *testing.T, h http.HandlerFunc, method, target string, body interface{}, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var rd bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&rd).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(method, target, &rd))
+	if rec.Code == http.StatusOK && out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// signedTransfer builds an APITx for a transfer whose payload is signed by
+// priv, as older clients sign it
+func signedTransfer(priv []byte, pub []byte, receiver string, amount int64, note string, inputs []string) APITx {
+	txx := tx.NewTransaction(crypto.WalletIDFromPub(pub), receiver, amount, note, inputs)
+	sig := crypto.SignPayload(priv, txx.Payload())
+	return APITx{
+		SenderID:   txx.SenderID,
+		ReceiverID: receiver,
+		Amount:     amount,
+		Note:       note,
+		Inputs:     inputs,
+		SenderPub:  base64.StdEncoding.EncodeToString(pub),
+		Signature:  base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+func TestBalanceHandler(t *testing.T) {
+	m := useMemStore(t)
+	_, pub, _ := crypto.GenerateKeypair()
+	wallet := crypto.WalletIDFromPub(pub)
+	m.addUTXO("a", wallet, "", 40, nil)
+	m.addUTXO("b", wallet, "", 25, &utxo.Lock{Kind: utxo.LockTime, Height: 1000})
+	m.addUTXO("c", wallet, "gold", 7, nil)
+	m.addUTXO("d", "someone-else", "", 99, nil)
+
+	var resp struct {
+		Wallet    string                   `json:"wallet"`
+		Address   string                   `json:"address"`
+		Balance   int64                    `json:"balance"`
+		Spendable int64                    `json:"spendable"`
+		Assets    map[string]*assetBalance `json:"assets"`
+		UTXOs     []db.UTXO                `json:"utxos"`
+	}
+	// Wallets may be named by address as well as by ID
+	rec := serve(t, balanceHandler, http.MethodGet, "/wallet/balance?wallet="+addressOf(wallet), nil, &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Wallet != wallet || resp.Address != addressOf(wallet) {
+		t.Fatalf("wallet %q address %q", resp.Wallet, resp.Address)
+	}
+	if resp.Balance != 65 || resp.Spendable != 40 {
+		t.Fatalf("balance %d spendable %d, want 65 and 40", resp.Balance, resp.Spendable)
+	}
+	if g := resp.Assets["gold"]; g == nil || g.Balance != 7 || g.Spendable != 7 {
+		t.Fatalf("gold balance %+v", g)
+	}
+	if len(resp.UTXOs) != 3 {
+		t.Fatalf("%d utxos, want 3", len(resp.UTXOs))
+	}
+
+	if rec := serve(t, balanceHandler, http.MethodGet, "/wallet/balance", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing wallet: status %d", rec.Code)
+	}
+	if rec := serve(t, balanceHandler, http.MethodGet, "/wallet/balance?wallet=cw1notanaddress", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad address: status %d", rec.Code)
+	}
+}
+
+func TestTxSubmitSignatureForms(t *testing.T) {
+	m := useMemStore(t)
+	priv, pub, _ := crypto.GenerateKeypair()
+	_, rpub, _ := crypto.GenerateKeypair()
+	sender, receiver := crypto.WalletIDFromPub(pub), crypto.WalletIDFromPub(rpub)
+	m.wallets[sender], m.wallets[receiver] = true, true
+	for _, id := range []string{"in-payload", "in-sighash", "in-psbt", "in-bad"} {
+		m.addUTXO(id, sender, "", 100, nil)
+	}
+
+	// Signed over the payload, as older clients sign
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", signedTransfer(priv, pub, receiver, 10, "", []string{"in-payload"}), nil); rec.Code != http.StatusOK {
+		t.Fatalf("payload signature: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Signed over the signature hash
+	txx := tx.NewTransaction(sender, receiver, 10, "", []string{"in-sighash"})
+	at := signedTransfer(priv, pub, receiver, 10, "", []string{"in-sighash"})
+	at.Signature = base64.StdEncoding.EncodeToString(crypto.SignPayload(priv, txx.SigHash()))
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", at, nil); rec.Code != http.StatusOK {
+		t.Fatalf("signature hash signature: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A signed packet
+	txx = tx.NewTransaction(sender, receiver, 10, "", []string{"in-psbt"})
+	p, err := psbt.New(txx, []*utxo.UTXO{{ID: "in-psbt", Owner: sender, Amount: 100}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := p.Encode()
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", APITx{PSBT: enc}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("packet: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A signature over anything else is refused
+	at = signedTransfer(priv, pub, receiver, 10, "", []string{"in-bad"})
+	at.Signature = base64.StdEncoding.EncodeToString(crypto.SignPayload(priv, []byte("something else")))
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", at, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad signature: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(m.txs) != 3 {
+		t.Fatalf("recorded %d transactions, want 3", len(m.txs))
+	}
+}
+
+func TestTxSubmitHandler(t *testing.T) {
+	m := useMemStore(t)
+	priv, pub, _ := crypto.GenerateKeypair()
+	_, rpub, _ := crypto.GenerateKeypair()
+	sender, receiver := crypto.WalletIDFromPub(pub), crypto.WalletIDFromPub(rpub)
+	m.wallets[sender], m.wallets[receiver] = true, true
+	m.addUTXO("in1", sender, "", 100, nil)
+
+	at := signedTransfer(priv, pub, receiver, 30, "rent", []string{"in1"})
+	var resp struct {
+		Status string `json:"status"`
+		TxID   string `json:"txid"`
+	}
+	rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", at, &resp)
+	if rec.Code != http.StatusOK || resp.Status != "accepted" {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if u, _ := m.GetUTXOByID(context.Background(), "in1"); !u.Spent || u.SpentInTxID != resp.TxID {
+		t.Fatalf("input not spent by %s: %+v", resp.TxID, u)
+	}
+	if b, _ := m.GetBalance(context.Background(), receiver); b != 30 {
+		t.Fatalf("receiver balance %d, want 30", b)
+	}
+	if b, _ := m.GetBalance(context.Background(), sender); b != 70 {
+		t.Fatalf("sender change %d, want 70", b)
+	}
+	if len(m.txs) != 1 || m.txs[0].TxID != resp.TxID {
+		t.Fatalf("recorded transactions %+v", m.txs)
+	}
+	if pending := bc.GetPendingTransactions(); len(pending) != 1 || pending[0] != resp.TxID {
+		t.Fatalf("pending %v", pending)
+	}
+
+	// The same signed request again spends nothing
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", at, nil); rec.Code != http.StatusConflict ||
+		!strings.Contains(rec.Body.String(), "already applied") {
+		t.Fatalf("replay: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	m.addUTXO("in2", sender, "", 50, nil)
+	cases := map[string]func(*APITx){
+		"tampered amount":  func(a *APITx) { a.Amount = 45 },
+		"foreign input":    func(a *APITx) { a.Inputs = []string{"theirs"} },
+		"unknown receiver": func(a *APITx) { *a = signedTransfer(priv, pub, strings.Repeat("ab", 32), 5, "", []string{"in2"}) },
+		"overspend":        func(a *APITx) { *a = signedTransfer(priv, pub, receiver, 60, "", []string{"in2"}) },
+	}
+	m.addUTXO("theirs", receiver, "", 50, nil)
+	for name, mutate := range cases {
+		a := signedTransfer(priv, pub, receiver, 5, "", []string{"in2"})
+		mutate(&a)
+		if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", a, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+	if u, _ := m.GetUTXOByID(context.Background(), "in2"); u.Spent {
+		t.Fatal("a refused transfer spent its input")
+	}
+
+	// An allowed unknown receiver is registered only once the transfer applies
+	unknown := strings.Repeat("ab", 32)
+	a := signedTransfer(priv, pub, unknown, 60, "", []string{"in2"})
+	a.AllowUnknown = true
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", a, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("overspend to unknown: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.external[unknown] {
+		t.Fatal("a refused transfer registered its receiver")
+	}
+	a = signedTransfer(priv, pub, unknown, 5, "", []string{"in2"})
+	a.AllowUnknown = true
+	if rec := serve(t, txSubmitHandler, http.MethodPost, "/tx/submit", a, nil); rec.Code != http.StatusOK {
+		t.Fatalf("allow_unknown: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if !m.external[unknown] {
+		t.Fatal("allowed unknown receiver not registered")
+	}
+}
+
+func TestTransactionHistoryHandler(t *testing.T) {
+	m := useMemStore(t)
+	a, b, c := strings.Repeat("a", 64), strings.Repeat("b", 64), strings.Repeat("c", 64)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, r := range []db.TxRecord{
+		{TxID: "t1", SenderWalletID: a, ReceiverWalletID: b, Amount: 10},
+		{TxID: "t2", SenderWalletID: b, ReceiverWalletID: a, Amount: 4},
+		{TxID: "t3", SenderWalletID: a, ReceiverWalletID: c, Amount: 6},
+		{TxID: "t4", SenderWalletID: b, ReceiverWalletID: c, Amount: 100},
+	} {
+		r.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		m.txs = append(m.txs, r)
+	}
+
+	type page struct {
+		Transactions []db.TxRecord    `json:"transactions"`
+		NextCursor   string           `json:"next_cursor"`
+		HasMore      bool             `json:"has_more"`
+		Totals       db.HistoryTotals `json:"totals"`
+	}
+	var p page
+	rec := serve(t, transactionHistoryHandler, http.MethodGet, "/wallet/history?wallet="+a+"&limit=2", nil, &p)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(p.Transactions) != 2 || p.Transactions[0].TxID != "t3" || p.Transactions[1].TxID != "t2" || !p.HasMore {
+		t.Fatalf("first page %+v", p)
+	}
+	if p.Totals != (db.HistoryTotals{Count: 3, Sent: 16, Received: 4}) {
+		t.Fatalf("totals %+v", p.Totals)
+	}
+
+	var next page
+	serve(t, transactionHistoryHandler, http.MethodGet, "/wallet/history?wallet="+a+"&limit=2&cursor="+p.NextCursor, nil, &next)
+	if len(next.Transactions) != 1 || next.Transactions[0].TxID != "t1" || next.HasMore {
+		t.Fatalf("second page %+v", next)
+	}
+
+	var sent page
+	serve(t, transactionHistoryHandler, http.MethodGet, "/wallet/history?wallet="+a+"&direction=sent", nil, &sent)
+	if len(sent.Transactions) != 2 || sent.Totals.Received != 0 {
+		t.Fatalf("sent %+v", sent)
+	}
+
+	for _, q := range []string{"", "?wallet=" + a + "&direction=sideways", "?wallet=" + a + "&limit=-1", "?wallet=" + a + "&cursor=bogus"} {
+		if rec := serve(t, transactionHistoryHandler, http.MethodGet, "/wallet/history"+q, nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d", q, rec.Code)
+		}
+	}
+}
+
+func TestMineHandlerReportsUnstoredBlock(t *testing.T) {
+	m := useMemStore(t)
+	m.blockErr = errors.New("disk full")
+	bc.AddPendingTransaction("tx-1")
+
+	rec := serve(t, mineHandler, http.MethodPost, "/blockchain/mine", MineReq{MinerAddress: strings.Repeat("a", 64)}, nil)
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "disk full") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.blockWrites != blockStoreAttempts {
+		t.Fatalf("%d writes, want %d", m.blockWrites, blockStoreAttempts)
+	}
+}
+
+func TestWebhookCreateHandler(t *testing.T) {
+	m := useMemStore(t)
+	mgr := useSessions(t)
+	wallet := strings.Repeat("d", 64)
+	m.userWallets["user-1"] = wallet
+	token, _, _ := mgr.Issue("user-1", []string{wallet})
+	stranger, _, _ := mgr.Issue("user-2", nil)
+
+	create := func(token, url string) *httptest.ResponseRecorder {
+		return serve(t, webhookCreateHandler, http.MethodPost, "/webhooks/create?token="+token,
+			CreateWebhookReq{URL: url}, nil)
+	}
+	if rec := create("", "https://shop.example/hooks"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: status %d", rec.Code)
+	}
+	if rec := create(stranger, "https://shop.example/hooks"); rec.Code != http.StatusNotFound {
+		t.Fatalf("user without a wallet: status %d", rec.Code)
+	}
+	for _, url := range []string{"http://127.0.0.1:8080/", "http://169.254.169.254/latest/meta-data", "http://localhost/"} {
+		if rec := create(token, url); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", url, rec.Code)
+		}
+	}
+	if rec := create(token, "https://shop.example/hooks"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(m.endpoints) != 1 || m.endpoints[0].UserID != "user-1" || m.endpoints[0].WalletID != wallet {
+		t.Fatalf("endpoints %+v", m.endpoints)
+	}
+}
+
+func TestOrderHandlersRequireSession(t *testing.T) {
+	m := useMemStore(t)
+	mgr := useSessions(t)
+	wallet, payee := strings.Repeat("d", 64), strings.Repeat("e", 64)
+	m.userWallets["user-1"] = wallet
+	m.wallets[payee] = true
+	token, _, _ := mgr.Issue("user-1", []string{wallet})
+	stranger, _, _ := mgr.Issue("user-2", nil)
+
+	req := CreateOrderReq{ReceiverWalletID: payee, Amount: 5, Schedule: "0 9 1 * *"}
+	if rec := serve(t, orderCreateHandler, http.MethodPost, "/orders/create", req, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: status %d", rec.Code)
+	}
+	req.UserID = "user-2"
+	if rec := serve(t, orderCreateHandler, http.MethodPost, "/orders/create?token="+token, req, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("another user_id: status %d", rec.Code)
+	}
+	req.UserID = ""
+	var o orders.Order
+	if rec := serve(t, orderCreateHandler, http.MethodPost, "/orders/create?token="+token, req, &o); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if o.UserID != "user-1" || o.SenderWalletID != wallet {
+		t.Fatalf("order %+v", o)
+	}
+
+	// Only the owner's session can act on the order
+	action := OrderActionReq{OrderID: o.ID}
+	if rec := serve(t, orderPauseHandler, http.MethodPost, "/orders/pause?token="+stranger, action, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("stranger pausing: status %d", rec.Code)
+	}
+	if rec := serve(t, orderPauseHandler, http.MethodPost, "/orders/pause?token="+token, action, nil); rec.Code != http.StatusOK {
+		t.Fatalf("owner pausing: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.orders[o.ID].Status != orders.StatusPaused {
+		t.Fatalf("order %+v", m.orders[o.ID])
+	}
+}
+
+func TestOrderUpdateChecksRecipient(t *testing.T) {
+	m := useMemStore(t)
+	mgr := useSessions(t)
+	wallet, payee, unknown := strings.Repeat("d", 64), strings.Repeat("e", 64), strings.Repeat("f", 64)
+	m.userWallets["user-1"] = wallet
+	m.wallets[payee] = true
+	token, _, _ := mgr.Issue("user-1", []string{wallet})
+
+	var o orders.Order
+	create := CreateOrderReq{ReceiverWalletID: payee, Amount: 5, Schedule: "0 9 1 * *"}
+	if rec := serve(t, orderCreateHandler, http.MethodPost, "/orders/create?token="+token, create, &o); rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A new receiver is checked as on create
+	update := UpdateOrderReq{OrderID: o.ID, ReceiverWalletID: &unknown}
+	if rec := serve(t, orderUpdateHandler, http.MethodPost, "/orders/update?token="+token, update, nil); rec.Code != http.StatusBadRequest ||
+		!strings.Contains(rec.Body.String(), "not a registered wallet") {
+		t.Fatalf("unknown receiver: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.orders[o.ID].ReceiverWalletID != payee || m.external[unknown] {
+		t.Fatalf("refused update changed the order: %+v", m.orders[o.ID])
+	}
+	update.AllowUnknown = true
+	if rec := serve(t, orderUpdateHandler, http.MethodPost, "/orders/update?token="+token, update, nil); rec.Code != http.StatusOK {
+		t.Fatalf("allow_unknown: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.orders[o.ID].ReceiverWalletID != unknown || !m.external[unknown] {
+		t.Fatalf("order %+v", m.orders[o.ID])
+	}
+}
+
+func TestMultisigCreateHandler(t *testing.T) {
+	m := useMemStore(t)
+	mgr := useSessions(t)
+	token, _, _ := mgr.Issue("user-1", nil)
+	var keys []string
+	for i := 0; i < 2; i++ {
+		_, pub, _ := crypto.GenerateKeypair()
+		keys = append(keys, base64.StdEncoding.EncodeToString(pub))
+	}
+
+	req := CreateMultisigReq{Name: "treasury", Threshold: 2, PublicKeys: keys}
+	if rec := serve(t, multisigCreateHandler, http.MethodPost, "/multisig/create", req, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: status %d", rec.Code)
+	}
+	req.UserID = "user-2"
+	if rec := serve(t, multisigCreateHandler, http.MethodPost, "/multisig/create?token="+token, req, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("another user_id: status %d", rec.Code)
+	}
+	if len(m.multisigs) != 0 {
+		t.Fatalf("refused request created %+v", m.multisigs)
+	}
+	req.UserID = ""
+	var mw multisig.Wallet
+	if rec := serve(t, multisigCreateHandler, http.MethodPost, "/multisig/create?token="+token, req, &mw); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if m.multisigs[mw.Address].CreatedBy != "user-1" {
+		t.Fatalf("wallet %+v", m.multisigs[mw.Address])
+	}
+}
+
+func TestMultisigExecuteHandler(t *testing.T) {
+	m := useMemStore(t)
+	var privs []string
+	var keys []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		priv, pub, _ := crypto.GenerateKeypair()
+		privs = append(privs, base64.StdEncoding.EncodeToString(priv))
+		keys = append(keys, pub)
+	}
+	policy, err := multisig.NewPolicy(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := policy.Address()
+	m.multisigs[wallet] = multisig.Wallet{Address: wallet, Policy: policy}
+	m.wallets[wallet] = true
+	_, rpub, _ := crypto.GenerateKeypair()
+	receiver := crypto.WalletIDFromPub(rpub)
+	m.wallets[receiver] = true
+	m.addUTXO("ms1", wallet, "", 100, nil)
+
+	// A cosigner signing on their own must know the inputs they sign for
+	propose := ProposeReq{WalletID: wallet, ReceiverID: receiver, Amount: 30, Timestamp: 1700000000,
+		CosignerAuth: CosignerAuth{PublicKey: base64.StdEncoding.EncodeToString(keys[0]), Signature: base64.StdEncoding.EncodeToString(make([]byte, 64))}}
+	if rec := serve(t, multisigProposeHandler, http.MethodPost, "/multisig/propose", propose, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("signed proposal without inputs: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	propose.CosignerAuth = CosignerAuth{PrivateKey: privs[0]}
+	var view proposalView
+	if rec := serve(t, multisigProposeHandler, http.MethodPost, "/multisig/propose", propose, &view); rec.Code != http.StatusOK {
+		t.Fatalf("propose: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(view.Inputs) != 1 || view.Inputs[0] != "ms1" || string(view.Payload) != string(view.Transaction().SigHash()) {
+		t.Fatalf("proposal %+v should sign the hash of a transaction spending ms1", view.Proposal)
+	}
+	sign := map[string]string{"proposal_id": view.ID, "private_key": privs[2]}
+	if rec := serve(t, multisigSignHandler, http.MethodPost, "/multisig/sign", sign, &view); rec.Code != http.StatusOK || !view.Ready {
+		t.Fatalf("sign: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		TxID string `json:"txid"`
+	}
+	execute := map[string]string{"proposal_id": view.ID}
+	if rec := serve(t, multisigExecuteHandler, http.MethodPost, "/multisig/execute", execute, &resp); rec.Code != http.StatusOK {
+		t.Fatalf("execute: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The stored transaction verifies as the chain checks it
+	if len(m.txs) != 1 || m.txs[0].TxID != resp.TxID {
+		t.Fatalf("recorded transactions %+v", m.txs)
+	}
+	stored := view.Transaction()
+	stored.SenderPub, stored.Signature = m.txs[0].SenderPublicKey, m.txs[0].Signature
+	if stored.ID != resp.TxID {
+		t.Fatalf("executed %s, approvals cover %s", resp.TxID, stored.ID)
+	}
+	if err := multisig.VerifyTransaction(stored); err != nil {
+		t.Fatalf("stored witness rejected: %v", err)
+	}
+	if u, _ := m.GetUTXOByID(context.Background(), "ms1"); !u.Spent || u.SpentInTxID != resp.TxID {
+		t.Fatalf("input not spent by %s: %+v", resp.TxID, u)
+	}
+	if p := m.proposals[view.ID]; p.Status != multisig.ProposalExecuted || p.TxID != resp.TxID {
+		t.Fatalf("proposal %+v", p)
+	}
+	if rec := serve(t, multisigExecuteHandler, http.MethodPost, "/multisig/execute", execute, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("second execution: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJobHandlersRequireAdmin(t *testing.T) {
+	mgr := useSessions(t)
+	runs := 0
+	old := jobRunner
+	jobRunner = jobs.NewScheduler(nil, nil, nil)
+	t.Cleanup(func() { jobRunner = old })
+	if err := jobRunner.Register(jobs.Job{Name: "noop", Schedule: "0 0 * * *", Run: func(context.Context) error {
+		runs++
+		return nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	user, _, _ := mgr.Issue("user-1", nil)
+	admin, _, _ := mgr.IssueAdmin("admin-1", nil)
+
+	run := map[string]string{"job": "noop"}
+	for _, tc := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{user, http.StatusForbidden},
+		{admin, http.StatusOK},
+	} {
+		if rec := serve(t, jobsHandler, http.MethodGet, "/admin/jobs?token="+tc.token, nil, nil); rec.Code != tc.want {
+			t.Fatalf("list with %q: status %d, want %d", tc.token, rec.Code, tc.want)
+		}
+		if rec := serve(t, jobRunHandler, http.MethodPost, "/admin/jobs/run?token="+tc.token, run, nil); rec.Code != tc.want {
+			t.Fatalf("run with %q: status %d, want %d", tc.token, rec.Code, tc.want)
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("job ran %d times, want 1", runs)
+	}
+}
+
+func TestLogAndAuditHandlersRequireAdmin(t *testing.T) {
+	useMemStore(t)
+	mgr := useSessions(t)
+	user, _, _ := mgr.Issue("user-1", nil)
+	admin, _, _ := mgr.IssueAdmin("admin-1", nil)
+
+	for _, h := range []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+	}{
+		{"logs", logsHandler, "/admin/logs"},
+		{"audit", auditListHandler, "/admin/audit"},
+		{"verify", auditVerifyHandler, "/admin/audit/verify"},
+	} {
+		for _, tc := range []struct {
+			token string
+			want  int
+		}{
+			{"", http.StatusUnauthorized},
+			{user, http.StatusForbidden},
+			{admin, http.StatusOK},
+		} {
+			if rec := serve(t, h.handler, http.MethodGet, h.target+"?token="+tc.token, nil, nil); rec.Code != tc.want {
+				t.Fatalf("%s with %q: status %d, want %d: %s", h.name, tc.token, rec.Code, tc.want, rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestZakatTriggerHandler(t *testing.T) {
+	mgr := useSessions(t)
+	oldRunner, oldZakat := jobRunner, zakatScheduler
+	t.Cleanup(func() { jobRunner, zakatScheduler = oldRunner, oldZakat })
+	jobRunner = jobs.NewScheduler(nil, nil, nil)
+	zakatScheduler = scheduler.NewZakatScheduler(nil, blockchain.NewBlockchain(1), utxo.NewManager(), "zakat-pool")
+	user, _, _ := mgr.Issue("user-1", nil)
+	admin, _, _ := mgr.IssueAdmin("admin-1", nil)
+
+	if rec := serve(t, zakatTriggerHandler, http.MethodPost, "/zakat/trigger", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: status %d", rec.Code)
+	}
+	if rec := serve(t, zakatTriggerHandler, http.MethodPost, "/zakat/trigger?token="+user, nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("user session: status %d", rec.Code)
+	}
+
+	// Manual runs go through the job runner
+	if rec := serve(t, zakatTriggerHandler, http.MethodPost, "/zakat/trigger?token="+admin, nil, nil); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without the zakat job: status %d", rec.Code)
+	}
+	runs := 0
+	if err := jobRunner.Register(jobs.Job{Name: "zakat", Schedule: "0 0 1 * *", Run: func(ctx context.Context) error {
+		runs++
+		return zakatScheduler.Run(ctx)
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(t, zakatTriggerHandler, http.MethodPost, "/zakat/trigger?token="+admin, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("admin session: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if runs != 1 {
+		t.Fatalf("zakat job ran %d times, want 1", runs)
+	}
+}
+
+func TestInvoiceHandlersRequireSession(t *testing.T) {
+	m := useMemStore(t)
+	mgr := useSessions(t)
+	m.userWallets["user-1"] = strings.Repeat("d", 64)
+	m.userWallets["user-2"] = strings.Repeat("e", 64)
+	token, _, _ := mgr.Issue("user-1", []string{m.userWallets["user-1"]})
+	stranger, _, _ := mgr.Issue("user-2", []string{m.userWallets["user-2"]})
+
+	req := CreateInvoiceReq{Amount: 40, Memo: "order 17"}
+	if rec := serve(t, invoiceCreateHandler, http.MethodPost, "/invoices/create", req, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: status %d", rec.Code)
+	}
+	req.UserID = "user-2"
+	if rec := serve(t, invoiceCreateHandler, http.MethodPost, "/invoices/create?token="+token, req, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("another user_id: status %d", rec.Code)
+	}
+	req.UserID = ""
+	var inv invoiceView
+	if rec := serve(t, invoiceCreateHandler, http.MethodPost, "/invoices/create?token="+token, req, &inv); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if inv.UserID != "user-1" || inv.WalletID != m.userWallets["user-1"] {
+		t.Fatalf("invoice %+v", inv.Invoice)
+	}
+
+	if rec := serve(t, invoiceListHandler, http.MethodGet, "/invoices/list?user_id=user-1", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("list without session: status %d", rec.Code)
+	}
+	if rec := serve(t, invoiceListHandler, http.MethodGet, "/invoices/list?user_id=user-1&token="+stranger, nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("list another user's invoices: status %d", rec.Code)
+	}
+	var list struct {
+		Invoices []invoiceView `json:"invoices"`
+	}
+	if rec := serve(t, invoiceListHandler, http.MethodGet, "/invoices/list?token="+token, nil, &list); rec.Code != http.StatusOK || len(list.Invoices) != 1 {
+		t.Fatalf("list: status %d, %d invoices", rec.Code, len(list.Invoices))
+	}
+
+	get := "/invoices/get?invoice_id=" + inv.ID
+	if rec := serve(t, invoiceGetHandler, http.MethodGet, get, nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("get without session: status %d", rec.Code)
+	}
+	if rec := serve(t, invoiceGetHandler, http.MethodGet, get+"&user_id=user-1&token="+stranger, nil, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("get with another user_id: status %d", rec.Code)
+	}
+	if rec := serve(t, invoiceGetHandler, http.MethodGet, get+"&token="+stranger, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("stranger's get: status %d", rec.Code)
+	}
+	if rec := serve(t, invoiceGetHandler, http.MethodGet, get+"&token="+token, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("owner's get: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRecoveryCompleteNeedsSecret(t *testing.T) {
+	m := useMemStore(t)
+	wallet := strings.Repeat("f", 64)
+	m.setups[wallet] = recovery.Setup{SetID: "aaaa1111", WalletID: wallet, Threshold: 2, Shares: 3}
+
+	var started struct {
+		Request recovery.Request `json:"request"`
+		Secret  string           `json:"secret"`
+	}
+	if rec := serve(t, recoveryStartHandler, http.MethodPost, "/recovery/start", map[string]string{"wallet_id": wallet}, &started); rec.Code != http.StatusOK {
+		t.Fatalf("start: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if started.Secret == "" || started.Request.ID == "" {
+		t.Fatalf("start returned %+v", started)
+	}
+
+	// Knowing the request ID is not enough to finish it
+	complete := func(secret string) int {
+		body := map[string]string{"request_id": started.Request.ID, "secret": secret, "new_password": "N3w-passw0rd!x"}
+		return serve(t, recoveryCompleteHandler, http.MethodPost, "/recovery/complete", body, nil).Code
+	}
+	other, _, _ := recovery.NewSecret()
+	for _, secret := range []string{"", other} {
+		if code := complete(secret); code != http.StatusForbidden {
+			t.Fatalf("completion with secret %q: status %d", secret, code)
+		}
+	}
+	// The opener gets past the secret to the share count
+	if code := complete(started.Secret); code != http.StatusConflict {
+		t.Fatalf("completion with the secret: status %d", code)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"blockchain-wallet/pkg/db"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// transactionHistoryHandler returns one page of a wallet's transactions,
+// newest first, with totals for the whole filtered range.
+//
+// Query parameters: wallet (required), limit, cursor, from, to (RFC 3339 or
+// YYYY-MM-DD; a bare `to` date includes that day), direction (sent|received),
+// counterparty, min_amount, max_amount, type, status and q (note search).
+func transactionHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter, err := parseHistoryFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(q.Get("limit"), defaultHistoryLimit, maxHistoryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var after *db.HistoryCursor
+	if v := q.Get("cursor"); v != "" {
+		if after, err = db.DecodeHistoryCursor(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one extra row to know whether another page follows
+	txs, err := dbClient.QueryTransactionHistory(r.Context(), filter, after, limit+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nextCursor := ""
+	if len(txs) > limit {
+		txs = txs[:limit]
+		nextCursor = db.CursorFor(txs[len(txs)-1]).Encode()
+	}
+	if txs == nil {
+		txs = []db.TxRecord{}
+	}
+
+	totals, err := dbClient.GetTransactionTotals(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"wallet":       filter.WalletID,
+		"transactions": txs,
+		"next_cursor":  nextCursor,
+		"has_more":     nextCursor != "",
+		"totals":       totals,
+	})
+}
+
+// parseHistoryFilter reads the history filters from query parameters
+func parseHistoryFilter(q url.Values) (db.HistoryFilter, error) {
+	f := db.HistoryFilter{
+		WalletID:     q.Get("wallet"),
+		Direction:    q.Get("direction"),
+		Counterparty: q.Get("counterparty"),
+		TxType:       q.Get("type"),
+		Status:       q.Get("status"),
+		Search:       q.Get("q"),
+	}
+	if f.WalletID == "" {
+		return f, fmt.Errorf("missing wallet param")
+	}
+	var err error
+	if f.WalletID, err = normalizeAddress(f.WalletID); err != nil {
+		return f, err
+	}
+	if f.Counterparty, err = normalizeAddress(f.Counterparty); err != nil {
+		return f, fmt.Errorf("counterparty %w", err)
+	}
+	switch f.Direction {
+	case "", "all":
+		f.Direction = ""
+	case db.DirectionSent, db.DirectionReceived:
+	default:
+		return f, fmt.Errorf("direction must be sent or received")
+	}
+
+	if f.From, err = parseHistoryTime(q.Get("from"), false); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseHistoryTime(q.Get("to"), true); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if f.MinAmount, err = parseHistoryAmount(q.Get("min_amount")); err != nil {
+		return f, fmt.Errorf("invalid min_amount: %w", err)
+	}
+	if f.MaxAmount, err = parseHistoryAmount(q.Get("max_amount")); err != nil {
+		return f, fmt.Errorf("invalid max_amount: %w", err)
+	}
+	return f, nil
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or YYYY-MM-DD dates. A date
+// used as an exclusive upper bound is moved to the start of the next day.
+func parseHistoryTime(v string, upper bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("use RFC 3339 or YYYY-MM-DD")
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func parseHistoryAmount(v string) (*int64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	return &n, nil
+}
+
+// parseLimit reads a page size, using def when it is absent and capping it at max
+func parseLimit(v string, def, max int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+	if n > max {
+		n = max
+	}
+	return n, nil
+}
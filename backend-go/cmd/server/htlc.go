@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/htlc"
+	"blockchain-wallet/pkg/script"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+const (
+	defaultHTLCLimit = 50
+	maxHTLCLimit     = 500
+)
+
+// htlcView adds the state as of now, so expired contracts show as such
+type htlcView struct {
+	htlc.HTLC
+	State string `json:"state"`
+}
+
+func viewHTLC(h htlc.HTLC) htlcView {
+	return htlcView{HTLC: h, State: h.State(time.Now().Unix())}
+}
+
+type CreateHTLCReq struct {
+	SenderID    string `json:"sender_id"`
+	SenderPub   string `json:"sender_pub"`  // base64; also the refund key
+	SenderPriv  string `json:"sender_priv"` // base64
+	ReceiverID  string `json:"receiver_id"`
+	ReceiverPub string `json:"receiver_pub"` // base64; the claim key
+	Amount      int64  `json:"amount"`
+	Hash        string `json:"hash"`    // hex SHA-256 of the secret
+	Timeout     int64  `json:"timeout"` // unix time from which the sender may refund
+	Note        string `json:"note"`
+
+	AllowUnknown bool `json:"allow_unknown"` // lock funds for a wallet the directory does not list
+}
+
+// htlcCreateHandler locks funds in a contract the receiver can claim with
+// the secret behind hash, or the sender can refund after the timeout. Like
+// an escrow, the output stays the sender's until it is settled.
+func htlcCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateHTLCReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.SenderID, &req.ReceiverID) {
+		return
+	}
+	pubBytes, err := base64.StdEncoding.DecodeString(req.SenderPub)
+	if err != nil {
+		http.Error(w, "invalid sender_pub: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	privBytes, err := base64.StdEncoding.DecodeString(req.SenderPriv)
+	if err != nil {
+		http.Error(w, "invalid sender_priv: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	claimer, err := base64.StdEncoding.DecodeString(req.ReceiverPub)
+	if err != nil || len(claimer) != ed25519.PublicKeySize {
+		http.Error(w, "invalid receiver_pub", http.StatusBadRequest)
+		return
+	}
+	if crypto.WalletIDFromPub(claimer) != req.ReceiverID {
+		http.Error(w, "receiver_id does not match receiver_pub", http.StatusBadRequest)
+		return
+	}
+	hash, err := hex.DecodeString(req.Hash)
+	if err != nil {
+		http.Error(w, "hash must be hex", http.StatusBadRequest)
+		return
+	}
+	if req.Timeout <= time.Now().Unix() {
+		http.Error(w, "timeout must be in the future", http.StatusBadRequest)
+		return
+	}
+	contract := htlc.Contract{Hash: hash, Claimer: claimer, Refunder: pubBytes, Timeout: req.Timeout}
+	lockScript, err := contract.Script()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The output stays the sender's, so an unknown receiver is only
+	// registered when a claim pays it
+	if _, err := checkRecipient(r.Context(), req.ReceiverID, req.AllowUnknown); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	lock := &utxo.Lock{Kind: utxo.LockScript, Script: lockScript}
+	txx, err := signAndSubmitTransfer(r.Context(), req.SenderID, req.SenderID, "", req.Amount, req.Note, lock, false, pubBytes, privBytes, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	h := htlc.HTLC{
+		ID:         txx.ID + "_recv",
+		TxID:       txx.ID,
+		SenderID:   req.SenderID,
+		ReceiverID: req.ReceiverID,
+		Amount:     req.Amount,
+		Hash:       hex.EncodeToString(hash),
+		Claimer:    claimer,
+		Refunder:   pubBytes,
+		Timeout:    req.Timeout,
+		Status:     htlc.StatusOpen,
+		CreatedAt:  time.Now(),
+	}
+	if err := dbClient.InsertHTLC(r.Context(), h); err != nil {
+		http.Error(w, "failed to record htlc: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), req.SenderID, "htlc_created",
+		fmt.Sprintf("HTLC %s: %d for %s until %d", h.ID, h.Amount, h.ReceiverID, h.Timeout), "open", r.RemoteAddr)
+
+	writeJSON(w, viewHTLC(h))
+}
+
+type SettleHTLCReq struct {
+	HTLCID    string `json:"htlc_id"`
+	Secret    string `json:"secret"`    // hex; claims only
+	Timestamp int64  `json:"timestamp"` // required with a signature
+	CosignerAuth
+}
+
+// htlcClaimHandler pays a contract to its receiver, who reveals the secret
+// and signs with the claim key
+func htlcClaimHandler(w http.ResponseWriter, r *http.Request) {
+	settleHTLCHandler(w, r, htlc.StatusClaimed)
+}
+
+// htlcRefundHandler returns an expired contract to its sender, who signs
+// with the refund key
+func htlcRefundHandler(w http.ResponseWriter, r *http.Request) {
+	settleHTLCHandler(w, r, htlc.StatusRefunded)
+}
+
+// settleHTLCHandler spends a contract through the script path. With a
+// private key the server signs; otherwise the signature must cover the
+// sighash /script/sighash returns for the same spend.
+func settleHTLCHandler(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SettleHTLCReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h, err := dbClient.GetHTLC(r.Context(), req.HTLCID)
+	if err != nil {
+		http.Error(w, "htlc not found", http.StatusNotFound)
+		return
+	}
+	if h.Status != htlc.StatusOpen {
+		http.Error(w, "htlc already "+h.Status, http.StatusConflict)
+		return
+	}
+	secret, err := hex.DecodeString(req.Secret)
+	if err != nil || (action == htlc.StatusClaimed && len(secret) == 0) {
+		http.Error(w, "secret must be hex", http.StatusBadRequest)
+		return
+	}
+
+	// The receiver was checked when the contract was created
+	spend := SpendScriptReq{
+		SenderID:     h.SenderID,
+		ReceiverID:   h.ReceiverID,
+		Note:         fmt.Sprintf("HTLC claim of %s", h.ID),
+		Timestamp:    req.Timestamp,
+		Inputs:       []ScriptInput{{UTXOID: h.ID}},
+		AllowUnknown: true,
+	}
+	if action == htlc.StatusRefunded {
+		spend.ReceiverID = h.SenderID
+		spend.Note = fmt.Sprintf("HTLC refund of %s", h.ID)
+	}
+	if spend.Timestamp == 0 && req.PrivateKey != "" {
+		spend.Timestamp = time.Now().Unix()
+	}
+	txx, _, _, err := spend.transaction(r.Context())
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	sig, err := req.sign(txx.SigHash())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if action == htlc.StatusClaimed {
+		spend.Inputs[0].UnlockScript, err = htlc.ClaimScript(sig.Signature, secret)
+	} else {
+		spend.Inputs[0].UnlockScript, err = htlc.RefundScript(sig.Signature)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txx, err = spendScript(r.Context(), &spend, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	if h, err = dbClient.GetHTLC(r.Context(), h.ID); err != nil {
+		http.Error(w, "failed to fetch htlc: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"htlc": viewHTLC(h),
+		"txid": txx.ID,
+	})
+}
+
+// recordHTLCSpends settles the contracts among the inputs of a script
+// spend, keeping the secret a claim reveals so the other side of a swap
+// can use it
+func recordHTLCSpends(ctx context.Context, txx *tx.Transaction, inputs []*utxo.UTXO, unlocks []script.Script) {
+	for i, u := range inputs {
+		h, err := dbClient.GetHTLC(ctx, u.ID)
+		if err != nil {
+			continue
+		}
+		c, err := h.Contract()
+		if err != nil {
+			continue
+		}
+		status, secret := htlc.StatusRefunded, ""
+		if s, ok := c.Secret(unlocks[i]); ok {
+			status, secret = htlc.StatusClaimed, hex.EncodeToString(s)
+		}
+		if err := dbClient.SettleHTLC(ctx, h.ID, status, txx.ID, secret, time.Now()); err != nil {
+			log.Printf("Warning: failed to settle htlc %s: %v", h.ID, err)
+			continue
+		}
+		_ = dbClient.InsertLog(ctx, h.SenderID, "htlc_"+status,
+			fmt.Sprintf("HTLC %s: %d to %s", h.ID, h.Amount, txx.ReceiverID), "confirmed", "")
+	}
+}
+
+// htlcGetHandler returns a contract by ?htlc_id, or the contracts locked to
+// ?hash. A claimed contract shows the secret it revealed.
+func htlcGetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if id := q.Get("htlc_id"); id != "" {
+		h, err := dbClient.GetHTLC(r.Context(), id)
+		if err != nil {
+			http.Error(w, "htlc not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, viewHTLC(h))
+		return
+	}
+	hash := q.Get("hash")
+	if hash == "" {
+		http.Error(w, "missing htlc_id or hash param", http.StatusBadRequest)
+		return
+	}
+	list, err := dbClient.GetHTLCsByHash(r.Context(), hash)
+	if err != nil {
+		http.Error(w, "failed to fetch htlcs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"htlcs": viewHTLCs(list)})
+}
+
+// htlcListHandler lists the contracts a wallet sent or receives, newest
+// first
+func htlcListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	walletID := q.Get("wallet_id")
+	if walletID == "" {
+		http.Error(w, "missing wallet_id param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"), defaultHTLCLimit, maxHTLCLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := dbClient.GetHTLCs(r.Context(), walletID, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch htlcs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"htlcs": viewHTLCs(list)})
+}
+
+func viewHTLCs(list []htlc.HTLC) []htlcView {
+	views := make([]htlcView, len(list))
+	for i, h := range list {
+		views[i] = viewHTLC(h)
+	}
+	return views
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/invoice"
+)
+
+const (
+	defaultInvoiceExpiry   = 24 * time.Hour
+	defaultInvoiceSchedule = "*/5 * * * *" // mark lapsed invoices expired every five minutes
+	defaultInvoiceLimit    = 50
+	maxInvoiceLimit        = 500
+)
+
+// checkInvoicePayment vets a transfer whose note carries an invoice
+// reference before it is accepted, so payments cannot go to the wrong
+// wallet, in another asset or to an invoice that no longer takes them.
+// Notes without a reference pass unchanged.
+func checkInvoicePayment(ctx context.Context, receiverID, assetID, note string) error {
+	ref := invoice.ReferenceIn(note)
+	if ref == "" || dbClient == nil {
+		return nil
+	}
+	if assetID != "" {
+		return badTransfer("invoice %s is payable in the native coin", ref)
+	}
+	inv, err := dbClient.GetInvoiceByReference(ctx, ref)
+	if errors.Is(err, sql.ErrNoRows) {
+		return badTransfer("unknown invoice reference %s", ref)
+	}
+	if err != nil {
+		return fmt.Errorf("look up invoice %s: %w", ref, err)
+	}
+	if inv.WalletID != receiverID {
+		return badTransfer("invoice %s is payable to %s", ref, inv.WalletID)
+	}
+	if !inv.Payable(time.Now()) {
+		return badTransfer("invoice %s is %s", ref, inv.StatusAt(time.Now()))
+	}
+	return nil
+}
+
+// settleInvoices matches the transactions of a mined block to the invoices
+// referenced in their notes
+func settleInvoices(ctx context.Context, block *blockchain.Block) {
+	if dbClient == nil {
+		return
+	}
+	paidAt := time.Unix(block.Timestamp, 0).UTC()
+	for _, txID := range block.Transactions {
+		if strings.HasPrefix(txID, miningRewardTag) {
+			continue
+		}
+		rec, err := dbClient.GetTransactionByID(ctx, txID)
+		if err != nil || rec.Asset != "" {
+			continue
+		}
+		ref := invoice.ReferenceIn(rec.Note)
+		if ref == "" {
+			continue
+		}
+		inv, err := dbClient.GetInvoiceByReference(ctx, ref)
+		if err != nil || inv.WalletID != rec.ReceiverWalletID {
+			continue
+		}
+
+		updated, err := dbClient.RecordInvoicePayment(ctx, invoice.Payment{
+			InvoiceID:  inv.ID,
+			TxID:       rec.TxID,
+			Amount:     rec.Amount,
+			BlockIndex: block.Index,
+			BlockHash:  block.Hash,
+			PaidAt:     paidAt,
+		}, time.Now())
+		if err != nil {
+			log.Printf("Warning: failed to match tx %s to invoice %s: %v", rec.TxID, ref, err)
+			continue
+		}
+		if updated == nil {
+			continue
+		}
+		_ = dbClient.InsertLog(ctx, inv.WalletID, "invoice_payment",
+			fmt.Sprintf("Invoice %s: received %d of %d in tx %s", ref, updated.AmountPaid, updated.Amount, rec.TxID),
+			updated.Status, "system")
+	}
+}
+
+// invoiceView adds the payment URI and, when loaded, the matched payments
+type invoiceView struct {
+	invoice.Invoice
+	URI         string            `json:"uri"`
+	Outstanding int64             `json:"outstanding"`
+	Payments    []invoice.Payment `json:"payments,omitempty"`
+}
+
+// viewInvoice brings the status up to date, since an open invoice may have
+// lapsed since the expiry job last ran
+func viewInvoice(inv invoice.Invoice) invoiceView {
+	inv.Status = inv.StatusAt(time.Now())
+	return invoiceView{Invoice: inv, URI: inv.URI(), Outstanding: inv.Outstanding()}
+}
+
+type CreateInvoiceReq struct {
+	UserID    string     `json:"user_id"` // optional; must be the session's user
+	Amount    int64      `json:"amount"`
+	Memo      string     `json:"memo"`
+	ExpiresAt *time.Time `json:"expires_at"` // default 24h from now
+}
+
+// invoiceCreateHandler issues an invoice payable to the session user's
+// wallet
+func invoiceCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateInvoiceReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := sessionUser(w, claims, req.UserID)
+	if !ok {
+		return
+	}
+
+	wallet, err := dbClient.GetUserWalletByUserID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "wallet not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	inv := invoice.Invoice{
+		UserID:    userID,
+		WalletID:  wallet.WalletID,
+		Amount:    req.Amount,
+		Memo:      strings.TrimSpace(req.Memo),
+		Status:    invoice.StatusOpen,
+		ExpiresAt: now.Add(defaultInvoiceExpiry),
+		CreatedAt: now,
+	}
+	if req.ExpiresAt != nil {
+		inv.ExpiresAt = req.ExpiresAt.UTC()
+	}
+	if err := invoice.Validate(inv); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if inv.Reference, err = invoice.NewReference(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inv.ID, err = dbClient.InsertInvoice(r.Context(), inv)
+	if err != nil {
+		http.Error(w, "failed to create invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), wallet.WalletID, "invoice_created",
+		fmt.Sprintf("Invoice %s for %d", inv.Reference, inv.Amount), "success", r.RemoteAddr)
+
+	writeJSON(w, viewInvoice(inv))
+}
+
+// invoiceListHandler lists the session user's invoices, newest first.
+// status narrows the list to open, paid, underpaid or expired invoices.
+func invoiceListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	userID, ok := sessionUser(w, claims, q.Get("user_id"))
+	if !ok {
+		return
+	}
+	status := q.Get("status")
+	switch status {
+	case "", invoice.StatusOpen, invoice.StatusPaid, invoice.StatusUnderpaid, invoice.StatusExpired:
+	default:
+		http.Error(w, "status must be open, paid, underpaid or expired", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"), defaultInvoiceLimit, maxInvoiceLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := dbClient.GetInvoices(r.Context(), userID, status, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch invoices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	views := make([]invoiceView, 0, len(list))
+	for _, inv := range list {
+		views = append(views, viewInvoice(inv))
+	}
+
+	writeJSON(w, map[string]interface{}{"invoices": views})
+}
+
+// invoiceGetHandler returns one of the session user's invoices with its
+// payments
+func invoiceGetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := sessionUser(w, claims, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+	invoiceID := r.URL.Query().Get("invoice_id")
+	if invoiceID == "" {
+		http.Error(w, "invoice_id required", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := dbClient.GetInvoice(r.Context(), invoiceID, userID)
+	if err != nil {
+		http.Error(w, "invoice not found", http.StatusNotFound)
+		return
+	}
+	v := viewInvoice(inv)
+	if v.Payments, err = dbClient.GetInvoicePayments(r.Context(), inv.ID); err != nil {
+		http.Error(w, "failed to fetch payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, v)
+}
+
+// invoiceStatusHandler lets a payer look up an invoice by its reference.
+// Only what is needed to pay it is returned.
+func invoiceStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inv, ok := invoiceByRef(w, r)
+	if !ok {
+		return
+	}
+	v := viewInvoice(inv)
+
+	writeJSON(w, map[string]interface{}{
+		"reference":   v.Reference,
+		"wallet_id":   v.WalletID,
+		"amount":      v.Amount,
+		"amount_paid": v.AmountPaid,
+		"outstanding": v.Outstanding,
+		"memo":        v.Memo,
+		"status":      v.Status,
+		"expires_at":  v.ExpiresAt,
+		"uri":         v.URI,
+	})
+}
+
+// invoiceQRHandler renders an invoice's payment URI as a QR code PNG
+func invoiceQRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size := invoice.DefaultQRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+	inv, ok := invoiceByRef(w, r)
+	if !ok {
+		return
+	}
+
+	png, err := invoice.QRCode(inv.URI(), size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(png)
+}
+
+// invoiceByRef loads the invoice named by the ref query parameter, writing
+// the error response when there is none
+func invoiceByRef(w http.ResponseWriter, r *http.Request) (invoice.Invoice, bool) {
+	ref := strings.ToUpper(r.URL.Query().Get("ref"))
+	if ref == "" {
+		http.Error(w, "missing ref param", http.StatusBadRequest)
+		return invoice.Invoice{}, false
+	}
+	inv, err := dbClient.GetInvoiceByReference(r.Context(), ref)
+	if err != nil {
+		http.Error(w, "invoice not found", http.StatusNotFound)
+		return invoice.Invoice{}, false
+	}
+	return inv, true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/orders"
+)
+
+// Default schedules, overridable through the environment
+const (
+	defaultZakatSchedule     = "0 0 1 * *" // midnight on the 1st of every month
+	defaultOTPCleanupSched   = "@hourly"
+	defaultReconcileSchedule = "30 3 * * *" // daily at 03:30
+)
+
+// envOr returns the environment variable or def when it is unset
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// registerJobs wires the periodic background work into the job runner.
+// Jobs other than Zakat need the database and are skipped without it.
+func registerJobs() {
+	must := func(err error) {
+		if err != nil {
+			log.Fatalf("❌ failed to register job: %v", err)
+		}
+	}
+
+	// A Zakat pass logs and queues deductions before it mines them, so a
+	// retry after a partial failure would charge wallets twice; it runs once
+	must(jobRunner.Register(jobs.Job{
+		Name:     "zakat",
+		Schedule: envOr("ZAKAT_SCHEDULE", defaultZakatSchedule),
+		Run:      zakatScheduler.Run,
+	}))
+
+	if dbClient == nil {
+		return
+	}
+
+	must(jobRunner.Register(jobs.Job{
+		Name:     "otp-cleanup",
+		Schedule: envOr("OTP_CLEANUP_SCHEDULE", defaultOTPCleanupSched),
+		Run: func(ctx context.Context) error {
+			n, err := dbClient.DeleteExpiredOTPs(ctx)
+			if err == nil && n > 0 {
+				log.Printf("🧹 Removed %d expired OTPs", n)
+			}
+			return err
+		},
+		MaxRetries: 1,
+		Backoff:    time.Minute,
+	}))
+
+	must(jobRunner.Register(jobs.Job{
+		Name:     "balance-reconciliation",
+		Schedule: envOr("RECONCILE_SCHEDULE", defaultReconcileSchedule),
+		Run: func(ctx context.Context) error {
+			n, err := dbClient.ReconcileBalances(ctx)
+			if err == nil && n > 0 {
+				log.Printf("⚖️  Corrected cached balance of %d wallets", n)
+			}
+			return err
+		},
+		MaxRetries: 2,
+		Backoff:    time.Minute,
+	}))
+
+	processor := orders.NewProcessor(dbClient, payStandingOrder, notifyStandingOrderFailure, jobs.SystemClock)
+	must(jobRunner.Register(jobs.Job{
+		Name:     "standing-orders",
+		Schedule: envOr("STANDING_ORDERS_SCHEDULE", defaultStandingOrderSchedule),
+		Run:      processor.Run,
+	}))
+
+	must(jobRunner.Register(jobs.Job{
+		Name:     "webhook-delivery",
+		Schedule: envOr("WEBHOOK_SCHEDULE", defaultWebhookSchedule),
+		Run:      webhookDispatcher.Run,
+	}))
+
+	must(jobRunner.Register(jobs.Job{
+		Name:     "invoice-expiry",
+		Schedule: envOr("INVOICE_EXPIRY_SCHEDULE", defaultInvoiceSchedule),
+		Run: func(ctx context.Context) error {
+			n, err := dbClient.ExpireInvoices(ctx, time.Now())
+			if err == nil && n > 0 {
+				log.Printf("🧾 Marked %d invoices expired", n)
+			}
+			return err
+		},
+		MaxRetries: 1,
+		Backoff:    time.Minute,
+	}))
+
+	must(jobRunner.Register(jobs.Job{
+		Name:     "recovery-expiry",
+		Schedule: envOr("RECOVERY_EXPIRY_SCHEDULE", defaultRecoverySchedule),
+		Run: func(ctx context.Context) error {
+			n, err := dbClient.ExpireRecoveryRequests(ctx, time.Now().UTC())
+			if err == nil && n > 0 {
+				log.Printf("🔑 Closed %d lapsed recovery requests", n)
+			}
+			return err
+		},
+		MaxRetries: 1,
+		Backoff:    time.Minute,
+	}))
+}
+
+// jobsHandler lists registered jobs and their recent run history to an
+// admin session
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	resp := map[string]interface{}{
+		"jobs": jobRunner.Jobs(),
+	}
+
+	if dbClient != nil {
+		limit := 50
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+		runs, err := dbClient.GetJobRuns(context.Background(), r.URL.Query().Get("job"), limit)
+		if err != nil {
+			http.Error(w, "failed to fetch job runs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["runs"] = runs
+	}
+
+	writeJSON(w, resp)
+}
+
+// jobRunHandler runs a job immediately for an admin session
+func jobRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Job string `json:"job"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := jobRunner.RunNow(r.Context(), req.Job)
+	recordAudit(r, audit.AdminAction, claims.UserID, req.Job, auditOutcome("manual job run", err))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == jobs.ErrUnknownJob {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"status": "completed",
+		"job":    req.Job,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/keystore"
+)
+
+// minKeystorePassphrase is the shortest passphrase a backup is sealed under
+const minKeystorePassphrase = 8
+
+type KeystoreExportReq struct {
+	WalletID   string `json:"wallet_id"`
+	Passphrase string `json:"passphrase"`
+}
+
+type KeystoreImportReq struct {
+	Keystore   json.RawMessage `json:"keystore"`
+	Passphrase string          `json:"passphrase"`
+}
+
+// walletExportHandler returns the key of one of the caller's wallets as a
+// keystore file sealed under a passphrase of their choosing, for backup or
+// for the command-line wallet. The session token from login must cover the
+// wallet.
+func walletExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	var req KeystoreExportReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.WalletID) {
+		return
+	}
+	if req.WalletID == "" && len(claims.Wallets) > 0 {
+		req.WalletID = claims.Wallets[0]
+	}
+	if !claims.HasWallet(req.WalletID) {
+		http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+		return
+	}
+	if len(req.Passphrase) < minKeystorePassphrase {
+		http.Error(w, "passphrase must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	wallet, err := dbClient.GetWalletByID(r.Context(), req.WalletID)
+	if err != nil {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+	priv, err := crypto.DecryptPrivateKey(wallet.PrivateKeyEncrypted)
+	if err != nil {
+		log.Printf("Error decrypting private key for wallet %s: %v", wallet.WalletID, err)
+		http.Error(w, "failed to decrypt wallet key", http.StatusInternalServerError)
+		return
+	}
+	k, err := keystore.Encrypt(ed25519.PrivateKey(priv), req.Passphrase, "", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, audit.KeyAccess, claims.UserID, wallet.WalletID, "private key exported to a keystore file")
+	_ = dbClient.InsertLog(r.Context(), wallet.WalletID, "wallet_exported", "Wallet key exported", "success", r.RemoteAddr)
+	publishSecurity(wallet.WalletID, audit.KeyAccess, "private key exported to a keystore file", r.RemoteAddr)
+	writeJSON(w, map[string]interface{}{"keystore": k})
+}
+
+// walletImportHandler restores a wallet from a keystore file. The file's
+// wallet ID must follow from its public key and the passphrase must open
+// it. A wallet this server already holds must belong to the caller and
+// match its stored public key; its server-side key is then sealed again
+// from the file. Otherwise the wallet is added to the caller's account,
+// which is only possible while the account has no wallet.
+func walletImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	var req KeystoreImportReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Keystore) == 0 {
+		http.Error(w, "keystore is required", http.StatusBadRequest)
+		return
+	}
+	k, err := keystore.Parse(req.Keystore)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	priv, err := k.Decrypt(req.Passphrase)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, keystore.ErrWrongPassphrase) {
+			status = http.StatusUnauthorized
+			recordAudit(r, audit.KeyAccess, claims.UserID, k.WalletID, "keystore import failed: wrong passphrase")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	enc, err := crypto.EncryptPrivateKey(priv)
+	if err != nil {
+		http.Error(w, "failed to encrypt private key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	restored := false
+	existing, err := dbClient.GetWalletByID(ctx, k.WalletID)
+	if err == nil && existing.External() {
+		// paid before it was registered here; importing the key claims it
+		err = sql.ErrNoRows
+	}
+	switch {
+	case err == nil:
+		if existing.UserID != claims.UserID {
+			http.Error(w, "wallet belongs to another account", http.StatusForbidden)
+			return
+		}
+		if !bytes.Equal(existing.PublicKey, k.PublicKey) {
+			http.Error(w, "keystore public key does not match the stored wallet", http.StatusConflict)
+			return
+		}
+		if err := dbClient.UpdateWalletKey(ctx, k.WalletID, enc); err != nil {
+			http.Error(w, "failed to store wallet key: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		restored = true
+	case errors.Is(err, sql.ErrNoRows):
+		if current, err := dbClient.GetUserWalletByUserID(ctx, claims.UserID); err == nil {
+			http.Error(w, "account already has wallet "+current.WalletID, http.StatusConflict)
+			return
+		}
+		if err := dbClient.InsertWallet(ctx, claims.UserID, k.WalletID, k.PublicKey, enc); err != nil {
+			http.Error(w, "failed to create wallet: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, audit.KeyAccess, claims.UserID, k.WalletID, "private key imported from a keystore file")
+	_ = dbClient.InsertLog(ctx, k.WalletID, "wallet_imported", "Wallet key imported", "success", r.RemoteAddr)
+	publishSecurity(k.WalletID, audit.KeyAccess, "private key imported from a keystore file", r.RemoteAddr)
+	writeJSON(w, map[string]interface{}{
+		"wallet_id":  k.WalletID,
+		"public_key": base64.StdEncoding.EncodeToString(k.PublicKey),
+		"restored":   restored,
+	})
+}
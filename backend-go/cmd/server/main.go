@@ -5,32 +5,42 @@ import (
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
 
+	"blockchain-wallet/pkg/audit"
 	"blockchain-wallet/pkg/blockchain"
 	"blockchain-wallet/pkg/crypto"
 	"blockchain-wallet/pkg/db"
 	"blockchain-wallet/pkg/email" // <--- ENSURE THIS IMPORT EXISTS
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/psbt"
 	"blockchain-wallet/pkg/scheduler"
 	"blockchain-wallet/pkg/tx"
 	"blockchain-wallet/pkg/utxo"
 )
 
 var utxoMgr = utxo.NewManager()
-var dbClient *db.Client
+var dbClient db.Store
 var bc *blockchain.Blockchain
 var zakatScheduler *scheduler.ZakatScheduler
+var jobRunner *jobs.Scheduler
+var auditLog *audit.Recorder
 
-func init() {
+// setup loads configuration and connects the server's dependencies
+func setup() {
 	// 1. Load .env file
 	err := godotenv.Load()
 	if err != nil {
@@ -47,17 +57,86 @@ func init() {
 	}
 
 	// 3. Connect DB
-	dbClient, err = db.NewClient(context.Background())
+	client, err := db.Open(context.Background())
 	if err != nil {
+		// A configured database must be reachable; only a node with no
+		// database settings at all runs without one
+		if os.Getenv("DB_DRIVER") != "" || os.Getenv("DATABASE_URL") != "" {
+			log.Fatalf("❌ CRITICAL: DB connection failed: %v", err)
+		}
 		log.Printf("❌ CRITICAL: DB connection failed: %v", err)
-		dbClient = nil // Explicitly nil so handlers fail gracefully
+		// dbClient stays nil so handlers fail gracefully
 	} else {
-		log.Printf("✓ Database connected successfully")
+		log.Printf("✓ Database connected successfully (%s)", client.Driver())
+
+		ctx := context.Background()
+		// An embedded SQLite file is owned by this process, so keep it migrated
+		if os.Getenv("AUTO_MIGRATE") == "true" || client.Driver() == db.DriverSQLite {
+			applied, err := client.MigrateUp(ctx)
+			if err != nil {
+				log.Fatalf("❌ Migration failed: %v", err)
+			}
+			for _, m := range applied {
+				log.Printf("✓ Applied migration %04d_%s", m.Version, m.Name)
+			}
+		}
+		// Refuse to run against a schema this build does not understand
+		if err := client.CheckSchemaVersion(ctx); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		dbClient = client
+	}
+
+	// Audit events go to the hash-chained audit log when there is a DB
+	var auditStore audit.Store
+	if dbClient != nil {
+		auditStore = dbClient
+	}
+	auditLog = audit.NewRecorder(auditStore)
+
+	initAddressPrefix()
+	if statementSigner, err = loadStatementSigner(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if sessions, err = loadSessionManager(); err != nil {
+		log.Fatalf("❌ %v", err)
 	}
 
 	// 4. Init Blockchain & Scheduler
 	bc = blockchain.NewBlockchain(5)
-	zakatScheduler = scheduler.NewZakatScheduler(dbClient, bc, utxoMgr, "zakat-pool-system")
+	// Continue from the stored tip so heights carry on across restarts
+	if dbClient != nil {
+		tip, err := dbClient.ChainTip(context.Background())
+		switch {
+		case err == nil:
+			bc = blockchain.ResumeBlockchain(5, tip.Header())
+			log.Printf("✓ Resumed chain at height %d (%s)", tip.Index, tip.Hash)
+		case !errors.Is(err, sql.ErrNoRows):
+			log.Fatalf("❌ Loading chain tip failed: %v", err)
+		}
+	}
+	var zakatStore scheduler.Store
+	if dbClient != nil {
+		zakatStore = dbClient
+	}
+	zakatScheduler = scheduler.NewZakatScheduler(zakatStore, bc, utxoMgr, "zakat-pool-system")
+	zakatScheduler.SetTransferLock(&transferMu)
+	zakatScheduler.OnRun(func(ctx context.Context, s scheduler.RunSummary) {
+		if s.Block != nil {
+			settleInvoices(ctx, s.Block)
+		}
+		publishZakatRun(ctx, s)
+	})
+	if dbClient != nil {
+		webhookDispatcher = newWebhookDispatcher()
+	}
+
+	// 5. Job runner: with a DB, jobs are guarded by advisory locks and runs are recorded
+	if dbClient != nil {
+		jobRunner = jobs.NewScheduler(jobs.SystemClock, dbClient, dbClient)
+	} else {
+		jobRunner = jobs.NewScheduler(jobs.SystemClock, nil, nil)
+	}
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
@@ -74,19 +153,20 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	setup()
 	defer func() {
+		jobRunner.Stop()
 		if dbClient != nil {
 			dbClient.Close()
 		}
-		if zakatScheduler != nil {
-			zakatScheduler.Stop()
-		}
 	}()
 
-	if dbClient != nil {
-		ctx := context.Background()
-		zakatScheduler.Start(ctx)
-	}
+	registerJobs()
+	jobRunner.Start(context.Background())
 
 	mux := http.NewServeMux()
 	
@@ -100,13 +180,22 @@ func main() {
 	mux.HandleFunc("/wallet/create", createWalletHandler)
 	mux.HandleFunc("/wallet/fund", fundHandler)
 	mux.HandleFunc("/wallet/balance", balanceHandler)
+	mux.HandleFunc("/address/validate", addressValidateHandler)
 	mux.HandleFunc("/tx/submit", txSubmitHandler)
 	mux.HandleFunc("/tx/sign-and-submit", txSignAndSubmitHandler)
+	mux.HandleFunc("/tx/build", txBuildHandler)
 	mux.HandleFunc("/tx/details", txDetailsHandler)
+	mux.HandleFunc("/script/compile", scriptCompileHandler)
 	mux.HandleFunc("/blockchain/mine", mineHandler)
 	mux.HandleFunc("/blockchain/blocks", blocksHandler)
 	mux.HandleFunc("/blockchain/validate", validateHandler)
 	mux.HandleFunc("/blockchain/pending", pendingHandler)
+	mux.HandleFunc("/admin/jobs", jobsHandler)
+	mux.HandleFunc("/admin/jobs/run", jobRunHandler)
+	mux.HandleFunc("/reports/verify", statementVerifyHandler)
+	mux.HandleFunc("/reports/public-key", statementKeyHandler)
+	mux.HandleFunc("/events", eventsSSEHandler)
+	mux.HandleFunc("/events/ws", eventsWSHandler)
 
 	if dbClient != nil {
 		mux.HandleFunc("/profile/get", profileGetHandler)
@@ -115,9 +204,68 @@ func main() {
 		mux.HandleFunc("/profile/beneficiaries/add", beneficiariesAddHandler)
 		mux.HandleFunc("/profile/beneficiaries/remove", beneficiariesRemoveHandler)
 		mux.HandleFunc("/wallet/history", transactionHistoryHandler)
+		mux.HandleFunc("/wallet/export", walletExportHandler)
+		mux.HandleFunc("/wallet/import", walletImportHandler)
+		mux.HandleFunc("/recovery/setup", recoverySetupHandler)
+		mux.HandleFunc("/recovery/start", recoveryStartHandler)
+		mux.HandleFunc("/recovery/request", recoveryRequestHandler)
+		mux.HandleFunc("/recovery/share", recoveryShareHandler)
+		mux.HandleFunc("/recovery/complete", recoveryCompleteHandler)
+		mux.HandleFunc("/directory/lookup", directoryLookupHandler)
+		mux.HandleFunc("/directory/alias", directoryAliasHandler)
+		mux.HandleFunc("/reports/statement", statementHandler)
+		mux.HandleFunc("/explorer/blocks", explorerBlocksHandler)
+		mux.HandleFunc("/explorer/block", explorerBlockHandler)
+		mux.HandleFunc("/explorer/address", explorerAddressHandler)
+		mux.HandleFunc("/explorer/richlist", explorerRichListHandler)
+		mux.HandleFunc("/explorer/series", explorerSeriesHandler)
+		mux.HandleFunc("/explorer/stats", explorerStatsHandler)
 		mux.HandleFunc("/admin/logs", logsHandler)
+		mux.HandleFunc("/admin/audit", auditListHandler)
+		mux.HandleFunc("/admin/audit/verify", auditVerifyHandler)
 		mux.HandleFunc("/auth/request-email-change", requestEmailChangeHandler)
 		mux.HandleFunc("/auth/confirm-email-change", confirmEmailChangeHandler)
+		mux.HandleFunc("/orders/create", orderCreateHandler)
+		mux.HandleFunc("/orders/list", orderListHandler)
+		mux.HandleFunc("/orders/runs", orderRunsHandler)
+		mux.HandleFunc("/orders/update", orderUpdateHandler)
+		mux.HandleFunc("/orders/pause", orderPauseHandler)
+		mux.HandleFunc("/orders/resume", orderResumeHandler)
+		mux.HandleFunc("/orders/cancel", orderCancelHandler)
+		mux.HandleFunc("/webhooks/create", webhookCreateHandler)
+		mux.HandleFunc("/webhooks/list", webhookListHandler)
+		mux.HandleFunc("/webhooks/delete", webhookDeleteHandler)
+		mux.HandleFunc("/webhooks/deliveries", webhookDeliveriesHandler)
+		mux.HandleFunc("/webhooks/attempts", webhookAttemptsHandler)
+		mux.HandleFunc("/webhooks/replay", webhookReplayHandler)
+		mux.HandleFunc("/invoices/create", invoiceCreateHandler)
+		mux.HandleFunc("/invoices/list", invoiceListHandler)
+		mux.HandleFunc("/invoices/get", invoiceGetHandler)
+		mux.HandleFunc("/invoices/status", invoiceStatusHandler)
+		mux.HandleFunc("/invoices/qr", invoiceQRHandler)
+		mux.HandleFunc("/multisig/create", multisigCreateHandler)
+		mux.HandleFunc("/multisig/wallet", multisigWalletHandler)
+		mux.HandleFunc("/multisig/propose", multisigProposeHandler)
+		mux.HandleFunc("/multisig/sign", multisigSignHandler)
+		mux.HandleFunc("/multisig/execute", multisigExecuteHandler)
+		mux.HandleFunc("/multisig/cancel", multisigCancelHandler)
+		mux.HandleFunc("/multisig/proposals", multisigProposalsHandler)
+		mux.HandleFunc("/escrow/create", escrowCreateHandler)
+		mux.HandleFunc("/escrow/release", escrowReleaseHandler)
+		mux.HandleFunc("/escrow/refund", escrowRefundHandler)
+		mux.HandleFunc("/escrow/list", escrowListHandler)
+		mux.HandleFunc("/tx/spend-script", txSpendScriptHandler)
+		mux.HandleFunc("/script/sighash", scriptSighashHandler)
+		mux.HandleFunc("/htlc/create", htlcCreateHandler)
+		mux.HandleFunc("/htlc/claim", htlcClaimHandler)
+		mux.HandleFunc("/htlc/refund", htlcRefundHandler)
+		mux.HandleFunc("/htlc/get", htlcGetHandler)
+		mux.HandleFunc("/htlc/list", htlcListHandler)
+		mux.HandleFunc("/assets/create", assetCreateHandler)
+		mux.HandleFunc("/assets/issue", assetIssueHandler)
+		mux.HandleFunc("/assets/zakat", assetZakatHandler)
+		mux.HandleFunc("/assets/get", assetGetHandler)
+		mux.HandleFunc("/assets/list", assetListHandler)
 	}
 
 	if zakatScheduler != nil {
@@ -152,6 +300,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 
 type CreateWalletResp struct {
 	WalletID   string `json:"wallet_id"`
+	Address    string `json:"address"`
 	PublicKey  string `json:"public_key"`
 	PrivateKey string `json:"private_key"` // WARNING: for demo only
 }
@@ -169,6 +318,7 @@ func createWalletHandler(w http.ResponseWriter, r *http.Request) {
 	id := crypto.WalletIDFromPub(pub)
 	resp := CreateWalletResp{
 		WalletID:   id,
+		Address:    addressOf(id),
 		PublicKey:  base64.StdEncoding.EncodeToString(pub),
 		PrivateKey: base64.StdEncoding.EncodeToString(priv),
 	}
@@ -190,12 +340,16 @@ func fundHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &fr.WalletID) {
+		return
+	}
 	id := utxoMgr.AddUTXO(fr.WalletID, fr.Amount)
 	if dbClient != nil {
 		if err := dbClient.InsertUTXO(context.Background(), id, fr.WalletID, fr.Amount); err != nil {
 			log.Printf("Warning: failed to log UTXO to DB: %v", err)
 		}
 	}
+	publishBalance(r.Context(), fr.WalletID, fr.Amount, "deposit")
 	writeJSON(w, map[string]string{"utxo_id": id})
 }
 
@@ -209,9 +363,12 @@ func balanceHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing wallet param", http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &wallet) {
+		return
+	}
 
 	var bal int64
-	var utxoList []map[string]interface{}
+	var utxoList []db.UTXO
 	
 	if dbClient != nil {
 		var err error
@@ -234,17 +391,42 @@ func balanceHandler(w http.ResponseWriter, r *http.Request) {
 		// Get UTXOs from in-memory manager
 		memUtxos := utxoMgr.GetUnspentByOwner(wallet)
 		for _, u := range memUtxos {
-			utxoList = append(utxoList, map[string]interface{}{
-				"utxo_id": u.ID,
-				"amount":  u.Amount,
-			})
+			utxoList = append(utxoList, db.UTXO{UTXOID: u.ID, Owner: u.Owner, Amount: u.Amount, Lock: u.Lock, Asset: u.Asset})
+		}
+	}
+
+	// Locked outputs count towards the balance but cannot be sent yet.
+	// Balance and spendable are in the native coin; other assets are
+	// totalled separately by asset ID.
+	var spendable int64
+	assets := map[string]*assetBalance{}
+	height, now := chainHeight(), time.Now().Unix()
+	for _, u := range utxoList {
+		unlocked := u.Lock.CheckSpend(height, now) == nil
+		if u.Asset == "" {
+			if unlocked {
+				spendable += u.Amount
+			}
+			continue
+		}
+		ab := assets[u.Asset]
+		if ab == nil {
+			ab = &assetBalance{}
+			assets[u.Asset] = ab
+		}
+		ab.Balance += u.Amount
+		if unlocked {
+			ab.Spendable += u.Amount
 		}
 	}
 
 	writeJSON(w, map[string]interface{}{
-		"wallet":  wallet,
-		"balance": bal,
-		"utxos":   utxoList,
+		"wallet":    wallet,
+		"address":   addressOf(wallet),
+		"balance":   bal,
+		"spendable": spendable,
+		"assets":    assets,
+		"utxos":     utxoList,
 	})
 }
 
@@ -256,6 +438,10 @@ type APITx struct {
 	Inputs     []string `json:"inputs"`
 	SenderPub  string   `json:"sender_pub"`  // base64
 	Signature  string   `json:"signature"`   // base64
+	Lock       *utxo.Lock `json:"lock"`      // optional time or script lock on the receiver's output
+	Asset      string   `json:"asset"`       // asset ID to send; empty for the native coin
+	PSBT       string   `json:"psbt"`        // a signed packet from /tx/build, as JSON or base64, instead of the fields above
+	AllowUnknown bool   `json:"allow_unknown"` // send even if the receiver is not a registered wallet
 }
 
 func txSubmitHandler(w http.ResponseWriter, r *http.Request) {
@@ -268,97 +454,203 @@ func txSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	// build transaction
-	txx := tx.NewTransaction(at.SenderID, at.ReceiverID, at.Amount, at.Note, at.Inputs)
+	// Signatures cover the internal wallet IDs, not the address strings
+	if !normalizeAddresses(w, &at.SenderID, &at.ReceiverID) {
+		return
+	}
+
+	var txx *tx.Transaction
+	if at.PSBT != "" {
+		p, err := psbt.Decode([]byte(at.PSBT))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if txx, err = p.Finalize(); err != nil {
+			http.Error(w, "invalid psbt: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		// build transaction
+		txx = tx.NewTransaction(at.SenderID, at.ReceiverID, at.Amount, at.Note, at.Inputs)
+		if at.Lock != nil || at.Asset != "" {
+			txx.Lock = at.Lock
+			txx.Asset = at.Asset
+			txx.ID = txx.ComputeID()
+		}
+
+		// decode pub and sig
+		pubb, err := base64.StdEncoding.DecodeString(at.SenderPub)
+		if err != nil {
+			http.Error(w, "invalid sender_pub", http.StatusBadRequest)
+			return
+		}
+		sigb, err := base64.StdEncoding.DecodeString(at.Signature)
+		if err != nil {
+			http.Error(w, "invalid signature", http.StatusBadRequest)
+			return
+		}
+		txx.SenderPub = pubb
+		txx.Signature = sigb
+	}
+	if err := checkTransferLock(txx.Lock); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// decode pub and sig
-	pubb, err := base64.StdEncoding.DecodeString(at.SenderPub)
+	// verify the signature and that the key owns the sender wallet, or
+	// that a multisig sender's cosigners meet its threshold. Packets are
+	// signed over the signature hash. The fields above may be signed over
+	// the signature hash too, which binds the signature to the inputs, or
+	// over the payload as older clients sign them.
+	var err error
+	switch {
+	case multisig.IsAddress(txx.SenderID):
+		err = multisig.VerifyTransaction(txx)
+	case at.PSBT != "":
+		err = txx.VerifySigHashSigner()
+	default:
+		if err = txx.VerifySigHashSigner(); err != nil {
+			err = txx.VerifySigner()
+		}
+	}
 	if err != nil {
-		http.Error(w, "invalid sender_pub", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	sigb, err := base64.StdEncoding.DecodeString(at.Signature)
+	if err := checkInvoicePayment(r.Context(), txx.ReceiverID, txx.Asset, txx.Note); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	external, err := checkRecipient(r.Context(), txx.ReceiverID, at.AllowUnknown)
 	if err != nil {
-		http.Error(w, "invalid signature", http.StatusBadRequest)
+		writeTransferError(w, err)
 		return
 	}
-	txx.SenderPub = pubb
-	txx.Signature = sigb
 
-	// verify signature
-	if !crypto.VerifySignature(ed25519.PublicKey(pubb), txx.Payload(), sigb) {
-		http.Error(w, "signature invalid", http.StatusBadRequest)
+	if err := applySignedTransfer(r.Context(), txx, external, r.RemoteAddr, nil); err != nil {
+		writeTransferError(w, err)
 		return
 	}
 
-	// validate inputs exist and belong to sender and are unspent
+	writeJSON(w, map[string]interface{}{"status": "accepted", "txid": txx.ID})
+}
+
+// lookupUTXO finds an output - prefer database over in-memory
+func lookupUTXO(ctx context.Context, id string) *utxo.UTXO {
+	if dbClient != nil {
+		rec, err := dbClient.GetUTXOByID(ctx, id)
+		if err != nil {
+			return nil
+		}
+		return &utxo.UTXO{ID: rec.UTXOID, Owner: rec.Owner, Amount: rec.Amount, Spent: rec.Spent, Lock: rec.Lock, Asset: rec.Asset}
+	}
+	return utxoMgr.GetUTXO(id)
+}
+
+// applySignedTransfer checks the inputs a signed transaction names and
+// applies it: the inputs are spent, the receiver and change outputs are
+// created and the transaction is queued for mining. external registers the
+// receiver as an external wallet along with the outputs (see
+// checkRecipient). claim, when set, runs after the checks and before any
+// input is spent; its error stops the transfer.
+func applySignedTransfer(ctx context.Context, txx *tx.Transaction, external bool, ip string, claim func() error) error {
+	transferMu.Lock()
+	defer transferMu.Unlock()
+
+	// the ID is the signature hash, which covers the payload and inputs,
+	// so a transaction that was already applied is refused before its
+	// inputs are looked at
+	if dbClient != nil {
+		if _, err := dbClient.GetTransactionByID(ctx, txx.ID); err == nil {
+			return &transferError{status: http.StatusConflict, msg: "transaction " + txx.ID + " was already applied"}
+		}
+	}
+
+	// validate inputs exist and belong to sender and are unspent and unlocked
 	var total int64
+	var inputs []*utxo.UTXO
+	seen := map[string]bool{}
+	height, now := chainHeight(), time.Now().Unix()
 	for _, in := range txx.InputUTXOs {
-		u := utxoMgr.GetUTXO(in)
+		if seen[in] {
+			return badTransfer("input %s listed twice", in)
+		}
+		seen[in] = true
+		u := lookupUTXO(ctx, in)
 		if u == nil {
-			http.Error(w, "input utxo not found: "+in, http.StatusBadRequest)
-			return
+			return badTransfer("input utxo not found: %s", in)
 		}
 		if u.Owner != txx.SenderID {
-			http.Error(w, "input owner mismatch", http.StatusBadRequest)
-			return
+			return badTransfer("input owner mismatch")
 		}
 		if u.Spent {
-			http.Error(w, "input already spent", http.StatusBadRequest)
-			return
+			return badTransfer("input already spent")
+		}
+		if err := u.Lock.CheckSpend(height, now); err != nil {
+			return badTransfer("input %s: %v", in, err)
+		}
+		inputs = append(inputs, u)
+		if u.Asset == txx.Asset {
+			total += u.Amount
 		}
-		total += u.Amount
 	}
 	if total < txx.Amount {
-		http.Error(w, "insufficient funds", http.StatusBadRequest)
-		return
+		return badTransfer("insufficient funds")
 	}
-
-	// spend inputs
-	for _, in := range txx.InputUTXOs {
-		if err := utxoMgr.Spend(in, txx.SenderID); err != nil {
-			http.Error(w, "failed to spend input: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if dbClient != nil {
-			if err := dbClient.SpendUTXO(context.Background(), in, txx.ID); err != nil {
-				log.Printf("Warning: failed to mark UTXO as spent in DB: %v", err)
-			}
-		}
+	// every asset spent must reappear in the receiver and change outputs
+	if err := tx.CheckConservation(inputs, txx.Outputs(total)); err != nil {
+		return badTransfer("%v", err)
 	}
-
-	// create receiver utxo
-	utxoMgr.AddUTXO(txx.ReceiverID, txx.Amount)
-	if dbClient != nil {
-		if err := dbClient.InsertUTXO(context.Background(), txx.ID+"_recv", txx.ReceiverID, txx.Amount); err != nil {
-			log.Printf("Warning: failed to insert receiver UTXO in DB: %v", err)
+	if claim != nil {
+		if err := claim(); err != nil {
+			return err
 		}
 	}
 
-	// create change utxo if any
-	change := total - txx.Amount
-	if change > 0 {
-		utxoMgr.AddUTXO(txx.SenderID, change)
-		if dbClient != nil {
-			if err := dbClient.InsertUTXO(context.Background(), txx.ID+"_change", txx.SenderID, change); err != nil {
-				log.Printf("Warning: failed to insert change UTXO in DB: %v", err)
-			}
-		}
+	// spend inputs and create the receiver and change outputs
+	t := db.Transfer{Outputs: txx.Outputs(total), Height: height, Now: now, RegisterReceiver: external}
+	if err := recordTransfer(ctx, txx, t, ip); err != nil {
+		return err
 	}
-
 	if dbClient != nil {
-		if err := dbClient.InsertTransaction(context.Background(), txx.ID, txx.SenderID, txx.ReceiverID, txx.Amount, txx.Note, txx.Signature, txx.SenderPub, r.RemoteAddr); err != nil {
-			log.Printf("Warning: failed to log transaction in DB: %v", err)
-		}
-		if err := dbClient.InsertLog(context.Background(), txx.SenderID, "tx_sent", "Transfer to "+txx.ReceiverID, "confirmed", r.RemoteAddr); err != nil {
+		if err := dbClient.InsertLog(ctx, txx.SenderID, "tx_sent", "Transfer to "+txx.ReceiverID, "confirmed", ip); err != nil {
 			log.Printf("Warning: failed to log action in DB: %v", err)
 		}
 	}
 
-	writeJSON(w, map[string]interface{}{"status": "accepted", "txid": txx.ID})
-
 	// Add transaction to pending pool for mining
 	bc.AddPendingTransaction(txx.ID)
+	publishTransfer(ctx, txx)
+	return nil
+}
+
+// recordTransfer spends the inputs of txx and creates t.Outputs, storing
+// the transaction with them in one database transaction so a failure spends
+// nothing, then adds the outputs to the in-memory set. t carries the
+// outputs and how the inputs are checked; its record and inputs are taken
+// from txx.
+func recordTransfer(ctx context.Context, txx *tx.Transaction, t db.Transfer, ip string) error {
+	if dbClient != nil {
+		t.Record, t.Inputs = txRecord(txx, ip), txx.InputUTXOs
+		err := dbClient.ApplyTransfer(ctx, t)
+		if errors.Is(err, db.ErrUTXOUnavailable) {
+			return &transferError{status: http.StatusConflict, msg: "failed to spend input: " + err.Error()}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record transfer: %w", err)
+		}
+	} else {
+		for _, in := range txx.InputUTXOs {
+			if err := utxoMgr.SpendAt(in, txx.SenderID, t.Height, t.Now); err != nil {
+				return fmt.Errorf("failed to spend input: %w", err)
+			}
+		}
+	}
+	for _, o := range t.Outputs {
+		utxoMgr.AddAssetUTXO(o.Owner, o.Asset, o.Amount, o.Lock)
+	}
+	return nil
 }
 
 // APITxWithPrivKey is used for the sign-and-submit endpoint where client sends private key
@@ -369,6 +661,9 @@ type APITxWithPrivKey struct {
 	Note       string `json:"note"`
 	SenderPub  string `json:"sender_pub"`  // base64
 	SenderPriv string `json:"sender_priv"` // base64
+	Lock       *utxo.Lock `json:"lock"`    // optional time or script lock on the receiver's output
+	Asset      string `json:"asset"`       // asset ID to send; empty for the native coin
+	AllowUnknown bool `json:"allow_unknown"` // send even if the receiver is not a registered wallet
 }
 
 // txSignAndSubmitHandler signs the transaction server-side and submits it
@@ -384,6 +679,9 @@ func txSignAndSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &req.SenderID, &req.ReceiverID) {
+		return
+	}
 	
 	// Decode private key
 	privBytes, err := base64.StdEncoding.DecodeString(req.SenderPriv)
@@ -399,142 +697,218 @@ func txSignAndSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Prove the caller holds the sender's key before the directory is asked
+	// about the receiver
+	if _, err := senderKey(req.SenderID, pubBytes, privBytes); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	if err := checkTransferLock(req.Lock); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	external, err := checkRecipient(r.Context(), req.ReceiverID, req.AllowUnknown)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	
+	txx, err := signAndSubmitTransfer(r.Context(), req.SenderID, req.ReceiverID, req.Asset, req.Amount, req.Note, req.Lock, external, pubBytes, privBytes, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	
+	writeJSON(w, map[string]interface{}{"status": "accepted", "txid": txx.ID})
+}
+
+// transferError is a transfer failure that maps to a specific HTTP status
+type transferError struct {
+	status int
+	msg    string
+}
+
+func (e *transferError) Error() string { return e.msg }
+
+func badTransfer(format string, args ...interface{}) error {
+	return &transferError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+// writeTransferError answers with err's status if it is a transferError,
+// or 500 otherwise
+func writeTransferError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if te, ok := err.(*transferError); ok {
+		status = te.status
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// transferMu serialises UTXO selection and spending between HTTP requests
+// and background jobs so two transfers cannot pick the same inputs
+var transferMu sync.Mutex
+
+// signAndSubmitTransfer validates the sender's keys, selects UTXOs, signs the
+// transaction, spends the inputs and queues it for mining. It is shared by
+// the sign-and-submit endpoint and scheduled standing orders. assetID is
+// empty for the native coin; external is as for applySignedTransfer.
+func signAndSubmitTransfer(ctx context.Context, senderID, receiverID, assetID string, amount int64, note string, lock *utxo.Lock, external bool, pubBytes, privBytes []byte, ip string) (*tx.Transaction, error) {
+	privKey, err := senderKey(senderID, pubBytes, privBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	if amount <= 0 {
+		return nil, badTransfer("amount must be positive")
+	}
+	if lock != nil {
+		if err := lock.Validate(); err != nil {
+			return nil, badTransfer("invalid lock: %v", err)
+		}
+	}
+	if err := checkInvoicePayment(ctx, receiverID, assetID, note); err != nil {
+		return nil, err
+	}
+	
+	return submitTransfer(ctx, senderID, assetID, amount, external, ip, func(inputs []string) (*tx.Transaction, error) {
+		txx := tx.NewTransaction(senderID, receiverID, amount, note, inputs)
+		if lock != nil || assetID != "" {
+			txx.Lock = lock
+			txx.Asset = assetID
+			txx.ID = txx.ComputeID()
+		}
+		txx.SenderPub = pubBytes
+		txx.Signature = crypto.SignPayload(privKey, txx.SigHash())
+		
+		// Verify signature before proceeding
+		if err := txx.VerifySigHashSigner(); err != nil {
+			return nil, fmt.Errorf("internal error: %v", err)
+		}
+		return txx, nil
+	})
+}
+
+// senderKey checks that privBytes is the private key of pubBytes and that
+// the key owns senderID
+func senderKey(senderID string, pubBytes, privBytes []byte) (ed25519.PrivateKey, error) {
 	// Verify that the private key corresponds to the public key
 	if len(privBytes) != ed25519.PrivateKeySize {
-		http.Error(w, "invalid private key size", http.StatusBadRequest)
-		return
+		return nil, badTransfer("invalid private key size")
 	}
 	
 	privKey := ed25519.PrivateKey(privBytes)
 	derivedPub := privKey.Public().(ed25519.PublicKey)
 	
 	if !bytes.Equal(derivedPub, pubBytes) {
-		http.Error(w, "private key does not match public key", http.StatusBadRequest)
-		return
+		return nil, badTransfer("private key does not match public key")
 	}
 	
 	// Verify wallet ID matches the public key
-	expectedWalletID := crypto.WalletIDFromPub(pubBytes)
-	if expectedWalletID != req.SenderID {
-		http.Error(w, "sender_id does not match public key", http.StatusBadRequest)
-		return
+	if crypto.WalletIDFromPub(pubBytes) != senderID {
+		return nil, badTransfer("sender_id does not match public key")
 	}
-	
+	return privKey, nil
+}
+
+// selectInputs picks unlocked outputs of an asset owned by senderID until
+// they cover amount, returning them and their total
+func selectInputs(ctx context.Context, senderID, assetID string, amount int64) ([]*utxo.UTXO, int64, error) {
 	// Get UTXOs for the sender - prefer database over in-memory
-	var selectedInputs []string
+	var selected []*utxo.UTXO
 	var totalInput int64
+	height, now := chainHeight(), time.Now().Unix()
 	
 	if dbClient != nil {
 		// Use database UTXOs (persistent)
-		dbUtxos, err := dbClient.GetUnspentUTXOs(context.Background(), req.SenderID)
+		dbUtxos, err := dbClient.GetUnspentUTXOs(ctx, senderID)
 		if err != nil {
 			log.Printf("Warning: failed to get UTXOs from DB: %v", err)
 		}
 		if len(dbUtxos) == 0 {
-			http.Error(w, "no UTXOs available for sender", http.StatusBadRequest)
-			return
+			return nil, 0, badTransfer("no UTXOs available for sender")
 		}
 		
-		// Select UTXOs to cover the amount
+		// Select UTXOs of the asset to cover the amount, skipping locked ones
 		for _, u := range dbUtxos {
-			utxoID := u["utxo_id"].(string)
-			amount := u["amount"].(int64)
-			selectedInputs = append(selectedInputs, utxoID)
-			totalInput += amount
-			if totalInput >= req.Amount {
+			if u.Asset != assetID || u.Lock.CheckSpend(height, now) != nil {
+				continue
+			}
+			selected = append(selected, &utxo.UTXO{ID: u.UTXOID, Owner: u.Owner, Amount: u.Amount, Lock: u.Lock, Asset: u.Asset})
+			totalInput += u.Amount
+			if totalInput >= amount {
 				break
 			}
 		}
 	} else {
 		// Fallback to in-memory UTXOs
-		utxos := utxoMgr.GetUnspentByOwner(req.SenderID)
+		utxos := utxoMgr.GetUnspentByOwner(senderID)
 		if len(utxos) == 0 {
-			http.Error(w, "no UTXOs available for sender", http.StatusBadRequest)
-			return
+			return nil, 0, badTransfer("no UTXOs available for sender")
 		}
 		
-		// Select UTXOs to cover the amount
+		// Select UTXOs of the asset to cover the amount, skipping locked ones
 		for _, u := range utxos {
-			selectedInputs = append(selectedInputs, u.ID)
+			if u.Asset != assetID || u.Lock.CheckSpend(height, now) != nil {
+				continue
+			}
+			selected = append(selected, u)
 			totalInput += u.Amount
-			if totalInput >= req.Amount {
+			if totalInput >= amount {
 				break
 			}
 		}
 	}
 	
-	if totalInput < req.Amount {
-		http.Error(w, fmt.Sprintf("insufficient funds: have %d, need %d", totalInput, req.Amount), http.StatusBadRequest)
-		return
+	if totalInput < amount {
+		return nil, 0, badTransfer("insufficient funds: have %d, need %d", totalInput, amount)
 	}
+	return selected, totalInput, nil
+}
+
+// submitTransfer selects enough of the sender's UTXOs of an asset to cover
+// amount, has build create the signed transaction spending them, and
+// applies it. Transfers are serialised so two never select the same inputs.
+func submitTransfer(ctx context.Context, senderID, assetID string, amount int64, external bool, ip string, build func(inputs []string) (*tx.Transaction, error)) (*tx.Transaction, error) {
+	transferMu.Lock()
+	defer transferMu.Unlock()
 	
-	// Create the transaction
-	txx := tx.NewTransaction(req.SenderID, req.ReceiverID, req.Amount, req.Note, selectedInputs)
-	txx.SenderPub = pubBytes
-	
-	// Sign the transaction payload
-	payload := txx.Payload()
-	signature := crypto.SignPayload(privKey, payload)
-	txx.Signature = signature
-	
-	// Verify signature before proceeding
-	if !crypto.VerifySignature(pubBytes, payload, signature) {
-		http.Error(w, "internal error: signature verification failed", http.StatusInternalServerError)
-		return
+	height, now := chainHeight(), time.Now().Unix()
+	selected, totalInput, err := selectInputs(ctx, senderID, assetID, amount)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Spend inputs - use DB if available, otherwise in-memory
-	for _, in := range txx.InputUTXOs {
-		if dbClient != nil {
-			// Spend in database (primary)
-			if err := dbClient.SpendUTXO(context.Background(), in, txx.ID); err != nil {
-				http.Error(w, "failed to spend input in DB: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			// Fallback to in-memory
-			if err := utxoMgr.Spend(in, txx.SenderID); err != nil {
-				http.Error(w, "failed to spend input: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
+	selectedInputs := make([]string, len(selected))
+	for i, u := range selected {
+		selectedInputs[i] = u.ID
 	}
 	
-	// Create receiver UTXO
-	receiverUtxoID := txx.ID + "_recv"
-	if dbClient != nil {
-		if err := dbClient.InsertUTXO(context.Background(), receiverUtxoID, txx.ReceiverID, txx.Amount); err != nil {
-			log.Printf("Warning: failed to insert receiver UTXO in DB: %v", err)
-		}
+	// Create and sign the transaction
+	txx, err := build(selectedInputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.CheckConservation(selected, txx.Outputs(totalInput)); err != nil {
+		return nil, badTransfer("%v", err)
 	}
-	utxoMgr.AddUTXO(txx.ReceiverID, txx.Amount)
 	
-	// Create change UTXO if any
-	change := totalInput - txx.Amount
-	if change > 0 {
-		changeUtxoID := txx.ID + "_change"
-		if dbClient != nil {
-			if err := dbClient.InsertUTXO(context.Background(), changeUtxoID, txx.SenderID, change); err != nil {
-				log.Printf("Warning: failed to insert change UTXO in DB: %v", err)
-			}
-		}
-		utxoMgr.AddUTXO(txx.SenderID, change)
+	// Spend inputs and create the receiver and change outputs
+	t := db.Transfer{Outputs: txx.Outputs(totalInput), Height: height, Now: now, RegisterReceiver: external}
+	if err := recordTransfer(ctx, txx, t, ip); err != nil {
+		return nil, err
 	}
 	
 	// Log transaction
 	if dbClient != nil {
-		if err := dbClient.InsertTransaction(context.Background(), txx.ID, txx.SenderID, txx.ReceiverID, txx.Amount, txx.Note, txx.Signature, txx.SenderPub, r.RemoteAddr); err != nil {
-			log.Printf("Warning: failed to log transaction in DB: %v", err)
-		}
-		if err := dbClient.InsertLog(context.Background(), txx.SenderID, "tx_sent", "Transfer to "+txx.ReceiverID, "confirmed", r.RemoteAddr); err != nil {
+		if err := dbClient.InsertLog(ctx, txx.SenderID, "tx_sent", "Transfer to "+txx.ReceiverID, "confirmed", ip); err != nil {
 			log.Printf("Warning: failed to log action in DB: %v", err)
 		}
 	}
 	
-	writeJSON(w, map[string]interface{}{"status": "accepted", "txid": txx.ID})
-	
 	// Add transaction to pending pool for mining
 	bc.AddPendingTransaction(txx.ID)
+	publishTransfer(ctx, txx)
+	
+	return txx, nil
 }
 
 // txDetailsHandler returns full transaction details including signature
@@ -562,14 +936,34 @@ func txDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Convert signature and public key to base64 for frontend display
-	if sig, ok := txData["signature"].([]byte); ok && sig != nil {
-		txData["signature_base64"] = base64.StdEncoding.EncodeToString(sig)
+	resp := struct {
+		*db.TxRecord
+		SignatureBase64 string `json:"signature_base64,omitempty"`
+		SenderPubBase64 string `json:"sender_pub_base64,omitempty"`
+	}{TxRecord: txData}
+	if txData.Signature != nil {
+		resp.SignatureBase64 = base64.StdEncoding.EncodeToString(txData.Signature)
 	}
-	if pub, ok := txData["sender_public_key"].([]byte); ok && pub != nil {
-		txData["sender_pub_base64"] = base64.StdEncoding.EncodeToString(pub)
+	if txData.SenderPublicKey != nil {
+		resp.SenderPubBase64 = base64.StdEncoding.EncodeToString(txData.SenderPublicKey)
 	}
 	
-	writeJSON(w, txData)
+	writeJSON(w, resp)
+}
+
+// txRecord converts a signed transaction into its database row
+func txRecord(txx *tx.Transaction, ip string) db.TxRecord {
+	return db.TxRecord{
+		TxID:             txx.ID,
+		SenderWalletID:   txx.SenderID,
+		ReceiverWalletID: txx.ReceiverID,
+		Amount:           txx.Amount,
+		Note:             txx.Note,
+		Signature:        txx.Signature,
+		SenderPublicKey:  txx.SenderPub,
+		IPAddress:        ip,
+		Asset:            txx.Asset,
+	}
 }
 
 func writeJSON(w http.ResponseWriter, v interface{}) {
@@ -702,6 +1096,7 @@ func verifyOtpHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !ok {
+		recordAudit(r, audit.OTPFailed, req.Email, "", "signup verification")
 		http.Error(w, "invalid or expired otp", http.StatusBadRequest)
 		return
 	}
@@ -744,6 +1139,7 @@ func verifyOtpHandler(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]interface{}{
 		"user_id":    userID,
 		"wallet_id":  walletID,
+		"address":    addressOf(walletID),
 		"public_key": base64.StdEncoding.EncodeToString(pub),
 	})
 }
@@ -763,93 +1159,72 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user by email
-	userRow, err := dbClient.GetUserByEmail(context.Background(), req.Email)
+	user, err := dbClient.GetUserByEmail(context.Background(), req.Email)
 	if err != nil {
+		recordAudit(r, audit.LoginFailed, req.Email, "", "unknown user")
 		http.Error(w, "user not found", http.StatusUnauthorized)
 		return
 	}
 
 	// Verify password
-	passwordHash := userRow["password_hash"].(string)
-	if !crypto.VerifyPassword(req.Password, passwordHash) {
+	if !crypto.VerifyPassword(req.Password, user.PasswordHash) {
+		recordAudit(r, audit.LoginFailed, req.Email, user.ID, "invalid password")
+		if wallet, err := dbClient.GetUserWalletByUserID(r.Context(), user.ID); err == nil {
+			publishSecurity(wallet.WalletID, audit.LoginFailed, "invalid password", r.RemoteAddr)
+		}
 		http.Error(w, "invalid password", http.StatusUnauthorized)
 		return
 	}
 
-	userID := userRow["id"].(string)
+	userID := user.ID
 
 	// Get wallet info
-	walletRow, err := dbClient.GetUserWalletByUserID(context.Background(), userID)
+	wallet, err := dbClient.GetUserWalletByUserID(context.Background(), userID)
 	if err != nil {
 		http.Error(w, "wallet not found: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Get encrypted private key and DECRYPT it for the frontend
-	privKeyEnc := walletRow["private_key_encrypted"].([]byte)
-	pubKey := walletRow["public_key"].([]byte)
-	walletID := walletRow["wallet_id"].(string)
-
 	// Decrypt the private key using the Server Master Key
-	decryptedPrivKey, err := crypto.DecryptPrivateKey(privKeyEnc)
+	decryptedPrivKey, err := crypto.DecryptPrivateKey(wallet.PrivateKeyEncrypted)
 	if err != nil {
 		log.Printf("Error decrypting private key for user %s: %v", userID, err)
 		http.Error(w, "failed to decrypt wallet key", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r, audit.KeyAccess, wallet.WalletID, wallet.WalletID, "private key decrypted for login")
+	recordAudit(r, audit.LoginSuccess, wallet.WalletID, userID, "")
+	_ = dbClient.InsertLog(r.Context(), wallet.WalletID, "login_success", "Signed in as "+user.Email, "success", r.RemoteAddr)
+	publishSecurity(wallet.WalletID, audit.LoginSuccess, "signed in as "+user.Email, r.RemoteAddr)
 
-	// Return user profile data with DECRYPTED private key
-	writeJSON(w, map[string]interface{}{
-		"user_id":     userID,
-		"wallet_id":   walletID,
-		"email":       userRow["email"],
-		"full_name":   userRow["full_name"],
-		"cnic":        userRow["cnic"],
-		"public_key":  base64.StdEncoding.EncodeToString(pubKey),
-		"private_key": base64.StdEncoding.EncodeToString(decryptedPrivKey), // Send Raw Key
-		"balance":     walletRow["balance"],
-	})
-}
-
-
-func transactionHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet || dbClient == nil {
-		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
-		return
+	// The session token authorises the event streams for this wallet, and
+	// the admin endpoints for an operator
+	issue := sessions.Issue
+	if isAdminEmail(user.Email) {
+		issue = sessions.IssueAdmin
 	}
-
-	walletID := r.URL.Query().Get("wallet")
-	if walletID == "" {
-		http.Error(w, "missing wallet param", http.StatusBadRequest)
-		return
-	}
-
-	txs, err := dbClient.GetTransactionHistory(context.Background(), walletID, 50)
+	token, claims, err := issue(userID, []string{wallet.WalletID})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "failed to start session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Return user profile data with DECRYPTED private key
 	writeJSON(w, map[string]interface{}{
-		"wallet":       walletID,
-		"transactions": txs,
+		"user_id":            userID,
+		"wallet_id":          wallet.WalletID,
+		"address":            addressOf(wallet.WalletID),
+		"email":              user.Email,
+		"full_name":          user.FullName,
+		"cnic":               user.CNIC,
+		"public_key":         base64.StdEncoding.EncodeToString(wallet.PublicKey),
+		"private_key":        base64.StdEncoding.EncodeToString(decryptedPrivKey), // Send Raw Key
+		"balance":            wallet.Balance,
+		"session_token":      token,
+		"session_expires_at": time.Unix(claims.ExpiresAt, 0).UTC(),
 	})
 }
 
-type LogsReq struct {
-	WalletID string `json:"wallet_id"`
-	Action   string `json:"action"`
-	Limit    int    `json:"limit"`
-}
-
-func logsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost || dbClient == nil {
-		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
-		return
-	}
-	// Simplified logs handler (full implementation would query logs from DB)
-	writeJSON(w, map[string]string{"status": "logs endpoint ready"})
-}
 
 // Blockchain endpoints
 
@@ -873,6 +1248,9 @@ func mineHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "miner_address required", http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &mr.MinerAddress) {
+		return
+	}
 
 	block, err := bc.MinePendingTransactions(mr.MinerAddress)
 	if err != nil {
@@ -880,17 +1258,55 @@ func mineHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Persist the block and mark its transactions mined. The block is
+	// already on the chain, so a failed write is retried before giving up.
+	if dbClient != nil {
+		if err := storeBlock(r.Context(), block); err != nil {
+			http.Error(w, fmt.Sprintf("block %d was mined but could not be stored: %v", block.Index, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	recordAudit(r, audit.BlockMined, mr.MinerAddress, block.Hash,
+		fmt.Sprintf("block %d with %d transactions", block.Index, len(block.Transactions)))
+	settleInvoices(r.Context(), block)
+	publishBlock(r.Context(), block)
+
 	writeJSON(w, map[string]interface{}{
 		"block_index":    block.Index,
 		"block_hash":     block.Hash,
 		"nonce":          block.Nonce,
 		"difficulty":     block.Difficulty,
 		"transactions":   block.Transactions,
+		"merkle_root":    block.MerkleRoot,
 		"previous_hash":  block.PreviousHash,
 		"timestamp":      block.Timestamp,
+		"persisted":      dbClient != nil,
 	})
 }
 
+// blockStoreAttempts is how many times a mined block is written before the
+// failure is reported
+const blockStoreAttempts = 3
+
+// storeBlock writes a mined block, retrying transient failures
+func storeBlock(ctx context.Context, block *blockchain.Block) error {
+	var err error
+	for attempt := 1; attempt <= blockStoreAttempts; attempt++ {
+		if err = dbClient.InsertBlock(ctx, block); err == nil {
+			return nil
+		}
+		log.Printf("Warning: failed to store mined block %s (attempt %d of %d): %v", block.Hash, attempt, blockStoreAttempts, err)
+		if attempt < blockStoreAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+			}
+		}
+	}
+	return err
+}
+
 func blocksHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -906,6 +1322,7 @@ func blocksHandler(w http.ResponseWriter, r *http.Request) {
 			"nonce":         b.Nonce,
 			"difficulty":    b.Difficulty,
 			"transactions":  b.Transactions,
+			"merkle_root":   b.MerkleRoot,
 			"previous_hash": b.PreviousHash,
 			"timestamp":     b.Timestamp,
 		})
@@ -943,22 +1360,32 @@ func pendingHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// zakatTriggerHandler manually triggers Zakat deduction
+// zakatTriggerHandler runs the Zakat job immediately for an admin session.
+// It goes through the job runner, so it never overlaps a scheduled run, and
+// wallets already charged this month are not charged again.
 func zakatTriggerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	claims, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
 
-	if zakatScheduler == nil {
+	if zakatScheduler == nil || jobRunner == nil {
 		http.Error(w, "Zakat scheduler not available", http.StatusServiceUnavailable)
 		return
 	}
 
-	ctx := context.Background()
-	err := zakatScheduler.TriggerZakatNow(ctx)
+	err := jobRunner.RunNow(r.Context(), "zakat")
+	recordAudit(r, audit.AdminAction, claims.UserID, "zakat", auditOutcome("manual zakat run", err))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if err == jobs.ErrUnknownJob {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -1011,6 +1438,9 @@ func profileGetHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing wallet_id param", http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
 
 	profile, err := dbClient.GetUserByWalletID(context.Background(), walletID)
 	if err != nil {
@@ -1100,6 +1530,9 @@ func beneficiariesAddHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !normalizeAddresses(w, &req.WalletID) {
+		return
+	}
 
 	if err := dbClient.AddBeneficiary(context.Background(), req.UserID, req.WalletID, req.BeneficiaryName); err != nil {
 		http.Error(w, "failed to add beneficiary: "+err.Error(), http.StatusInternalServerError)
@@ -1165,6 +1598,7 @@ func confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !ok {
+		recordAudit(r, audit.OTPFailed, req.UserID, req.NewEmail, "email change confirmation")
 		http.Error(w, "invalid or expired otp", http.StatusBadRequest)
 		return
 	}
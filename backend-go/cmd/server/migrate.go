@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+
+	"blockchain-wallet/pkg/db"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up                 apply all pending migrations
+  down [n]           roll back the last n migrations (default 1)
+  status             list migrations and whether they are applied
+  baseline <version> mark migrations up to <version> as applied without running them
+                     (for databases created by hand from the old schema.sql)`
+
+// runMigrate implements the `migrate` subcommand and returns the exit code
+func runMigrate(args []string) int {
+	_ = godotenv.Load()
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+	client, err := db.Open(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ DB connection failed: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := client.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Printf("✓ applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of steps")
+				return 2
+			}
+		}
+		reverted, err := client.MigrateDown(ctx, steps)
+		for _, m := range reverted {
+			fmt.Printf("✓ rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+
+	case "status":
+		status, err := client.MigrationStatus(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		for _, s := range status {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+	case "baseline":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "baseline expects a version")
+			return 2
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "baseline expects a numeric version")
+			return 2
+		}
+		if err := client.Baseline(ctx, version); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("✓ baselined at version %d\n", version)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
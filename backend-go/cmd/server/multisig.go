@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/tx"
+)
+
+const (
+	defaultProposalLimit = 50
+	maxProposalLimit     = 500
+)
+
+// CosignerAuth identifies a cosigner acting on a proposal. Either signature
+// (over the payload being approved) or private_key is given; with the
+// private key the server signs, as /tx/sign-and-submit does.
+type CosignerAuth struct {
+	PublicKey  string `json:"public_key"`  // base64
+	Signature  string `json:"signature"`   // base64
+	PrivateKey string `json:"private_key"` // base64
+}
+
+// sign returns the cosigner's signature over payload
+func (a CosignerAuth) sign(payload []byte) (multisig.Signature, error) {
+	var s multisig.Signature
+	if a.PrivateKey != "" {
+		priv, err := base64.StdEncoding.DecodeString(a.PrivateKey)
+		if err != nil || len(priv) != ed25519.PrivateKeySize {
+			return s, errors.New("invalid private_key")
+		}
+		s.PublicKey = ed25519.PrivateKey(priv).Public().(ed25519.PublicKey)
+		if a.PublicKey != "" && a.PublicKey != base64.StdEncoding.EncodeToString(s.PublicKey) {
+			return s, errors.New("private key does not match public key")
+		}
+		s.Signature = crypto.SignPayload(priv, payload)
+		return s, nil
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(a.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return s, errors.New("invalid public_key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return s, errors.New("signature or private_key required")
+	}
+	return multisig.Signature{PublicKey: pub, Signature: sig}, nil
+}
+
+// proposalView adds what a cosigner needs to sign and whether the proposal
+// can be executed
+type proposalView struct {
+	multisig.Proposal
+	Payload   []byte `json:"payload"` // base64; sign these bytes to approve
+	Threshold int    `json:"threshold"`
+	Ready     bool   `json:"ready"`
+}
+
+func viewProposal(p multisig.Proposal, policy multisig.Policy) proposalView {
+	v := proposalView{Proposal: p, Payload: p.Payload(), Threshold: policy.Threshold}
+	v.Ready = p.Status == multisig.ProposalPending && policy.Verify(v.Payload, p.Signatures) == nil
+	return v
+}
+
+type CreateMultisigReq struct {
+	UserID     string   `json:"user_id"` // optional; must be the session's user
+	Name       string   `json:"name"`
+	Threshold  int      `json:"threshold"`
+	PublicKeys []string `json:"public_keys"` // base64 Ed25519 keys
+}
+
+// multisigCreateHandler registers an M-of-N wallet for the session user.
+// The address is derived from the policy, so the same keys and threshold
+// always give the same one.
+func multisigCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateMultisigReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID != "" && req.UserID != claims.UserID {
+		http.Error(w, "user_id does not match the session", http.StatusForbidden)
+		return
+	}
+	if len(req.Name) > 100 {
+		http.Error(w, "name longer than 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	keys := make([]ed25519.PublicKey, len(req.PublicKeys))
+	for i, k := range req.PublicKeys {
+		b, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("public key %d is not base64", i+1), http.StatusBadRequest)
+			return
+		}
+		keys[i] = b
+	}
+	policy, err := multisig.NewPolicy(req.Threshold, keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mw := multisig.Wallet{
+		Address:   policy.Address(),
+		Name:      strings.TrimSpace(req.Name),
+		Policy:    policy,
+		CreatedBy: claims.UserID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := dbClient.GetMultisigWallet(r.Context(), mw.Address); err == nil {
+		http.Error(w, "a multisig wallet with these keys and threshold already exists: "+mw.Address, http.StatusConflict)
+		return
+	}
+	if err := dbClient.InsertMultisigWallet(r.Context(), mw); err != nil {
+		http.Error(w, "failed to create multisig wallet: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), mw.Address, "multisig_created",
+		fmt.Sprintf("%d-of-%d wallet %q created by user %s", policy.Threshold, len(policy.Keys), mw.Name, claims.UserID),
+		"success", r.RemoteAddr)
+
+	writeJSON(w, mw)
+}
+
+// multisigWalletHandler returns a multisig wallet with its balance, or with
+// public_key, the wallets that key cosigns
+func multisigWalletHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if k := q.Get("public_key"); k != "" {
+		pub, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			http.Error(w, "invalid public_key", http.StatusBadRequest)
+			return
+		}
+		list, err := dbClient.GetMultisigWalletsByKey(r.Context(), pub)
+		if err != nil {
+			http.Error(w, "failed to fetch wallets: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if list == nil {
+			list = []multisig.Wallet{}
+		}
+		writeJSON(w, map[string]interface{}{"wallets": list})
+		return
+	}
+
+	address := q.Get("address")
+	if address == "" {
+		http.Error(w, "missing address or public_key param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &address) {
+		return
+	}
+	mw, err := dbClient.GetMultisigWallet(r.Context(), address)
+	if err != nil {
+		http.Error(w, "multisig wallet not found", http.StatusNotFound)
+		return
+	}
+	balance, err := dbClient.GetBalance(r.Context(), address)
+	if err != nil {
+		http.Error(w, "failed to fetch balance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"wallet":  mw,
+		"balance": balance,
+	})
+}
+
+type ProposeReq struct {
+	WalletID     string   `json:"wallet_id"`
+	ReceiverID   string   `json:"receiver_id"`
+	Amount       int64    `json:"amount"`
+	Note         string   `json:"note"`
+	Timestamp    int64    `json:"timestamp"`     // required with a signature, since it is signed
+	Inputs       []string `json:"inputs"`        // UTXOs to spend; required with a signature (see /tx/build)
+	AllowUnknown bool     `json:"allow_unknown"` // pay a receiver that is not a registered wallet
+	CosignerAuth
+}
+
+// multisigProposeHandler opens a spend proposal. The proposer must be a
+// cosigner and their signature counts as the first approval. The inputs are
+// fixed here, since approvals sign the transaction's signature hash; they
+// are not reserved, so if they are spent first the proposal must be
+// cancelled and made again.
+func multisigProposeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ProposeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.WalletID, &req.ReceiverID) {
+		return
+	}
+	if req.ReceiverID == "" || req.Amount <= 0 {
+		http.Error(w, "receiver_id and a positive amount required", http.StatusBadRequest)
+		return
+	}
+	if req.Timestamp == 0 {
+		if req.PrivateKey == "" {
+			http.Error(w, "timestamp required with a signature", http.StatusBadRequest)
+			return
+		}
+		req.Timestamp = time.Now().Unix()
+	}
+	if len(req.Inputs) == 0 && req.PrivateKey == "" {
+		http.Error(w, "inputs required with a signature", http.StatusBadRequest)
+		return
+	}
+
+	mw, err := dbClient.GetMultisigWallet(r.Context(), req.WalletID)
+	if err != nil {
+		http.Error(w, "multisig wallet not found", http.StatusNotFound)
+		return
+	}
+
+	if len(req.Inputs) == 0 {
+		selected, _, err := selectInputs(r.Context(), mw.Address, "", req.Amount)
+		if err != nil {
+			writeTransferError(w, err)
+			return
+		}
+		for _, u := range selected {
+			req.Inputs = append(req.Inputs, u.ID)
+		}
+	}
+
+	p := multisig.Proposal{
+		WalletID:   mw.Address,
+		ReceiverID: req.ReceiverID,
+		Amount:     req.Amount,
+		Note:       req.Note,
+		Timestamp:  req.Timestamp,
+		Inputs:     req.Inputs,
+		Status:     multisig.ProposalPending,
+	}
+	sig, err := req.sign(p.Payload())
+	if err == nil {
+		err = mw.Policy.VerifyOne(p.Payload(), sig)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	// An unknown receiver is registered when the proposal is executed
+	if _, err := checkRecipient(r.Context(), p.ReceiverID, req.AllowUnknown); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	if p.ID, err = dbClient.InsertMultisigProposal(r.Context(), p); err != nil {
+		if errors.Is(err, multisig.ErrDuplicateProposal) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, "failed to create proposal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := dbClient.AddMultisigSignature(r.Context(), p.ID, sig); err != nil {
+		http.Error(w, "failed to store signature: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.Signatures = []multisig.Signature{sig}
+	p.CreatedAt = time.Now().UTC()
+	_ = dbClient.InsertLog(r.Context(), mw.Address, "multisig_proposed",
+		fmt.Sprintf("Proposal %s: %d to %s", p.ID, p.Amount, p.ReceiverID), "pending", r.RemoteAddr)
+
+	writeJSON(w, viewProposal(p, mw.Policy))
+}
+
+// loadProposal returns a proposal and the policy of its wallet, writing the
+// error response when either is missing
+func loadProposal(w http.ResponseWriter, ctx context.Context, id string) (multisig.Proposal, multisig.Policy, bool) {
+	if id == "" {
+		http.Error(w, "proposal_id required", http.StatusBadRequest)
+		return multisig.Proposal{}, multisig.Policy{}, false
+	}
+	p, err := dbClient.GetMultisigProposal(ctx, id)
+	if err != nil {
+		http.Error(w, "proposal not found", http.StatusNotFound)
+		return p, multisig.Policy{}, false
+	}
+	mw, err := dbClient.GetMultisigWallet(ctx, p.WalletID)
+	if err != nil {
+		http.Error(w, "failed to load multisig wallet: "+err.Error(), http.StatusInternalServerError)
+		return p, multisig.Policy{}, false
+	}
+	return p, mw.Policy, true
+}
+
+// multisigSignHandler adds a cosigner's approval to a pending proposal
+func multisigSignHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ProposalID string `json:"proposal_id"`
+		CosignerAuth
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, policy, ok := loadProposal(w, r.Context(), req.ProposalID)
+	if !ok {
+		return
+	}
+	if p.Status != multisig.ProposalPending {
+		http.Error(w, "proposal is "+p.Status, http.StatusConflict)
+		return
+	}
+	sig, err := req.sign(p.Payload())
+	if err == nil {
+		err = policy.VerifyOne(p.Payload(), sig)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := dbClient.AddMultisigSignature(r.Context(), p.ID, sig); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if p, err = dbClient.GetMultisigProposal(r.Context(), p.ID); err != nil {
+		http.Error(w, "failed to reload proposal: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, viewProposal(p, policy))
+}
+
+// multisigExecuteHandler spends a proposal once enough cosigners have
+// approved it. Anyone may execute; the signatures are the authorisation.
+func multisigExecuteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ProposalID string `json:"proposal_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, policy, ok := loadProposal(w, r.Context(), req.ProposalID)
+	if !ok {
+		return
+	}
+	if p.Status != multisig.ProposalPending {
+		http.Error(w, "proposal is "+p.Status, http.StatusConflict)
+		return
+	}
+	if err := policy.Verify(p.Payload(), p.Signatures); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txx, err := executeProposal(r.Context(), p, policy, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"status": "accepted", "txid": txx.ID, "proposal_id": p.ID})
+}
+
+// executeProposal submits the proposal's transaction. The approvals sign
+// its signature hash and travel with it as its witness, so it is checked
+// exactly as /tx/submit checks it before any input is spent.
+// Once applied its inputs are spent, so the approvals cannot spend again.
+func executeProposal(ctx context.Context, p multisig.Proposal, policy multisig.Policy, ip string) (*tx.Transaction, error) {
+	if err := checkInvoicePayment(ctx, p.ReceiverID, "", p.Note); err != nil {
+		return nil, err
+	}
+	// The receiver was checked, and allowed if unknown, when proposed
+	external, err := checkRecipient(ctx, p.ReceiverID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	txx := p.Transaction()
+	txx.SenderPub = policy.Encode()
+	txx.Signature = multisig.EncodeWitness(p.Signatures)
+	if err := multisig.VerifyTransaction(txx); err != nil {
+		return nil, badTransfer("%v", err)
+	}
+	err = applySignedTransfer(ctx, txx, external, ip, func() error {
+		// Closed under the transfer lock so a proposal is never paid twice
+		if err := dbClient.CloseMultisigProposal(ctx, p.ID, multisig.ProposalExecuted, txx.ID, time.Now()); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return &transferError{status: http.StatusConflict, msg: "proposal is no longer pending"}
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_ = dbClient.InsertLog(ctx, p.WalletID, "multisig_executed",
+		fmt.Sprintf("Proposal %s executed as tx %s with %d signatures", p.ID, txx.ID, len(p.Signatures)), "confirmed", ip)
+	return txx, nil
+}
+
+// multisigCancelHandler withdraws a pending proposal. Any one cosigner can
+// cancel by signing the proposal's cancel payload ("cancel:<id>").
+func multisigCancelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ProposalID string `json:"proposal_id"`
+		CosignerAuth
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, policy, ok := loadProposal(w, r.Context(), req.ProposalID)
+	if !ok {
+		return
+	}
+	sig, err := req.sign(p.CancelPayload())
+	if err == nil {
+		err = policy.VerifyOne(p.CancelPayload(), sig)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := dbClient.CloseMultisigProposal(r.Context(), p.ID, multisig.ProposalCancelled, "", time.Now()); err != nil {
+		http.Error(w, "proposal is not pending", http.StatusConflict)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), p.WalletID, "multisig_cancelled",
+		"Proposal "+p.ID+" cancelled by "+base64.StdEncoding.EncodeToString(sig.PublicKey), "cancelled", r.RemoteAddr)
+
+	writeJSON(w, map[string]interface{}{"status": multisig.ProposalCancelled, "proposal_id": p.ID})
+}
+
+// multisigProposalsHandler returns one proposal with its signatures
+// (proposal_id), or a wallet's proposals, newest first (wallet_id, with
+// optional status and limit)
+func multisigProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if id := q.Get("proposal_id"); id != "" {
+		p, policy, ok := loadProposal(w, r.Context(), id)
+		if !ok {
+			return
+		}
+		writeJSON(w, viewProposal(p, policy))
+		return
+	}
+
+	walletID := q.Get("wallet_id")
+	if walletID == "" {
+		http.Error(w, "missing wallet_id or proposal_id param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
+	status := q.Get("status")
+	switch status {
+	case "", multisig.ProposalPending, multisig.ProposalExecuted, multisig.ProposalCancelled:
+	default:
+		http.Error(w, "status must be pending, executed or cancelled", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"), defaultProposalLimit, maxProposalLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := dbClient.GetMultisigProposals(r.Context(), walletID, status, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch proposals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []multisig.Proposal{}
+	}
+
+	writeJSON(w, map[string]interface{}{"proposals": list})
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/email"
+	"blockchain-wallet/pkg/orders"
+)
+
+const defaultStandingOrderSchedule = "* * * * *" // check for due orders every minute
+
+// payStandingOrder executes one occurrence of a standing order through the
+// same validation and signing path as /tx/sign-and-submit, using the
+// sender's server-held key
+func payStandingOrder(ctx context.Context, o orders.Order) (string, error) {
+	wallet, err := dbClient.GetUserWalletByUserID(ctx, o.UserID)
+	if err != nil {
+		return "", fmt.Errorf("load sender wallet: %w", err)
+	}
+	if wallet.WalletID != o.SenderWalletID {
+		return "", fmt.Errorf("sender wallet no longer belongs to the order's user")
+	}
+
+	priv, err := crypto.DecryptPrivateKey(wallet.PrivateKeyEncrypted)
+	if err != nil {
+		return "", fmt.Errorf("decrypt sender key: %w", err)
+	}
+	auditLog.Record(ctx, audit.Event{Type: audit.KeyAccess, Actor: "system", Subject: wallet.WalletID,
+		Details: "private key decrypted for standing order " + o.ID, IPAddress: "standing-order"})
+	publishSecurity(wallet.WalletID, audit.KeyAccess, "private key used for standing order "+o.ID, "standing-order")
+
+	note := o.Note
+	if note == "" {
+		note = "Standing order " + o.ID
+	}
+	txx, err := signAndSubmitTransfer(ctx, o.SenderWalletID, o.ReceiverWalletID, "", o.Amount, note, nil, false, wallet.PublicKey, priv, "standing-order")
+	if err != nil {
+		return "", err
+	}
+	return txx.ID, nil
+}
+
+// notifyStandingOrderFailure logs a failed standing order and emails its owner
+func notifyStandingOrderFailure(ctx context.Context, o orders.Order, cause error) {
+	msg := fmt.Sprintf("Your scheduled payment of %d coins to %s could not be made: %v", o.Amount, o.ReceiverWalletID, cause)
+	if err := dbClient.InsertLog(ctx, o.SenderWalletID, "standing_order_failed", msg, "failed", "system"); err != nil {
+		log.Printf("Warning: failed to log standing order failure: %v", err)
+	}
+
+	profile, err := dbClient.GetUserByWalletID(ctx, o.SenderWalletID)
+	if err != nil {
+		log.Printf("Warning: cannot notify owner of standing order %s: %v", o.ID, err)
+		return
+	}
+	if err := email.SendNotification(profile.Email, "Scheduled payment failed", msg); err != nil {
+		log.Printf("Warning: failed to email standing order failure: %v", err)
+	}
+}
+
+// firstRunAfter returns the first occurrence of the order's schedule at or after from
+func firstRunAfter(o orders.Order, from time.Time) (time.Time, error) {
+	return orders.NextRun(o.Schedule, from.Add(-time.Second), o.EndDate)
+}
+
+type CreateOrderReq struct {
+	UserID           string     `json:"user_id"` // optional; must be the session's user
+	ReceiverWalletID string     `json:"receiver_wallet_id"`
+	Amount           int64      `json:"amount"`
+	Note             string     `json:"note"`
+	Schedule         string     `json:"schedule"` // cron expression, e.g. "0 9 1 * *"
+	StartAt          *time.Time `json:"start_at"`
+	EndDate          *time.Time `json:"end_date"`
+	AllowUnknown     bool       `json:"allow_unknown"` // pay a receiver that is not a registered wallet
+}
+
+// orderCreateHandler creates a standing order from the session user's
+// wallet, which the session must cover since the order spends from it with
+// the server-held key
+func orderCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.ReceiverWalletID) {
+		return
+	}
+	userID, ok := sessionUser(w, claims, req.UserID)
+	if !ok {
+		return
+	}
+
+	wallet, err := dbClient.GetUserWalletByUserID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "wallet not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !claims.HasWallet(wallet.WalletID) {
+		http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+		return
+	}
+
+	o := orders.Order{
+		UserID:           userID,
+		SenderWalletID:   wallet.WalletID,
+		ReceiverWalletID: req.ReceiverWalletID,
+		Amount:           req.Amount,
+		Note:             req.Note,
+		Schedule:         req.Schedule,
+		EndDate:          req.EndDate,
+		Status:           orders.StatusActive,
+	}
+	if err := orders.Validate(o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	external, err := checkRecipient(r.Context(), o.ReceiverWalletID, req.AllowUnknown)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	from := time.Now()
+	if req.StartAt != nil && req.StartAt.After(from) {
+		from = *req.StartAt
+	}
+	o.NextRunAt, err = firstRunAfter(o, from)
+	if err != nil {
+		http.Error(w, "schedule has no payment before end_date", http.StatusBadRequest)
+		return
+	}
+
+	o.ID, err = dbClient.InsertStandingOrder(r.Context(), o, external)
+	if err != nil {
+		http.Error(w, "failed to create standing order: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), o.SenderWalletID, "standing_order_created",
+		fmt.Sprintf("Standing order %s: %d to %s (%s)", o.ID, o.Amount, o.ReceiverWalletID, o.Schedule), "success", r.RemoteAddr)
+
+	writeJSON(w, o)
+}
+
+// orderListHandler lists the session user's standing orders
+func orderListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := sessionUser(w, claims, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+
+	list, err := dbClient.GetStandingOrders(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "failed to fetch standing orders: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"user_id": userID,
+		"orders":  list,
+	})
+}
+
+// orderRunsHandler returns the execution history of one of the session
+// user's standing orders
+func orderRunsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	userID, ok := sessionUser(w, claims, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+	orderID := r.URL.Query().Get("order_id")
+	if orderID == "" {
+		http.Error(w, "order_id required", http.StatusBadRequest)
+		return
+	}
+
+	// Ownership check
+	if _, err := dbClient.GetStandingOrder(r.Context(), orderID, userID); err != nil {
+		http.Error(w, "standing order not found", http.StatusNotFound)
+		return
+	}
+
+	runs, err := dbClient.GetStandingOrderRuns(r.Context(), orderID, 100)
+	if err != nil {
+		http.Error(w, "failed to fetch runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"order_id": orderID,
+		"runs":     runs,
+	})
+}
+
+type UpdateOrderReq struct {
+	UserID           string     `json:"user_id"` // optional; must be the session's user
+	OrderID          string     `json:"order_id"`
+	ReceiverWalletID *string    `json:"receiver_wallet_id"`
+	Amount           *int64     `json:"amount"`
+	Note             *string    `json:"note"`
+	Schedule         *string    `json:"schedule"`
+	EndDate          *time.Time `json:"end_date"`
+	AllowUnknown     bool       `json:"allow_unknown"` // pay a new receiver that is not a registered wallet
+}
+
+// orderUpdateHandler edits the recipient, amount, note, schedule or end date
+// of one of the session user's orders
+func orderUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := sessionUser(w, claims, req.UserID)
+	if !ok {
+		return
+	}
+
+	o, ok := loadOrder(w, r, req.OrderID, userID)
+	if !ok {
+		return
+	}
+
+	rescheduled, newReceiver := false, false
+	if req.ReceiverWalletID != nil {
+		if !normalizeAddresses(w, req.ReceiverWalletID) {
+			return
+		}
+		newReceiver = *req.ReceiverWalletID != o.ReceiverWalletID
+		o.ReceiverWalletID = *req.ReceiverWalletID
+	}
+	if req.Amount != nil {
+		o.Amount = *req.Amount
+	}
+	if req.Note != nil {
+		o.Note = *req.Note
+	}
+	if req.Schedule != nil {
+		o.Schedule = *req.Schedule
+		rescheduled = true
+	}
+	if req.EndDate != nil {
+		o.EndDate = req.EndDate
+		rescheduled = true
+	}
+	if err := orders.Validate(o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	external := false
+	if newReceiver {
+		var err error
+		if external, err = checkRecipient(r.Context(), o.ReceiverWalletID, req.AllowUnknown); err != nil {
+			writeTransferError(w, err)
+			return
+		}
+	}
+
+	if rescheduled && o.Status == orders.StatusActive {
+		next, err := firstRunAfter(o, time.Now())
+		if err != nil {
+			http.Error(w, "schedule has no payment before end_date", http.StatusBadRequest)
+			return
+		}
+		o.NextRunAt = next
+	}
+
+	saveOrder(w, r, o, external, "standing_order_updated")
+}
+
+type OrderActionReq struct {
+	UserID  string `json:"user_id"` // optional; must be the session's user
+	OrderID string `json:"order_id"`
+}
+
+// orderPauseHandler suspends an active order
+func orderPauseHandler(w http.ResponseWriter, r *http.Request) {
+	changeOrderStatus(w, r, func(o *orders.Order) error {
+		if o.Status != orders.StatusActive {
+			return fmt.Errorf("only active orders can be paused")
+		}
+		o.Status = orders.StatusPaused
+		return nil
+	}, "standing_order_paused")
+}
+
+// orderResumeHandler reactivates a paused order from its next occurrence
+func orderResumeHandler(w http.ResponseWriter, r *http.Request) {
+	changeOrderStatus(w, r, func(o *orders.Order) error {
+		if o.Status != orders.StatusPaused {
+			return fmt.Errorf("only paused orders can be resumed")
+		}
+		next, err := firstRunAfter(*o, time.Now())
+		if err != nil {
+			return fmt.Errorf("order has no payment left before its end_date")
+		}
+		o.NextRunAt = next
+		o.Status = orders.StatusActive
+		return nil
+	}, "standing_order_resumed")
+}
+
+// orderCancelHandler permanently stops an order
+func orderCancelHandler(w http.ResponseWriter, r *http.Request) {
+	changeOrderStatus(w, r, func(o *orders.Order) error {
+		if o.Status == orders.StatusCancelled || o.Status == orders.StatusCompleted {
+			return fmt.Errorf("order is already %s", o.Status)
+		}
+		o.Status = orders.StatusCancelled
+		return nil
+	}, "standing_order_cancelled")
+}
+
+func changeOrderStatus(w http.ResponseWriter, r *http.Request, apply func(o *orders.Order) error, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req OrderActionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userID, ok := sessionUser(w, claims, req.UserID)
+	if !ok {
+		return
+	}
+
+	o, ok := loadOrder(w, r, req.OrderID, userID)
+	if !ok {
+		return
+	}
+	if err := apply(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	saveOrder(w, r, o, false, action)
+}
+
+// loadOrder fetches an order owned by userID, writing the error response on failure
+func loadOrder(w http.ResponseWriter, r *http.Request, orderID, userID string) (orders.Order, bool) {
+	if orderID == "" {
+		http.Error(w, "order_id required", http.StatusBadRequest)
+		return orders.Order{}, false
+	}
+	o, err := dbClient.GetStandingOrder(r.Context(), orderID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "standing order not found", http.StatusNotFound)
+		return o, false
+	}
+	if err != nil {
+		http.Error(w, "failed to load standing order: "+err.Error(), http.StatusInternalServerError)
+		return o, false
+	}
+	if o.Status == orders.StatusCancelled || o.Status == orders.StatusCompleted {
+		http.Error(w, "standing order is "+o.Status, http.StatusConflict)
+		return o, false
+	}
+	return o, true
+}
+
+func saveOrder(w http.ResponseWriter, r *http.Request, o orders.Order, external bool, action string) {
+	if err := dbClient.UpdateStandingOrder(r.Context(), o, external); err != nil {
+		http.Error(w, "failed to update standing order: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_ = dbClient.InsertLog(r.Context(), o.SenderWalletID, action, "Standing order "+o.ID, "success", r.RemoteAddr)
+	writeJSON(w, o)
+}
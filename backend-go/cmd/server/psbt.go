@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/psbt"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+type BuildTxReq struct {
+	SenderID   string     `json:"sender_id"`
+	ReceiverID string     `json:"receiver_id"`
+	Amount     int64      `json:"amount"`
+	Asset      string     `json:"asset"`
+	Note       string     `json:"note"`
+	Lock       *utxo.Lock `json:"lock"`
+}
+
+// txBuildHandler builds an unsigned packet for a transfer without touching
+// any keys, so a watch-only server can prepare it for offline signers. The
+// inputs are not reserved: if they are spent before the signed packet comes
+// back to /tx/submit, it is rejected and must be built again.
+func txBuildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BuildTxReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.SenderID, &req.ReceiverID) {
+		return
+	}
+	if req.SenderID == "" || req.ReceiverID == "" || req.Amount <= 0 {
+		http.Error(w, "sender_id, receiver_id and a positive amount are required", http.StatusBadRequest)
+		return
+	}
+	if err := checkTransferLock(req.Lock); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkInvoicePayment(r.Context(), req.ReceiverID, req.Asset, req.Note); err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	// a multisig sender's packet carries its policy so cosigners can check
+	// that they are signing for the right wallet
+	var policy *multisig.Policy
+	if multisig.IsAddress(req.SenderID) {
+		if dbClient == nil {
+			http.Error(w, "multisig senders require a database", http.StatusServiceUnavailable)
+			return
+		}
+		mw, err := dbClient.GetMultisigWallet(r.Context(), req.SenderID)
+		if err != nil {
+			http.Error(w, "multisig wallet not found", http.StatusNotFound)
+			return
+		}
+		policy = &mw.Policy
+	}
+
+	inputs, _, err := selectInputs(r.Context(), req.SenderID, req.Asset, req.Amount)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	ids := make([]string, len(inputs))
+	for i, u := range inputs {
+		ids[i] = u.ID
+	}
+	txx := tx.NewTransaction(req.SenderID, req.ReceiverID, req.Amount, req.Note, ids)
+	txx.Lock = req.Lock
+	txx.Asset = req.Asset
+	txx.ID = txx.ComputeID()
+
+	p, err := psbt.New(txx, inputs, policy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.Meta = map[string]string{
+		"built_at":     strconv.FormatInt(time.Now().Unix(), 10),
+		"chain_height": strconv.FormatInt(chainHeight(), 10),
+	}
+	encoded, err := p.Encode()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"psbt":     p,
+		"encoded":  encoded,
+		"required": p.Required(),
+	})
+}
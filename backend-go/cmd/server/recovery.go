@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/email"
+	"blockchain-wallet/pkg/keystore"
+	"blockchain-wallet/pkg/recovery"
+)
+
+// defaultRecoverySchedule is how often lapsed recovery requests are closed
+const defaultRecoverySchedule = "@hourly"
+
+type RecoverySetupReq struct {
+	WalletID  string              `json:"wallet_id"`
+	Threshold int                 `json:"threshold"`
+	Shares    int                 `json:"shares"` // defaults to one per guardian
+	Guardians []recovery.Guardian `json:"guardians"`
+}
+
+// recoveryShareView is one share of a new setup. The share text is only
+// returned when it was not emailed to a guardian, for the owner to print
+// or pass on.
+type recoveryShareView struct {
+	Index    int    `json:"index"`
+	Guardian string `json:"guardian,omitempty"`
+	Emailed  bool   `json:"emailed"`
+	Share    string `json:"share,omitempty"`
+}
+
+// recoveryRequestView adds the state as of now and whether the request
+// has enough shares
+type recoveryRequestView struct {
+	recovery.Request
+	State string `json:"state"`
+	Ready bool   `json:"ready"`
+}
+
+func viewRecoveryRequest(req recovery.Request) recoveryRequestView {
+	return recoveryRequestView{Request: req, State: req.State(time.Now()), Ready: req.Ready()}
+}
+
+// recoverySetupHandler splits the seed of one of the caller's wallets into
+// Shamir shares (POST), or shows the active split without its shares (GET).
+// Guardians with an email address are sent their share; the rest are
+// returned once, in the response, to be printed. A new split replaces the
+// old one, whose shares stop working.
+func recoverySetupHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		walletID := r.URL.Query().Get("wallet_id")
+		if !normalizeAddresses(w, &walletID) {
+			return
+		}
+		if walletID == "" && len(claims.Wallets) > 0 {
+			walletID = claims.Wallets[0]
+		}
+		if !claims.HasWallet(walletID) {
+			http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+			return
+		}
+		s, err := dbClient.GetRecoverySetup(r.Context(), walletID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "wallet has no recovery setup", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, s)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RecoverySetupReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.WalletID) {
+		return
+	}
+	if req.WalletID == "" && len(claims.Wallets) > 0 {
+		req.WalletID = claims.Wallets[0]
+	}
+	if !claims.HasWallet(req.WalletID) {
+		http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+		return
+	}
+	if req.Shares == 0 {
+		req.Shares = len(req.Guardians)
+	}
+	for i := range req.Guardians {
+		req.Guardians[i].Index = i + 1
+	}
+	setup := recovery.Setup{WalletID: req.WalletID, Threshold: req.Threshold, Shares: req.Shares,
+		Guardians: req.Guardians, CreatedAt: time.Now().UTC()}
+	if err := setup.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wallet, err := dbClient.GetWalletByID(r.Context(), req.WalletID)
+	if err != nil {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+	priv, err := crypto.DecryptPrivateKey(wallet.PrivateKeyEncrypted)
+	if err != nil {
+		log.Printf("Error decrypting private key for wallet %s: %v", wallet.WalletID, err)
+		http.Error(w, "failed to decrypt wallet key", http.StatusInternalServerError)
+		return
+	}
+	shares, err := crypto.SplitSecret(ed25519.PrivateKey(priv).Seed(), setup.Shares, setup.Threshold)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setup.SetID = shares[0].Set
+	if err := dbClient.InsertRecoverySetup(r.Context(), setup); err != nil {
+		http.Error(w, "failed to store recovery setup: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]recoveryShareView, len(shares))
+	emailed := 0
+	for i, s := range shares {
+		views[i] = recoveryShareView{Index: s.Index, Share: s.String()}
+		if i >= len(setup.Guardians) {
+			continue
+		}
+		g := setup.Guardians[i]
+		views[i].Guardian = g.Name
+		if g.Email == "" {
+			continue
+		}
+		msg := fmt.Sprintf("You have been chosen as a recovery guardian for wallet %s. Keep this share safe "+
+			"and only hand it over if the owner asks you to help recover their wallet. "+
+			"%d of %d shares are needed. Share %d: %s",
+			setup.WalletID, setup.Threshold, setup.Shares, s.Index, s.String())
+		if err := email.SendNotification(g.Email, "Wallet recovery share", msg); err != nil {
+			log.Printf("Warning: failed to email recovery share %d of wallet %s: %v", s.Index, setup.WalletID, err)
+			continue
+		}
+		views[i].Emailed, views[i].Share = true, ""
+		emailed++
+	}
+
+	details := fmt.Sprintf("seed split into %d shares, %d needed to recover; %d emailed to guardians",
+		setup.Shares, setup.Threshold, emailed)
+	recordAudit(r, audit.KeyRecovery, claims.UserID, setup.WalletID, details)
+	_ = dbClient.InsertLog(r.Context(), setup.WalletID, "recovery_setup", details, "success", r.RemoteAddr)
+	publishSecurity(setup.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+	writeJSON(w, map[string]interface{}{"setup": setup, "shares": views})
+}
+
+// recoveryStartHandler opens a request to recover a wallet that has a
+// recovery setup. No session is needed, since the owner may have lost
+// access; the request is worthless without enough shares. The response
+// carries a secret, shown only this once, that completing the request
+// needs, so whoever learns the request ID cannot finish it. The owner is
+// told of every request.
+func recoveryStartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		WalletID string `json:"wallet_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &body.WalletID) {
+		return
+	}
+	ctx := r.Context()
+	setup, err := dbClient.GetRecoverySetup(ctx, body.WalletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "wallet has no recovery setup", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req := recovery.Request{WalletID: setup.WalletID, SetID: setup.SetID, Threshold: setup.Threshold,
+		Status: recovery.StatusOpen, Collected: []int{}, CreatedAt: time.Now().UTC()}
+	req.ExpiresAt = req.CreatedAt.Add(recovery.RequestLifetime)
+	secret, hash, err := recovery.NewSecret()
+	if err != nil {
+		http.Error(w, "failed to make request secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.SecretHash = hash
+	if req.ID, err = dbClient.InsertRecoveryRequest(ctx, req, r.RemoteAddr); err != nil {
+		http.Error(w, "failed to open recovery request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details := "recovery request " + req.ID + " opened"
+	recordAudit(r, audit.KeyRecovery, setup.WalletID, setup.WalletID, details)
+	_ = dbClient.InsertLog(ctx, setup.WalletID, "recovery_started", details, "pending", r.RemoteAddr)
+	publishSecurity(setup.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+	notifyRecovery(setup.WalletID, "Wallet recovery started",
+		fmt.Sprintf("A request to recover wallet %s was opened from %s. If this was not you, make a new recovery setup to cancel it.",
+			setup.WalletID, r.RemoteAddr))
+
+	// Guardian names tell the owner whom to ask; their emails stay private
+	guardians := make([]recovery.Guardian, len(setup.Guardians))
+	for i, g := range setup.Guardians {
+		guardians[i] = recovery.Guardian{Index: g.Index, Name: g.Name}
+	}
+	writeJSON(w, map[string]interface{}{
+		"request":   viewRecoveryRequest(req),
+		"secret":    secret,
+		"guardians": guardians,
+	})
+}
+
+// recoveryRequestHandler shows how far a recovery request has got
+func recoveryRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, ok := loadRecoveryRequest(w, r, r.URL.Query().Get("request_id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, viewRecoveryRequest(req))
+}
+
+// recoveryShareHandler adds one share to an open recovery request. Shares
+// are checked against the wallet's active setup and held sealed with the
+// master key until the request is closed.
+func recoveryShareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		RequestID string `json:"request_id"`
+		Share     string `json:"share"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, ok := loadOpenRecoveryRequest(w, r, body.RequestID)
+	if !ok {
+		return
+	}
+	share, err := crypto.ParseShare(body.Share)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if share.Set != req.SetID || share.Threshold != req.Threshold {
+		recordAudit(r, audit.KeyRecovery, req.WalletID, req.WalletID,
+			fmt.Sprintf("recovery request %s: share from another setup refused", req.ID))
+		http.Error(w, "share does not belong to this wallet's recovery setup", http.StatusBadRequest)
+		return
+	}
+	if req.Has(share.Index) {
+		http.Error(w, fmt.Sprintf("share %d was already submitted", share.Index), http.StatusConflict)
+		return
+	}
+	enc, err := crypto.EncryptPrivateKey([]byte(share.String()))
+	if err != nil {
+		http.Error(w, "failed to seal share: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := dbClient.AddRecoveryShare(r.Context(), req.ID, share.Index, enc); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "request is closed or already has this share", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Collected = append(req.Collected, share.Index)
+
+	details := fmt.Sprintf("recovery request %s: share %d received (%d of %d)",
+		req.ID, share.Index, len(req.Collected), req.Threshold)
+	recordAudit(r, audit.KeyRecovery, req.WalletID, req.WalletID, details)
+	publishSecurity(req.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+	writeJSON(w, viewRecoveryRequest(req))
+}
+
+// recoveryCompleteHandler rebuilds the wallet key from the collected shares.
+// It needs the secret returned when the request was opened. The key must
+// match the wallet's public key; it is then sealed again on the server, the
+// account password is replaced, and the key is returned as a keystore file
+// under the new password. Shares that rebuild the wrong key fail the
+// request, so a new one must be started.
+func recoveryCompleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		RequestID   string `json:"request_id"`
+		Secret      string `json:"secret"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := crypto.ValidatePassword(body.NewPassword); err != nil {
+		http.Error(w, "invalid password: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, ok := loadOpenRecoveryRequest(w, r, body.RequestID)
+	if !ok {
+		return
+	}
+	if !req.CheckSecret(body.Secret) {
+		details := fmt.Sprintf("recovery request %s: completion with a wrong secret refused", req.ID)
+		recordAudit(r, audit.KeyRecovery, req.WalletID, req.WalletID, details)
+		publishSecurity(req.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+		http.Error(w, "secret does not match this recovery request", http.StatusForbidden)
+		return
+	}
+	if !req.Ready() {
+		http.Error(w, fmt.Sprintf("need %d shares, have %d", req.Threshold, len(req.Collected)), http.StatusConflict)
+		return
+	}
+
+	ctx := r.Context()
+	wallet, err := dbClient.GetWalletByID(ctx, req.WalletID)
+	if err != nil {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+	priv, err := rebuildRecoveredKey(r, req)
+	if err != nil {
+		log.Printf("Recovery request %s failed: %v", req.ID, err)
+		_ = dbClient.CloseRecoveryRequest(ctx, req.ID, recovery.StatusFailed, time.Now().UTC())
+		details := fmt.Sprintf("recovery request %s failed: %v", req.ID, err)
+		recordAudit(r, audit.KeyRecovery, req.WalletID, req.WalletID, details)
+		_ = dbClient.InsertLog(ctx, req.WalletID, "recovery_failed", details, "failed", r.RemoteAddr)
+		publishSecurity(req.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+		http.Error(w, "shares do not rebuild this wallet's key; start a new request", http.StatusBadRequest)
+		return
+	}
+	if !bytes.Equal(priv.Public().(ed25519.PublicKey), wallet.PublicKey) {
+		http.Error(w, "recovered key does not match the stored wallet", http.StatusConflict)
+		return
+	}
+	profile, err := dbClient.GetUserByWalletID(ctx, req.WalletID)
+	if err != nil {
+		http.Error(w, "wallet has no account to recover", http.StatusNotFound)
+		return
+	}
+	enc, err := crypto.EncryptPrivateKey(priv)
+	if err != nil {
+		http.Error(w, "failed to encrypt private key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	k, err := keystore.Encrypt(priv, body.NewPassword, "", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Closing first means two concurrent completions cannot both succeed
+	if err := dbClient.CloseRecoveryRequest(ctx, req.ID, recovery.StatusCompleted, time.Now().UTC()); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "request is no longer open", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := dbClient.UpdateWalletKey(ctx, req.WalletID, enc); err != nil {
+		http.Error(w, "failed to store wallet key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := dbClient.UpdateUserPassword(ctx, profile.UserID, crypto.HashPassword(body.NewPassword)); err != nil {
+		http.Error(w, "failed to set password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	details := fmt.Sprintf("recovery request %s completed: key rebuilt from %d shares and password replaced",
+		req.ID, len(req.Collected))
+	recordAudit(r, audit.KeyRecovery, req.WalletID, req.WalletID, details)
+	_ = dbClient.InsertLog(ctx, req.WalletID, "recovery_completed", "Wallet recovered from guardian shares", "success", r.RemoteAddr)
+	publishSecurity(req.WalletID, audit.KeyRecovery, details, r.RemoteAddr)
+	notifyRecovery(req.WalletID, "Wallet recovered",
+		fmt.Sprintf("Wallet %s was recovered from guardian shares and its password was changed.", req.WalletID))
+	writeJSON(w, map[string]interface{}{
+		"wallet_id": req.WalletID,
+		"keystore":  k,
+	})
+}
+
+// rebuildRecoveredKey combines the shares of a request into the wallet's
+// key and checks that it belongs to the wallet
+func rebuildRecoveredKey(r *http.Request, req recovery.Request) (ed25519.PrivateKey, error) {
+	sealed, err := dbClient.GetRecoveryShares(r.Context(), req.ID)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]crypto.Share, 0, len(sealed))
+	for _, enc := range sealed {
+		text, err := crypto.DecryptPrivateKey(enc)
+		if err != nil {
+			return nil, fmt.Errorf("open share: %w", err)
+		}
+		s, err := crypto.ParseShare(string(text))
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	seed, err := crypto.CombineShares(shares)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("rebuilt secret is not a key seed")
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	if crypto.WalletIDFromPub(priv.Public().(ed25519.PublicKey)) != req.WalletID {
+		return nil, errors.New("rebuilt key belongs to another wallet")
+	}
+	return priv, nil
+}
+
+// loadRecoveryRequest fetches a request, writing 400 or 404 on failure
+func loadRecoveryRequest(w http.ResponseWriter, r *http.Request, id string) (recovery.Request, bool) {
+	if id == "" {
+		http.Error(w, "missing request_id", http.StatusBadRequest)
+		return recovery.Request{}, false
+	}
+	req, err := dbClient.GetRecoveryRequest(r.Context(), id)
+	if err != nil {
+		http.Error(w, "recovery request not found", http.StatusNotFound)
+		return req, false
+	}
+	return req, true
+}
+
+// loadOpenRecoveryRequest is loadRecoveryRequest for requests that must
+// still be collecting shares, writing 409 otherwise
+func loadOpenRecoveryRequest(w http.ResponseWriter, r *http.Request, id string) (recovery.Request, bool) {
+	req, ok := loadRecoveryRequest(w, r, id)
+	if !ok {
+		return req, false
+	}
+	if state := req.State(time.Now()); state != recovery.StatusOpen {
+		http.Error(w, "recovery request is "+state, http.StatusConflict)
+		return req, false
+	}
+	return req, true
+}
+
+// notifyRecovery emails the wallet's owner about a recovery step
+func notifyRecovery(walletID, subject, msg string) {
+	profile, err := dbClient.GetUserByWalletID(context.Background(), walletID)
+	if err != nil {
+		log.Printf("Warning: cannot notify owner of wallet %s: %v", walletID, err)
+		return
+	}
+	if err := email.SendNotification(profile.Email, subject, msg); err != nil {
+		log.Printf("Warning: failed to email recovery notice: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"blockchain-wallet/pkg/report"
+)
+
+var statementSigner *report.Signer
+
+// loadStatementSigner sets up the key that signs account statements. It is
+// read from STATEMENT_SIGNING_KEY (a base64 32-byte seed) or derived from
+// MASTER_KEY; without either, a throwaway key is used for this process only.
+func loadStatementSigner() (*report.Signer, error) {
+	if v := os.Getenv("STATEMENT_SIGNING_KEY"); v != "" {
+		seed, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("STATEMENT_SIGNING_KEY: %w", err)
+		}
+		return report.NewSigner(seed)
+	}
+	if v := os.Getenv("MASTER_KEY"); v != "" {
+		seed := sha256.Sum256([]byte("statement-signing:" + v))
+		return report.NewSigner(seed[:])
+	}
+
+	log.Println("⚠️  No STATEMENT_SIGNING_KEY or MASTER_KEY; statements are signed with a temporary key")
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return report.NewSigner(seed)
+}
+
+// statementHandler builds a signed statement of a wallet for a period.
+//
+// Query parameters: wallet (required), from and to (RFC 3339 or YYYY-MM-DD;
+// from defaults to the beginning, to to now) and format (json|csv|pdf).
+func statementHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || dbClient == nil {
+		http.Error(w, "method not allowed or DB unavailable", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	walletID := q.Get("wallet")
+	if walletID == "" {
+		http.Error(w, "missing wallet param", http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &walletID) {
+		return
+	}
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = report.FormatJSON
+	case report.FormatJSON, report.FormatCSV, report.FormatPDF:
+	default:
+		http.Error(w, "format must be json, csv or pdf", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from, err := parseHistoryTime(q.Get("from"), false)
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseHistoryTime(q.Get("to"), true)
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from == nil {
+		from = &time.Time{}
+	}
+	if to == nil {
+		to = &now
+	}
+
+	if _, err := dbClient.GetWalletByID(r.Context(), walletID); err != nil {
+		http.Error(w, "wallet not found", http.StatusNotFound)
+		return
+	}
+
+	st, err := report.Build(r.Context(), dbClient, walletID, *from, *to, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	signed, err := statementSigner.Sign(st)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", report.ContentType(format))
+	if format != report.FormatJSON || q.Get("download") == "true" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+report.Filename(st, format)+`"`)
+	}
+	if err := report.Write(w, signed, format); err != nil {
+		log.Printf("Warning: failed to write statement: %v", err)
+	}
+}
+
+// statementVerifyHandler checks a JSON statement export against the server key
+func statementVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var signed report.Signed
+	if err := json.NewDecoder(r.Body).Decode(&signed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := report.Verify(&signed, statementSigner.PublicKey())
+	if err != nil && !errors.Is(err, report.ErrBadSignature) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := map[string]interface{}{"valid": err == nil}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	writeJSON(w, resp)
+}
+
+// statementKeyHandler publishes the key that verifies statements offline
+func statementKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"algorithm":  report.SignatureAlgorithm,
+		"public_key": base64.StdEncoding.EncodeToString(statementSigner.PublicKey()),
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/db"
+	"blockchain-wallet/pkg/script"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+type CompileScriptReq struct {
+	Asm string `json:"asm"` // e.g. "OP_DUP OP_SHA256 <hash> OP_EQUALVERIFY OP_CHECKSIG"
+}
+
+// scriptCompileHandler assembles a script from its text form, returning
+// the hex to use in a script lock or unlocking script
+func scriptCompileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CompileScriptReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := script.Parse(req.Asm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"script":    s,
+		"asm":       s.String(),
+		"size":      len(s),
+		"push_only": s.IsPushOnly(),
+	})
+}
+
+type ScriptInput struct {
+	UTXOID       string        `json:"utxo_id"`
+	UnlockScript script.Script `json:"unlock_script"` // hex
+}
+
+type SpendScriptReq struct {
+	SenderID   string        `json:"sender_id"` // owner of the inputs
+	ReceiverID string        `json:"receiver_id"`
+	Note       string        `json:"note"`
+	Timestamp  int64         `json:"timestamp"`
+	Inputs     []ScriptInput `json:"inputs"`
+	Lock       *utxo.Lock    `json:"lock"` // optional time or script lock on the receiver's output
+
+	AllowUnknown bool `json:"allow_unknown"` // send to a wallet the directory does not list
+}
+
+// transaction builds the transaction spending the inputs in full, and
+// reports whether its receiver is an external wallet (see checkRecipient).
+// Its SigHash is what CHECKSIG verifies against, so every field here is
+// committed to by the unlocking scripts' signatures.
+func (req *SpendScriptReq) transaction(ctx context.Context) (*tx.Transaction, []*utxo.UTXO, bool, error) {
+	if req.SenderID == "" || req.ReceiverID == "" || req.Timestamp == 0 || len(req.Inputs) == 0 {
+		return nil, nil, false, badTransfer("sender_id, receiver_id, timestamp and inputs required")
+	}
+	if err := checkTransferLock(req.Lock); err != nil {
+		return nil, nil, false, badTransfer("%v", err)
+	}
+	external, err := checkRecipient(ctx, req.ReceiverID, req.AllowUnknown)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	ids := make([]string, len(req.Inputs))
+	inputs := make([]*utxo.UTXO, len(req.Inputs))
+	seen := make(map[string]bool, len(req.Inputs))
+	var amount int64
+	for i, in := range req.Inputs {
+		if seen[in.UTXOID] {
+			return nil, nil, false, badTransfer("input %s listed twice", in.UTXOID)
+		}
+		seen[in.UTXOID] = true
+		rec, err := dbClient.GetUTXOByID(ctx, in.UTXOID)
+		if err != nil {
+			return nil, nil, false, &transferError{status: http.StatusNotFound, msg: "utxo not found: " + in.UTXOID}
+		}
+		if rec.Spent {
+			return nil, nil, false, &transferError{status: http.StatusConflict, msg: "utxo already spent: " + in.UTXOID}
+		}
+		ids[i] = rec.UTXOID
+		inputs[i] = &utxo.UTXO{ID: rec.UTXOID, Owner: rec.Owner, Amount: rec.Amount, Spent: rec.Spent, Lock: rec.Lock, Asset: rec.Asset}
+		if rec.Asset != inputs[0].Asset {
+			return nil, nil, false, badTransfer("inputs hold different assets")
+		}
+		amount += rec.Amount
+	}
+
+	// The whole amount goes to the receiver, in the asset the inputs hold
+	txx := tx.NewTransaction(req.SenderID, req.ReceiverID, amount, req.Note, ids)
+	txx.Timestamp = req.Timestamp
+	txx.Lock = req.Lock
+	txx.Asset = inputs[0].Asset
+	txx.ID = txx.ComputeID()
+	return txx, inputs, external, nil
+}
+
+// scriptSighashHandler returns the transaction ID and the hash unlocking
+// scripts must sign for a script spend, without submitting it
+func scriptSighashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SpendScriptReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.SenderID, &req.ReceiverID) {
+		return
+	}
+	txx, _, _, err := req.transaction(r.Context())
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"txid":    txx.ID,
+		"sighash": hex.EncodeToString(txx.SigHash()),
+		"amount":  txx.Amount,
+	})
+}
+
+// txSpendScriptHandler spends script-locked outputs in full to a receiver.
+// Each input carries an unlocking script that must satisfy the output's
+// locking script at the current height and time.
+func txSpendScriptHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SpendScriptReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !normalizeAddresses(w, &req.SenderID, &req.ReceiverID) {
+		return
+	}
+
+	txx, err := spendScript(r.Context(), &req, r.RemoteAddr)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"status": "ok",
+		"txid":   txx.ID,
+		"amount": txx.Amount,
+	})
+}
+
+// spendScript verifies the unlocking scripts and records the spend
+func spendScript(ctx context.Context, req *SpendScriptReq, ip string) (*tx.Transaction, error) {
+	transferMu.Lock()
+	defer transferMu.Unlock()
+
+	txx, inputs, external, err := req.transaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlocks := make([]script.Script, len(req.Inputs))
+	for i, in := range req.Inputs {
+		unlocks[i] = in.UnlockScript
+	}
+	if err := tx.VerifyScriptSpend(txx, inputs, unlocks, chainHeight(), time.Now().Unix()); err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, script.ErrEvalFalse) && !errors.Is(err, script.ErrVerify) &&
+			!errors.Is(err, script.ErrLocktimeNotReached) {
+			status = http.StatusBadRequest
+		}
+		return nil, &transferError{status: status, msg: err.Error()}
+	}
+	// The unlocking scripts are the authorisation
+	txx.Signature = tx.EncodeUnlockScripts(unlocks)
+
+	t := db.Transfer{Outputs: txx.Outputs(txx.Amount), InputLock: utxo.LockScript, RegisterReceiver: external}
+	if err := recordTransfer(ctx, txx, t, ip); err != nil {
+		return nil, err
+	}
+	_ = dbClient.InsertLog(ctx, txx.SenderID, "script_spend",
+		fmt.Sprintf("Spent %d script-locked outputs: %d to %s", len(inputs), txx.Amount, txx.ReceiverID), "confirmed", ip)
+
+	recordHTLCSpends(ctx, txx, inputs, unlocks)
+
+	bc.AddPendingTransaction(txx.ID)
+	publishTransfer(ctx, txx)
+	return txx, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/session"
+)
+
+const defaultSessionTTL = 12 * time.Hour
+
+var sessions *session.Manager
+
+// loadSessionManager sets up the key that signs session tokens. It is read
+// from SESSION_SECRET (base64, at least 32 bytes) or derived from
+// MASTER_KEY; without either, sessions only last as long as this process.
+// SESSION_TTL overrides how long a token stays valid.
+func loadSessionManager() (*session.Manager, error) {
+	ttl := defaultSessionTTL
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("SESSION_TTL: %w", err)
+		}
+		ttl = d
+	}
+
+	if v := os.Getenv("SESSION_SECRET"); v != "" {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("SESSION_SECRET: %w", err)
+		}
+		return session.NewManager(key, ttl)
+	}
+	if v := os.Getenv("MASTER_KEY"); v != "" {
+		key := sha256.Sum256([]byte("session:" + v))
+		return session.NewManager(key[:], ttl)
+	}
+
+	log.Println("⚠️  No SESSION_SECRET or MASTER_KEY; sessions end when the server restarts")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return session.NewManager(key, ttl)
+}
+
+// requestSession returns the session of the caller, taken from an
+// "Authorization: Bearer" header or, for browser EventSource and WebSocket
+// clients that cannot set headers, the token query parameter
+func requestSession(r *http.Request) (*session.Claims, error) {
+	token := r.URL.Query().Get("token")
+	if h := r.Header.Get("Authorization"); h != "" {
+		var ok bool
+		if token, ok = strings.CutPrefix(h, "Bearer "); !ok {
+			return nil, session.ErrInvalidToken
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("session token required")
+	}
+	return sessions.Verify(token)
+}
+
+// requireSession returns the caller's session, writing 401 if there is none
+func requireSession(w http.ResponseWriter, r *http.Request) (*session.Claims, bool) {
+	claims, err := requestSession(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// isAdminEmail reports whether email is one of the operators listed in
+// ADMIN_EMAILS (comma-separated), whose sessions are admin sessions
+func isAdminEmail(email string) bool {
+	for _, e := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if e = strings.TrimSpace(e); e != "" && strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin returns the caller's session, writing 401 if there is none
+// and 403 if it is not an admin session
+func requireAdmin(w http.ResponseWriter, r *http.Request) (*session.Claims, bool) {
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !claims.Admin {
+		http.Error(w, "admin session required", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
+
+// sessionUser is the user a request acts for: the session's. A user_id sent
+// by older clients must name the same user.
+func sessionUser(w http.ResponseWriter, claims *session.Claims, userID string) (string, bool) {
+	if userID != "" && userID != claims.UserID {
+		http.Error(w, "user_id does not match the session", http.StatusForbidden)
+		return "", false
+	}
+	return claims.UserID, true
+}
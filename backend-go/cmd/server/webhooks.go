@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/webhook"
+)
+
+const (
+	defaultWebhookSchedule = "* * * * *" // retries are picked up every minute
+	defaultDeliveryLimit   = 50
+	maxDeliveryLimit       = 500
+)
+
+// webhookDispatcher is nil without a database
+var webhookDispatcher *webhook.Dispatcher
+
+// newWebhookDispatcher builds the dispatcher over the database outbox
+func newWebhookDispatcher() *webhook.Dispatcher {
+	return webhook.NewDispatcher(dbClient, webhook.DefaultConfig(), jobs.SystemClock)
+}
+
+// notifyWebhooks queues an event for the wallet's endpoints and starts
+// sending it. Failures are logged; the payment itself has already happened.
+func notifyWebhooks(ctx context.Context, walletID, eventType, subject string, data interface{}) {
+	if webhookDispatcher == nil {
+		return
+	}
+	n, err := webhookDispatcher.Enqueue(ctx, walletID, eventType, subject, data)
+	if err != nil {
+		log.Printf("Warning: failed to queue %s webhook for %s: %v", eventType, walletID, err)
+		return
+	}
+	if n > 0 {
+		webhookDispatcher.Kick()
+	}
+}
+
+type CreateWebhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// webhookCreateHandler registers an endpoint for the wallet of the
+// session's user. The signing secret is only ever returned here.
+func webhookCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateWebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = webhook.EventTypes()
+	}
+
+	wallet, err := dbClient.GetUserWalletByUserID(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "wallet not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !claims.HasWallet(wallet.WalletID) {
+		http.Error(w, "session does not cover this wallet", http.StatusForbidden)
+		return
+	}
+
+	e := webhook.Endpoint{
+		UserID:   claims.UserID,
+		WalletID: wallet.WalletID,
+		URL:      req.URL,
+		Events:   req.Events,
+		Active:   true,
+	}
+	if err := webhook.ValidateEndpoint(e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if e.Secret, err = webhook.NewSecret(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e.ID, err = dbClient.InsertWebhookEndpoint(r.Context(), e)
+	if err != nil {
+		http.Error(w, "failed to register webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	e.CreatedAt = time.Now().UTC()
+	_ = dbClient.InsertLog(r.Context(), wallet.WalletID, "webhook_created",
+		fmt.Sprintf("Webhook %s: %s (%v)", e.ID, e.URL, e.Events), "success", r.RemoteAddr)
+
+	writeJSON(w, e)
+}
+
+// webhookListHandler lists the session user's endpoints
+func webhookListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := dbClient.GetWebhookEndpoints(r.Context(), claims.UserID)
+	if err != nil {
+		http.Error(w, "failed to fetch webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []webhook.Endpoint{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"user_id":     claims.UserID,
+		"webhooks":    list,
+		"event_types": webhook.EventTypes(),
+	})
+}
+
+// webhookDeleteHandler removes an endpoint and its deliveries
+func webhookDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		EndpointID string `json:"endpoint_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.EndpointID == "" {
+		http.Error(w, "endpoint_id required", http.StatusBadRequest)
+		return
+	}
+
+	if err := dbClient.DeleteWebhookEndpoint(r.Context(), req.EndpointID, claims.UserID); err != nil {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"status": "deleted", "endpoint_id": req.EndpointID})
+}
+
+// webhookDeliveriesHandler lists deliveries to a user's endpoints, newest
+// first.
+//
+// Query parameters: endpoint_id, status
+// (pending|delivered|dead; dead is the dead-letter queue) and limit.
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusDead:
+	default:
+		http.Error(w, "status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(q.Get("limit"), defaultDeliveryLimit, maxDeliveryLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := dbClient.GetWebhookDeliveries(r.Context(), claims.UserID, q.Get("endpoint_id"), status, limit)
+	if err != nil {
+		http.Error(w, "failed to fetch deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []webhook.Delivery{}
+	}
+
+	writeJSON(w, map[string]interface{}{"deliveries": list})
+}
+
+// webhookAttemptsHandler returns the delivery log of one delivery
+func webhookAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID := r.URL.Query().Get("delivery_id")
+	if deliveryID == "" {
+		http.Error(w, "missing delivery_id param", http.StatusBadRequest)
+		return
+	}
+
+	list, err := dbClient.GetWebhookAttempts(r.Context(), deliveryID, claims.UserID)
+	if err != nil {
+		http.Error(w, "failed to fetch attempts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []webhook.Attempt{}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"delivery_id": deliveryID,
+		"attempts":    list,
+	})
+}
+
+// webhookReplayHandler sends a delivery again, typically one from the
+// dead-letter queue once the merchant has fixed their endpoint
+func webhookReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DeliveryID string `json:"delivery_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DeliveryID == "" {
+		http.Error(w, "delivery_id required", http.StatusBadRequest)
+		return
+	}
+
+	if err := dbClient.ReplayWebhookDelivery(r.Context(), req.DeliveryID, claims.UserID, time.Now()); err != nil {
+		http.Error(w, "delivery not found", http.StatusNotFound)
+		return
+	}
+	webhookDispatcher.Kick()
+
+	writeJSON(w, map[string]interface{}{"status": "queued", "delivery_id": req.DeliveryID})
+}
@@ -0,0 +1,206 @@
+// Command signer works with partially signed transactions away from the
+// server, typically on an air-gapped machine. The server builds a packet
+// with /tx/build; it is carried here as a file, signed, and carried back to
+// /tx/submit.
+//
+//	signer inspect tx.psbt
+//	signer -key alice.key -out tx.signed sign tx.psbt
+//	signer -out tx.signed combine alice.psbt bob.psbt
+//	signer -out submit.json finalize tx.signed
+//
+// Keys are files holding a base64 Ed25519 private key. Packets are read as
+// JSON or base64 and written as base64, or as JSON with -format json.
+// finalize writes the request body for /tx/submit.
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/psbt"
+)
+
+func main() {
+	keyPath := flag.String("key", "", "file holding the signer's base64 private key")
+	out := flag.String("out", "", "file to write the result to; standard output if empty")
+	format := flag.String("format", "base64", "packet output format: base64 or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: signer [flags] inspect|sign|combine|finalize packet...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "base64" && *format != "json" {
+		log.Fatalf("unknown format %q", *format)
+	}
+	log.SetFlags(0)
+
+	files := flag.Args()[1:]
+	p, err := readPacket(files[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "inspect":
+		err = inspect(os.Stdout, p)
+	case "sign":
+		if *keyPath == "" {
+			log.Fatal("sign needs -key")
+		}
+		var priv ed25519.PrivateKey
+		if priv, err = loadKey(*keyPath); err != nil {
+			log.Fatal(err)
+		}
+		if err = p.Sign(priv); err == nil {
+			log.Printf("signed %s as %s (%d of %d signatures)",
+				p.TxID, crypto.WalletIDFromPub(priv.Public().(ed25519.PublicKey)), len(p.Signatures), p.Required())
+			err = writeOutput(*out, p, *format)
+		}
+	case "combine":
+		for _, f := range files[1:] {
+			var other *psbt.Packet
+			if other, err = readPacket(f); err != nil {
+				break
+			}
+			if err = p.Combine(other); err != nil {
+				err = fmt.Errorf("%s: %w", f, err)
+				break
+			}
+		}
+		if err == nil {
+			log.Printf("combined %d packets: %d of %d signatures", len(files), len(p.Signatures), p.Required())
+			err = writeOutput(*out, p, *format)
+		}
+	case "finalize":
+		if _, err = p.Finalize(); err == nil {
+			var body []byte
+			enc, _ := p.Encode()
+			if body, err = json.Marshal(map[string]string{"psbt": enc}); err == nil {
+				err = writeFile(*out, append(body, '\n'))
+			}
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+// loadKey reads a base64 Ed25519 private key from a file
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s: not a base64 Ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+// readPacket reads a packet from a file, or from standard input for "-"
+func readPacket(path string) (*psbt.Packet, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := psbt.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func writeOutput(path string, p *psbt.Packet, format string) error {
+	var data []byte
+	var err error
+	if format == "json" {
+		data, err = json.MarshalIndent(p, "", "  ")
+	} else {
+		var enc string
+		enc, err = p.Encode()
+		data = []byte(enc)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+func writeFile(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// inspect prints what the packet spends and creates, so the signer can
+// check it before signing
+func inspect(w io.Writer, p *psbt.Packet) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	asset := p.Asset
+	if asset == "" {
+		asset = "native"
+	}
+	fmt.Fprintf(w, "txid      %s\n", p.TxID)
+	fmt.Fprintf(w, "from      %s\n", p.SenderID)
+	fmt.Fprintf(w, "to        %s\n", p.ReceiverID)
+	fmt.Fprintf(w, "amount    %d %s\n", p.Amount, asset)
+	if p.Note != "" {
+		fmt.Fprintf(w, "note      %s\n", p.Note)
+	}
+	if p.Lock != nil {
+		fmt.Fprintf(w, "lock      %s\n", p.Lock.Kind)
+	}
+	fmt.Fprintf(w, "created   %s\n", time.Unix(p.Timestamp, 0).UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "fee       %d\n", p.Fee)
+	for _, in := range p.Inputs {
+		fmt.Fprintf(w, "input     %s  %d\n", in.UTXOID, in.Amount)
+	}
+	for _, o := range p.Outputs {
+		fmt.Fprintf(w, "output    %s  %s  %d\n", o.UTXOID, o.Owner, o.Amount)
+	}
+	keys := make([]string, 0, len(p.Meta))
+	for k := range p.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "meta      %s=%s\n", k, p.Meta[k])
+	}
+	fmt.Fprintf(w, "signed    %d of %d", len(p.Signatures), p.Required())
+	if p.Complete() {
+		fmt.Fprint(w, " (complete)")
+	}
+	fmt.Fprintln(w)
+	for _, s := range p.Signatures {
+		fmt.Fprintf(w, "signer    %s\n", base64.StdEncoding.EncodeToString(s.PublicKey))
+	}
+	return nil
+}
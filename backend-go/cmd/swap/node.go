@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"blockchain-wallet/pkg/htlc"
+)
+
+// node is a client for one deployment of the wallet server
+type node struct {
+	name string
+	url  string
+	http *http.Client
+}
+
+// contract is an HTLC as the server reports it
+type contract struct {
+	htlc.HTLC
+	State string `json:"state"`
+}
+
+func (n *node) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(n.url, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", n.name, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", n.name, err)
+	}
+	if resp.StatusCode >= 300 {
+		return &nodeError{node: n.name, status: resp.StatusCode, msg: strings.TrimSpace(string(data))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// nodeError is a request the server answered with an error status
+type nodeError struct {
+	node   string
+	status int
+	msg    string
+}
+
+func (e *nodeError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d: %s", e.node, e.status, e.msg)
+}
+
+// create locks amount from p in a contract p can refund after timeout and
+// to can claim with the secret behind hash
+func (n *node) create(ctx context.Context, p, to *party, amount int64, hash string, timeout int64) (*contract, error) {
+	var c contract
+	err := n.do(ctx, http.MethodPost, "/htlc/create", map[string]interface{}{
+		"sender_id":    p.id,
+		"sender_pub":   base64.StdEncoding.EncodeToString(p.pub),
+		"sender_priv":  base64.StdEncoding.EncodeToString(p.priv),
+		"receiver_id":  to.id,
+		"receiver_pub": base64.StdEncoding.EncodeToString(to.pub),
+		"amount":       amount,
+		"hash":         hash,
+		"timeout":      timeout,
+		"note":         "atomic swap",
+	}, &c)
+	return &c, err
+}
+
+// get returns a contract by ID
+func (n *node) get(ctx context.Context, id string) (*contract, error) {
+	var c contract
+	err := n.do(ctx, http.MethodGet, "/htlc/get?htlc_id="+url.QueryEscape(id), nil, &c)
+	return &c, err
+}
+
+// find returns the contract sender locked to hash, or nil if there is none
+func (n *node) find(ctx context.Context, hash, senderID string) (*contract, error) {
+	var res struct {
+		HTLCs []contract `json:"htlcs"`
+	}
+	if err := n.do(ctx, http.MethodGet, "/htlc/get?hash="+url.QueryEscape(hash), nil, &res); err != nil {
+		return nil, err
+	}
+	for i := range res.HTLCs {
+		if res.HTLCs[i].SenderID == senderID {
+			return &res.HTLCs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// claim spends a contract to its receiver p with the secret
+func (n *node) claim(ctx context.Context, id string, p *party, secret string) error {
+	return n.do(ctx, http.MethodPost, "/htlc/claim", map[string]interface{}{
+		"htlc_id":     id,
+		"secret":      secret,
+		"private_key": base64.StdEncoding.EncodeToString(p.priv),
+	}, nil)
+}
+
+// refund spends an expired contract back to its sender p
+func (n *node) refund(ctx context.Context, id string, p *party) error {
+	return n.do(ctx, http.MethodPost, "/htlc/refund", map[string]interface{}{
+		"htlc_id":     id,
+		"private_key": base64.StdEncoding.EncodeToString(p.priv),
+	}, nil)
+}
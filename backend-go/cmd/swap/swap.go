@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/htlc"
+)
+
+// party is one side of the swap, holding the same key on both nodes
+type party struct {
+	name string
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+	id   string
+}
+
+// loadParty reads a base64 Ed25519 private key from a file
+func loadParty(name, path string) (*party, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s: not a base64 Ed25519 private key", path)
+	}
+	pub := ed25519.PrivateKey(priv).Public().(ed25519.PublicKey)
+	return &party{name: name, priv: priv, pub: pub, id: crypto.WalletIDFromPub(pub)}, nil
+}
+
+// swapState is saved after every step so an interrupted swap can be
+// resumed. Alice pays AmountA on node A for Bob's AmountB on node B.
+type swapState struct {
+	AliceID  string `json:"alice_id"`
+	BobID    string `json:"bob_id"`
+	Secret   string `json:"secret"` // hex; Alice's, revealed when she claims on B
+	Hash     string `json:"hash"`
+	AmountA  int64  `json:"amount_a"`
+	AmountB  int64  `json:"amount_b"`
+	LockBy   int64  `json:"lock_by"`   // no contract is created after this
+	TimeoutB int64  `json:"timeout_b"` // Bob may refund on B from here
+	TimeoutA int64  `json:"timeout_a"` // Alice may refund on A from here; later than TimeoutB
+	HTLCA    string `json:"htlc_a,omitempty"`
+	HTLCB    string `json:"htlc_b,omitempty"`
+	Aborted  string `json:"aborted,omitempty"` // why the swap stopped going forward
+}
+
+// newSwapState starts a swap. Bob's contract times out one window from now
+// and Alice's two, so Bob always has a window to claim on A after Alice
+// reveals the secret on B.
+func newSwapState(alice, bob *party, amountA, amountB int64, window time.Duration) (*swapState, error) {
+	secret, hash, err := htlc.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &swapState{
+		AliceID:  alice.id,
+		BobID:    bob.id,
+		Secret:   fmt.Sprintf("%x", secret),
+		Hash:     fmt.Sprintf("%x", hash),
+		AmountA:  amountA,
+		AmountB:  amountB,
+		LockBy:   now.Add(window / 2).Unix(),
+		TimeoutB: now.Add(window).Unix(),
+		TimeoutA: now.Add(2 * window).Unix(),
+	}, nil
+}
+
+func loadSwapState(path string) (*swapState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var st swapState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// save writes the state through a temporary file so a crash never leaves
+// it half written
+func (st *swapState) save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// swap drives a swap between Alice on node A and Bob on node B
+type swap struct {
+	st         *swapState
+	path       string
+	a, b       *node
+	alice, bob *party
+	poll       time.Duration
+}
+
+func (s *swap) save() error {
+	return s.st.save(s.path)
+}
+
+// abort stops the swap going forward; settle then refunds what was locked
+func (s *swap) abort(reason string) error {
+	if s.st.Aborted == "" {
+		log.Printf("Aborting swap: %s", reason)
+		s.st.Aborted = reason
+	}
+	return s.save()
+}
+
+// run takes the swap as far as it can go: both contracts locked, then
+// settled by claims or, if anything goes wrong, by refunds
+func (s *swap) run(ctx context.Context) error {
+	if err := s.lockA(ctx); err != nil {
+		return err
+	}
+	if s.st.HTLCA == "" {
+		log.Printf("Nothing was locked; the swap is over")
+		return nil
+	}
+	if err := s.lockB(ctx); err != nil {
+		return err
+	}
+	return s.settle(ctx)
+}
+
+// lockA has Alice lock AmountA on node A for Bob
+func (s *swap) lockA(ctx context.Context) error {
+	if s.st.HTLCA != "" {
+		return nil
+	}
+	// A previous run may have created it before crashing
+	c, err := s.a.find(ctx, s.st.Hash, s.alice.id)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		if s.st.Aborted != "" || time.Now().Unix() >= s.st.LockBy {
+			return s.abort("too late to lock on node A")
+		}
+		if c, err = s.a.create(ctx, s.alice, s.bob, s.st.AmountA, s.st.Hash, s.st.TimeoutA); err != nil {
+			return fmt.Errorf("locking on node A: %w", err)
+		}
+	}
+	log.Printf("Alice locked %d on node A in %s until %s", c.Amount, c.ID, time.Unix(c.Timeout, 0).Format(time.RFC3339))
+	s.st.HTLCA = c.ID
+	return s.save()
+}
+
+// lockB has Bob check Alice's contract and lock AmountB on node B for her.
+// Any problem aborts the swap rather than failing, so settle refunds A.
+func (s *swap) lockB(ctx context.Context) error {
+	if s.st.HTLCB != "" || s.st.Aborted != "" {
+		return nil
+	}
+	c, err := s.b.find(ctx, s.st.Hash, s.bob.id)
+	if err != nil {
+		return s.abort(err.Error())
+	}
+	if c == nil {
+		a, err := s.a.get(ctx, s.st.HTLCA)
+		if err != nil {
+			return s.abort(err.Error())
+		}
+		if err := s.check(a, s.alice, s.bob, s.st.AmountA, s.st.TimeoutA); err != nil {
+			return s.abort("node A contract: " + err.Error())
+		}
+		if time.Now().Unix() >= s.st.LockBy {
+			return s.abort("too late to lock on node B")
+		}
+		if c, err = s.b.create(ctx, s.bob, s.alice, s.st.AmountB, s.st.Hash, s.st.TimeoutB); err != nil {
+			// It may have been created anyway; settle looks it up
+			return s.abort("locking on node B: " + err.Error())
+		}
+	}
+	log.Printf("Bob locked %d on node B in %s until %s", c.Amount, c.ID, time.Unix(c.Timeout, 0).Format(time.RFC3339))
+	s.st.HTLCB = c.ID
+	return s.save()
+}
+
+// check verifies that a counterparty's contract has the agreed terms
+func (s *swap) check(c *contract, from, to *party, amount, timeout int64) error {
+	switch {
+	case c.SenderID != from.id || c.ReceiverID != to.id:
+		return errors.New("wrong parties")
+	case !c.Claimer.Equal(to.pub):
+		return errors.New("wrong claim key")
+	case c.Hash != s.st.Hash:
+		return errors.New("wrong hash")
+	case c.Amount != amount:
+		return fmt.Errorf("amount %d, want %d", c.Amount, amount)
+	case c.Timeout != timeout:
+		return fmt.Errorf("timeout %d, want %d", c.Timeout, timeout)
+	case c.Status != htlc.StatusOpen:
+		return errors.New("already " + c.Status)
+	}
+	return nil
+}
+
+// settle polls both contracts until each is claimed or refunded. Alice
+// claims on B while it is safe; Bob claims on A with the secret her claim
+// revealed on node B. Contracts that time out are refunded. Node errors
+// are logged and retried, so a swap survives either node going away for a
+// while.
+func (s *swap) settle(ctx context.Context) error {
+	for {
+		done, err := s.settleOnce(ctx)
+		if err != nil {
+			log.Printf("Retrying in %v: %v", s.poll, err)
+		}
+		if done {
+			return s.report(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.poll):
+		}
+	}
+}
+
+func (s *swap) settleOnce(ctx context.Context) (bool, error) {
+	if s.st.HTLCB == "" {
+		c, err := s.b.find(ctx, s.st.Hash, s.bob.id)
+		if err != nil {
+			return false, err
+		}
+		if c != nil {
+			s.st.HTLCB = c.ID
+			if err := s.save(); err != nil {
+				return false, err
+			}
+		}
+	}
+	now := time.Now().Unix()
+
+	var b *contract
+	if s.st.HTLCB != "" {
+		var err error
+		if b, err = s.b.get(ctx, s.st.HTLCB); err != nil {
+			return false, err
+		}
+		if b.Status == htlc.StatusOpen {
+			switch {
+			case now >= s.st.TimeoutB:
+				log.Printf("Node B contract timed out; Bob refunds it")
+				if err := s.b.refund(ctx, b.ID, s.bob); err != nil {
+					return false, err
+				}
+			case s.st.Aborted == "":
+				if err := s.check(b, s.bob, s.alice, s.st.AmountB, s.st.TimeoutB); err != nil {
+					return false, s.abort("node B contract: " + err.Error())
+				}
+				log.Printf("Alice claims on node B, revealing the secret")
+				if err := s.b.claim(ctx, b.ID, s.alice, s.st.Secret); err != nil {
+					return false, err
+				}
+			}
+			if b, err = s.b.get(ctx, b.ID); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	a, err := s.a.get(ctx, s.st.HTLCA)
+	if err != nil {
+		return false, err
+	}
+	if a.Status == htlc.StatusOpen {
+		switch {
+		case b != nil && b.Status == htlc.StatusClaimed:
+			// Bob learns the secret from node B, not from the state file
+			log.Printf("Bob claims on node A with the secret from node B")
+			if err := s.a.claim(ctx, a.ID, s.bob, b.Secret); err != nil {
+				return false, err
+			}
+		case now >= s.st.TimeoutA:
+			log.Printf("Node A contract timed out; Alice refunds it")
+			if err := s.a.refund(ctx, a.ID, s.alice); err != nil {
+				return false, err
+			}
+		}
+		if a, err = s.a.get(ctx, a.ID); err != nil {
+			return false, err
+		}
+	}
+
+	settled := a.Status != htlc.StatusOpen && (b == nil || b.Status != htlc.StatusOpen)
+	// Without a node B contract, A stays open until it can be refunded
+	return settled, nil
+}
+
+// report prints how each contract ended
+func (s *swap) report(ctx context.Context) error {
+	for _, side := range []struct {
+		n  *node
+		id string
+	}{{s.a, s.st.HTLCA}, {s.b, s.st.HTLCB}} {
+		if side.id == "" {
+			fmt.Printf("%s: no contract\n", side.n.name)
+			continue
+		}
+		c, err := side.n.get(ctx, side.id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s %d from %s to %s: %s", side.n.name, c.ID, c.Amount, c.SenderID, c.ReceiverID, c.State)
+		if c.SettleTxID != "" {
+			fmt.Printf(" in %s", c.SettleTxID)
+		}
+		fmt.Println()
+	}
+	if s.st.Aborted != "" {
+		fmt.Printf("aborted: %s\n", s.st.Aborted)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// client talks to the wallet server's HTTP API. token is the session
+// token from login, sent to the endpoints that need one.
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.url, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (c *client) get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, out)
+}
+
+func (c *client) post(ctx context.Context, path string, body, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, body, out)
+}
+
+// utxo is an unspent output as /wallet/balance reports it
+type utxo struct {
+	ID     string `json:"utxo_id"`
+	Amount int64  `json:"amount"`
+	Asset  string `json:"asset"`
+	Lock   *struct {
+		Kind string `json:"kind"`
+	} `json:"lock"`
+}
+
+type holding struct {
+	Balance   int64 `json:"balance"`
+	Spendable int64 `json:"spendable"`
+}
+
+type balance struct {
+	Wallet    string              `json:"wallet"`
+	Balance   int64               `json:"balance"`
+	Spendable int64               `json:"spendable"`
+	Assets    map[string]*holding `json:"assets"`
+	UTXOs     []utxo              `json:"utxos"`
+}
+
+func (c *client) balance(ctx context.Context, wallet string) (*balance, error) {
+	var b balance
+	err := c.get(ctx, "/wallet/balance?wallet="+url.QueryEscape(wallet), &b)
+	return &b, err
+}
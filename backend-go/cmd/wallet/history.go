@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyTx is a transaction as /wallet/history reports it
+type historyTx struct {
+	TxID             string    `json:"tx_id"`
+	SenderWalletID   string    `json:"sender_wallet_id"`
+	ReceiverWalletID string    `json:"receiver_wallet_id"`
+	Amount           int64     `json:"amount"`
+	Asset            string    `json:"asset,omitempty"`
+	Note             string    `json:"note"`
+	TxType           string    `json:"tx_type"`
+	Status           string    `json:"status"`
+	Confirmations    int64     `json:"confirmations"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// cmdHistory fetches every page of a wallet's history and writes it as
+// CSV or JSON
+func cmdHistory(c *cli, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv or json")
+	out := fs.String("out", "", "file to write to; standard output if empty")
+	from := fs.String("from", "", "only transactions on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only transactions on or before this date (YYYY-MM-DD)")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil || (*format != "csv" && *format != "json") {
+		return usageError{}
+	}
+	wallet := c.walletID(pos[0])
+
+	var all []historyTx
+	cursor := ""
+	for {
+		q := url.Values{"wallet": {wallet}, "limit": {"200"}}
+		if *from != "" {
+			q.Set("from", *from)
+		}
+		if *to != "" {
+			q.Set("to", *to)
+		}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		var page struct {
+			Transactions []historyTx `json:"transactions"`
+			NextCursor   string      `json:"next_cursor"`
+		}
+		if err := c.node.get(context.Background(), "/wallet/history?"+q.Encode(), &page); err != nil {
+			return err
+		}
+		all = append(all, page.Transactions...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if *format == "json" {
+		if all == nil {
+			all = []historyTx{}
+		}
+		data, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeOut(*out, append(data, '\n'))
+	}
+
+	var sb strings.Builder
+	cw := csv.NewWriter(&sb)
+	cw.Write([]string{"tx_id", "created_at", "type", "direction", "counterparty", "amount", "asset", "status", "confirmations", "note"})
+	for _, t := range all {
+		direction, counterparty := "out", t.ReceiverWalletID
+		if t.ReceiverWalletID == wallet {
+			direction, counterparty = "in", t.SenderWalletID
+		}
+		cw.Write([]string{
+			t.TxID, t.CreatedAt.UTC().Format(time.RFC3339), t.TxType, direction, counterparty,
+			strconv.FormatInt(t.Amount, 10), t.Asset, t.Status, strconv.FormatInt(t.Confirmations, 10), t.Note,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return writeOut(*out, []byte(sb.String()))
+}
+
+// cmdBeneficiaries lists, adds or removes a user's saved beneficiaries
+func cmdBeneficiaries(c *cli, args []string) error {
+	fs := flag.NewFlagSet("beneficiaries", flag.ContinueOnError)
+	user := fs.String("user", "", "user ID the beneficiaries belong to")
+	pos, err := parseFlags(fs, args, 0, 3)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch {
+	case len(pos) == 0 && *user != "":
+		var resp struct {
+			Beneficiaries []struct {
+				ID       string `json:"id"`
+				WalletID string `json:"beneficiary_wallet_id"`
+				Name     string `json:"beneficiary_name"`
+			} `json:"beneficiaries"`
+		}
+		if err := c.node.get(ctx, "/profile/beneficiaries?user_id="+url.QueryEscape(*user), &resp); err != nil {
+			return err
+		}
+		for _, b := range resp.Beneficiaries {
+			fmt.Printf("%s  %s  %s\n", b.ID, b.WalletID, b.Name)
+		}
+		return nil
+	case len(pos) == 3 && pos[0] == "add" && *user != "":
+		return c.node.post(ctx, "/profile/beneficiaries/add", map[string]string{
+			"user_id":          *user,
+			"wallet_id":        c.walletID(pos[1]),
+			"beneficiary_name": pos[2],
+		}, nil)
+	case len(pos) == 2 && pos[0] == "remove":
+		return c.node.post(ctx, "/profile/beneficiaries/remove", map[string]string{"beneficiary_id": pos[1]}, nil)
+	}
+	return usageError{}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/keystore"
+)
+
+// cmdNew creates a key and saves it encrypted in the keystore
+func cmdNew(c *cli, args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	label := fs.String("label", "", "name to refer to the key by")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	priv, _, err := crypto.GenerateKeypair()
+	if err != nil {
+		return err
+	}
+	return c.store(priv, *label)
+}
+
+// cmdImport adds an existing key to the keystore. It accepts a file
+// holding a base64 private key, as /wallet/create returns, or another
+// keystore's key file.
+func cmdImport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	label := fs.String("label", "", "name to refer to the key by")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(pos[0])
+	if err != nil {
+		return err
+	}
+
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "{") {
+		k, err := keystore.Parse(data)
+		if err != nil {
+			return err
+		}
+		if *label != "" {
+			k.Label = *label
+		}
+		// Check the passphrase before accepting the file
+		pass, err := c.passphrase("Passphrase of the key file: ")
+		if err != nil {
+			return err
+		}
+		if _, err := k.Decrypt(pass); err != nil {
+			return err
+		}
+		if err := c.keys.Save(k); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s\n", k.WalletID)
+		return nil
+	}
+
+	priv, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return fmt.Errorf("%s: neither a key file nor a base64 Ed25519 private key", pos[0])
+	}
+	return c.store(priv, *label)
+}
+
+// store encrypts priv under a new passphrase and saves it
+func (c *cli) store(priv ed25519.PrivateKey, label string) error {
+	pass, err := c.passphrase("New passphrase: ")
+	if err != nil {
+		return err
+	}
+	k, err := keystore.Encrypt(priv, pass, label, 0)
+	if err != nil {
+		return err
+	}
+	if err := c.keys.Save(k); err != nil {
+		return err
+	}
+	fmt.Printf("Wallet    %s\n", k.WalletID)
+	fmt.Printf("Public    %s\n", base64.StdEncoding.EncodeToString(k.PublicKey))
+	fmt.Printf("Keystore  %s\n", c.keys.Path)
+	return nil
+}
+
+// cmdKeys lists the keystore without unlocking anything
+func cmdKeys(c *cli, args []string) error {
+	if len(args) != 0 {
+		return usageError{}
+	}
+	keys, err := c.keys.List()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fmt.Printf("No keys in %s\n", c.keys.Path)
+		return nil
+	}
+	for _, k := range keys {
+		fmt.Printf("%-14s %s  %s\n", k.Label, c.address(k.WalletID), k.CreatedAt.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// cmdExport writes a keystore key file out as a backup. The file stays
+// sealed under its passphrase and can be imported by "wallet import" or
+// uploaded with "wallet restore".
+func cmdExport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write to; standard output if empty")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	k, err := c.keys.Find(pos[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", pos[0], err)
+	}
+	data, err := k.Marshal()
+	if err != nil {
+		return err
+	}
+	return writeOut(*out, append(data, '\n'))
+}
+
+// cmdBackup has the server seal a wallet key it holds under a new
+// passphrase and saves the result in the keystore, or in a file with -out
+func cmdBackup(c *cli, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	token := fs.String("token", c.node.token, "session token from login")
+	label := fs.String("label", "", "name to refer to the key by")
+	out := fs.String("out", "", "file to write the key file to instead of the keystore")
+	pos, err := parseFlags(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if *token == "" {
+		return errors.New("a session token is required; pass -token or set WALLET_TOKEN")
+	}
+	c.node.token = *token
+	wallet := ""
+	if len(pos) == 1 {
+		wallet = pos[0]
+	}
+	pass, err := c.passphrase("Passphrase for the backup: ")
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Keystore json.RawMessage `json:"keystore"`
+	}
+	err = c.node.post(context.Background(), "/wallet/export", map[string]string{
+		"wallet_id":  wallet,
+		"passphrase": pass,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	k, err := keystore.Parse(resp.Keystore)
+	if err != nil {
+		return err
+	}
+	// Make sure the file opens before relying on it as a backup
+	if _, err := k.Decrypt(pass); err != nil {
+		return err
+	}
+	k.Label = *label
+	if *out != "" {
+		data, err := k.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := writeOut(*out, append(data, '\n')); err != nil {
+			return err
+		}
+	} else if err := c.keys.Save(k); err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %s\n", k.WalletID)
+	return nil
+}
+
+// cmdRestore uploads a keystore key to the server, which checks it against
+// the wallet it holds or adds the wallet to the account
+func cmdRestore(c *cli, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	token := fs.String("token", c.node.token, "session token from login")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *token == "" {
+		return errors.New("a session token is required; pass -token or set WALLET_TOKEN")
+	}
+	c.node.token = *token
+	k, err := c.keys.Find(pos[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", pos[0], err)
+	}
+	pass, err := c.passphrase(fmt.Sprintf("Passphrase for %s: ", k.WalletID[:16]))
+	if err != nil {
+		return err
+	}
+	if _, err := k.Decrypt(pass); err != nil {
+		return err
+	}
+
+	var resp struct {
+		WalletID string `json:"wallet_id"`
+		Restored bool   `json:"restored"`
+	}
+	err = c.node.post(context.Background(), "/wallet/import", map[string]interface{}{
+		"keystore":   k,
+		"passphrase": pass,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Restored {
+		fmt.Printf("Restored the server key of %s\n", resp.WalletID)
+	} else {
+		fmt.Printf("Added %s to the account\n", resp.WalletID)
+	}
+	return nil
+}
+
+// unlock finds a key in the keystore and decrypts it
+func (c *cli) unlock(name string) (*keystore.Key, ed25519.PrivateKey, error) {
+	k, err := c.keys.Find(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	pass, err := c.passphrase(fmt.Sprintf("Passphrase for %s: ", k.WalletID[:16]))
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := k.Decrypt(pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, priv, nil
+}
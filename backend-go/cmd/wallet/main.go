@@ -0,0 +1,196 @@
+// Command wallet is a command-line client for the wallet server. Keys are
+// kept in passphrase-encrypted files in a local keystore and never leave
+// the machine: transfers are built by the server, signed here, and sent
+// back as signed packets.
+//
+//	wallet new -label savings
+//	wallet balance savings
+//	wallet send -from savings -to <address> -amount 25 -note rent
+//
+// A transfer can also be signed on a machine with no network access:
+//
+//	wallet build -from <address> -to <address> -amount 25 -out tx.psbt
+//	wallet sign -key savings tx.psbt > tx.signed     (offline)
+//	wallet submit tx.signed
+//
+// The passphrase is read from WALLET_PASSPHRASE or, failing that, from
+// standard input. Commands that use a server-held key take the session
+// token from login in -token or WALLET_TOKEN. Wallets are given as keystore
+// labels, addresses of the network in ADDRESS_PREFIX, or legacy hex wallet
+// IDs. Run "wallet help" for every command.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/address"
+	"blockchain-wallet/pkg/keystore"
+)
+
+// cli holds the global settings every command shares
+type cli struct {
+	node   *client
+	keys   keystore.Dir
+	home   string
+	prefix string // network prefix of addresses
+	stdin  *bufio.Reader
+}
+
+type command struct {
+	usage string
+	help  string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"new":           {"new [-label name]", "create a key in the keystore", cmdNew},
+	"import":        {"import [-label name] keyfile", "add a base64 private key or key file to the keystore", cmdImport},
+	"keys":          {"keys", "list the keys in the keystore", cmdKeys},
+	"export":        {"export [-out file] key", "write a keystore key as a portable backup file", cmdExport},
+	"backup":        {"backup [-token t] [-out file] [wallet]", "fetch a wallet's key from the server as a keystore file", cmdBackup},
+	"restore":       {"restore [-token t] key", "upload a keystore key to the server", cmdRestore},
+	"balance":       {"balance wallet", "show a wallet's balance and asset holdings", cmdBalance},
+	"utxos":         {"utxos wallet", "list a wallet's unspent outputs", cmdUTXOs},
+	"send":          {"send -from key -to wallet -amount n [-asset id] [-note text] [-allow-unknown]", "build, sign and submit a transfer", cmdSend},
+	"build":         {"build -from wallet -to wallet -amount n [-asset id] [-note text] [-out file]", "build an unsigned transfer for offline signing", cmdBuild},
+	"sign":          {"sign -key key [-out file] packet", "sign a packet with a keystore key; needs no network", cmdSign},
+	"submit":        {"submit [-allow-unknown] packet", "submit a signed packet", cmdSubmit},
+	"watch":         {"watch [-interval d] [add|remove wallet...]", "follow the balances of watched wallets", cmdWatch},
+	"beneficiaries": {"beneficiaries -user id [add wallet name | remove id]", "manage a user's saved beneficiaries", cmdBeneficiaries},
+	"history":       {"history [-format csv|json] [-out file] wallet", "export a wallet's transaction history", cmdHistory},
+}
+
+func main() {
+	defaultHome := os.Getenv("WALLET_HOME")
+	if defaultHome == "" {
+		if dir, err := os.UserHomeDir(); err == nil {
+			defaultHome = filepath.Join(dir, ".wallet")
+		}
+	}
+	defaultNode := os.Getenv("WALLET_NODE")
+	if defaultNode == "" {
+		defaultNode = "http://localhost:8080"
+	}
+	nodeURL := flag.String("node", defaultNode, "URL of the wallet server")
+	home := flag.String("home", defaultHome, "directory holding the keystore and watch list")
+	flag.Usage = usage
+	flag.Parse()
+	log.SetFlags(0)
+
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "" && name != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+	prefix := os.Getenv("ADDRESS_PREFIX")
+	if prefix == "" {
+		prefix = address.MainPrefix
+	}
+	c := &cli{
+		node:   &client{url: *nodeURL, token: os.Getenv("WALLET_TOKEN"), http: &http.Client{Timeout: 30 * time.Second}},
+		keys:   keystore.Dir{Path: filepath.Join(*home, "keystore")},
+		home:   *home,
+		prefix: prefix,
+		stdin:  bufio.NewReader(os.Stdin),
+	}
+	if err := cmd.run(c, flag.Args()[1:]); err != nil {
+		var ue usageError
+		if errors.As(err, &ue) {
+			fmt.Fprintf(os.Stderr, "usage: wallet %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		log.Fatalf("%s: %v", name, err)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: wallet [-node url] [-home dir] command [args]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(out, "  %-14s %s\n", n, commands[n].help)
+	}
+	fmt.Fprintln(out)
+	flag.PrintDefaults()
+}
+
+// usageError reports a command run with the wrong arguments
+type usageError struct{}
+
+func (usageError) Error() string { return "usage" }
+
+// parseFlags parses a command's flags, allowing them before or after its
+// positional arguments, and checks the number of positional arguments
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	fs.SetOutput(new(strings.Builder))
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usageError{}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(pos) < min || (max >= 0 && len(pos) > max) {
+		return nil, usageError{}
+	}
+	return pos, nil
+}
+
+// passphrase returns WALLET_PASSPHRASE or reads a line from standard input
+func (c *cli) passphrase(prompt string) (string, error) {
+	if p := os.Getenv("WALLET_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := c.stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return line, nil
+}
+
+// walletID resolves a keystore label, ID prefix or address to a wallet ID,
+// or returns name unchanged for the server to judge
+func (c *cli) walletID(name string) string {
+	if k, err := c.keys.Find(name); err == nil {
+		return k.WalletID
+	}
+	if id, err := address.Normalize(c.prefix, name); err == nil {
+		return id
+	}
+	return name
+}
+
+// address is how a wallet ID is shown: as an address where it has one
+func (c *cli) address(walletID string) string {
+	if s, err := address.Encode(c.prefix, walletID); err == nil {
+		return s
+	}
+	return walletID
+}
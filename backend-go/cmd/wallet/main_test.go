@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"blockchain-wallet/pkg/address"
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/keystore"
+	"blockchain-wallet/pkg/psbt"
+	"blockchain-wallet/pkg/tx"
+	utxos "blockchain-wallet/pkg/utxo"
+)
+
+// newTestCLI returns a cli with an empty keystore under a temporary home,
+// talking to nodeURL, with the passphrase taken from the environment
+func newTestCLI(t *testing.T, nodeURL string) *cli {
+	t.Helper()
+	t.Setenv("WALLET_PASSPHRASE", "correct horse")
+	home := t.TempDir()
+	return &cli{
+		node:   &client{url: nodeURL, http: http.DefaultClient},
+		keys:   keystore.Dir{Path: filepath.Join(home, "keystore")},
+		home:   home,
+		prefix: address.MainPrefix,
+		stdin:  bufio.NewReader(strings.NewReader("")),
+	}
+}
+
+// importKey adds a new key to the cli's keystore under label
+func importKey(t *testing.T, c *cli, label string) ed25519.PrivateKey {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdImport(c, []string{"-label", label, file}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return priv
+}
+
+// packetFor builds an unsigned packet sending amount from priv's wallet,
+// spending a single output of 100
+func packetFor(t *testing.T, priv ed25519.PrivateKey, receiver string, amount int64, note string) *psbt.Packet {
+	t.Helper()
+	sender := crypto.WalletIDFromPub(priv.Public().(ed25519.PublicKey))
+	in := &utxos.UTXO{ID: "in-1", Owner: sender, Amount: 100}
+	p, err := psbt.New(tx.NewTransaction(sender, receiver, amount, note, []string{in.ID}), []*utxos.UTXO{in}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestImportExportRoundTrip(t *testing.T) {
+	c := newTestCLI(t, "")
+	priv := importKey(t, c, "savings")
+
+	k, err := c.keys.Find("savings")
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if k.WalletID != crypto.WalletIDFromPub(priv.Public().(ed25519.PublicKey)) {
+		t.Fatalf("imported wallet %s", k.WalletID)
+	}
+
+	// The exported file imports into another keystore and opens to the same key
+	backup := filepath.Join(t.TempDir(), "savings.json")
+	if err := cmdExport(c, []string{"-out", backup, "savings"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	other := newTestCLI(t, "")
+	if err := cmdImport(other, []string{"-label", "restored", backup}); err != nil {
+		t.Fatalf("import of the export: %v", err)
+	}
+	_, got, err := other.unlock("restored")
+	if err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if !bytes.Equal(got, priv) {
+		t.Fatal("round trip changed the key")
+	}
+
+	// A key file is only accepted with its passphrase
+	third := newTestCLI(t, "")
+	t.Setenv("WALLET_PASSPHRASE", "wrong")
+	if err := cmdImport(third, []string{backup}); err == nil {
+		t.Fatal("imported a key file with the wrong passphrase")
+	}
+}
+
+func TestSignPacket(t *testing.T) {
+	c := newTestCLI(t, "")
+	priv := importKey(t, c, "cold")
+	other := importKey(t, c, "other")
+	receiver := crypto.WalletIDFromPub(other.Public().(ed25519.PublicKey))
+
+	dir := t.TempDir()
+	unsigned, signed := filepath.Join(dir, "tx.psbt"), filepath.Join(dir, "tx.signed")
+	if err := writePacket(unsigned, packetFor(t, priv, receiver, 25, "rent")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the sender's key can sign
+	if err := cmdSign(c, []string{"-key", "other", "-out", signed, unsigned}); err == nil {
+		t.Fatal("signed with a key that does not own the sender wallet")
+	}
+	if err := cmdSign(c, []string{"-key", "cold", "-out", signed, unsigned}); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	p, err := readPacket(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txx, err := p.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if err := txx.VerifySigHashSigner(); err != nil || txx.Amount != 25 || txx.ReceiverID != receiver {
+		t.Fatalf("signed transaction %+v: %v", txx, err)
+	}
+
+	if err := cmdSign(c, []string{unsigned}); err != (usageError{}) {
+		t.Fatalf("sign without -key: %v", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var submitted []*tx.Transaction
+	var priv ed25519.PrivateKey
+	amountBuilt := int64(0) // the amount the server builds; 0 builds what was asked
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tx/build":
+			var req struct {
+				ReceiverID string `json:"receiver_id"`
+				Amount     int64  `json:"amount"`
+				Note       string `json:"note"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if amountBuilt != 0 {
+				req.Amount = amountBuilt
+			}
+			enc, _ := packetFor(t, priv, req.ReceiverID, req.Amount, req.Note).Encode()
+			_ = json.NewEncoder(w).Encode(map[string]string{"encoded": enc})
+		case "/tx/submit":
+			var req struct {
+				PSBT string `json:"psbt"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			p, err := psbt.Decode([]byte(req.PSBT))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			txx, err := p.Finalize()
+			if err == nil {
+				err = txx.VerifySigHashSigner()
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			submitted = append(submitted, txx)
+			_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "txid": txx.ID})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestCLI(t, srv.URL)
+	priv = importKey(t, c, "savings")
+	receiver := strings.Repeat("ab", 32)
+
+	if err := cmdSend(c, []string{"-from", "savings", "-to", receiver, "-amount", "25", "-note", "rent"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(submitted) != 1 || submitted[0].Amount != 25 || submitted[0].ReceiverID != receiver || submitted[0].Note != "rent" {
+		t.Fatalf("submitted %+v", submitted)
+	}
+
+	// A packet that differs from the request is not signed
+	amountBuilt = 90
+	if err := cmdSend(c, []string{"-from", "savings", "-to", receiver, "-amount", "25"}); err == nil ||
+		!strings.Contains(err.Error(), "different transfer") {
+		t.Fatalf("send of a tampered packet: %v", err)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("tampered packet was submitted")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"blockchain-wallet/pkg/psbt"
+)
+
+// cmdBalance shows a wallet's native balance and its token holdings
+func cmdBalance(c *cli, args []string) error {
+	if len(args) != 1 {
+		return usageError{}
+	}
+	b, err := c.node.balance(context.Background(), c.walletID(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wallet     %s\n", b.Wallet)
+	fmt.Printf("Balance    %d\n", b.Balance)
+	fmt.Printf("Spendable  %d\n", b.Spendable)
+	ids := make([]string, 0, len(b.Assets))
+	for id := range b.Assets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("Asset      %s  %d (%d spendable)\n", id, b.Assets[id].Balance, b.Assets[id].Spendable)
+	}
+	return nil
+}
+
+// cmdUTXOs lists a wallet's unspent outputs
+func cmdUTXOs(c *cli, args []string) error {
+	if len(args) != 1 {
+		return usageError{}
+	}
+	b, err := c.node.balance(context.Background(), c.walletID(args[0]))
+	if err != nil {
+		return err
+	}
+	for _, u := range b.UTXOs {
+		line := fmt.Sprintf("%-72s %12d", u.ID, u.Amount)
+		if u.Asset != "" {
+			line += "  " + u.Asset
+		}
+		if u.Lock != nil {
+			line += "  locked:" + u.Lock.Kind
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+type transferFlags struct {
+	from, to, asset, note string
+	amount                int64
+}
+
+func (t *transferFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.from, "from", "", "sending wallet or keystore key")
+	fs.StringVar(&t.to, "to", "", "receiving wallet or keystore key")
+	fs.Int64Var(&t.amount, "amount", 0, "amount to send")
+	fs.StringVar(&t.asset, "asset", "", "asset ID to send; the native coin if empty")
+	fs.StringVar(&t.note, "note", "", "note recorded with the transfer")
+}
+
+// build asks the server for an unsigned packet
+func (c *cli) build(ctx context.Context, t transferFlags) (*psbt.Packet, error) {
+	if t.from == "" || t.to == "" || t.amount <= 0 {
+		return nil, usageError{}
+	}
+	var resp struct {
+		Encoded string `json:"encoded"`
+	}
+	err := c.node.post(ctx, "/tx/build", map[string]interface{}{
+		"sender_id":   c.walletID(t.from),
+		"receiver_id": c.walletID(t.to),
+		"amount":      t.amount,
+		"asset":       t.asset,
+		"note":        t.note,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return psbt.Decode([]byte(resp.Encoded))
+}
+
+// submit sends a fully signed packet and returns the transaction ID. The
+// server refuses receivers that are not registered unless allowUnknown.
+func (c *cli) submit(ctx context.Context, p *psbt.Packet, allowUnknown bool) (string, error) {
+	if _, err := p.Finalize(); err != nil {
+		return "", err
+	}
+	enc, err := p.Encode()
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		TxID string `json:"txid"`
+	}
+	err = c.node.post(ctx, "/tx/submit", map[string]interface{}{"psbt": enc, "allow_unknown": allowUnknown}, &resp)
+	return resp.TxID, err
+}
+
+// cmdSend builds a transfer on the server, signs it locally and submits it
+func cmdSend(c *cli, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	var t transferFlags
+	t.register(fs)
+	allowUnknown := fs.Bool("allow-unknown", false, "send even if the receiver is not a registered wallet")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if t.from == "" || t.to == "" || t.amount <= 0 {
+		return usageError{}
+	}
+	k, priv, err := c.unlock(t.from)
+	if err != nil {
+		return err
+	}
+	t.from = k.WalletID
+
+	ctx := context.Background()
+	p, err := c.build(ctx, t)
+	if err != nil {
+		return err
+	}
+	// The server chose the inputs; check the packet says what was asked
+	// before signing it. send never asks for a lock, so a packet with one
+	// would hand the receiver an output nobody asked to lock.
+	if p.SenderID != t.from || p.ReceiverID != c.walletID(t.to) || p.Amount != t.amount ||
+		p.Asset != t.asset || p.Note != t.note || p.Lock != nil {
+		return fmt.Errorf("server built a different transfer than requested")
+	}
+	if err := p.Sign(priv); err != nil {
+		return err
+	}
+	txid, err := c.submit(ctx, p, *allowUnknown)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sent %d to %s in %s\n", t.amount, p.ReceiverID, txid)
+	return nil
+}
+
+// cmdBuild writes an unsigned packet to carry to an offline signer
+func cmdBuild(c *cli, args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	var t transferFlags
+	t.register(fs)
+	out := fs.String("out", "", "file to write the packet to; standard output if empty")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	p, err := c.build(context.Background(), t)
+	if err != nil {
+		return err
+	}
+	return writePacket(*out, p)
+}
+
+// cmdSign signs a packet with a keystore key. It makes no network calls,
+// so it can run on an air-gapped machine.
+func cmdSign(c *cli, args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	key := fs.String("key", "", "keystore key to sign with")
+	out := fs.String("out", "", "file to write the signed packet to; standard output if empty")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil || *key == "" {
+		return usageError{}
+	}
+	p, err := readPacket(pos[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signing %d to %s from %s (inputs %d, fee %d)\n",
+		p.Amount, p.ReceiverID, p.SenderID, len(p.Inputs), p.Fee)
+	if p.Lock != nil {
+		fmt.Fprintf(os.Stderr, "The receiver's output is locked: %s\n", p.Lock)
+	}
+	_, priv, err := c.unlock(*key)
+	if err != nil {
+		return err
+	}
+	if err := p.Sign(priv); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d signatures\n", len(p.Signatures), p.Required())
+	return writePacket(*out, p)
+}
+
+// cmdSubmit sends a signed packet to the server
+func cmdSubmit(c *cli, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ContinueOnError)
+	allowUnknown := fs.Bool("allow-unknown", false, "send even if the receiver is not a registered wallet")
+	pos, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	p, err := readPacket(pos[0])
+	if err != nil {
+		return err
+	}
+	txid, err := c.submit(context.Background(), p, *allowUnknown)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Submitted %s\n", txid)
+	return nil
+}
+
+func readPacket(path string) (*psbt.Packet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return psbt.Decode(data)
+}
+
+func writePacket(path string, p *psbt.Packet) error {
+	enc, err := p.Encode()
+	if err != nil {
+		return err
+	}
+	return writeOut(path, []byte(enc+"\n"))
+}
+
+// writeOut writes data to path, or to standard output if path is empty
+func writeOut(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
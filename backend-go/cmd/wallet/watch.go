@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchFile is where the watched wallets are kept
+func (c *cli) watchFile() string {
+	return filepath.Join(c.home, "watch.json")
+}
+
+func (c *cli) loadWatched() ([]string, error) {
+	data, err := os.ReadFile(c.watchFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.watchFile(), err)
+	}
+	return list, nil
+}
+
+func (c *cli) saveWatched(list []string) error {
+	sort.Strings(list)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.home, 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.watchFile(), append(data, '\n'), 0o600)
+}
+
+// cmdWatch edits the watch list, or polls the watched wallets and prints
+// every balance change until interrupted. Watching needs no keys.
+func cmdWatch(c *cli, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", 10*time.Second, "how often to poll the server")
+	pos, err := parseFlags(fs, args, 0, -1)
+	if err != nil {
+		return err
+	}
+	list, err := c.loadWatched()
+	if err != nil {
+		return err
+	}
+
+	if len(pos) > 0 {
+		switch pos[0] {
+		case "add":
+			for _, name := range pos[1:] {
+				id := c.walletID(name)
+				if !contains(list, id) {
+					list = append(list, id)
+				}
+			}
+		case "remove":
+			for _, name := range pos[1:] {
+				id := c.walletID(name)
+				for i, w := range list {
+					if w == id {
+						list = append(list[:i], list[i+1:]...)
+						break
+					}
+				}
+			}
+		case "list":
+			for _, w := range list {
+				fmt.Println(w)
+			}
+			return nil
+		default:
+			return usageError{}
+		}
+		if err := c.saveWatched(list); err != nil {
+			return err
+		}
+		fmt.Printf("Watching %d wallets\n", len(list))
+		return nil
+	}
+
+	if len(list) == 0 {
+		return errors.New("no wallets watched; add some with \"watch add\"")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	last := map[string]int64{}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		for _, w := range list {
+			b, err := c.node.balance(ctx, w)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Printf("%s: %v", w, err)
+				continue
+			}
+			prev, seen := last[w]
+			switch {
+			case !seen:
+				fmt.Printf("%s  %s  balance %d\n", time.Now().Format(time.TimeOnly), w, b.Balance)
+			case b.Balance != prev:
+				fmt.Printf("%s  %s  balance %d (%+d)\n", time.Now().Format(time.TimeOnly), w, b.Balance, b.Balance-prev)
+			}
+			last[w] = b.Balance
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+// Package address encodes wallet IDs as checksummed, versioned addresses.
+//
+// Internally a wallet is identified by 64 hex characters (the SHA-256 of its
+// public key) or, for multisig wallets, "ms" and 64 hex characters. Those
+// have no checksum, so a mistyped ID is still a valid-looking wallet. An
+// address carries the same 32-byte hash in Bech32m under a network prefix,
+// with a leading version that says what kind of wallet it is:
+//
+//	cw1q<52 characters of hash><6 characters of checksum>
+//
+// Legacy hex IDs are still accepted by Normalize during the transition.
+package address
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Network prefixes
+const (
+	MainPrefix = "cw"  // the default network
+	TestPrefix = "tcw" // test and development networks
+)
+
+// Address versions
+const (
+	VersionKey      = 0 // a single-key wallet; the hash is WalletIDFromPub's
+	VersionMultisig = 1 // a multisig policy; the hash is multisig.Policy.Address's
+)
+
+// multisigPrefix starts the legacy form of multisig wallet IDs
+const multisigPrefix = "ms"
+
+// Address is a decoded address
+type Address struct {
+	Prefix  string
+	Version int
+	Hash    []byte // 32 bytes
+}
+
+// String encodes the address in Bech32m
+func (a Address) String() string {
+	data, _ := convertBits(a.Hash, 8, 5, true)
+	return encodeBech32m(a.Prefix, append([]byte{byte(a.Version)}, data...))
+}
+
+// WalletID is the internal wallet ID the address stands for
+func (a Address) WalletID() string {
+	id := hex.EncodeToString(a.Hash)
+	if a.Version == VersionMultisig {
+		return multisigPrefix + id
+	}
+	return id
+}
+
+// ValidPrefix reports whether p can be used as a network prefix: 1 to 16
+// lower-case letters
+func ValidPrefix(p string) bool {
+	if len(p) == 0 || len(p) > 16 {
+		return false
+	}
+	for _, c := range p {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromWalletID returns the address of an internal wallet ID on the network
+// with the given prefix
+func FromWalletID(prefix, walletID string) (Address, error) {
+	if !ValidPrefix(prefix) {
+		return Address{}, fmt.Errorf("invalid network prefix %q", prefix)
+	}
+	version, hexID := VersionKey, walletID
+	if strings.HasPrefix(walletID, multisigPrefix) {
+		version, hexID = VersionMultisig, walletID[len(multisigPrefix):]
+	}
+	hash, err := hex.DecodeString(hexID)
+	if err != nil || len(hash) != sha256.Size {
+		return Address{}, fmt.Errorf("%q is not a wallet ID", walletID)
+	}
+	return Address{Prefix: prefix, Version: version, Hash: hash}, nil
+}
+
+// Encode returns the address string of an internal wallet ID
+func Encode(prefix, walletID string) (string, error) {
+	a, err := FromWalletID(prefix, walletID)
+	if err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+// Parse decodes a Bech32m address of any network. Upper case is accepted,
+// for addresses read out or put in QR codes.
+func Parse(s string) (Address, error) {
+	hrp, data, err := decodeBech32m(strings.TrimSpace(s))
+	if err != nil {
+		return Address{}, err
+	}
+	if !ValidPrefix(hrp) {
+		return Address{}, fmt.Errorf("invalid network prefix %q", hrp)
+	}
+	if len(data) == 0 {
+		return Address{}, errors.New("address has no data")
+	}
+	version := int(data[0])
+	if version != VersionKey && version != VersionMultisig {
+		return Address{}, fmt.Errorf("unknown address version %d", version)
+	}
+	hash, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(hash) != sha256.Size {
+		return Address{}, fmt.Errorf("address holds %d bytes, want %d", len(hash), sha256.Size)
+	}
+	return Address{Prefix: hrp, Version: version, Hash: hash}, nil
+}
+
+// Validate parses s and checks that it belongs to the network with the
+// given prefix
+func Validate(prefix, s string) (Address, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return a, err
+	}
+	if a.Prefix != prefix {
+		return a, fmt.Errorf("address is for network %q, not %q", a.Prefix, prefix)
+	}
+	return a, nil
+}
+
+// IsLegacy reports whether s is an internal wallet ID in its raw hex form
+func IsLegacy(s string) bool {
+	s = strings.TrimPrefix(s, multisigPrefix)
+	if len(s) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Normalize turns user input into an internal wallet ID. It takes an
+// address of the given network or, during the transition, a legacy hex ID,
+// in either case. Anything else is an error.
+func Normalize(prefix, s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if IsLegacy(strings.ToLower(s)) {
+		return strings.ToLower(s), nil
+	}
+	a, err := Validate(prefix, s)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %w", err)
+	}
+	return a.WalletID(), nil
+}
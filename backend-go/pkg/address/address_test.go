@@ -0,0 +1,118 @@
+package address
+
+import (
+	"strings"
+	"testing"
+)
+
+// Valid Bech32m strings from BIP 350
+func TestBech32mVectors(t *testing.T) {
+	for _, s := range []string{
+		"A1LQFN3A",
+		"a1lqfn3a",
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+		"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		"?1v759aa",
+	} {
+		hrp, data, err := decodeBech32m(s)
+		if err != nil {
+			t.Errorf("decode %q: %v", s, err)
+			continue
+		}
+		if got := encodeBech32m(hrp, data); got != strings.ToLower(s) {
+			t.Errorf("re-encode %q = %q", s, got)
+		}
+	}
+	for _, s := range []string{"a1lqfn3", "A1lqfn3a", "abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryy", "1qzzfhee"} {
+		if _, _, err := decodeBech32m(s); err == nil {
+			t.Errorf("decode %q succeeded", s)
+		}
+	}
+}
+
+const keyID = "e884ae70b7553e2b59ca99ad028f5ab8347d56854714283626f4437569545be4"
+
+func TestEncodeParseRoundTrip(t *testing.T) {
+	for _, id := range []string{keyID, "ms" + keyID} {
+		s, err := Encode(MainPrefix, id)
+		if err != nil {
+			t.Fatalf("Encode(%s): %v", id, err)
+		}
+		if !strings.HasPrefix(s, "cw1") || len(s) != 62 {
+			t.Fatalf("Encode(%s) = %q", id, s)
+		}
+		a, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", s, err)
+		}
+		if a.WalletID() != id || a.Prefix != MainPrefix {
+			t.Fatalf("Parse(%s) = %+v", s, a)
+		}
+		if upper, err := Parse(strings.ToUpper(s)); err != nil || upper.WalletID() != id {
+			t.Fatalf("Parse upper-case = %+v, %v", upper, err)
+		}
+	}
+	if _, err := Encode(MainPrefix, "zakat-pool-system"); err == nil {
+		t.Fatal("encoded a non-hex wallet ID")
+	}
+	if _, err := Encode("CW", keyID); err == nil {
+		t.Fatal("encoded under an upper-case prefix")
+	}
+}
+
+func TestParseCatchesTypos(t *testing.T) {
+	s, _ := Encode(MainPrefix, keyID)
+	for i := len(MainPrefix) + 1; i < len(s); i++ {
+		for _, c := range charset {
+			if byte(c) == s[i] {
+				continue
+			}
+			typo := s[:i] + string(c) + s[i+1:]
+			if _, err := Parse(typo); err == nil {
+				t.Fatalf("typo at %d (%q) parsed", i, typo)
+			}
+		}
+	}
+	swapped := s[:10] + string(s[11]) + string(s[10]) + s[12:]
+	if swapped != s {
+		if _, err := Parse(swapped); err == nil {
+			t.Fatal("swapped characters parsed")
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	addr, _ := Encode(MainPrefix, keyID)
+	test, _ := Encode(TestPrefix, keyID)
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{addr, keyID, true},
+		{" " + strings.ToUpper(addr) + " ", keyID, true},
+		{keyID, keyID, true},
+		{strings.ToUpper(keyID), keyID, true},
+		{"ms" + keyID, "ms" + keyID, true},
+		{test, "", false},       // another network
+		{keyID[:63], "", false}, // short legacy ID
+		{"alice", "", false},    // not an address
+		{flipLast(addr), "", false},
+	}
+	for _, c := range cases {
+		got, err := Normalize(MainPrefix, c.in)
+		if c.ok && (err != nil || got != c.want) {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", c.in, got, err, c.want)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("Normalize(%q) = %q, want an error", c.in, got)
+		}
+	}
+}
+
+func flipLast(s string) string {
+	last := "q"
+	if s[len(s)-1] == 'q' {
+		last = "p"
+	}
+	return s[:len(s)-1] + last
+}
@@ -0,0 +1,136 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The Bech32m encoding of BIP 350: a human-readable prefix, the separator
+// "1", then data in a 32-character alphabet ending in a six-character
+// checksum. The checksum detects any error in up to four characters.
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32mConst is what the checksum polymod of a valid Bech32m string is
+const bech32mConst = 0x2bc830a3
+
+// maxLength is the longest string Bech32m is specified for
+const maxLength = 90
+
+var charsetRev = func() [128]int8 {
+	var rev [128]int8
+	for i := range rev {
+		rev[i] = -1
+	}
+	for i, c := range charset {
+		rev[c] = int8(i)
+	}
+	return rev
+}()
+
+func polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// encodeBech32m encodes 5-bit values under a lower-case prefix
+func encodeBech32m(hrp string, data []byte) string {
+	values := append(hrpExpand(hrp), data...)
+	mod := polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ bech32mConst
+	var b strings.Builder
+	b.Grow(len(hrp) + 1 + len(data) + 6)
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(charset[(mod>>(5*(5-i)))&31])
+	}
+	return b.String()
+}
+
+// decodeBech32m splits a Bech32m string into its prefix and 5-bit values,
+// checksum removed. Mixed case is refused, as the specification requires.
+func decodeBech32m(s string) (string, []byte, error) {
+	if len(s) > maxLength {
+		return "", nil, errors.New("address too long")
+	}
+	lower, upper := strings.ToLower(s), strings.ToUpper(s)
+	if s != lower && s != upper {
+		return "", nil, errors.New("address mixes upper and lower case")
+	}
+	s = lower
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errors.New("address has no prefix or is too short")
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, errors.New("address prefix has an invalid character")
+		}
+	}
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		c := s[i]
+		if c >= 128 || charsetRev[c] < 0 {
+			return "", nil, fmt.Errorf("address has an invalid character %q", c)
+		}
+		data = append(data, byte(charsetRev[c]))
+	}
+	if polymod(append(hrpExpand(hrp), data...)) != bech32mConst {
+		return "", nil, errors.New("address checksum does not match; check it for typos")
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+// convertBits regroups a bit stream from groups of from bits into groups of
+// to bits. When decoding (pad false) leftover bits must be zero padding.
+func convertBits(in []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<to - 1
+	out := make([]byte, 0, len(in)*int(from)/int(to)+1)
+	for _, v := range in {
+		if uint(v)>>from != 0 {
+			return nil, errors.New("invalid data value")
+		}
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
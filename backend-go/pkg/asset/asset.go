@@ -0,0 +1,106 @@
+// Package asset describes custom tokens issued on the chain alongside the
+// native coin. Outputs carry the ID of the asset they hold; the native coin
+// has the empty ID. New units of an asset only come from issuance
+// transactions signed by its issuer key.
+package asset
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"blockchain-wallet/pkg/crypto"
+)
+
+// Native is the asset ID of the chain's own coin
+const Native = ""
+
+// MaxSymbolLen is the longest ticker symbol an asset may have
+const MaxSymbolLen = 12
+
+// MaxZakatBPS is the highest Zakat rate, in basis points, an asset may set
+const MaxZakatBPS = 10000
+
+// Asset is a registered token
+type Asset struct {
+	ID        string            `json:"asset_id"`
+	Symbol    string            `json:"symbol"`
+	Name      string            `json:"name"`
+	IssuerKey ed25519.PublicKey `json:"issuer_key"` // base64 in JSON
+	ZakatBPS  int64             `json:"zakat_bps"`  // charged by the Zakat run; 0 exempts the asset
+	Supply    int64             `json:"supply"`     // total issued
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// ID derives an asset's ID from its issuer key and symbol, so an issuer
+// cannot register the same symbol twice and nobody else can take it
+func ID(issuer ed25519.PublicKey, symbol string) string {
+	h := sha256.Sum256(append(append([]byte("asset|"), issuer...), symbol...))
+	return hex.EncodeToString(h[:16])
+}
+
+// ValidSymbol checks that s is 1 to MaxSymbolLen upper-case letters or digits
+func ValidSymbol(s string) error {
+	if s == "" || len(s) > MaxSymbolLen {
+		return fmt.Errorf("symbol must be 1 to %d characters", MaxSymbolLen)
+	}
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return errors.New("symbol may only contain A-Z and 0-9")
+		}
+	}
+	return nil
+}
+
+// ValidZakatBPS checks that a Zakat rate is within 0 and MaxZakatBPS
+func ValidZakatBPS(bps int64) error {
+	if bps < 0 || bps > MaxZakatBPS {
+		return fmt.Errorf("zakat_bps must be between 0 and %d", MaxZakatBPS)
+	}
+	return nil
+}
+
+// Validate checks that the asset is well formed and its ID matches its
+// issuer key and symbol
+func (a *Asset) Validate() error {
+	if err := ValidSymbol(a.Symbol); err != nil {
+		return err
+	}
+	if len(a.IssuerKey) != ed25519.PublicKeySize {
+		return errors.New("issuer key must be 32 bytes")
+	}
+	if a.ID != ID(a.IssuerKey, a.Symbol) {
+		return errors.New("asset ID does not match issuer key and symbol")
+	}
+	return ValidZakatBPS(a.ZakatBPS)
+}
+
+// Zakat returns the Zakat due on balance units of the asset, rounded down
+func (a *Asset) Zakat(balance int64) int64 {
+	if balance <= 0 {
+		return 0
+	}
+	return balance * a.ZakatBPS / MaxZakatBPS
+}
+
+// ConfigPayload is what the issuer signs to register an asset or change
+// its Zakat rate. The timestamp keeps an old signature from being replayed
+// to restore an earlier rate.
+func ConfigPayload(assetID string, zakatBPS, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("asset:config:%s:%d:%d", assetID, zakatBPS, timestamp))
+}
+
+// VerifyIssuer checks that sig over payload was made by the asset's issuer
+func (a *Asset) VerifyIssuer(pub ed25519.PublicKey, payload, sig []byte) error {
+	if !bytes.Equal(pub, a.IssuerKey) {
+		return errors.New("key is not the asset's issuer key")
+	}
+	if !crypto.VerifySignature(pub, payload, sig) {
+		return errors.New("issuer signature invalid")
+	}
+	return nil
+}
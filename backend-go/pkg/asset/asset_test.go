@@ -0,0 +1,67 @@
+package asset
+
+import (
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+)
+
+func TestAssetValidate(t *testing.T) {
+	_, pub, _ := crypto.GenerateKeypair()
+	_, other, _ := crypto.GenerateKeypair()
+	valid := func() Asset {
+		return Asset{ID: ID(pub, "PTS"), Symbol: "PTS", IssuerKey: pub, ZakatBPS: 250}
+	}
+	if a := valid(); a.Validate() != nil {
+		t.Fatalf("valid asset rejected: %v", a.Validate())
+	}
+	if ID(pub, "PTS") == ID(other, "PTS") || ID(pub, "PTS") == ID(pub, "VCH") {
+		t.Error("asset IDs should differ by issuer and symbol")
+	}
+
+	cases := map[string]func(a *Asset){
+		"empty symbol":     func(a *Asset) { a.Symbol = "" },
+		"lower-case":       func(a *Asset) { a.Symbol = "pts"; a.ID = ID(pub, "pts") },
+		"long symbol":      func(a *Asset) { a.Symbol = "ABCDEFGHIJKLM"; a.ID = ID(pub, a.Symbol) },
+		"short key":        func(a *Asset) { a.IssuerKey = pub[:16] },
+		"other issuer":     func(a *Asset) { a.IssuerKey = other },
+		"negative zakat":   func(a *Asset) { a.ZakatBPS = -1 },
+		"zakat above 100%": func(a *Asset) { a.ZakatBPS = MaxZakatBPS + 1 },
+	}
+	for name, mutate := range cases {
+		a := valid()
+		mutate(&a)
+		if a.Validate() == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAssetZakat(t *testing.T) {
+	a := Asset{ZakatBPS: 250}
+	for balance, want := range map[int64]int64{1000: 25, 39: 0, 40: 1, 0: 0, -5: 0} {
+		if got := a.Zakat(balance); got != want {
+			t.Errorf("Zakat(%d) = %d, want %d", balance, got, want)
+		}
+	}
+	if got := (&Asset{}).Zakat(1000); got != 0 {
+		t.Errorf("exempt asset charged %d", got)
+	}
+}
+
+func TestVerifyIssuer(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	otherPriv, other, _ := crypto.GenerateKeypair()
+	a := Asset{ID: ID(pub, "PTS"), Symbol: "PTS", IssuerKey: pub}
+	payload := ConfigPayload(a.ID, 100, 1700000000)
+
+	if err := a.VerifyIssuer(pub, payload, crypto.SignPayload(priv, payload)); err != nil {
+		t.Errorf("issuer signature rejected: %v", err)
+	}
+	if a.VerifyIssuer(other, payload, crypto.SignPayload(otherPriv, payload)) == nil {
+		t.Error("signature by another key accepted")
+	}
+	if a.VerifyIssuer(pub, ConfigPayload(a.ID, 0, 1700000000), crypto.SignPayload(priv, payload)) == nil {
+		t.Error("signature over a different rate accepted")
+	}
+}
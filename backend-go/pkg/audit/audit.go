@@ -0,0 +1,206 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit event types. The set is fixed; Record rejects anything else.
+const (
+	LoginSuccess = "login_success"
+	LoginFailed  = "login_failed"
+	OTPFailed    = "otp_failed"
+	KeyAccess    = "key_access"
+	KeyRecovery  = "key_recovery"
+	AdminAction  = "admin_action"
+	BlockMined   = "block_mined"
+)
+
+var eventTypes = map[string]bool{
+	LoginSuccess: true,
+	LoginFailed:  true,
+	OTPFailed:    true,
+	KeyAccess:    true,
+	KeyRecovery:  true,
+	AdminAction:  true,
+	BlockMined:   true,
+}
+
+// EventTypes lists every valid event type
+func EventTypes() []string {
+	return []string{LoginSuccess, LoginFailed, OTPFailed, KeyAccess, KeyRecovery, AdminAction, BlockMined}
+}
+
+// ValidType reports whether t is one of the audit event types
+func ValidType(t string) bool {
+	return eventTypes[t]
+}
+
+// GenesisHash is the previous hash of the first entry in the log
+var GenesisHash = strings.Repeat("0", 64)
+
+// Event is something worth auditing, before it is placed in the chain
+type Event struct {
+	Type      string `json:"type"`
+	Actor     string `json:"actor"`   // wallet, email or "system" that caused the event
+	Subject   string `json:"subject"` // what the event acted on, if anything
+	Details   string `json:"details"`
+	IPAddress string `json:"ip_address"`
+}
+
+// Entry is an event sealed into the hash chain
+type Entry struct {
+	Seq int64 `json:"seq"`
+	Event
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// Filter narrows a listing of the audit log. Zero values do not filter.
+type Filter struct {
+	Type  string
+	Actor string
+	From  *time.Time // inclusive
+	To    *time.Time // exclusive
+}
+
+// Store persists the audit log. AppendAudit must read the chain head and
+// insert the sealed entry atomically.
+type Store interface {
+	AppendAudit(ctx context.Context, ev Event) (*Entry, error)
+	ListAudit(ctx context.Context, f Filter, afterSeq int64, limit int) ([]Entry, error)
+}
+
+// Seal places ev after prev (nil for the first entry) and computes its hash.
+// Timestamps are kept to millisecond precision so they survive storage.
+func Seal(prev *Entry, ev Event, now time.Time) Entry {
+	e := Entry{
+		Seq:       1,
+		Event:     ev,
+		CreatedAt: now.UTC().Truncate(time.Millisecond),
+		PrevHash:  GenesisHash,
+	}
+	if prev != nil {
+		e.Seq = prev.Seq + 1
+		e.PrevHash = prev.Hash
+	}
+	e.Hash = ComputeHash(e)
+	return e
+}
+
+// ComputeHash returns the SHA-256 of the entry's content and previous hash.
+// Every field is length-prefixed so that values cannot run into each other.
+func ComputeHash(e Entry) string {
+	h := sha256.New()
+	for _, field := range []string{
+		e.PrevHash,
+		strconv.FormatInt(e.Seq, 10),
+		e.Type,
+		e.Actor,
+		e.Subject,
+		e.Details,
+		e.IPAddress,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	} {
+		writeField(h, field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeField(h hash.Hash, s string) {
+	fmt.Fprintf(h, "%d:%s", len(s), s)
+}
+
+// ChainError describes the first entry that does not fit the chain
+type ChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit log broken at seq %d: %s", e.Seq, e.Reason)
+}
+
+// Verify checks that entries follow prev (nil at the start of the log) without
+// gaps and that each hash matches its content
+func Verify(prev *Entry, entries []Entry) error {
+	for i := range entries {
+		e := &entries[i]
+		wantSeq, wantPrev := int64(1), GenesisHash
+		if prev != nil {
+			wantSeq, wantPrev = prev.Seq+1, prev.Hash
+		}
+		switch {
+		case e.Seq != wantSeq:
+			return &ChainError{Seq: e.Seq, Reason: fmt.Sprintf("expected seq %d", wantSeq)}
+		case e.PrevHash != wantPrev:
+			return &ChainError{Seq: e.Seq, Reason: "previous hash does not match"}
+		case e.Hash != ComputeHash(*e):
+			return &ChainError{Seq: e.Seq, Reason: "hash does not match content"}
+		}
+		prev = e
+	}
+	return nil
+}
+
+// VerifyStore walks the whole log in pages and returns the number of entries
+// checked and the head hash
+func VerifyStore(ctx context.Context, s Store, pageSize int) (int64, string, error) {
+	var prev *Entry
+	var checked int64
+	for {
+		page, err := s.ListAudit(ctx, Filter{}, checked, pageSize)
+		if err != nil {
+			return checked, "", err
+		}
+		if err := Verify(prev, page); err != nil {
+			return checked, "", err
+		}
+		if len(page) == 0 {
+			break
+		}
+		checked += int64(len(page))
+		prev = &page[len(page)-1]
+		if len(page) < pageSize {
+			break
+		}
+	}
+	head := GenesisHash
+	if prev != nil {
+		head = prev.Hash
+	}
+	return checked, head, nil
+}
+
+// Recorder appends events on behalf of the application. Failures are logged
+// rather than returned so that auditing never blocks the audited action.
+type Recorder struct {
+	store Store
+}
+
+// NewRecorder returns a recorder writing to s; a nil store records nothing
+func NewRecorder(s Store) *Recorder {
+	return &Recorder{store: s}
+}
+
+// Record appends ev to the audit log
+func (r *Recorder) Record(ctx context.Context, ev Event) {
+	if r == nil || r.store == nil {
+		return
+	}
+	if !ValidType(ev.Type) {
+		log.Printf("⚠️  Ignoring unknown audit event type %q", ev.Type)
+		return
+	}
+	if _, err := r.store.AppendAudit(ctx, ev); err != nil {
+		log.Printf("⚠️  Failed to record audit event %s: %v", ev.Type, err)
+	}
+}
@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memStore keeps the audit log in memory
+type memStore struct {
+	entries []Entry
+	now     time.Time
+}
+
+func (m *memStore) AppendAudit(ctx context.Context, ev Event) (*Entry, error) {
+	var prev *Entry
+	if len(m.entries) > 0 {
+		prev = &m.entries[len(m.entries)-1]
+	}
+	m.now = m.now.Add(time.Second)
+	e := Seal(prev, ev, m.now)
+	m.entries = append(m.entries, e)
+	return &e, nil
+}
+
+func (m *memStore) ListAudit(ctx context.Context, f Filter, afterSeq int64, limit int) ([]Entry, error) {
+	var out []Entry
+	for _, e := range m.entries {
+		if e.Seq > afterSeq && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func newLog(t *testing.T, n int) *memStore {
+	t.Helper()
+	m := &memStore{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	rec := NewRecorder(m)
+	for i := 0; i < n; i++ {
+		rec.Record(context.Background(), Event{Type: LoginSuccess, Actor: "wallet", IPAddress: "127.0.0.1"})
+	}
+	return m
+}
+
+func TestSealChainsEntries(t *testing.T) {
+	m := newLog(t, 3)
+	if len(m.entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(m.entries))
+	}
+	if m.entries[0].Seq != 1 || m.entries[0].PrevHash != GenesisHash {
+		t.Errorf("first entry = %+v", m.entries[0])
+	}
+	for i := 1; i < 3; i++ {
+		if m.entries[i].PrevHash != m.entries[i-1].Hash {
+			t.Errorf("entry %d does not link to its predecessor", i)
+		}
+	}
+	if err := Verify(nil, m.entries); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(m *memStore)
+		seq    int64
+	}{
+		{"edited details", func(m *memStore) { m.entries[1].Details = "nothing to see" }, 2},
+		{"deleted entry", func(m *memStore) { m.entries = append(m.entries[:1], m.entries[2:]...) }, 3},
+		{"rehashed entry", func(m *memStore) {
+			m.entries[1].Actor = "someone else"
+			m.entries[1].Hash = ComputeHash(m.entries[1])
+		}, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newLog(t, 4)
+			tc.tamper(m)
+
+			_, _, err := VerifyStore(context.Background(), m, 2)
+			var ce *ChainError
+			if !errors.As(err, &ce) {
+				t.Fatalf("VerifyStore error = %v, want ChainError", err)
+			}
+			if ce.Seq != tc.seq {
+				t.Errorf("broken at seq %d, want %d", ce.Seq, tc.seq)
+			}
+		})
+	}
+}
+
+func TestVerifyStore(t *testing.T) {
+	m := newLog(t, 5)
+	n, head, err := VerifyStore(context.Background(), m, 2)
+	if err != nil {
+		t.Fatalf("VerifyStore: %v", err)
+	}
+	if n != 5 || head != m.entries[4].Hash {
+		t.Errorf("VerifyStore = %d, %s", n, head)
+	}
+
+	n, head, err = VerifyStore(context.Background(), &memStore{}, 2)
+	if err != nil || n != 0 || head != GenesisHash {
+		t.Errorf("empty log = %d, %s, %v", n, head, err)
+	}
+}
+
+func TestRecorderRejectsUnknownTypes(t *testing.T) {
+	m := &memStore{}
+	NewRecorder(m).Record(context.Background(), Event{Type: "coffee_break"})
+	if len(m.entries) != 0 {
+		t.Errorf("unknown event type was recorded")
+	}
+
+	// A nil store is a no-op
+	NewRecorder(nil).Record(context.Background(), Event{Type: LoginSuccess})
+}
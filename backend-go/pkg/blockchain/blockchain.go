@@ -13,6 +13,8 @@ type Block struct {
 	Index        int64
 	Timestamp    int64
 	Transactions []string // transaction IDs
+	MerkleRoot   string
+	Miner        string // address credited with the mining reward
 	PreviousHash string
 	Hash         string
 	Nonce        int64
@@ -44,6 +46,7 @@ func (b *Block) MineBlock(difficulty int) {
 type Blockchain struct {
 	mu            sync.RWMutex
 	chain         []*Block
+	base          int64 // index of chain[0]; non-zero once resumed from a stored tip
 	difficulty    int
 	pendingTxs    []string
 	miningReward  int64
@@ -71,6 +74,19 @@ func NewBlockchain(difficulty int) *Blockchain {
 	return bc
 }
 
+// ResumeBlockchain continues an existing chain from its tip, so the next
+// mined block links to it and takes the following index. Blocks below the
+// tip are not held in memory.
+func ResumeBlockchain(difficulty int, tip *Block) *Blockchain {
+	return &Blockchain{
+		chain:        []*Block{tip},
+		base:         tip.Index,
+		difficulty:   difficulty,
+		pendingTxs:   make([]string, 0),
+		miningReward: 10,
+	}
+}
+
 // AddPendingTransaction adds a transaction ID to pending pool
 func (bc *Blockchain) AddPendingTransaction(txID string) {
 	bc.mu.Lock()
@@ -94,14 +110,17 @@ func (bc *Blockchain) MinePendingTransactions(minerAddress string) (*Block, erro
 
 	lastBlock := bc.chain[len(bc.chain)-1]
 	newBlock := &Block{
-		Index:        int64(len(bc.chain)),
+		Index:        bc.base + int64(len(bc.chain)),
 		Timestamp:    time.Now().Unix(),
 		Transactions: append(bc.pendingTxs, "MINING_REWARD:"+minerAddress), // add mining reward tx
+		Miner:        minerAddress,
 		PreviousHash: lastBlock.Hash,
 		Hash:         "",
 		Nonce:        0,
 	}
 
+	newBlock.MerkleRoot = MerkleRoot(newBlock.Transactions)
+
 	// Mine the block
 	newBlock.MineBlock(bc.difficulty)
 
@@ -150,6 +169,7 @@ func (bc *Blockchain) ValidateChain() bool {
 func (bc *Blockchain) GetBlockByIndex(index int64) *Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
+	index -= bc.base
 	if index < 0 || index >= int64(len(bc.chain)) {
 		return nil
 	}
@@ -166,11 +186,19 @@ func (bc *Blockchain) GetLatestBlock() *Block {
 	return bc.chain[len(bc.chain)-1]
 }
 
-// GetChainLength returns the number of blocks
+// GetChainLength returns the number of blocks, counting those below a
+// resumed tip
 func (bc *Blockchain) GetChainLength() int {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	return len(bc.chain)
+	return int(bc.base) + len(bc.chain)
+}
+
+// GetDifficulty returns the current mining difficulty
+func (bc *Blockchain) GetDifficulty() int {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.difficulty
 }
 
 // GetAllBlocks returns all blocks
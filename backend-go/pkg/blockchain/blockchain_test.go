@@ -92,3 +92,30 @@ func TestBlockchainValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestResumeBlockchain(t *testing.T) {
+	tip := &Block{Index: 7, Timestamp: 1700000000, Transactions: []string{}, PreviousHash: "00prev"}
+	tip.MineBlock(2)
+	bc := ResumeBlockchain(2, tip)
+
+	if bc.GetChainLength() != 8 {
+		t.Fatalf("chain length should count the stored blocks, got %d", bc.GetChainLength())
+	}
+	bc.AddPendingTransaction("tx1")
+	block, err := bc.MinePendingTransactions("miner-wallet")
+	if err != nil {
+		t.Fatalf("mining failed: %v", err)
+	}
+	if block.Index != 8 || block.PreviousHash != tip.Hash {
+		t.Fatalf("block should follow the tip: index %d, previous %s", block.Index, block.PreviousHash)
+	}
+	if bc.GetChainLength() != 9 || bc.GetBlockByIndex(8) != block || bc.GetBlockByIndex(7) != tip {
+		t.Fatalf("lookups should use chain heights")
+	}
+	if bc.GetBlockByIndex(6) != nil {
+		t.Fatalf("blocks below the tip are not held in memory")
+	}
+	if !bc.ValidateChain() {
+		t.Fatalf("resumed chain failed validation")
+	}
+}
@@ -0,0 +1,34 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MerkleRoot computes the SHA-256 Merkle root of a list of transaction IDs.
+// Leaves are the hashes of the IDs; an odd node at any level is paired with
+// itself. An empty list has an empty root.
+func MerkleRoot(txIDs []string) string {
+	if len(txIDs) == 0 {
+		return ""
+	}
+
+	level := make([][]byte, len(txIDs))
+	for i, id := range txIDs {
+		h := sha256.Sum256([]byte(id))
+		level[i] = h[:]
+	}
+
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([][]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			h := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, h[:])
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	if MerkleRoot(nil) != "" {
+		t.Error("empty list should have an empty root")
+	}
+
+	leaf := func(s string) []byte { h := sha256.Sum256([]byte(s)); return h[:] }
+	pair := func(a, b []byte) []byte { h := sha256.Sum256(append(append([]byte{}, a...), b...)); return h[:] }
+
+	if got, want := MerkleRoot([]string{"tx1"}), hex.EncodeToString(leaf("tx1")); got != want {
+		t.Errorf("single leaf root = %s, want %s", got, want)
+	}
+
+	ab := pair(leaf("a"), leaf("b"))
+	cc := pair(leaf("c"), leaf("c"))
+	want := hex.EncodeToString(pair(ab, cc))
+	if got := MerkleRoot([]string{"a", "b", "c"}); got != want {
+		t.Errorf("odd leaf count root = %s, want %s", got, want)
+	}
+
+	if MerkleRoot([]string{"a", "b"}) == MerkleRoot([]string{"b", "a"}) {
+		t.Error("root should depend on transaction order")
+	}
+}
+
+func TestMinedBlockHasMerkleRoot(t *testing.T) {
+	bc := NewBlockchain(1)
+	bc.AddPendingTransaction("tx1")
+	block, err := bc.MinePendingTransactions("miner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Miner != "miner" {
+		t.Errorf("miner = %q", block.Miner)
+	}
+	if block.MerkleRoot != MerkleRoot(block.Transactions) {
+		t.Error("block merkle root does not match its transactions")
+	}
+}
@@ -0,0 +1,200 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxShares is the most shares a secret can be split into; each share is a
+// distinct non-zero point of GF(256)
+const MaxShares = 255
+
+// sharePrefix starts the text form of a share and carries its version
+const sharePrefix = "wss1"
+
+// A set tag is setTagSize random bytes. Splits made before it was raised
+// have 4-byte tags, which ParseShare still accepts.
+const (
+	setTagSize       = 16
+	legacySetTagSize = 4
+)
+
+// Share is one piece of a secret split with SplitSecret. Threshold shares of
+// the same set rebuild the secret; fewer reveal nothing about it.
+type Share struct {
+	Set       string // random hex tag shared by the pieces of one split
+	Threshold int
+	Index     int // the x coordinate, 1..MaxShares
+	Data      []byte
+}
+
+// gfExp and gfLog are exponent and logarithm tables for GF(2^8) with the
+// AES polynomial x^8+x^4+x^3+x+1 and generator 3
+var gfExp, gfLog = func() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = byte(i)
+		// multiply by 3: x*2 xor x, reducing by the polynomial
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	return exp, log
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret splits secret into n shares, any k of which rebuild it. Each
+// byte is the constant term of its own random polynomial of degree k-1.
+func SplitSecret(secret []byte, n, k int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+	if k < 2 || k > n || n > MaxShares {
+		return nil, fmt.Errorf("need 2 <= threshold <= shares <= %d, got %d of %d", MaxShares, k, n)
+	}
+	tag := make([]byte, setTagSize)
+	if _, err := rand.Read(tag); err != nil {
+		return nil, err
+	}
+	set := hex.EncodeToString(tag)
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{Set: set, Threshold: k, Index: i + 1, Data: make([]byte, len(secret))}
+	}
+	coeffs := make([]byte, k)
+	for j, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's rule at x = index
+			x := byte(shares[i].Index)
+			var y byte
+			for c := k - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coeffs[c]
+			}
+			shares[i].Data[j] = y
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+	return shares, nil
+}
+
+// CombineShares rebuilds a secret from at least threshold shares of one
+// split. A wrong share still yields a secret, just not the right one, so
+// callers check the result against something they know, such as a public key.
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	first := shares[0]
+	seen := map[int]bool{}
+	for _, s := range shares {
+		if s.Set != first.Set || s.Threshold != first.Threshold {
+			return nil, errors.New("shares come from different splits")
+		}
+		if len(s.Data) != len(first.Data) || len(s.Data) == 0 {
+			return nil, errors.New("shares differ in length")
+		}
+		if s.Index < 1 || s.Index > MaxShares {
+			return nil, fmt.Errorf("share index %d out of range", s.Index)
+		}
+		if seen[s.Index] {
+			return nil, fmt.Errorf("share %d given twice", s.Index)
+		}
+		seen[s.Index] = true
+	}
+	if len(shares) < first.Threshold {
+		return nil, fmt.Errorf("need %d shares, have %d", first.Threshold, len(shares))
+	}
+	use := shares[:first.Threshold]
+
+	// Lagrange interpolation at x = 0; in GF(2^8) subtraction is xor
+	secret := make([]byte, len(first.Data))
+	for i, si := range use {
+		xi := byte(si.Index)
+		basis := byte(1)
+		for j, sj := range use {
+			if i != j {
+				xj := byte(sj.Index)
+				basis = gfMul(basis, gfDiv(xj, xj^xi))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(si.Data[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// String encodes the share for printing or sending, as
+// wss1-<set>-<threshold>-<index>-<hex data>-<checksum>. The checksum is
+// the first four bytes of SHA-256 over everything before it, so a mistyped
+// share is caught when it is parsed.
+func (s Share) String() string {
+	body := fmt.Sprintf("%s-%s-%d-%d-%s", sharePrefix, s.Set, s.Threshold, s.Index, hex.EncodeToString(s.Data))
+	return body + "-" + shareChecksum(body)
+}
+
+func shareChecksum(body string) string {
+	h := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(h[:4])
+}
+
+// ParseShare reads a share written by Share.String. Case and whitespace are
+// ignored, so a share copied from paper can be typed back in spaced out.
+func ParseShare(text string) (Share, error) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), ""))
+	parts := strings.Split(text, "-")
+	if len(parts) != 6 || parts[0] != sharePrefix {
+		return Share{}, errors.New("not a wallet share")
+	}
+	body := strings.Join(parts[:5], "-")
+	if shareChecksum(body) != parts[5] {
+		return Share{}, errors.New("share checksum does not match; check it for typos")
+	}
+	var s Share
+	var err error
+	s.Set = parts[1]
+	if len(s.Set) != 2*setTagSize && len(s.Set) != 2*legacySetTagSize {
+		return Share{}, errors.New("invalid share set")
+	}
+	if s.Threshold, err = strconv.Atoi(parts[2]); err != nil || s.Threshold < 2 || s.Threshold > MaxShares {
+		return Share{}, errors.New("invalid share threshold")
+	}
+	if s.Index, err = strconv.Atoi(parts[3]); err != nil || s.Index < 1 || s.Index > MaxShares {
+		return Share{}, errors.New("invalid share index")
+	}
+	if s.Data, err = hex.DecodeString(parts[4]); err != nil || len(s.Data) == 0 {
+		return Share{}, errors.New("invalid share data")
+	}
+	return s, nil
+}
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSplitCombineAnySubset(t *testing.T) {
+	priv, _, err := GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := priv.Seed()
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitSecret: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+	for _, idx := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var pick []Share
+		for _, i := range idx {
+			pick = append(pick, shares[i])
+		}
+		got, err := CombineShares(pick)
+		if err != nil {
+			t.Fatalf("CombineShares %v: %v", idx, err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("CombineShares %v rebuilt the wrong secret", idx)
+		}
+	}
+
+	if _, err := CombineShares(shares[:2]); err == nil {
+		t.Fatal("two shares of a 3-of-5 split combined")
+	}
+	if _, err := CombineShares([]Share{shares[0], shares[0], shares[1]}); err == nil {
+		t.Fatal("a repeated share was accepted")
+	}
+	other, _ := SplitSecret(secret, 5, 3)
+	if _, err := CombineShares([]Share{shares[0], shares[1], other[2]}); err == nil {
+		t.Fatal("shares of different splits were combined")
+	}
+}
+
+func TestSplitSecretRejectsBadParams(t *testing.T) {
+	for _, c := range []struct{ n, k int }{{3, 1}, {2, 3}, {256, 2}} {
+		if _, err := SplitSecret([]byte("secret"), c.n, c.k); err == nil {
+			t.Errorf("SplitSecret(n=%d, k=%d) succeeded", c.n, c.k)
+		}
+	}
+	if _, err := SplitSecret(nil, 3, 2); err == nil {
+		t.Error("empty secret was split")
+	}
+}
+
+func TestShareText(t *testing.T) {
+	shares, err := SplitSecret([]byte("0123456789abcdef0123456789abcdef"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares[1].Set) != 32 {
+		t.Fatalf("set tag %q is not 16 bytes", shares[1].Set)
+	}
+	text := shares[1].String()
+	if !strings.HasPrefix(text, "wss1-"+shares[1].Set+"-2-2-") {
+		t.Fatalf("unexpected share text %q", text)
+	}
+
+	// Shares from before set tags grew still parse
+	legacy := Share{Set: "0a1b2c3d", Threshold: 2, Index: 1, Data: []byte{1, 2}}
+	if s, err := ParseShare(legacy.String()); err != nil || s.Set != legacy.Set {
+		t.Fatalf("legacy share: %+v, %v", s, err)
+	}
+
+	// Spaced out and upper-cased, as copied from paper
+	var spaced strings.Builder
+	for i, r := range strings.ToUpper(text) {
+		if i > 0 && i%8 == 0 {
+			spaced.WriteString(" ")
+		}
+		spaced.WriteRune(r)
+	}
+	s, err := ParseShare(spaced.String())
+	if err != nil {
+		t.Fatalf("ParseShare: %v", err)
+	}
+	if s.Set != shares[1].Set || s.Threshold != 2 || s.Index != 2 || !bytes.Equal(s.Data, shares[1].Data) {
+		t.Fatalf("parsed %+v, want %+v", s, shares[1])
+	}
+
+	// One mistyped data digit fails the checksum
+	i := strings.LastIndex(text, "-") - 1
+	digit := "0"
+	if text[i] == '0' {
+		digit = "1"
+	}
+	typo := text[:i] + digit + text[i+1:]
+	if _, err := ParseShare(typo); err == nil {
+		t.Fatal("mistyped share parsed")
+	}
+	if _, err := ParseShare("not-a-share"); err == nil {
+		t.Fatal("garbage parsed as a share")
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"blockchain-wallet/pkg/asset"
+)
+
+// InsertAsset registers a new asset with no supply
+func (c *Client) InsertAsset(ctx context.Context, a asset.Asset) error {
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO assets (asset_id, symbol, name, issuer_key, zakat_bps) VALUES ($1, $2, $3, $4, $5)",
+		a.ID, a.Symbol, a.Name, []byte(a.IssuerKey), a.ZakatBPS,
+	)
+	return err
+}
+
+const assetColumns = "asset_id, symbol, COALESCE(name, ''), issuer_key, zakat_bps, supply, created_at"
+
+func scanAsset(row rowScanner) (asset.Asset, error) {
+	var a asset.Asset
+	var issuer []byte
+	err := row.Scan(&a.ID, &a.Symbol, &a.Name, &issuer, &a.ZakatBPS, &a.Supply, &a.CreatedAt)
+	a.IssuerKey = issuer
+	return a, err
+}
+
+// GetAsset returns an asset by ID
+func (c *Client) GetAsset(ctx context.Context, id string) (asset.Asset, error) {
+	return scanAsset(c.db.QueryRowContext(ctx, "SELECT "+assetColumns+" FROM assets WHERE asset_id = $1", id))
+}
+
+// ListAssets returns up to limit assets by symbol
+func (c *Client) ListAssets(ctx context.Context, limit int) ([]asset.Asset, error) {
+	return c.queryAssets(ctx, "SELECT "+assetColumns+" FROM assets ORDER BY symbol, asset_id LIMIT $1", limit)
+}
+
+func (c *Client) queryAssets(ctx context.Context, query string, args ...interface{}) ([]asset.Asset, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []asset.Asset
+	for rows.Next() {
+		a, err := scanAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// GetZakatAssets returns the assets that set a Zakat rate
+func (c *Client) GetZakatAssets(ctx context.Context) ([]asset.Asset, error) {
+	return c.queryAssets(ctx, "SELECT "+assetColumns+" FROM assets WHERE zakat_bps > 0 ORDER BY asset_id")
+}
+
+// SetAssetZakat changes the Zakat rate of an asset. Returns sql.ErrNoRows
+// if it does not exist.
+func (c *Client) SetAssetZakat(ctx context.Context, id string, bps int64) error {
+	res, err := c.db.ExecContext(ctx, "UPDATE assets SET zakat_bps = $1 WHERE asset_id = $2", bps, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IssueAsset records an issuance: the new output holding rec.Amount of
+// rec.Asset for the receiver, the transaction and the asset's supply, in
+// one database transaction. registerReceiver registers the receiver as an
+// external wallet first, as Transfer.RegisterReceiver does.
+func (c *Client) IssueAsset(ctx context.Context, rec TxRecord, utxoID string, registerReceiver bool) error {
+	rec.TxType = "issuance"
+	return c.inTx(ctx, func(q querier) error {
+		if registerReceiver {
+			if err := registerExternalWallet(ctx, q, rec.ReceiverWalletID); err != nil {
+				return fmt.Errorf("register receiver: %w", err)
+			}
+		}
+		res, err := q.ExecContext(ctx,
+			"UPDATE assets SET supply = supply + $1 WHERE asset_id = $2", rec.Amount, rec.Asset)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return sql.ErrNoRows
+		}
+		if err := insertUTXO(ctx, q, utxoID, rec.ReceiverWalletID, rec.Asset, rec.Amount, nil); err != nil {
+			return err
+		}
+		return insertTransaction(ctx, q, rec)
+	})
+}
+
+// GetAssetBalances returns a wallet's unspent holdings of each asset other
+// than the native coin, locked outputs included
+func (c *Client) GetAssetBalances(ctx context.Context, walletID string) (map[string]int64, error) {
+	return c.sumUTXOs(ctx,
+		`SELECT asset_id, SUM(amount) FROM utxos
+		 WHERE owner_wallet_id = $1 AND spent = FALSE AND asset_id IS NOT NULL
+		 GROUP BY asset_id`,
+		walletID)
+}
+
+// GetAssetHolders returns the unspent holdings of an asset by wallet
+func (c *Client) GetAssetHolders(ctx context.Context, assetID string) (map[string]int64, error) {
+	return c.sumUTXOs(ctx,
+		`SELECT owner_wallet_id, SUM(amount) FROM utxos
+		 WHERE asset_id = $1 AND spent = FALSE
+		 GROUP BY owner_wallet_id`,
+		assetID)
+}
+
+func (c *Client) sumUTXOs(ctx context.Context, query string, arg string) (map[string]int64, error) {
+	rows, err := c.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := map[string]int64{}
+	for rows.Next() {
+		var key string
+		var sum int64
+		if err := rows.Scan(&key, &sum); err != nil {
+			return nil, err
+		}
+		sums[key] = sum
+	}
+	return sums, rows.Err()
+}
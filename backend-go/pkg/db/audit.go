@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"blockchain-wallet/pkg/audit"
+)
+
+const auditColumns = "seq, event_type, actor, subject, details, ip_address, created_at, prev_hash, hash"
+
+func scanAudit(row rowScanner) (*audit.Entry, error) {
+	var e audit.Entry
+	err := row.Scan(&e.Seq, &e.Type, &e.Actor, &e.Subject, &e.Details, &e.IPAddress, &e.CreatedAt, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return nil, err
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+	return &e, nil
+}
+
+// AppendAudit seals ev after the current head of the audit log and stores it.
+// Appends are serialised so that two events never claim the same head.
+func (c *Client) AppendAudit(ctx context.Context, ev audit.Event) (*audit.Entry, error) {
+	var entry audit.Entry
+	err := c.inTx(ctx, func(q querier) error {
+		if c.dialect == postgresDialect {
+			if _, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('audit_log'))"); err != nil {
+				return err
+			}
+		}
+
+		head, err := scanAudit(q.QueryRowContext(ctx,
+			"SELECT "+auditColumns+" FROM audit_log ORDER BY seq DESC LIMIT 1"))
+		if err == sql.ErrNoRows {
+			head, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry = audit.Seal(head, ev, time.Now())
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO audit_log ("+auditColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			entry.Seq, entry.Type, entry.Actor, entry.Subject, entry.Details, entry.IPAddress,
+			entry.CreatedAt, entry.PrevHash, entry.Hash,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ListAudit returns up to limit audit entries matching f in chain order,
+// starting after afterSeq
+func (c *Client) ListAudit(ctx context.Context, f audit.Filter, afterSeq int64, limit int) ([]audit.Entry, error) {
+	w := &whereBuilder{}
+	w.add("seq > ?", afterSeq)
+	if f.Type != "" {
+		w.add("event_type = ?", f.Type)
+	}
+	if f.Actor != "" {
+		w.add("actor = ?", f.Actor)
+	}
+	if f.From != nil {
+		w.add("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		w.add("created_at < ?", *f.To)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+auditColumns+" FROM audit_log"+w.String()+
+			fmt.Sprintf(" ORDER BY seq LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		e, err := scanAudit(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
@@ -3,16 +3,48 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/orders"
+	"blockchain-wallet/pkg/utxo"
 )
 
-// Client wraps Supabase/PostgreSQL connection
+// Client wraps a Supabase/PostgreSQL or embedded SQLite connection
 type Client struct {
-	db *sql.DB
+	pool    *sql.DB
+	db      conn
+	dialect *dialect
+
+	// SQLite has no advisory locks; job locks are held in process
+	locksMu sync.Mutex
+	locks   map[string]bool
+}
+
+// Open connects to the backend selected by DB_DRIVER: "postgres" (default,
+// using DATABASE_URL) or "sqlite" (using the file at SQLITE_PATH)
+func Open(ctx context.Context) (*Client, error) {
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", DriverPostgres:
+		return NewClient(ctx)
+	case DriverSQLite:
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "wallet.db"
+		}
+		return NewSQLiteClient(ctx, path)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q (want postgres or sqlite)", driver)
+	}
 }
 
 // NewClient connects to Supabase PostgreSQL backend
@@ -21,22 +53,43 @@ func NewClient(ctx context.Context) (*Client, error) {
 	if dbURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL not set")
 	}
+	return connect(ctx, postgresDialect, "postgres", dbURL)
+}
+
+// NewSQLiteClient opens (creating if needed) an embedded SQLite database file
+func NewSQLiteClient(ctx context.Context, path string) (*Client, error) {
+	dsn := "file:" + path +
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	return connect(ctx, sqliteDialect, "sqlite", dsn)
+}
 
-	db, err := sql.Open("postgres", dbURL)
+func connect(ctx context.Context, d *dialect, driverName, dsn string) (*Client, error) {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	if err = db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &Client{db: db}, nil
+	return &Client{pool: db, db: conn{q: db, d: d}, dialect: d}, nil
+}
+
+// Driver reports which backend the client is connected to
+func (c *Client) Driver() string {
+	return c.dialect.name
 }
 
 // Close closes the database connection
 func (c *Client) Close() error {
-	return c.db.Close()
+	return c.pool.Close()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
 // InsertUser inserts a new user
@@ -53,51 +106,147 @@ func (c *Client) InsertUser(ctx context.Context, email, fullName, cnic string) (
 
 // InsertWallet inserts a new wallet for a user
 func (c *Client) InsertWallet(ctx context.Context, userID, walletID string, pubKey, privKeyEnc []byte) error {
-	_, err := c.db.ExecContext(
-		ctx,
-		"INSERT INTO wallets (user_id, wallet_id, public_key, private_key_encrypted) VALUES ($1, $2, $3, $4)",
-		userID, walletID, pubKey, privKeyEnc,
+	return c.inTx(ctx, func(q querier) error {
+		// an external wallet that was paid before it was registered is claimed
+		res, err := q.ExecContext(ctx,
+			`UPDATE wallets SET user_id = $1, public_key = $3, private_key_encrypted = $4
+			 WHERE wallet_id = $2 AND user_id IS NULL AND public_key = $5`,
+			userID, walletID, pubKey, privKeyEnc, []byte{},
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			return nil
+		}
+		_, err = q.ExecContext(ctx,
+			"INSERT INTO wallets (user_id, wallet_id, public_key, private_key_encrypted) VALUES ($1, $2, $3, $4)",
+			userID, walletID, pubKey, privKeyEnc,
+		)
+		return err
+	})
+}
+
+// UpdateWalletKey replaces the stored encrypted private key of a wallet
+func (c *Client) UpdateWalletKey(ctx context.Context, walletID string, privKeyEnc []byte) error {
+	res, err := c.db.ExecContext(ctx,
+		"UPDATE wallets SET private_key_encrypted = $1 WHERE wallet_id = $2",
+		privKeyEnc, walletID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const walletColumns = `id, COALESCE(user_id, ''), wallet_id, public_key, private_key_encrypted,
+	COALESCE(balance, 0), zakat_last_deducted, created_at`
+
+func scanWallet(row rowScanner) (*Wallet, error) {
+	var w Wallet
+	err := row.Scan(&w.ID, &w.UserID, &w.WalletID, &w.PublicKey, &w.PrivateKeyEncrypted,
+		&w.Balance, &w.ZakatLastDeducted, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
 }
 
 // GetWalletByID retrieves wallet by wallet_id
-func (c *Client) GetWalletByID(ctx context.Context, walletID string) (map[string]interface{}, error) {
+func (c *Client) GetWalletByID(ctx context.Context, walletID string) (*Wallet, error) {
 	row := c.db.QueryRowContext(
 		ctx,
-		"SELECT id, wallet_id, public_key, balance FROM wallets WHERE wallet_id = $1",
+		"SELECT "+walletColumns+" FROM wallets WHERE wallet_id = $1",
 		walletID,
 	)
-	var id, wid string
-	var pubKey []byte
-	var balance int64
-	err := row.Scan(&id, &wid, &pubKey, &balance)
-	if err != nil {
-		return nil, err
-	}
-	return map[string]interface{}{
-		"id":         id,
-		"wallet_id":  wid,
-		"public_key": pubKey,
-		"balance":    balance,
-	}, nil
+	return scanWallet(row)
 }
 
 // InsertUTXO inserts a new UTXO
 func (c *Client) InsertUTXO(ctx context.Context, utxoID, ownerWalletID string, amount int64) error {
-	_, err := c.db.ExecContext(
-		ctx,
-		"INSERT INTO utxos (utxo_id, owner_wallet_id, amount) VALUES ($1, $2, $3)",
-		utxoID, ownerWalletID, amount,
-	)
-	return err
+	return c.inTx(ctx, func(q querier) error {
+		return insertUTXO(ctx, q, utxoID, ownerWalletID, "", amount, nil)
+	})
+}
+
+// InsertLockedUTXO inserts a UTXO with a spending condition
+func (c *Client) InsertLockedUTXO(ctx context.Context, utxoID, ownerWalletID string, amount int64, lock utxo.Lock) error {
+	return c.inTx(ctx, func(q querier) error {
+		return insertUTXO(ctx, q, utxoID, ownerWalletID, "", amount, &lock)
+	})
+}
+
+// InsertAssetUTXO inserts a UTXO holding amount of assetID, with an
+// optional spending condition
+func (c *Client) InsertAssetUTXO(ctx context.Context, utxoID, ownerWalletID, assetID string, amount int64, lock *utxo.Lock) error {
+	return c.inTx(ctx, func(q querier) error {
+		return insertUTXO(ctx, q, utxoID, ownerWalletID, assetID, amount, lock)
+	})
+}
+
+// insertUTXO stores an output. Only native-coin outputs count towards the
+// explorer's balances and supply.
+func insertUTXO(ctx context.Context, q querier, utxoID, owner, assetID string, amount int64, lock *utxo.Lock) error {
+	var l utxo.Lock
+	if lock != nil {
+		l = *lock
+	}
+	var kind, payee, arbiter, asset *string
+	if l.Kind != "" {
+		kind = &l.Kind
+	}
+	if l.Payee != "" {
+		payee, arbiter = &l.Payee, &l.Arbiter
+	}
+	var lockScript []byte
+	if len(l.Script) > 0 {
+		lockScript = l.Script
+	}
+	if assetID != "" {
+		asset = &assetID
+	}
+	if _, err := q.ExecContext(ctx,
+		`INSERT INTO utxos (utxo_id, owner_wallet_id, amount, lock_kind, lock_height, lock_time, escrow_payee, escrow_arbiter, lock_script, asset_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		utxoID, owner, amount, kind, l.Height, l.Time, payee, arbiter, lockScript, asset,
+	); err != nil {
+		return err
+	}
+	if assetID != "" {
+		return nil
+	}
+	return addUTXOStats(ctx, q, owner, amount, 1)
+}
+
+const utxoColumns = `utxo_id, owner_wallet_id, amount, COALESCE(spent, FALSE),
+	COALESCE(spent_in_tx_id, ''), created_at, spent_at,
+	COALESCE(lock_kind, ''), lock_height, lock_time, COALESCE(escrow_payee, ''), COALESCE(escrow_arbiter, ''), lock_script,
+	COALESCE(asset_id, '')`
+
+func scanUTXO(row rowScanner) (*UTXO, error) {
+	var u UTXO
+	var l utxo.Lock
+	var lockScript []byte
+	err := row.Scan(&u.UTXOID, &u.Owner, &u.Amount, &u.Spent, &u.SpentInTxID, &u.CreatedAt, &u.SpentAt,
+		&l.Kind, &l.Height, &l.Time, &l.Payee, &l.Arbiter, &lockScript, &u.Asset)
+	if err != nil {
+		return nil, err
+	}
+	if l.Kind != "" {
+		l.Script = lockScript
+		u.Lock = &l
+	}
+	return &u, nil
 }
 
 // GetUnspentUTXOs retrieves unspent UTXOs for a wallet
-func (c *Client) GetUnspentUTXOs(ctx context.Context, walletID string) ([]map[string]interface{}, error) {
+func (c *Client) GetUnspentUTXOs(ctx context.Context, walletID string) ([]UTXO, error) {
 	rows, err := c.db.QueryContext(
 		ctx,
-		"SELECT utxo_id, amount FROM utxos WHERE owner_wallet_id = $1 AND spent = FALSE",
+		"SELECT "+utxoColumns+" FROM utxos WHERE owner_wallet_id = $1 AND spent = FALSE ORDER BY created_at",
 		walletID,
 	)
 	if err != nil {
@@ -105,111 +254,217 @@ func (c *Client) GetUnspentUTXOs(ctx context.Context, walletID string) ([]map[st
 	}
 	defer rows.Close()
 
-	var utxos []map[string]interface{}
+	var utxos []UTXO
 	for rows.Next() {
-		var utxoID string
-		var amount int64
-		if err := rows.Scan(&utxoID, &amount); err != nil {
+		u, err := scanUTXO(rows)
+		if err != nil {
 			return nil, err
 		}
-		utxos = append(utxos, map[string]interface{}{
-			"utxo_id": utxoID,
-			"amount":  amount,
-		})
+		utxos = append(utxos, *u)
 	}
 	return utxos, rows.Err()
 }
 
-// GetBalance returns the total balance for a wallet
+// GetBalance returns the total native-coin balance for a wallet
 func (c *Client) GetBalance(ctx context.Context, walletID string) (int64, error) {
 	var balance int64
 	err := c.db.QueryRowContext(
 		ctx,
-		"SELECT COALESCE(SUM(amount), 0) FROM utxos WHERE owner_wallet_id = $1 AND spent = FALSE",
+		"SELECT COALESCE(SUM(amount), 0) FROM utxos WHERE owner_wallet_id = $1 AND spent = FALSE AND asset_id IS NULL",
 		walletID,
 	).Scan(&balance)
 	return balance, err
 }
 
 // GetUTXOByID retrieves a single UTXO by its ID
-func (c *Client) GetUTXOByID(ctx context.Context, utxoID string) (map[string]interface{}, error) {
+func (c *Client) GetUTXOByID(ctx context.Context, utxoID string) (*UTXO, error) {
 	row := c.db.QueryRowContext(
 		ctx,
-		"SELECT utxo_id, owner_wallet_id, amount, spent FROM utxos WHERE utxo_id = $1",
+		"SELECT "+utxoColumns+" FROM utxos WHERE utxo_id = $1",
 		utxoID,
 	)
-	var id, owner string
-	var amount int64
-	var spent bool
-	err := row.Scan(&id, &owner, &amount, &spent)
-	if err != nil {
-		return nil, err
-	}
-	return map[string]interface{}{
-		"utxo_id": id,
-		"owner":   owner,
-		"amount":  amount,
-		"spent":   spent,
-	}, nil
+	return scanUTXO(row)
 }
 
 // InsertTransaction inserts a new transaction
-func (c *Client) InsertTransaction(ctx context.Context, txID, senderID, receiverID string, amount int64, note string, sig []byte, senderPub []byte, ip string) error {
+func (c *Client) InsertTransaction(ctx context.Context, rec TxRecord) error {
+	return c.inTx(ctx, func(q querier) error {
+		return insertTransaction(ctx, q, rec)
+	})
+}
+
+func insertTransaction(ctx context.Context, q querier, rec TxRecord) error {
+	txType := rec.TxType
+	if txType == "" {
+		txType = "transfer"
+	}
+	var asset *string
+	if rec.Asset != "" {
+		asset = &rec.Asset
+	}
 	// Updates for new schema: sender_public_key, ip_address
-	_, err := c.db.ExecContext(
+	if _, err := q.ExecContext(
 		ctx,
-		"INSERT INTO transactions (tx_id, sender_wallet_id, receiver_wallet_id, amount, note, signature, sender_public_key, ip_address) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		txID, senderID, receiverID, amount, note, sig, senderPub, ip,
-	)
-	return err
+		"INSERT INTO transactions (tx_id, sender_wallet_id, receiver_wallet_id, amount, note, signature, sender_public_key, ip_address, tx_type, asset_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		rec.TxID, rec.SenderWalletID, rec.ReceiverWalletID, rec.Amount, rec.Note, rec.Signature, rec.SenderPublicKey, rec.IPAddress, txType, asset,
+	); err != nil {
+		return err
+	}
+	return addTxStats(ctx, q, rec)
+}
+
+// txColumns select a transaction with its containing block (if mined) and
+// its confirmations: the height of the stored chain above that block, the
+// block included. Use with txFrom.
+const txColumns = `t.tx_id, t.sender_wallet_id, t.receiver_wallet_id, t.amount, COALESCE(t.note, ''),
+	COALESCE(t.tx_type, 'transfer'), COALESCE(t.status, 'pending'), COALESCE(t.block_hash, ''),
+	COALESCE(t.ip_address, ''), t.created_at, t.confirmed_at, b.block_index,
+	CASE WHEN b.block_index IS NULL THEN 0
+	     ELSE (SELECT MAX(b2.block_index) FROM blocks b2) - b.block_index + 1 END,
+	COALESCE(t.asset_id, '')`
+
+const txFrom = " FROM transactions t LEFT JOIN blocks b ON b.block_hash = t.block_hash"
+
+func scanTx(row rowScanner, extra ...interface{}) (*TxRecord, error) {
+	var t TxRecord
+	dest := []interface{}{&t.TxID, &t.SenderWalletID, &t.ReceiverWalletID, &t.Amount, &t.Note,
+		&t.TxType, &t.Status, &t.BlockHash, &t.IPAddress, &t.CreatedAt, &t.ConfirmedAt,
+		&t.BlockIndex, &t.Confirmations, &t.Asset}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 // GetTransactionByID retrieves a single transaction with full details including signature
-func (c *Client) GetTransactionByID(ctx context.Context, txID string) (map[string]interface{}, error) {
+func (c *Client) GetTransactionByID(ctx context.Context, txID string) (*TxRecord, error) {
 	row := c.db.QueryRowContext(
 		ctx,
-		`SELECT tx_id, sender_wallet_id, receiver_wallet_id, amount, note, signature, sender_public_key, tx_type, status, ip_address, created_at 
-		 FROM transactions WHERE tx_id = $1`,
+		"SELECT "+txColumns+", t.signature, t.sender_public_key"+txFrom+" WHERE t.tx_id = $1",
 		txID,
 	)
-	var id, senderID, receiverID, txType, status, ipAddr, createdAt string
-	var amount int64
-	var note *string
 	var signature, senderPub []byte
-	
-	err := row.Scan(&id, &senderID, &receiverID, &amount, &note, &signature, &senderPub, &txType, &status, &ipAddr, &createdAt)
+	t, err := scanTx(row, &signature, &senderPub)
 	if err != nil {
 		return nil, err
 	}
-	
-	noteVal := ""
-	if note != nil {
-		noteVal = *note
-	}
-	
-	return map[string]interface{}{
-		"tx_id":              id,
-		"sender_wallet_id":   senderID,
-		"receiver_wallet_id": receiverID,
-		"amount":             amount,
-		"note":               noteVal,
-		"signature":          signature,
-		"sender_public_key":  senderPub,
-		"tx_type":            txType,
-		"status":             status,
-		"ip_address":         ipAddr,
-		"created_at":         createdAt,
-	}, nil
-}
-
-// SpendUTXO marks a UTXO as spent
+	t.Signature = signature
+	t.SenderPublicKey = senderPub
+	return t, nil
+}
+
+// ErrUTXOUnavailable is returned when spending a UTXO that does not exist,
+// has already been spent or is locked
+var ErrUTXOUnavailable = errors.New("utxo does not exist, is already spent or is locked")
+
+// SpendUTXO marks an unspent UTXO as spent by txID. Locked UTXOs are
+// refused; use SpendUTXOAt for those.
 func (c *Client) SpendUTXO(ctx context.Context, utxoID, txID string) error {
-	_, err := c.db.ExecContext(
-		ctx,
-		"UPDATE utxos SET spent = TRUE, spent_in_tx_id = $1, spent_at = NOW() WHERE utxo_id = $2",
-		txID, utxoID,
-	)
-	return err
+	return c.SpendUTXOAt(ctx, utxoID, txID, 0, 0)
+}
+
+// SpendUTXOAt is SpendUTXO at the given chain height and unix time, so
+// time-locked UTXOs that have matured can be spent. Escrow UTXOs are only
+// spent by SpendEscrowUTXO.
+func (c *Client) SpendUTXOAt(ctx context.Context, utxoID, txID string, height, now int64) error {
+	return c.inTx(ctx, func(q querier) error {
+		return spendUTXO(ctx, q, utxoID, txID, "", height, now)
+	})
+}
+
+// SpendEscrowUTXO marks an unspent escrow UTXO as spent by the transaction
+// releasing or refunding it. The caller checks the approvals.
+func (c *Client) SpendEscrowUTXO(ctx context.Context, utxoID, txID string) error {
+	return c.inTx(ctx, func(q querier) error {
+		return spendUTXO(ctx, q, utxoID, txID, utxo.LockEscrow, 0, 0)
+	})
+}
+
+// SpendScriptUTXO marks an unspent script-locked UTXO as spent by txID.
+// The caller runs the unlocking script.
+func (c *Client) SpendScriptUTXO(ctx context.Context, utxoID, txID string) error {
+	return c.inTx(ctx, func(q querier) error {
+		return spendUTXO(ctx, q, utxoID, txID, utxo.LockScript, 0, 0)
+	})
+}
+
+// spendUTXO spends an unspent UTXO carrying lockKind. With no lockKind the
+// UTXO must be unlocked or time-locked and matured at height and now;
+// escrow and script locks are checked by the caller.
+func spendUTXO(ctx context.Context, q querier, utxoID, txID, lockKind string, height, now int64) error {
+	cond, condArgs := "lock_kind = $3", []interface{}{lockKind}
+	if lockKind == "" {
+		cond = "(lock_kind IS NULL OR (lock_kind = $3 AND lock_height <= $4 AND lock_time <= $5))"
+		condArgs = []interface{}{utxo.LockTime, height, now}
+	}
+	var owner, asset string
+	var amount int64
+	err := q.QueryRowContext(ctx,
+		`UPDATE utxos SET spent = TRUE, spent_in_tx_id = $1, spent_at = NOW()
+		 WHERE utxo_id = $2 AND COALESCE(spent, FALSE) = FALSE AND `+cond+`
+		 RETURNING owner_wallet_id, amount, COALESCE(asset_id, '')`,
+		append([]interface{}{txID, utxoID}, condArgs...)...,
+	).Scan(&owner, &amount, &asset)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("spend %s: %w", utxoID, ErrUTXOUnavailable)
+	}
+	if err != nil {
+		return err
+	}
+	if asset != "" {
+		return nil
+	}
+	return addUTXOStats(ctx, q, owner, -amount, -1)
+}
+
+// Transfer is a transaction as it is applied to the UTXO set: the outputs
+// it spends, the outputs it creates and its record
+type Transfer struct {
+	Record  TxRecord
+	Inputs  []string
+	Outputs []*utxo.UTXO
+	// InputLock is the lock kind of the inputs: empty for unlocked outputs
+	// and time locks matured at Height and Now, or utxo.LockEscrow or
+	// utxo.LockScript, whose conditions the caller has checked
+	InputLock   string
+	Height, Now int64
+	// RegisterReceiver registers the receiver as an external wallet first,
+	// for a transfer the sender allowed to an unknown wallet
+	RegisterReceiver bool
+	// ZakatPeriod, when set, records the transfer as the sender's Zakat for
+	// that month (YYYY-MM). It fails with ErrZakatDeducted if the sender was
+	// already charged for the period in the same asset.
+	ZakatPeriod string
+}
+
+// ApplyTransfer spends a transfer's inputs, stores its outputs and records
+// it in one database transaction, so no input is spent without the outputs
+// that replace it. An input that cannot be spent fails with
+// ErrUTXOUnavailable.
+func (c *Client) ApplyTransfer(ctx context.Context, t Transfer) error {
+	return c.inTx(ctx, func(q querier) error {
+		if t.RegisterReceiver {
+			if err := registerExternalWallet(ctx, q, t.Record.ReceiverWalletID); err != nil {
+				return fmt.Errorf("register receiver: %w", err)
+			}
+		}
+		if t.ZakatPeriod != "" {
+			if err := recordZakatDeduction(ctx, q, t); err != nil {
+				return err
+			}
+		}
+		for _, in := range t.Inputs {
+			if err := spendUTXO(ctx, q, in, t.Record.TxID, t.InputLock, t.Height, t.Now); err != nil {
+				return err
+			}
+		}
+		for _, o := range t.Outputs {
+			if err := insertUTXO(ctx, q, o.ID, o.Owner, o.Asset, o.Amount, o.Lock); err != nil {
+				return fmt.Errorf("insert output %s: %w", o.ID, err)
+			}
+		}
+		return insertTransaction(ctx, q, t.Record)
+	})
 }
 
 // InsertLog inserts a system log entry
@@ -222,101 +477,121 @@ func (c *Client) InsertLog(ctx context.Context, walletID, action, details, statu
 	return err
 }
 
-// GetTransactionHistory returns transactions for a wallet
-func (c *Client) GetTransactionHistory(ctx context.Context, walletID string, limit int) ([]map[string]interface{}, error) {
+// GetLogs returns the most recent log entries, optionally for one wallet
+func (c *Client) GetLogs(ctx context.Context, walletID string, limit int) ([]LogEntry, error) {
+	return c.QueryLogs(ctx, LogFilter{WalletID: walletID}, nil, limit)
+}
+
+// GetAllWallets returns all wallets from the database
+func (c *Client) GetAllWallets(ctx context.Context) ([]Wallet, error) {
 	rows, err := c.db.QueryContext(
 		ctx,
-		`SELECT tx_id, sender_wallet_id, receiver_wallet_id, amount, tx_type, status, created_at 
-		 FROM transactions 
-		 WHERE sender_wallet_id = $1 OR receiver_wallet_id = $1 
-		 ORDER BY created_at DESC LIMIT $2`,
-		walletID, limit,
+		"SELECT "+walletColumns+" FROM wallets ORDER BY created_at DESC",
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var txs []map[string]interface{}
+	var wallets []Wallet
 	for rows.Next() {
-		var txID, senderID, receiverID, txType, status string
-		var amount int64
-		var createdAt string
-		if err := rows.Scan(&txID, &senderID, &receiverID, &amount, &txType, &status, &createdAt); err != nil {
+		w, err := scanWallet(rows)
+		if err != nil {
 			return nil, err
 		}
-		txs = append(txs, map[string]interface{}{
-			"tx_id":              txID,
-			"sender_wallet_id":   senderID,
-			"receiver_wallet_id": receiverID,
-			"amount":             amount,
-			"tx_type":            txType,
-			"status":             status,
-			"created_at":         createdAt,
-		})
+		wallets = append(wallets, *w)
 	}
-	return txs, rows.Err()
+	return wallets, rows.Err()
 }
 
-// GetAllWallets returns all wallets from the database
-func (c *Client) GetAllWallets(ctx context.Context) ([]map[string]interface{}, error) {
-	rows, err := c.db.QueryContext(
+// InsertBlock stores a mined block, links the transactions it contains and
+// marks them mined, all in one database transaction. Entries that are not
+// stored transactions (such as the mining reward) are not linked, but the
+// full entry list is kept with the block so its hash can be checked later.
+func (c *Client) InsertBlock(ctx context.Context, b *blockchain.Block) error {
+	entries, err := json.Marshal(b.Transactions)
+	if err != nil {
+		return err
+	}
+	return c.inTx(ctx, func(q querier) error {
+		var blockID string
+		err := q.QueryRowContext(ctx,
+			`INSERT INTO blocks (block_index, block_hash, previous_hash, merkle_root, nonce, difficulty, mined_at, miner_wallet_id, block_time, entries)
+			 VALUES ($1, $2, $3, $4, $5, $6, NOW(), (SELECT wallet_id FROM wallets WHERE wallet_id = $7), $8, $9)
+			 RETURNING id`,
+			b.Index, b.Hash, b.PreviousHash, b.MerkleRoot, b.Nonce, b.Difficulty, b.Miner, b.Timestamp, string(entries),
+		).Scan(&blockID)
+		if err != nil {
+			return fmt.Errorf("insert block: %w", err)
+		}
+
+		for _, txID := range b.Transactions {
+			res, err := q.ExecContext(ctx,
+				"UPDATE transactions SET status = $1, block_hash = $2, confirmed_at = NOW() WHERE tx_id = $3 AND block_hash IS NULL",
+				TxStatusMined, b.Hash, txID,
+			)
+			if err != nil {
+				return fmt.Errorf("mark %s mined: %w", txID, err)
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			if _, err := q.ExecContext(ctx,
+				"INSERT INTO block_transactions (block_id, tx_id) VALUES ($1, $2)",
+				blockID, txID,
+			); err != nil {
+				return fmt.Errorf("link %s: %w", txID, err)
+			}
+		}
+		return addBlockStats(ctx, q, b)
+	})
+}
+
+// GetBlockByHash retrieves a stored block header and its linked transactions
+func (c *Client) GetBlockByHash(ctx context.Context, hash string) (*BlockRecord, error) {
+	var b BlockRecord
+	err := c.db.QueryRowContext(
 		ctx,
-		`SELECT id, user_id, wallet_id, balance, zakat_last_deducted, created_at 
-		 FROM wallets 
-		 ORDER BY created_at DESC`,
+		`SELECT id, block_index, block_hash, previous_hash, COALESCE(merkle_root, ''), nonce,
+		        COALESCE(difficulty, 0), mined_at, COALESCE(miner_wallet_id, '')
+		 FROM blocks WHERE block_hash = $1`,
+		hash,
+	).Scan(&b.ID, &b.Index, &b.Hash, &b.PreviousHash, &b.MerkleRoot, &b.Nonce, &b.Difficulty, &b.MinedAt, &b.MinerWalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT tx_id FROM block_transactions WHERE block_id = $1 ORDER BY tx_id",
+		b.ID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-
-	var wallets []map[string]interface{}
 	for rows.Next() {
-		var id, userID, walletID string
-		var balance int64
-		var zakatLastDeducted *string
-		var createdAt string
-
-		if err := rows.Scan(&id, &userID, &walletID, &balance, &zakatLastDeducted, &createdAt); err != nil {
+		var txID string
+		if err := rows.Scan(&txID); err != nil {
 			return nil, err
 		}
-		wallets = append(wallets, map[string]interface{}{
-			"id":                  id,
-			"user_id":             userID,
-			"wallet_id":           walletID,
-			"balance":             balance,
-			"zakat_last_deducted": zakatLastDeducted,
-			"created_at":          createdAt,
-		})
+		b.TxIDs = append(b.TxIDs, txID)
 	}
-	return wallets, rows.Err()
+	b.TxCount = int64(len(b.TxIDs))
+	return &b, rows.Err()
 }
 
-// InsertBlock stores a mined block in the database
-func (c *Client) InsertBlock(ctx context.Context, block interface{}) error {
-	// Type assert to blockchain.Block
-	b, ok := block.(*struct {
-		Index        int64
-		Timestamp    int64
-		Transactions interface{}
-		PreviousHash string
-		Hash         string
-		Nonce        int64
-		Difficulty   int
-	})
-	if !ok {
-		return fmt.Errorf("invalid block type")
+// inTx runs fn in a database transaction, committing if it returns nil
+func (c *Client) inTx(ctx context.Context, fn func(q querier) error) error {
+	sqlTx, err := c.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer sqlTx.Rollback()
 
-	// Updated for new schema: block_index added
-	_, err := c.db.ExecContext(
-		ctx,
-		`INSERT INTO blocks (block_index, block_hash, previous_hash, nonce, difficulty, mined_at) 
-		 VALUES ($1, $2, $3, $4, $5, NOW())`,
-		b.Index, b.Hash, b.PreviousHash, b.Nonce, b.Difficulty,
-	)
-	return err
+	if err := fn(conn{q: sqlTx, d: c.dialect}); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
 }
 
 // InsertOTP inserts an OTP code for an email
@@ -352,9 +627,9 @@ func (c *Client) VerifyOTP(ctx context.Context, email, code string) (bool, error
 }
 
 // GetUserByWalletID retrieves user profile given wallet_id
-func (c *Client) GetUserByWalletID(ctx context.Context, walletID string) (map[string]interface{}, error) {
+func (c *Client) GetUserByWalletID(ctx context.Context, walletID string) (*Profile, error) {
 	row := c.db.QueryRowContext(ctx,
-		`SELECT u.id, u.email, u.full_name, u.cnic,
+		`SELECT u.id, u.email, COALESCE(u.full_name, ''), COALESCE(u.cnic, ''),
 		        w.wallet_id, w.public_key, w.created_at, w.zakat_last_deducted,
 		        COALESCE(u.zakat_enabled, TRUE)
 		 FROM users u
@@ -363,29 +638,13 @@ func (c *Client) GetUserByWalletID(ctx context.Context, walletID string) (map[st
 		walletID,
 	)
 
-	var userID, email, fullName, cnic, wid string
-	var pubKey []byte
-	var createdAt string
-	var zakatLastDeducted *string
-	var zakatEnabled bool
-
-	err := row.Scan(&userID, &email, &fullName, &cnic, &wid,
-		&pubKey, &createdAt, &zakatLastDeducted, &zakatEnabled)
+	var p Profile
+	err := row.Scan(&p.UserID, &p.Email, &p.FullName, &p.CNIC, &p.WalletID,
+		&p.PublicKey, &p.CreatedAt, &p.ZakatLastDeducted, &p.ZakatEnabled)
 	if err != nil {
 		return nil, err
 	}
-
-	return map[string]interface{}{
-		"user_id":             userID,
-		"email":               email,
-		"full_name":           fullName,
-		"cnic":                cnic,
-		"wallet_id":           wid,
-		"public_key":          pubKey,
-		"created_at":          createdAt,
-		"zakat_last_deducted": zakatLastDeducted,
-		"zakat_enabled":       zakatEnabled,
-	}, nil
+	return &p, nil
 }
 
 // UpdateUserProfile updates user name and email
@@ -416,9 +675,9 @@ func (c *Client) UpdateUserEmail(ctx context.Context, userID, email string) erro
 }
 
 // GetBeneficiaries returns all beneficiaries for a user
-func (c *Client) GetBeneficiaries(ctx context.Context, userID string) ([]map[string]interface{}, error) {
+func (c *Client) GetBeneficiaries(ctx context.Context, userID string) ([]Beneficiary, error) {
 	rows, err := c.db.QueryContext(ctx,
-		"SELECT id, beneficiary_wallet_id, beneficiary_name, created_at FROM beneficiaries WHERE user_id=$1 ORDER BY created_at DESC",
+		"SELECT id, user_id, beneficiary_wallet_id, COALESCE(beneficiary_name, ''), created_at FROM beneficiaries WHERE user_id=$1 ORDER BY created_at DESC",
 		userID,
 	)
 	if err != nil {
@@ -426,18 +685,13 @@ func (c *Client) GetBeneficiaries(ctx context.Context, userID string) ([]map[str
 	}
 	defer rows.Close()
 
-	var beneficiaries []map[string]interface{}
+	var beneficiaries []Beneficiary
 	for rows.Next() {
-		var id, wid, name, createdAt string
-		if err := rows.Scan(&id, &wid, &name, &createdAt); err != nil {
+		var b Beneficiary
+		if err := rows.Scan(&b.ID, &b.UserID, &b.WalletID, &b.Name, &b.CreatedAt); err != nil {
 			return nil, err
 		}
-		beneficiaries = append(beneficiaries, map[string]interface{}{
-			"id":                    id,
-			"beneficiary_wallet_id": wid,
-			"beneficiary_name":      name,
-			"created_at":            createdAt,
-		})
+		beneficiaries = append(beneficiaries, b)
 	}
 	return beneficiaries, rows.Err()
 }
@@ -470,48 +724,304 @@ func (c *Client) UpdateUserPassword(ctx context.Context, userID, passwordHash st
 }
 
 // GetUserByEmail retrieves user by email for login
-func (c *Client) GetUserByEmail(ctx context.Context, email string) (map[string]interface{}, error) {
+func (c *Client) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	row := c.db.QueryRowContext(ctx,
-		"SELECT id, email, full_name, cnic, password_hash FROM users WHERE email=$1",
+		`SELECT id, email, COALESCE(full_name, ''), COALESCE(cnic, ''), COALESCE(password_hash, ''),
+		        COALESCE(zakat_enabled, TRUE), created_at
+		 FROM users WHERE email=$1`,
 		email,
 	)
 
-	var id, userEmail, fullName, cnic, passwordHash string
-	err := row.Scan(&id, &userEmail, &fullName, &cnic, &passwordHash)
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.FullName, &u.CNIC, &u.PasswordHash, &u.ZakatEnabled, &u.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-
-	return map[string]interface{}{
-		"id":            id,
-		"email":         userEmail,
-		"full_name":     fullName,
-		"cnic":          cnic,
-		"password_hash": passwordHash,
-	}, nil
+	return &u, nil
 }
 
 // GetUserWalletByUserID retrieves wallet info for user login
-func (c *Client) GetUserWalletByUserID(ctx context.Context, userID string) (map[string]interface{}, error) {
+func (c *Client) GetUserWalletByUserID(ctx context.Context, userID string) (*Wallet, error) {
 	row := c.db.QueryRowContext(ctx,
-		"SELECT id, wallet_id, public_key, private_key_encrypted, balance FROM wallets WHERE user_id=$1",
+		"SELECT "+walletColumns+" FROM wallets WHERE user_id=$1",
 		userID,
 	)
+	return scanWallet(row)
+}
 
-	var id, walletID string
-	var pubKey, privKeyEnc []byte
-	var balance int64
+// TryLock takes a session-level Postgres advisory lock keyed on name.
+// The lock lives on a dedicated connection which is returned to the pool by unlock.
+// On SQLite, which serves a single node, the lock is only held in process.
+func (c *Client) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	if c.dialect == sqliteDialect {
+		return c.tryLocalLock(name)
+	}
+
+	conn, err := c.pool.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+	unlock := func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", name)
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+func (c *Client) tryLocalLock(name string) (func(), bool, error) {
+	c.locksMu.Lock()
+	defer c.locksMu.Unlock()
+	if c.locks[name] {
+		return nil, false, nil
+	}
+	if c.locks == nil {
+		c.locks = map[string]bool{}
+	}
+	c.locks[name] = true
+	unlock := func() {
+		c.locksMu.Lock()
+		delete(c.locks, name)
+		c.locksMu.Unlock()
+	}
+	return unlock, true, nil
+}
+
+// RecordJobRun stores one attempt of a scheduled job
+func (c *Client) RecordJobRun(ctx context.Context, run jobs.Run) error {
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO job_runs (job_name, attempt, status, error, started_at, finished_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		run.JobName, run.Attempt, run.Status, run.Error, run.StartedAt, run.FinishedAt,
+	)
+	return err
+}
+
+// GetJobRuns returns the most recent runs, optionally filtered by job name
+func (c *Client) GetJobRuns(ctx context.Context, jobName string, limit int) ([]jobs.Run, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT id, job_name, attempt, status, COALESCE(error, ''), started_at, finished_at
+		 FROM job_runs
+		 WHERE $1 = '' OR job_name = $1
+		 ORDER BY started_at DESC, id DESC LIMIT $2`,
+		jobName, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []jobs.Run
+	for rows.Next() {
+		var r jobs.Run
+		if err := rows.Scan(&r.ID, &r.JobName, &r.Attempt, &r.Status, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// DeleteExpiredOTPs removes OTPs that are used or past their expiry
+func (c *Client) DeleteExpiredOTPs(ctx context.Context) (int64, error) {
+	res, err := c.db.ExecContext(ctx, "DELETE FROM otps WHERE used = TRUE OR expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ReconcileBalances recomputes the cached wallets.balance from unspent
+// native-coin UTXOs and returns the number of wallets whose balance was
+// corrected
+func (c *Client) ReconcileBalances(ctx context.Context) (int64, error) {
+	res, err := c.db.ExecContext(ctx,
+		`UPDATE wallets AS w SET balance = s.total
+		 FROM (
+		     SELECT w2.wallet_id, COALESCE(SUM(u.amount), 0) AS total
+		     FROM wallets w2
+		     LEFT JOIN utxos u ON u.owner_wallet_id = w2.wallet_id AND u.spent = FALSE AND u.asset_id IS NULL
+		     GROUP BY w2.wallet_id
+		 ) s
+		 WHERE w.wallet_id = s.wallet_id AND w.balance IS DISTINCT FROM s.total`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+const standingOrderColumns = `id, user_id, sender_wallet_id, receiver_wallet_id, amount, COALESCE(note, ''),
+	schedule, next_run_at, end_date, status, last_run_at, COALESCE(last_error, ''), failure_count, created_at`
 
-	err := row.Scan(&id, &walletID, &pubKey, &privKeyEnc, &balance)
+func scanStandingOrder(row rowScanner) (orders.Order, error) {
+	var o orders.Order
+	err := row.Scan(&o.ID, &o.UserID, &o.SenderWalletID, &o.ReceiverWalletID, &o.Amount, &o.Note,
+		&o.Schedule, &o.NextRunAt, &o.EndDate, &o.Status, &o.LastRunAt, &o.LastError, &o.FailureCount, &o.CreatedAt)
+	return o, err
+}
+
+// InsertStandingOrder creates a standing order and returns its ID.
+// registerReceiver registers the receiver as an external wallet in the same
+// database transaction, for an order the sender allowed to an unknown
+// wallet.
+func (c *Client) InsertStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) (string, error) {
+	var id string
+	err := c.inTx(ctx, func(q querier) error {
+		if registerReceiver {
+			if err := registerExternalWallet(ctx, q, o.ReceiverWalletID); err != nil {
+				return fmt.Errorf("register receiver: %w", err)
+			}
+		}
+		return q.QueryRowContext(ctx,
+			`INSERT INTO standing_orders (user_id, sender_wallet_id, receiver_wallet_id, amount, note, schedule, next_run_at, end_date, status)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+			o.UserID, o.SenderWalletID, o.ReceiverWalletID, o.Amount, o.Note, o.Schedule, o.NextRunAt, o.EndDate, o.Status,
+		).Scan(&id)
+	})
+	return id, err
+}
+
+// GetStandingOrder retrieves a standing order owned by userID
+func (c *Client) GetStandingOrder(ctx context.Context, id, userID string) (orders.Order, error) {
+	row := c.db.QueryRowContext(ctx,
+		"SELECT "+standingOrderColumns+" FROM standing_orders WHERE id = $1 AND user_id = $2",
+		id, userID,
+	)
+	return scanStandingOrder(row)
+}
+
+// GetStandingOrders returns all standing orders of a user, newest first
+func (c *Client) GetStandingOrders(ctx context.Context, userID string) ([]orders.Order, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+standingOrderColumns+" FROM standing_orders WHERE user_id = $1 ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []orders.Order
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// UpdateStandingOrder saves the editable fields and status of an order.
+// registerReceiver is as for InsertStandingOrder.
+func (c *Client) UpdateStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) error {
+	return c.inTx(ctx, func(q querier) error {
+		if registerReceiver {
+			if err := registerExternalWallet(ctx, q, o.ReceiverWalletID); err != nil {
+				return fmt.Errorf("register receiver: %w", err)
+			}
+		}
+		res, err := q.ExecContext(ctx,
+			`UPDATE standing_orders
+			 SET receiver_wallet_id = $1, amount = $2, note = $3, schedule = $4, next_run_at = $5, end_date = $6, status = $7, updated_at = NOW()
+			 WHERE id = $8 AND user_id = $9`,
+			o.ReceiverWalletID, o.Amount, o.Note, o.Schedule, o.NextRunAt, o.EndDate, o.Status, o.ID, o.UserID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// GetDueStandingOrders returns active orders whose next run is at or before now
+func (c *Client) GetDueStandingOrders(ctx context.Context, now time.Time) ([]orders.Order, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+standingOrderColumns+" FROM standing_orders WHERE status = 'active' AND next_run_at <= $1 ORDER BY next_run_at",
+		now,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var list []orders.Order
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// RecordStandingOrderRun stores the outcome of one standing order execution
+func (c *Client) RecordStandingOrderRun(ctx context.Context, exec orders.Execution) error {
+	var txID *string
+	if exec.TxID != "" {
+		txID = &exec.TxID
+	}
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO standing_order_runs (order_id, tx_id, status, error, run_at) VALUES ($1, $2, $3, $4, $5)",
+		exec.OrderID, txID, exec.Status, exec.Error, exec.RunAt,
+	)
+	return err
+}
+
+// AdvanceStandingOrder moves an order to its next occurrence after an execution.
+// An execution without a status only updates the schedule and status.
+func (c *Client) AdvanceStandingOrder(ctx context.Context, exec orders.Execution, nextRunAt time.Time, status string) error {
+	if exec.Status == "" {
+		_, err := c.db.ExecContext(ctx,
+			"UPDATE standing_orders SET next_run_at = $1, status = $2, updated_at = NOW() WHERE id = $3",
+			nextRunAt, status, exec.OrderID,
+		)
+		return err
+	}
+	failed := 0
+	if exec.Status == orders.RunFailed {
+		failed = 1
+	}
+	_, err := c.db.ExecContext(ctx,
+		`UPDATE standing_orders
+		 SET next_run_at = $1, status = $2, last_run_at = $3, last_error = $4, failure_count = failure_count + $5, updated_at = NOW()
+		 WHERE id = $6`,
+		nextRunAt, status, exec.RunAt, exec.Error, failed, exec.OrderID,
+	)
+	return err
+}
+
+// GetStandingOrderRuns returns the most recent executions of an order
+func (c *Client) GetStandingOrderRuns(ctx context.Context, orderID string, limit int) ([]orders.Execution, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT order_id, COALESCE(tx_id, ''), status, COALESCE(error, ''), run_at
+		 FROM standing_order_runs WHERE order_id = $1 ORDER BY run_at DESC LIMIT $2`,
+		orderID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return map[string]interface{}{
-		"id":                    id,
-		"wallet_id":             walletID,
-		"public_key":            pubKey,
-		"private_key_encrypted": privKeyEnc,
-		"balance":               balance,
-	}, nil
-}
\ No newline at end of file
+	var runs []orders.Execution
+	for rows.Next() {
+		var e orders.Execution
+		if err := rows.Scan(&e.OrderID, &e.TxID, &e.Status, &e.Error, &e.RunAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, e)
+	}
+	return runs, rows.Err()
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Supported storage backends
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// SQLite keeps timestamps as text. Values written from Go and by NOW() share
+// one fixed-width UTC format so that they sort and compare as strings.
+const (
+	sqliteTimeFormat = "2006-01-02 15:04:05.000-07:00"
+	sqliteNow        = "(strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))"
+)
+
+// dialect adapts the Postgres flavoured queries in this package to a backend.
+// Both backends accept $N placeholders, so only NOW() and time values differ.
+type dialect struct {
+	name string
+}
+
+var (
+	postgresDialect = &dialect{name: DriverPostgres}
+	sqliteDialect   = &dialect{name: DriverSQLite}
+)
+
+func (d *dialect) rebind(query string) string {
+	if d == sqliteDialect {
+		return strings.ReplaceAll(query, "NOW()", sqliteNow)
+	}
+	return query
+}
+
+// args formats every timestamp as sqliteTimeFormat text on SQLite
+func (d *dialect) args(args []interface{}) []interface{} {
+	if d != sqliteDialect {
+		return args
+	}
+	for i, a := range args {
+		switch v := a.(type) {
+		case time.Time:
+			args[i] = v.UTC().Format(sqliteTimeFormat)
+		case *time.Time:
+			if v != nil {
+				args[i] = v.UTC().Format(sqliteTimeFormat)
+			}
+		}
+	}
+	return args
+}
+
+// querier is implemented by *sql.DB, *sql.Conn and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn runs statements through the dialect of the client that created it
+type conn struct {
+	q querier
+	d *dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.d.rebind(query), c.d.args(args)...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.d.rebind(query), c.d.args(args)...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.d.rebind(query), c.d.args(args)...)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"blockchain-wallet/pkg/directory"
+)
+
+// directoryFrom joins a wallet with what the directory shows about it.
+// Only wallets with an owner are listed: a user's wallet or a multisig
+// wallet, not external ones.
+const directoryFrom = `SELECT w.wallet_id, COALESCE(a.alias, ''), COALESCE(u.full_name, m.name, ''),
+	        m.wallet_id IS NOT NULL
+	 FROM wallets w
+	 LEFT JOIN users u ON u.id = w.user_id
+	 LEFT JOIN multisig_wallets m ON m.wallet_id = w.wallet_id
+	 LEFT JOIN wallet_aliases a ON a.wallet_id = w.wallet_id
+	 WHERE (u.id IS NOT NULL OR m.wallet_id IS NOT NULL) AND `
+
+func (c *Client) getDirectoryEntry(ctx context.Context, where, arg string) (directory.Entry, error) {
+	var e directory.Entry
+	err := c.db.QueryRowContext(ctx, directoryFrom+where, arg).
+		Scan(&e.WalletID, &e.Alias, &e.Name, &e.Multisig)
+	return e, err
+}
+
+// GetDirectoryEntry looks up a wallet by ID
+func (c *Client) GetDirectoryEntry(ctx context.Context, walletID string) (directory.Entry, error) {
+	return c.getDirectoryEntry(ctx, "w.wallet_id = $1", walletID)
+}
+
+// GetDirectoryEntryByAlias looks up the wallet holding a normalized alias
+func (c *Client) GetDirectoryEntryByAlias(ctx context.Context, alias string) (directory.Entry, error) {
+	return c.getDirectoryEntry(ctx, "a.alias = $1", alias)
+}
+
+// GetDirectoryEntryByEmail looks up the wallet of the user registered with
+// a lower-cased email address
+func (c *Client) GetDirectoryEntryByEmail(ctx context.Context, email string) (directory.Entry, error) {
+	return c.getDirectoryEntry(ctx, "lower(u.email) = $1", email)
+}
+
+// SetWalletAlias gives a wallet a normalized alias, replacing its old one.
+// It returns directory.ErrAliasTaken if another wallet holds the alias.
+func (c *Client) SetWalletAlias(ctx context.Context, walletID, alias string) error {
+	return c.inTx(ctx, func(q querier) error {
+		var holder string
+		err := q.QueryRowContext(ctx, "SELECT wallet_id FROM wallet_aliases WHERE alias = $1", alias).Scan(&holder)
+		switch {
+		case err == nil && holder != walletID:
+			return directory.ErrAliasTaken
+		case err == nil:
+			return nil
+		case err != sql.ErrNoRows:
+			return err
+		}
+		if _, err := q.ExecContext(ctx, "DELETE FROM wallet_aliases WHERE wallet_id = $1", walletID); err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, "INSERT INTO wallet_aliases (alias, wallet_id) VALUES ($1, $2)", alias, walletID)
+		return err
+	})
+}
+
+// DeleteWalletAlias removes a wallet's alias, if it has one
+func (c *Client) DeleteWalletAlias(ctx context.Context, walletID string) error {
+	_, err := c.db.ExecContext(ctx, "DELETE FROM wallet_aliases WHERE wallet_id = $1", walletID)
+	return err
+}
+
+// registerExternalWallet records a wallet ID that is not registered here,
+// so a transfer to it can own outputs. The row has no user and no key; it
+// is claimed when the key is imported (see InsertWallet). It does nothing
+// if the wallet exists. Callers run it in the database transaction that
+// stores what refers to the wallet, so a failed transfer leaves no row.
+func registerExternalWallet(ctx context.Context, q querier, walletID string) error {
+	_, err := q.ExecContext(ctx,
+		`INSERT INTO wallets (user_id, wallet_id, public_key, private_key_encrypted)
+		 VALUES (NULL, $1, $2, $2) ON CONFLICT (wallet_id) DO NOTHING`,
+		walletID, []byte{},
+	)
+	return err
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+
+	"blockchain-wallet/pkg/utxo"
+)
+
+// GetEscrows returns up to limit escrow outputs in which the wallet is the
+// payer, payee or arbiter, newest first. An escrow spent to its payee was
+// released; one spent back to the payer was refunded.
+func (c *Client) GetEscrows(ctx context.Context, walletID string, limit int) ([]Escrow, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT `+utxoColumns+`,
+		        CASE WHEN COALESCE(spent, FALSE) = FALSE THEN CAST($3 AS TEXT)
+		             WHEN EXISTS (SELECT 1 FROM transactions t
+		                          WHERE t.tx_id = utxos.spent_in_tx_id AND t.receiver_wallet_id = utxos.escrow_payee) THEN CAST($4 AS TEXT)
+		             ELSE CAST($5 AS TEXT) END
+		 FROM utxos
+		 WHERE lock_kind = $1 AND (owner_wallet_id = $2 OR escrow_payee = $2 OR escrow_arbiter = $2)
+		 ORDER BY created_at DESC, utxo_id
+		 LIMIT $6`,
+		utxo.LockEscrow, walletID, utxo.EscrowHeld, utxo.EscrowReleased, utxo.EscrowRefunded, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Escrow
+	for rows.Next() {
+		var e Escrow
+		u, err := scanUTXO(escrowScanner{rows, &e.Status})
+		if err != nil {
+			return nil, err
+		}
+		e.UTXO = *u
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// escrowScanner appends the status column to a UTXO scan
+type escrowScanner struct {
+	row    rowScanner
+	status *string
+}
+
+func (s escrowScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.status)...)
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"blockchain-wallet/pkg/blockchain"
+)
+
+// The explorer aggregates (address_stats, daily_stats and chain_stats) are
+// updated in the same database transaction as the write they summarise.
+
+// statsDay is the daily_stats key for now
+func statsDay() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// addUTXOStats applies a created (count 1) or spent (count -1) output of
+// amount to its owner's totals and the network supply
+func addUTXOStats(ctx context.Context, q querier, owner string, amount, count int64) error {
+	received, sent := amount, int64(0)
+	if amount < 0 {
+		received, sent = 0, -amount
+	}
+	if _, err := q.ExecContext(ctx,
+		`INSERT INTO address_stats (wallet_id, received, sent, balance, utxo_count, first_seen, last_seen)
+		 VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		 ON CONFLICT (wallet_id) DO UPDATE SET
+		     received = address_stats.received + excluded.received,
+		     sent = address_stats.sent + excluded.sent,
+		     balance = address_stats.balance + excluded.balance,
+		     utxo_count = address_stats.utxo_count + excluded.utxo_count,
+		     first_seen = COALESCE(address_stats.first_seen, excluded.first_seen),
+		     last_seen = excluded.last_seen`,
+		owner, received, sent, amount, count,
+	); err != nil {
+		return fmt.Errorf("update address stats: %w", err)
+	}
+	if _, err := q.ExecContext(ctx,
+		"UPDATE chain_stats SET total_supply = total_supply + $1, utxo_count = utxo_count + $2 WHERE id = 1",
+		amount, count,
+	); err != nil {
+		return fmt.Errorf("update chain stats: %w", err)
+	}
+	return nil
+}
+
+// addTxStats counts a new transaction for both parties, its day and the network
+func addTxStats(ctx context.Context, q querier, rec TxRecord) error {
+	parties := []string{rec.SenderWalletID}
+	if rec.ReceiverWalletID != rec.SenderWalletID {
+		parties = append(parties, rec.ReceiverWalletID)
+	}
+	for _, w := range parties {
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO address_stats (wallet_id, tx_count, first_seen, last_seen)
+			 VALUES ($1, 1, NOW(), NOW())
+			 ON CONFLICT (wallet_id) DO UPDATE SET
+			     tx_count = address_stats.tx_count + 1,
+			     first_seen = COALESCE(address_stats.first_seen, excluded.first_seen),
+			     last_seen = excluded.last_seen`,
+			w,
+		); err != nil {
+			return fmt.Errorf("update address stats: %w", err)
+		}
+	}
+	// Volume is in the native coin; asset transfers are counted but not summed
+	volume := rec.Amount
+	if rec.Asset != "" {
+		volume = 0
+	}
+	if _, err := q.ExecContext(ctx,
+		`INSERT INTO daily_stats (day, tx_count, volume) VALUES ($1, 1, $2)
+		 ON CONFLICT (day) DO UPDATE SET
+		     tx_count = daily_stats.tx_count + 1,
+		     volume = daily_stats.volume + excluded.volume`,
+		statsDay(), volume,
+	); err != nil {
+		return fmt.Errorf("update daily stats: %w", err)
+	}
+	if _, err := q.ExecContext(ctx, "UPDATE chain_stats SET tx_count = tx_count + 1 WHERE id = 1"); err != nil {
+		return fmt.Errorf("update chain stats: %w", err)
+	}
+	return nil
+}
+
+// addBlockStats counts a newly stored block
+func addBlockStats(ctx context.Context, q querier, b *blockchain.Block) error {
+	if _, err := q.ExecContext(ctx,
+		`INSERT INTO daily_stats (day, block_count, difficulty_sum) VALUES ($1, 1, $2)
+		 ON CONFLICT (day) DO UPDATE SET
+		     block_count = daily_stats.block_count + 1,
+		     difficulty_sum = daily_stats.difficulty_sum + excluded.difficulty_sum`,
+		statsDay(), b.Difficulty,
+	); err != nil {
+		return fmt.Errorf("update daily stats: %w", err)
+	}
+	if _, err := q.ExecContext(ctx,
+		`UPDATE chain_stats SET block_count = block_count + 1,
+		     first_block_at = COALESCE(first_block_at, NOW()), last_block_at = NOW()
+		 WHERE id = 1`,
+	); err != nil {
+		return fmt.Errorf("update chain stats: %w", err)
+	}
+	return nil
+}
+
+// BlockCursor marks the last block of a page of the explorer's block list
+type BlockCursor struct {
+	MinedAt time.Time
+	ID      string
+}
+
+// Encode returns the opaque form of the cursor used by the API
+func (c BlockCursor) Encode() string {
+	return encodeCursor(c.MinedAt, c.ID)
+}
+
+// DecodeBlockCursor parses a cursor produced by Encode
+func DecodeBlockCursor(s string) (*BlockCursor, error) {
+	at, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockCursor{MinedAt: at, ID: id}, nil
+}
+
+// BlockCursorFor returns the cursor positioned after b
+func BlockCursorFor(b BlockRecord) BlockCursor {
+	return BlockCursor{MinedAt: b.MinedAt, ID: b.ID}
+}
+
+const blockColumns = `b.id, b.block_index, b.block_hash, b.previous_hash, COALESCE(b.merkle_root, ''), b.nonce,
+	COALESCE(b.difficulty, 0), b.mined_at, COALESCE(b.miner_wallet_id, ''),
+	(SELECT COUNT(*) FROM block_transactions bt WHERE bt.block_id = b.id)`
+
+func scanBlock(row rowScanner) (*BlockRecord, error) {
+	var b BlockRecord
+	err := row.Scan(&b.ID, &b.Index, &b.Hash, &b.PreviousHash, &b.MerkleRoot, &b.Nonce,
+		&b.Difficulty, &b.MinedAt, &b.MinerWalletID, &b.TxCount)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBlocks returns up to limit stored blocks, most recently mined first,
+// starting after the cursor (nil for the first page)
+func (c *Client) ListBlocks(ctx context.Context, after *BlockCursor, limit int) ([]BlockRecord, error) {
+	w := &whereBuilder{}
+	if after != nil {
+		w.add("(b.mined_at < ? OR (b.mined_at = ? AND b.id < ?))", after.MinedAt, after.MinedAt, after.ID)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+blockColumns+" FROM blocks b"+w.String()+
+			fmt.Sprintf(" ORDER BY b.mined_at DESC, b.id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []BlockRecord
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, *b)
+	}
+	return blocks, rows.Err()
+}
+
+// GetBlockByHeight returns the block stored at a height. Servers that started
+// a new chain on every restart left repeated heights behind; the most
+// recently mined block wins.
+func (c *Client) GetBlockByHeight(ctx context.Context, height int64) (*BlockRecord, error) {
+	b, err := scanBlock(c.db.QueryRowContext(ctx,
+		"SELECT "+blockColumns+" FROM blocks b WHERE b.block_index = $1 ORDER BY b.mined_at DESC LIMIT 1",
+		height,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return c.GetBlockByHash(ctx, b.Hash)
+}
+
+const addressStatsColumns = "wallet_id, received, sent, balance, utxo_count, tx_count, first_seen, last_seen"
+
+func scanAddressStats(row rowScanner) (*AddressStats, error) {
+	var a AddressStats
+	err := row.Scan(&a.WalletID, &a.Received, &a.Sent, &a.Balance, &a.UTXOCount, &a.TxCount, &a.FirstSeen, &a.LastSeen)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAddressStats returns the explorer totals of a wallet. A wallet that has
+// never been seen gets zero totals.
+func (c *Client) GetAddressStats(ctx context.Context, walletID string) (*AddressStats, error) {
+	a, err := scanAddressStats(c.db.QueryRowContext(ctx,
+		"SELECT "+addressStatsColumns+" FROM address_stats WHERE wallet_id = $1",
+		walletID,
+	))
+	if err == sql.ErrNoRows {
+		return &AddressStats{WalletID: walletID}, nil
+	}
+	return a, err
+}
+
+// GetRichList returns the wallets with the largest balances
+func (c *Client) GetRichList(ctx context.Context, limit int) ([]AddressStats, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+addressStatsColumns+" FROM address_stats WHERE balance > 0 ORDER BY balance DESC, wallet_id LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []AddressStats
+	for rows.Next() {
+		a, err := scanAddressStats(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+// GetDailyStats returns the activity of each day in [from, to], oldest
+// first. Days are UTC dates in YYYY-MM-DD form; quiet days are omitted.
+func (c *Client) GetDailyStats(ctx context.Context, from, to string) ([]DailyStats, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT day, tx_count, volume, block_count, difficulty_sum
+		 FROM daily_stats WHERE day >= $1 AND day <= $2 ORDER BY day`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []DailyStats
+	for rows.Next() {
+		var d DailyStats
+		var difficultySum int64
+		if err := rows.Scan(&d.Day, &d.TxCount, &d.Volume, &d.BlockCount, &difficultySum); err != nil {
+			return nil, err
+		}
+		if d.BlockCount > 0 {
+			d.AvgDifficulty = float64(difficultySum) / float64(d.BlockCount)
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// GetChainStats returns the network-wide totals
+func (c *Client) GetChainStats(ctx context.Context) (*ChainStats, error) {
+	var s ChainStats
+	err := c.db.QueryRowContext(ctx,
+		`SELECT total_supply, utxo_count, tx_count, block_count, first_block_at, last_block_at
+		 FROM chain_stats WHERE id = 1`,
+	).Scan(&s.TotalSupply, &s.UTXOCount, &s.TxCount, &s.BlockCount, &s.FirstBlockAt, &s.LastBlockAt)
+	if err != nil {
+		return nil, err
+	}
+	if s.BlockCount > 1 && s.FirstBlockAt != nil && s.LastBlockAt != nil {
+		s.AvgBlockTime = s.LastBlockAt.Sub(*s.FirstBlockAt).Seconds() / float64(s.BlockCount-1)
+	}
+	return &s, nil
+}
@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// History directions relative to the filtered wallet
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// HistoryFilter narrows the transaction history of one wallet. Zero values
+// do not filter.
+type HistoryFilter struct {
+	WalletID     string
+	From         *time.Time // inclusive
+	To           *time.Time // exclusive
+	Direction    string     // DirectionSent, DirectionReceived or "" for both
+	Counterparty string     // the other wallet of the transfer
+	MinAmount    *int64
+	MaxAmount    *int64
+	TxType       string
+	Status       string
+	Search       string // case-insensitive substring of the note
+}
+
+// HistoryCursor marks the last transaction of a page; the next page starts
+// strictly after it in (created_at, tx_id) descending order
+type HistoryCursor struct {
+	CreatedAt time.Time
+	TxID      string
+}
+
+// HistoryTotals summarises every transaction matching a filter. Count
+// includes asset transfers; Sent and Received are in the native coin.
+type HistoryTotals struct {
+	Count    int64 `json:"count"`
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+// Encode returns the opaque form of the cursor used by the API
+func (c HistoryCursor) Encode() string {
+	return encodeCursor(c.CreatedAt, c.TxID)
+}
+
+// DecodeHistoryCursor parses a cursor produced by Encode
+func DecodeHistoryCursor(s string) (*HistoryCursor, error) {
+	at, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryCursor{CreatedAt: at, TxID: id}, nil
+}
+
+// encodeCursor packs a keyset position into a URL-safe token
+func encodeCursor(at time.Time, id string) string {
+	raw := at.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	at, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	return at, parts[1], nil
+}
+
+// CursorFor returns the cursor positioned after rec
+func CursorFor(rec TxRecord) HistoryCursor {
+	return HistoryCursor{CreatedAt: rec.CreatedAt, TxID: rec.TxID}
+}
+
+// whereBuilder collects SQL conditions with numbered placeholders
+type whereBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends a condition; each ? in cond is replaced by the next $N
+func (w *whereBuilder) add(cond string, args ...interface{}) {
+	for _, a := range args {
+		w.args = append(w.args, a)
+		cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(w.args)), 1)
+	}
+	w.conds = append(w.conds, cond)
+}
+
+func (w *whereBuilder) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func historyWhere(f HistoryFilter) *whereBuilder {
+	w := &whereBuilder{}
+	switch f.Direction {
+	case DirectionSent:
+		w.add("t.sender_wallet_id = ?", f.WalletID)
+	case DirectionReceived:
+		w.add("t.receiver_wallet_id = ?", f.WalletID)
+	default:
+		w.add("(t.sender_wallet_id = ? OR t.receiver_wallet_id = ?)", f.WalletID, f.WalletID)
+	}
+	if f.Counterparty != "" {
+		w.add("(t.sender_wallet_id = ? OR t.receiver_wallet_id = ?)", f.Counterparty, f.Counterparty)
+	}
+	if f.From != nil {
+		w.add("t.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		w.add("t.created_at < ?", *f.To)
+	}
+	if f.MinAmount != nil {
+		w.add("t.amount >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		w.add("t.amount <= ?", *f.MaxAmount)
+	}
+	if f.TxType != "" {
+		w.add("COALESCE(t.tx_type, 'transfer') = ?", f.TxType)
+	}
+	if f.Status != "" {
+		w.add("COALESCE(t.status, 'pending') = ?", f.Status)
+	}
+	if f.Search != "" {
+		w.add(`LOWER(COALESCE(t.note, '')) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(f.Search))+"%")
+	}
+	return w
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// QueryTransactionHistory returns up to limit transactions matching f, newest
+// first, starting after the cursor (nil for the first page)
+func (c *Client) QueryTransactionHistory(ctx context.Context, f HistoryFilter, after *HistoryCursor, limit int) ([]TxRecord, error) {
+	w := historyWhere(f)
+	if after != nil {
+		w.add("(t.created_at < ? OR (t.created_at = ? AND t.tx_id < ?))", after.CreatedAt, after.CreatedAt, after.TxID)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+txColumns+txFrom+w.String()+
+			fmt.Sprintf(" ORDER BY t.created_at DESC, t.tx_id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []TxRecord
+	for rows.Next() {
+		t, err := scanTx(rows)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, *t)
+	}
+	return txs, rows.Err()
+}
+
+// GetTransactionTotals counts every transaction matching f and sums the
+// native-coin ones
+func (c *Client) GetTransactionTotals(ctx context.Context, f HistoryFilter) (HistoryTotals, error) {
+	w := historyWhere(f)
+	w.args = append(w.args, f.WalletID)
+	n := len(w.args)
+
+	var totals HistoryTotals
+	err := c.db.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT COUNT(*),
+		        COALESCE(SUM(CASE WHEN t.sender_wallet_id = $%d AND t.asset_id IS NULL THEN t.amount ELSE 0 END), 0),
+		        COALESCE(SUM(CASE WHEN t.receiver_wallet_id = $%d AND t.asset_id IS NULL THEN t.amount ELSE 0 END), 0)
+		 FROM transactions t`, n, n)+w.String(),
+		w.args...,
+	).Scan(&totals.Count, &totals.Sent, &totals.Received)
+	return totals, err
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC)
+	c := HistoryCursor{CreatedAt: at, TxID: "abc|def"}
+
+	got, err := DecodeHistoryCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("DecodeHistoryCursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(at) || got.TxID != "abc|def" {
+		t.Errorf("round trip = %+v", got)
+	}
+
+	for _, bad := range []string{"", "!!!", "bm90LWEtY3Vyc29y"} {
+		if _, err := DecodeHistoryCursor(bad); err == nil {
+			t.Errorf("cursor %q should be rejected", bad)
+		}
+	}
+}
+
+func TestHistoryWhere(t *testing.T) {
+	min := int64(5)
+	w := historyWhere(HistoryFilter{WalletID: "w", Direction: DirectionSent, MinAmount: &min, Search: "50%_off"})
+
+	if got := w.String(); !strings.Contains(got, "t.sender_wallet_id = $1") || !strings.Contains(got, "t.amount >= $2") ||
+		!strings.Contains(got, "LIKE $3") {
+		t.Errorf("unexpected where clause: %s", got)
+	}
+	if len(w.args) != 3 || w.args[2] != `%50\%\_off%` {
+		t.Errorf("unexpected args: %#v", w.args)
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"blockchain-wallet/pkg/htlc"
+)
+
+// InsertHTLC records a contract output created by a transfer
+func (c *Client) InsertHTLC(ctx context.Context, h htlc.HTLC) error {
+	_, err := c.db.ExecContext(ctx,
+		`INSERT INTO htlcs (htlc_id, tx_id, sender_wallet_id, receiver_wallet_id, amount, hash_lock, claimer_key, refunder_key, timeout)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		h.ID, h.TxID, h.SenderID, h.ReceiverID, h.Amount, h.Hash, []byte(h.Claimer), []byte(h.Refunder), h.Timeout,
+	)
+	return err
+}
+
+const htlcColumns = `htlc_id, tx_id, sender_wallet_id, receiver_wallet_id, amount, hash_lock, claimer_key, refunder_key,
+	timeout, status, COALESCE(secret, ''), COALESCE(settle_tx_id, ''), created_at, settled_at`
+
+func scanHTLC(row rowScanner) (htlc.HTLC, error) {
+	var h htlc.HTLC
+	var claimer, refunder []byte
+	err := row.Scan(&h.ID, &h.TxID, &h.SenderID, &h.ReceiverID, &h.Amount, &h.Hash, &claimer, &refunder,
+		&h.Timeout, &h.Status, &h.Secret, &h.SettleTxID, &h.CreatedAt, &h.SettledAt)
+	h.Claimer, h.Refunder = claimer, refunder
+	return h, err
+}
+
+// GetHTLC returns a contract by its output ID
+func (c *Client) GetHTLC(ctx context.Context, id string) (htlc.HTLC, error) {
+	return scanHTLC(c.db.QueryRowContext(ctx, "SELECT "+htlcColumns+" FROM htlcs WHERE htlc_id = $1", id))
+}
+
+// GetHTLCsByHash returns the contracts locked to a hash, newest first. In a
+// swap the counterparty's contract is found by the shared hash.
+func (c *Client) GetHTLCsByHash(ctx context.Context, hash string) ([]htlc.HTLC, error) {
+	return c.queryHTLCs(ctx,
+		"SELECT "+htlcColumns+" FROM htlcs WHERE hash_lock = $1 ORDER BY created_at DESC, htlc_id",
+		hash)
+}
+
+// GetHTLCs returns up to limit contracts a wallet sent or receives, newest
+// first
+func (c *Client) GetHTLCs(ctx context.Context, walletID string, limit int) ([]htlc.HTLC, error) {
+	return c.queryHTLCs(ctx,
+		"SELECT "+htlcColumns+` FROM htlcs WHERE sender_wallet_id = $1 OR receiver_wallet_id = $1
+		 ORDER BY created_at DESC, htlc_id LIMIT $2`,
+		walletID, limit)
+}
+
+func (c *Client) queryHTLCs(ctx context.Context, query string, args ...interface{}) ([]htlc.HTLC, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []htlc.HTLC
+	for rows.Next() {
+		h, err := scanHTLC(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// SettleHTLC marks an open contract claimed or refunded by txID. A claim
+// records the revealed secret. Returns sql.ErrNoRows if it is not open.
+func (c *Client) SettleHTLC(ctx context.Context, id, status, txID, secret string, at time.Time) error {
+	var s *string
+	if secret != "" {
+		s = &secret
+	}
+	res, err := c.db.ExecContext(ctx,
+		`UPDATE htlcs SET status = $1, settle_tx_id = $2, secret = $3, settled_at = $4
+		 WHERE htlc_id = $5 AND status = $6`,
+		status, txID, s, at, id, htlc.StatusOpen,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
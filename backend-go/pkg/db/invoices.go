@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"blockchain-wallet/pkg/invoice"
+)
+
+const invoiceColumns = "id, reference, user_id, wallet_id, amount, memo, status, amount_paid, expires_at, created_at, paid_at"
+
+func scanInvoice(row rowScanner) (invoice.Invoice, error) {
+	var inv invoice.Invoice
+	err := row.Scan(&inv.ID, &inv.Reference, &inv.UserID, &inv.WalletID, &inv.Amount, &inv.Memo, &inv.Status,
+		&inv.AmountPaid, &inv.ExpiresAt, &inv.CreatedAt, &inv.PaidAt)
+	return inv, err
+}
+
+// InsertInvoice creates an invoice and returns its ID
+func (c *Client) InsertInvoice(ctx context.Context, inv invoice.Invoice) (string, error) {
+	var id string
+	err := c.db.QueryRowContext(ctx,
+		`INSERT INTO invoices (reference, user_id, wallet_id, amount, memo, status, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		inv.Reference, inv.UserID, inv.WalletID, inv.Amount, inv.Memo, inv.Status, inv.ExpiresAt,
+	).Scan(&id)
+	return id, err
+}
+
+// GetInvoice returns one of a user's invoices
+func (c *Client) GetInvoice(ctx context.Context, id, userID string) (invoice.Invoice, error) {
+	row := c.db.QueryRowContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices WHERE id = $1 AND user_id = $2",
+		id, userID,
+	)
+	return scanInvoice(row)
+}
+
+// GetInvoiceByReference returns the invoice with the given reference
+func (c *Client) GetInvoiceByReference(ctx context.Context, ref string) (invoice.Invoice, error) {
+	row := c.db.QueryRowContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices WHERE reference = $1",
+		ref,
+	)
+	return scanInvoice(row)
+}
+
+// GetInvoices returns up to limit of a user's invoices, newest first,
+// optionally only those with the given status
+func (c *Client) GetInvoices(ctx context.Context, userID, status string, limit int) ([]invoice.Invoice, error) {
+	w := &whereBuilder{}
+	w.add("user_id = ?", userID)
+	if status != "" {
+		w.add("status = ?", status)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+invoiceColumns+" FROM invoices"+w.String()+
+			fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []invoice.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, inv)
+	}
+	return list, rows.Err()
+}
+
+// GetInvoicePayments returns the payments matched to an invoice, oldest first
+func (c *Client) GetInvoicePayments(ctx context.Context, invoiceID string) ([]invoice.Payment, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT invoice_id, tx_id, amount, block_index, block_hash, paid_at
+		 FROM invoice_payments WHERE invoice_id = $1 ORDER BY paid_at, id`,
+		invoiceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []invoice.Payment
+	for rows.Next() {
+		var p invoice.Payment
+		if err := rows.Scan(&p.InvoiceID, &p.TxID, &p.Amount, &p.BlockIndex, &p.BlockHash, &p.PaidAt); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// RecordInvoicePayment matches a confirmed payment to its invoice and
+// updates the invoice's status as of now. It returns nil when the
+// transaction was already matched.
+func (c *Client) RecordInvoicePayment(ctx context.Context, p invoice.Payment, now time.Time) (*invoice.Invoice, error) {
+	var inv invoice.Invoice
+	applied := false
+	err := c.inTx(ctx, func(q querier) error {
+		res, err := q.ExecContext(ctx,
+			`INSERT INTO invoice_payments (invoice_id, tx_id, amount, block_index, block_hash, paid_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (tx_id) DO NOTHING`,
+			p.InvoiceID, p.TxID, p.Amount, p.BlockIndex, p.BlockHash, p.PaidAt,
+		)
+		if err != nil {
+			return fmt.Errorf("insert invoice payment: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		applied = true
+
+		// The increment locks the row, so concurrent payments add up
+		if _, err := q.ExecContext(ctx,
+			"UPDATE invoices SET amount_paid = amount_paid + $1 WHERE id = $2",
+			p.Amount, p.InvoiceID,
+		); err != nil {
+			return err
+		}
+		if inv, err = scanInvoice(q.QueryRowContext(ctx,
+			"SELECT "+invoiceColumns+" FROM invoices WHERE id = $1", p.InvoiceID,
+		)); err != nil {
+			return err
+		}
+
+		inv.Status = inv.StatusAt(now)
+		if inv.Status == invoice.StatusPaid && inv.PaidAt == nil {
+			inv.PaidAt = &p.PaidAt
+		}
+		_, err = q.ExecContext(ctx,
+			"UPDATE invoices SET status = $1, paid_at = $2 WHERE id = $3",
+			inv.Status, inv.PaidAt, inv.ID,
+		)
+		return err
+	})
+	if err != nil || !applied {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// ExpireInvoices marks open invoices past their expiry as expired and
+// returns how many were
+func (c *Client) ExpireInvoices(ctx context.Context, now time.Time) (int64, error) {
+	res, err := c.db.ExecContext(ctx,
+		"UPDATE invoices SET status = $1 WHERE status = $2 AND expires_at <= $3",
+		invoice.StatusExpired, invoice.StatusOpen, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
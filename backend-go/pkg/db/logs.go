@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// LogFilter narrows the system log. Zero values do not filter.
+type LogFilter struct {
+	WalletID  string
+	Action    string
+	Status    string
+	IPAddress string
+	From      *time.Time // inclusive
+	To        *time.Time // exclusive
+}
+
+// LogCursor marks the last entry of a page of the system log
+type LogCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque form of the cursor used by the API
+func (c LogCursor) Encode() string {
+	return encodeCursor(c.CreatedAt, c.ID)
+}
+
+// DecodeLogCursor parses a cursor produced by Encode
+func DecodeLogCursor(s string) (*LogCursor, error) {
+	at, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &LogCursor{CreatedAt: at, ID: id}, nil
+}
+
+// LogCursorFor returns the cursor positioned after e
+func LogCursorFor(e LogEntry) LogCursor {
+	return LogCursor{CreatedAt: e.CreatedAt, ID: e.ID}
+}
+
+func logWhere(f LogFilter) *whereBuilder {
+	w := &whereBuilder{}
+	if f.WalletID != "" {
+		w.add("wallet_id = ?", f.WalletID)
+	}
+	if f.Action != "" {
+		w.add("action = ?", f.Action)
+	}
+	if f.Status != "" {
+		w.add("status = ?", f.Status)
+	}
+	if f.IPAddress != "" {
+		w.add("ip_address = ?", f.IPAddress)
+	}
+	if f.From != nil {
+		w.add("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		w.add("created_at < ?", *f.To)
+	}
+	return w
+}
+
+// QueryLogs returns up to limit log entries matching f, newest first,
+// starting after the cursor (nil for the first page)
+func (c *Client) QueryLogs(ctx context.Context, f LogFilter, after *LogCursor, limit int) ([]LogEntry, error) {
+	w := logWhere(f)
+	if after != nil {
+		w.add("(created_at < ? OR (created_at = ? AND id < ?))", after.CreatedAt, after.CreatedAt, after.ID)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT id, COALESCE(wallet_id, ''), action, COALESCE(details, ''), COALESCE(status, ''),
+		        COALESCE(ip_address, ''), created_at
+		 FROM logs`+w.String()+
+			fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		var e LogEntry
+		if err := rows.Scan(&e.ID, &e.WalletID, &e.Action, &e.Details, &e.Status, &e.IPAddress, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
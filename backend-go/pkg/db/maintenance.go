@@ -0,0 +1,673 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/blockchain"
+)
+
+// The functions in this file back cmd/nodectl. They read and repair the
+// stored chain directly and assume no server is writing at the same time.
+
+// StoredBlock is a stored block with the timestamp and entry list its hash
+// covers. Blocks stored before those were recorded have neither, and their
+// hash cannot be recomputed.
+type StoredBlock struct {
+	BlockRecord
+	Timestamp *int64   `json:"timestamp,omitempty"`
+	Entries   []string `json:"entries,omitempty"`
+}
+
+// Header returns the block as the chain built it, for recomputing its hash
+func (b StoredBlock) Header() *blockchain.Block {
+	blk := &blockchain.Block{
+		Index:        b.Index,
+		Transactions: b.Entries,
+		MerkleRoot:   b.MerkleRoot,
+		Miner:        b.MinerWalletID,
+		PreviousHash: b.PreviousHash,
+		Hash:         b.Hash,
+		Nonce:        b.Nonce,
+		Difficulty:   b.Difficulty,
+	}
+	if b.Timestamp != nil {
+		blk.Timestamp = *b.Timestamp
+	}
+	return blk
+}
+
+const storedBlockColumns = `id, block_index, block_hash, previous_hash, COALESCE(merkle_root, ''), nonce,
+	COALESCE(difficulty, 0), mined_at, COALESCE(miner_wallet_id, ''), block_time, entries`
+
+func scanStoredBlock(row rowScanner) (StoredBlock, error) {
+	var b StoredBlock
+	var ts sql.NullInt64
+	var entries sql.NullString
+	if err := row.Scan(&b.ID, &b.Index, &b.Hash, &b.PreviousHash, &b.MerkleRoot, &b.Nonce,
+		&b.Difficulty, &b.MinedAt, &b.MinerWalletID, &ts, &entries); err != nil {
+		return b, err
+	}
+	if ts.Valid {
+		b.Timestamp = &ts.Int64
+	}
+	if entries.Valid {
+		if err := json.Unmarshal([]byte(entries.String), &b.Entries); err != nil {
+			return b, fmt.Errorf("block %s: entries: %w", b.Hash, err)
+		}
+	}
+	return b, nil
+}
+
+// ChainTip returns the stored block the chain continues from: the highest,
+// and of blocks at the same height from before restarts resumed the chain,
+// the most recently mined. It returns sql.ErrNoRows if no block is stored.
+func (c *Client) ChainTip(ctx context.Context) (*StoredBlock, error) {
+	b, err := scanStoredBlock(c.db.QueryRowContext(ctx,
+		"SELECT "+storedBlockColumns+" FROM blocks ORDER BY block_index DESC, mined_at DESC, id DESC LIMIT 1"))
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ChainBlocks returns every stored block in height order with the IDs of
+// the transactions linked to it
+func (c *Client) ChainBlocks(ctx context.Context) ([]StoredBlock, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+storedBlockColumns+" FROM blocks ORDER BY block_index, mined_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []StoredBlock
+	byID := map[string]int{}
+	for rows.Next() {
+		b, err := scanStoredBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[b.ID] = len(blocks)
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	links, err := c.db.QueryContext(ctx, "SELECT block_id, tx_id FROM block_transactions ORDER BY tx_id")
+	if err != nil {
+		return nil, err
+	}
+	defer links.Close()
+	for links.Next() {
+		var blockID, txID string
+		if err := links.Scan(&blockID, &txID); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[blockID]; ok {
+			blocks[i].TxIDs = append(blocks[i].TxIDs, txID)
+			blocks[i].TxCount++
+		}
+	}
+	return blocks, links.Err()
+}
+
+// ChainIssue is a problem found while verifying the stored chain
+type ChainIssue struct {
+	Height  int64  `json:"height"`
+	Hash    string `json:"hash,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// ChainReport summarises a verification of the stored chain. The server
+// starts a fresh in-memory chain with a new genesis block every time it
+// restarts and genesis is never stored, so a healthy database holds one
+// segment per run; more is not an error.
+type ChainReport struct {
+	Blocks   int          `json:"blocks"`
+	Segments int          `json:"segments"`
+	Unhashed int          `json:"unhashed"` // blocks stored without their contents
+	Issues   []ChainIssue `json:"issues"`
+}
+
+// VerifyBlocks checks the proof of work, hash, Merkle root and links of
+// blocks as returned by ChainBlocks
+func VerifyBlocks(blocks []StoredBlock) ChainReport {
+	r := ChainReport{Blocks: len(blocks), Issues: []ChainIssue{}}
+	byHash := make(map[string]StoredBlock, len(blocks))
+	for _, b := range blocks {
+		byHash[b.Hash] = b
+	}
+	children := map[string][]string{}
+
+	for _, b := range blocks {
+		issue := func(format string, args ...interface{}) {
+			r.Issues = append(r.Issues, ChainIssue{Height: b.Index, Hash: b.Hash, Problem: fmt.Sprintf(format, args...)})
+		}
+		if b.Difficulty < 0 || b.Difficulty > len(b.Hash) || b.Hash[:b.Difficulty] != strings.Repeat("0", b.Difficulty) {
+			issue("hash does not meet difficulty %d", b.Difficulty)
+		}
+		if b.Timestamp == nil {
+			r.Unhashed++
+		} else {
+			if h := b.Header().ComputeHash(); h != b.Hash {
+				issue("hash does not match contents (computed %s)", h)
+			}
+			if b.MerkleRoot != "" && blockchain.MerkleRoot(b.Entries) != b.MerkleRoot {
+				issue("merkle root does not match entries")
+			}
+			entries := make(map[string]bool, len(b.Entries))
+			for _, e := range b.Entries {
+				entries[e] = true
+			}
+			for _, id := range b.TxIDs {
+				if !entries[id] {
+					issue("linked transaction %s is not in the block", id)
+				}
+			}
+		}
+
+		prev, ok := byHash[b.PreviousHash]
+		switch {
+		case !ok:
+			r.Segments++
+		case prev.Index != b.Index-1:
+			issue("previous block %s is at height %d", prev.Hash, prev.Index)
+		default:
+			children[prev.Hash] = append(children[prev.Hash], b.Hash)
+		}
+	}
+
+	for parent, kids := range children {
+		if len(kids) > 1 {
+			sort.Strings(kids)
+			r.Issues = append(r.Issues, ChainIssue{
+				Height:  byHash[parent].Index,
+				Hash:    parent,
+				Problem: fmt.Sprintf("%d blocks build on this block: %s", len(kids), strings.Join(kids, ", ")),
+			})
+		}
+	}
+	sort.SliceStable(r.Issues, func(i, j int) bool { return r.Issues[i].Height < r.Issues[j].Height })
+	return r
+}
+
+// VerifyChain verifies the stored blocks and checks that transactions and
+// blocks agree about which block mined what
+func (c *Client) VerifyChain(ctx context.Context) (*ChainReport, error) {
+	blocks, err := c.ChainBlocks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := VerifyBlocks(blocks)
+
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT t.tx_id, COALESCE(t.status, 'pending'), COALESCE(t.block_hash, ''), COALESCE(b.block_hash, ''), COALESCE(b.block_index, 0)
+		 FROM transactions t
+		 LEFT JOIN block_transactions bt ON bt.tx_id = t.tx_id
+		 LEFT JOIN blocks b ON b.id = bt.block_id
+		 WHERE t.block_hash IS NOT NULL OR bt.tx_id IS NOT NULL
+		 ORDER BY t.tx_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[string]bool, len(blocks))
+	for _, b := range blocks {
+		stored[b.Hash] = true
+	}
+	for rows.Next() {
+		var txID, status, claimed, linked string
+		var height int64
+		if err := rows.Scan(&txID, &status, &claimed, &linked, &height); err != nil {
+			return nil, err
+		}
+		switch {
+		case linked == "" && !stored[claimed]:
+			r.Issues = append(r.Issues, ChainIssue{Problem: fmt.Sprintf("transaction %s names block %s, which is not stored", txID, claimed)})
+		case linked != "" && claimed != linked:
+			r.Issues = append(r.Issues, ChainIssue{Height: height, Hash: linked, Problem: fmt.Sprintf("transaction %s is linked here but names block %q", txID, claimed)})
+		case status != TxStatusMined:
+			r.Issues = append(r.Issues, ChainIssue{Height: height, Hash: claimed, Problem: fmt.Sprintf("transaction %s is in a block but %s", txID, status)})
+		}
+	}
+	return &r, rows.Err()
+}
+
+// UnspentOutputs returns every unspent output, oldest first. assetID
+// filters by asset; "*" returns all assets and "" only the native coin.
+func (c *Client) UnspentOutputs(ctx context.Context, assetID string) ([]UTXO, error) {
+	query := "SELECT " + utxoColumns + " FROM utxos WHERE COALESCE(spent, FALSE) = FALSE"
+	var args []interface{}
+	switch assetID {
+	case "*":
+	case "":
+		query += " AND asset_id IS NULL"
+	default:
+		query += " AND asset_id = $1"
+		args = append(args, assetID)
+	}
+	rows, err := c.db.QueryContext(ctx, query+" ORDER BY created_at, utxo_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UTXO
+	for rows.Next() {
+		u, err := scanUTXO(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, rows.Err()
+}
+
+// Supply is the unspent total of one asset. Issued is the supply the
+// assets table records, which the unspent total should equal; it is not
+// tracked for the native coin.
+type Supply struct {
+	Asset   string `json:"asset"` // empty for the native coin
+	Symbol  string `json:"symbol,omitempty"`
+	Amount  int64  `json:"amount"`
+	UTXOs   int64  `json:"utxos"`
+	Holders int64  `json:"holders"`
+	Issued  *int64 `json:"issued,omitempty"`
+}
+
+// SupplySummary returns the supply of the native coin followed by every
+// issued asset
+func (c *Client) SupplySummary(ctx context.Context) ([]Supply, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT '', '', COALESCE(SUM(amount), 0), COUNT(*), COUNT(DISTINCT owner_wallet_id), NULL
+		 FROM utxos WHERE COALESCE(spent, FALSE) = FALSE AND asset_id IS NULL
+		 UNION ALL
+		 SELECT a.asset_id, a.symbol, COALESCE(SUM(u.amount), 0), COUNT(u.utxo_id), COUNT(DISTINCT u.owner_wallet_id), a.supply
+		 FROM assets a LEFT JOIN utxos u ON u.asset_id = a.asset_id AND COALESCE(u.spent, FALSE) = FALSE
+		 GROUP BY a.asset_id, a.symbol, a.supply`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Supply
+	for rows.Next() {
+		var s Supply
+		var issued sql.NullInt64
+		if err := rows.Scan(&s.Asset, &s.Symbol, &s.Amount, &s.UTXOs, &s.Holders, &issued); err != nil {
+			return nil, err
+		}
+		if issued.Valid {
+			s.Issued = &issued.Int64
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out[1:], func(i, j int) bool { return out[i+1].Symbol < out[j+1].Symbol })
+	return out, nil
+}
+
+// OutputRepair is an output a mined transaction should have created that
+// is missing or differs from what is stored
+type OutputRepair struct {
+	TxID     string `json:"tx_id"`
+	UTXOID   string `json:"utxo_id"`
+	Owner    string `json:"owner_wallet_id"`
+	Asset    string `json:"asset,omitempty"`
+	Amount   int64  `json:"amount"`
+	Problem  string `json:"problem"`
+	Repaired bool   `json:"repaired"`
+}
+
+// RepairOutputs replays the transactions of the stored blocks and checks
+// that each one's receiver output (<txid>_recv) and change output
+// (<txid>_change, the spent inputs less the amount) exist. With apply set,
+// missing outputs are recreated unspent and unlocked; outputs that exist
+// with the wrong owner or amount, and transactions paying out more than
+// their stored inputs, are only reported. Outputs are recreated without
+// their lock and as unspent even if a lost input row recorded them spent,
+// so review the dry run first. Callers should rebuild balances afterwards.
+func (c *Client) RepairOutputs(ctx context.Context, apply bool) ([]OutputRepair, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT t.tx_id, t.sender_wallet_id, t.receiver_wallet_id, t.amount, COALESCE(t.asset_id, ''), COALESCE(t.tx_type, 'transfer')
+		 FROM transactions t JOIN blocks b ON b.block_hash = t.block_hash
+		 ORDER BY b.block_index, b.mined_at, t.created_at, t.tx_id`)
+	if err != nil {
+		return nil, err
+	}
+	type minedTx struct {
+		id, sender, receiver, asset, kind string
+		amount                            int64
+	}
+	var mined []minedTx
+	for rows.Next() {
+		var t minedTx
+		if err := rows.Scan(&t.id, &t.sender, &t.receiver, &t.amount, &t.asset, &t.kind); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		mined = append(mined, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	all, err := c.allOutputs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]UTXO, len(all))
+	inputs := map[string]int64{} // tx ID + asset -> value spent
+	for _, u := range all {
+		outputs[u.UTXOID] = u
+		if u.SpentInTxID != "" {
+			inputs[u.SpentInTxID+"\x00"+u.Asset] += u.Amount
+		}
+	}
+
+	var repairs []OutputRepair
+	check := func(t minedTx, utxoID, owner string, amount int64) error {
+		u, ok := outputs[utxoID]
+		r := OutputRepair{TxID: t.id, UTXOID: utxoID, Owner: owner, Asset: t.asset, Amount: amount}
+		switch {
+		case !ok:
+			r.Problem = "missing"
+			if apply {
+				if err := c.inTx(ctx, func(q querier) error {
+					return insertUTXO(ctx, q, utxoID, owner, t.asset, amount, nil)
+				}); err != nil {
+					return fmt.Errorf("recreate %s: %w", utxoID, err)
+				}
+				r.Repaired = true
+			}
+		case u.Owner != owner:
+			r.Problem = fmt.Sprintf("owned by %s", u.Owner)
+		case u.Amount != amount:
+			r.Problem = fmt.Sprintf("holds %d", u.Amount)
+		case u.Asset != t.asset:
+			r.Problem = fmt.Sprintf("holds asset %q", u.Asset)
+		default:
+			return nil
+		}
+		repairs = append(repairs, r)
+		return nil
+	}
+	for _, t := range mined {
+		if err := check(t, t.id+"_recv", t.receiver, t.amount); err != nil {
+			return repairs, err
+		}
+		spent := inputs[t.id+"\x00"+t.asset]
+		if t.kind != "issuance" && spent < t.amount {
+			// An input row was lost; whatever replaced it cannot be told apart
+			repairs = append(repairs, OutputRepair{TxID: t.id, Owner: t.sender, Asset: t.asset, Amount: t.amount - spent,
+				Problem: fmt.Sprintf("spends %d more than its stored inputs", t.amount-spent)})
+		}
+		if change := spent - t.amount; change > 0 {
+			if err := check(t, t.id+"_change", t.sender, change); err != nil {
+				return repairs, err
+			}
+		}
+	}
+	return repairs, nil
+}
+
+func (c *Client) allOutputs(ctx context.Context) ([]UTXO, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT "+utxoColumns+" FROM utxos ORDER BY created_at, utxo_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UTXO
+	for rows.Next() {
+		u, err := scanUTXO(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, rows.Err()
+}
+
+// RebuildStats recomputes the explorer aggregates (address_stats,
+// daily_stats and chain_stats) from the outputs, transactions and blocks,
+// replacing whatever they held
+func (c *Client) RebuildStats(ctx context.Context) error {
+	outputs, err := c.allOutputs(ctx)
+	if err != nil {
+		return err
+	}
+
+	addrs := map[string]*AddressStats{}
+	addr := func(id string, at time.Time) *AddressStats {
+		s, ok := addrs[id]
+		if !ok {
+			s = &AddressStats{WalletID: id}
+			addrs[id] = s
+		}
+		if s.FirstSeen == nil || at.Before(*s.FirstSeen) {
+			s.FirstSeen = &at
+		}
+		if s.LastSeen == nil || at.After(*s.LastSeen) {
+			s.LastSeen = &at
+		}
+		return s
+	}
+	type dayTotals struct{ txCount, volume, blockCount, difficultySum int64 }
+	days := map[string]*dayTotals{}
+	day := func(at time.Time) *dayTotals {
+		key := at.UTC().Format("2006-01-02")
+		d, ok := days[key]
+		if !ok {
+			d = &dayTotals{}
+			days[key] = d
+		}
+		return d
+	}
+	var chain ChainStats
+
+	for _, u := range outputs {
+		if u.Asset != "" {
+			continue
+		}
+		last := u.CreatedAt
+		if u.SpentAt != nil {
+			last = *u.SpentAt
+		}
+		s := addr(u.Owner, u.CreatedAt)
+		addr(u.Owner, last)
+		s.Received += u.Amount
+		if u.Spent {
+			s.Sent += u.Amount
+		} else {
+			s.Balance += u.Amount
+			s.UTXOCount++
+			chain.TotalSupply += u.Amount
+			chain.UTXOCount++
+		}
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT sender_wallet_id, receiver_wallet_id, amount, COALESCE(asset_id, ''), created_at FROM transactions")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var sender, receiver, asset string
+		var amount int64
+		var at time.Time
+		if err := rows.Scan(&sender, &receiver, &amount, &asset, &at); err != nil {
+			rows.Close()
+			return err
+		}
+		addr(sender, at).TxCount++
+		if receiver != sender {
+			addr(receiver, at).TxCount++
+		}
+		d := day(at)
+		d.txCount++
+		if asset == "" {
+			d.volume += amount
+		}
+		chain.TxCount++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = c.db.QueryContext(ctx, "SELECT COALESCE(difficulty, 0), mined_at FROM blocks")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var difficulty int64
+		var at time.Time
+		if err := rows.Scan(&difficulty, &at); err != nil {
+			rows.Close()
+			return err
+		}
+		d := day(at)
+		d.blockCount++
+		d.difficultySum += difficulty
+		chain.BlockCount++
+		if chain.FirstBlockAt == nil || at.Before(*chain.FirstBlockAt) {
+			first := at
+			chain.FirstBlockAt = &first
+		}
+		if chain.LastBlockAt == nil || at.After(*chain.LastBlockAt) {
+			last := at
+			chain.LastBlockAt = &last
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return c.inTx(ctx, func(q querier) error {
+		for _, stmt := range []string{"DELETE FROM address_stats", "DELETE FROM daily_stats"} {
+			if _, err := q.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		for _, s := range addrs {
+			if _, err := q.ExecContext(ctx,
+				`INSERT INTO address_stats (wallet_id, received, sent, balance, utxo_count, tx_count, first_seen, last_seen)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				s.WalletID, s.Received, s.Sent, s.Balance, s.UTXOCount, s.TxCount, s.FirstSeen, s.LastSeen,
+			); err != nil {
+				return fmt.Errorf("insert address stats: %w", err)
+			}
+		}
+		for key, d := range days {
+			if _, err := q.ExecContext(ctx,
+				"INSERT INTO daily_stats (day, tx_count, volume, block_count, difficulty_sum) VALUES ($1, $2, $3, $4, $5)",
+				key, d.txCount, d.volume, d.blockCount, d.difficultySum,
+			); err != nil {
+				return fmt.Errorf("insert daily stats: %w", err)
+			}
+		}
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO chain_stats (id, total_supply, utxo_count, tx_count, block_count, first_block_at, last_block_at)
+			 VALUES (1, $1, $2, $3, $4, $5, $6)
+			 ON CONFLICT (id) DO UPDATE SET
+			     total_supply = excluded.total_supply, utxo_count = excluded.utxo_count,
+			     tx_count = excluded.tx_count, block_count = excluded.block_count,
+			     first_block_at = excluded.first_block_at, last_block_at = excluded.last_block_at`,
+			chain.TotalSupply, chain.UTXOCount, chain.TxCount, chain.BlockCount, chain.FirstBlockAt, chain.LastBlockAt,
+		); err != nil {
+			return fmt.Errorf("update chain stats: %w", err)
+		}
+		return nil
+	})
+}
+
+// PruneLogs deletes activity log entries older than before and returns how
+// many were removed. The audit log is append-only and is not touched.
+func (c *Client) PruneLogs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := c.db.ExecContext(ctx, "DELETE FROM logs WHERE created_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// TxStatusDropped marks a pending transaction evicted from the mempool
+const TxStatusDropped = "dropped"
+
+// DropStalePending reverts pending transactions created before the cutoff:
+// their outputs are deleted, their inputs become unspent again and they
+// are marked dropped. Only plain transfers are dropped, and not those that
+// created locked outputs. A transaction whose outputs have since been
+// spent is kept unless the spender is dropped too, so the newest go first. It
+// returns the dropped transaction IDs; callers should rebuild the stats
+// and balances afterwards.
+func (c *Client) DropStalePending(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT tx_id FROM transactions
+		 WHERE block_hash IS NULL AND COALESCE(status, 'pending') = $1 AND created_at < $2
+		   AND COALESCE(tx_type, 'transfer') = 'transfer'
+		 ORDER BY created_at DESC, tx_id DESC`,
+		TxStatusPending, before)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, id := range ids {
+		err := c.inTx(ctx, func(q querier) error {
+			var spent int
+			if err := q.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM utxos WHERE utxo_id IN ($1, $2) AND (COALESCE(spent, FALSE) = TRUE OR lock_kind IS NOT NULL)",
+				id+"_recv", id+"_change",
+			).Scan(&spent); err != nil {
+				return err
+			}
+			if spent > 0 {
+				return errOutputsSpent
+			}
+			if _, err := q.ExecContext(ctx, "DELETE FROM utxos WHERE utxo_id IN ($1, $2)", id+"_recv", id+"_change"); err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx,
+				"UPDATE utxos SET spent = FALSE, spent_in_tx_id = NULL, spent_at = NULL WHERE spent_in_tx_id = $1", id,
+			); err != nil {
+				return err
+			}
+			_, err := q.ExecContext(ctx, "UPDATE transactions SET status = $1 WHERE tx_id = $2", TxStatusDropped, id)
+			return err
+		})
+		if err == errOutputsSpent {
+			continue
+		}
+		if err != nil {
+			return dropped, fmt.Errorf("drop %s: %w", id, err)
+		}
+		dropped = append(dropped, id)
+	}
+	return dropped, nil
+}
+
+var errOutputsSpent = errors.New("outputs already spent or locked")
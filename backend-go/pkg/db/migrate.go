@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// LoadMigrations parses the embedded NNNN_name.up.sql / NNNN_name.down.sql
+// files of a driver and returns them ordered by version. Both drivers share
+// the same version numbers and names.
+func LoadMigrations(driver string) ([]Migration, error) {
+	if driver != DriverPostgres && driver != DriverSQLite {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+	return loadMigrations(migrationFiles, "migrations/"+driver)
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.%s.sql", name, direction)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		body, err := fs.ReadFile(fsys, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		} else if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, parts[1])
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the version this build of the server expects
+func LatestSchemaVersion() int {
+	migrations, err := LoadMigrations(DriverPostgres)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func (c *Client) ensureMigrationTable(ctx context.Context) error {
+	_, err := c.db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+		     version INT PRIMARY KEY,
+		     name VARCHAR(255) NOT NULL,
+		     applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		 )`)
+	return err
+}
+
+func (c *Client) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := c.ensureMigrationTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := c.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest applied migration version (0 if none)
+func (c *Client) SchemaVersion(ctx context.Context) (int, error) {
+	if err := c.ensureMigrationTable(ctx); err != nil {
+		return 0, err
+	}
+	var v int
+	err := c.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&v)
+	return v, err
+}
+
+// CheckSchemaVersion fails unless the database is at exactly the version
+// this build expects
+func (c *Client) CheckSchemaVersion(ctx context.Context) error {
+	current, err := c.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	want := LatestSchemaVersion()
+	if current < want {
+		return fmt.Errorf("database schema is at version %d but this server needs %d; run `server migrate up`", current, want)
+	}
+	if current > want {
+		return fmt.Errorf("database schema is at version %d, newer than this server supports (%d)", current, want)
+	}
+	return nil
+}
+
+// MigrationStatus lists every known migration and whether it is applied
+func (c *Client) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations(c.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			at := at
+			s.Applied = true
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own
+// transaction, and returns the ones that were applied
+func (c *Client) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := LoadMigrations(c.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := c.inMigrationTx(ctx, m.Version, true, func(tx querier) error {
+			if !isBlankSQL(m.Up) {
+				if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the most recent steps migrations
+func (c *Client) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := LoadMigrations(c.dialect.name)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+		err := c.inMigrationTx(ctx, m.Version, false, func(tx querier) error {
+			if !isBlankSQL(m.Down) {
+				if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Baseline marks migrations up to version as applied without running them.
+// It is meant for databases that were created by hand from the old schema.sql.
+func (c *Client) Baseline(ctx context.Context, version int) error {
+	migrations, err := LoadMigrations(c.dialect.name)
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > len(migrations) {
+		return fmt.Errorf("baseline version must be between 1 and %d", len(migrations))
+	}
+	if err := c.ensureMigrationTable(ctx); err != nil {
+		return err
+	}
+	for _, m := range migrations[:version] {
+		_, err := c.db.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING",
+			m.Version, m.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inMigrationTx runs fn in a transaction holding an advisory lock so two
+// instances never migrate concurrently. The applied state is re-checked
+// under the lock.
+func (c *Client) inMigrationTx(ctx context.Context, version int, wantApplied bool, fn func(tx querier) error) error {
+	return c.inTx(ctx, func(tx querier) error {
+		// SQLite transactions already take the write lock when they begin
+		if c.dialect == postgresDialect {
+			if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))"); err != nil {
+				return err
+			}
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == wantApplied {
+			// Another instance got there first
+			return nil
+		}
+		return fn(tx)
+	})
+}
+
+// isBlankSQL reports whether a script contains only comments and whitespace
+func isBlankSQL(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
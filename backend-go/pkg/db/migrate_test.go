@@ -0,0 +1,96 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, driver := range []string{DriverPostgres, DriverSQLite} {
+		migrations, err := LoadMigrations(driver)
+		if err != nil {
+			t.Fatalf("%s: LoadMigrations: %v", driver, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: no migrations embedded", driver)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: migration %d has version %d", driver, i, m.Version)
+			}
+			if m.Down == "" {
+				t.Errorf("%s: migration %04d_%s has no down script", driver, m.Version, m.Name)
+			}
+			// Every index must be re-runnable
+			for _, line := range strings.Split(m.Up, "\n") {
+				if strings.HasPrefix(strings.TrimSpace(line), "CREATE INDEX ") && !strings.Contains(line, "IF NOT EXISTS") {
+					t.Errorf("%s: migration %04d_%s: index is not IF NOT EXISTS: %s", driver, m.Version, m.Name, line)
+				}
+			}
+		}
+		if LatestSchemaVersion() != migrations[len(migrations)-1].Version {
+			t.Errorf("%s: LatestSchemaVersion does not match the last migration", driver)
+		}
+	}
+}
+
+func TestMigrationsMatchAcrossDrivers(t *testing.T) {
+	pg, err := LoadMigrations(DriverPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lite, err := LoadMigrations(DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg) != len(lite) {
+		t.Fatalf("postgres has %d migrations, sqlite has %d", len(pg), len(lite))
+	}
+	for i := range pg {
+		if pg[i].Name != lite[i].Name {
+			t.Errorf("migration %d is %q on postgres but %q on sqlite", pg[i].Version, pg[i].Name, lite[i].Name)
+		}
+	}
+}
+
+func TestLoadMigrationsValidation(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"gap": {
+			"m/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+			"m/0003_c.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"missing up": {
+			"m/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"name mismatch": {
+			"m/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad version": {
+			"m/abc_a.up.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := loadMigrations(fsys, "m"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	ok := fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("SELECT 2;")},
+		"m/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/0001_a.down.sql": {Data: []byte("-- nothing to undo")},
+		"m/README.md":       {Data: []byte("ignored")},
+	}
+	migrations, err := loadMigrations(ok, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "a" || migrations[1].Name != "b" {
+		t.Fatalf("unexpected migrations: %+v", migrations)
+	}
+	if !isBlankSQL(migrations[0].Down) {
+		t.Error("comment-only script should count as blank")
+	}
+}
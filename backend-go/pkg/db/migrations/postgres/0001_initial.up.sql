@@ -1,6 +1,8 @@
--- Supabase SQL Schema for Blockchain Wallet System
+-- Initial schema for the Blockchain Wallet System (Supabase / PostgreSQL)
 -- COMPLIANT WITH FINAL PROJECT REQUIREMENTS
 
+CREATE EXTENSION IF NOT EXISTS pgcrypto; -- gen_random_uuid() on PostgreSQL < 13
+
 -- 1. Users table
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -113,13 +115,13 @@ CREATE TABLE IF NOT EXISTS beneficiaries (
 );
 
 -- Indexes for performance
-CREATE INDEX idx_wallets_user_id ON wallets(user_id);
-CREATE INDEX idx_wallets_wallet_id ON wallets(wallet_id);
-CREATE INDEX idx_utxos_owner ON utxos(owner_wallet_id);
-CREATE INDEX idx_utxos_spent ON utxos(spent);
-CREATE INDEX idx_transactions_sender ON transactions(sender_wallet_id);
-CREATE INDEX idx_transactions_receiver ON transactions(receiver_wallet_id);
-CREATE INDEX idx_transactions_status ON transactions(status);
-CREATE INDEX idx_logs_wallet ON logs(wallet_id);
-CREATE INDEX idx_blocks_hash ON blocks(block_hash);
-CREATE INDEX idx_blocks_index ON blocks(block_index); -- Important for blockchain sync
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_wallets_user_id ON wallets(user_id);
+CREATE INDEX IF NOT EXISTS idx_wallets_wallet_id ON wallets(wallet_id);
+CREATE INDEX IF NOT EXISTS idx_utxos_owner ON utxos(owner_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_utxos_spent ON utxos(spent);
+CREATE INDEX IF NOT EXISTS idx_transactions_sender ON transactions(sender_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_receiver ON transactions(receiver_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+CREATE INDEX IF NOT EXISTS idx_logs_wallet ON logs(wallet_id);
+CREATE INDEX IF NOT EXISTS idx_blocks_hash ON blocks(block_hash);
+CREATE INDEX IF NOT EXISTS idx_blocks_index ON blocks(block_index); -- Important for blockchain sync
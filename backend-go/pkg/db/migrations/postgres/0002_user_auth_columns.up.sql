@@ -0,0 +1,5 @@
+-- Databases created from early versions of schema.sql lack these columns,
+-- which UpdateUserPassword, GetUserByEmail and the profile settings rely on.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS zakat_enabled BOOLEAN DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
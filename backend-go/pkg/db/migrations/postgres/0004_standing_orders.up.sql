@@ -0,0 +1,32 @@
+-- Standing orders (scheduled / recurring transfers)
+CREATE TABLE IF NOT EXISTS standing_orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id),
+    receiver_wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id),
+    amount INT8 NOT NULL CHECK (amount > 0),
+    note TEXT,
+    schedule VARCHAR(100) NOT NULL, -- cron expression
+    next_run_at TIMESTAMP NOT NULL,
+    end_date TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- 'active', 'paused', 'cancelled', 'completed'
+    last_run_at TIMESTAMP,
+    last_error TEXT,
+    failure_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Standing order executions
+CREATE TABLE IF NOT EXISTS standing_order_runs (
+    id BIGSERIAL PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES standing_orders(id) ON DELETE CASCADE,
+    tx_id VARCHAR(255), -- set when the transfer was accepted
+    status VARCHAR(20) NOT NULL, -- 'success', 'failed'
+    error TEXT,
+    run_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_standing_orders_user ON standing_orders(user_id);
+CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders(status, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_standing_order_runs_order ON standing_order_runs(order_id, run_at DESC);
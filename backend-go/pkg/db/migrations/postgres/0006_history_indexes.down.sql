@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_receiver_page;
+DROP INDEX IF EXISTS idx_transactions_sender_page;
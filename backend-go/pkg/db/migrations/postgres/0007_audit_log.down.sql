@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+DROP INDEX IF EXISTS idx_logs_action;
+DROP INDEX IF EXISTS idx_logs_created;
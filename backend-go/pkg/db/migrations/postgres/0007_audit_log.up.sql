@@ -0,0 +1,31 @@
+-- Filters and keyset paging of the system log
+CREATE INDEX IF NOT EXISTS idx_logs_created ON logs(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_logs_action ON logs(action);
+
+-- Append-only, hash-chained audit log. Each hash covers the entry and the
+-- hash before it, so editing or removing a row breaks the chain.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq BIGINT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL, -- one of the audit event types in pkg/audit
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_type ON audit_log(event_type, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, seq);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_modify BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,29 @@
+-- Payment requests; payments are matched through the reference in the transaction note
+CREATE TABLE IF NOT EXISTS invoices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reference VARCHAR(32) UNIQUE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id),
+    amount INT8 NOT NULL CHECK (amount > 0),
+    memo TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- 'open', 'paid', 'underpaid', 'expired'
+    amount_paid INT8 NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    paid_at TIMESTAMP
+);
+
+-- Confirmed transactions matched to an invoice
+CREATE TABLE IF NOT EXISTS invoice_payments (
+    id BIGSERIAL PRIMARY KEY,
+    invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    tx_id VARCHAR(255) UNIQUE NOT NULL,
+    amount INT8 NOT NULL,
+    block_index INT8 NOT NULL,
+    block_hash VARCHAR(255) NOT NULL,
+    paid_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_user ON invoices(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_invoices_open ON invoices(status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice ON invoice_payments(invoice_id);
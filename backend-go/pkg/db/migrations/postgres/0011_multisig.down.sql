@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS multisig_signatures;
+DROP TABLE IF EXISTS multisig_proposals;
+DROP TABLE IF EXISTS multisig_keys;
+DROP TABLE IF EXISTS multisig_wallets;
+-- Fails while multisig wallet rows remain; they hold funds and are not removed here
+ALTER TABLE wallets ALTER COLUMN user_id SET NOT NULL;
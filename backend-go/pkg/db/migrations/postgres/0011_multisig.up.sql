@@ -0,0 +1,44 @@
+-- Multisig wallets are not owned by a single user
+ALTER TABLE wallets ALTER COLUMN user_id DROP NOT NULL;
+
+-- M-of-N policies behind multisig wallet addresses
+CREATE TABLE IF NOT EXISTS multisig_wallets (
+    wallet_id VARCHAR(255) PRIMARY KEY REFERENCES wallets(wallet_id),
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    threshold INT NOT NULL,
+    policy BYTEA NOT NULL, -- canonical encoding, see multisig.Policy.Encode
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Cosigner keys, for finding the wallets a key belongs to
+CREATE TABLE IF NOT EXISTS multisig_keys (
+    wallet_id VARCHAR(255) NOT NULL REFERENCES multisig_wallets(wallet_id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    PRIMARY KEY (wallet_id, public_key)
+);
+
+-- Spend proposals and the signatures collected for them
+CREATE TABLE IF NOT EXISTS multisig_proposals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    wallet_id VARCHAR(255) NOT NULL REFERENCES multisig_wallets(wallet_id),
+    receiver_wallet_id VARCHAR(255) NOT NULL,
+    amount INT8 NOT NULL CHECK (amount > 0),
+    note TEXT NOT NULL DEFAULT '',
+    tx_timestamp INT8 NOT NULL, -- part of the signed payload
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'executed', 'cancelled'
+    tx_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    executed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS multisig_signatures (
+    proposal_id UUID NOT NULL REFERENCES multisig_proposals(id) ON DELETE CASCADE,
+    public_key BYTEA NOT NULL,
+    signature BYTEA NOT NULL,
+    signed_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (proposal_id, public_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_multisig_keys_key ON multisig_keys(public_key);
+CREATE INDEX IF NOT EXISTS idx_multisig_proposals_wallet ON multisig_proposals(wallet_id, created_at DESC);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_utxos_escrow_arbiter;
+DROP INDEX IF EXISTS idx_utxos_escrow_payee;
+
+ALTER TABLE utxos DROP COLUMN escrow_arbiter;
+ALTER TABLE utxos DROP COLUMN escrow_payee;
+ALTER TABLE utxos DROP COLUMN lock_time;
+ALTER TABLE utxos DROP COLUMN lock_height;
+ALTER TABLE utxos DROP COLUMN lock_kind;
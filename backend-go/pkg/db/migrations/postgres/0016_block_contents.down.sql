@@ -0,0 +1,2 @@
+ALTER TABLE blocks DROP COLUMN entries;
+ALTER TABLE blocks DROP COLUMN block_time;
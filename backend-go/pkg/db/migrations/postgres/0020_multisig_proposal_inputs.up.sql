@@ -0,0 +1,6 @@
+-- The outputs a proposal spends (JSON list of UTXO IDs), fixed when it is
+-- proposed so cosigners sign the transaction's signature hash. Approvals on
+-- pending proposals from before this migration do not cover any inputs and
+-- can never form a valid witness, so those proposals are cancelled.
+ALTER TABLE multisig_proposals ADD COLUMN input_utxos TEXT;
+UPDATE multisig_proposals SET status = 'cancelled' WHERE status = 'pending';
@@ -0,0 +1,5 @@
+-- Setups made with 32-character tags cannot be kept in the narrower column
+DELETE FROM recovery_setups WHERE LENGTH(set_id) > 16;
+ALTER TABLE recovery_requests ALTER COLUMN set_id TYPE VARCHAR(16);
+ALTER TABLE recovery_guardians ALTER COLUMN set_id TYPE VARCHAR(16);
+ALTER TABLE recovery_setups ALTER COLUMN set_id TYPE VARCHAR(16);
@@ -0,0 +1,5 @@
+-- Recovery set tags grew from 4 to 16 random bytes (32 hex characters), so
+-- setups of different wallets do not collide. Older 8-character tags stay.
+ALTER TABLE recovery_setups ALTER COLUMN set_id TYPE VARCHAR(32);
+ALTER TABLE recovery_guardians ALTER COLUMN set_id TYPE VARCHAR(32);
+ALTER TABLE recovery_requests ALTER COLUMN set_id TYPE VARCHAR(32);
@@ -0,0 +1,11 @@
+-- One row per Zakat charge: the period (YYYY-MM) a wallet was charged for in
+-- an asset ('' for the native coin). The key stops a second charge for the
+-- same period, whether from a manual run or another instance.
+CREATE TABLE IF NOT EXISTS zakat_deductions (
+    wallet_id VARCHAR(64) NOT NULL,
+    asset_id VARCHAR(64) NOT NULL DEFAULT '',
+    period VARCHAR(7) NOT NULL,
+    tx_id VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (wallet_id, asset_id, period)
+);
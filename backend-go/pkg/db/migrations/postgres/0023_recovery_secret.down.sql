@@ -0,0 +1 @@
+ALTER TABLE recovery_requests DROP COLUMN secret_hash;
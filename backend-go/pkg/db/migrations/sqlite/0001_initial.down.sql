@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS beneficiaries;
+DROP TABLE IF EXISTS logs;
+DROP TABLE IF EXISTS block_transactions;
+DROP TABLE IF EXISTS blocks;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS utxos;
+DROP TABLE IF EXISTS wallets;
+DROP TABLE IF EXISTS otps;
+DROP TABLE IF EXISTS users;
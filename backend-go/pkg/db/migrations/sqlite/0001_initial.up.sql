@@ -0,0 +1,116 @@
+-- Initial schema for the Blockchain Wallet System (embedded SQLite)
+-- Mirrors postgres/0001_initial.up.sql. UUIDs are random hex text and
+-- timestamps are UTC text in the format the Go driver writes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    full_name VARCHAR(255),
+    cnic VARCHAR(50),
+    password_hash VARCHAR(255),
+    zakat_enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS otps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR(255) NOT NULL,
+    code VARCHAR(10) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS wallets (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id VARCHAR(255) UNIQUE NOT NULL,
+    public_key BLOB NOT NULL,
+    private_key_encrypted BLOB NOT NULL,
+    balance INTEGER DEFAULT 0,
+    zakat_last_deducted TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE(user_id)
+);
+
+CREATE TABLE IF NOT EXISTS utxos (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    utxo_id VARCHAR(255) UNIQUE NOT NULL,
+    owner_wallet_id VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL,
+    spent BOOLEAN DEFAULT FALSE,
+    spent_in_tx_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    spent_at TIMESTAMP,
+    FOREIGN KEY (owner_wallet_id) REFERENCES wallets(wallet_id)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    tx_id VARCHAR(255) UNIQUE NOT NULL,
+    sender_wallet_id VARCHAR(255) NOT NULL,
+    receiver_wallet_id VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL,
+    note TEXT,
+    tx_type VARCHAR(50) DEFAULT 'transfer',
+    sender_public_key BLOB,
+    signature BLOB NOT NULL,
+    status VARCHAR(50) DEFAULT 'pending',
+    block_hash VARCHAR(255),
+    ip_address VARCHAR(50),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    confirmed_at TIMESTAMP,
+    FOREIGN KEY (sender_wallet_id) REFERENCES wallets(wallet_id),
+    FOREIGN KEY (receiver_wallet_id) REFERENCES wallets(wallet_id)
+);
+
+CREATE TABLE IF NOT EXISTS blocks (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    block_index INTEGER NOT NULL,
+    block_hash VARCHAR(255) UNIQUE NOT NULL,
+    previous_hash VARCHAR(255) NOT NULL,
+    merkle_root VARCHAR(255),
+    nonce INTEGER NOT NULL,
+    difficulty INTEGER DEFAULT 5,
+    mined_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    miner_wallet_id VARCHAR(255) REFERENCES wallets(wallet_id)
+);
+
+CREATE TABLE IF NOT EXISTS block_transactions (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    block_id TEXT NOT NULL REFERENCES blocks(id) ON DELETE CASCADE,
+    tx_id VARCHAR(255) NOT NULL REFERENCES transactions(tx_id),
+    UNIQUE(block_id, tx_id)
+);
+
+CREATE TABLE IF NOT EXISTS logs (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    wallet_id VARCHAR(255),
+    action VARCHAR(100) NOT NULL,
+    details TEXT,
+    status VARCHAR(50),
+    ip_address VARCHAR(50),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    FOREIGN KEY (wallet_id) REFERENCES wallets(wallet_id)
+);
+
+CREATE TABLE IF NOT EXISTS beneficiaries (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    beneficiary_wallet_id VARCHAR(255) NOT NULL,
+    beneficiary_name VARCHAR(255),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE(user_id, beneficiary_wallet_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallets_user_id ON wallets(user_id);
+CREATE INDEX IF NOT EXISTS idx_wallets_wallet_id ON wallets(wallet_id);
+CREATE INDEX IF NOT EXISTS idx_utxos_owner ON utxos(owner_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_utxos_spent ON utxos(spent);
+CREATE INDEX IF NOT EXISTS idx_transactions_sender ON transactions(sender_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_receiver ON transactions(receiver_wallet_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_status ON transactions(status);
+CREATE INDEX IF NOT EXISTS idx_logs_wallet ON logs(wallet_id);
+CREATE INDEX IF NOT EXISTS idx_blocks_hash ON blocks(block_hash);
+CREATE INDEX IF NOT EXISTS idx_blocks_index ON blocks(block_index);
@@ -0,0 +1 @@
+-- No-op: the columns are part of the initial schema as well, so they are kept.
@@ -0,0 +1,2 @@
+-- No-op: SQLite databases never predate the initial schema, which already
+-- has password_hash, zakat_enabled and updated_at.
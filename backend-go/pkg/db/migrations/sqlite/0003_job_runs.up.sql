@@ -0,0 +1,12 @@
+-- Scheduled job run history
+CREATE TABLE IF NOT EXISTS job_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_name VARCHAR(100) NOT NULL,
+    attempt INTEGER NOT NULL DEFAULT 1,
+    status VARCHAR(20) NOT NULL, -- 'success', 'failed'
+    error TEXT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job ON job_runs(job_name, started_at DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_blocks_mined_at;
+DROP INDEX IF EXISTS idx_block_transactions_tx;
+DROP INDEX IF EXISTS idx_transactions_block_hash;
@@ -0,0 +1,4 @@
+-- Lookups for the block containing a transaction and for confirmation counts
+CREATE INDEX IF NOT EXISTS idx_transactions_block_hash ON transactions(block_hash);
+CREATE INDEX IF NOT EXISTS idx_block_transactions_tx ON block_transactions(tx_id);
+CREATE INDEX IF NOT EXISTS idx_blocks_mined_at ON blocks(mined_at);
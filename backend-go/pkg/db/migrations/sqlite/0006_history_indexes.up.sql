@@ -0,0 +1,3 @@
+-- Keyset pagination of a wallet's history, newest first, per direction
+CREATE INDEX IF NOT EXISTS idx_transactions_sender_page ON transactions(sender_wallet_id, created_at DESC, tx_id DESC);
+CREATE INDEX IF NOT EXISTS idx_transactions_receiver_page ON transactions(receiver_wallet_id, created_at DESC, tx_id DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS audit_log;
+DROP INDEX IF EXISTS idx_logs_action;
+DROP INDEX IF EXISTS idx_logs_created;
@@ -0,0 +1,30 @@
+-- Filters and keyset paging of the system log
+CREATE INDEX IF NOT EXISTS idx_logs_created ON logs(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_logs_action ON logs(action);
+
+-- Append-only, hash-chained audit log. Each hash covers the entry and the
+-- hash before it, so editing or removing a row breaks the chain.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq INTEGER PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL, -- one of the audit event types in pkg/audit
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_type ON audit_log(event_type, seq);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, seq);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_blocks_block_index;
+DROP TABLE IF EXISTS chain_stats;
+DROP TABLE IF EXISTS daily_stats;
+DROP TABLE IF EXISTS address_stats;
@@ -0,0 +1,84 @@
+-- Explorer aggregates, kept up to date by the writes that change them and
+-- backfilled here from existing data
+
+-- Per-address totals; received and sent count UTXO value, like a block explorer
+CREATE TABLE IF NOT EXISTS address_stats (
+    wallet_id VARCHAR(255) PRIMARY KEY,
+    received INT8 NOT NULL DEFAULT 0,
+    sent INT8 NOT NULL DEFAULT 0,
+    balance INT8 NOT NULL DEFAULT 0,
+    utxo_count INT8 NOT NULL DEFAULT 0,
+    tx_count INT8 NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_address_stats_balance ON address_stats(balance DESC, wallet_id);
+
+-- Per-day activity, keyed by the UTC date
+CREATE TABLE IF NOT EXISTS daily_stats (
+    day VARCHAR(10) PRIMARY KEY, -- 'YYYY-MM-DD'
+    tx_count INT8 NOT NULL DEFAULT 0,
+    volume INT8 NOT NULL DEFAULT 0,
+    block_count INT8 NOT NULL DEFAULT 0,
+    difficulty_sum INT8 NOT NULL DEFAULT 0
+);
+
+-- Network-wide totals in a single row
+CREATE TABLE IF NOT EXISTS chain_stats (
+    id INT PRIMARY KEY CHECK (id = 1),
+    total_supply INT8 NOT NULL DEFAULT 0,
+    utxo_count INT8 NOT NULL DEFAULT 0,
+    tx_count INT8 NOT NULL DEFAULT 0,
+    block_count INT8 NOT NULL DEFAULT 0,
+    first_block_at TIMESTAMP,
+    last_block_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_blocks_block_index ON blocks(block_index, mined_at DESC);
+
+INSERT INTO address_stats (wallet_id, received, sent, balance, utxo_count, first_seen, last_seen)
+SELECT owner_wallet_id,
+       SUM(amount),
+       SUM(CASE WHEN COALESCE(spent, FALSE) THEN amount ELSE 0 END),
+       SUM(CASE WHEN COALESCE(spent, FALSE) THEN 0 ELSE amount END),
+       SUM(CASE WHEN COALESCE(spent, FALSE) THEN 0 ELSE 1 END),
+       MIN(created_at),
+       MAX(COALESCE(spent_at, created_at))
+FROM utxos
+GROUP BY owner_wallet_id;
+
+INSERT INTO address_stats (wallet_id, first_seen, last_seen)
+SELECT a.wallet_id, MIN(a.created_at), MAX(a.created_at)
+FROM (SELECT sender_wallet_id AS wallet_id, created_at FROM transactions
+      UNION ALL
+      SELECT receiver_wallet_id, created_at FROM transactions) a
+WHERE NOT EXISTS (SELECT 1 FROM address_stats s WHERE s.wallet_id = a.wallet_id)
+GROUP BY a.wallet_id;
+
+UPDATE address_stats SET tx_count = (
+    SELECT COUNT(*) FROM transactions t
+    WHERE t.sender_wallet_id = address_stats.wallet_id OR t.receiver_wallet_id = address_stats.wallet_id
+);
+
+INSERT INTO daily_stats (day, tx_count, volume)
+SELECT substr(created_at, 1, 10), COUNT(*), SUM(amount)
+FROM transactions
+GROUP BY substr(created_at, 1, 10);
+
+-- WHERE TRUE lets SQLite tell the upsert clause apart from a join constraint
+INSERT INTO daily_stats (day, block_count, difficulty_sum)
+SELECT substr(mined_at, 1, 10), COUNT(*), SUM(COALESCE(difficulty, 0))
+FROM blocks
+WHERE TRUE
+GROUP BY substr(mined_at, 1, 10)
+ON CONFLICT (day) DO UPDATE SET block_count = excluded.block_count, difficulty_sum = excluded.difficulty_sum;
+
+INSERT INTO chain_stats (id, total_supply, utxo_count, tx_count, block_count, first_block_at, last_block_at)
+SELECT 1,
+       (SELECT COALESCE(SUM(amount), 0) FROM utxos WHERE COALESCE(spent, FALSE) = FALSE),
+       (SELECT COUNT(*) FROM utxos WHERE COALESCE(spent, FALSE) = FALSE),
+       (SELECT COUNT(*) FROM transactions),
+       (SELECT COUNT(*) FROM blocks),
+       (SELECT MIN(mined_at) FROM blocks),
+       (SELECT MAX(mined_at) FROM blocks);
@@ -0,0 +1,29 @@
+-- Payment requests; payments are matched through the reference in the transaction note
+CREATE TABLE IF NOT EXISTS invoices (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    reference VARCHAR(32) UNIQUE NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id),
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    memo TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- 'open', 'paid', 'underpaid', 'expired'
+    amount_paid INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    paid_at TIMESTAMP
+);
+
+-- Confirmed transactions matched to an invoice
+CREATE TABLE IF NOT EXISTS invoice_payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    invoice_id TEXT NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    tx_id VARCHAR(255) UNIQUE NOT NULL,
+    amount INTEGER NOT NULL,
+    block_index INTEGER NOT NULL,
+    block_hash VARCHAR(255) NOT NULL,
+    paid_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_user ON invoices(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_invoices_open ON invoices(status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_invoice_payments_invoice ON invoice_payments(invoice_id);
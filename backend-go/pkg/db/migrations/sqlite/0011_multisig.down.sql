@@ -0,0 +1,26 @@
+DROP TABLE IF EXISTS multisig_signatures;
+DROP TABLE IF EXISTS multisig_proposals;
+DROP TABLE IF EXISTS multisig_keys;
+DROP TABLE IF EXISTS multisig_wallets;
+
+-- Restores NOT NULL on wallets.user_id; fails while multisig wallet rows
+-- remain, since they hold funds and are not removed here
+PRAGMA defer_foreign_keys = ON;
+
+CREATE TABLE wallets_old AS SELECT * FROM wallets;
+DROP TABLE wallets;
+CREATE TABLE wallets (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id VARCHAR(255) UNIQUE NOT NULL,
+    public_key BLOB NOT NULL,
+    private_key_encrypted BLOB NOT NULL,
+    balance INTEGER DEFAULT 0,
+    zakat_last_deducted TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE(user_id)
+);
+INSERT INTO wallets SELECT * FROM wallets_old;
+DROP TABLE wallets_old;
+CREATE INDEX IF NOT EXISTS idx_wallets_user_id ON wallets(user_id);
+CREATE INDEX IF NOT EXISTS idx_wallets_wallet_id ON wallets(wallet_id);
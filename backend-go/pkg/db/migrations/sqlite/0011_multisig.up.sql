@@ -0,0 +1,64 @@
+-- Multisig wallets are not owned by a single user. SQLite cannot drop
+-- NOT NULL in place, so wallets is rebuilt; foreign keys pointing at it are
+-- checked at commit, once the rows are back.
+PRAGMA defer_foreign_keys = ON;
+
+CREATE TABLE wallets_old AS SELECT * FROM wallets;
+DROP TABLE wallets;
+CREATE TABLE wallets (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+    wallet_id VARCHAR(255) UNIQUE NOT NULL,
+    public_key BLOB NOT NULL,
+    private_key_encrypted BLOB NOT NULL,
+    balance INTEGER DEFAULT 0,
+    zakat_last_deducted TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE(user_id)
+);
+INSERT INTO wallets SELECT * FROM wallets_old;
+DROP TABLE wallets_old;
+CREATE INDEX IF NOT EXISTS idx_wallets_user_id ON wallets(user_id);
+CREATE INDEX IF NOT EXISTS idx_wallets_wallet_id ON wallets(wallet_id);
+
+-- M-of-N policies behind multisig wallet addresses
+CREATE TABLE IF NOT EXISTS multisig_wallets (
+    wallet_id VARCHAR(255) PRIMARY KEY REFERENCES wallets(wallet_id),
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    threshold INTEGER NOT NULL,
+    policy BLOB NOT NULL, -- canonical encoding, see multisig.Policy.Encode
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+-- Cosigner keys, for finding the wallets a key belongs to
+CREATE TABLE IF NOT EXISTS multisig_keys (
+    wallet_id VARCHAR(255) NOT NULL REFERENCES multisig_wallets(wallet_id) ON DELETE CASCADE,
+    public_key BLOB NOT NULL,
+    PRIMARY KEY (wallet_id, public_key)
+);
+
+-- Spend proposals and the signatures collected for them
+CREATE TABLE IF NOT EXISTS multisig_proposals (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    wallet_id VARCHAR(255) NOT NULL REFERENCES multisig_wallets(wallet_id),
+    receiver_wallet_id VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    note TEXT NOT NULL DEFAULT '',
+    tx_timestamp INTEGER NOT NULL, -- part of the signed payload
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'executed', 'cancelled'
+    tx_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    executed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS multisig_signatures (
+    proposal_id TEXT NOT NULL REFERENCES multisig_proposals(id) ON DELETE CASCADE,
+    public_key BLOB NOT NULL,
+    signature BLOB NOT NULL,
+    signed_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (proposal_id, public_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_multisig_keys_key ON multisig_keys(public_key);
+CREATE INDEX IF NOT EXISTS idx_multisig_proposals_wallet ON multisig_proposals(wallet_id, created_at DESC);
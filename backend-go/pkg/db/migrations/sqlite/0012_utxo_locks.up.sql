@@ -0,0 +1,10 @@
+-- Spending conditions on outputs: time locks and escrow (see utxo.Lock).
+-- lock_height and lock_time (unix seconds) are 0 when unused.
+ALTER TABLE utxos ADD COLUMN lock_kind VARCHAR(16);
+ALTER TABLE utxos ADD COLUMN lock_height BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE utxos ADD COLUMN lock_time BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE utxos ADD COLUMN escrow_payee VARCHAR(255);
+ALTER TABLE utxos ADD COLUMN escrow_arbiter VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_utxos_escrow_payee ON utxos(escrow_payee) WHERE escrow_payee IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_utxos_escrow_arbiter ON utxos(escrow_arbiter) WHERE escrow_arbiter IS NOT NULL;
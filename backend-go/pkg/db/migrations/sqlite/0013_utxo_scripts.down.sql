@@ -0,0 +1 @@
+ALTER TABLE utxos DROP COLUMN lock_script;
@@ -0,0 +1,2 @@
+-- Locking scripts on outputs with lock_kind 'script' (see pkg/script)
+ALTER TABLE utxos ADD COLUMN lock_script BLOB;
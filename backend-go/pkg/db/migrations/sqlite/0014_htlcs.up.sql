@@ -0,0 +1,23 @@
+-- Hash time-locked contracts. Each is a script-locked output (htlc_id is
+-- its utxo_id) that the receiver claims with the secret behind hash_lock,
+-- or the sender refunds after timeout (unix seconds).
+CREATE TABLE IF NOT EXISTS htlcs (
+    htlc_id VARCHAR(255) PRIMARY KEY,
+    tx_id VARCHAR(255) NOT NULL,
+    sender_wallet_id VARCHAR(255) NOT NULL,
+    receiver_wallet_id VARCHAR(255) NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    hash_lock VARCHAR(64) NOT NULL, -- hex SHA-256
+    claimer_key BLOB NOT NULL,
+    refunder_key BLOB NOT NULL,
+    timeout INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- 'open', 'claimed', 'refunded'
+    secret VARCHAR(255), -- hex, revealed by the claim
+    settle_tx_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    settled_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_htlcs_hash ON htlcs(hash_lock);
+CREATE INDEX IF NOT EXISTS idx_htlcs_sender ON htlcs(sender_wallet_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_htlcs_receiver ON htlcs(receiver_wallet_id, created_at DESC);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_utxos_asset;
+ALTER TABLE transactions DROP COLUMN asset_id;
+ALTER TABLE utxos DROP COLUMN asset_id;
+DROP TABLE IF EXISTS assets;
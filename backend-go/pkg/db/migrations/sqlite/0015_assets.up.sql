@@ -0,0 +1,17 @@
+-- Custom tokens. asset_id is derived from the issuer key and symbol (see
+-- pkg/asset); supply is the total issued.
+CREATE TABLE IF NOT EXISTS assets (
+    asset_id VARCHAR(64) PRIMARY KEY,
+    symbol VARCHAR(12) NOT NULL,
+    name VARCHAR(255),
+    issuer_key BLOB NOT NULL,
+    zakat_bps INTEGER NOT NULL DEFAULT 0 CHECK (zakat_bps BETWEEN 0 AND 10000),
+    supply INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+-- The asset an output or transaction moves; NULL for the native coin
+ALTER TABLE utxos ADD COLUMN asset_id VARCHAR(64);
+ALTER TABLE transactions ADD COLUMN asset_id VARCHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_utxos_asset ON utxos(asset_id, owner_wallet_id);
@@ -0,0 +1,5 @@
+-- What a block hashes over, so the chain can be verified from storage:
+-- the block's unix timestamp and its full entry list (JSON, in order,
+-- mining reward included). NULL for blocks stored before this migration.
+ALTER TABLE blocks ADD COLUMN block_time INT8;
+ALTER TABLE blocks ADD COLUMN entries TEXT;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS recovery_shares;
+DROP TABLE IF EXISTS recovery_requests;
+DROP TABLE IF EXISTS recovery_guardians;
+DROP TABLE IF EXISTS recovery_setups;
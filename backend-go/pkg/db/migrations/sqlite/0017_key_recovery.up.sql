@@ -0,0 +1,43 @@
+-- Social key recovery. A setup records how a wallet's seed was split into
+-- Shamir shares and which guardian holds each; the shares themselves are
+-- never stored. Only the newest setup of a wallet is active.
+CREATE TABLE IF NOT EXISTS recovery_setups (
+    set_id VARCHAR(16) PRIMARY KEY, -- the set tag carried by every share
+    wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id) ON DELETE CASCADE,
+    threshold INTEGER NOT NULL,
+    shares INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    revoked_at TIMESTAMP -- set when a newer setup replaces this one
+);
+
+CREATE TABLE IF NOT EXISTS recovery_guardians (
+    set_id VARCHAR(16) NOT NULL REFERENCES recovery_setups(set_id) ON DELETE CASCADE,
+    share_index INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (set_id, share_index)
+);
+
+-- Requests collecting shares back. Submitted shares are sealed with the
+-- master key and deleted once the request is closed.
+CREATE TABLE IF NOT EXISTS recovery_requests (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    wallet_id VARCHAR(255) NOT NULL REFERENCES wallets(wallet_id) ON DELETE CASCADE,
+    set_id VARCHAR(16) NOT NULL REFERENCES recovery_setups(set_id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- 'open', 'completed', 'failed'
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS recovery_shares (
+    request_id TEXT NOT NULL REFERENCES recovery_requests(id) ON DELETE CASCADE,
+    share_index INTEGER NOT NULL,
+    share_encrypted BLOB NOT NULL,
+    submitted_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (request_id, share_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_setups_wallet ON recovery_setups(wallet_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_recovery_requests_wallet ON recovery_requests(wallet_id, created_at DESC);
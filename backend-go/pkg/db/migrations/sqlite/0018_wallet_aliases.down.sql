@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS wallet_aliases;
+DROP INDEX IF EXISTS idx_users_email_lower;
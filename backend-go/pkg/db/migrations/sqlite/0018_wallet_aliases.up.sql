@@ -0,0 +1,9 @@
+-- Directory aliases such as @shop, stored lower-case without the "@". A
+-- wallet has at most one; setting another replaces it.
+CREATE TABLE IF NOT EXISTS wallet_aliases (
+    alias VARCHAR(20) PRIMARY KEY,
+    wallet_id VARCHAR(255) UNIQUE NOT NULL REFERENCES wallets(wallet_id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
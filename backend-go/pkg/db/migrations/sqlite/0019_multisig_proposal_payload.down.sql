@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_multisig_proposals_payload;
@@ -0,0 +1,5 @@
+-- Cosigners approve a proposal by signing its payload, so a wallet may
+-- propose each payload only once; otherwise the approvals of an executed
+-- proposal would count towards a copy of it.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_multisig_proposals_payload
+    ON multisig_proposals(wallet_id, receiver_wallet_id, amount, note, tx_timestamp);
@@ -0,0 +1 @@
+-- No-op: see the up migration.
@@ -0,0 +1,2 @@
+-- No-op: SQLite does not enforce VARCHAR lengths, so the 32-character
+-- recovery set tags already fit.
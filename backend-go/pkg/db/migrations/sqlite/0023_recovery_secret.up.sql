@@ -0,0 +1,5 @@
+-- Hash of the secret returned to whoever opened a recovery request.
+-- Completing the request needs the secret, so knowing the request ID is
+-- not enough. Requests opened before this have no hash and cannot be
+-- completed; they lapse within a day.
+ALTER TABLE recovery_requests ADD COLUMN secret_hash BLOB NOT NULL DEFAULT X'';
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"time"
+
+	"blockchain-wallet/pkg/utxo"
+)
+
+// Transaction statuses
+const (
+	TxStatusPending = "pending"
+	TxStatusMined   = "mined"
+)
+
+// User is a registered account
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	FullName     string    `json:"full_name"`
+	CNIC         string    `json:"cnic"`
+	PasswordHash string    `json:"-"`
+	ZakatEnabled bool      `json:"zakat_enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Wallet is a user's key pair and cached balance
+type Wallet struct {
+	ID                  string     `json:"id"`
+	UserID              string     `json:"user_id"`
+	WalletID            string     `json:"wallet_id"`
+	PublicKey           []byte     `json:"public_key"`
+	PrivateKeyEncrypted []byte     `json:"-"`
+	Balance             int64      `json:"balance"`
+	ZakatLastDeducted   *time.Time `json:"zakat_last_deducted"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// External reports whether the wallet was only registered as a transfer
+// recipient, with no owner or key (see Transfer.RegisterReceiver)
+func (w *Wallet) External() bool {
+	return w.UserID == "" && len(w.PublicKey) == 0
+}
+
+// Profile is a user joined with their wallet
+type Profile struct {
+	UserID            string     `json:"user_id"`
+	Email             string     `json:"email"`
+	FullName          string     `json:"full_name"`
+	CNIC              string     `json:"cnic"`
+	WalletID          string     `json:"wallet_id"`
+	PublicKey         []byte     `json:"public_key"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ZakatLastDeducted *time.Time `json:"zakat_last_deducted"`
+	ZakatEnabled      bool       `json:"zakat_enabled"`
+}
+
+// UTXO is a persisted transaction output
+type UTXO struct {
+	UTXOID      string     `json:"utxo_id"`
+	Owner       string     `json:"owner_wallet_id"`
+	Amount      int64      `json:"amount"`
+	Spent       bool       `json:"spent"`
+	SpentInTxID string     `json:"spent_in_tx_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SpentAt     *time.Time `json:"spent_at,omitempty"`
+	Lock        *utxo.Lock `json:"lock,omitempty"`
+	Asset       string     `json:"asset,omitempty"` // empty for the native coin
+}
+
+// Escrow is an escrow output with its state (utxo.EscrowHeld, Released or
+// Refunded)
+type Escrow struct {
+	UTXO
+	Status string `json:"status"`
+}
+
+// TxRecord is a persisted transaction
+type TxRecord struct {
+	TxID             string     `json:"tx_id"`
+	SenderWalletID   string     `json:"sender_wallet_id"`
+	ReceiverWalletID string     `json:"receiver_wallet_id"`
+	Amount           int64      `json:"amount"`
+	Note             string     `json:"note"`
+	TxType           string     `json:"tx_type"`
+	SenderPublicKey  []byte     `json:"sender_public_key,omitempty"`
+	Signature        []byte     `json:"signature,omitempty"`
+	Status           string     `json:"status"`
+	BlockHash        string     `json:"block_hash,omitempty"`
+	IPAddress        string     `json:"ip_address,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at,omitempty"`
+	BlockIndex       *int64     `json:"block_index,omitempty"`
+	Confirmations    int64      `json:"confirmations"`
+	Asset            string     `json:"asset,omitempty"` // empty for the native coin
+}
+
+// BlockRecord is a persisted block header
+type BlockRecord struct {
+	ID            string    `json:"id"`
+	Index         int64     `json:"block_index"`
+	Hash          string    `json:"block_hash"`
+	PreviousHash  string    `json:"previous_hash"`
+	MerkleRoot    string    `json:"merkle_root,omitempty"`
+	Nonce         int64     `json:"nonce"`
+	Difficulty    int       `json:"difficulty"`
+	MinedAt       time.Time `json:"mined_at"`
+	MinerWalletID string    `json:"miner_wallet_id,omitempty"`
+	TxIDs         []string  `json:"tx_ids,omitempty"`
+	TxCount       int64     `json:"tx_count"`
+}
+
+// AddressStats are the explorer totals of one wallet. Received and sent are
+// the value of outputs paid to and spent by it, change included.
+type AddressStats struct {
+	WalletID  string     `json:"wallet_id"`
+	Received  int64      `json:"received"`
+	Sent      int64      `json:"sent"`
+	Balance   int64      `json:"balance"`
+	UTXOCount int64      `json:"utxo_count"`
+	TxCount   int64      `json:"tx_count"`
+	FirstSeen *time.Time `json:"first_seen"`
+	LastSeen  *time.Time `json:"last_seen"`
+}
+
+// DailyStats is the network activity of one UTC day
+type DailyStats struct {
+	Day           string  `json:"day"`
+	TxCount       int64   `json:"tx_count"`
+	Volume        int64   `json:"volume"`
+	BlockCount    int64   `json:"block_count"`
+	AvgDifficulty float64 `json:"avg_difficulty"`
+}
+
+// ChainStats are network-wide totals
+type ChainStats struct {
+	TotalSupply  int64      `json:"total_supply"`
+	UTXOCount    int64      `json:"utxo_count"`
+	TxCount      int64      `json:"tx_count"`
+	BlockCount   int64      `json:"block_count"`
+	FirstBlockAt *time.Time `json:"first_block_at"`
+	LastBlockAt  *time.Time `json:"last_block_at"`
+	// AvgBlockTime is the mean interval between stored blocks in seconds
+	AvgBlockTime float64 `json:"avg_block_time"`
+}
+
+// LogEntry is a row of the system log
+type LogEntry struct {
+	ID        string    `json:"id"`
+	WalletID  string    `json:"wallet_id"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details"`
+	Status    string    `json:"status"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Beneficiary is a saved recipient of a user
+type Beneficiary struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	WalletID  string    `json:"beneficiary_wallet_id"`
+	Name      string    `json:"beneficiary_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"blockchain-wallet/pkg/multisig"
+)
+
+// InsertMultisigWallet registers a multisig wallet. It gets a wallets row
+// with no owning user, holding the encoded policy as its public key, so it
+// can own UTXOs and send transactions like any other wallet.
+func (c *Client) InsertMultisigWallet(ctx context.Context, w multisig.Wallet) error {
+	policy := w.Policy.Encode()
+	var createdBy *string
+	if w.CreatedBy != "" {
+		createdBy = &w.CreatedBy
+	}
+	return c.inTx(ctx, func(q querier) error {
+		if _, err := q.ExecContext(ctx,
+			"INSERT INTO wallets (user_id, wallet_id, public_key, private_key_encrypted) VALUES (NULL, $1, $2, $3)",
+			w.Address, policy, []byte{},
+		); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO multisig_wallets (wallet_id, name, threshold, policy, created_by)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			w.Address, w.Name, w.Policy.Threshold, policy, createdBy,
+		); err != nil {
+			return err
+		}
+		for _, k := range w.Policy.Keys {
+			if _, err := q.ExecContext(ctx,
+				"INSERT INTO multisig_keys (wallet_id, public_key) VALUES ($1, $2)",
+				w.Address, []byte(k),
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const multisigWalletColumns = "m.wallet_id, m.name, m.policy, COALESCE(m.created_by, ''), m.created_at"
+
+func scanMultisigWallet(row rowScanner) (multisig.Wallet, error) {
+	var w multisig.Wallet
+	var policy []byte
+	if err := row.Scan(&w.Address, &w.Name, &policy, &w.CreatedBy, &w.CreatedAt); err != nil {
+		return w, err
+	}
+	p, err := multisig.DecodePolicy(policy)
+	if err != nil {
+		return w, fmt.Errorf("multisig wallet %s: %w", w.Address, err)
+	}
+	w.Policy = p
+	return w, nil
+}
+
+// GetMultisigWallet returns the multisig wallet at an address
+func (c *Client) GetMultisigWallet(ctx context.Context, address string) (multisig.Wallet, error) {
+	return scanMultisigWallet(c.db.QueryRowContext(ctx,
+		"SELECT "+multisigWalletColumns+" FROM multisig_wallets m WHERE m.wallet_id = $1",
+		address,
+	))
+}
+
+// GetMultisigWalletsByKey returns the multisig wallets a key cosigns
+func (c *Client) GetMultisigWalletsByKey(ctx context.Context, pub ed25519.PublicKey) ([]multisig.Wallet, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+multisigWalletColumns+` FROM multisig_wallets m
+		 JOIN multisig_keys k ON k.wallet_id = m.wallet_id
+		 WHERE k.public_key = $1 ORDER BY m.created_at DESC`,
+		[]byte(pub),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []multisig.Wallet
+	for rows.Next() {
+		w, err := scanMultisigWallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+// InsertMultisigProposal records a spend proposal and returns its ID. It
+// returns multisig.ErrDuplicateProposal if the wallet has ever had a
+// proposal for the same transfer and timestamp, whatever its status.
+func (c *Client) InsertMultisigProposal(ctx context.Context, p multisig.Proposal) (string, error) {
+	inputs, err := json.Marshal(p.Inputs)
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = c.inTx(ctx, func(q querier) error {
+		var n int
+		err := q.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM multisig_proposals
+			 WHERE wallet_id = $1 AND receiver_wallet_id = $2 AND amount = $3 AND note = $4 AND tx_timestamp = $5`,
+			p.WalletID, p.ReceiverID, p.Amount, p.Note, p.Timestamp,
+		).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return multisig.ErrDuplicateProposal
+		}
+		return q.QueryRowContext(ctx,
+			`INSERT INTO multisig_proposals (wallet_id, receiver_wallet_id, amount, note, tx_timestamp, input_utxos, status)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			p.WalletID, p.ReceiverID, p.Amount, p.Note, p.Timestamp, string(inputs), p.Status,
+		).Scan(&id)
+	})
+	return id, err
+}
+
+const multisigProposalColumns = `id, wallet_id, receiver_wallet_id, amount, note, tx_timestamp, input_utxos, status,
+	COALESCE(tx_id, ''), created_at, executed_at`
+
+func scanMultisigProposal(row rowScanner) (multisig.Proposal, error) {
+	var p multisig.Proposal
+	var inputs sql.NullString
+	if err := row.Scan(&p.ID, &p.WalletID, &p.ReceiverID, &p.Amount, &p.Note, &p.Timestamp, &inputs, &p.Status,
+		&p.TxID, &p.CreatedAt, &p.ExecutedAt); err != nil {
+		return p, err
+	}
+	if inputs.Valid {
+		if err := json.Unmarshal([]byte(inputs.String), &p.Inputs); err != nil {
+			return p, fmt.Errorf("proposal %s: inputs: %w", p.ID, err)
+		}
+	}
+	return p, nil
+}
+
+// GetMultisigProposal returns a proposal with its signatures
+func (c *Client) GetMultisigProposal(ctx context.Context, id string) (multisig.Proposal, error) {
+	p, err := scanMultisigProposal(c.db.QueryRowContext(ctx,
+		"SELECT "+multisigProposalColumns+" FROM multisig_proposals WHERE id = $1", id,
+	))
+	if err != nil {
+		return p, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT public_key, signature FROM multisig_signatures WHERE proposal_id = $1 ORDER BY signed_at, public_key",
+		id,
+	)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	p.Signatures = []multisig.Signature{}
+	for rows.Next() {
+		var s multisig.Signature
+		var pub []byte
+		if err := rows.Scan(&pub, &s.Signature); err != nil {
+			return p, err
+		}
+		s.PublicKey = pub
+		p.Signatures = append(p.Signatures, s)
+	}
+	return p, rows.Err()
+}
+
+// GetMultisigProposals returns up to limit of a wallet's proposals, newest
+// first, without their signatures. status narrows the list when set.
+func (c *Client) GetMultisigProposals(ctx context.Context, walletID, status string, limit int) ([]multisig.Proposal, error) {
+	w := &whereBuilder{}
+	w.add("wallet_id = ?", walletID)
+	if status != "" {
+		w.add("status = ?", status)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+multisigProposalColumns+" FROM multisig_proposals"+w.String()+
+			fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []multisig.Proposal
+	for rows.Next() {
+		p, err := scanMultisigProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// AddMultisigSignature stores a cosigner's signature on a pending proposal.
+// Signing twice keeps the first signature.
+func (c *Client) AddMultisigSignature(ctx context.Context, proposalID string, s multisig.Signature) error {
+	res, err := c.db.ExecContext(ctx,
+		`INSERT INTO multisig_signatures (proposal_id, public_key, signature)
+		 SELECT id, $2, $3 FROM multisig_proposals WHERE id = $1 AND status = 'pending'
+		 ON CONFLICT (proposal_id, public_key) DO NOTHING`,
+		proposalID, []byte(s.PublicKey), s.Signature,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Either a repeat signature or a proposal that is no longer pending
+		p, err := c.GetMultisigProposal(ctx, proposalID)
+		if err != nil {
+			return err
+		}
+		if p.Status != multisig.ProposalPending {
+			return fmt.Errorf("proposal is %s", p.Status)
+		}
+	}
+	return nil
+}
+
+// CloseMultisigProposal moves a pending proposal to executed at the given
+// time (with its transaction) or cancelled. It returns sql.ErrNoRows when the proposal is
+// not pending, so a proposal is only ever executed once.
+func (c *Client) CloseMultisigProposal(ctx context.Context, id, status, txID string, at time.Time) error {
+	var tx *string
+	var executedAt *time.Time
+	if status == multisig.ProposalExecuted {
+		tx, executedAt = &txID, &at
+	}
+	res, err := c.db.ExecContext(ctx,
+		`UPDATE multisig_proposals SET status = $1, tx_id = $2, executed_at = $3
+		 WHERE id = $4 AND status = 'pending'`,
+		status, tx, executedAt, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"blockchain-wallet/pkg/recovery"
+)
+
+// InsertRecoverySetup records a new split of a wallet's seed. Earlier
+// setups are revoked and their open requests fail, since their shares no
+// longer count.
+func (c *Client) InsertRecoverySetup(ctx context.Context, s recovery.Setup) error {
+	return c.inTx(ctx, func(q querier) error {
+		if _, err := q.ExecContext(ctx,
+			"UPDATE recovery_setups SET revoked_at = $2 WHERE wallet_id = $1 AND revoked_at IS NULL",
+			s.WalletID, s.CreatedAt,
+		); err != nil {
+			return err
+		}
+		if err := closeRecoveryRequests(ctx, q,
+			"wallet_id = $1 AND status = 'open'", s.WalletID, recovery.StatusFailed, s.CreatedAt); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO recovery_setups (set_id, wallet_id, threshold, shares, created_at)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			s.SetID, s.WalletID, s.Threshold, s.Shares, s.CreatedAt,
+		); err != nil {
+			return err
+		}
+		for _, g := range s.Guardians {
+			if _, err := q.ExecContext(ctx,
+				"INSERT INTO recovery_guardians (set_id, share_index, name, email) VALUES ($1, $2, $3, $4)",
+				s.SetID, g.Index, g.Name, g.Email,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRecoverySetup returns the active setup of a wallet with its guardians,
+// or sql.ErrNoRows if it has none
+func (c *Client) GetRecoverySetup(ctx context.Context, walletID string) (recovery.Setup, error) {
+	var s recovery.Setup
+	err := c.db.QueryRowContext(ctx,
+		`SELECT set_id, wallet_id, threshold, shares, created_at FROM recovery_setups
+		 WHERE wallet_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC LIMIT 1`,
+		walletID,
+	).Scan(&s.SetID, &s.WalletID, &s.Threshold, &s.Shares, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT share_index, name, email FROM recovery_guardians WHERE set_id = $1 ORDER BY share_index",
+		s.SetID,
+	)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	s.Guardians = []recovery.Guardian{}
+	for rows.Next() {
+		var g recovery.Guardian
+		if err := rows.Scan(&g.Index, &g.Name, &g.Email); err != nil {
+			return s, err
+		}
+		s.Guardians = append(s.Guardians, g)
+	}
+	return s, rows.Err()
+}
+
+// InsertRecoveryRequest opens a request against a setup and returns its ID
+func (c *Client) InsertRecoveryRequest(ctx context.Context, r recovery.Request, ipAddress string) (string, error) {
+	hash := r.SecretHash
+	if hash == nil {
+		hash = []byte{} // a nil slice would be stored as NULL
+	}
+	var id string
+	err := c.db.QueryRowContext(ctx,
+		`INSERT INTO recovery_requests (wallet_id, set_id, status, ip_address, expires_at, secret_hash)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		r.WalletID, r.SetID, recovery.StatusOpen, ipAddress, r.ExpiresAt, hash,
+	).Scan(&id)
+	return id, err
+}
+
+// GetRecoveryRequest returns a request with the indexes of the shares it
+// has collected
+func (c *Client) GetRecoveryRequest(ctx context.Context, id string) (recovery.Request, error) {
+	var r recovery.Request
+	err := c.db.QueryRowContext(ctx,
+		`SELECT r.id, r.wallet_id, r.set_id, s.threshold, r.status, r.created_at, r.expires_at, r.closed_at, r.secret_hash
+		 FROM recovery_requests r JOIN recovery_setups s ON s.set_id = r.set_id
+		 WHERE r.id = $1`,
+		id,
+	).Scan(&r.ID, &r.WalletID, &r.SetID, &r.Threshold, &r.Status, &r.CreatedAt, &r.ExpiresAt, &r.ClosedAt, &r.SecretHash)
+	if err != nil {
+		return r, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT share_index FROM recovery_shares WHERE request_id = $1 ORDER BY share_index", id)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	r.Collected = []int{}
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			return r, err
+		}
+		r.Collected = append(r.Collected, i)
+	}
+	return r, rows.Err()
+}
+
+// AddRecoveryShare stores a sealed share on an open request. Returns
+// sql.ErrNoRows if the request is not open or already has that share.
+func (c *Client) AddRecoveryShare(ctx context.Context, requestID string, index int, shareEnc []byte) error {
+	res, err := c.db.ExecContext(ctx,
+		`INSERT INTO recovery_shares (request_id, share_index, share_encrypted)
+		 SELECT id, $2, $3 FROM recovery_requests WHERE id = $1 AND status = 'open'
+		 ON CONFLICT (request_id, share_index) DO NOTHING`,
+		requestID, index, shareEnc,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetRecoveryShares returns the sealed shares of a request
+func (c *Client) GetRecoveryShares(ctx context.Context, requestID string) ([][]byte, error) {
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT share_encrypted FROM recovery_shares WHERE request_id = $1 ORDER BY share_index", requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list [][]byte
+	for rows.Next() {
+		var enc []byte
+		if err := rows.Scan(&enc); err != nil {
+			return nil, err
+		}
+		list = append(list, enc)
+	}
+	return list, rows.Err()
+}
+
+// CloseRecoveryRequest marks an open request completed or failed and
+// deletes its shares. Returns sql.ErrNoRows if it is not open.
+func (c *Client) CloseRecoveryRequest(ctx context.Context, id, status string, at time.Time) error {
+	return c.inTx(ctx, func(q querier) error {
+		var found string
+		err := q.QueryRowContext(ctx,
+			"SELECT id FROM recovery_requests WHERE id = $1 AND status = 'open'", id,
+		).Scan(&found)
+		if err != nil {
+			return err
+		}
+		return closeRecoveryRequests(ctx, q, "id = $1", id, status, at)
+	})
+}
+
+// ExpireRecoveryRequests marks open requests past their deadline expired,
+// deleting the shares they collected, and returns how many were
+func (c *Client) ExpireRecoveryRequests(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := c.inTx(ctx, func(q querier) error {
+		if err := q.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM recovery_requests WHERE status = 'open' AND expires_at <= $1", now,
+		).Scan(&n); err != nil {
+			return err
+		}
+		return closeRecoveryRequests(ctx, q, "status = 'open' AND expires_at <= $1", now, recovery.StatusExpired, now)
+	})
+	return n, err
+}
+
+// closeRecoveryRequests deletes the shares of the requests matching where,
+// whose one argument is $1, and sets their status
+func closeRecoveryRequests(ctx context.Context, q querier, where string, arg interface{}, status string, at time.Time) error {
+	if _, err := q.ExecContext(ctx,
+		"DELETE FROM recovery_shares WHERE request_id IN (SELECT id FROM recovery_requests WHERE "+where+")",
+		arg,
+	); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx,
+		"UPDATE recovery_requests SET status = $2, closed_at = $3 WHERE "+where,
+		arg, status, at,
+	)
+	return err
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"crypto/ed25519"
+	"time"
+
+	"blockchain-wallet/pkg/asset"
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/directory"
+	"blockchain-wallet/pkg/htlc"
+	"blockchain-wallet/pkg/invoice"
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/orders"
+	"blockchain-wallet/pkg/recovery"
+	"blockchain-wallet/pkg/report"
+	"blockchain-wallet/pkg/utxo"
+	"blockchain-wallet/pkg/webhook"
+)
+
+// UserRepository stores accounts
+type UserRepository interface {
+	InsertUser(ctx context.Context, email, fullName, cnic string) (string, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByWalletID(ctx context.Context, walletID string) (*Profile, error)
+	UpdateUserPassword(ctx context.Context, userID, passwordHash string) error
+	UpdateUserProfile(ctx context.Context, userID, fullName, email string) error
+	UpdateUserNameAndSettings(ctx context.Context, userID, fullName string, zakatEnabled bool) error
+	UpdateUserEmail(ctx context.Context, userID, email string) error
+}
+
+// OTPRepository stores one-time codes
+type OTPRepository interface {
+	InsertOTP(ctx context.Context, email, code string, expiresAt time.Time) error
+	VerifyOTP(ctx context.Context, email, code string) (bool, error)
+	DeleteExpiredOTPs(ctx context.Context) (int64, error)
+}
+
+// WalletRepository stores wallets and their keys
+type WalletRepository interface {
+	InsertWallet(ctx context.Context, userID, walletID string, pubKey, privKeyEnc []byte) error
+	GetWalletByID(ctx context.Context, walletID string) (*Wallet, error)
+	UpdateWalletKey(ctx context.Context, walletID string, privKeyEnc []byte) error
+	GetUserWalletByUserID(ctx context.Context, userID string) (*Wallet, error)
+	GetAllWallets(ctx context.Context) ([]Wallet, error)
+	ReconcileBalances(ctx context.Context) (int64, error)
+	ZakatDeducted(ctx context.Context, walletID, assetID, period string) (bool, error)
+}
+
+// UTXORepository stores transaction outputs
+type UTXORepository interface {
+	InsertUTXO(ctx context.Context, utxoID, ownerWalletID string, amount int64) error
+	GetUTXOByID(ctx context.Context, utxoID string) (*UTXO, error)
+	GetUnspentUTXOs(ctx context.Context, walletID string) ([]UTXO, error)
+	GetBalance(ctx context.Context, walletID string) (int64, error)
+	SpendUTXO(ctx context.Context, utxoID, txID string) error
+	InsertLockedUTXO(ctx context.Context, utxoID, ownerWalletID string, amount int64, lock utxo.Lock) error
+	SpendUTXOAt(ctx context.Context, utxoID, txID string, height, now int64) error
+	SpendEscrowUTXO(ctx context.Context, utxoID, txID string) error
+	SpendScriptUTXO(ctx context.Context, utxoID, txID string) error
+	GetEscrows(ctx context.Context, walletID string, limit int) ([]Escrow, error)
+	InsertAssetUTXO(ctx context.Context, utxoID, ownerWalletID, assetID string, amount int64, lock *utxo.Lock) error
+	GetAssetBalances(ctx context.Context, walletID string) (map[string]int64, error)
+}
+
+// TransactionRepository stores transactions
+type TransactionRepository interface {
+	InsertTransaction(ctx context.Context, rec TxRecord) error
+	ApplyTransfer(ctx context.Context, t Transfer) error
+	GetTransactionByID(ctx context.Context, txID string) (*TxRecord, error)
+	QueryTransactionHistory(ctx context.Context, f HistoryFilter, after *HistoryCursor, limit int) ([]TxRecord, error)
+	GetTransactionTotals(ctx context.Context, f HistoryFilter) (HistoryTotals, error)
+}
+
+// BlockRepository stores mined blocks
+type BlockRepository interface {
+	InsertBlock(ctx context.Context, block *blockchain.Block) error
+	GetBlockByHash(ctx context.Context, hash string) (*BlockRecord, error)
+	ChainTip(ctx context.Context) (*StoredBlock, error)
+}
+
+// ExplorerRepository reads blocks and the explorer aggregates
+type ExplorerRepository interface {
+	ListBlocks(ctx context.Context, after *BlockCursor, limit int) ([]BlockRecord, error)
+	GetBlockByHeight(ctx context.Context, height int64) (*BlockRecord, error)
+	GetAddressStats(ctx context.Context, walletID string) (*AddressStats, error)
+	GetRichList(ctx context.Context, limit int) ([]AddressStats, error)
+	GetDailyStats(ctx context.Context, from, to string) ([]DailyStats, error)
+	GetChainStats(ctx context.Context) (*ChainStats, error)
+}
+
+// LogRepository stores the system log
+type LogRepository interface {
+	InsertLog(ctx context.Context, walletID, action, details, status, ipAddress string) error
+	GetLogs(ctx context.Context, walletID string, limit int) ([]LogEntry, error)
+	QueryLogs(ctx context.Context, f LogFilter, after *LogCursor, limit int) ([]LogEntry, error)
+}
+
+// AuditRepository stores the hash-chained audit log
+type AuditRepository interface {
+	audit.Store
+}
+
+// StatementRepository reads the ledger that account statements are built from
+type StatementRepository interface {
+	report.Source
+}
+
+// BeneficiaryRepository stores users' saved recipients
+type BeneficiaryRepository interface {
+	GetBeneficiaries(ctx context.Context, userID string) ([]Beneficiary, error)
+	AddBeneficiary(ctx context.Context, userID, walletID, name string) error
+	RemoveBeneficiary(ctx context.Context, beneficiaryID string) error
+}
+
+// StandingOrderRepository stores recurring transfers
+type StandingOrderRepository interface {
+	orders.Store
+	InsertStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) (string, error)
+	GetStandingOrder(ctx context.Context, id, userID string) (orders.Order, error)
+	GetStandingOrders(ctx context.Context, userID string) ([]orders.Order, error)
+	UpdateStandingOrder(ctx context.Context, o orders.Order, registerReceiver bool) error
+	GetStandingOrderRuns(ctx context.Context, orderID string, limit int) ([]orders.Execution, error)
+}
+
+// WebhookRepository stores merchant webhook endpoints, the delivery outbox
+// and its log
+type WebhookRepository interface {
+	webhook.Store
+	InsertWebhookEndpoint(ctx context.Context, e webhook.Endpoint) (string, error)
+	GetWebhookEndpoints(ctx context.Context, userID string) ([]webhook.Endpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id, userID string) error
+	GetWebhookDeliveries(ctx context.Context, userID, endpointID, status string, limit int) ([]webhook.Delivery, error)
+	GetWebhookAttempts(ctx context.Context, deliveryID, userID string) ([]webhook.Attempt, error)
+	ReplayWebhookDelivery(ctx context.Context, deliveryID, userID string, now time.Time) error
+}
+
+// InvoiceRepository stores payment requests and the payments matched to them
+type InvoiceRepository interface {
+	InsertInvoice(ctx context.Context, inv invoice.Invoice) (string, error)
+	GetInvoice(ctx context.Context, id, userID string) (invoice.Invoice, error)
+	GetInvoiceByReference(ctx context.Context, ref string) (invoice.Invoice, error)
+	GetInvoices(ctx context.Context, userID, status string, limit int) ([]invoice.Invoice, error)
+	GetInvoicePayments(ctx context.Context, invoiceID string) ([]invoice.Payment, error)
+	RecordInvoicePayment(ctx context.Context, p invoice.Payment, now time.Time) (*invoice.Invoice, error)
+	ExpireInvoices(ctx context.Context, now time.Time) (int64, error)
+}
+
+// MultisigRepository stores multisig wallets and their spend proposals
+type MultisigRepository interface {
+	InsertMultisigWallet(ctx context.Context, w multisig.Wallet) error
+	GetMultisigWallet(ctx context.Context, address string) (multisig.Wallet, error)
+	GetMultisigWalletsByKey(ctx context.Context, pub ed25519.PublicKey) ([]multisig.Wallet, error)
+	InsertMultisigProposal(ctx context.Context, p multisig.Proposal) (string, error)
+	GetMultisigProposal(ctx context.Context, id string) (multisig.Proposal, error)
+	GetMultisigProposals(ctx context.Context, walletID, status string, limit int) ([]multisig.Proposal, error)
+	AddMultisigSignature(ctx context.Context, proposalID string, s multisig.Signature) error
+	CloseMultisigProposal(ctx context.Context, id, status, txID string, at time.Time) error
+}
+
+// HTLCRepository stores hash time-locked contracts
+type HTLCRepository interface {
+	InsertHTLC(ctx context.Context, h htlc.HTLC) error
+	GetHTLC(ctx context.Context, id string) (htlc.HTLC, error)
+	GetHTLCsByHash(ctx context.Context, hash string) ([]htlc.HTLC, error)
+	GetHTLCs(ctx context.Context, walletID string, limit int) ([]htlc.HTLC, error)
+	SettleHTLC(ctx context.Context, id, status, txID, secret string, at time.Time) error
+}
+
+// AssetRepository stores custom tokens and their issuance
+type AssetRepository interface {
+	InsertAsset(ctx context.Context, a asset.Asset) error
+	GetAsset(ctx context.Context, id string) (asset.Asset, error)
+	ListAssets(ctx context.Context, limit int) ([]asset.Asset, error)
+	SetAssetZakat(ctx context.Context, id string, bps int64) error
+	GetZakatAssets(ctx context.Context) ([]asset.Asset, error)
+	IssueAsset(ctx context.Context, rec TxRecord, utxoID string, registerReceiver bool) error
+	GetAssetHolders(ctx context.Context, assetID string) (map[string]int64, error)
+}
+
+// RecoveryRepository stores key recovery setups and the requests that
+// collect shares back
+type RecoveryRepository interface {
+	InsertRecoverySetup(ctx context.Context, s recovery.Setup) error
+	GetRecoverySetup(ctx context.Context, walletID string) (recovery.Setup, error)
+	InsertRecoveryRequest(ctx context.Context, r recovery.Request, ipAddress string) (string, error)
+	GetRecoveryRequest(ctx context.Context, id string) (recovery.Request, error)
+	AddRecoveryShare(ctx context.Context, requestID string, index int, shareEnc []byte) error
+	GetRecoveryShares(ctx context.Context, requestID string) ([][]byte, error)
+	CloseRecoveryRequest(ctx context.Context, id, status string, at time.Time) error
+	ExpireRecoveryRequests(ctx context.Context, now time.Time) (int64, error)
+}
+
+// DirectoryRepository resolves transfer recipients and stores wallet
+// aliases
+type DirectoryRepository interface {
+	GetDirectoryEntry(ctx context.Context, walletID string) (directory.Entry, error)
+	GetDirectoryEntryByAlias(ctx context.Context, alias string) (directory.Entry, error)
+	GetDirectoryEntryByEmail(ctx context.Context, email string) (directory.Entry, error)
+	SetWalletAlias(ctx context.Context, walletID, alias string) error
+	DeleteWalletAlias(ctx context.Context, walletID string) error
+}
+
+// JobRepository provides job locking and run history
+type JobRepository interface {
+	jobs.Locker
+	jobs.History
+	GetJobRuns(ctx context.Context, jobName string, limit int) ([]jobs.Run, error)
+}
+
+// Store is the full persistence layer used by the server
+type Store interface {
+	UserRepository
+	OTPRepository
+	WalletRepository
+	UTXORepository
+	TransactionRepository
+	BlockRepository
+	ExplorerRepository
+	LogRepository
+	AuditRepository
+	StatementRepository
+	BeneficiaryRepository
+	StandingOrderRepository
+	WebhookRepository
+	InvoiceRepository
+	MultisigRepository
+	HTLCRepository
+	AssetRepository
+	RecoveryRepository
+	DirectoryRepository
+	JobRepository
+	Close() error
+}
+
+var _ Store = (*Client)(nil)
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/asset"
+)
+
+// SnapshotVersion is the version of the snapshot format written by
+// ExportSnapshot
+const SnapshotVersion = 1
+
+// Snapshot is the chain data of a node: its blocks, transactions, outputs
+// and assets. Users and wallets are not included, so a snapshot can only
+// be imported where the wallets it mentions already exist.
+type Snapshot struct {
+	Version       int           `json:"version"`
+	SchemaVersion int           `json:"schema_version"`
+	ExportedAt    time.Time     `json:"exported_at"`
+	Blocks        []StoredBlock `json:"blocks"`
+	Transactions  []TxRecord    `json:"transactions"`
+	UTXOs         []UTXO        `json:"utxos"`
+	Assets        []asset.Asset `json:"assets"`
+}
+
+// SnapshotCounts is how many rows of each kind a snapshot import added,
+// and how many existing rows it brought up to date
+type SnapshotCounts struct {
+	Blocks       int64 `json:"blocks"`
+	Transactions int64 `json:"transactions"`
+	UTXOs        int64 `json:"utxos"`
+	Assets       int64 `json:"assets"`
+	Updated      int64 `json:"updated"`
+}
+
+// ExportSnapshot reads the whole stored chain
+func (c *Client) ExportSnapshot(ctx context.Context) (*Snapshot, error) {
+	version, err := c.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{Version: SnapshotVersion, SchemaVersion: version, ExportedAt: time.Now().UTC()}
+	if s.Blocks, err = c.ChainBlocks(ctx); err != nil {
+		return nil, err
+	}
+	if s.UTXOs, err = c.allOutputs(ctx); err != nil {
+		return nil, err
+	}
+	if s.Assets, err = c.queryAssets(ctx, "SELECT "+assetColumns+" FROM assets ORDER BY created_at, asset_id"); err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+txColumns+", t.signature, t.sender_public_key"+txFrom+" ORDER BY t.created_at, t.tx_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var signature, senderPub []byte
+		t, err := scanTx(rows, &signature, &senderPub)
+		if err != nil {
+			return nil, err
+		}
+		// Heights and confirmations depend on the importing node's blocks
+		t.BlockIndex, t.Confirmations = nil, 0
+		t.Signature, t.SenderPublicKey = signature, senderPub
+		s.Transactions = append(s.Transactions, *t)
+	}
+	return s, rows.Err()
+}
+
+// ImportSnapshot adds the rows of a snapshot that this database does not
+// have yet, in one database transaction, then rebuilds the explorer
+// aggregates and wallet balances. The snapshot's blocks must verify. An
+// existing row that the snapshot is ahead of is brought up to date: an
+// unspent output the snapshot has spent is marked spent, and a transaction
+// not yet in a block gets the snapshot's block and status. Anything else
+// already here is left as it is.
+func (c *Client) ImportSnapshot(ctx context.Context, s *Snapshot) (SnapshotCounts, error) {
+	var n SnapshotCounts
+	if s.Version != SnapshotVersion {
+		return n, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	if r := VerifyBlocks(s.Blocks); len(r.Issues) > 0 {
+		i := r.Issues[0]
+		return n, fmt.Errorf("snapshot chain does not verify (%d issues): block %d %s: %s", len(r.Issues), i.Height, i.Hash, i.Problem)
+	}
+	if err := c.checkSnapshotWallets(ctx, s); err != nil {
+		return n, err
+	}
+
+	count := func(res interface{ RowsAffected() (int64, error) }, into *int64) {
+		if k, err := res.RowsAffected(); err == nil {
+			*into += k
+		}
+	}
+	err := c.inTx(ctx, func(q querier) error {
+		for _, a := range s.Assets {
+			res, err := q.ExecContext(ctx,
+				`INSERT INTO assets (asset_id, symbol, name, issuer_key, zakat_bps, supply, created_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (asset_id) DO NOTHING`,
+				a.ID, a.Symbol, a.Name, []byte(a.IssuerKey), a.ZakatBPS, a.Supply, a.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("asset %s: %w", a.ID, err)
+			}
+			count(res, &n.Assets)
+		}
+		for _, t := range s.Transactions {
+			var blockHash, asset *string
+			if t.BlockHash != "" {
+				blockHash = &t.BlockHash
+			}
+			if t.Asset != "" {
+				asset = &t.Asset
+			}
+			res, err := q.ExecContext(ctx,
+				`INSERT INTO transactions (tx_id, sender_wallet_id, receiver_wallet_id, amount, note, signature, sender_public_key,
+				     ip_address, tx_type, asset_id, status, block_hash, created_at, confirmed_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) ON CONFLICT (tx_id) DO NOTHING`,
+				t.TxID, t.SenderWalletID, t.ReceiverWalletID, t.Amount, t.Note, t.Signature, t.SenderPublicKey,
+				t.IPAddress, t.TxType, asset, t.Status, blockHash, t.CreatedAt, t.ConfirmedAt)
+			if err != nil {
+				return fmt.Errorf("transaction %s: %w", t.TxID, err)
+			}
+			count(res, &n.Transactions)
+			if blockHash != nil {
+				res, err := q.ExecContext(ctx,
+					`UPDATE transactions SET status = $2, block_hash = $3, confirmed_at = $4
+					 WHERE tx_id = $1 AND block_hash IS NULL`,
+					t.TxID, t.Status, blockHash, t.ConfirmedAt)
+				if err != nil {
+					return fmt.Errorf("transaction %s: %w", t.TxID, err)
+				}
+				count(res, &n.Updated)
+			}
+		}
+		for _, b := range s.Blocks {
+			var entries *string
+			if b.Entries != nil {
+				data, err := json.Marshal(b.Entries)
+				if err != nil {
+					return err
+				}
+				e := string(data)
+				entries = &e
+			}
+			res, err := q.ExecContext(ctx,
+				`INSERT INTO blocks (block_index, block_hash, previous_hash, merkle_root, nonce, difficulty, mined_at, miner_wallet_id, block_time, entries)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT wallet_id FROM wallets WHERE wallet_id = $8), $9, $10)
+				 ON CONFLICT (block_hash) DO NOTHING`,
+				b.Index, b.Hash, b.PreviousHash, b.MerkleRoot, b.Nonce, b.Difficulty, b.MinedAt, b.MinerWalletID, b.Timestamp, entries)
+			if err != nil {
+				return fmt.Errorf("block %s: %w", b.Hash, err)
+			}
+			count(res, &n.Blocks)
+			for _, txID := range b.TxIDs {
+				if _, err := q.ExecContext(ctx,
+					`INSERT INTO block_transactions (block_id, tx_id)
+					 SELECT id, $1 FROM blocks WHERE block_hash = $2
+					 ON CONFLICT (block_id, tx_id) DO NOTHING`,
+					txID, b.Hash); err != nil {
+					return fmt.Errorf("block %s: link %s: %w", b.Hash, txID, err)
+				}
+			}
+		}
+		for _, u := range s.UTXOs {
+			var kind, payee, arbiter, spentIn, asset *string
+			var height, at int64
+			var script []byte
+			if l := u.Lock; l != nil {
+				kind, height, at = &l.Kind, l.Height, l.Time
+				if l.Payee != "" {
+					payee, arbiter = &l.Payee, &l.Arbiter
+				}
+				if len(l.Script) > 0 {
+					script = l.Script
+				}
+			}
+			if u.SpentInTxID != "" {
+				spentIn = &u.SpentInTxID
+			}
+			if u.Asset != "" {
+				asset = &u.Asset
+			}
+			res, err := q.ExecContext(ctx,
+				`INSERT INTO utxos (utxo_id, owner_wallet_id, amount, spent, spent_in_tx_id, created_at, spent_at,
+				     lock_kind, lock_height, lock_time, escrow_payee, escrow_arbiter, lock_script, asset_id)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) ON CONFLICT (utxo_id) DO NOTHING`,
+				u.UTXOID, u.Owner, u.Amount, u.Spent, spentIn, u.CreatedAt, u.SpentAt,
+				kind, height, at, payee, arbiter, script, asset)
+			if err != nil {
+				return fmt.Errorf("utxo %s: %w", u.UTXOID, err)
+			}
+			count(res, &n.UTXOs)
+			if u.Spent {
+				res, err := q.ExecContext(ctx,
+					`UPDATE utxos SET spent = TRUE, spent_in_tx_id = $2, spent_at = $3
+					 WHERE utxo_id = $1 AND COALESCE(spent, FALSE) = FALSE`,
+					u.UTXOID, spentIn, u.SpentAt)
+				if err != nil {
+					return fmt.Errorf("utxo %s: %w", u.UTXOID, err)
+				}
+				count(res, &n.Updated)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := c.RebuildStats(ctx); err != nil {
+		return n, fmt.Errorf("rebuild stats: %w", err)
+	}
+	if _, err := c.ReconcileBalances(ctx); err != nil {
+		return n, fmt.Errorf("reconcile balances: %w", err)
+	}
+	return n, nil
+}
+
+// checkSnapshotWallets fails if the snapshot moves funds of wallets this
+// database does not have
+func (c *Client) checkSnapshotWallets(ctx context.Context, s *Snapshot) error {
+	want := map[string]bool{}
+	for _, t := range s.Transactions {
+		want[t.SenderWalletID] = true
+		want[t.ReceiverWalletID] = true
+	}
+	for _, u := range s.UTXOs {
+		want[u.Owner] = true
+	}
+	var missing []string
+	for id := range want {
+		var found string
+		err := c.db.QueryRowContext(ctx, "SELECT wallet_id FROM wallets WHERE wallet_id = $1", id).Scan(&found)
+		if err != nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	if len(missing) > 3 {
+		missing = append(missing[:3], "...")
+	}
+	return fmt.Errorf("snapshot refers to wallets this database does not have (%s); create them first", strings.Join(missing, ", "))
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"blockchain-wallet/pkg/report"
+)
+
+// TxTypeZakat is the type of the transactions by which the Zakat scheduler
+// pays a wallet's Zakat to the pool
+const TxTypeZakat = "zakat_deduction"
+
+// ZakatDeductedAction is the system log action recording a Zakat deduction
+const ZakatDeductedAction = "zakat_deducted"
+
+// WalletMovements returns the wallet's native-coin ledger before the given
+// time: every transfer it sent or received plus deposits, which are outputs
+// not created by any transaction. The fee of a sent transfer is whatever its
+// spent inputs exceed its receiver and change outputs by. Zakat
+// transactions are debited as Zakat. Asset transfers and outputs are left
+// out.
+func (c *Client) WalletMovements(ctx context.Context, walletID string, before time.Time) ([]report.Movement, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT t.tx_id, t.created_at, t.sender_wallet_id, t.receiver_wallet_id, t.amount,
+		        COALESCE(t.note, ''), COALESCE(t.tx_type, 'transfer'),
+		        COALESCE((SELECT SUM(i.amount) FROM utxos i
+		                  WHERE i.spent_in_tx_id = t.tx_id AND i.asset_id IS NULL), 0),
+		        COALESCE((SELECT SUM(o.amount) FROM utxos o
+		                  WHERE (o.utxo_id = t.tx_id || '_recv' OR o.utxo_id = t.tx_id || '_change')
+		                    AND o.asset_id IS NULL), 0)
+		 FROM transactions t
+		 WHERE (t.sender_wallet_id = $1 OR t.receiver_wallet_id = $1) AND t.created_at < $2
+		   AND t.asset_id IS NULL`,
+		walletID, before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moves []report.Movement
+	for rows.Next() {
+		var (
+			txID, sender, receiver, note, txType string
+			at                                   time.Time
+			amount, inputs, outputs              int64
+		)
+		if err := rows.Scan(&txID, &at, &sender, &receiver, &amount, &note, &txType, &inputs, &outputs); err != nil {
+			return nil, err
+		}
+		if sender == walletID {
+			var fee int64
+			if inputs > outputs {
+				fee = inputs - outputs
+			}
+			kind := report.KindTransferOut
+			if txType == TxTypeZakat {
+				kind = report.KindZakat
+			}
+			moves = append(moves, report.Movement{At: at, TxID: txID, Kind: kind, Counterparty: receiver,
+				Note: note, Debit: amount + fee, Fee: fee})
+		}
+		if receiver == walletID {
+			moves = append(moves, report.Movement{At: at, TxID: txID, Kind: report.KindTransferIn,
+				Counterparty: sender, Note: note, Credit: amount})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	deposits, err := c.db.QueryContext(ctx,
+		`SELECT u.utxo_id, u.created_at, u.amount FROM utxos u
+		 WHERE u.owner_wallet_id = $1 AND u.created_at < $2 AND u.asset_id IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM transactions t
+		                   WHERE u.utxo_id = t.tx_id || '_recv' OR u.utxo_id = t.tx_id || '_change')`,
+		walletID, before,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer deposits.Close()
+
+	for deposits.Next() {
+		m := report.Movement{Kind: report.KindDeposit}
+		if err := deposits.Scan(&m.TxID, &m.At, &m.Credit); err != nil {
+			return nil, err
+		}
+		moves = append(moves, m)
+	}
+	return moves, deposits.Err()
+}
+
+// UTXOBalanceAt sums the wallet's native-coin outputs created before at and
+// not yet spent at that time
+func (c *Client) UTXOBalanceAt(ctx context.Context, walletID string, at time.Time) (int64, error) {
+	var balance int64
+	err := c.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM utxos
+		 WHERE owner_wallet_id = $1 AND created_at < $2 AND asset_id IS NULL
+		   AND (COALESCE(spent, FALSE) = FALSE OR spent_at >= $2)`,
+		walletID, at,
+	).Scan(&balance)
+	return balance, err
+}
@@ -0,0 +1,1850 @@
+package db
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"blockchain-wallet/pkg/asset"
+	"blockchain-wallet/pkg/audit"
+	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/directory"
+	"blockchain-wallet/pkg/htlc"
+	"blockchain-wallet/pkg/invoice"
+	"blockchain-wallet/pkg/jobs"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/orders"
+	"blockchain-wallet/pkg/recovery"
+	"blockchain-wallet/pkg/report"
+	"blockchain-wallet/pkg/utxo"
+	"blockchain-wallet/pkg/webhook"
+)
+
+// testStores returns a freshly migrated client for every available backend.
+// SQLite always runs; Postgres runs when TEST_DATABASE_URL points at a
+// throwaway database (the suite migrates it down and up again).
+func testStores(t *testing.T) map[string]*Client {
+	t.Helper()
+	ctx := context.Background()
+	stores := map[string]*Client{}
+
+	lite, err := NewSQLiteClient(ctx, t.TempDir()+"/wallet.db")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	stores[DriverSQLite] = lite
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		pg, err := connect(ctx, postgresDialect, "postgres", url)
+		if err != nil {
+			t.Fatalf("open postgres: %v", err)
+		}
+		if _, err := pg.MigrateDown(ctx, LatestSchemaVersion()); err != nil {
+			t.Fatalf("reset postgres: %v", err)
+		}
+		stores[DriverPostgres] = pg
+	} else {
+		t.Log("TEST_DATABASE_URL is not set; testing SQLite only")
+	}
+
+	for name, c := range stores {
+		if _, err := c.MigrateUp(ctx); err != nil {
+			t.Fatalf("%s: migrate up: %v", name, err)
+		}
+		c := c
+		t.Cleanup(func() { c.Close() })
+	}
+	return stores
+}
+
+// forEachStore runs fn as a subtest against every backend
+func forEachStore(t *testing.T, fn func(t *testing.T, c *Client)) {
+	for name, c := range testStores(t) {
+		c := c
+		t.Run(name, func(t *testing.T) { fn(t, c) })
+	}
+}
+
+// seedWallet creates a user with a wallet and returns the user ID
+func seedWallet(t *testing.T, c *Client, email, walletID string) string {
+	t.Helper()
+	ctx := context.Background()
+	userID, err := c.InsertUser(ctx, email, "Test "+walletID, "12345-1234567-1")
+	if err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	if err := c.InsertWallet(ctx, userID, walletID, []byte("pub-"+walletID), []byte("enc-"+walletID)); err != nil {
+		t.Fatalf("InsertWallet: %v", err)
+	}
+	return userID
+}
+
+func TestStoreMigrations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		if err := c.CheckSchemaVersion(ctx); err != nil {
+			t.Fatalf("CheckSchemaVersion: %v", err)
+		}
+		if _, err := c.MigrateDown(ctx, LatestSchemaVersion()); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if v, _ := c.SchemaVersion(ctx); v != 0 {
+			t.Fatalf("schema version after full rollback = %d", v)
+		}
+		applied, err := c.MigrateUp(ctx)
+		if err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		if len(applied) != LatestSchemaVersion() {
+			t.Errorf("applied %d migrations, want %d", len(applied), LatestSchemaVersion())
+		}
+	})
+}
+
+func TestStoreUsersAndWallets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "ali@example.com", "wallet-ali")
+
+		if err := c.UpdateUserPassword(ctx, userID, "hash"); err != nil {
+			t.Fatalf("UpdateUserPassword: %v", err)
+		}
+		user, err := c.GetUserByEmail(ctx, "ali@example.com")
+		if err != nil {
+			t.Fatalf("GetUserByEmail: %v", err)
+		}
+		if user.ID != userID || user.PasswordHash != "hash" || !user.ZakatEnabled || user.CreatedAt.IsZero() {
+			t.Errorf("unexpected user: %+v", user)
+		}
+
+		wallet, err := c.GetUserWalletByUserID(ctx, userID)
+		if err != nil {
+			t.Fatalf("GetUserWalletByUserID: %v", err)
+		}
+		if wallet.WalletID != "wallet-ali" || string(wallet.PrivateKeyEncrypted) != "enc-wallet-ali" {
+			t.Errorf("unexpected wallet: %+v", wallet)
+		}
+		if _, err := c.GetWalletByID(ctx, "wallet-ali"); err != nil {
+			t.Errorf("GetWalletByID: %v", err)
+		}
+		if err := c.UpdateWalletKey(ctx, "wallet-ali", []byte("resealed")); err != nil {
+			t.Fatalf("UpdateWalletKey: %v", err)
+		}
+		if w, _ := c.GetWalletByID(ctx, "wallet-ali"); string(w.PrivateKeyEncrypted) != "resealed" {
+			t.Errorf("key not replaced: %q", w.PrivateKeyEncrypted)
+		}
+		if err := c.UpdateWalletKey(ctx, "wallet-nobody", []byte("x")); err != sql.ErrNoRows {
+			t.Errorf("UpdateWalletKey of an unknown wallet: %v", err)
+		}
+
+		if err := c.UpdateUserNameAndSettings(ctx, userID, "Ali Khan", false); err != nil {
+			t.Fatalf("UpdateUserNameAndSettings: %v", err)
+		}
+		profile, err := c.GetUserByWalletID(ctx, "wallet-ali")
+		if err != nil {
+			t.Fatalf("GetUserByWalletID: %v", err)
+		}
+		if profile.FullName != "Ali Khan" || profile.ZakatEnabled || string(profile.PublicKey) != "pub-wallet-ali" {
+			t.Errorf("unexpected profile: %+v", profile)
+		}
+
+		if _, err := c.GetUserByEmail(ctx, "nobody@example.com"); err != sql.ErrNoRows {
+			t.Errorf("missing user: got %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestStoreUTXOsAndTransactions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		for i, amt := range []int64{60, 40} {
+			if err := c.InsertUTXO(ctx, fmt.Sprintf("faucet-%d", i), "wallet-a", amt); err != nil {
+				t.Fatalf("InsertUTXO: %v", err)
+			}
+		}
+		if bal, _ := c.GetBalance(ctx, "wallet-a"); bal != 100 {
+			t.Fatalf("balance = %d, want 100", bal)
+		}
+
+		rec := TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b",
+			Amount: 70, Note: "rent", Signature: []byte("sig"), SenderPublicKey: []byte("pub"), IPAddress: "127.0.0.1"}
+		if err := c.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		for _, id := range []string{"faucet-0", "faucet-1"} {
+			if err := c.SpendUTXO(ctx, id, "tx-1"); err != nil {
+				t.Fatalf("SpendUTXO: %v", err)
+			}
+		}
+		_ = c.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 70)
+		_ = c.InsertUTXO(ctx, "tx-1_change", "wallet-a", 30)
+
+		unspent, err := c.GetUnspentUTXOs(ctx, "wallet-a")
+		if err != nil || len(unspent) != 1 || unspent[0].UTXOID != "tx-1_change" {
+			t.Fatalf("unexpected unspent UTXOs: %+v (%v)", unspent, err)
+		}
+		spent, err := c.GetUTXOByID(ctx, "faucet-0")
+		if err != nil || !spent.Spent || spent.SpentInTxID != "tx-1" || spent.SpentAt == nil {
+			t.Errorf("UTXO not marked spent: %+v (%v)", spent, err)
+		}
+
+		got, err := c.GetTransactionByID(ctx, "tx-1")
+		if err != nil {
+			t.Fatalf("GetTransactionByID: %v", err)
+		}
+		if got.Amount != 70 || got.Status != "pending" || string(got.Signature) != "sig" || got.IPAddress != "127.0.0.1" {
+			t.Errorf("unexpected transaction: %+v", got)
+		}
+		history, err := c.QueryTransactionHistory(ctx, HistoryFilter{WalletID: "wallet-b"}, nil, 10)
+		if err != nil || len(history) != 1 || history[0].TxID != "tx-1" {
+			t.Errorf("unexpected history: %+v (%v)", history, err)
+		}
+
+		// The cached balance column is only corrected by reconciliation
+		n, err := c.ReconcileBalances(ctx)
+		if err != nil || n != 2 {
+			t.Errorf("ReconcileBalances corrected %d wallets (%v), want 2", n, err)
+		}
+		wallets, err := c.GetAllWallets(ctx)
+		if err != nil || len(wallets) != 2 {
+			t.Fatalf("GetAllWallets: %+v (%v)", wallets, err)
+		}
+		for _, w := range wallets {
+			if want := map[string]int64{"wallet-a": 30, "wallet-b": 70}[w.WalletID]; w.Balance != want {
+				t.Errorf("%s balance = %d, want %d", w.WalletID, w.Balance, want)
+			}
+		}
+	})
+}
+
+func TestStoreApplyTransfer(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+		_ = c.InsertUTXO(ctx, "faucet", "wallet-a", 100)
+
+		transfer := func(txID, receiver string) Transfer {
+			return Transfer{
+				Record: TxRecord{TxID: txID, SenderWalletID: "wallet-a", ReceiverWalletID: receiver, Amount: 70, Signature: []byte("sig")},
+				Inputs: []string{"faucet"},
+				Outputs: []*utxo.UTXO{{ID: txID + "_recv", Owner: receiver, Amount: 70},
+					{ID: txID + "_change", Owner: "wallet-a", Amount: 30}},
+			}
+		}
+
+		// An output that cannot be stored leaves the input unspent
+		if err := c.ApplyTransfer(ctx, transfer("tx-lost", "wallet-nobody")); err == nil {
+			t.Fatal("transfer to an unknown wallet was applied")
+		}
+		if u, _ := c.GetUTXOByID(ctx, "faucet"); u.Spent {
+			t.Fatalf("failed transfer spent its input: %+v", u)
+		}
+		if _, err := c.GetTransactionByID(ctx, "tx-lost"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("failed transfer was recorded: %v", err)
+		}
+
+		if err := c.ApplyTransfer(ctx, transfer("tx-1", "wallet-b")); err != nil {
+			t.Fatalf("ApplyTransfer: %v", err)
+		}
+		if u, _ := c.GetUTXOByID(ctx, "faucet"); !u.Spent || u.SpentInTxID != "tx-1" {
+			t.Fatalf("input not spent by tx-1: %+v", u)
+		}
+		if b, _ := c.GetBalance(ctx, "wallet-b"); b != 70 {
+			t.Fatalf("receiver balance = %d, want 70", b)
+		}
+		if _, err := c.GetTransactionByID(ctx, "tx-1"); err != nil {
+			t.Fatalf("GetTransactionByID: %v", err)
+		}
+		if err := c.ApplyTransfer(ctx, transfer("tx-2", "wallet-b")); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("double spend: %v", err)
+		}
+
+		// An unknown receiver is registered only with a transfer that applies
+		ext := transfer("tx-ext", "wallet-ext")
+		ext.RegisterReceiver = true
+		if err := c.ApplyTransfer(ctx, ext); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("double spend to an external wallet: %v", err)
+		}
+		if _, err := c.GetWalletByID(ctx, "wallet-ext"); err == nil {
+			t.Fatal("failed transfer registered its receiver")
+		}
+		_ = c.InsertUTXO(ctx, "faucet-2", "wallet-a", 100)
+		ext.Inputs = []string{"faucet-2"}
+		if err := c.ApplyTransfer(ctx, ext); err != nil {
+			t.Fatalf("ApplyTransfer to an external wallet: %v", err)
+		}
+		if w, err := c.GetWalletByID(ctx, "wallet-ext"); err != nil || !w.External() {
+			t.Fatalf("external wallet = %+v, %v", w, err)
+		}
+	})
+}
+
+func TestStoreZakatPeriod(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		_ = c.InsertUTXO(ctx, "faucet-0", "wallet-a", 100)
+		_ = c.InsertUTXO(ctx, "faucet-1", "wallet-a", 100)
+		_ = c.InsertAssetUTXO(ctx, "gold-0", "wallet-a", "gold", 100, nil)
+
+		zakat := func(txID, input, assetID string) Transfer {
+			return Transfer{
+				Record: TxRecord{TxID: txID, SenderWalletID: "wallet-a", ReceiverWalletID: "zakat-pool", Amount: 2,
+					TxType: TxTypeZakat, Signature: []byte{}, Asset: assetID},
+				Inputs: []string{input},
+				Outputs: []*utxo.UTXO{{ID: txID + "_recv", Owner: "zakat-pool", Asset: assetID, Amount: 2},
+					{ID: txID + "_change", Owner: "wallet-a", Asset: assetID, Amount: 98}},
+				Now:              time.Now().Unix(),
+				RegisterReceiver: true,
+				ZakatPeriod:      "2026-10",
+			}
+		}
+
+		if done, err := c.ZakatDeducted(ctx, "wallet-a", "", "2026-10"); err != nil || done {
+			t.Fatalf("ZakatDeducted before any charge = %v, %v", done, err)
+		}
+		if err := c.ApplyTransfer(ctx, zakat("tx-z1", "faucet-0", "")); err != nil {
+			t.Fatalf("ApplyTransfer: %v", err)
+		}
+		if done, err := c.ZakatDeducted(ctx, "wallet-a", "", "2026-10"); err != nil || !done {
+			t.Fatalf("ZakatDeducted after the charge = %v, %v", done, err)
+		}
+		if w, _ := c.GetWalletByID(ctx, "wallet-a"); w.ZakatLastDeducted == nil {
+			t.Error("zakat_last_deducted not set")
+		}
+
+		// A second charge for the period applies nothing
+		if err := c.ApplyTransfer(ctx, zakat("tx-z2", "faucet-1", "")); !errors.Is(err, ErrZakatDeducted) {
+			t.Fatalf("second charge: %v", err)
+		}
+		if u, _ := c.GetUTXOByID(ctx, "faucet-1"); u.Spent {
+			t.Fatal("second charge spent its input")
+		}
+
+		// Other assets and periods are charged separately
+		if err := c.ApplyTransfer(ctx, zakat("tx-z3", "gold-0", "gold")); err != nil {
+			t.Fatalf("asset charge: %v", err)
+		}
+		if done, _ := c.ZakatDeducted(ctx, "wallet-a", "", "2026-11"); done {
+			t.Error("next period reported as charged")
+		}
+	})
+}
+
+func TestStoreStatement(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		_ = c.InsertUTXO(ctx, "faucet-0", "wallet-a", 60)
+		_ = c.InsertUTXO(ctx, "faucet-1", "wallet-a", 40)
+		rec := TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 65, Note: "rent", Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		_ = c.SpendUTXO(ctx, "faucet-0", "tx-1")
+		_ = c.SpendUTXO(ctx, "faucet-1", "tx-1")
+		_ = c.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 65)
+		_ = c.InsertUTXO(ctx, "tx-1_change", "wallet-a", 30) // 5 left over as the fee
+
+		// Asset movements are not part of the coin statement
+		_ = c.InsertAssetUTXO(ctx, "gold-0", "wallet-a", "gold", 500, nil)
+		gold := TxRecord{TxID: "tx-gold", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 200, Asset: "gold", Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, gold); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		_ = c.SpendUTXO(ctx, "gold-0", "tx-gold")
+		_ = c.InsertAssetUTXO(ctx, "tx-gold_recv", "wallet-b", "gold", 200, nil)
+		_ = c.InsertAssetUTXO(ctx, "tx-gold_change", "wallet-a", "gold", 300, nil)
+
+		now := time.Now()
+		st, err := report.Build(ctx, c, "wallet-a", now.Add(-time.Hour), now.Add(time.Hour), now)
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		if len(st.Lines) != 3 || st.OpeningBalance != 0 || st.ClosingBalance != 30 {
+			t.Fatalf("unexpected statement: %+v", st)
+		}
+		if st.TotalCredits != 100 || st.TotalDebits != 70 || st.TotalFees != 5 || !st.Reconciled {
+			t.Errorf("totals: %+v", st)
+		}
+
+		st, err = report.Build(ctx, c, "wallet-b", now.Add(-time.Hour), now.Add(time.Hour), now)
+		if err != nil || st.ClosingBalance != 65 || st.UTXOBalance != 65 || st.Lines[0].Kind != report.KindTransferIn {
+			t.Errorf("receiver statement: %+v (%v)", st, err)
+		}
+
+		// Zakat is what Zakat transactions pay, not transfers whose note
+		// mentions it
+		_ = c.InsertUTXO(ctx, "faucet-2", "wallet-a", 10)
+		gift := Transfer{
+			Record:  TxRecord{TxID: "tx-gift", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 10, Note: "zakat al-fitr", Signature: []byte("sig")},
+			Inputs:  []string{"faucet-2"},
+			Outputs: []*utxo.UTXO{{ID: "tx-gift_recv", Owner: "wallet-b", Amount: 10}},
+		}
+		zakat := Transfer{
+			Record: TxRecord{TxID: "tx-zakat", SenderWalletID: "wallet-a", ReceiverWalletID: "zakat-pool", Amount: 7,
+				Note: "Monthly Zakat deduction (2.5%)", TxType: TxTypeZakat, Signature: []byte{}},
+			Inputs: []string{"tx-1_change"},
+			Outputs: []*utxo.UTXO{{ID: "tx-zakat_recv", Owner: "zakat-pool", Amount: 7},
+				{ID: "tx-zakat_change", Owner: "wallet-a", Amount: 23}},
+			RegisterReceiver: true,
+		}
+		for _, tr := range []Transfer{gift, zakat} {
+			if err := c.ApplyTransfer(ctx, tr); err != nil {
+				t.Fatalf("ApplyTransfer %s: %v", tr.Record.TxID, err)
+			}
+		}
+		st, err = report.Build(ctx, c, "wallet-a", now.Add(-time.Hour), now.Add(time.Hour), now)
+		if err != nil || st.ZakatPaid != 7 || st.ClosingBalance != 23 || !st.Reconciled {
+			t.Fatalf("statement with zakat: %+v (%v)", st, err)
+		}
+		kinds := map[string]string{}
+		for _, l := range st.Lines {
+			kinds[l.TxID] = l.Kind
+		}
+		if kinds["tx-zakat"] != report.KindZakat || kinds["tx-gift"] != report.KindTransferOut {
+			t.Errorf("line kinds: %v", kinds)
+		}
+
+		// Before the period, nothing had happened yet
+		if bal, err := c.UTXOBalanceAt(ctx, "wallet-a", now.Add(-time.Hour)); err != nil || bal != 0 {
+			t.Errorf("UTXOBalanceAt = %d (%v)", bal, err)
+		}
+	})
+}
+
+func TestStoreExplorerStats(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		_ = c.InsertUTXO(ctx, "faucet-0", "wallet-a", 60)
+		_ = c.InsertUTXO(ctx, "faucet-1", "wallet-a", 40)
+		rec := TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 70, Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		for _, id := range []string{"faucet-0", "faucet-1"} {
+			if err := c.SpendUTXO(ctx, id, "tx-1"); err != nil {
+				t.Fatalf("SpendUTXO: %v", err)
+			}
+		}
+		if err := c.SpendUTXO(ctx, "faucet-0", "tx-2"); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Errorf("double spend: err = %v", err)
+		}
+		_ = c.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 70)
+		_ = c.InsertUTXO(ctx, "tx-1_change", "wallet-a", 30)
+
+		for i, txIDs := range [][]string{{"tx-1"}, {}} {
+			b := &blockchain.Block{Index: int64(i + 1), Hash: fmt.Sprintf("00blk%d", i), PreviousHash: "0",
+				Difficulty: 2 + 2*i, Transactions: txIDs}
+			if err := c.InsertBlock(ctx, b); err != nil {
+				t.Fatalf("InsertBlock: %v", err)
+			}
+		}
+
+		check := func(t *testing.T) {
+			a, err := c.GetAddressStats(ctx, "wallet-a")
+			if err != nil || a.Received != 130 || a.Sent != 100 || a.Balance != 30 || a.UTXOCount != 1 || a.TxCount != 1 || a.FirstSeen == nil {
+				t.Errorf("wallet-a stats: %+v (%v)", a, err)
+			}
+			if rich, _ := c.GetRichList(ctx, 10); len(rich) != 2 || rich[0].WalletID != "wallet-b" || rich[0].Balance != 70 {
+				t.Errorf("rich list: %+v", rich)
+			}
+			chain, err := c.GetChainStats(ctx)
+			if err != nil || chain.TotalSupply != 100 || chain.UTXOCount != 2 || chain.TxCount != 1 || chain.BlockCount != 2 {
+				t.Errorf("chain stats: %+v (%v)", chain, err)
+			}
+			days, err := c.GetDailyStats(ctx, "2000-01-01", "2999-12-31")
+			if err != nil || len(days) != 1 || days[0].TxCount != 1 || days[0].Volume != 70 ||
+				days[0].BlockCount != 2 || days[0].AvgDifficulty != 3 {
+				t.Errorf("daily stats: %+v (%v)", days, err)
+			}
+		}
+		check(t)
+
+		// Migration 0008 backfills the same totals from existing rows; roll
+		// back to just before it and re-apply everything since
+		if _, err := c.MigrateDown(ctx, LatestSchemaVersion()-7); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+		if _, err := c.MigrateUp(ctx); err != nil {
+			t.Fatalf("MigrateUp: %v", err)
+		}
+		check(t)
+
+		if none, err := c.GetAddressStats(ctx, "nobody"); err != nil || none.Balance != 0 {
+			t.Errorf("unknown address: %+v (%v)", none, err)
+		}
+
+		var seen []string
+		var after *BlockCursor
+		for {
+			page, err := c.ListBlocks(ctx, after, 1)
+			if err != nil {
+				t.Fatalf("ListBlocks: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			seen = append(seen, page[0].Hash)
+			cur := BlockCursorFor(page[0])
+			after = &cur
+		}
+		if len(seen) != 2 || seen[0] == seen[1] {
+			t.Errorf("paged blocks: %v", seen)
+		}
+
+		b, err := c.GetBlockByHeight(ctx, 1)
+		if err != nil || b.Hash != "00blk0" || b.TxCount != 1 || len(b.TxIDs) != 1 {
+			t.Errorf("block at height 1: %+v (%v)", b, err)
+		}
+	})
+}
+
+func TestStoreBlocksAndLogs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		b := &blockchain.Block{Index: 1, Hash: "00abc", PreviousHash: "0", Nonce: 42, Difficulty: 2}
+		if err := c.InsertBlock(ctx, b); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+		stored, err := c.GetBlockByHash(ctx, "00abc")
+		if err != nil || stored.Index != 1 || stored.Nonce != 42 {
+			t.Errorf("unexpected block: %+v (%v)", stored, err)
+		}
+
+		_ = c.InsertLog(ctx, "wallet-a", "login", "ok", "success", "127.0.0.1")
+		_ = c.InsertLog(ctx, "wallet-b", "zakat_deducted", "ran", "success", "system")
+		if logs, _ := c.GetLogs(ctx, "wallet-a", 10); len(logs) != 1 || logs[0].Action != "login" {
+			t.Errorf("wallet logs: %+v", logs)
+		}
+		if logs, _ := c.GetLogs(ctx, "", 10); len(logs) != 2 {
+			t.Errorf("expected 2 logs in total, got %d", len(logs))
+		}
+	})
+}
+
+func TestStoreChainTip(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		if _, err := c.ChainTip(ctx); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("empty store: expected sql.ErrNoRows, got %v", err)
+		}
+
+		ts := int64(1700000000)
+		for _, b := range []*blockchain.Block{
+			{Index: 1, Hash: "00a1", PreviousHash: "0"},
+			{Index: 3, Hash: "00a3", PreviousHash: "00a2", Timestamp: ts, Transactions: []string{"tx-3"}},
+			{Index: 2, Hash: "00a2", PreviousHash: "00a1"},
+		} {
+			if err := c.InsertBlock(ctx, b); err != nil {
+				t.Fatalf("InsertBlock %s: %v", b.Hash, err)
+			}
+		}
+		tip, err := c.ChainTip(ctx)
+		if err != nil {
+			t.Fatalf("ChainTip: %v", err)
+		}
+		h := tip.Header()
+		if h.Index != 3 || h.Hash != "00a3" || h.PreviousHash != "00a2" || h.Timestamp != ts {
+			t.Errorf("unexpected tip: %+v", h)
+		}
+	})
+}
+
+func TestStoreLogQuery(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		for i := 0; i < 5; i++ {
+			_ = c.InsertLog(ctx, "wallet-a", "tx_sent", fmt.Sprintf("transfer %d", i), "confirmed", "10.0.0.1")
+		}
+		_ = c.InsertLog(ctx, "wallet-a", "tx_sent", "rejected", "failed", "10.0.0.2")
+		_ = c.InsertLog(ctx, "wallet-b", "zakat_deducted", "ran", "success", "system")
+
+		// Page through wallet-a two at a time without repeats
+		seen := map[string]bool{}
+		var after *LogCursor
+		for {
+			page, err := c.QueryLogs(ctx, LogFilter{WalletID: "wallet-a"}, after, 2)
+			if err != nil {
+				t.Fatalf("QueryLogs: %v", err)
+			}
+			for _, e := range page {
+				if seen[e.ID] {
+					t.Fatalf("log %s returned twice", e.ID)
+				}
+				seen[e.ID] = true
+			}
+			if len(page) < 2 {
+				break
+			}
+			cur := LogCursorFor(page[len(page)-1])
+			after = &cur
+		}
+		if len(seen) != 6 {
+			t.Errorf("paged %d wallet-a logs, want 6", len(seen))
+		}
+
+		future := time.Now().Add(time.Hour)
+		cases := []struct {
+			name string
+			f    LogFilter
+			want int
+		}{
+			{"all", LogFilter{}, 7},
+			{"action", LogFilter{Action: "zakat_deducted"}, 1},
+			{"status", LogFilter{WalletID: "wallet-a", Status: "failed"}, 1},
+			{"ip", LogFilter{IPAddress: "10.0.0.1"}, 5},
+			{"from", LogFilter{From: &future}, 0},
+			{"to", LogFilter{To: &future}, 7},
+		}
+		for _, tc := range cases {
+			logs, err := c.QueryLogs(ctx, tc.f, nil, 50)
+			if err != nil || len(logs) != tc.want {
+				t.Errorf("%s: got %d logs (%v), want %d", tc.name, len(logs), err, tc.want)
+			}
+		}
+	})
+}
+
+func TestStoreAuditLog(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+
+		events := []audit.Event{
+			{Type: audit.LoginFailed, Actor: "a@example.com", IPAddress: "10.0.0.1"},
+			{Type: audit.LoginSuccess, Actor: "wallet-a", IPAddress: "10.0.0.1"},
+			{Type: audit.KeyAccess, Actor: "wallet-a", Subject: "wallet-a", Details: "private key decrypted for login"},
+			{Type: audit.BlockMined, Actor: "wallet-b", Subject: "00abc"},
+		}
+		for _, ev := range events {
+			if _, err := c.AppendAudit(ctx, ev); err != nil {
+				t.Fatalf("AppendAudit: %v", err)
+			}
+		}
+
+		n, head, err := audit.VerifyStore(ctx, c, 3)
+		if err != nil || n != 4 {
+			t.Fatalf("VerifyStore = %d, %v", n, err)
+		}
+		last, _ := c.ListAudit(ctx, audit.Filter{}, 3, 10)
+		if len(last) != 1 || last[0].Hash != head || last[0].Type != audit.BlockMined {
+			t.Errorf("unexpected head: %+v", last)
+		}
+
+		if got, _ := c.ListAudit(ctx, audit.Filter{Actor: "wallet-a"}, 0, 10); len(got) != 2 {
+			t.Errorf("wallet-a entries: %+v", got)
+		}
+		if got, _ := c.ListAudit(ctx, audit.Filter{Type: audit.LoginFailed}, 0, 10); len(got) != 1 || got[0].Seq != 1 {
+			t.Errorf("failed logins: %+v", got)
+		}
+
+		// The table refuses edits and deletes
+		if _, err := c.db.ExecContext(ctx, "UPDATE audit_log SET details = 'edited' WHERE seq = 2"); err == nil {
+			t.Error("audit_log accepted an update")
+		}
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM audit_log WHERE seq = 2"); err == nil {
+			t.Error("audit_log accepted a delete")
+		}
+	})
+}
+
+func TestStoreMinedBlocks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		rec := TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 5, Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		if got, _ := c.GetTransactionByID(ctx, "tx-1"); got.Status != TxStatusPending || got.BlockIndex != nil || got.Confirmations != 0 {
+			t.Fatalf("unmined transaction: %+v", got)
+		}
+
+		txIDs := []string{"tx-1", "MINING_REWARD:wallet-a"}
+		first := &blockchain.Block{Index: 1, Hash: "00first", PreviousHash: "00genesis", Nonce: 7, Difficulty: 2,
+			Transactions: txIDs, MerkleRoot: blockchain.MerkleRoot(txIDs), Miner: "wallet-a"}
+		if err := c.InsertBlock(ctx, first); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+
+		stored, err := c.GetBlockByHash(ctx, "00first")
+		if err != nil {
+			t.Fatalf("GetBlockByHash: %v", err)
+		}
+		if stored.MerkleRoot != first.MerkleRoot || stored.MinerWalletID != "wallet-a" {
+			t.Errorf("block header not stored: %+v", stored)
+		}
+		if len(stored.TxIDs) != 1 || stored.TxIDs[0] != "tx-1" {
+			t.Errorf("block should link only stored transactions, got %v", stored.TxIDs)
+		}
+
+		got, err := c.GetTransactionByID(ctx, "tx-1")
+		if err != nil {
+			t.Fatalf("GetTransactionByID: %v", err)
+		}
+		if got.Status != TxStatusMined || got.BlockHash != "00first" || got.ConfirmedAt == nil ||
+			got.BlockIndex == nil || *got.BlockIndex != 1 || got.Confirmations != 1 {
+			t.Errorf("transaction not marked mined: %+v", got)
+		}
+
+		// A later block adds a confirmation; an unknown miner is stored without a wallet
+		rec2 := TxRecord{TxID: "tx-2", SenderWalletID: "wallet-b", ReceiverWalletID: "wallet-a", Amount: 2, Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, rec2); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		second := &blockchain.Block{Index: 2, Hash: "00second", PreviousHash: "00first", Difficulty: 2, Miner: "outside-miner",
+			Transactions: []string{"tx-2"}}
+		if err := c.InsertBlock(ctx, second); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+		// Blocks stamped with the same time are still told apart by height
+		if _, err := c.db.ExecContext(ctx, "UPDATE blocks SET mined_at = (SELECT MIN(mined_at) FROM blocks)"); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := c.GetTransactionByID(ctx, "tx-2"); got == nil || got.Confirmations != 1 {
+			t.Errorf("transaction in the newest block: %+v", got)
+		}
+		if b, _ := c.GetBlockByHash(ctx, "00second"); b == nil || b.MinerWalletID != "" {
+			t.Errorf("unknown miner should not be linked: %+v", b)
+		}
+		history, err := c.QueryTransactionHistory(ctx, HistoryFilter{WalletID: "wallet-a"}, nil, 10)
+		if err != nil || len(history) != 2 || history[1].TxID != "tx-1" || history[1].Confirmations != 2 {
+			t.Errorf("history confirmations: %+v (%v)", history, err)
+		}
+
+		// A duplicate block rolls back as a whole
+		dup := &blockchain.Block{Index: 3, Hash: "00first", PreviousHash: "00second", Difficulty: 2}
+		if err := c.InsertBlock(ctx, dup); err == nil {
+			t.Error("duplicate block hash accepted")
+		}
+	})
+}
+
+func TestStoreTransactionHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+		seedWallet(t, c, "c@example.com", "wallet-c")
+
+		txs := []TxRecord{
+			{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 10, Note: "Rent March"},
+			{TxID: "tx-2", SenderWalletID: "wallet-b", ReceiverWalletID: "wallet-a", Amount: 25, Note: "refund"},
+			{TxID: "tx-3", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-c", Amount: 40, Note: "rent April"},
+			{TxID: "tx-4", SenderWalletID: "wallet-c", ReceiverWalletID: "wallet-a", Amount: 5, Note: "100% done"},
+			{TxID: "tx-5", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 60},
+			{TxID: "tx-6", SenderWalletID: "wallet-b", ReceiverWalletID: "wallet-c", Amount: 99, Note: "not ours"},
+			{TxID: "tx-7", SenderWalletID: "wallet-c", ReceiverWalletID: "wallet-a", Amount: 15, Note: "100 percent"},
+		}
+		for _, rec := range txs {
+			rec.Signature = []byte("sig")
+			if err := c.InsertTransaction(ctx, rec); err != nil {
+				t.Fatalf("InsertTransaction: %v", err)
+			}
+		}
+		if err := c.InsertBlock(ctx, &blockchain.Block{Index: 1, Hash: "00b1", PreviousHash: "0", Transactions: []string{"tx-1", "tx-2"}}); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+
+		// Page through everything; rows created in the same instant are ordered by tx_id
+		var seen []string
+		var after *HistoryCursor
+		for page := 0; page < 5; page++ {
+			rows, err := c.QueryTransactionHistory(ctx, HistoryFilter{WalletID: "wallet-a"}, after, 4)
+			if err != nil {
+				t.Fatalf("QueryTransactionHistory: %v", err)
+			}
+			for _, r := range rows {
+				seen = append(seen, r.TxID)
+			}
+			if len(rows) < 4 {
+				break
+			}
+			cur := CursorFor(rows[len(rows)-1])
+			decoded, err := DecodeHistoryCursor(cur.Encode())
+			if err != nil {
+				t.Fatalf("cursor round trip: %v", err)
+			}
+			after = decoded
+		}
+		if len(seen) != 6 {
+			t.Fatalf("paged over %v, want the 6 transactions of wallet-a once each", seen)
+		}
+		unique := map[string]bool{}
+		for _, id := range seen {
+			unique[id] = true
+		}
+		if len(unique) != 6 || unique["tx-6"] {
+			t.Errorf("unexpected pages: %v", seen)
+		}
+
+		min, max := int64(10), int64(40)
+		cases := []struct {
+			name string
+			f    HistoryFilter
+			want int
+		}{
+			{"sent", HistoryFilter{Direction: DirectionSent}, 3},
+			{"received", HistoryFilter{Direction: DirectionReceived}, 3},
+			{"counterparty", HistoryFilter{Counterparty: "wallet-c"}, 3},
+			{"amount range", HistoryFilter{MinAmount: &min, MaxAmount: &max}, 4},
+			{"status", HistoryFilter{Status: TxStatusMined}, 2},
+			{"type", HistoryFilter{TxType: "transfer"}, 6},
+			{"search is case-insensitive", HistoryFilter{Search: "RENT"}, 2},
+			{"search escapes wildcards", HistoryFilter{Search: "100%"}, 1},
+			{"sent to counterparty", HistoryFilter{Direction: DirectionSent, Counterparty: "wallet-b"}, 2},
+		}
+		for _, tc := range cases {
+			tc.f.WalletID = "wallet-a"
+			rows, err := c.QueryTransactionHistory(ctx, tc.f, nil, 50)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if len(rows) != tc.want {
+				t.Errorf("%s: got %d transactions, want %d", tc.name, len(rows), tc.want)
+			}
+			totals, err := c.GetTransactionTotals(ctx, tc.f)
+			if err != nil || totals.Count != int64(tc.want) {
+				t.Errorf("%s: totals %+v (%v), want count %d", tc.name, totals, err, tc.want)
+			}
+		}
+
+		future := time.Now().Add(time.Hour)
+		past := time.Now().Add(-time.Hour)
+		if rows, _ := c.QueryTransactionHistory(ctx, HistoryFilter{WalletID: "wallet-a", From: &future}, nil, 50); len(rows) != 0 {
+			t.Errorf("future date range returned %d rows", len(rows))
+		}
+		if rows, _ := c.QueryTransactionHistory(ctx, HistoryFilter{WalletID: "wallet-a", From: &past, To: &future}, nil, 50); len(rows) != 6 {
+			t.Errorf("current date range returned %d rows, want 6", len(rows))
+		}
+
+		totals, err := c.GetTransactionTotals(ctx, HistoryFilter{WalletID: "wallet-a"})
+		if err != nil {
+			t.Fatalf("GetTransactionTotals: %v", err)
+		}
+		if totals != (HistoryTotals{Count: 6, Sent: 110, Received: 45}) {
+			t.Errorf("totals = %+v", totals)
+		}
+
+		// An asset transfer is counted but not summed with coins
+		gold := TxRecord{TxID: "tx-gold", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 500, Asset: "gold", Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, gold); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		totals, err = c.GetTransactionTotals(ctx, HistoryFilter{WalletID: "wallet-a"})
+		if err != nil || totals != (HistoryTotals{Count: 7, Sent: 110, Received: 45}) {
+			t.Errorf("totals with an asset transfer = %+v (%v)", totals, err)
+		}
+	})
+}
+
+func TestStoreOTPs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		if err := c.InsertOTP(ctx, "a@example.com", "111111", time.Now().Add(5*time.Minute)); err != nil {
+			t.Fatalf("InsertOTP: %v", err)
+		}
+		_ = c.InsertOTP(ctx, "a@example.com", "222222", time.Now().Add(-time.Minute))
+
+		if ok, err := c.VerifyOTP(ctx, "a@example.com", "222222"); ok || err != nil {
+			t.Errorf("expired OTP accepted (%v)", err)
+		}
+		if ok, err := c.VerifyOTP(ctx, "a@example.com", "111111"); !ok || err != nil {
+			t.Fatalf("valid OTP rejected (%v)", err)
+		}
+		if ok, _ := c.VerifyOTP(ctx, "a@example.com", "111111"); ok {
+			t.Error("OTP accepted twice")
+		}
+		if n, err := c.DeleteExpiredOTPs(ctx); n != 2 || err != nil {
+			t.Errorf("DeleteExpiredOTPs removed %d (%v), want 2", n, err)
+		}
+	})
+}
+
+func TestStoreBeneficiaries(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "a@example.com", "wallet-a")
+
+		if err := c.AddBeneficiary(ctx, userID, "wallet-b", "Bilal"); err != nil {
+			t.Fatalf("AddBeneficiary: %v", err)
+		}
+		if err := c.AddBeneficiary(ctx, userID, "wallet-b", "Bilal again"); err == nil {
+			t.Error("duplicate beneficiary accepted")
+		}
+		list, err := c.GetBeneficiaries(ctx, userID)
+		if err != nil || len(list) != 1 || list[0].Name != "Bilal" {
+			t.Fatalf("unexpected beneficiaries: %+v (%v)", list, err)
+		}
+		if err := c.RemoveBeneficiary(ctx, list[0].ID); err != nil {
+			t.Fatalf("RemoveBeneficiary: %v", err)
+		}
+		if list, _ := c.GetBeneficiaries(ctx, userID); len(list) != 0 {
+			t.Errorf("beneficiary not removed: %+v", list)
+		}
+	})
+}
+
+func TestStoreStandingOrders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		now := time.Now().Truncate(time.Second)
+		o := orders.Order{UserID: userID, SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b",
+			Amount: 10, Schedule: "@monthly", NextRunAt: now.Add(-time.Minute), Status: orders.StatusActive}
+		id, err := c.InsertStandingOrder(ctx, o, false)
+		if err != nil {
+			t.Fatalf("InsertStandingOrder: %v", err)
+		}
+
+		due, err := c.GetDueStandingOrders(ctx, now)
+		if err != nil || len(due) != 1 || due[0].ID != id {
+			t.Fatalf("unexpected due orders: %+v (%v)", due, err)
+		}
+		if !due[0].NextRunAt.Equal(o.NextRunAt) {
+			t.Errorf("next run = %s, want %s", due[0].NextRunAt, o.NextRunAt)
+		}
+
+		exec := orders.Execution{OrderID: id, Status: orders.RunFailed, Error: "insufficient funds", RunAt: now}
+		if err := c.RecordStandingOrderRun(ctx, exec); err != nil {
+			t.Fatalf("RecordStandingOrderRun: %v", err)
+		}
+		if err := c.AdvanceStandingOrder(ctx, exec, now.AddDate(0, 1, 0), orders.StatusActive); err != nil {
+			t.Fatalf("AdvanceStandingOrder: %v", err)
+		}
+		if due, _ := c.GetDueStandingOrders(ctx, now); len(due) != 0 {
+			t.Errorf("advanced order still due: %+v", due)
+		}
+
+		got, err := c.GetStandingOrder(ctx, id, userID)
+		if err != nil || got.FailureCount != 1 || got.LastError != "insufficient funds" || got.LastRunAt == nil {
+			t.Errorf("order not advanced: %+v (%v)", got, err)
+		}
+		if _, err := c.GetStandingOrder(ctx, id, "someone-else"); err != sql.ErrNoRows {
+			t.Errorf("order visible to another user (%v)", err)
+		}
+
+		got.Status = orders.StatusPaused
+		if err := c.UpdateStandingOrder(ctx, got, false); err != nil {
+			t.Fatalf("UpdateStandingOrder: %v", err)
+		}
+		if list, _ := c.GetStandingOrders(ctx, userID); len(list) != 1 || list[0].Status != orders.StatusPaused {
+			t.Errorf("unexpected orders: %+v", list)
+		}
+		if runs, _ := c.GetStandingOrderRuns(ctx, id, 10); len(runs) != 1 || runs[0].Status != orders.RunFailed {
+			t.Errorf("unexpected runs: %+v", runs)
+		}
+	})
+}
+
+func TestStoreWebhooks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "shop@example.com", "wallet-shop")
+		otherID := seedWallet(t, c, "other@example.com", "wallet-other")
+		now := time.Now().UTC().Truncate(time.Millisecond)
+
+		endpointID, err := c.InsertWebhookEndpoint(ctx, webhook.Endpoint{UserID: userID, WalletID: "wallet-shop",
+			URL: "https://shop.example/hooks", Secret: "whsec_1", Active: true,
+			Events: []string{webhook.EventPaymentReceived, webhook.EventPaymentConfirmed}})
+		if err != nil {
+			t.Fatalf("InsertWebhookEndpoint: %v", err)
+		}
+		active, err := c.GetActiveWebhookEndpoints(ctx, "wallet-shop")
+		if err != nil || len(active) != 1 || active[0].Secret != "whsec_1" || len(active[0].Events) != 2 {
+			t.Fatalf("GetActiveWebhookEndpoints = %+v, %v", active, err)
+		}
+		listed, _ := c.GetWebhookEndpoints(ctx, userID)
+		if len(listed) != 1 || listed[0].Secret != "" {
+			t.Fatalf("GetWebhookEndpoints should hide secrets: %+v", listed)
+		}
+
+		d := webhook.Delivery{EndpointID: endpointID, EventID: "evt_1", EventType: webhook.EventPaymentReceived,
+			Payload: []byte(`{"id":"evt_1"}`), Status: webhook.StatusPending, NextAttemptAt: now}
+		// The duplicate is dropped by the outbox
+		if err := c.InsertWebhookDeliveries(ctx, []webhook.Delivery{d, d}); err != nil {
+			t.Fatalf("InsertWebhookDeliveries: %v", err)
+		}
+
+		due, err := c.ClaimWebhookDeliveries(ctx, now, now.Add(time.Minute), 10)
+		if err != nil || len(due) != 1 {
+			t.Fatalf("ClaimWebhookDeliveries = %d, %v", len(due), err)
+		}
+		if due[0].Endpoint.URL != "https://shop.example/hooks" || string(due[0].Delivery.Payload) != `{"id":"evt_1"}` {
+			t.Fatalf("claimed %+v", due[0])
+		}
+		// Leased: a second sender gets nothing until the lease runs out
+		if again, _ := c.ClaimWebhookDeliveries(ctx, now, now.Add(time.Minute), 10); len(again) != 0 {
+			t.Fatalf("delivery claimed twice")
+		}
+
+		del := due[0].Delivery
+		del.Attempts, del.Status, del.LastAttemptAt, del.LastError = 1, webhook.StatusDead, &now, "HTTP 500: boom"
+		del.LastStatusCode = 500
+		att := webhook.Attempt{DeliveryID: del.ID, Attempt: 1, AttemptedAt: now, StatusCode: 500, Error: "HTTP 500: boom", DurationMs: 12}
+		if err := c.RecordWebhookAttempt(ctx, del, att); err != nil {
+			t.Fatalf("RecordWebhookAttempt: %v", err)
+		}
+
+		dead, err := c.GetWebhookDeliveries(ctx, userID, "", webhook.StatusDead, 10)
+		if err != nil || len(dead) != 1 || dead[0].LastStatusCode != 500 || dead[0].Attempts != 1 {
+			t.Fatalf("dead letters = %+v, %v", dead, err)
+		}
+		if others, _ := c.GetWebhookDeliveries(ctx, otherID, "", "", 10); len(others) != 0 {
+			t.Fatalf("another user sees %d deliveries", len(others))
+		}
+		log, err := c.GetWebhookAttempts(ctx, del.ID, userID)
+		if err != nil || len(log) != 1 || log[0].StatusCode != 500 || log[0].DurationMs != 12 {
+			t.Fatalf("attempt log = %+v, %v", log, err)
+		}
+
+		if err := c.ReplayWebhookDelivery(ctx, del.ID, otherID, now); err != sql.ErrNoRows {
+			t.Fatalf("replay by another user: %v", err)
+		}
+		if err := c.ReplayWebhookDelivery(ctx, del.ID, userID, now); err != nil {
+			t.Fatalf("ReplayWebhookDelivery: %v", err)
+		}
+		due, _ = c.ClaimWebhookDeliveries(ctx, now, now.Add(time.Minute), 10)
+		if len(due) != 1 || due[0].Delivery.Attempts != 0 || due[0].Delivery.Status != webhook.StatusPending {
+			t.Fatalf("replayed delivery not due: %+v", due)
+		}
+
+		if err := c.DeleteWebhookEndpoint(ctx, endpointID, otherID); err != sql.ErrNoRows {
+			t.Fatalf("delete by another user: %v", err)
+		}
+		if err := c.DeleteWebhookEndpoint(ctx, endpointID, userID); err != nil {
+			t.Fatalf("DeleteWebhookEndpoint: %v", err)
+		}
+		if left, _ := c.GetWebhookDeliveries(ctx, userID, "", "", 10); len(left) != 0 {
+			t.Fatalf("deliveries outlived their endpoint: %d", len(left))
+		}
+	})
+}
+
+func TestStoreJobs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+
+		unlock, ok, err := c.TryLock(ctx, "job:test")
+		if err != nil || !ok {
+			t.Fatalf("TryLock: ok=%v err=%v", ok, err)
+		}
+		if _, again, _ := c.TryLock(ctx, "job:test"); again {
+			t.Error("lock taken twice")
+		}
+		unlock()
+		unlock, ok, _ = c.TryLock(ctx, "job:test")
+		if !ok {
+			t.Fatal("lock not released")
+		}
+		unlock()
+
+		start := time.Now()
+		run := jobs.Run{JobName: "zakat", Attempt: 1, Status: jobs.StatusSuccess, StartedAt: start, FinishedAt: start.Add(time.Second)}
+		if err := c.RecordJobRun(ctx, run); err != nil {
+			t.Fatalf("RecordJobRun: %v", err)
+		}
+		_ = c.RecordJobRun(ctx, jobs.Run{JobName: "otp-cleanup", Attempt: 1, Status: jobs.StatusFailed, Error: "boom", StartedAt: start, FinishedAt: start})
+
+		runs, err := c.GetJobRuns(ctx, "zakat", 10)
+		if err != nil || len(runs) != 1 || runs[0].Status != jobs.StatusSuccess {
+			t.Fatalf("unexpected runs: %+v (%v)", runs, err)
+		}
+		if all, _ := c.GetJobRuns(ctx, "", 10); len(all) != 2 {
+			t.Errorf("expected 2 runs in total, got %d", len(all))
+		}
+	})
+}
+
+func TestStoreInvoices(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "merchant@example.com", "wallet-merchant")
+		otherID := seedWallet(t, c, "buyer@example.com", "wallet-buyer")
+		now := time.Now().UTC().Truncate(time.Millisecond)
+
+		inv := invoice.Invoice{Reference: "INV-ABCDEFGHIJ", UserID: userID, WalletID: "wallet-merchant",
+			Amount: 100, Memo: "Order 7", Status: invoice.StatusOpen, ExpiresAt: now.Add(time.Hour)}
+		id, err := c.InsertInvoice(ctx, inv)
+		if err != nil {
+			t.Fatalf("InsertInvoice: %v", err)
+		}
+		stale := inv
+		stale.Reference, stale.ExpiresAt = "INV-KLMNOPQRST", now.Add(-time.Minute)
+		if _, err := c.InsertInvoice(ctx, stale); err != nil {
+			t.Fatalf("InsertInvoice: %v", err)
+		}
+
+		got, err := c.GetInvoiceByReference(ctx, "INV-ABCDEFGHIJ")
+		if err != nil || got.ID != id || got.Amount != 100 || got.Memo != "Order 7" {
+			t.Fatalf("GetInvoiceByReference = %+v, %v", got, err)
+		}
+		if _, err := c.GetInvoice(ctx, id, otherID); err != sql.ErrNoRows {
+			t.Fatalf("another user's invoice: %v", err)
+		}
+
+		pay := invoice.Payment{InvoiceID: id, TxID: "tx-1", Amount: 40, BlockIndex: 3, BlockHash: "h3", PaidAt: now}
+		updated, err := c.RecordInvoicePayment(ctx, pay, now)
+		if err != nil || updated == nil || updated.Status != invoice.StatusUnderpaid || updated.AmountPaid != 40 {
+			t.Fatalf("partial payment = %+v, %v", updated, err)
+		}
+		// Matching the same transaction again changes nothing
+		if again, err := c.RecordInvoicePayment(ctx, pay, now); err != nil || again != nil {
+			t.Fatalf("duplicate payment = %+v, %v", again, err)
+		}
+		pay.TxID, pay.Amount = "tx-2", 60
+		updated, err = c.RecordInvoicePayment(ctx, pay, now)
+		if err != nil || updated.Status != invoice.StatusPaid || updated.AmountPaid != 100 || updated.PaidAt == nil {
+			t.Fatalf("full payment = %+v, %v", updated, err)
+		}
+
+		payments, err := c.GetInvoicePayments(ctx, id)
+		if err != nil || len(payments) != 2 || payments[1].TxID != "tx-2" || payments[0].BlockHash != "h3" {
+			t.Fatalf("GetInvoicePayments = %+v, %v", payments, err)
+		}
+
+		n, err := c.ExpireInvoices(ctx, now)
+		if err != nil || n != 1 {
+			t.Fatalf("ExpireInvoices = %d, %v", n, err)
+		}
+		expired, _ := c.GetInvoices(ctx, userID, invoice.StatusExpired, 10)
+		if len(expired) != 1 || expired[0].Reference != "INV-KLMNOPQRST" {
+			t.Fatalf("expired invoices = %+v", expired)
+		}
+		all, _ := c.GetInvoices(ctx, userID, "", 10)
+		if len(all) != 2 {
+			t.Fatalf("GetInvoices = %d invoices, want 2", len(all))
+		}
+	})
+}
+
+func TestStoreMultisig(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "treasurer@example.com", "wallet-treasurer")
+		seedWallet(t, c, "vendor@example.com", "wallet-vendor")
+
+		keys := make([]ed25519.PublicKey, 3)
+		for i := range keys {
+			pub, _, _ := ed25519.GenerateKey(nil)
+			keys[i] = pub
+		}
+		policy, err := multisig.NewPolicy(2, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := multisig.Wallet{Address: policy.Address(), Name: "Treasury", Policy: policy, CreatedBy: userID}
+		if err := c.InsertMultisigWallet(ctx, w); err != nil {
+			t.Fatalf("InsertMultisigWallet: %v", err)
+		}
+
+		// It is a wallet like any other: it can hold funds
+		if err := c.InsertUTXO(ctx, "fund-1", w.Address, 500); err != nil {
+			t.Fatalf("InsertUTXO to multisig wallet: %v", err)
+		}
+		row, err := c.GetWalletByID(ctx, w.Address)
+		if err != nil || row.UserID != "" {
+			t.Fatalf("GetWalletByID = %+v, %v", row, err)
+		}
+
+		got, err := c.GetMultisigWallet(ctx, w.Address)
+		if err != nil || got.Name != "Treasury" || got.Policy.Threshold != 2 || got.Policy.Address() != w.Address {
+			t.Fatalf("GetMultisigWallet = %+v, %v", got, err)
+		}
+		byKey, err := c.GetMultisigWalletsByKey(ctx, keys[1])
+		if err != nil || len(byKey) != 1 || byKey[0].Address != w.Address {
+			t.Fatalf("GetMultisigWalletsByKey = %+v, %v", byKey, err)
+		}
+
+		p := multisig.Proposal{WalletID: w.Address, ReceiverID: "wallet-vendor", Amount: 120, Note: "invoice 9",
+			Timestamp: 1700000000, Inputs: []string{"utxo-1", "utxo-2"}, Status: multisig.ProposalPending}
+		p.ID, err = c.InsertMultisigProposal(ctx, p)
+		if err != nil {
+			t.Fatalf("InsertMultisigProposal: %v", err)
+		}
+		sig := multisig.Signature{PublicKey: keys[0], Signature: []byte("sig-0")}
+		for i := 0; i < 2; i++ {
+			if err := c.AddMultisigSignature(ctx, p.ID, sig); err != nil {
+				t.Fatalf("AddMultisigSignature: %v", err)
+			}
+		}
+		loaded, err := c.GetMultisigProposal(ctx, p.ID)
+		if err != nil || len(loaded.Signatures) != 1 || !loaded.Signatures[0].PublicKey.Equal(keys[0]) ||
+			loaded.Timestamp != 1700000000 || !reflect.DeepEqual(loaded.Inputs, p.Inputs) ||
+			string(loaded.Payload()) != string(p.Payload()) {
+			t.Fatalf("GetMultisigProposal = %+v, %v", loaded, err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		if err := c.CloseMultisigProposal(ctx, p.ID, multisig.ProposalExecuted, "tx-ms", now); err != nil {
+			t.Fatalf("CloseMultisigProposal: %v", err)
+		}
+		if err := c.CloseMultisigProposal(ctx, p.ID, multisig.ProposalExecuted, "tx-again", now); err != sql.ErrNoRows {
+			t.Fatalf("second execution: %v", err)
+		}
+		if err := c.AddMultisigSignature(ctx, p.ID, multisig.Signature{PublicKey: keys[1], Signature: []byte("late")}); err == nil {
+			t.Fatalf("signature on an executed proposal accepted")
+		}
+
+		list, err := c.GetMultisigProposals(ctx, w.Address, multisig.ProposalExecuted, 10)
+		if err != nil || len(list) != 1 || list[0].TxID != "tx-ms" || list[0].ExecutedAt == nil {
+			t.Fatalf("GetMultisigProposals = %+v, %v", list, err)
+		}
+
+		// An executed transfer cannot be proposed again, even over other inputs
+		p.Inputs = []string{"utxo-3"}
+		if _, err := c.InsertMultisigProposal(ctx, p); !errors.Is(err, multisig.ErrDuplicateProposal) {
+			t.Fatalf("re-proposing an executed transfer: %v", err)
+		}
+		p.Timestamp++
+		if _, err := c.InsertMultisigProposal(ctx, p); err != nil {
+			t.Fatalf("proposal with a new timestamp: %v", err)
+		}
+	})
+}
+
+func TestStoreUTXOLocks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "payer@example.com", "wallet-a")
+		seedWallet(t, c, "payee@example.com", "wallet-b")
+		seedWallet(t, c, "arbiter@example.com", "wallet-c")
+
+		vesting := utxo.Lock{Kind: utxo.LockTime, Height: 10, Time: 1000}
+		if err := c.InsertLockedUTXO(ctx, "vest-1", "wallet-b", 50, vesting); err != nil {
+			t.Fatalf("InsertLockedUTXO: %v", err)
+		}
+		got, err := c.GetUTXOByID(ctx, "vest-1")
+		if err != nil || got.Lock == nil || !reflect.DeepEqual(*got.Lock, vesting) {
+			t.Fatalf("GetUTXOByID = %+v, %v", got, err)
+		}
+		if err := c.SpendUTXO(ctx, "vest-1", "tx-early"); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("spending a locked UTXO: %v", err)
+		}
+		if err := c.SpendUTXOAt(ctx, "vest-1", "tx-early", 10, 999); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("spending before the lock time: %v", err)
+		}
+		if err := c.SpendUTXOAt(ctx, "vest-1", "tx-vested", 10, 1000); err != nil {
+			t.Fatalf("spending a matured UTXO: %v", err)
+		}
+
+		escrow := utxo.Lock{Kind: utxo.LockEscrow, Time: 2000, Payee: "wallet-b", Arbiter: "wallet-c"}
+		for _, id := range []string{"esc-1", "esc-2", "esc-3"} {
+			if err := c.InsertLockedUTXO(ctx, id, "wallet-a", 30, escrow); err != nil {
+				t.Fatalf("InsertLockedUTXO: %v", err)
+			}
+		}
+		if err := c.SpendUTXOAt(ctx, "esc-1", "tx-x", 100, 5000); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("ordinary spend of an escrow: %v", err)
+		}
+		if err := c.SpendEscrowUTXO(ctx, "vest-1", "tx-x"); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("escrow spend of a spent UTXO: %v", err)
+		}
+
+		release := TxRecord{TxID: "tx-release", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 30,
+			Signature: []byte("sig"), SenderPublicKey: []byte("pub")}
+		refund := TxRecord{TxID: "tx-refund", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-a", Amount: 30,
+			Signature: []byte("sig"), SenderPublicKey: []byte("pub")}
+		for id, rec := range map[string]TxRecord{"esc-1": release, "esc-2": refund} {
+			if err := c.InsertTransaction(ctx, rec); err != nil {
+				t.Fatalf("InsertTransaction: %v", err)
+			}
+			if err := c.SpendEscrowUTXO(ctx, id, rec.TxID); err != nil {
+				t.Fatalf("SpendEscrowUTXO: %v", err)
+			}
+		}
+
+		status := map[string]string{}
+		for _, w := range []string{"wallet-a", "wallet-b", "wallet-c"} {
+			list, err := c.GetEscrows(ctx, w, 10)
+			if err != nil || len(list) != 3 {
+				t.Fatalf("GetEscrows(%s) = %+v, %v", w, list, err)
+			}
+			for _, e := range list {
+				status[e.UTXOID] = e.Status
+			}
+		}
+		want := map[string]string{"esc-1": utxo.EscrowReleased, "esc-2": utxo.EscrowRefunded, "esc-3": utxo.EscrowHeld}
+		for id, s := range want {
+			if status[id] != s {
+				t.Errorf("escrow %s status = %q, want %q", id, status[id], s)
+			}
+		}
+
+		scripted := utxo.Lock{Kind: utxo.LockScript, Script: []byte{0x51}}
+		if err := c.InsertLockedUTXO(ctx, "scr-1", "wallet-b", 20, scripted); err != nil {
+			t.Fatalf("InsertLockedUTXO: %v", err)
+		}
+		got, err = c.GetUTXOByID(ctx, "scr-1")
+		if err != nil || got.Lock == nil || !reflect.DeepEqual(*got.Lock, scripted) {
+			t.Fatalf("GetUTXOByID = %+v, %v", got.Lock, err)
+		}
+		if err := c.SpendUTXOAt(ctx, "scr-1", "tx-x", 100, 5000); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("ordinary spend of a script-locked UTXO: %v", err)
+		}
+		if err := c.SpendEscrowUTXO(ctx, "scr-1", "tx-x"); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("escrow spend of a script-locked UTXO: %v", err)
+		}
+		if err := c.SpendScriptUTXO(ctx, "esc-3", "tx-x"); !errors.Is(err, ErrUTXOUnavailable) {
+			t.Fatalf("script spend of an escrow: %v", err)
+		}
+		if err := c.SpendScriptUTXO(ctx, "scr-1", "tx-script"); err != nil {
+			t.Fatalf("SpendScriptUTXO: %v", err)
+		}
+	})
+}
+
+func TestStoreHTLCs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		claimer, _, _ := ed25519.GenerateKey(nil)
+		refunder, _, _ := ed25519.GenerateKey(nil)
+		base := htlc.HTLC{SenderID: "wallet-a", ReceiverID: "wallet-b", Amount: 25, Hash: strings.Repeat("ab", 32),
+			Claimer: claimer, Refunder: refunder, Timeout: 1700000000}
+		for _, id := range []string{"h-1", "h-2"} {
+			h := base
+			h.ID, h.TxID = id, "tx-"+id
+			if err := c.InsertHTLC(ctx, h); err != nil {
+				t.Fatalf("InsertHTLC: %v", err)
+			}
+		}
+
+		got, err := c.GetHTLC(ctx, "h-1")
+		if err != nil || got.Status != htlc.StatusOpen || got.Amount != 25 || !got.Claimer.Equal(claimer) || got.SettledAt != nil {
+			t.Fatalf("GetHTLC = %+v, %v", got, err)
+		}
+		if list, err := c.GetHTLCsByHash(ctx, base.Hash); err != nil || len(list) != 2 {
+			t.Fatalf("GetHTLCsByHash = %+v, %v", list, err)
+		}
+		for _, w := range []string{"wallet-a", "wallet-b"} {
+			if list, err := c.GetHTLCs(ctx, w, 10); err != nil || len(list) != 2 {
+				t.Fatalf("GetHTLCs(%s) = %+v, %v", w, list, err)
+			}
+		}
+		if list, _ := c.GetHTLCs(ctx, "wallet-c", 10); len(list) != 0 {
+			t.Fatalf("GetHTLCs of an unrelated wallet = %+v", list)
+		}
+
+		now := time.Now()
+		if err := c.SettleHTLC(ctx, "h-1", htlc.StatusClaimed, "tx-claim", "cafe", now); err != nil {
+			t.Fatalf("SettleHTLC: %v", err)
+		}
+		if err := c.SettleHTLC(ctx, "h-1", htlc.StatusRefunded, "tx-refund", "", now); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("settling twice: %v", err)
+		}
+		got, _ = c.GetHTLC(ctx, "h-1")
+		if got.Status != htlc.StatusClaimed || got.Secret != "cafe" || got.SettleTxID != "tx-claim" || got.SettledAt == nil {
+			t.Fatalf("claimed HTLC = %+v", got)
+		}
+		if err := c.SettleHTLC(ctx, "h-2", htlc.StatusRefunded, "tx-refund", "", now); err != nil {
+			t.Fatalf("SettleHTLC refund: %v", err)
+		}
+		if got, _ = c.GetHTLC(ctx, "h-2"); got.Status != htlc.StatusRefunded || got.Secret != "" {
+			t.Fatalf("refunded HTLC = %+v", got)
+		}
+	})
+}
+
+func TestStoreAssets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "holder@example.com", "wallet-a")
+		seedWallet(t, c, "other@example.com", "wallet-b")
+
+		issuer, _, _ := ed25519.GenerateKey(nil)
+		pts := asset.Asset{ID: asset.ID(issuer, "PTS"), Symbol: "PTS", Name: "Points", IssuerKey: issuer, ZakatBPS: 100}
+		if err := c.InsertAsset(ctx, pts); err != nil {
+			t.Fatalf("InsertAsset: %v", err)
+		}
+		if err := c.InsertAsset(ctx, pts); err == nil {
+			t.Fatal("registering an asset twice should fail")
+		}
+
+		issue := TxRecord{TxID: "tx-issue", SenderWalletID: "wallet-b", ReceiverWalletID: "wallet-a", Amount: 500,
+			Signature: []byte("sig"), SenderPublicKey: issuer, Asset: pts.ID}
+		if err := c.IssueAsset(ctx, issue, "tx-issue_recv", false); err != nil {
+			t.Fatalf("IssueAsset: %v", err)
+		}
+		unknown := issue
+		unknown.TxID, unknown.Asset = "tx-unknown", "no-such-asset"
+		if err := c.IssueAsset(ctx, unknown, "tx-unknown_recv", false); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("issuing an unknown asset: %v", err)
+		}
+		if err := c.InsertUTXO(ctx, "coin-1", "wallet-a", 70); err != nil {
+			t.Fatalf("InsertUTXO: %v", err)
+		}
+		if err := c.InsertAssetUTXO(ctx, "pts-2", "wallet-b", pts.ID, 20, nil); err != nil {
+			t.Fatalf("InsertAssetUTXO: %v", err)
+		}
+
+		got, err := c.GetAsset(ctx, pts.ID)
+		if err != nil || got.Supply != 500 || got.ZakatBPS != 100 || !got.IssuerKey.Equal(issuer) || got.Name != "Points" {
+			t.Fatalf("GetAsset = %+v, %v", got, err)
+		}
+		if u, err := c.GetUTXOByID(ctx, "tx-issue_recv"); err != nil || u.Asset != pts.ID || u.Amount != 500 {
+			t.Fatalf("issued UTXO = %+v, %v", u, err)
+		}
+		if rec, err := c.GetTransactionByID(ctx, "tx-issue"); err != nil || rec.TxType != "issuance" || rec.Asset != pts.ID {
+			t.Fatalf("issuance record = %+v, %v", rec, err)
+		}
+
+		if bal, err := c.GetBalance(ctx, "wallet-a"); err != nil || bal != 70 {
+			t.Fatalf("native balance = %d, %v; want 70", bal, err)
+		}
+		if bals, err := c.GetAssetBalances(ctx, "wallet-a"); err != nil || len(bals) != 1 || bals[pts.ID] != 500 {
+			t.Fatalf("GetAssetBalances = %v, %v", bals, err)
+		}
+		holders, err := c.GetAssetHolders(ctx, pts.ID)
+		if err != nil || !reflect.DeepEqual(holders, map[string]int64{"wallet-a": 500, "wallet-b": 20}) {
+			t.Fatalf("GetAssetHolders = %v, %v", holders, err)
+		}
+		// Tokens stay out of the native supply
+		if stats, err := c.GetChainStats(ctx); err != nil || stats.TotalSupply != 70 {
+			t.Fatalf("chain stats = %+v, %v", stats, err)
+		}
+		if err := c.SpendUTXO(ctx, "tx-issue_recv", "tx-spend"); err != nil {
+			t.Fatalf("SpendUTXO: %v", err)
+		}
+		if stats, _ := c.GetChainStats(ctx); stats.TotalSupply != 70 {
+			t.Fatalf("spending a token changed the native supply: %+v", stats)
+		}
+
+		if list, err := c.GetZakatAssets(ctx); err != nil || len(list) != 1 || list[0].ID != pts.ID {
+			t.Fatalf("GetZakatAssets = %+v, %v", list, err)
+		}
+		if err := c.SetAssetZakat(ctx, pts.ID, 0); err != nil {
+			t.Fatalf("SetAssetZakat: %v", err)
+		}
+		if err := c.SetAssetZakat(ctx, "no-such-asset", 0); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("SetAssetZakat of an unknown asset: %v", err)
+		}
+		if list, err := c.ListAssets(ctx, 10); err != nil || len(list) != 1 || list[0].ZakatBPS != 0 {
+			t.Fatalf("ListAssets = %+v, %v", list, err)
+		}
+		if list, err := c.GetZakatAssets(ctx); err != nil || len(list) != 0 {
+			t.Fatalf("GetZakatAssets after exempting = %+v, %v", list, err)
+		}
+	})
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	mine := func(index int64, prev string, entries ...string) StoredBlock {
+		b := &blockchain.Block{Index: index, Timestamp: 1700000000 + index, Transactions: entries,
+			MerkleRoot: blockchain.MerkleRoot(entries), PreviousHash: prev}
+		b.MineBlock(1)
+		ts := b.Timestamp
+		return StoredBlock{BlockRecord: BlockRecord{Index: b.Index, Hash: b.Hash, PreviousHash: prev,
+			MerkleRoot: b.MerkleRoot, Nonce: b.Nonce, Difficulty: b.Difficulty, TxIDs: entries}, Timestamp: &ts, Entries: entries}
+	}
+	one := mine(1, "genesis-a", "tx-1")
+	two := mine(2, one.Hash, "tx-2")
+	restart := mine(1, "genesis-b")
+	legacy := StoredBlock{BlockRecord: BlockRecord{Index: 2, Hash: "0legacy", PreviousHash: restart.Hash}}
+
+	r := VerifyBlocks([]StoredBlock{one, two, restart, legacy})
+	if len(r.Issues) != 0 || r.Segments != 2 || r.Unhashed != 1 {
+		t.Fatalf("healthy chain: %+v", r)
+	}
+
+	tampered := two
+	tampered.Entries = []string{"tx-2", "tx-forged"}
+	fork := mine(2, one.Hash, "tx-3")
+	r = VerifyBlocks([]StoredBlock{one, tampered, fork})
+	var problems []string
+	for _, i := range r.Issues {
+		problems = append(problems, i.Problem)
+	}
+	got := strings.Join(problems, "; ")
+	for _, want := range []string{"hash does not match contents", "merkle root does not match", "2 blocks build on this block"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("issues %q lack %q", got, want)
+		}
+	}
+}
+
+func TestStoreMaintenance(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "a@example.com", "wallet-a")
+		seedWallet(t, c, "b@example.com", "wallet-b")
+
+		// wallet-a pays 30 of a 100 deposit to wallet-b, but the change output was never stored
+		if err := c.InsertUTXO(ctx, "deposit", "wallet-a", 100); err != nil {
+			t.Fatalf("InsertUTXO: %v", err)
+		}
+		if err := c.SpendUTXO(ctx, "deposit", "tx-1"); err != nil {
+			t.Fatalf("SpendUTXO: %v", err)
+		}
+		if err := c.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 30); err != nil {
+			t.Fatalf("InsertUTXO: %v", err)
+		}
+		rec := TxRecord{TxID: "tx-1", SenderWalletID: "wallet-a", ReceiverWalletID: "wallet-b", Amount: 30, Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		b := &blockchain.Block{Index: 1, Timestamp: time.Now().Unix(), Transactions: []string{"tx-1", "MINING_REWARD:wallet-a"},
+			PreviousHash: "genesis", Miner: "wallet-a"}
+		b.MerkleRoot = blockchain.MerkleRoot(b.Transactions)
+		b.MineBlock(1)
+		if err := c.InsertBlock(ctx, b); err != nil {
+			t.Fatalf("InsertBlock: %v", err)
+		}
+
+		report, err := c.VerifyChain(ctx)
+		if err != nil || report.Blocks != 1 || report.Unhashed != 0 || len(report.Issues) != 0 {
+			t.Fatalf("VerifyChain = %+v, %v", report, err)
+		}
+
+		repairs, err := c.RepairOutputs(ctx, false)
+		if err != nil || len(repairs) != 1 || repairs[0].UTXOID != "tx-1_change" || repairs[0].Amount != 70 || repairs[0].Repaired {
+			t.Fatalf("RepairOutputs dry run = %+v, %v", repairs, err)
+		}
+		if repairs, err = c.RepairOutputs(ctx, true); err != nil || !repairs[0].Repaired {
+			t.Fatalf("RepairOutputs = %+v, %v", repairs, err)
+		}
+		if u, err := c.GetUTXOByID(ctx, "tx-1_change"); err != nil || u.Owner != "wallet-a" || u.Amount != 70 {
+			t.Fatalf("recreated change = %+v, %v", u, err)
+		}
+		if repairs, _ = c.RepairOutputs(ctx, false); len(repairs) != 0 {
+			t.Fatalf("outputs still need repair: %+v", repairs)
+		}
+
+		supply, err := c.SupplySummary(ctx)
+		if err != nil || len(supply) != 1 || supply[0].Amount != 100 || supply[0].UTXOs != 2 || supply[0].Holders != 2 {
+			t.Fatalf("SupplySummary = %+v, %v", supply, err)
+		}
+
+		// Rebuilding reproduces what the writes maintained incrementally
+		before, _ := c.GetChainStats(ctx)
+		beforeA, _ := c.GetAddressStats(ctx, "wallet-a")
+		if _, err := c.db.ExecContext(ctx, "UPDATE chain_stats SET total_supply = 0, tx_count = 0 WHERE id = 1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.RebuildStats(ctx); err != nil {
+			t.Fatalf("RebuildStats: %v", err)
+		}
+		after, _ := c.GetChainStats(ctx)
+		afterA, _ := c.GetAddressStats(ctx, "wallet-a")
+		if after.TotalSupply != before.TotalSupply || after.UTXOCount != before.UTXOCount ||
+			after.TxCount != before.TxCount || after.BlockCount != before.BlockCount {
+			t.Errorf("chain stats rebuilt as %+v, were %+v", after, before)
+		}
+		if afterA.Received != beforeA.Received || afterA.Sent != beforeA.Sent || afterA.Balance != beforeA.Balance || afterA.TxCount != beforeA.TxCount {
+			t.Errorf("address stats rebuilt as %+v, were %+v", afterA, beforeA)
+		}
+
+		// A pending transfer that never got mined is reverted
+		if err := c.SpendUTXO(ctx, "tx-1_recv", "tx-2"); err != nil {
+			t.Fatalf("SpendUTXO: %v", err)
+		}
+		if err := c.InsertUTXO(ctx, "tx-2_recv", "wallet-a", 30); err != nil {
+			t.Fatalf("InsertUTXO: %v", err)
+		}
+		pending := TxRecord{TxID: "tx-2", SenderWalletID: "wallet-b", ReceiverWalletID: "wallet-a", Amount: 30, Signature: []byte("sig")}
+		if err := c.InsertTransaction(ctx, pending); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		if dropped, err := c.DropStalePending(ctx, time.Now().Add(-time.Hour)); err != nil || len(dropped) != 0 {
+			t.Fatalf("recent transaction dropped: %v, %v", dropped, err)
+		}
+
+		snap, err := c.ExportSnapshot(ctx)
+		if err != nil || len(snap.Blocks) != 1 || len(snap.Transactions) != 2 || len(snap.UTXOs) != 4 {
+			t.Fatalf("ExportSnapshot = %+v, %v", snap, err)
+		}
+
+		dropped, err := c.DropStalePending(ctx, time.Now().Add(time.Hour))
+		if err != nil || !reflect.DeepEqual(dropped, []string{"tx-2"}) {
+			t.Fatalf("DropStalePending = %v, %v", dropped, err)
+		}
+		if u, err := c.GetUTXOByID(ctx, "tx-1_recv"); err != nil || u.Spent {
+			t.Errorf("input of the dropped transaction still spent: %+v, %v", u, err)
+		}
+		if _, err := c.GetUTXOByID(ctx, "tx-2_recv"); err == nil {
+			t.Error("output of the dropped transaction still exists")
+		}
+		if got, _ := c.GetTransactionByID(ctx, "tx-2"); got.Status != TxStatusDropped {
+			t.Errorf("dropped transaction status = %q", got.Status)
+		}
+
+		if err := c.InsertLog(ctx, "wallet-a", "login", "", "ok", ""); err != nil {
+			t.Fatalf("InsertLog: %v", err)
+		}
+		if n, err := c.PruneLogs(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+			t.Fatalf("PruneLogs = %d, %v", n, err)
+		}
+
+		// The snapshot loads into a fresh database that has the wallets
+		fresh, err := NewSQLiteClient(ctx, t.TempDir()+"/fresh.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fresh.Close()
+		if _, err := fresh.MigrateUp(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fresh.ImportSnapshot(ctx, snap); err == nil {
+			t.Fatal("import without the wallets should fail")
+		}
+		seedWallet(t, fresh, "a@example.com", "wallet-a")
+		seedWallet(t, fresh, "b@example.com", "wallet-b")
+		n, err := fresh.ImportSnapshot(ctx, snap)
+		if err != nil || n != (SnapshotCounts{Blocks: 1, Transactions: 2, UTXOs: 4}) {
+			t.Fatalf("ImportSnapshot = %+v, %v", n, err)
+		}
+		if n, err := fresh.ImportSnapshot(ctx, snap); err != nil || n != (SnapshotCounts{}) {
+			t.Fatalf("second import = %+v, %v", n, err)
+		}
+		if r, err := fresh.VerifyChain(ctx); err != nil || len(r.Issues) != 0 {
+			t.Fatalf("imported chain: %+v, %v", r, err)
+		}
+		if bal, err := fresh.GetBalance(ctx, "wallet-a"); err != nil || bal != 100 {
+			t.Errorf("imported balance of wallet-a = %d, %v", bal, err)
+		}
+		if stats, _ := fresh.GetChainStats(ctx); stats.TotalSupply != 100 || stats.BlockCount != 1 {
+			t.Errorf("imported chain stats = %+v", stats)
+		}
+
+		// A snapshot whose blocks do not verify is refused
+		forged := *snap
+		forged.Blocks = append([]StoredBlock(nil), snap.Blocks...)
+		forged.Blocks[0].Entries = append([]string{"tx-forged"}, forged.Blocks[0].Entries...)
+		if _, err := fresh.ImportSnapshot(ctx, &forged); err == nil || !strings.Contains(err.Error(), "does not verify") {
+			t.Fatalf("import of a forged chain: %v", err)
+		}
+
+		// A node that saw tx-1 but not its block, nor tx-2, catches up
+		older, err := NewSQLiteClient(ctx, t.TempDir()+"/older.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer older.Close()
+		if _, err := older.MigrateUp(ctx); err != nil {
+			t.Fatal(err)
+		}
+		seedWallet(t, older, "a@example.com", "wallet-a")
+		seedWallet(t, older, "b@example.com", "wallet-b")
+		_ = older.InsertUTXO(ctx, "deposit", "wallet-a", 100)
+		_ = older.SpendUTXO(ctx, "deposit", "tx-1")
+		_ = older.InsertUTXO(ctx, "tx-1_recv", "wallet-b", 30)
+		if err := older.InsertTransaction(ctx, rec); err != nil {
+			t.Fatalf("InsertTransaction: %v", err)
+		}
+		n, err = older.ImportSnapshot(ctx, snap)
+		if err != nil || n != (SnapshotCounts{Blocks: 1, Transactions: 1, UTXOs: 2, Updated: 2}) {
+			t.Fatalf("import over older data = %+v, %v", n, err)
+		}
+		if u, err := older.GetUTXOByID(ctx, "tx-1_recv"); err != nil || !u.Spent || u.SpentInTxID != "tx-2" {
+			t.Errorf("output spent in the snapshot = %+v, %v", u, err)
+		}
+		if got, _ := older.GetTransactionByID(ctx, "tx-1"); got.BlockHash != snap.Blocks[0].Hash {
+			t.Errorf("mined transaction names block %q", got.BlockHash)
+		}
+		if r, err := older.VerifyChain(ctx); err != nil || len(r.Issues) != 0 {
+			t.Fatalf("chain after import over older data: %+v, %v", r, err)
+		}
+		for wallet, want := range map[string]int64{"wallet-a": 100, "wallet-b": 0} {
+			if bal, err := older.GetBalance(ctx, wallet); err != nil || bal != want {
+				t.Errorf("balance of %s after import over older data = %d, %v; want %d", wallet, bal, err, want)
+			}
+		}
+	})
+}
+
+func TestStoreRecovery(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		seedWallet(t, c, "rec@example.com", "wallet-r")
+		now := time.Now().UTC()
+
+		if _, err := c.GetRecoverySetup(ctx, "wallet-r"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("GetRecoverySetup before any setup: %v", err)
+		}
+		first := recovery.Setup{SetID: "aaaa1111", WalletID: "wallet-r", Threshold: 2, Shares: 3, CreatedAt: now,
+			Guardians: []recovery.Guardian{{Index: 1, Name: "Ayesha", Email: "ayesha@example.com"}, {Index: 2, Name: "Bilal"}}}
+		if err := c.InsertRecoverySetup(ctx, first); err != nil {
+			t.Fatalf("InsertRecoverySetup: %v", err)
+		}
+		got, err := c.GetRecoverySetup(ctx, "wallet-r")
+		if err != nil || got.SetID != "aaaa1111" || got.Threshold != 2 || len(got.Guardians) != 2 || got.Guardians[0].Email != "ayesha@example.com" {
+			t.Fatalf("GetRecoverySetup = %+v, %v", got, err)
+		}
+
+		secret, hash, _ := recovery.NewSecret()
+		id, err := c.InsertRecoveryRequest(ctx, recovery.Request{WalletID: "wallet-r", SetID: "aaaa1111",
+			ExpiresAt: now.Add(time.Hour), SecretHash: hash}, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("InsertRecoveryRequest: %v", err)
+		}
+		for _, i := range []int{3, 1} {
+			if err := c.AddRecoveryShare(ctx, id, i, []byte(fmt.Sprintf("share-%d", i))); err != nil {
+				t.Fatalf("AddRecoveryShare(%d): %v", i, err)
+			}
+		}
+		if err := c.AddRecoveryShare(ctx, id, 3, []byte("again")); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("repeated share: %v", err)
+		}
+		req, err := c.GetRecoveryRequest(ctx, id)
+		if err != nil || req.Status != recovery.StatusOpen || req.Threshold != 2 || !reflect.DeepEqual(req.Collected, []int{1, 3}) {
+			t.Fatalf("GetRecoveryRequest = %+v, %v", req, err)
+		}
+		if !req.CheckSecret(secret) {
+			t.Fatal("stored request does not match its secret")
+		}
+		if shares, err := c.GetRecoveryShares(ctx, id); err != nil || len(shares) != 2 || string(shares[0]) != "share-1" {
+			t.Fatalf("GetRecoveryShares = %q, %v", shares, err)
+		}
+
+		if err := c.CloseRecoveryRequest(ctx, id, recovery.StatusCompleted, now); err != nil {
+			t.Fatalf("CloseRecoveryRequest: %v", err)
+		}
+		if err := c.CloseRecoveryRequest(ctx, id, recovery.StatusFailed, now); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("closing a closed request: %v", err)
+		}
+		if shares, _ := c.GetRecoveryShares(ctx, id); len(shares) != 0 {
+			t.Fatalf("shares kept after close: %d", len(shares))
+		}
+		if err := c.AddRecoveryShare(ctx, id, 2, []byte("late")); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("share on a closed request: %v", err)
+		}
+
+		// A new setup revokes the old one and fails its open requests
+		open, _ := c.InsertRecoveryRequest(ctx, recovery.Request{WalletID: "wallet-r", SetID: "aaaa1111",
+			ExpiresAt: now.Add(time.Hour)}, "")
+		_ = c.AddRecoveryShare(ctx, open, 1, []byte("share-1"))
+		second := recovery.Setup{SetID: "bbbb2222bbbb2222bbbb2222bbbb2222", WalletID: "wallet-r", Threshold: 3, Shares: 5, CreatedAt: now.Add(time.Second)}
+		if err := c.InsertRecoverySetup(ctx, second); err != nil {
+			t.Fatalf("second InsertRecoverySetup: %v", err)
+		}
+		if got, _ := c.GetRecoverySetup(ctx, "wallet-r"); got.SetID != "bbbb2222bbbb2222bbbb2222bbbb2222" || len(got.Guardians) != 0 {
+			t.Fatalf("active setup = %+v", got)
+		}
+		if req, _ := c.GetRecoveryRequest(ctx, open); req.Status != recovery.StatusFailed || len(req.Collected) != 0 {
+			t.Fatalf("request on the revoked setup = %+v", req)
+		}
+
+		// Lapsed requests expire and lose their shares
+		lapsed, _ := c.InsertRecoveryRequest(ctx, recovery.Request{WalletID: "wallet-r", SetID: "bbbb2222bbbb2222bbbb2222bbbb2222",
+			ExpiresAt: now.Add(-time.Minute)}, "")
+		_ = c.AddRecoveryShare(ctx, lapsed, 4, []byte("share-4"))
+		if n, err := c.ExpireRecoveryRequests(ctx, now); err != nil || n != 1 {
+			t.Fatalf("ExpireRecoveryRequests = %d, %v", n, err)
+		}
+		if req, _ := c.GetRecoveryRequest(ctx, lapsed); req.Status != recovery.StatusExpired || len(req.Collected) != 0 {
+			t.Fatalf("lapsed request = %+v", req)
+		}
+	})
+}
+
+func TestStoreDirectory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+		userID := seedWallet(t, c, "Shop@Example.com", "wallet-shop")
+		seedWallet(t, c, "other@example.com", "wallet-other")
+
+		e, err := c.GetDirectoryEntry(ctx, "wallet-shop")
+		if err != nil || e.Name != "Test wallet-shop" || e.Alias != "" || e.Multisig {
+			t.Fatalf("GetDirectoryEntry = %+v, %v", e, err)
+		}
+		if e, err := c.GetDirectoryEntryByEmail(ctx, "shop@example.com"); err != nil || e.WalletID != "wallet-shop" {
+			t.Fatalf("GetDirectoryEntryByEmail = %+v, %v", e, err)
+		}
+		if _, err := c.GetDirectoryEntry(ctx, "wallet-none"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("unknown wallet: %v", err)
+		}
+
+		if err := c.SetWalletAlias(ctx, "wallet-shop", "shop"); err != nil {
+			t.Fatalf("SetWalletAlias: %v", err)
+		}
+		if err := c.SetWalletAlias(ctx, "wallet-other", "shop"); !errors.Is(err, directory.ErrAliasTaken) {
+			t.Fatalf("taken alias: %v", err)
+		}
+		if e, err := c.GetDirectoryEntryByAlias(ctx, "shop"); err != nil || e.WalletID != "wallet-shop" || e.Alias != "shop" {
+			t.Fatalf("GetDirectoryEntryByAlias = %+v, %v", e, err)
+		}
+		// A new alias replaces the old one, which is then free
+		if err := c.SetWalletAlias(ctx, "wallet-shop", "corner.shop"); err != nil {
+			t.Fatalf("SetWalletAlias again: %v", err)
+		}
+		if _, err := c.GetDirectoryEntryByAlias(ctx, "shop"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("old alias still resolves: %v", err)
+		}
+		if err := c.SetWalletAlias(ctx, "wallet-other", "shop"); err != nil {
+			t.Fatalf("freed alias: %v", err)
+		}
+		if err := c.DeleteWalletAlias(ctx, "wallet-other"); err != nil {
+			t.Fatalf("DeleteWalletAlias: %v", err)
+		}
+		if e, _ := c.GetDirectoryEntry(ctx, "wallet-other"); e.Alias != "" {
+			t.Fatalf("alias after delete = %q", e.Alias)
+		}
+
+		// External wallets can own outputs but are not listed, until the
+		// key is imported and claims them
+		if err := registerExternalWallet(ctx, c.db, "wallet-ext"); err != nil {
+			t.Fatalf("registerExternalWallet: %v", err)
+		}
+		if err := registerExternalWallet(ctx, c.db, "wallet-ext"); err != nil {
+			t.Fatalf("registerExternalWallet again: %v", err)
+		}
+		if err := c.InsertUTXO(ctx, "ext-1", "wallet-ext", 40); err != nil {
+			t.Fatalf("InsertUTXO to external wallet: %v", err)
+		}
+		if w, err := c.GetWalletByID(ctx, "wallet-ext"); err != nil || !w.External() {
+			t.Fatalf("external wallet = %+v, %v", w, err)
+		}
+		if _, err := c.GetDirectoryEntry(ctx, "wallet-ext"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("external wallet listed: %v", err)
+		}
+		if err := registerExternalWallet(ctx, c.db, "wallet-shop"); err != nil {
+			t.Fatalf("registerExternalWallet on a user wallet: %v", err)
+		}
+		if w, _ := c.GetWalletByID(ctx, "wallet-shop"); w.External() || w.UserID != userID {
+			t.Fatalf("user wallet changed to %+v", w)
+		}
+
+		newUser, err := c.InsertUser(ctx, "late@example.com", "Late Comer", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.InsertWallet(ctx, newUser, "wallet-ext", []byte("pub-ext"), []byte("enc-ext")); err != nil {
+			t.Fatalf("InsertWallet claiming an external wallet: %v", err)
+		}
+		w, err := c.GetWalletByID(ctx, "wallet-ext")
+		if err != nil || w.External() || w.UserID != newUser || string(w.PublicKey) != "pub-ext" {
+			t.Fatalf("claimed wallet = %+v, %v", w, err)
+		}
+		if utxos, _ := c.GetUnspentUTXOs(ctx, "wallet-ext"); len(utxos) != 1 {
+			t.Fatalf("claimed wallet has %d outputs, want 1", len(utxos))
+		}
+		if err := c.InsertWallet(ctx, userID, "wallet-ext", []byte("pub-x"), []byte("enc-x")); err == nil {
+			t.Fatal("InsertWallet took over a claimed wallet")
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"blockchain-wallet/pkg/webhook"
+)
+
+const webhookEndpointColumns = "id, user_id, wallet_id, url, secret, events, active, created_at"
+
+func scanWebhookEndpoint(row rowScanner) (webhook.Endpoint, error) {
+	var e webhook.Endpoint
+	var events string
+	err := row.Scan(&e.ID, &e.UserID, &e.WalletID, &e.URL, &e.Secret, &events, &e.Active, &e.CreatedAt)
+	e.Events = strings.Split(events, ",")
+	return e, err
+}
+
+func (c *Client) queryWebhookEndpoints(ctx context.Context, query string, args ...interface{}) ([]webhook.Endpoint, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []webhook.Endpoint
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// InsertWebhookEndpoint registers an endpoint and returns its ID
+func (c *Client) InsertWebhookEndpoint(ctx context.Context, e webhook.Endpoint) (string, error) {
+	var id string
+	err := c.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_endpoints (user_id, wallet_id, url, secret, events, active)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		e.UserID, e.WalletID, e.URL, e.Secret, strings.Join(e.Events, ","), e.Active,
+	).Scan(&id)
+	return id, err
+}
+
+// GetWebhookEndpoints returns a user's endpoints, newest first, without
+// their secrets
+func (c *Client) GetWebhookEndpoints(ctx context.Context, userID string) ([]webhook.Endpoint, error) {
+	list, err := c.queryWebhookEndpoints(ctx,
+		"SELECT "+webhookEndpointColumns+" FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at DESC",
+		userID,
+	)
+	for i := range list {
+		list[i].Secret = ""
+	}
+	return list, err
+}
+
+// GetActiveWebhookEndpoints returns the active endpoints of a wallet
+func (c *Client) GetActiveWebhookEndpoints(ctx context.Context, walletID string) ([]webhook.Endpoint, error) {
+	return c.queryWebhookEndpoints(ctx,
+		"SELECT "+webhookEndpointColumns+" FROM webhook_endpoints WHERE wallet_id = $1 AND active = TRUE",
+		walletID,
+	)
+}
+
+// DeleteWebhookEndpoint removes a user's endpoint together with its
+// deliveries and their log
+func (c *Client) DeleteWebhookEndpoint(ctx context.Context, id, userID string) error {
+	res, err := c.db.ExecContext(ctx,
+		"DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2",
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// InsertWebhookDeliveries queues deliveries in the outbox. An event already
+// queued for an endpoint is skipped.
+func (c *Client) InsertWebhookDeliveries(ctx context.Context, ds []webhook.Delivery) error {
+	return c.inTx(ctx, func(q querier) error {
+		for _, d := range ds {
+			if _, err := q.ExecContext(ctx,
+				`INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt_at)
+				 VALUES ($1, $2, $3, $4, $5, $6)
+				 ON CONFLICT (endpoint_id, event_id) DO NOTHING`,
+				d.EndpointID, d.EventID, d.EventType, string(d.Payload), d.Status, d.NextAttemptAt,
+			); err != nil {
+				return fmt.Errorf("insert webhook delivery: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+const webhookDeliveryColumns = `d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_attempt_at, COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''),
+	d.created_at, d.delivered_at`
+
+func scanWebhookDelivery(row rowScanner, extra ...interface{}) (webhook.Delivery, error) {
+	var d webhook.Delivery
+	var payload string
+	dest := append([]interface{}{&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}, extra...)
+	err := row.Scan(dest...)
+	d.Payload = []byte(payload)
+	return d, err
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries of active
+// endpoints until leaseUntil. Claims are serialised so two senders never
+// get the same delivery.
+func (c *Client) ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]webhook.Due, error) {
+	var due []webhook.Due
+	err := c.inTx(ctx, func(q querier) error {
+		if c.dialect == postgresDialect {
+			if _, err := q.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('webhook_deliveries'))"); err != nil {
+				return err
+			}
+		}
+
+		rows, err := q.QueryContext(ctx,
+			"SELECT "+webhookDeliveryColumns+", e.url, e.secret"+
+				` FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id
+				 WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND e.active = TRUE
+				 ORDER BY d.next_attempt_at, d.created_at LIMIT $2`,
+			now, limit,
+		)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var job webhook.Due
+			job.Delivery, err = scanWebhookDelivery(rows, &job.Endpoint.URL, &job.Endpoint.Secret)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			job.Endpoint.ID = job.Delivery.EndpointID
+			due = append(due, job)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range due {
+			if _, err := q.ExecContext(ctx,
+				"UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = $2",
+				leaseUntil, due[i].Delivery.ID,
+			); err != nil {
+				return err
+			}
+			due[i].Delivery.NextAttemptAt = leaseUntil
+		}
+		return nil
+	})
+	return due, err
+}
+
+// RecordWebhookAttempt saves the state of a delivery after an attempt and
+// appends the attempt to the delivery log
+func (c *Client) RecordWebhookAttempt(ctx context.Context, d webhook.Delivery, a webhook.Attempt) error {
+	return c.inTx(ctx, func(q querier) error {
+		if _, err := q.ExecContext(ctx,
+			`UPDATE webhook_deliveries
+			 SET status = $1, attempts = $2, next_attempt_at = $3, last_attempt_at = $4,
+			     last_status_code = $5, last_error = $6, delivered_at = $7
+			 WHERE id = $8`,
+			d.Status, d.Attempts, d.NextAttemptAt, d.LastAttemptAt,
+			nullInt(d.LastStatusCode), d.LastError, d.DeliveredAt, d.ID,
+		); err != nil {
+			return fmt.Errorf("update webhook delivery: %w", err)
+		}
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO webhook_attempts (delivery_id, attempt, attempted_at, status_code, error, duration_ms)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			a.DeliveryID, a.Attempt, a.AttemptedAt, nullInt(a.StatusCode), a.Error, a.DurationMs,
+		)
+		return err
+	})
+}
+
+// nullInt stores zero as NULL
+func nullInt(v int) *int {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// GetWebhookDeliveries returns up to limit deliveries to a user's endpoints,
+// newest first. endpointID and status narrow the list when set; status
+// "dead" lists the dead-letter queue.
+func (c *Client) GetWebhookDeliveries(ctx context.Context, userID, endpointID, status string, limit int) ([]webhook.Delivery, error) {
+	w := &whereBuilder{}
+	w.add("e.user_id = ?", userID)
+	if endpointID != "" {
+		w.add("d.endpoint_id = ?", endpointID)
+	}
+	if status != "" {
+		w.add("d.status = ?", status)
+	}
+	w.args = append(w.args, limit)
+
+	rows, err := c.db.QueryContext(ctx,
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries d JOIN webhook_endpoints e ON e.id = d.endpoint_id"+
+			w.String()+fmt.Sprintf(" ORDER BY d.created_at DESC, d.id DESC LIMIT $%d", len(w.args)),
+		w.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []webhook.Delivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// GetWebhookAttempts returns the delivery log of one of a user's
+// deliveries, oldest first
+func (c *Client) GetWebhookAttempts(ctx context.Context, deliveryID, userID string) ([]webhook.Attempt, error) {
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT a.delivery_id, a.attempt, a.attempted_at, COALESCE(a.status_code, 0), COALESCE(a.error, ''), a.duration_ms
+		 FROM webhook_attempts a
+		 JOIN webhook_deliveries d ON d.id = a.delivery_id
+		 JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		 WHERE a.delivery_id = $1 AND e.user_id = $2
+		 ORDER BY a.attempted_at, a.id`,
+		deliveryID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []webhook.Attempt
+	for rows.Next() {
+		var a webhook.Attempt
+		if err := rows.Scan(&a.DeliveryID, &a.Attempt, &a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMs); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// ReplayWebhookDelivery queues one of a user's deliveries to be sent again
+// at now with a fresh set of attempts, whether it was delivered or
+// dead-lettered. Its delivery log is kept.
+func (c *Client) ReplayWebhookDelivery(ctx context.Context, deliveryID, userID string, now time.Time) error {
+	res, err := c.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $1, delivered_at = NULL
+		 WHERE id = $2 AND endpoint_id IN (SELECT id FROM webhook_endpoints WHERE user_id = $3)`,
+		now, deliveryID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
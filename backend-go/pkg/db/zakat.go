@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrZakatDeducted is returned for a second Zakat charge of a wallet in the
+// same asset and period
+var ErrZakatDeducted = errors.New("zakat already deducted for this period")
+
+// ZakatDeducted reports whether a wallet was charged Zakat in an asset
+// (empty for the native coin) for the period (YYYY-MM)
+func (c *Client) ZakatDeducted(ctx context.Context, walletID, assetID, period string) (bool, error) {
+	var one int
+	err := c.db.QueryRowContext(ctx,
+		`SELECT 1 FROM zakat_deductions WHERE wallet_id = $1 AND asset_id = $2 AND period = $3`,
+		walletID, assetID, period,
+	).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// recordZakatDeduction claims the transfer's period for its sender and asset
+// and, for the native coin, stamps the wallet's zakat_last_deducted
+func recordZakatDeduction(ctx context.Context, q querier, t Transfer) error {
+	res, err := q.ExecContext(ctx,
+		`INSERT INTO zakat_deductions (wallet_id, asset_id, period, tx_id)
+		 VALUES ($1, $2, $3, $4) ON CONFLICT (wallet_id, asset_id, period) DO NOTHING`,
+		t.Record.SenderWalletID, t.Record.Asset, t.ZakatPeriod, t.Record.TxID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrZakatDeducted
+	}
+	if t.Record.Asset != "" {
+		return nil
+	}
+	_, err = q.ExecContext(ctx,
+		"UPDATE wallets SET zakat_last_deducted = $1 WHERE wallet_id = $2",
+		time.Unix(t.Now, 0).UTC(), t.Record.SenderWalletID,
+	)
+	return err
+}
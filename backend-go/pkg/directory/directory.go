@@ -0,0 +1,104 @@
+// Package directory resolves payment recipients. A recipient is named by
+// wallet address, by the email its owner registered with, or by an alias
+// such as @shop that the owner chose. A lookup answers whether the wallet
+// exists and gives a masked name, so the sender can confirm the recipient
+// without the directory giving names away.
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ways a query names a recipient
+const (
+	KindAddress = "address" // an address or legacy wallet ID
+	KindEmail   = "email"
+	KindAlias   = "alias" // starts with "@"
+)
+
+// Alias length bounds, without the "@"
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 20
+)
+
+// ErrAliasTaken is returned when another wallet holds an alias
+var ErrAliasTaken = errors.New("alias is taken")
+
+// reserved aliases could be mistaken for the operator
+var reserved = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "support": true,
+	"system": true, "wallet": true, "zakat": true, "treasury": true,
+}
+
+// Entry is a wallet found in the directory. Name is the owner's full name,
+// or a multisig wallet's label, and must be masked before it is shown.
+type Entry struct {
+	WalletID string
+	Alias    string
+	Name     string
+	Multisig bool
+}
+
+// Classify says how q names a recipient
+func Classify(q string) string {
+	q = strings.TrimSpace(q)
+	switch {
+	case strings.HasPrefix(q, "@"):
+		return KindAlias
+	case strings.Contains(q, "@"):
+		return KindEmail
+	default:
+		return KindAddress
+	}
+}
+
+// NormalizeAlias checks an alias and returns it lower-cased without the
+// leading "@". An alias is 3 to 20 letters, digits, "_" or ".", starting
+// with a letter.
+func NormalizeAlias(s string) (string, error) {
+	a := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@"))
+	if len(a) < MinAliasLength || len(a) > MaxAliasLength {
+		return "", fmt.Errorf("alias must be %d to %d characters", MinAliasLength, MaxAliasLength)
+	}
+	if a[0] < 'a' || a[0] > 'z' {
+		return "", errors.New("alias must start with a letter")
+	}
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '.' {
+			return "", fmt.Errorf("alias may not contain %q", c)
+		}
+	}
+	if reserved[a] {
+		return "", fmt.Errorf("alias @%s is reserved", a)
+	}
+	return a, nil
+}
+
+// NormalizeEmail checks an email address and returns it lower-cased
+func NormalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s {
+		return "", fmt.Errorf("invalid email address %q", s)
+	}
+	return strings.ToLower(s), nil
+}
+
+// MaskName keeps the first letter of each word of a name and hides the
+// rest: "Ali Khan" becomes "A** K***"
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, w := range words {
+		first, size := utf8.DecodeRuneInString(w)
+		n := utf8.RuneCountInString(w[size:])
+		words[i] = string(unicode.ToUpper(first)) + strings.Repeat("*", n)
+	}
+	return strings.Join(words, " ")
+}
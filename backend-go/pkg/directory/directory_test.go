@@ -0,0 +1,62 @@
+package directory
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	cases := map[string]string{
+		"@shop":            KindAlias,
+		"  @shop ":         KindAlias,
+		"ali@example.com":  KindEmail,
+		"cw1qgqzgrl68jkn2": KindAddress,
+		"e884ae70b7553e2b": KindAddress,
+	}
+	for q, want := range cases {
+		if got := Classify(q); got != want {
+			t.Errorf("Classify(%q) = %s, want %s", q, got, want)
+		}
+	}
+}
+
+func TestNormalizeAlias(t *testing.T) {
+	for in, want := range map[string]string{
+		"@Shop":      "shop",
+		"shop":       "shop",
+		" @ali.khan": "ali.khan",
+		"@a_1":       "a_1",
+	} {
+		got, err := NormalizeAlias(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeAlias(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"@ab", "@1shop", "@shop!", "@sh op", "@" + string(make([]byte, 21)), "@admin", "@Zakat"} {
+		if got, err := NormalizeAlias(in); err == nil {
+			t.Errorf("NormalizeAlias(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if got, err := NormalizeEmail(" Ali@Example.com "); err != nil || got != "ali@example.com" {
+		t.Fatalf("NormalizeEmail = %q, %v", got, err)
+	}
+	for _, in := range []string{"ali", "Ali <ali@example.com>", "@shop"} {
+		if _, err := NormalizeEmail(in); err == nil {
+			t.Errorf("NormalizeEmail(%q) accepted", in)
+		}
+	}
+}
+
+func TestMaskName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Ali Khan":        "A** K***",
+		"  ayesha   bibi": "A***** B***",
+		"M":               "M",
+		"Zoë":             "Z**",
+		"":                "",
+	} {
+		if got := MaskName(in); got != want {
+			t.Errorf("MaskName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
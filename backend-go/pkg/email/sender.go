@@ -2,25 +2,13 @@ package email
 
 import (
 	"fmt"
+	"html"
 	"net/smtp"
 	"os"
 )
 
 // SendOTP sends the 6-digit code to the user via Gmail
 func SendOTP(toEmail, code string) error {
-	// 1. Get Credentials from .env (Same as debug script)
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	if from == "" || password == "" {
-		return fmt.Errorf("SMTP credentials not set in .env")
-	}
-
-	// 2. Format the Email Message
-	subject := "Subject: Your CryptoWallet Verification Code\n"
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
 	body := fmt.Sprintf(`
 		<html>
 			<body style="font-family: Arial, sans-serif; color: #333;">
@@ -32,14 +20,41 @@ func SendOTP(toEmail, code string) error {
 				</div>
 			</body>
 		</html>`, code)
+	return send(toEmail, "Your CryptoWallet Verification Code", body)
+}
+
+// SendNotification sends a short informational message to the user
+func SendNotification(toEmail, subject, message string) error {
+	body := fmt.Sprintf(`
+		<html>
+			<body style="font-family: Arial, sans-serif; color: #333;">
+				<div style="max-width: 400px; padding: 20px; border: 1px solid #ddd; border-radius: 8px;">
+					<h2 style="color: #2563EB;">%s</h2>
+					<p>%s</p>
+				</div>
+			</body>
+		</html>`, html.EscapeString(subject), html.EscapeString(message))
+	return send(toEmail, subject, body)
+}
+
+// send delivers an HTML email through Gmail SMTP
+func send(toEmail, subject, htmlBody string) error {
+	// 1. Get Credentials from .env (Same as debug script)
+	from := os.Getenv("SMTP_EMAIL")
+	password := os.Getenv("SMTP_PASSWORD")
+	smtpHost := "smtp.gmail.com"
+	smtpPort := "587"
+
+	if from == "" || password == "" {
+		return fmt.Errorf("SMTP credentials not set in .env")
+	}
 
-	msg := []byte(subject + mime + body)
+	// 2. Format the Email Message
+	header := "Subject: " + subject + "\n"
+	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	msg := []byte(header + mime + htmlBody)
 
 	// 3. Authenticate & Send
 	auth := smtp.PlainAuth("", from, password, smtpHost)
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{toEmail}, msg)
-	if err != nil {
-		return err
-	}
-	return nil
-}
\ No newline at end of file
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{toEmail}, msg)
+}
@@ -0,0 +1,239 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topics published by the server
+const (
+	TxAccepted     = "tx.accepted"
+	TxConfirmed    = "tx.confirmed"
+	BlockMined     = "block.mined"
+	ZakatRun       = "zakat.run"
+	BalanceChanged = "balance.changed"
+	Security       = "security"
+)
+
+// Topics returns every topic in a stable order
+func Topics() []string {
+	return []string{TxAccepted, TxConfirmed, BlockMined, ZakatRun, BalanceChanged, Security}
+}
+
+// ValidTopic reports whether t is a known topic
+func ValidTopic(t string) bool {
+	return slices.Contains(Topics(), t)
+}
+
+// Event is a published notification. Events scoped to wallets are only
+// delivered to subscribers of one of those wallets; events without wallets
+// are public.
+type Event struct {
+	ID      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Wallets []string        `json:"wallets,omitempty"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	seq uint64
+}
+
+// Filter selects the events a subscriber receives. No topics means every
+// topic; public events are delivered regardless of Wallets.
+type Filter struct {
+	Topics  []string
+	Wallets []string
+}
+
+// Match reports whether ev passes the filter
+func (f Filter) Match(ev Event) bool {
+	if len(f.Topics) > 0 && !slices.Contains(f.Topics, ev.Topic) {
+		return false
+	}
+	if len(ev.Wallets) == 0 {
+		return true
+	}
+	for _, w := range ev.Wallets {
+		if slices.Contains(f.Wallets, w) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// DefaultHistory is how many recent events a bus keeps for resuming
+	DefaultHistory = 1024
+	// subscriberBuffer is how far a subscriber may fall behind before it
+	// is dropped and has to resume from its last event ID
+	subscriberBuffer = 64
+)
+
+// Bus fans events out to subscribers and keeps a window of recent events
+// so a reconnecting client can resume after its last event ID. IDs are
+// "<epoch>-<seq>"; the epoch changes each time the process starts, so an
+// ID from a previous run is recognised as unresumable.
+type Bus struct {
+	mu      sync.Mutex
+	epoch   string
+	seq     uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+	now     func() time.Time
+}
+
+// NewBus returns a bus remembering the last history events
+func NewBus(history int) *Bus {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	var b [4]byte
+	rand.Read(b[:])
+	return &Bus{
+		epoch: hex.EncodeToString(b[:]),
+		size:  history,
+		subs:  make(map[*Subscription]struct{}),
+		now:   time.Now,
+	}
+}
+
+// Publish sends an event to every matching subscriber and returns it. data
+// is encoded as JSON.
+func (b *Bus) Publish(topic string, wallets []string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("encode %s event: %w", topic, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	ev := Event{
+		ID:      b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+		Topic:   topic,
+		Wallets: wallets,
+		Time:    b.now().UTC(),
+		Data:    raw,
+		seq:     b.seq,
+	}
+	if len(b.history) == b.size {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	b.history = append(b.history, ev)
+
+	for s := range b.subs {
+		if !s.filter.Match(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// Too slow: cut it loose rather than block publishers
+			s.dropped = true
+			b.remove(s)
+		}
+	}
+	return ev, nil
+}
+
+// Subscription receives the events matching its filter on C. C is closed
+// when the subscription ends, either by Close or because the subscriber
+// fell too far behind.
+type Subscription struct {
+	C <-chan Event
+	// Replay holds the missed events after the requested last event ID
+	Replay []Event
+	// Reset is set when the last event ID could not be resumed from, so the
+	// client must reload its state instead of relying on replay
+	Reset bool
+
+	bus     *Bus
+	ch      chan Event
+	filter  Filter
+	dropped bool
+}
+
+// Subscribe registers a subscriber. When lastEventID is set, the events
+// published after it that match f are returned in Replay.
+func (b *Bus) Subscribe(f Filter, lastEventID string) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{C: ch, bus: b, ch: ch, filter: f}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lastEventID != "" {
+		s.Replay, s.Reset = b.since(lastEventID, f)
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// since returns the matching history after id, or reset when id is not
+// from this epoch or has already left the window. Callers hold b.mu.
+func (b *Bus) since(id string, f Filter) (replay []Event, reset bool) {
+	epoch, n, ok := strings.Cut(id, "-")
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if !ok || err != nil || epoch != b.epoch || seq > b.seq {
+		return nil, true
+	}
+	if len(b.history) > 0 && seq+1 < b.history[0].seq {
+		return nil, true
+	}
+	for _, ev := range b.history {
+		if ev.seq > seq && f.Match(ev) {
+			replay = append(replay, ev)
+		}
+	}
+	return replay, false
+}
+
+// SetFilter changes which events the subscription receives from now on
+func (s *Subscription) SetFilter(f Filter) {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.filter = f
+}
+
+// Filter returns the subscription's current filter
+func (s *Subscription) Filter() Filter {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.filter
+}
+
+// Dropped reports whether the subscription was ended for falling behind
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove unregisters s and closes its channel. Callers hold b.mu.
+func (b *Bus) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
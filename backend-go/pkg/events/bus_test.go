@@ -0,0 +1,179 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func publish(t *testing.T, b *Bus, topic string, wallets ...string) Event {
+	t.Helper()
+	ev, err := b.Publish(topic, wallets, map[string]string{"topic": topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func ids(evs []Event) []string {
+	out := make([]string, len(evs))
+	for i, ev := range evs {
+		out[i] = ev.ID
+	}
+	return out
+}
+
+func TestFilterMatch(t *testing.T) {
+	f := Filter{Topics: []string{TxAccepted, BlockMined}, Wallets: []string{"alice"}}
+	cases := []struct {
+		ev   Event
+		want bool
+	}{
+		{Event{Topic: TxAccepted, Wallets: []string{"alice", "bob"}}, true},
+		{Event{Topic: TxAccepted, Wallets: []string{"bob"}}, false},
+		{Event{Topic: BlockMined}, true},
+		{Event{Topic: Security, Wallets: []string{"alice"}}, false},
+	}
+	for _, c := range cases {
+		if got := f.Match(c.ev); got != c.want {
+			t.Errorf("Match(%s %v) = %v, want %v", c.ev.Topic, c.ev.Wallets, got, c.want)
+		}
+	}
+	if !(Filter{Wallets: []string{"alice"}}).Match(Event{Topic: Security, Wallets: []string{"alice"}}) {
+		t.Error("empty topic list should match every topic")
+	}
+}
+
+func TestPublishDeliversToMatchingSubscribers(t *testing.T) {
+	b := NewBus(0)
+	alice := b.Subscribe(Filter{Wallets: []string{"alice"}}, "")
+	bob := b.Subscribe(Filter{Topics: []string{BlockMined}, Wallets: []string{"bob"}}, "")
+	defer alice.Close()
+	defer bob.Close()
+
+	sent := publish(t, b, TxAccepted, "alice", "carol")
+	mined := publish(t, b, BlockMined)
+
+	if ev := <-alice.C; ev.ID != sent.ID {
+		t.Fatalf("alice got %s, want %s", ev.ID, sent.ID)
+	}
+	if ev := <-alice.C; ev.ID != mined.ID {
+		t.Fatalf("alice got %s, want %s", ev.ID, mined.ID)
+	}
+	if ev := <-bob.C; ev.ID != mined.ID {
+		t.Fatalf("bob got %s, want %s", ev.ID, mined.ID)
+	}
+	if len(bob.C) != 0 {
+		t.Fatal("bob received another wallet's event")
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(sent.Data, &data); err != nil || data["topic"] != TxAccepted {
+		t.Fatalf("data = %s (%v)", sent.Data, err)
+	}
+}
+
+func TestSubscribeResumesAfterLastEventID(t *testing.T) {
+	b := NewBus(10)
+	first := publish(t, b, TxAccepted, "alice")
+	publish(t, b, TxAccepted, "bob")
+	second := publish(t, b, BalanceChanged, "alice")
+	third := publish(t, b, BlockMined)
+
+	s := b.Subscribe(Filter{Wallets: []string{"alice"}}, first.ID)
+	defer s.Close()
+	if s.Reset {
+		t.Fatal("unexpected reset")
+	}
+	got := ids(s.Replay)
+	if len(got) != 2 || got[0] != second.ID || got[1] != third.ID {
+		t.Fatalf("replay = %v, want [%s %s]", got, second.ID, third.ID)
+	}
+
+	// Nothing is missed or duplicated between replay and live delivery
+	live := publish(t, b, TxConfirmed, "alice")
+	if ev := <-s.C; ev.ID != live.ID {
+		t.Fatalf("live = %s, want %s", ev.ID, live.ID)
+	}
+
+	upToDate := b.Subscribe(Filter{}, live.ID)
+	defer upToDate.Close()
+	if upToDate.Reset || len(upToDate.Replay) != 0 {
+		t.Fatalf("up-to-date subscriber: reset=%v replay=%v", upToDate.Reset, ids(upToDate.Replay))
+	}
+}
+
+func TestSubscribeResetsWhenHistoryIsGone(t *testing.T) {
+	b := NewBus(3)
+	first := publish(t, b, BlockMined)
+	second := publish(t, b, BlockMined)
+	for i := 0; i < 3; i++ {
+		publish(t, b, BlockMined)
+	}
+
+	for name, id := range map[string]string{
+		"evicted":     first.ID,
+		"other epoch": "deadbeef-1",
+		"from future": b.epoch + "-99",
+		"garbage":     "nonsense",
+		"bad seq":     b.epoch + "-x",
+	} {
+		s := b.Subscribe(Filter{}, id)
+		if !s.Reset || len(s.Replay) != 0 {
+			t.Errorf("%s: reset=%v replay=%d", name, s.Reset, len(s.Replay))
+		}
+		s.Close()
+	}
+
+	// The event just before the window can still be resumed from
+	s := b.Subscribe(Filter{}, second.ID)
+	defer s.Close()
+	if s.Reset || len(s.Replay) != 3 {
+		t.Fatalf("reset=%v replay=%d, want 3 events", s.Reset, len(s.Replay))
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBus(0)
+	slow := b.Subscribe(Filter{}, "")
+	for i := 0; i < subscriberBuffer+1; i++ {
+		publish(t, b, BlockMined)
+	}
+	if !slow.Dropped() || b.Subscribers() != 0 {
+		t.Fatalf("dropped=%v subscribers=%d", slow.Dropped(), b.Subscribers())
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("drained %d buffered events, want %d", n, subscriberBuffer)
+	}
+	slow.Close() // closing again is harmless
+}
+
+func TestSetFilter(t *testing.T) {
+	b := NewBus(0)
+	s := b.Subscribe(Filter{Topics: []string{BlockMined}}, "")
+	defer s.Close()
+
+	publish(t, b, ZakatRun)
+	s.SetFilter(Filter{Topics: []string{ZakatRun}})
+	run := publish(t, b, ZakatRun)
+	if ev := <-s.C; ev.ID != run.ID {
+		t.Fatalf("got %s, want %s", ev.ID, run.ID)
+	}
+	if got := s.Filter().Topics; len(got) != 1 || got[0] != ZakatRun {
+		t.Fatalf("filter topics = %v", got)
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	for _, topic := range Topics() {
+		if !ValidTopic(topic) {
+			t.Errorf("%s not valid", topic)
+		}
+	}
+	if ValidTopic("tx.rejected") {
+		t.Error("unknown topic accepted")
+	}
+}
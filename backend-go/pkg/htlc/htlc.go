@@ -0,0 +1,146 @@
+// Package htlc implements hash time-locked contracts: outputs the receiver
+// claims by revealing the secret behind a hash, or the sender takes back
+// once a timeout has passed. Two contracts on the same hash on different
+// chains make an atomic swap, since claiming one reveals the secret that
+// claims the other.
+package htlc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"blockchain-wallet/pkg/script"
+)
+
+// Contract states
+const (
+	StatusOpen     = "open"
+	StatusClaimed  = "claimed"
+	StatusRefunded = "refunded"
+	StatusExpired  = "expired" // open, but past its timeout so it may be refunded
+)
+
+// SecretSize is the size of secrets made by NewSecret
+const SecretSize = 32
+
+// Contract holds the terms of an HTLC output
+type Contract struct {
+	Hash     []byte            // SHA-256 of the secret
+	Claimer  ed25519.PublicKey // may spend with the secret
+	Refunder ed25519.PublicKey // may spend after Timeout
+	Timeout  int64             // unix seconds
+}
+
+// Validate checks that the terms are well formed
+func (c Contract) Validate() error {
+	if len(c.Hash) != sha256.Size {
+		return errors.New("hash must be a 32-byte SHA-256 digest")
+	}
+	if len(c.Claimer) != ed25519.PublicKeySize || len(c.Refunder) != ed25519.PublicKeySize {
+		return errors.New("claimer and refunder keys must be 32 bytes")
+	}
+	if bytes.Equal(c.Claimer, c.Refunder) {
+		return errors.New("claimer and refunder must differ")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be a unix time")
+	}
+	return nil
+}
+
+// Script is the locking script for the contract:
+//
+//	OP_IF OP_SHA256 <hash> OP_EQUALVERIFY <claimer>
+//	OP_ELSE <timeout> OP_CHECKTIMEVERIFY OP_DROP <refunder>
+//	OP_ENDIF OP_CHECKSIG
+func (c Contract) Script() (script.Script, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var b script.Builder
+	b.AddOp(script.OP_IF).AddOp(script.OP_SHA256).AddData(c.Hash).AddOp(script.OP_EQUALVERIFY).AddData(c.Claimer)
+	b.AddOp(script.OP_ELSE).AddInt(c.Timeout).AddOp(script.OP_CHECKTIMEVERIFY).AddOp(script.OP_DROP).AddData(c.Refunder)
+	b.AddOp(script.OP_ENDIF).AddOp(script.OP_CHECKSIG)
+	return b.Script()
+}
+
+// ClaimScript unlocks a contract with the claimer's signature and the
+// secret: <sig> <secret> 1
+func ClaimScript(sig, secret []byte) (script.Script, error) {
+	var b script.Builder
+	b.AddData(sig).AddData(secret).AddInt(1)
+	return b.Script()
+}
+
+// RefundScript unlocks an expired contract with the refunder's signature:
+// <sig> 0
+func RefundScript(sig []byte) (script.Script, error) {
+	var b script.Builder
+	b.AddData(sig).AddInt(0)
+	return b.Script()
+}
+
+// Secret returns the secret revealed by an unlocking script, if it is a
+// claim of this contract
+func (c Contract) Secret(unlock script.Script) ([]byte, bool) {
+	data, err := unlock.PushedData()
+	if err != nil || len(data) != 3 || !bytes.Equal(data[2], []byte{1}) {
+		return nil, false
+	}
+	if h := sha256.Sum256(data[1]); !bytes.Equal(h[:], c.Hash) {
+		return nil, false
+	}
+	return data[1], true
+}
+
+// NewSecret returns a random secret and its hash
+func NewSecret() (secret, hash []byte, err error) {
+	secret = make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, err
+	}
+	h := sha256.Sum256(secret)
+	return secret, h[:], nil
+}
+
+// HTLC is a contract output as recorded by the server. The output stays
+// the sender's until it is claimed by the receiver or refunded.
+type HTLC struct {
+	ID         string            `json:"htlc_id"` // the output's UTXO ID
+	TxID       string            `json:"txid"`
+	SenderID   string            `json:"sender_id"`
+	ReceiverID string            `json:"receiver_id"`
+	Amount     int64             `json:"amount"`
+	Hash       string            `json:"hash"` // hex
+	Claimer    ed25519.PublicKey `json:"claimer_key"`
+	Refunder   ed25519.PublicKey `json:"refunder_key"`
+	Timeout    int64             `json:"timeout"`
+	Status     string            `json:"status"`
+	Secret     string            `json:"secret,omitempty"` // hex, once claimed
+	SettleTxID string            `json:"settle_txid,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	SettledAt  *time.Time        `json:"settled_at,omitempty"`
+}
+
+// Contract returns the terms of the output
+func (h HTLC) Contract() (Contract, error) {
+	hash, err := hex.DecodeString(h.Hash)
+	if err != nil {
+		return Contract{}, errors.New("hash must be hex")
+	}
+	return Contract{Hash: hash, Claimer: h.Claimer, Refunder: h.Refunder, Timeout: h.Timeout}, nil
+}
+
+// State is the status as of unix time now, reporting open contracts past
+// their timeout as expired
+func (h HTLC) State(now int64) string {
+	if h.Status == StatusOpen && now >= h.Timeout {
+		return StatusExpired
+	}
+	return h.Status
+}
@@ -0,0 +1,106 @@
+package htlc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/script"
+)
+
+func TestContractSpend(t *testing.T) {
+	claimPriv, claimPub, _ := crypto.GenerateKeypair()
+	refundPriv, refundPub, _ := crypto.GenerateKeypair()
+	secret, hash, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Contract{Hash: hash, Claimer: claimPub, Refunder: refundPub, Timeout: 1000}
+	lock, err := c.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigHash := sha256.Sum256([]byte("spend"))
+	sign := func(k ed25519.PrivateKey) []byte { return ed25519.Sign(k, sigHash[:]) }
+	claim := func(k ed25519.PrivateKey, s []byte) script.Script {
+		u, err := ClaimScript(sign(k), s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	refund := func(k ed25519.PrivateKey) script.Script {
+		u, err := RefundScript(sign(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	tests := []struct {
+		name   string
+		unlock script.Script
+		now    int64
+		want   error
+	}{
+		{"claim", claim(claimPriv, secret), 0, nil},
+		{"claim after timeout", claim(claimPriv, secret), 5000, nil},
+		{"claim with wrong secret", claim(claimPriv, []byte("guess")), 0, script.ErrVerify},
+		{"claim by refunder", claim(refundPriv, secret), 0, script.ErrEvalFalse},
+		{"refund before timeout", refund(refundPriv), 999, script.ErrLocktimeNotReached},
+		{"refund", refund(refundPriv), 1000, nil},
+		{"refund by claimer", refund(claimPriv), 1000, script.ErrEvalFalse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := script.Verify(tt.unlock, lock, script.Context{SigHash: sigHash[:], Time: tt.now})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if got, ok := c.Secret(claim(claimPriv, secret)); !ok || !bytes.Equal(got, secret) {
+		t.Errorf("Secret of a claim = %x, %v", got, ok)
+	}
+	if _, ok := c.Secret(claim(claimPriv, []byte("guess"))); ok {
+		t.Error("Secret accepted a wrong secret")
+	}
+	if _, ok := c.Secret(refund(refundPriv)); ok {
+		t.Error("Secret of a refund")
+	}
+}
+
+func TestContractValidate(t *testing.T) {
+	_, a, _ := crypto.GenerateKeypair()
+	_, b, _ := crypto.GenerateKeypair()
+	hash := make([]byte, 32)
+	invalid := []Contract{
+		{Hash: hash[:31], Claimer: a, Refunder: b, Timeout: 1},
+		{Hash: hash, Claimer: a[:31], Refunder: b, Timeout: 1},
+		{Hash: hash, Claimer: a, Refunder: a, Timeout: 1},
+		{Hash: hash, Claimer: a, Refunder: b},
+	}
+	for i, c := range invalid {
+		if _, err := c.Script(); err == nil {
+			t.Errorf("contract %d: expected an error", i)
+		}
+	}
+}
+
+func TestHTLCState(t *testing.T) {
+	h := HTLC{Status: StatusOpen, Timeout: 100}
+	if s := h.State(99); s != StatusOpen {
+		t.Errorf("State before timeout = %s", s)
+	}
+	if s := h.State(100); s != StatusExpired {
+		t.Errorf("State at timeout = %s", s)
+	}
+	h.Status = StatusClaimed
+	if s := h.State(100); s != StatusClaimed {
+		t.Errorf("State of a claimed contract = %s", s)
+	}
+}
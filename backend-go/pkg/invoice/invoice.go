@@ -0,0 +1,197 @@
+package invoice
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Invoice statuses
+const (
+	StatusOpen      = "open"
+	StatusPaid      = "paid"
+	StatusUnderpaid = "underpaid" // some but not all of the amount arrived
+	StatusExpired   = "expired"   // nothing arrived before the expiry
+)
+
+// Scheme is the URI scheme of payment requests
+const Scheme = "cryptowallet"
+
+// Limits on invoice fields
+const (
+	MaxMemo   = 140
+	MaxExpiry = 90 * 24 * time.Hour
+)
+
+// Invoice asks for a payment to a user's wallet. Payments are matched to it
+// through the reference carried in the transaction note.
+type Invoice struct {
+	ID         string     `json:"id"`
+	Reference  string     `json:"reference"`
+	UserID     string     `json:"user_id"`
+	WalletID   string     `json:"wallet_id"`
+	Amount     int64      `json:"amount"`
+	Memo       string     `json:"memo,omitempty"`
+	Status     string     `json:"status"`
+	AmountPaid int64      `json:"amount_paid"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	PaidAt     *time.Time `json:"paid_at,omitempty"`
+}
+
+// Payment is a confirmed transaction matched to an invoice
+type Payment struct {
+	InvoiceID  string    `json:"invoice_id"`
+	TxID       string    `json:"tx_id"`
+	Amount     int64     `json:"amount"`
+	BlockIndex int64     `json:"block_index"`
+	BlockHash  string    `json:"block_hash"`
+	PaidAt     time.Time `json:"paid_at"`
+}
+
+// URI returns the invoice's payment request
+func (inv Invoice) URI() string {
+	return Request{WalletID: inv.WalletID, Amount: inv.Amount, Reference: inv.Reference, Memo: inv.Memo}.URI()
+}
+
+// Outstanding returns how much is still to be paid
+func (inv Invoice) Outstanding() int64 {
+	if inv.AmountPaid >= inv.Amount {
+		return 0
+	}
+	return inv.Amount - inv.AmountPaid
+}
+
+// StatusAt returns the invoice's status at now given what has been paid.
+// Anything paid keeps an invoice out of expired, so a late partial payment
+// still shows as underpaid.
+func (inv Invoice) StatusAt(now time.Time) string {
+	switch {
+	case inv.AmountPaid >= inv.Amount:
+		return StatusPaid
+	case inv.AmountPaid > 0:
+		return StatusUnderpaid
+	case !now.Before(inv.ExpiresAt):
+		return StatusExpired
+	default:
+		return StatusOpen
+	}
+}
+
+// Payable reports whether a new payment may still be made against the
+// invoice at now
+func (inv Invoice) Payable(now time.Time) bool {
+	return now.Before(inv.ExpiresAt) && inv.AmountPaid < inv.Amount
+}
+
+// Validate checks a new invoice
+func Validate(inv Invoice) error {
+	if inv.WalletID == "" {
+		return errors.New("wallet_id required")
+	}
+	if inv.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if len(inv.Memo) > MaxMemo {
+		return fmt.Errorf("memo longer than %d characters", MaxMemo)
+	}
+	if !inv.ExpiresAt.After(inv.CreatedAt) {
+		return errors.New("expiry must be in the future")
+	}
+	if inv.ExpiresAt.Sub(inv.CreatedAt) > MaxExpiry {
+		return fmt.Errorf("expiry may be at most %s away", MaxExpiry)
+	}
+	return nil
+}
+
+// References look like INV-7K2QF4ZJ9MXA: ten base32 characters
+const refPrefix = "INV-"
+
+var refPattern = regexp.MustCompile(`\bINV-[A-Z2-7]{10}\b`)
+
+// NewReference returns a random invoice reference
+func NewReference() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return refPrefix + base32.StdEncoding.EncodeToString(b)[:10], nil
+}
+
+// ReferenceIn returns the first invoice reference in a transaction note, or
+// "" when there is none
+func ReferenceIn(note string) string {
+	return refPattern.FindString(strings.ToUpper(note))
+}
+
+// Request is a payment request as carried in a URI
+type Request struct {
+	WalletID  string `json:"wallet_id"`
+	Amount    int64  `json:"amount,omitempty"`
+	Reference string `json:"ref,omitempty"`
+	Memo      string `json:"memo,omitempty"`
+}
+
+// URI encodes the request as cryptowallet:<wallet_id>?amount=..&ref=..&memo=..
+func (r Request) URI() string {
+	q := url.Values{}
+	if r.Amount > 0 {
+		q.Set("amount", strconv.FormatInt(r.Amount, 10))
+	}
+	if r.Reference != "" {
+		q.Set("ref", r.Reference)
+	}
+	if r.Memo != "" {
+		q.Set("memo", r.Memo)
+	}
+	u := Scheme + ":" + r.WalletID
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// Note returns the transaction note a wallet should send to pay the request
+func (r Request) Note() string {
+	if r.Memo == "" {
+		return r.Reference
+	}
+	if r.Reference == "" {
+		return r.Memo
+	}
+	return r.Reference + " " + r.Memo
+}
+
+// ParseURI decodes a payment request URI
+func ParseURI(s string) (Request, error) {
+	rest, ok := strings.CutPrefix(s, Scheme+":")
+	if !ok {
+		return Request{}, fmt.Errorf("not a %s URI", Scheme)
+	}
+	rest = strings.TrimPrefix(rest, "//")
+	wallet, query, _ := strings.Cut(rest, "?")
+	if wallet == "" {
+		return Request{}, errors.New("payment URI has no wallet")
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return Request{}, fmt.Errorf("payment URI query: %w", err)
+	}
+
+	r := Request{WalletID: wallet, Reference: q.Get("ref"), Memo: q.Get("memo")}
+	if v := q.Get("amount"); v != "" {
+		if r.Amount, err = strconv.ParseInt(v, 10, 64); err != nil || r.Amount <= 0 {
+			return Request{}, fmt.Errorf("invalid amount %q", v)
+		}
+	}
+	if r.Reference != "" && ReferenceIn(r.Reference) != r.Reference {
+		return Request{}, fmt.Errorf("invalid reference %q", r.Reference)
+	}
+	return r, nil
+}
@@ -0,0 +1,136 @@
+package invoice
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusAt(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	inv := Invoice{Amount: 100, ExpiresAt: now.Add(time.Hour)}
+
+	cases := []struct {
+		paid int64
+		at   time.Time
+		want string
+	}{
+		{0, now, StatusOpen},
+		{0, now.Add(time.Hour), StatusExpired},
+		{40, now, StatusUnderpaid},
+		{40, now.Add(2 * time.Hour), StatusUnderpaid},
+		{100, now, StatusPaid},
+		{150, now.Add(2 * time.Hour), StatusPaid},
+	}
+	for _, c := range cases {
+		inv.AmountPaid = c.paid
+		if got := inv.StatusAt(c.at); got != c.want {
+			t.Errorf("paid %d at %s: status %s, want %s", c.paid, c.at.Sub(now), got, c.want)
+		}
+	}
+
+	inv.AmountPaid = 40
+	if !inv.Payable(now) || inv.Outstanding() != 60 {
+		t.Fatalf("underpaid invoice should take the remaining 60")
+	}
+	if inv.Payable(now.Add(time.Hour)) {
+		t.Fatalf("expired invoice should not be payable")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	ok := Invoice{WalletID: "w", Amount: 5, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := Validate(ok); err != nil {
+		t.Fatalf("valid invoice rejected: %v", err)
+	}
+
+	bad := []func(*Invoice){
+		func(i *Invoice) { i.WalletID = "" },
+		func(i *Invoice) { i.Amount = 0 },
+		func(i *Invoice) { i.Memo = strings.Repeat("x", MaxMemo+1) },
+		func(i *Invoice) { i.ExpiresAt = now },
+		func(i *Invoice) { i.ExpiresAt = now.Add(MaxExpiry + time.Hour) },
+	}
+	for n, mutate := range bad {
+		inv := ok
+		mutate(&inv)
+		if Validate(inv) == nil {
+			t.Errorf("case %d: invalid invoice accepted", n)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	ref, err := NewReference()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ref) != 14 || ReferenceIn(ref) != ref {
+		t.Fatalf("reference %q does not match its own pattern", ref)
+	}
+	other, _ := NewReference()
+	if other == ref {
+		t.Fatalf("references should be random")
+	}
+
+	if got := ReferenceIn("order 42, " + strings.ToLower(ref) + " thanks"); got != ref {
+		t.Fatalf("reference in note: got %q, want %q", got, ref)
+	}
+	for _, note := range []string{"", "rent", "INV-SHORT", "XINV-ABCDEFGHIJ", "INV-ABCDEFGHIJK"} {
+		if got := ReferenceIn(note); got != "" {
+			t.Errorf("ReferenceIn(%q) = %q, want none", note, got)
+		}
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	r := Request{WalletID: "abc123", Amount: 2500, Reference: "INV-ABCDEFGHIJ", Memo: "Order #7 & co"}
+	uri := r.URI()
+	if !strings.HasPrefix(uri, "cryptowallet:abc123?") || !strings.Contains(uri, "amount=2500") ||
+		!strings.Contains(uri, "ref=INV-ABCDEFGHIJ") {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+
+	got, err := ParseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != r {
+		t.Fatalf("round trip: got %+v, want %+v", got, r)
+	}
+	if got.Note() != "INV-ABCDEFGHIJ Order #7 & co" {
+		t.Fatalf("note %q", got.Note())
+	}
+
+	bare, err := ParseURI("cryptowallet:abc123")
+	if err != nil || bare.WalletID != "abc123" || bare.Amount != 0 {
+		t.Fatalf("bare URI: %+v, %v", bare, err)
+	}
+
+	for _, s := range []string{
+		"bitcoin:abc123",
+		"cryptowallet:",
+		"cryptowallet:abc?amount=-1",
+		"cryptowallet:abc?amount=ten",
+		"cryptowallet:abc?ref=nope",
+	} {
+		if _, err := ParseURI(s); err == nil {
+			t.Errorf("ParseURI(%q) should fail", s)
+		}
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	png, err := QRCode(Request{WalletID: "abc123", Amount: 1}.URI(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Fatalf("not a PNG")
+	}
+	if _, err := QRCode("x", MaxQRSize+1); err == nil {
+		t.Fatalf("oversized QR code should be refused")
+	}
+}
@@ -0,0 +1,24 @@
+package invoice
+
+import (
+	"fmt"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR code sizes in pixels
+const (
+	DefaultQRSize = 256
+	MaxQRSize     = 1024
+)
+
+// QRCode renders a payment URI as a PNG of size x size pixels
+func QRCode(uri string, size int) ([]byte, error) {
+	if size <= 0 {
+		size = DefaultQRSize
+	}
+	if size > MaxQRSize {
+		return nil, fmt.Errorf("QR size may be at most %d", MaxQRSize)
+	}
+	return qrcode.Encode(uri, qrcode.Medium, size)
+}
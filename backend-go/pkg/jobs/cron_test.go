@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	base := time.Date(2024, time.January, 15, 10, 30, 0, 0, time.UTC) // a Monday
+
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"30 2 29 2 *", time.Date(2024, 2, 29, 2, 30, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 8 1,15 * *", time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either may match (the 20th, or a Friday)
+		{"0 0 20 * 5", time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		// a day field covering its whole range is unrestricted, however written
+		{"0 0 20 * */1", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31 * 5", time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 0-7", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+
+	for _, tc := range cases {
+		s, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tc.want) {
+			t.Errorf("%q: next after %s = %s, want %s", tc.expr, base, got, tc.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 10ms",
+		"@every soon",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) should fail", expr)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run statuses recorded in job history
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// Clock abstracts time so schedules and backoff can be driven by tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+// Locker provides cluster-wide mutual exclusion so that only one instance
+// runs a given job at a time. TryLock returns ok=false if another holder
+// already owns the lock.
+type Locker interface {
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// Run is a single attempt of a job, as stored in the run history
+type Run struct {
+	ID         int64     `json:"id"`
+	JobName    string    `json:"job_name"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// History persists job runs
+type History interface {
+	RecordJobRun(ctx context.Context, run Run) error
+}
+
+// Job describes a unit of scheduled work
+type Job struct {
+	Name       string
+	Schedule   string // cron expression, see ParseCron
+	Run        func(ctx context.Context) error
+	MaxRetries int           // extra attempts after the first failure
+	Backoff    time.Duration // delay before the first retry, doubled on each retry
+	MaxBackoff time.Duration // upper bound for the retry delay (0 = no bound)
+}
+
+// JobStatus is a snapshot of a registered job
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Running   bool      `json:"running"`
+}
+
+type entry struct {
+	job       Job
+	schedule  *Schedule
+	next      time.Time
+	last      time.Time
+	lastError string
+	running   bool
+}
+
+// ErrUnknownJob is returned by RunNow for names that were never registered
+var ErrUnknownJob = errors.New("unknown job")
+
+// Scheduler runs registered jobs on their cron schedules
+type Scheduler struct {
+	mu      sync.Mutex
+	clock   Clock
+	locker  Locker
+	history History
+	entries map[string]*entry
+	running bool
+	stop    chan struct{}
+	wake    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler. locker and history may be nil, in which
+// case jobs only coordinate within this process and runs are only logged.
+func NewScheduler(clock Clock, locker Locker, history History) *Scheduler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Scheduler{
+		clock:   clock,
+		locker:  locker,
+		history: history,
+		entries: make(map[string]*entry),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Register adds a job. It may be called before or after Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("job name and run func are required")
+	}
+	sched, err := ParseCron(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	next := sched.Next(s.clock.Now())
+	if next.IsZero() {
+		return fmt.Errorf("job %s: schedule %q never runs", job.Name, job.Schedule)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.entries[job.Name]; exists {
+		return fmt.Errorf("job %s already registered", job.Name)
+	}
+	s.entries[job.Name] = &entry{
+		job:      job,
+		schedule: sched,
+		next:     next,
+	}
+	s.notify()
+	return nil
+}
+
+// Start begins dispatching jobs in a background goroutine
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.loop(ctx)
+	log.Println("✓ Job scheduler started")
+}
+
+// Stop halts dispatching and waits for in-flight jobs to finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stop)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	log.Println("Job scheduler stopped")
+}
+
+// RunNow executes a job immediately, outside of its schedule
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.Lock()
+	e, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrUnknownJob
+	}
+	return s.execute(ctx, e)
+}
+
+// Jobs returns the status of every registered job sorted by name
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, JobStatus{
+			Name:      e.job.Name,
+			Schedule:  e.schedule.String(),
+			NextRun:   e.next,
+			LastRun:   e.last,
+			LastError: e.lastError,
+			Running:   e.running,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// notify wakes the loop so it can recompute its sleep; caller holds s.mu
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		wait := time.Minute
+		s.mu.Lock()
+		now := s.clock.Now()
+		for _, e := range s.entries {
+			if e.next.IsZero() {
+				continue
+			}
+			if d := e.next.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		s.mu.Unlock()
+		if wait < 0 {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-s.wake:
+			continue
+		case <-s.clock.After(wait):
+			s.dispatchDue(ctx)
+		}
+	}
+}
+
+// dispatchDue starts every job whose next activation time has passed. A
+// job with no next activation time is never due.
+func (s *Scheduler) dispatchDue(ctx context.Context) {
+	s.mu.Lock()
+	now := s.clock.Now()
+	var due []*entry
+	for _, e := range s.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		due = append(due, e)
+		if e.next = e.schedule.Next(now); e.next.IsZero() {
+			log.Printf("Job %s: schedule %q has no further runs", e.job.Name, e.schedule)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		s.wg.Add(1)
+		go func(e *entry) {
+			defer s.wg.Done()
+			if err := s.execute(ctx, e); err != nil {
+				log.Printf("Job %s failed: %v", e.job.Name, err)
+			}
+		}(e)
+	}
+}
+
+// execute runs a job once (plus retries) under its lock
+func (s *Scheduler) execute(ctx context.Context, e *entry) error {
+	s.mu.Lock()
+	if e.running {
+		s.mu.Unlock()
+		return fmt.Errorf("job %s is already running", e.job.Name)
+	}
+	e.running = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		e.running = false
+		s.mu.Unlock()
+	}()
+
+	if s.locker != nil {
+		unlock, ok, err := s.locker.TryLock(ctx, "job:"+e.job.Name)
+		if err != nil {
+			return fmt.Errorf("acquire lock: %w", err)
+		}
+		if !ok {
+			log.Printf("Job %s is held by another instance, skipping", e.job.Name)
+			return nil
+		}
+		defer unlock()
+	}
+
+	var err error
+	for attempt := 1; attempt <= e.job.MaxRetries+1; attempt++ {
+		run := Run{JobName: e.job.Name, Attempt: attempt, StartedAt: s.clock.Now()}
+		err = runSafely(ctx, e.job.Run)
+		run.FinishedAt = s.clock.Now()
+		run.Status = StatusSuccess
+		if err != nil {
+			run.Status = StatusFailed
+			run.Error = err.Error()
+		}
+		s.record(ctx, run)
+
+		s.mu.Lock()
+		e.last = run.StartedAt
+		e.lastError = run.Error
+		s.mu.Unlock()
+
+		if err == nil || attempt > e.job.MaxRetries {
+			break
+		}
+		delay := backoff(e.job.Backoff, e.job.MaxBackoff, attempt)
+		log.Printf("Job %s attempt %d failed: %v (retrying in %s)", e.job.Name, attempt, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(delay):
+		}
+	}
+	return err
+}
+
+func (s *Scheduler) record(ctx context.Context, run Run) {
+	if s.history == nil {
+		return
+	}
+	if err := s.history.RecordJobRun(ctx, run); err != nil {
+		log.Printf("Warning: failed to record run of job %s: %v", run.JobName, err)
+	}
+}
+
+// runSafely converts a panic inside a job into an error
+func runSafely(ctx context.Context, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// backoff returns the delay before retry number attempt (1-based)
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if max > 0 && d >= max {
+			return max
+		}
+	}
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
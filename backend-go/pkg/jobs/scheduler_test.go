@@ -0,0 +1,255 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock never sleeps: After advances the clock and fires immediately
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+type memHistory struct {
+	mu   sync.Mutex
+	runs []Run
+}
+
+func (h *memHistory) RecordJobRun(ctx context.Context, run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, run)
+	return nil
+}
+
+type denyLocker struct{}
+
+func (denyLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func TestDispatchDueRunsAndReschedules(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)}
+	s := NewScheduler(clock, nil, nil)
+
+	var mu sync.Mutex
+	runs := 0
+	err := s.Register(Job{Name: "hourly", Schedule: "@hourly", Run: func(ctx context.Context) error {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	// Not yet due
+	s.dispatchDue(context.Background())
+	s.wg.Wait()
+	if runs != 0 {
+		t.Fatalf("job ran before it was due")
+	}
+
+	clock.set(time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC))
+	s.dispatchDue(context.Background())
+	s.wg.Wait()
+	if runs != 1 {
+		t.Fatalf("expected 1 run, got %d", runs)
+	}
+
+	status := s.Jobs()
+	if len(status) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(status))
+	}
+	want := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	if !status[0].NextRun.Equal(want) {
+		t.Errorf("next run = %s, want %s", status[0].NextRun, want)
+	}
+}
+
+func TestDispatchSkipsJobsWithNoNextRun(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)}
+	s := NewScheduler(clock, nil, nil)
+	runs := 0
+	if err := s.Register(Job{Name: "hourly", Schedule: "@hourly", Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	// A schedule that ran out of activations leaves next at zero, which is
+	// before any clock reading but must not count as due
+	s.entries["hourly"].next = time.Time{}
+	s.dispatchDue(context.Background())
+	s.wg.Wait()
+	if runs != 0 {
+		t.Fatalf("job with no next run was dispatched %d times", runs)
+	}
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	hist := &memHistory{}
+	s := NewScheduler(clock, nil, hist)
+
+	calls := 0
+	s.Register(Job{
+		Name:       "flaky",
+		Schedule:   "@daily",
+		MaxRetries: 3,
+		Backoff:    time.Second,
+		Run: func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("temporary failure")
+			}
+			return nil
+		},
+	})
+
+	if err := s.RunNow(context.Background(), "flaky"); err != nil {
+		t.Fatalf("RunNow: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+	wantWaits := []time.Duration{time.Second, 2 * time.Second}
+	if len(clock.waits) != len(wantWaits) {
+		t.Fatalf("expected waits %v, got %v", wantWaits, clock.waits)
+	}
+	for i, w := range wantWaits {
+		if clock.waits[i] != w {
+			t.Errorf("wait %d = %s, want %s", i, clock.waits[i], w)
+		}
+	}
+
+	if len(hist.runs) != 3 {
+		t.Fatalf("expected 3 recorded runs, got %d", len(hist.runs))
+	}
+	if hist.runs[0].Status != StatusFailed || hist.runs[2].Status != StatusSuccess {
+		t.Errorf("unexpected statuses: %+v", hist.runs)
+	}
+	if hist.runs[2].Attempt != 3 {
+		t.Errorf("expected attempt 3, got %d", hist.runs[2].Attempt)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewScheduler(clock, nil, nil)
+	s.Register(Job{
+		Name:       "broken",
+		Schedule:   "@daily",
+		MaxRetries: 2,
+		Backoff:    time.Second,
+		MaxBackoff: time.Second,
+		Run:        func(ctx context.Context) error { return errors.New("boom") },
+	})
+
+	if err := s.RunNow(context.Background(), "broken"); err == nil {
+		t.Fatal("expected error after retries were exhausted")
+	}
+	for _, w := range clock.waits {
+		if w != time.Second {
+			t.Errorf("backoff should be capped at 1s, got %s", w)
+		}
+	}
+	if got := s.Jobs()[0].LastError; got != "boom" {
+		t.Errorf("last error = %q", got)
+	}
+}
+
+func TestLockHeldElsewhereSkipsRun(t *testing.T) {
+	s := NewScheduler(&fakeClock{}, denyLocker{}, nil)
+	ran := false
+	s.Register(Job{Name: "exclusive", Schedule: "@hourly", Run: func(ctx context.Context) error {
+		ran = true
+		return nil
+	}})
+
+	if err := s.RunNow(context.Background(), "exclusive"); err != nil {
+		t.Fatalf("RunNow: %v", err)
+	}
+	if ran {
+		t.Error("job should not run when another instance holds the lock")
+	}
+}
+
+func TestPanicIsRecorded(t *testing.T) {
+	hist := &memHistory{}
+	s := NewScheduler(&fakeClock{}, nil, hist)
+	s.Register(Job{Name: "panicky", Schedule: "@hourly", Run: func(ctx context.Context) error {
+		panic("oops")
+	}})
+
+	if err := s.RunNow(context.Background(), "panicky"); err == nil {
+		t.Fatal("expected panic to surface as an error")
+	}
+	if len(hist.runs) != 1 || hist.runs[0].Status != StatusFailed {
+		t.Fatalf("expected one failed run, got %+v", hist.runs)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	s := NewScheduler(nil, nil, nil)
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := s.Register(Job{Name: "bad", Schedule: "not a cron", Run: noop}); err == nil {
+		t.Error("invalid schedule should be rejected")
+	}
+	if err := s.Register(Job{Name: "never", Schedule: "0 0 30 2 *", Run: noop}); err == nil {
+		t.Error("schedule that never matches should be rejected")
+	}
+	if err := s.Register(Job{Name: "dup", Schedule: "@hourly", Run: noop}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := s.Register(Job{Name: "dup", Schedule: "@hourly", Run: noop}); err == nil {
+		t.Error("duplicate job name should be rejected")
+	}
+	if err := s.RunNow(context.Background(), "missing"); err != ErrUnknownJob {
+		t.Errorf("expected ErrUnknownJob, got %v", err)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	s := NewScheduler(nil, nil, nil)
+	s.Start(context.Background())
+	s.Start(context.Background()) // second start is a no-op
+	s.Stop()
+	s.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		t.Error("scheduler should be stopped")
+	}
+}
@@ -0,0 +1,306 @@
+// Package keystore keeps Ed25519 private keys in passphrase-encrypted
+// files. The key is sealed with AES-256-GCM under a key derived from the
+// passphrase with scrypt; the public key and wallet ID stay in the clear so
+// a wallet can be listed without unlocking it. The same file is the
+// portable backup format the server exports and imports.
+//
+// Version 1 files, which derive the key with PBKDF2-HMAC-SHA256, can still
+// be opened.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	"blockchain-wallet/pkg/crypto"
+)
+
+const (
+	// Version is the key file format version written by Encrypt
+	Version = 2
+	// DefaultScryptN is the scrypt cost for new files: 32 MiB and about a
+	// tenth of a second per unlock
+	DefaultScryptN = 1 << 15
+	// MinScryptN and MaxScryptN bound the cost a file may use. The upper
+	// bound keeps a hostile file from exhausting memory.
+	MinScryptN = 1 << 10
+	MaxScryptN = 1 << 20
+	// MinIterations and MaxIterations bound the PBKDF2 work factor a
+	// version 1 file may use. The upper bound, about a second of hashing,
+	// keeps a hostile file from tying up the CPU.
+	MinIterations = 1000
+	MaxIterations = 2_000_000
+
+	kdfScrypt  = "scrypt"
+	kdfPBKDF2  = "pbkdf2-sha256"
+	cipherName = "aes-256-gcm"
+	saltSize   = 16
+	scryptR    = 8
+	scryptP    = 1
+)
+
+var (
+	// ErrWrongPassphrase is returned when a file does not open with the
+	// given passphrase
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+	// ErrNotFound is returned when no key file matches
+	ErrNotFound = errors.New("key not found")
+	// ErrAmbiguous is returned when a name matches more than one key file
+	ErrAmbiguous = errors.New("name matches more than one key")
+)
+
+// KDFParams are the key derivation parameters of a key file: N, R and P
+// for scrypt, Iterations for PBKDF2
+type KDFParams struct {
+	N          int    `json:"n,omitempty"`
+	R          int    `json:"r,omitempty"`
+	P          int    `json:"p,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+}
+
+// Sealed is the encrypted private key
+type Sealed struct {
+	Cipher     string    `json:"cipher"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	KDF        string    `json:"kdf"`
+	KDFParams  KDFParams `json:"kdfparams"`
+}
+
+// Key is an encrypted key file
+type Key struct {
+	Version   int               `json:"version"`
+	WalletID  string            `json:"wallet_id"`
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Label     string            `json:"label,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Crypto    Sealed            `json:"crypto"`
+}
+
+// aad binds the ciphertext to the file's identity, so the sealed key cannot
+// be moved into another wallet's file
+func (k *Key) aad() []byte {
+	return []byte(fmt.Sprintf("keystore:%d:%s", k.Version, k.WalletID))
+}
+
+func deriveAEAD(passphrase, kdf string, p KDFParams) (cipher.AEAD, error) {
+	var key []byte
+	var err error
+	switch kdf {
+	case kdfScrypt:
+		if p.N < MinScryptN || p.N > MaxScryptN || p.R != scryptR || p.P != scryptP {
+			return nil, fmt.Errorf("unsupported scrypt parameters n=%d r=%d p=%d", p.N, p.R, p.P)
+		}
+		key, err = scrypt.Key([]byte(passphrase), p.Salt, p.N, p.R, p.P, 32)
+	case kdfPBKDF2:
+		if p.Iterations < MinIterations || p.Iterations > MaxIterations {
+			return nil, fmt.Errorf("iterations must be from %d to %d", MinIterations, MaxIterations)
+		}
+		key, err = pbkdf2.Key(sha256.New, passphrase, p.Salt, p.Iterations, 32)
+	default:
+		return nil, fmt.Errorf("unsupported kdf %q", kdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals priv under passphrase. scryptN is the scrypt cost, a power
+// of two; 0 uses DefaultScryptN.
+func Encrypt(priv ed25519.PrivateKey, passphrase, label string, scryptN int) (*Key, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("not an Ed25519 private key")
+	}
+	if passphrase == "" {
+		return nil, errors.New("passphrase required")
+	}
+	if scryptN == 0 {
+		scryptN = DefaultScryptN
+	}
+	if scryptN < MinScryptN || scryptN > MaxScryptN || scryptN&(scryptN-1) != 0 {
+		return nil, fmt.Errorf("scrypt cost must be a power of two from %d to %d", MinScryptN, MaxScryptN)
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	k := &Key{
+		Version:   Version,
+		WalletID:  crypto.WalletIDFromPub(pub),
+		PublicKey: pub,
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+		Crypto: Sealed{
+			Cipher:    cipherName,
+			KDF:       kdfScrypt,
+			KDFParams: KDFParams{N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, saltSize)},
+		},
+	}
+	if _, err := rand.Read(k.Crypto.KDFParams.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveAEAD(passphrase, k.Crypto.KDF, k.Crypto.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	k.Crypto.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(k.Crypto.Nonce); err != nil {
+		return nil, err
+	}
+	k.Crypto.Ciphertext = aead.Seal(nil, k.Crypto.Nonce, priv.Seed(), k.aad())
+	return k, nil
+}
+
+// Decrypt opens the key file with passphrase
+func (k *Key) Decrypt(passphrase string) (ed25519.PrivateKey, error) {
+	// Version 1 files always used PBKDF2; later ones name their kdf
+	switch {
+	case k.Version == 1 && k.Crypto.KDF == kdfPBKDF2:
+	case k.Version == Version && k.Crypto.KDF == kdfScrypt:
+	default:
+		return nil, fmt.Errorf("unsupported key file version %d with kdf %q", k.Version, k.Crypto.KDF)
+	}
+	if k.Crypto.Cipher != cipherName {
+		return nil, fmt.Errorf("unsupported cipher %q", k.Crypto.Cipher)
+	}
+	aead, err := deriveAEAD(passphrase, k.Crypto.KDF, k.Crypto.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Crypto.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	seed, err := aead.Open(nil, k.Crypto.Nonce, k.Crypto.Ciphertext, k.aad())
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrWrongPassphrase
+	}
+	priv := ed25519.NewKeyFromSeed(seed)
+	if !priv.Public().(ed25519.PublicKey).Equal(k.PublicKey) {
+		return nil, errors.New("key file public key does not match its private key")
+	}
+	return priv, nil
+}
+
+// Marshal returns the key file's JSON
+func (k *Key) Marshal() ([]byte, error) {
+	return json.MarshalIndent(k, "", "  ")
+}
+
+// Parse reads a key file's JSON and checks that its wallet ID follows from
+// its public key
+func Parse(data []byte) (*Key, error) {
+	var k Key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+	if len(k.PublicKey) != ed25519.PublicKeySize || crypto.WalletIDFromPub(k.PublicKey) != k.WalletID {
+		return nil, errors.New("key file wallet ID does not match its public key")
+	}
+	return &k, nil
+}
+
+// Dir is a directory of key files, one per wallet, named by wallet ID
+type Dir struct {
+	Path string
+}
+
+func (d Dir) file(walletID string) string {
+	return filepath.Join(d.Path, walletID+".json")
+}
+
+// Save writes a key file readable only by its owner. It refuses to replace
+// an existing file for the same wallet.
+func (d Dir) Save(k *Key) error {
+	if err := os.MkdirAll(d.Path, 0o700); err != nil {
+		return err
+	}
+	data, err := k.Marshal()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.file(k.WalletID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("wallet %s is already in the keystore", k.WalletID)
+		}
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List returns the key files in the directory, by label then wallet ID
+func (d Dir) List() ([]*Key, error) {
+	paths, err := filepath.Glob(filepath.Join(d.Path, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		k, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Label != keys[j].Label {
+			return keys[i].Label < keys[j].Label
+		}
+		return keys[i].WalletID < keys[j].WalletID
+	})
+	return keys, nil
+}
+
+// Find returns the key whose label is name or whose wallet ID starts with
+// name
+func (d Dir) Find(name string) (*Key, error) {
+	if name == "" {
+		return nil, ErrNotFound
+	}
+	keys, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	var match *Key
+	for _, k := range keys {
+		if k.Label == name || k.WalletID == name {
+			return k, nil
+		}
+		if strings.HasPrefix(k.WalletID, name) {
+			if match != nil {
+				return nil, ErrAmbiguous
+			}
+			match = k
+		}
+	}
+	if match == nil {
+		return nil, ErrNotFound
+	}
+	return match, nil
+}
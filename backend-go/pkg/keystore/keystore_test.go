@@ -0,0 +1,135 @@
+package keystore
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	k, err := Encrypt(priv, "correct horse", "savings", MinScryptN)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if k.WalletID != crypto.WalletIDFromPub(pub) {
+		t.Errorf("wallet ID %s", k.WalletID)
+	}
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, err := back.Decrypt("correct horse")
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !got.Equal(priv) {
+		t.Error("decrypted key differs")
+	}
+	if _, err := back.Decrypt("wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+}
+
+func TestSealedKeyIsBoundToWallet(t *testing.T) {
+	privA, _, _ := crypto.GenerateKeypair()
+	privB, _, _ := crypto.GenerateKeypair()
+	a, _ := Encrypt(privA, "pass", "", MinScryptN)
+	b, _ := Encrypt(privB, "pass", "", MinScryptN)
+
+	// Moving A's sealed key into B's file must not open
+	b.Crypto = a.Crypto
+	if _, err := b.Decrypt("pass"); err == nil {
+		t.Error("sealed key opened under another wallet")
+	}
+
+	a.WalletID = b.WalletID
+	data, _ := a.Marshal()
+	if _, err := Parse(data); err == nil {
+		t.Error("Parse accepted a wallet ID that does not match the public key")
+	}
+}
+
+func TestEncryptRejectsWeakSettings(t *testing.T) {
+	priv, _, _ := crypto.GenerateKeypair()
+	if _, err := Encrypt(priv, "", "", MinScryptN); err == nil {
+		t.Error("empty passphrase accepted")
+	}
+	if _, err := Encrypt(priv, "pass", "", 16); err == nil {
+		t.Error("low scrypt cost accepted")
+	}
+	if _, err := Encrypt(priv, "pass", "", 3000); err == nil {
+		t.Error("scrypt cost that is not a power of two accepted")
+	}
+
+	// A file may not demand more memory than MaxScryptN allows
+	k, _ := Encrypt(priv, "pass", "", MinScryptN)
+	k.Crypto.KDFParams.N = MaxScryptN * 2
+	if _, err := k.Decrypt("pass"); err == nil || errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("oversized scrypt cost: %v", err)
+	}
+}
+
+func TestDecryptVersion1(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	k := &Key{Version: 1, WalletID: crypto.WalletIDFromPub(pub), PublicKey: pub, Crypto: Sealed{
+		Cipher: cipherName, KDF: kdfPBKDF2, KDFParams: KDFParams{Iterations: MinIterations, Salt: []byte("0123456789abcdef")},
+	}}
+	aead, err := deriveAEAD("old pass", k.Crypto.KDF, k.Crypto.KDFParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Crypto.Nonce = make([]byte, aead.NonceSize())
+	k.Crypto.Ciphertext = aead.Seal(nil, k.Crypto.Nonce, priv.Seed(), k.aad())
+
+	got, err := k.Decrypt("old pass")
+	if err != nil || !got.Equal(priv) {
+		t.Fatalf("version 1 file: %v", err)
+	}
+	// Nor may it demand more hashing than MaxIterations allows
+	slow := *k
+	slow.Crypto.KDFParams.Iterations = MaxIterations + 1
+	if _, err := slow.Decrypt("old pass"); err == nil || errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("oversized iteration count: %v", err)
+	}
+	k.Crypto.KDF = kdfScrypt
+	if _, err := k.Decrypt("old pass"); err == nil {
+		t.Error("version 1 file with a scrypt kdf accepted")
+	}
+}
+
+func TestDir(t *testing.T) {
+	d := Dir{Path: t.TempDir()}
+	privA, _, _ := crypto.GenerateKeypair()
+	privB, _, _ := crypto.GenerateKeypair()
+	a, _ := Encrypt(privA, "pass", "alice", MinScryptN)
+	b, _ := Encrypt(privB, "pass", "bob", MinScryptN)
+	for _, k := range []*Key{a, b} {
+		if err := d.Save(k); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if err := d.Save(a); err == nil {
+		t.Error("saving a wallet twice should fail")
+	}
+
+	keys, err := d.List()
+	if err != nil || len(keys) != 2 || keys[0].Label != "alice" {
+		t.Fatalf("List = %v, %v", keys, err)
+	}
+	if k, err := d.Find("bob"); err != nil || k.WalletID != b.WalletID {
+		t.Errorf("Find by label = %v, %v", k, err)
+	}
+	if k, err := d.Find(a.WalletID[:10]); err != nil || k.WalletID != a.WalletID {
+		t.Errorf("Find by prefix = %v, %v", k, err)
+	}
+	if _, err := d.Find("carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find unknown: %v", err)
+	}
+}
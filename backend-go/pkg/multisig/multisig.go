@@ -0,0 +1,212 @@
+package multisig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/tx"
+)
+
+// MaxKeys bounds the number of cosigners of a policy
+const MaxKeys = 15
+
+// AddressPrefix starts every multisig address, so it can never collide with
+// a single-key wallet ID (plain hex)
+const AddressPrefix = "ms"
+
+const policyVersion = 1
+
+var (
+	// ErrNotEnoughSignatures is returned when fewer valid signatures than
+	// the threshold are present
+	ErrNotEnoughSignatures = errors.New("not enough valid signatures")
+	// ErrUnknownSigner is returned for a signature by a key outside the policy
+	ErrUnknownSigner = errors.New("signer is not a cosigner of this wallet")
+	// ErrBadSignature is returned for a signature that does not verify
+	ErrBadSignature = errors.New("invalid signature")
+	// ErrAddressMismatch is returned when a transaction's sender is not the
+	// address of the policy it carries
+	ErrAddressMismatch = errors.New("sender is not the address of the policy")
+)
+
+// Policy is an M-of-N spending rule over Ed25519 keys. Keys are kept in
+// canonical (sorted) order, so the same set of keys always gives the same
+// address.
+type Policy struct {
+	Threshold int                 `json:"threshold"`
+	Keys      []ed25519.PublicKey `json:"keys"`
+}
+
+// NewPolicy validates a threshold and set of keys and returns the policy
+func NewPolicy(threshold int, keys []ed25519.PublicKey) (Policy, error) {
+	if len(keys) == 0 {
+		return Policy{}, errors.New("at least one key required")
+	}
+	if len(keys) > MaxKeys {
+		return Policy{}, fmt.Errorf("at most %d keys allowed", MaxKeys)
+	}
+	if threshold < 1 || threshold > len(keys) {
+		return Policy{}, fmt.Errorf("threshold must be between 1 and %d", len(keys))
+	}
+
+	sorted := make([]ed25519.PublicKey, len(keys))
+	for i, k := range keys {
+		if len(k) != ed25519.PublicKeySize {
+			return Policy{}, fmt.Errorf("key %d is not an Ed25519 public key", i+1)
+		}
+		sorted[i] = append(ed25519.PublicKey(nil), k...)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	for i := 1; i < len(sorted); i++ {
+		if bytes.Equal(sorted[i], sorted[i-1]) {
+			return Policy{}, errors.New("duplicate key")
+		}
+	}
+	return Policy{Threshold: threshold, Keys: sorted}, nil
+}
+
+// Encode returns the canonical encoding: version, threshold, key count and
+// the keys in order
+func (p Policy) Encode() []byte {
+	b := make([]byte, 0, 3+len(p.Keys)*ed25519.PublicKeySize)
+	b = append(b, policyVersion, byte(p.Threshold), byte(len(p.Keys)))
+	for _, k := range p.Keys {
+		b = append(b, k...)
+	}
+	return b
+}
+
+// DecodePolicy parses an encoded policy
+func DecodePolicy(b []byte) (Policy, error) {
+	if len(b) < 3 || b[0] != policyVersion {
+		return Policy{}, errors.New("not a multisig policy")
+	}
+	n := int(b[2])
+	if len(b) != 3+n*ed25519.PublicKeySize {
+		return Policy{}, errors.New("truncated multisig policy")
+	}
+	keys := make([]ed25519.PublicKey, n)
+	for i := range keys {
+		off := 3 + i*ed25519.PublicKeySize
+		keys[i] = ed25519.PublicKey(b[off : off+ed25519.PublicKeySize])
+	}
+	p, err := NewPolicy(int(b[1]), keys)
+	if err != nil {
+		return Policy{}, err
+	}
+	if !bytes.Equal(p.Encode(), b) {
+		return Policy{}, errors.New("multisig policy keys are not in canonical order")
+	}
+	return p, nil
+}
+
+// Address derives the wallet address of the policy
+func (p Policy) Address() string {
+	h := sha256.Sum256(append([]byte("multisig:"), p.Encode()...))
+	return AddressPrefix + hex.EncodeToString(h[:])
+}
+
+// IsAddress reports whether a wallet ID is a multisig address
+func IsAddress(walletID string) bool {
+	return strings.HasPrefix(walletID, AddressPrefix) && len(walletID) == len(AddressPrefix)+2*sha256.Size
+}
+
+// HasKey reports whether pub is one of the policy's cosigners
+func (p Policy) HasKey(pub ed25519.PublicKey) bool {
+	for _, k := range p.Keys {
+		if bytes.Equal(k, pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature is one cosigner's signature over a payload
+type Signature struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Signature []byte            `json:"signature"`
+}
+
+// VerifyOne checks a single cosigner's signature
+func (p Policy) VerifyOne(payload []byte, s Signature) error {
+	if !p.HasKey(s.PublicKey) {
+		return ErrUnknownSigner
+	}
+	if !crypto.VerifySignature(s.PublicKey, payload, s.Signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Verify checks that sigs hold at least Threshold valid signatures over
+// payload by distinct cosigners. Any signature by an outsider or that does
+// not verify fails the whole set.
+func (p Policy) Verify(payload []byte, sigs []Signature) error {
+	seen := make(map[string]bool, len(sigs))
+	for _, s := range sigs {
+		if err := p.VerifyOne(payload, s); err != nil {
+			return err
+		}
+		seen[string(s.PublicKey)] = true
+	}
+	if len(seen) < p.Threshold {
+		return fmt.Errorf("%w: have %d of %d", ErrNotEnoughSignatures, len(seen), p.Threshold)
+	}
+	return nil
+}
+
+const witnessEntry = ed25519.PublicKeySize + ed25519.SignatureSize
+
+// EncodeWitness packs signatures as consecutive key||signature pairs, the
+// form they take in a transaction's signature field
+func EncodeWitness(sigs []Signature) []byte {
+	b := make([]byte, 0, len(sigs)*witnessEntry)
+	for _, s := range sigs {
+		b = append(b, s.PublicKey...)
+		b = append(b, s.Signature...)
+	}
+	return b
+}
+
+// DecodeWitness unpacks EncodeWitness
+func DecodeWitness(b []byte) ([]Signature, error) {
+	if len(b) == 0 || len(b)%witnessEntry != 0 {
+		return nil, errors.New("malformed multisig witness")
+	}
+	sigs := make([]Signature, 0, len(b)/witnessEntry)
+	for off := 0; off < len(b); off += witnessEntry {
+		sigs = append(sigs, Signature{
+			PublicKey: ed25519.PublicKey(b[off : off+ed25519.PublicKeySize]),
+			Signature: b[off+ed25519.PublicKeySize : off+witnessEntry],
+		})
+	}
+	return sigs, nil
+}
+
+// VerifyTransaction is the spending rule for a multisig sender: the
+// transaction carries the encoded policy in SenderPub and the cosigners'
+// signatures in Signature, the policy must hash to the sender address, and
+// the signatures must meet the threshold. The signatures are over the
+// signature hash, which covers the inputs, so a witness spends exactly the
+// outputs it was made for and cannot be moved to other inputs.
+func VerifyTransaction(t *tx.Transaction) error {
+	p, err := DecodePolicy(t.SenderPub)
+	if err != nil {
+		return err
+	}
+	if p.Address() != t.SenderID {
+		return ErrAddressMismatch
+	}
+	sigs, err := DecodeWitness(t.Signature)
+	if err != nil {
+		return err
+	}
+	return p.Verify(t.SigHash(), sigs)
+}
@@ -0,0 +1,198 @@
+package multisig
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+)
+
+type signer struct {
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+}
+
+func newSigners(t *testing.T, n int) []signer {
+	t.Helper()
+	s := make([]signer, n)
+	for i := range s {
+		priv, pub, err := crypto.GenerateKeypair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s[i] = signer{priv, pub}
+	}
+	return s
+}
+
+func keysOf(s []signer) []ed25519.PublicKey {
+	keys := make([]ed25519.PublicKey, len(s))
+	for i := range s {
+		keys[i] = s[i].pub
+	}
+	return keys
+}
+
+func (s signer) sign(payload []byte) Signature {
+	return Signature{PublicKey: s.pub, Signature: crypto.SignPayload(s.priv, payload)}
+}
+
+func TestPolicyAddressIsOrderIndependent(t *testing.T) {
+	s := newSigners(t, 3)
+	a, err := NewPolicy(2, []ed25519.PublicKey{s[0].pub, s[1].pub, s[2].pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewPolicy(2, []ed25519.PublicKey{s[2].pub, s[0].pub, s[1].pub})
+	if a.Address() != b.Address() {
+		t.Fatalf("key order changed the address")
+	}
+	if !IsAddress(a.Address()) || IsAddress(crypto.WalletIDFromPub(s[0].pub)) {
+		t.Fatalf("IsAddress misclassified an address")
+	}
+	c, _ := NewPolicy(3, keysOf(s))
+	if c.Address() == a.Address() {
+		t.Fatalf("threshold is not part of the address")
+	}
+
+	decoded, err := DecodePolicy(a.Encode())
+	if err != nil || decoded.Address() != a.Address() {
+		t.Fatalf("DecodePolicy round trip: %v", err)
+	}
+}
+
+func TestNewPolicyRejectsBadInput(t *testing.T) {
+	s := newSigners(t, 2)
+	cases := []struct {
+		threshold int
+		keys      []ed25519.PublicKey
+	}{
+		{1, nil},
+		{0, keysOf(s)},
+		{3, keysOf(s)},
+		{1, []ed25519.PublicKey{s[0].pub, s[0].pub}},
+		{1, []ed25519.PublicKey{s[0].pub[:31]}},
+		{1, keysOf(newSigners(t, MaxKeys+1))},
+	}
+	for i, c := range cases {
+		if _, err := NewPolicy(c.threshold, c.keys); err == nil {
+			t.Errorf("case %d: invalid policy accepted", i)
+		}
+	}
+}
+
+func TestVerifyThreshold(t *testing.T) {
+	s := newSigners(t, 3)
+	outsider := newSigners(t, 1)[0]
+	p, _ := NewPolicy(2, keysOf(s))
+	payload := []byte("spend 10")
+
+	if err := p.Verify(payload, []Signature{s[0].sign(payload)}); !errors.Is(err, ErrNotEnoughSignatures) {
+		t.Fatalf("1 of 2: got %v", err)
+	}
+	// The same cosigner twice does not count double
+	if err := p.Verify(payload, []Signature{s[0].sign(payload), s[0].sign(payload)}); !errors.Is(err, ErrNotEnoughSignatures) {
+		t.Fatalf("duplicate signer: got %v", err)
+	}
+	if err := p.Verify(payload, []Signature{s[0].sign(payload), s[2].sign(payload)}); err != nil {
+		t.Fatalf("2 of 2: %v", err)
+	}
+	if err := p.Verify(payload, []Signature{s[0].sign(payload), outsider.sign(payload)}); !errors.Is(err, ErrUnknownSigner) {
+		t.Fatalf("outsider: got %v", err)
+	}
+	if err := p.Verify(payload, []Signature{s[0].sign(payload), s[1].sign([]byte("spend 1000"))}); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("signature over other payload: got %v", err)
+	}
+}
+
+func TestVerifyTransaction(t *testing.T) {
+	s := newSigners(t, 3)
+	p, _ := NewPolicy(2, keysOf(s))
+	prop := Proposal{WalletID: p.Address(), ReceiverID: "bob", Amount: 50, Note: "rent", Timestamp: 1700000000, Inputs: []string{"u1"}}
+
+	txx := prop.Transaction()
+	txx.SenderPub = p.Encode()
+	payload := txx.SigHash()
+	txx.Signature = EncodeWitness([]Signature{s[1].sign(payload), s[2].sign(payload)})
+	if err := VerifyTransaction(txx); err != nil {
+		t.Fatalf("approved spend rejected: %v", err)
+	}
+
+	short := *txx
+	short.Signature = EncodeWitness([]Signature{s[1].sign(payload)})
+	if err := VerifyTransaction(&short); !errors.Is(err, ErrNotEnoughSignatures) {
+		t.Fatalf("under-signed spend: got %v", err)
+	}
+
+	// A policy for other keys cannot spend from this address
+	other, _ := NewPolicy(1, keysOf(newSigners(t, 1)))
+	forged := *txx
+	forged.SenderPub = other.Encode()
+	if err := VerifyTransaction(&forged); !errors.Is(err, ErrAddressMismatch) {
+		t.Fatalf("foreign policy: got %v", err)
+	}
+
+	tampered := *txx
+	tampered.Amount = 5000
+	if err := VerifyTransaction(&tampered); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered amount: got %v", err)
+	}
+
+	// The witness is bound to the inputs it was made for
+	moved := *txx
+	moved.InputUTXOs = []string{"u2"}
+	moved.ID = moved.ComputeID()
+	if err := VerifyTransaction(&moved); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("witness moved to other inputs: got %v", err)
+	}
+
+	// Approvals of a proposal over other inputs do not carry over
+	elsewhere := prop
+	elsewhere.Inputs = []string{"u2"}
+	approved := *txx
+	approved.Signature = EncodeWitness([]Signature{s[1].sign(elsewhere.Payload()), s[2].sign(elsewhere.Payload())})
+	if err := VerifyTransaction(&approved); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("replayed proposal approvals: got %v", err)
+	}
+}
+
+func TestProposalVerify(t *testing.T) {
+	s := newSigners(t, 3)
+	p, _ := NewPolicy(2, keysOf(s))
+	prop := Proposal{WalletID: p.Address(), ReceiverID: "bob", Amount: 50, Note: "rent", Timestamp: 1700000000, Inputs: []string{"u1", "u2"}}
+	prop.Signatures = []Signature{s[0].sign(prop.Payload()), s[2].sign(prop.Payload())}
+	if err := prop.Verify(p); err != nil {
+		t.Fatalf("approved proposal rejected: %v", err)
+	}
+
+	// The approvals are the witness of the proposal's transaction
+	txx := prop.Transaction()
+	txx.SenderPub = p.Encode()
+	txx.Signature = EncodeWitness(prop.Signatures)
+	if err := VerifyTransaction(txx); err != nil {
+		t.Fatalf("approvals rejected as a witness: %v", err)
+	}
+
+	other, _ := NewPolicy(2, keysOf(s[:2]))
+	if err := prop.Verify(other); !errors.Is(err, ErrAddressMismatch) {
+		t.Fatalf("policy of another wallet: got %v", err)
+	}
+	later := prop
+	later.Timestamp++
+	if err := later.Verify(p); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("approvals moved to another proposal: got %v", err)
+	}
+}
+
+func TestWitnessRoundTrip(t *testing.T) {
+	s := newSigners(t, 2)
+	sigs := []Signature{s[0].sign([]byte("x")), s[1].sign([]byte("x"))}
+	got, err := DecodeWitness(EncodeWitness(sigs))
+	if err != nil || len(got) != 2 || !got[1].PublicKey.Equal(s[1].pub) {
+		t.Fatalf("DecodeWitness = %v, %v", got, err)
+	}
+	if _, err := DecodeWitness([]byte("short")); err == nil {
+		t.Fatalf("malformed witness accepted")
+	}
+}
@@ -0,0 +1,82 @@
+package multisig
+
+import (
+	"errors"
+	"time"
+
+	"blockchain-wallet/pkg/tx"
+)
+
+// Proposal statuses
+const (
+	ProposalPending   = "pending"
+	ProposalExecuted  = "executed"
+	ProposalCancelled = "cancelled"
+)
+
+// ErrDuplicateProposal is returned when the wallet already has a proposal
+// for the same transfer at the same timestamp, so one transfer cannot be
+// proposed twice over different inputs.
+var ErrDuplicateProposal = errors.New("a proposal with the same payload already exists; use a new timestamp")
+
+// Wallet is a registered multisig wallet
+type Wallet struct {
+	Address   string    `json:"address"`
+	Name      string    `json:"name"`
+	Policy    Policy    `json:"policy"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Proposal is a spend from a multisig wallet awaiting cosigner approval.
+// Its timestamp and inputs are fixed when it is created so every cosigner
+// signs the same transaction.
+type Proposal struct {
+	ID         string      `json:"id"`
+	WalletID   string      `json:"wallet_id"`
+	ReceiverID string      `json:"receiver_id"`
+	Amount     int64       `json:"amount"`
+	Note       string      `json:"note"`
+	Timestamp  int64       `json:"timestamp"`
+	Inputs     []string    `json:"inputs"`
+	Status     string      `json:"status"`
+	Signatures []Signature `json:"signatures"`
+	TxID       string      `json:"tx_id,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ExecutedAt *time.Time  `json:"executed_at,omitempty"`
+}
+
+// Transaction returns the unsigned transaction the proposal spends with
+func (p Proposal) Transaction() *tx.Transaction {
+	t := &tx.Transaction{
+		SenderID:   p.WalletID,
+		ReceiverID: p.ReceiverID,
+		Amount:     p.Amount,
+		Timestamp:  p.Timestamp,
+		Note:       p.Note,
+		InputUTXOs: p.Inputs,
+	}
+	t.ID = t.ComputeID()
+	return t
+}
+
+// Payload returns the bytes each cosigner signs: the signature hash of the
+// proposal's transaction, so the approvals are its witness (see
+// VerifyTransaction)
+func (p Proposal) Payload() []byte {
+	return p.Transaction().SigHash()
+}
+
+// Verify checks that the proposal belongs to the policy's address and that
+// its approvals meet the threshold
+func (p Proposal) Verify(policy Policy) error {
+	if policy.Address() != p.WalletID {
+		return ErrAddressMismatch
+	}
+	return policy.Verify(p.Payload(), p.Signatures)
+}
+
+// CancelPayload returns the bytes a cosigner signs to cancel the proposal
+func (p Proposal) CancelPayload() []byte {
+	return []byte("cancel:" + p.ID)
+}
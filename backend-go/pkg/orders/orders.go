@@ -0,0 +1,179 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"blockchain-wallet/pkg/jobs"
+)
+
+// Standing order statuses
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Run outcomes recorded for each execution
+const (
+	RunSuccess = "success"
+	RunFailed  = "failed"
+)
+
+// Order is a recurring transfer from a user's wallet to a fixed recipient
+type Order struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	SenderWalletID   string     `json:"sender_wallet_id"`
+	ReceiverWalletID string     `json:"receiver_wallet_id"`
+	Amount           int64      `json:"amount"`
+	Note             string     `json:"note"`
+	Schedule         string     `json:"schedule"`
+	NextRunAt        time.Time  `json:"next_run_at"`
+	EndDate          *time.Time `json:"end_date,omitempty"`
+	Status           string     `json:"status"`
+	LastRunAt        *time.Time `json:"last_run_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	FailureCount     int        `json:"failure_count"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Execution is one attempt at paying a standing order
+type Execution struct {
+	OrderID string    `json:"order_id"`
+	TxID    string    `json:"tx_id,omitempty"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	RunAt   time.Time `json:"run_at"`
+}
+
+// Store is the persistence needed to execute standing orders
+type Store interface {
+	GetDueStandingOrders(ctx context.Context, now time.Time) ([]Order, error)
+	RecordStandingOrderRun(ctx context.Context, exec Execution) error
+	AdvanceStandingOrder(ctx context.Context, exec Execution, nextRunAt time.Time, status string) error
+}
+
+// TransferFunc pays one occurrence of an order and returns the transaction ID
+type TransferFunc func(ctx context.Context, o Order) (string, error)
+
+// NotifyFunc is told about failed executions
+type NotifyFunc func(ctx context.Context, o Order, err error)
+
+// ErrEnded is returned by NextRun when the schedule has no occurrence before the end date
+var ErrEnded = errors.New("standing order has ended")
+
+// NextRun returns the first occurrence of schedule after t that falls on or
+// before end (if set)
+func NextRun(schedule string, t time.Time, end *time.Time) (time.Time, error) {
+	s, err := jobs.ParseCron(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := s.Next(t)
+	if next.IsZero() || (end != nil && next.After(*end)) {
+		return time.Time{}, ErrEnded
+	}
+	return next, nil
+}
+
+// Validate checks the user supplied fields of an order
+func Validate(o Order) error {
+	if o.ReceiverWalletID == "" {
+		return fmt.Errorf("receiver_wallet_id required")
+	}
+	if o.ReceiverWalletID == o.SenderWalletID {
+		return fmt.Errorf("cannot create a standing order to your own wallet")
+	}
+	if o.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if _, err := jobs.ParseCron(o.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	return nil
+}
+
+// Processor executes due standing orders. Its Run method is registered with
+// the job runner.
+type Processor struct {
+	store    Store
+	transfer TransferFunc
+	notify   NotifyFunc
+	clock    jobs.Clock
+}
+
+// NewProcessor creates a processor. notify may be nil.
+func NewProcessor(store Store, transfer TransferFunc, notify NotifyFunc, clock jobs.Clock) *Processor {
+	if clock == nil {
+		clock = jobs.SystemClock
+	}
+	return &Processor{store: store, transfer: transfer, notify: notify, clock: clock}
+}
+
+// Run pays every order whose next run time has passed. A failing transfer is
+// recorded and skipped until its next occurrence; it does not fail the job.
+// An order that cannot be stored is logged and the rest are still paid; the
+// job then reports the failure.
+func (p *Processor) Run(ctx context.Context) error {
+	now := p.clock.Now()
+	due, err := p.store.GetDueStandingOrders(ctx, now)
+	if err != nil {
+		return fmt.Errorf("fetch due standing orders: %w", err)
+	}
+
+	failed := 0
+	for _, o := range due {
+		if err := p.execute(ctx, o, now); err != nil {
+			failed++
+			log.Printf("Standing order %s: %v", o.ID, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d due standing orders could not be processed", failed, len(due))
+	}
+	return nil
+}
+
+// execute pays one occurrence of an order. The order is moved on to its
+// next occurrence before the transfer, so failing to store the outcome
+// afterwards cannot leave it due and pay it twice.
+func (p *Processor) execute(ctx context.Context, o Order, now time.Time) error {
+	// An order past its end date is closed without paying
+	if o.EndDate != nil && now.After(*o.EndDate) {
+		return p.store.AdvanceStandingOrder(ctx, Execution{OrderID: o.ID, RunAt: now}, o.NextRunAt, StatusCompleted)
+	}
+
+	status := StatusActive
+	next, err := NextRun(o.Schedule, now, o.EndDate)
+	if err == ErrEnded {
+		status = StatusCompleted
+		next = o.NextRunAt
+	} else if err != nil {
+		return err
+	}
+	if err := p.store.AdvanceStandingOrder(ctx, Execution{OrderID: o.ID, RunAt: now}, next, status); err != nil {
+		return fmt.Errorf("advance before paying: %w", err)
+	}
+
+	exec := Execution{OrderID: o.ID, RunAt: now, Status: RunSuccess}
+	txID, err := p.transfer(ctx, o)
+	if err != nil {
+		exec.Status = RunFailed
+		exec.Error = err.Error()
+		log.Printf("Standing order %s failed: %v", o.ID, err)
+		if p.notify != nil {
+			p.notify(ctx, o, err)
+		}
+	}
+	exec.TxID = txID
+
+	if err := p.store.RecordStandingOrderRun(ctx, exec); err != nil {
+		return fmt.Errorf("record run of paid order: %w", err)
+	}
+	return p.store.AdvanceStandingOrder(ctx, exec, next, status)
+}
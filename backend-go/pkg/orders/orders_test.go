@@ -0,0 +1,232 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time { return c.now }
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+type memStore struct {
+	orders   map[string]*Order
+	runs     []Execution
+	advances int
+
+	failRecord  map[string]bool // orders whose runs cannot be recorded
+	failAdvance map[string]bool // orders that cannot be moved on
+}
+
+func (m *memStore) GetDueStandingOrders(ctx context.Context, now time.Time) ([]Order, error) {
+	var due []Order
+	for _, o := range m.orders {
+		if o.Status == StatusActive && !o.NextRunAt.After(now) {
+			due = append(due, *o)
+		}
+	}
+	return due, nil
+}
+
+func (m *memStore) RecordStandingOrderRun(ctx context.Context, exec Execution) error {
+	if m.failRecord[exec.OrderID] {
+		return errors.New("disk full")
+	}
+	m.runs = append(m.runs, exec)
+	return nil
+}
+
+func (m *memStore) AdvanceStandingOrder(ctx context.Context, exec Execution, next time.Time, status string) error {
+	if m.failAdvance[exec.OrderID] {
+		return errors.New("disk full")
+	}
+	m.advances++
+	o := m.orders[exec.OrderID]
+	o.NextRunAt = next
+	o.Status = status
+	if exec.Status != "" {
+		t := exec.RunAt
+		o.LastRunAt = &t
+		o.LastError = exec.Error
+		if exec.Status == RunFailed {
+			o.FailureCount++
+		}
+	}
+	return nil
+}
+
+func TestProcessorPaysDueOrders(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := &memStore{orders: map[string]*Order{
+		"due": {ID: "due", SenderWalletID: "a", ReceiverWalletID: "b", Amount: 100,
+			Schedule: "@monthly", NextRunAt: now, Status: StatusActive},
+		"later": {ID: "later", SenderWalletID: "a", ReceiverWalletID: "c", Amount: 5,
+			Schedule: "@monthly", NextRunAt: now.Add(time.Hour), Status: StatusActive},
+		"paused": {ID: "paused", SenderWalletID: "a", ReceiverWalletID: "d", Amount: 5,
+			Schedule: "@monthly", NextRunAt: now, Status: StatusPaused},
+	}}
+
+	var paid []string
+	p := NewProcessor(store, func(ctx context.Context, o Order) (string, error) {
+		paid = append(paid, o.ID)
+		return "tx-" + o.ID, nil
+	}, nil, fixedClock{now})
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(paid) != 1 || paid[0] != "due" {
+		t.Fatalf("expected only the due order to be paid, got %v", paid)
+	}
+	if len(store.runs) != 1 || store.runs[0].TxID != "tx-due" || store.runs[0].Status != RunSuccess {
+		t.Fatalf("unexpected runs: %+v", store.runs)
+	}
+	want := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	if got := store.orders["due"].NextRunAt; !got.Equal(want) {
+		t.Errorf("next run = %s, want %s", got, want)
+	}
+	if store.orders["due"].Status != StatusActive {
+		t.Errorf("order should stay active, got %s", store.orders["due"].Status)
+	}
+}
+
+func TestProcessorRecordsAndNotifiesFailures(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := &memStore{orders: map[string]*Order{
+		"o1": {ID: "o1", SenderWalletID: "a", ReceiverWalletID: "b", Amount: 100,
+			Schedule: "@monthly", NextRunAt: now, Status: StatusActive},
+	}}
+
+	var notified error
+	p := NewProcessor(store,
+		func(ctx context.Context, o Order) (string, error) {
+			return "", errors.New("insufficient funds: have 10, need 100")
+		},
+		func(ctx context.Context, o Order, err error) { notified = err },
+		fixedClock{now},
+	)
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("a failed order must not fail the job: %v", err)
+	}
+	if notified == nil {
+		t.Fatal("failure was not notified")
+	}
+	if len(store.runs) != 1 || store.runs[0].Status != RunFailed {
+		t.Fatalf("failure not recorded: %+v", store.runs)
+	}
+	o := store.orders["o1"]
+	if o.FailureCount != 1 || o.LastError == "" {
+		t.Errorf("order not marked failed: %+v", o)
+	}
+	if !o.NextRunAt.After(now) {
+		t.Error("failed order should move on to its next occurrence")
+	}
+}
+
+func TestProcessorStorageFailures(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	order := func(id string) *Order {
+		return &Order{ID: id, SenderWalletID: "a", ReceiverWalletID: "b", Amount: 1,
+			Schedule: "@monthly", NextRunAt: now, Status: StatusActive}
+	}
+	store := &memStore{
+		orders:      map[string]*Order{"unrecorded": order("unrecorded"), "stuck": order("stuck"), "fine": order("fine")},
+		failRecord:  map[string]bool{"unrecorded": true},
+		failAdvance: map[string]bool{"stuck": true},
+	}
+
+	paid := map[string]int{}
+	p := NewProcessor(store, func(ctx context.Context, o Order) (string, error) {
+		paid[o.ID]++
+		return "tx-" + o.ID, nil
+	}, nil, fixedClock{now})
+
+	if err := p.Run(context.Background()); err == nil {
+		t.Fatal("storage failures should fail the job")
+	}
+	// The job is retried at the same time; nothing may be paid twice
+	if err := p.Run(context.Background()); err == nil {
+		t.Fatal("the stuck order should still fail")
+	}
+
+	if paid["fine"] != 1 {
+		t.Errorf("an order after a failing one was paid %d times, want 1", paid["fine"])
+	}
+	if paid["unrecorded"] != 1 {
+		t.Errorf("an order whose run was not recorded was paid %d times, want 1", paid["unrecorded"])
+	}
+	if paid["stuck"] != 0 {
+		t.Errorf("an order that could not be moved on was paid %d times, want 0", paid["stuck"])
+	}
+}
+
+func TestProcessorCompletesAtEndDate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	expired := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	store := &memStore{orders: map[string]*Order{
+		"last": {ID: "last", SenderWalletID: "a", ReceiverWalletID: "b", Amount: 1,
+			Schedule: "@monthly", NextRunAt: now, EndDate: &end, Status: StatusActive},
+		"expired": {ID: "expired", SenderWalletID: "a", ReceiverWalletID: "b", Amount: 1,
+			Schedule: "@monthly", NextRunAt: now, EndDate: &expired, Status: StatusActive},
+	}}
+
+	var paid []string
+	p := NewProcessor(store, func(ctx context.Context, o Order) (string, error) {
+		paid = append(paid, o.ID)
+		return "tx", nil
+	}, nil, fixedClock{now})
+
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(paid) != 1 || paid[0] != "last" {
+		t.Fatalf("only the final occurrence should be paid, got %v", paid)
+	}
+	for id, o := range store.orders {
+		if o.Status != StatusCompleted {
+			t.Errorf("order %s should be completed, got %s", id, o.Status)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := Order{SenderWalletID: "a", ReceiverWalletID: "b", Amount: 1, Schedule: "0 9 1 * *"}
+	if err := Validate(ok); err != nil {
+		t.Fatalf("valid order rejected: %v", err)
+	}
+
+	bad := []Order{
+		{SenderWalletID: "a", Amount: 1, Schedule: "@monthly"},
+		{SenderWalletID: "a", ReceiverWalletID: "a", Amount: 1, Schedule: "@monthly"},
+		{SenderWalletID: "a", ReceiverWalletID: "b", Amount: 0, Schedule: "@monthly"},
+		{SenderWalletID: "a", ReceiverWalletID: "b", Amount: 1, Schedule: "whenever"},
+	}
+	for i, o := range bad {
+		if err := Validate(o); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+func TestNextRunHonoursEndDate(t *testing.T) {
+	from := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	next, err := NextRun("@monthly", from, &end)
+	if err != nil || !next.Equal(end) {
+		t.Fatalf("expected %s, got %s (%v)", end, next, err)
+	}
+	if _, err := NextRun("@monthly", end, &end); err != ErrEnded {
+		t.Fatalf("expected ErrEnded, got %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+// Package psbt is a portable partially signed transaction, in the spirit of
+// Bitcoin's PSBT. A watch-only server builds a Packet listing the inputs,
+// outputs, fee and signing policy of a transfer; offline signers add their
+// signatures; and once enough are present it is finalized into a
+// transaction for /tx/submit. Packets travel as JSON or as base64 of the
+// JSON, so they can be carried to an air-gapped machine as a file.
+package psbt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+// Version is the packet format version
+const Version = 1
+
+var (
+	// ErrIncomplete is returned when finalizing a packet that lacks
+	// signatures
+	ErrIncomplete = errors.New("packet is not fully signed")
+	// ErrNotSigner is returned when a key that cannot authorise the spend
+	// signs
+	ErrNotSigner = errors.New("key cannot sign for this sender")
+)
+
+// Input is an output the transaction spends
+type Input struct {
+	UTXOID string `json:"utxo_id"`
+	Owner  string `json:"owner"`
+	Amount int64  `json:"amount"`
+	Asset  string `json:"asset,omitempty"`
+}
+
+// Output is an output the transaction creates, with the ID it will have
+type Output struct {
+	UTXOID string     `json:"utxo_id"`
+	Owner  string     `json:"owner"`
+	Amount int64      `json:"amount"`
+	Asset  string     `json:"asset,omitempty"`
+	Lock   *utxo.Lock `json:"lock,omitempty"`
+}
+
+// Packet is an unsigned or partially signed transfer
+type Packet struct {
+	Version    int        `json:"version"`
+	TxID       string     `json:"txid"`
+	SenderID   string     `json:"sender_id"`
+	ReceiverID string     `json:"receiver_id"`
+	Amount     int64      `json:"amount"`
+	Asset      string     `json:"asset,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	Timestamp  int64      `json:"timestamp"`
+	Lock       *utxo.Lock `json:"lock,omitempty"`
+	Inputs     []Input    `json:"inputs"`
+	Outputs    []Output   `json:"outputs"`
+	Fee        int64      `json:"fee"` // inputs less outputs; always 0 on this chain
+	// Payload is what each signer signs: the transaction's signature hash
+	// (tx.Transaction.SigHash). It covers the inputs and the timestamp as
+	// well as the transfer, so a signature cannot be moved to another packet.
+	Payload []byte `json:"payload"`
+	// Policy is the spending rule when the sender is a multisig address
+	Policy     *multisig.Policy     `json:"policy,omitempty"`
+	Signatures []multisig.Signature `json:"signatures,omitempty"`
+	// Meta carries free-form details such as who built the packet and when
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// New builds an unsigned packet for t spending inputs. policy is required
+// when the sender is a multisig address and must be nil otherwise.
+func New(t *tx.Transaction, inputs []*utxo.UTXO, policy *multisig.Policy) (*Packet, error) {
+	p := &Packet{
+		Version:    Version,
+		TxID:       t.ID,
+		SenderID:   t.SenderID,
+		ReceiverID: t.ReceiverID,
+		Amount:     t.Amount,
+		Asset:      t.Asset,
+		Note:       t.Note,
+		Timestamp:  t.Timestamp,
+		Lock:       t.Lock,
+		Payload:    t.SigHash(),
+		Policy:     policy,
+	}
+	var total int64
+	for _, u := range inputs {
+		p.Inputs = append(p.Inputs, Input{UTXOID: u.ID, Owner: u.Owner, Amount: u.Amount, Asset: u.Asset})
+		if u.Asset == t.Asset {
+			total += u.Amount
+		}
+	}
+	for _, o := range t.Outputs(total) {
+		p.Outputs = append(p.Outputs, Output{UTXOID: o.ID, Owner: o.Owner, Amount: o.Amount, Asset: o.Asset, Lock: o.Lock})
+	}
+	p.Fee = p.inputTotal() - p.outputTotal()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Transaction returns the unsigned transaction the packet describes
+func (p *Packet) Transaction() *tx.Transaction {
+	t := &tx.Transaction{
+		SenderID:   p.SenderID,
+		ReceiverID: p.ReceiverID,
+		Amount:     p.Amount,
+		Timestamp:  p.Timestamp,
+		Note:       p.Note,
+		Lock:       p.Lock,
+		Asset:      p.Asset,
+	}
+	for _, in := range p.Inputs {
+		t.InputUTXOs = append(t.InputUTXOs, in.UTXOID)
+	}
+	t.ID = t.ComputeID()
+	return t
+}
+
+func (p *Packet) inputTotal() int64 {
+	var sum int64
+	for _, in := range p.Inputs {
+		sum += in.Amount
+	}
+	return sum
+}
+
+func (p *Packet) outputTotal() int64 {
+	var sum int64
+	for _, o := range p.Outputs {
+		sum += o.Amount
+	}
+	return sum
+}
+
+// Validate checks that the packet is self-consistent: the ID, payload and
+// outputs follow from the transaction it describes, every asset is
+// conserved, and the policy matches the sender. Signatures are not checked.
+func (p *Packet) Validate() error {
+	if p.Version != Version {
+		return fmt.Errorf("unsupported packet version %d", p.Version)
+	}
+	if len(p.Inputs) == 0 {
+		return errors.New("packet has no inputs")
+	}
+	if p.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	t := p.Transaction()
+	if t.ID != p.TxID {
+		return errors.New("txid does not match the transaction")
+	}
+	if !bytes.Equal(t.SigHash(), p.Payload) {
+		return errors.New("payload does not match the transaction")
+	}
+
+	ins := make([]*utxo.UTXO, len(p.Inputs))
+	var total int64
+	for i, in := range p.Inputs {
+		if in.Owner != p.SenderID {
+			return fmt.Errorf("input %s is not the sender's", in.UTXOID)
+		}
+		ins[i] = &utxo.UTXO{ID: in.UTXOID, Owner: in.Owner, Amount: in.Amount, Asset: in.Asset}
+		if in.Asset == p.Asset {
+			total += in.Amount
+		}
+	}
+	want := t.Outputs(total)
+	if len(want) != len(p.Outputs) {
+		return errors.New("outputs do not match the transaction")
+	}
+	for i, o := range want {
+		got := p.Outputs[i]
+		if got.UTXOID != o.ID || got.Owner != o.Owner || got.Amount != o.Amount || got.Asset != o.Asset || !reflect.DeepEqual(got.Lock, o.Lock) {
+			return fmt.Errorf("output %d does not match the transaction", i)
+		}
+	}
+	if err := tx.CheckConservation(ins, want); err != nil {
+		return err
+	}
+	if p.Fee != p.inputTotal()-p.outputTotal() {
+		return errors.New("fee does not match inputs less outputs")
+	}
+
+	if multisig.IsAddress(p.SenderID) {
+		if p.Policy == nil {
+			return errors.New("multisig sender requires a policy")
+		}
+		if p.Policy.Address() != p.SenderID {
+			return multisig.ErrAddressMismatch
+		}
+	} else if p.Policy != nil {
+		return errors.New("policy given for a single-key sender")
+	}
+	return nil
+}
+
+// canSign reports whether pub may sign for the sender
+func (p *Packet) canSign(pub ed25519.PublicKey) bool {
+	if p.Policy != nil {
+		return p.Policy.HasKey(pub)
+	}
+	return crypto.WalletIDFromPub(pub) == p.SenderID
+}
+
+// AddSignature adds a signature by a key that may sign for the sender,
+// replacing any earlier one by the same key
+func (p *Packet) AddSignature(s multisig.Signature) error {
+	if !p.canSign(s.PublicKey) {
+		return ErrNotSigner
+	}
+	if !crypto.VerifySignature(s.PublicKey, p.Payload, s.Signature) {
+		return multisig.ErrBadSignature
+	}
+	for i, existing := range p.Signatures {
+		if existing.PublicKey.Equal(s.PublicKey) {
+			p.Signatures[i] = s
+			return nil
+		}
+	}
+	p.Signatures = append(p.Signatures, s)
+	return nil
+}
+
+// Sign validates the packet and signs it with priv
+func (p *Packet) Sign(priv ed25519.PrivateKey) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	return p.AddSignature(multisig.Signature{PublicKey: pub, Signature: crypto.SignPayload(priv, p.Payload)})
+}
+
+// Combine merges the signatures of other copies of the same packet, as
+// when cosigners sign in parallel
+func (p *Packet) Combine(others ...*Packet) error {
+	for _, o := range others {
+		if o.TxID != p.TxID {
+			return fmt.Errorf("cannot combine packets for different transactions (%s)", o.TxID)
+		}
+		for _, s := range o.Signatures {
+			if err := p.AddSignature(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Required is the number of signatures the packet needs
+func (p *Packet) Required() int {
+	if p.Policy != nil {
+		return p.Policy.Threshold
+	}
+	return 1
+}
+
+// Complete reports whether the packet holds enough valid signatures
+func (p *Packet) Complete() bool {
+	valid := 0
+	for _, s := range p.Signatures {
+		if p.canSign(s.PublicKey) && crypto.VerifySignature(s.PublicKey, p.Payload, s.Signature) {
+			valid++
+		}
+	}
+	return valid >= p.Required()
+}
+
+// Finalize returns the signed transaction, ready for /tx/submit
+func (p *Packet) Finalize() (*tx.Transaction, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if !p.Complete() {
+		return nil, fmt.Errorf("%w: have %d of %d signatures", ErrIncomplete, len(p.Signatures), p.Required())
+	}
+	t := p.Transaction()
+	if p.Policy != nil {
+		t.SenderPub = p.Policy.Encode()
+		t.Signature = multisig.EncodeWitness(p.Signatures)
+		if err := multisig.VerifyTransaction(t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	t.SenderPub = p.Signatures[0].PublicKey
+	t.Signature = p.Signatures[0].Signature
+	if err := t.VerifySigHashSigner(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Encode returns the packet as base64 of its JSON
+func (p *Packet) Encode() (string, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Decode parses a packet given as JSON or as base64 of the JSON
+func Decode(data []byte) (*Packet, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' {
+		raw, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("packet is neither JSON nor base64: %w", err)
+		}
+		data = raw
+	}
+	var p Packet
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse packet: %w", err)
+	}
+	return &p, nil
+}
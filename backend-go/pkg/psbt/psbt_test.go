@@ -0,0 +1,196 @@
+package psbt
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/multisig"
+	"blockchain-wallet/pkg/tx"
+	"blockchain-wallet/pkg/utxo"
+)
+
+func newPacket(t *testing.T, sender string, policy *multisig.Policy) *Packet {
+	t.Helper()
+	inputs := []*utxo.UTXO{
+		{ID: "u1", Owner: sender, Amount: 70},
+		{ID: "u2", Owner: sender, Amount: 40},
+	}
+	txx := tx.NewTransaction(sender, "wallet-b", 100, "rent", []string{"u1", "u2"})
+	p, err := New(txx, inputs, policy)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func TestSingleKeyRoundTrip(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	p := newPacket(t, crypto.WalletIDFromPub(pub), nil)
+	if len(p.Outputs) != 2 || p.Outputs[1].Amount != 10 || p.Fee != 0 {
+		t.Fatalf("unexpected outputs %+v, fee %d", p.Outputs, p.Fee)
+	}
+	if _, err := p.Finalize(); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("finalizing an unsigned packet: %v", err)
+	}
+
+	// Carried offline as base64, signed, and carried back as JSON
+	enc, err := p.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := Decode([]byte(enc + "\n"))
+	if err != nil {
+		t.Fatalf("Decode base64: %v", err)
+	}
+	if err := offline.Sign(priv); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	enc, _ = offline.Encode()
+	back, _ := Decode([]byte(enc))
+
+	signed, err := back.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if signed.ID != p.TxID || len(signed.InputUTXOs) != 2 {
+		t.Errorf("finalized transaction %s, want %s", signed.ID, p.TxID)
+	}
+	if err := signed.VerifySigHashSigner(); err != nil {
+		t.Errorf("finalized transaction does not verify: %v", err)
+	}
+}
+
+func TestSignRejectsOtherKeys(t *testing.T) {
+	_, pub, _ := crypto.GenerateKeypair()
+	otherPriv, _, _ := crypto.GenerateKeypair()
+	p := newPacket(t, crypto.WalletIDFromPub(pub), nil)
+	if err := p.Sign(otherPriv); !errors.Is(err, ErrNotSigner) {
+		t.Fatalf("signing with another wallet's key: %v", err)
+	}
+}
+
+func TestMultisigCombine(t *testing.T) {
+	var privs []ed25519.PrivateKey
+	var pubs []ed25519.PublicKey
+	for i := 0; i < 3; i++ {
+		priv, pub, _ := crypto.GenerateKeypair()
+		privs, pubs = append(privs, priv), append(pubs, pub)
+	}
+	policy, err := multisig.NewPolicy(2, pubs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPacket(t, policy.Address(), &policy)
+
+	// Two cosigners sign their own copies in parallel
+	enc, _ := p.Encode()
+	a, _ := Decode([]byte(enc))
+	b, _ := Decode([]byte(enc))
+	if err := a.Sign(privs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Sign(privs[2]); err != nil {
+		t.Fatal(err)
+	}
+	if a.Complete() {
+		t.Fatal("one of two signatures should not be complete")
+	}
+	if err := a.Combine(b, b); err != nil {
+		t.Fatalf("Combine: %v", err)
+	}
+	if len(a.Signatures) != 2 || !a.Complete() {
+		t.Fatalf("combined packet has %d signatures", len(a.Signatures))
+	}
+	signed, err := a.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if err := multisig.VerifyTransaction(signed); err != nil {
+		t.Errorf("finalized multisig transaction does not verify: %v", err)
+	}
+
+	outsiderPriv, _, _ := crypto.GenerateKeypair()
+	if err := p.Sign(outsiderPriv); !errors.Is(err, ErrNotSigner) {
+		t.Errorf("outsider signature: %v", err)
+	}
+	other := newPacket(t, policy.Address(), &policy)
+	other.Amount = 90
+	other.TxID = other.Transaction().ID
+	if err := a.Combine(other); err == nil {
+		t.Error("combining packets for different transactions should fail")
+	}
+}
+
+func TestSignatureCannotBeReplayed(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	sender := crypto.WalletIDFromPub(pub)
+	p := newPacket(t, sender, nil)
+	if err := p.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	sig := p.Signatures[0]
+
+	// The same transfer from other inputs, or at another time, needs a new
+	// signature
+	inputs := []*utxo.UTXO{{ID: "u3", Owner: sender, Amount: 110}}
+	moved, err := New(tx.NewTransaction(sender, "wallet-b", 100, "rent", []string{"u3"}), inputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := newPacket(t, sender, nil)
+	later.Timestamp = p.Timestamp + 60
+	later.TxID = later.Transaction().ID
+	later.Payload = later.Transaction().SigHash()
+	for name, other := range map[string]*Packet{"other inputs": moved, "other timestamp": later} {
+		if err := other.AddSignature(sig); !errors.Is(err, multisig.ErrBadSignature) {
+			t.Errorf("%s: replayed signature: %v", name, err)
+		}
+		other.Signatures = []multisig.Signature{sig}
+		if _, err := other.Finalize(); err == nil {
+			t.Errorf("%s: packet with a replayed signature finalized", name)
+		}
+	}
+
+	// A signature over the transfer alone does not cover the inputs
+	q := newPacket(t, sender, nil)
+	bare := multisig.Signature{PublicKey: pub, Signature: crypto.SignPayload(priv, q.Transaction().Payload())}
+	if err := q.AddSignature(bare); !errors.Is(err, multisig.ErrBadSignature) {
+		t.Errorf("payload signature accepted: %v", err)
+	}
+}
+
+func TestValidateCatchesTampering(t *testing.T) {
+	_, pub, _ := crypto.GenerateKeypair()
+	sender := crypto.WalletIDFromPub(pub)
+	policy, _ := multisig.NewPolicy(1, []ed25519.PublicKey{pub})
+
+	cases := map[string]func(p *Packet){
+		"amount":         func(p *Packet) { p.Amount = 105 },
+		"change output":  func(p *Packet) { p.Outputs[1].Owner = "wallet-x" },
+		"extra output":   func(p *Packet) { p.Outputs = append(p.Outputs, Output{Owner: "wallet-x", Amount: 1}) },
+		"input amount":   func(p *Packet) { p.Inputs[0].Amount = 80 },
+		"foreign input":  func(p *Packet) { p.Inputs[1].Owner = "wallet-x" },
+		"fee":            func(p *Packet) { p.Fee = 5 },
+		"payload":        func(p *Packet) { p.Payload = []byte("pay me") },
+		"version":        func(p *Packet) { p.Version = 2 },
+		"stray policy":   func(p *Packet) { p.Policy = &policy },
+		"token as coins": func(p *Packet) { p.Inputs[1].Asset = "pts" },
+	}
+	for name, mutate := range cases {
+		p := newPacket(t, sender, nil)
+		mutate(p)
+		if p.Validate() == nil {
+			t.Errorf("%s: tampering not detected", name)
+		}
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	for _, in := range []string{"not base64!", "bm90IGpzb24=", "{"} {
+		if _, err := Decode([]byte(in)); err == nil {
+			t.Errorf("Decode(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package recovery describes social key recovery. A wallet's seed is split
+// into Shamir shares (see crypto.SplitSecret) that are handed to guardians
+// or printed. If the owner loses access, a recovery request collects shares
+// back until there are enough to rebuild the key, which is then sealed
+// under a new password.
+package recovery
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Request states
+const (
+	StatusOpen      = "open"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"  // the shares did not rebuild the wallet key
+	StatusExpired   = "expired" // open, but past its deadline
+)
+
+// MaxShares bounds how many shares a setup hands out
+const MaxShares = 16
+
+// RequestLifetime is how long a recovery request collects shares
+const RequestLifetime = 24 * time.Hour
+
+// Guardian is someone trusted with one share
+type Guardian struct {
+	Index int    `json:"index"` // the share they hold
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// Setup is the current split of a wallet's seed. A new setup replaces the
+// old one, whose shares are then refused.
+type Setup struct {
+	SetID     string     `json:"set_id"` // crypto.Share.Set of the shares
+	WalletID  string     `json:"wallet_id"`
+	Threshold int        `json:"threshold"`
+	Shares    int        `json:"shares"`
+	Guardians []Guardian `json:"guardians"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Validate checks the split parameters and guardians. Shares without a
+// guardian are for the owner to print.
+func (s Setup) Validate() error {
+	if s.Shares < 2 || s.Shares > MaxShares {
+		return fmt.Errorf("shares must be between 2 and %d", MaxShares)
+	}
+	if s.Threshold < 2 || s.Threshold > s.Shares {
+		return errors.New("threshold must be at least 2 and at most the number of shares")
+	}
+	if len(s.Guardians) > s.Shares {
+		return errors.New("more guardians than shares")
+	}
+	seen := map[int]bool{}
+	for _, g := range s.Guardians {
+		if g.Index < 1 || g.Index > s.Shares || seen[g.Index] {
+			return fmt.Errorf("guardian %q has an invalid share index", g.Name)
+		}
+		seen[g.Index] = true
+		if strings.TrimSpace(g.Name) == "" {
+			return errors.New("every guardian needs a name")
+		}
+		if g.Email != "" {
+			if _, err := mail.ParseAddress(g.Email); err != nil {
+				return fmt.Errorf("guardian %q has an invalid email", g.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Request collects shares to recover a wallet
+type Request struct {
+	ID        string     `json:"request_id"`
+	WalletID  string     `json:"wallet_id"`
+	SetID     string     `json:"set_id"`
+	Threshold int        `json:"threshold"`
+	Status    string     `json:"status"`
+	Collected []int      `json:"collected"` // indexes of the shares received
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	// SecretHash is the SHA-256 of the secret returned to whoever opened
+	// the request; completing it needs that secret
+	SecretHash []byte `json:"-"`
+}
+
+// State is the status as of now, so a lapsed request shows as expired
+func (r Request) State(now time.Time) string {
+	if r.Status == StatusOpen && !now.Before(r.ExpiresAt) {
+		return StatusExpired
+	}
+	return r.Status
+}
+
+// Ready reports whether enough shares are in to rebuild the key
+func (r Request) Ready() bool {
+	return len(r.Collected) >= r.Threshold
+}
+
+// Has reports whether share index was already received
+func (r Request) Has(index int) bool {
+	for _, i := range r.Collected {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random completion secret and its hash. Only the hash
+// is stored; the secret is shown once, to whoever opens the request.
+func NewSecret() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := hex.EncodeToString(b)
+	h := sha256.Sum256([]byte(secret))
+	return secret, h[:], nil
+}
+
+// CheckSecret reports whether secret is the one the request was opened
+// with. Requests stored without a hash never match.
+func (r Request) CheckSecret(secret string) bool {
+	if len(r.SecretHash) != sha256.Size || secret == "" {
+		return false
+	}
+	h := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(h[:], r.SecretHash) == 1
+}
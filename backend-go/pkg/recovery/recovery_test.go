@@ -0,0 +1,71 @@
+package recovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetupValidate(t *testing.T) {
+	ok := Setup{Threshold: 2, Shares: 3, Guardians: []Guardian{
+		{Index: 1, Name: "Ayesha", Email: "ayesha@example.com"},
+		{Index: 3, Name: "Bilal"},
+	}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("valid setup rejected: %v", err)
+	}
+
+	bad := map[string]Setup{
+		"one share":       {Threshold: 1, Shares: 1},
+		"threshold high":  {Threshold: 4, Shares: 3},
+		"too many shares": {Threshold: 2, Shares: MaxShares + 1},
+		"index zero":      {Threshold: 2, Shares: 3, Guardians: []Guardian{{Index: 0, Name: "a"}}},
+		"index repeated":  {Threshold: 2, Shares: 3, Guardians: []Guardian{{Index: 1, Name: "a"}, {Index: 1, Name: "b"}}},
+		"no name":         {Threshold: 2, Shares: 3, Guardians: []Guardian{{Index: 1}}},
+		"bad email":       {Threshold: 2, Shares: 3, Guardians: []Guardian{{Index: 1, Name: "a", Email: "nope"}}},
+	}
+	for name, s := range bad {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRequestState(t *testing.T) {
+	now := time.Now()
+	r := Request{Status: StatusOpen, Threshold: 2, Collected: []int{3}, ExpiresAt: now.Add(time.Hour)}
+	if got := r.State(now); got != StatusOpen {
+		t.Fatalf("State = %s, want open", got)
+	}
+	if got := r.State(now.Add(2 * time.Hour)); got != StatusExpired {
+		t.Fatalf("State after deadline = %s, want expired", got)
+	}
+	if r.Ready() || !r.Has(3) || r.Has(1) {
+		t.Fatalf("Ready/Has wrong for %v", r.Collected)
+	}
+	r.Collected = append(r.Collected, 1)
+	if !r.Ready() {
+		t.Fatal("two of two shares not ready")
+	}
+	r.Status = StatusCompleted
+	if got := r.State(now.Add(2 * time.Hour)); got != StatusCompleted {
+		t.Fatalf("closed request State = %s", got)
+	}
+}
+
+func TestRequestSecret(t *testing.T) {
+	secret, hash, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Request{SecretHash: hash}
+	if !r.CheckSecret(secret) {
+		t.Fatal("request refused its own secret")
+	}
+	other, _, _ := NewSecret()
+	if r.CheckSecret(other) || r.CheckSecret("") {
+		t.Fatal("request accepted another secret")
+	}
+	if (Request{}).CheckSecret("") {
+		t.Fatal("request without a hash accepted an empty secret")
+	}
+}
@@ -0,0 +1,101 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatPDF  = "pdf"
+)
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "application/json"
+}
+
+// Filename suggests a download name for a statement
+func Filename(st *Statement, format string) string {
+	id := st.WalletID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return fmt.Sprintf("statement-%s-%s-%s.%s", id, st.From.Format("20060102"), st.To.Format("20060102"), format)
+}
+
+// Write encodes a signed statement in the given format
+func Write(w io.Writer, signed *Signed, format string) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, signed)
+	case FormatCSV:
+		return WriteCSV(w, signed)
+	case FormatPDF:
+		return WritePDF(w, signed)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// WriteJSON writes the signed statement as JSON; it can be posted back for
+// verification as is
+func WriteJSON(w io.Writer, signed *Signed) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(signed)
+}
+
+// WriteCSV writes the statement lines between a summary header and the
+// signature trailer
+func WriteCSV(w io.Writer, signed *Signed) error {
+	st := signed.Statement
+	cw := csv.NewWriter(w)
+	n := strconv.FormatInt
+
+	rows := [][]string{
+		{"wallet_id", st.WalletID},
+		{"from", st.From.Format(time.RFC3339Nano)},
+		{"to", st.To.Format(time.RFC3339Nano)},
+		{"generated_at", st.GeneratedAt.Format(time.RFC3339Nano)},
+		{"opening_balance", n(st.OpeningBalance, 10)},
+		{},
+		{"date", "tx_id", "kind", "counterparty", "description", "credit", "debit", "fee", "balance"},
+	}
+	for _, l := range st.Lines {
+		rows = append(rows, []string{
+			l.Date.Format(time.RFC3339Nano), l.TxID, l.Kind, l.Counterparty, l.Description,
+			n(l.Credit, 10), n(l.Debit, 10), n(l.Fee, 10), n(l.Balance, 10),
+		})
+	}
+	rows = append(rows,
+		[]string{},
+		[]string{"total_credits", n(st.TotalCredits, 10)},
+		[]string{"total_debits", n(st.TotalDebits, 10)},
+		[]string{"total_fees", n(st.TotalFees, 10)},
+		[]string{"zakat_paid", n(st.ZakatPaid, 10)},
+		[]string{"closing_balance", n(st.ClosingBalance, 10)},
+		[]string{"utxo_balance", n(st.UTXOBalance, 10)},
+		[]string{"reconciled", strconv.FormatBool(st.Reconciled)},
+		[]string{},
+		[]string{"digest", signed.Digest},
+		[]string{"algorithm", signed.Algorithm},
+		[]string{"public_key", signed.PublicKey},
+		[]string{"signature", signed.Signature},
+	)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
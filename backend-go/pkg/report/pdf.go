@@ -0,0 +1,159 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Page layout for the generated PDF: A4 in points, monospaced 8pt text
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 8
+	pdfLeading      = 11
+	pdfLinesPerPage = (pdfPageHeight-2*pdfMargin)/pdfLeading - 2 // room for the footer
+)
+
+// WritePDF renders the signed statement as a plain, text-only PDF document
+func WritePDF(w io.Writer, signed *Signed) error {
+	pages := paginate(statementText(signed), pdfLinesPerPage)
+
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	// Objects 1-3 are the catalog, page tree and font; each page then takes
+	// two objects, the page and its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		stream := pageStream(lines, footer)
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func pageStream(lines []string, footer string) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+	for _, l := range lines {
+		fmt.Fprintf(&s, "(%s) Tj T*\n", pdfEscape(l))
+	}
+	s.WriteString("ET\n")
+	fmt.Fprintf(&s, "BT /F1 %d Tf %d %d Td (%s) Tj ET", pdfFontSize, pdfMargin, pdfMargin-pdfLeading, pdfEscape(footer))
+	return s.String()
+}
+
+func paginate(lines []string, perPage int) [][]string {
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	return append(pages, lines)
+}
+
+// pdfEscape makes s safe inside a PDF literal string. Only printable ASCII
+// is kept since the standard fonts carry no other glyphs reliably.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// statementText lays the statement out as fixed-width lines
+func statementText(signed *Signed) []string {
+	st := signed.Statement
+	const dateFmt = "2006-01-02 15:04"
+	row := "%-16s  %-12s  %-33s %10s %10s %6s %11s"
+
+	lines := []string{
+		"ACCOUNT STATEMENT",
+		"",
+		"Wallet:          " + st.WalletID,
+		"Period:          " + st.From.Format(time.RFC3339) + " to " + st.To.Format(time.RFC3339),
+		"Generated:       " + st.GeneratedAt.Format(time.RFC3339),
+		fmt.Sprintf("Opening balance: %d", st.OpeningBalance),
+		"",
+		fmt.Sprintf(row, "Date", "Kind", "Description", "Credit", "Debit", "Fee", "Balance"),
+		strings.Repeat("-", 106),
+	}
+	for _, l := range st.Lines {
+		lines = append(lines, fmt.Sprintf(row,
+			l.Date.Format(dateFmt), l.Kind, truncate(l.Description, 33),
+			amount(l.Credit), amount(l.Debit), amount(l.Fee), fmt.Sprint(l.Balance)))
+	}
+	if len(st.Lines) == 0 {
+		lines = append(lines, "No transactions in this period.")
+	}
+
+	reconciled := "yes"
+	if !st.Reconciled {
+		reconciled = fmt.Sprintf("NO (UTXO balance %d)", st.UTXOBalance)
+	}
+	return append(lines,
+		strings.Repeat("-", 106),
+		fmt.Sprintf("Total credits:   %d", st.TotalCredits),
+		fmt.Sprintf("Total debits:    %d", st.TotalDebits),
+		fmt.Sprintf("Fees:            %d", st.TotalFees),
+		fmt.Sprintf("Zakat paid:      %d", st.ZakatPaid),
+		fmt.Sprintf("Closing balance: %d", st.ClosingBalance),
+		"Matches UTXOs:   "+reconciled,
+		"",
+		"This statement is signed by the server. Verify it by posting the JSON",
+		"export to /reports/verify.",
+		"Digest (SHA-256): "+signed.Digest,
+		"Public key:       "+signed.PublicKey,
+		"Signature:        "+signed.Signature,
+	)
+}
+
+func amount(v int64) string {
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
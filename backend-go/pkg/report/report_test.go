@@ -0,0 +1,189 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memSource struct {
+	moves []Movement
+	utxo  int64
+}
+
+func (m *memSource) WalletMovements(ctx context.Context, walletID string, before time.Time) ([]Movement, error) {
+	var out []Movement
+	for _, mv := range m.moves {
+		if mv.At.Before(before) {
+			out = append(out, mv)
+		}
+	}
+	return out, nil
+}
+
+func (m *memSource) UTXOBalanceAt(ctx context.Context, walletID string, at time.Time) (int64, error) {
+	return m.utxo, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC)
+}
+
+func sampleSource() *memSource {
+	return &memSource{
+		utxo: 118,
+		moves: []Movement{
+			{At: day(10), TxID: "t3", Kind: KindTransferOut, Counterparty: "bob", Debit: 22, Fee: 2},
+			{At: day(1), TxID: "u1", Kind: KindDeposit, Credit: 100},
+			{At: day(5), TxID: "t1", Kind: KindTransferIn, Counterparty: "bob", Credit: 50},
+			{At: day(8), TxID: "t2", Kind: KindZakat, Counterparty: "zakat-pool", Note: "Monthly Zakat", Debit: 10},
+			{At: day(20), TxID: "t4", Kind: KindTransferIn, Counterparty: "carol", Credit: 999},
+		},
+	}
+}
+
+func TestBuildStatement(t *testing.T) {
+	st, err := Build(context.Background(), sampleSource(), "alice", day(3), day(15), day(16))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if st.OpeningBalance != 100 || st.ClosingBalance != 118 {
+		t.Errorf("opening %d, closing %d; want 100, 118", st.OpeningBalance, st.ClosingBalance)
+	}
+	wantBalances := []int64{150, 140, 118}
+	if len(st.Lines) != len(wantBalances) {
+		t.Fatalf("got %d lines, want %d", len(st.Lines), len(wantBalances))
+	}
+	for i, want := range wantBalances {
+		if st.Lines[i].Balance != want {
+			t.Errorf("line %d balance = %d, want %d", i, st.Lines[i].Balance, want)
+		}
+	}
+	if st.TotalCredits != 50 || st.TotalDebits != 32 || st.TotalFees != 2 || st.ZakatPaid != 10 {
+		t.Errorf("totals = %+v", st)
+	}
+	if st.Lines[2].Description != "Transfer to bob" || st.Lines[1].Description != "Monthly Zakat" {
+		t.Errorf("descriptions: %q, %q", st.Lines[2].Description, st.Lines[1].Description)
+	}
+	if !st.Reconciled {
+		t.Error("statement should reconcile with the UTXO balance")
+	}
+
+	// An empty period still carries the balance forward
+	empty, err := Build(context.Background(), sampleSource(), "alice", day(11), day(12), day(16))
+	if err != nil || empty.OpeningBalance != 118 || empty.ClosingBalance != 118 || len(empty.Lines) != 0 {
+		t.Errorf("empty period = %+v (%v)", empty, err)
+	}
+
+	if _, err := Build(context.Background(), sampleSource(), "alice", day(5), day(5), day(16)); err == nil {
+		t.Error("an empty range should be rejected")
+	}
+}
+
+func testSigner(t *testing.T) *Signer {
+	t.Helper()
+	s, err := NewSigner(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return s
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := testSigner(t)
+	st, _ := Build(context.Background(), sampleSource(), "alice", day(3), day(15), day(16))
+	signed, err := signer.Sign(st)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// The JSON export verifies after a round trip
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, signed); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var decoded Signed
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if err := Verify(&decoded, signer.PublicKey()); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	decoded.Statement.Lines[0].Credit = 5000
+	if err := Verify(&decoded, signer.PublicKey()); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered statement: err = %v", err)
+	}
+
+	other, _ := NewSigner(bytes.Repeat([]byte{8}, 32))
+	if err := Verify(signed, other.PublicKey()); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("wrong key: err = %v", err)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	st, _ := Build(context.Background(), sampleSource(), "alice", day(3), day(15), day(16))
+	signed, _ := testSigner(t).Sign(st)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, signed, FormatCSV); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"opening_balance,100",
+		"t3,transfer_out,bob,Transfer to bob,0,22,2,118",
+		"closing_balance,118",
+		"signature," + signed.Signature,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("CSV is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	src := sampleSource()
+	// Enough lines to need several pages
+	for i := 0; i < 150; i++ {
+		src.moves = append(src.moves, Movement{At: day(12), TxID: "n" + strconv.Itoa(i), Kind: KindDeposit, Credit: 1, Note: "Gift (with parentheses)"})
+	}
+	st, _ := Build(context.Background(), src, "alice", day(3), day(15), day(16))
+	signed, _ := testSigner(t).Sign(st)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, signed, FormatPDF); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("missing PDF header or trailer")
+	}
+	if !strings.Contains(pdf, "/Count 3") || !strings.Contains(pdf, `Gift \(with parentheses\)`) {
+		t.Error("unexpected page count or unescaped text")
+	}
+
+	// startxref must point at the xref table, and each entry at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(m[1])
+	if !strings.HasPrefix(pdf[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[1])
+		if want := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(pdf[off:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[off:off+10])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SignatureAlgorithm names the scheme used for statement signatures
+const SignatureAlgorithm = "ed25519"
+
+// ErrBadSignature is returned when a statement does not match its signature
+var ErrBadSignature = errors.New("statement signature is invalid")
+
+// Signed is a statement with the server's signature over its canonical JSON
+type Signed struct {
+	Statement *Statement `json:"statement"`
+	Digest    string     `json:"digest"` // hex SHA-256 of the canonical JSON
+	Algorithm string     `json:"algorithm"`
+	PublicKey string     `json:"public_key"` // base64
+	Signature string     `json:"signature"`  // base64
+}
+
+// Signer signs statements with the server key
+type Signer struct {
+	priv ed25519.PrivateKey
+}
+
+// NewSigner returns a signer for the Ed25519 key derived from seed
+func NewSigner(seed []byte) (*Signer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key seed must be %d bytes", ed25519.SeedSize)
+	}
+	return &Signer{priv: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the key that verifies this signer's statements
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.priv.Public().(ed25519.PublicKey)
+}
+
+// Sign signs st
+func (s *Signer) Sign(st *Statement) (*Signed, error) {
+	payload, err := canonical(st)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(payload)
+	return &Signed{
+		Statement: st,
+		Digest:    hex.EncodeToString(digest[:]),
+		Algorithm: SignatureAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(s.PublicKey()),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, payload)),
+	}, nil
+}
+
+// Verify checks the signature of a statement against the trusted key. The
+// public key embedded in signed is ignored; only pub is trusted.
+func Verify(signed *Signed, pub ed25519.PublicKey) error {
+	if signed == nil || signed.Statement == nil {
+		return fmt.Errorf("statement missing")
+	}
+	if signed.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", signed.Algorithm)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return ErrBadSignature
+	}
+	payload, err := canonical(signed.Statement)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(payload)
+	if hex.EncodeToString(digest[:]) != signed.Digest || !ed25519.Verify(pub, payload, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// canonical is the byte form of a statement that signatures cover
+func canonical(st *Statement) ([]byte, error) {
+	return json.Marshal(st)
+}
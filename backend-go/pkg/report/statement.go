@@ -0,0 +1,159 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Movement kinds
+const (
+	KindDeposit     = "deposit"
+	KindTransferIn  = "transfer_in"
+	KindTransferOut = "transfer_out"
+	KindZakat       = "zakat"
+)
+
+// Movement is one change to a wallet's funds as recorded in the ledger.
+// Credit and Debit are the gross amounts; Fee is part of Debit.
+type Movement struct {
+	At           time.Time
+	TxID         string
+	Kind         string
+	Counterparty string
+	Note         string
+	Credit       int64
+	Debit        int64
+	Fee          int64
+}
+
+// Source provides the ledger data a statement is built from
+type Source interface {
+	// WalletMovements returns every movement of the wallet before the given time
+	WalletMovements(ctx context.Context, walletID string, before time.Time) ([]Movement, error)
+	// UTXOBalanceAt sums the wallet's outputs that existed and were unspent at the given time
+	UTXOBalanceAt(ctx context.Context, walletID string, at time.Time) (int64, error)
+}
+
+// Line is a statement row with the balance after it
+type Line struct {
+	Date         time.Time `json:"date"`
+	TxID         string    `json:"tx_id"`
+	Kind         string    `json:"kind"`
+	Counterparty string    `json:"counterparty,omitempty"`
+	Description  string    `json:"description"`
+	Credit       int64     `json:"credit"`
+	Debit        int64     `json:"debit"`
+	Fee          int64     `json:"fee"`
+	Balance      int64     `json:"balance"`
+}
+
+// Statement is a wallet's account statement for [From, To)
+type Statement struct {
+	WalletID       string    `json:"wallet_id"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	GeneratedAt    time.Time `json:"generated_at"`
+	OpeningBalance int64     `json:"opening_balance"`
+	Lines          []Line    `json:"lines"`
+	TotalCredits   int64     `json:"total_credits"`
+	TotalDebits    int64     `json:"total_debits"`
+	TotalFees      int64     `json:"total_fees"`
+	ZakatPaid      int64     `json:"zakat_paid"`
+	ClosingBalance int64     `json:"closing_balance"`
+	UTXOBalance    int64     `json:"utxo_balance"`
+	Reconciled     bool      `json:"reconciled"`
+}
+
+// Build computes the statement of walletID for [from, to). Times are stored
+// in UTC at millisecond precision so that a statement survives a JSON round
+// trip byte for byte, which signature verification relies on.
+func Build(ctx context.Context, src Source, walletID string, from, to, now time.Time) (*Statement, error) {
+	if walletID == "" {
+		return nil, fmt.Errorf("wallet required")
+	}
+	from, to = normTime(from), normTime(to)
+	if !to.After(from) {
+		return nil, fmt.Errorf("period end must be after its start")
+	}
+
+	moves, err := src.WalletMovements(ctx, walletID, to)
+	if err != nil {
+		return nil, fmt.Errorf("load movements: %w", err)
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		if !moves[i].At.Equal(moves[j].At) {
+			return moves[i].At.Before(moves[j].At)
+		}
+		return moves[i].TxID < moves[j].TxID
+	})
+
+	s := &Statement{
+		WalletID:    walletID,
+		From:        from,
+		To:          to,
+		GeneratedAt: normTime(now),
+		Lines:       []Line{},
+	}
+	balance := int64(0)
+	for _, m := range moves {
+		if m.At.Before(from) {
+			balance += m.Credit - m.Debit
+			continue
+		}
+		if len(s.Lines) == 0 {
+			s.OpeningBalance = balance
+		}
+		balance += m.Credit - m.Debit
+		s.TotalCredits += m.Credit
+		s.TotalDebits += m.Debit
+		s.TotalFees += m.Fee
+		if m.Kind == KindZakat {
+			s.ZakatPaid += m.Debit
+		}
+		s.Lines = append(s.Lines, Line{
+			Date:         normTime(m.At),
+			TxID:         m.TxID,
+			Kind:         m.Kind,
+			Counterparty: m.Counterparty,
+			Description:  describe(m),
+			Credit:       m.Credit,
+			Debit:        m.Debit,
+			Fee:          m.Fee,
+			Balance:      balance,
+		})
+	}
+	if len(s.Lines) == 0 {
+		s.OpeningBalance = balance
+	}
+	s.ClosingBalance = balance
+
+	// Cross-check the transaction ledger against the UTXO set
+	if s.UTXOBalance, err = src.UTXOBalanceAt(ctx, walletID, to); err != nil {
+		return nil, fmt.Errorf("load utxo balance: %w", err)
+	}
+	s.Reconciled = s.UTXOBalance == s.ClosingBalance
+	return s, nil
+}
+
+func describe(m Movement) string {
+	if m.Note != "" {
+		return m.Note
+	}
+	switch m.Kind {
+	case KindDeposit:
+		return "Deposit"
+	case KindTransferIn:
+		return "Transfer from " + m.Counterparty
+	case KindTransferOut:
+		return "Transfer to " + m.Counterparty
+	case KindZakat:
+		return "Zakat"
+	}
+	return m.Kind
+}
+
+func normTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
@@ -2,174 +2,186 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"blockchain-wallet/pkg/asset"
 	"blockchain-wallet/pkg/blockchain"
 	"blockchain-wallet/pkg/db"
 	"blockchain-wallet/pkg/tx"
 	"blockchain-wallet/pkg/utxo"
 )
 
+// Store is the persistence the Zakat scheduler needs
+type Store interface {
+	db.WalletRepository
+	db.UTXORepository
+	db.BlockRepository
+	db.LogRepository
+	ApplyTransfer(ctx context.Context, t db.Transfer) error
+	GetZakatAssets(ctx context.Context) ([]asset.Asset, error)
+	GetAssetHolders(ctx context.Context, assetID string) (map[string]int64, error)
+}
+
 // ZakatScheduler handles monthly Zakat deductions
 type ZakatScheduler struct {
 	mu              sync.Mutex
-	running         bool
-	stopChan        chan struct{}
-	db              *db.Client
+	db              Store
 	bc              *blockchain.Blockchain
 	um              *utxo.Manager
 	zakatRate       float64 // 2.5% = 0.025
 	zakatPoolWallet string  // System wallet address for Zakat pool
 	lastRunTime     time.Time
+	onRun           func(context.Context, RunSummary)
+	transferMu      sync.Locker // held while a deduction selects and spends outputs
+}
+
+// RunSummary describes a completed Zakat pass
+type RunSummary struct {
+	At       time.Time
+	Deducted map[string]int64 // wallet ID -> Zakat charged
+	Total    int64
+	Block    *blockchain.Block // nil when nothing was deducted
+
+	// AssetDeducted is asset ID -> wallet ID -> Zakat charged in that asset
+	AssetDeducted map[string]map[string]int64
 }
 
 // NewZakatScheduler creates a new scheduler instance
-func NewZakatScheduler(dbClient *db.Client, bc *blockchain.Blockchain, um *utxo.Manager, zakatPoolWallet string) *ZakatScheduler {
+func NewZakatScheduler(dbClient Store, bc *blockchain.Blockchain, um *utxo.Manager, zakatPoolWallet string) *ZakatScheduler {
 	return &ZakatScheduler{
 		db:              dbClient,
 		bc:              bc,
 		um:              um,
 		zakatRate:       0.025, // 2.5%
 		zakatPoolWallet: zakatPoolWallet,
-		stopChan:        make(chan struct{}),
 		lastRunTime:     time.Now(),
 	}
 }
 
-// Start begins the scheduler in a background goroutine
-func (zs *ZakatScheduler) Start(ctx context.Context) {
-	zs.mu.Lock()
-	if zs.running {
-		zs.mu.Unlock()
-		return
+// Run performs one Zakat pass. It is registered with the job scheduler,
+// which decides when it fires and retries it on error.
+func (zs *ZakatScheduler) Run(ctx context.Context) error {
+	summary, err := zs.processMonthlyZakat(ctx)
+	if err != nil {
+		return err
 	}
-	zs.running = true
+	zs.mu.Lock()
+	zs.lastRunTime = time.Now()
+	summary.At = zs.lastRunTime
+	onRun := zs.onRun
 	zs.mu.Unlock()
-
-	go zs.run(ctx)
-	log.Println("✓ Zakat Scheduler started")
+	if onRun != nil {
+		onRun(ctx, summary)
+	}
+	return nil
 }
 
-// Stop gracefully stops the scheduler
-func (zs *ZakatScheduler) Stop() {
+// OnRun registers fn to be called after every successful Zakat pass
+func (zs *ZakatScheduler) OnRun(fn func(context.Context, RunSummary)) {
 	zs.mu.Lock()
-	if !zs.running {
-		zs.mu.Unlock()
-		return
-	}
-	zs.running = false
-	zs.mu.Unlock()
+	defer zs.mu.Unlock()
+	zs.onRun = fn
+}
 
-	close(zs.stopChan)
-	log.Println("Zakat Scheduler stopped")
+// SetTransferLock makes every deduction hold mu while it selects and spends
+// the wallet's outputs, so it cannot race a transfer spending the same ones
+func (zs *ZakatScheduler) SetTransferLock(mu sync.Locker) {
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+	zs.transferMu = mu
 }
 
-// run executes the scheduler loop (checks monthly)
-func (zs *ZakatScheduler) run(ctx context.Context) {
-	// Check every hour if a month has passed
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-zs.stopChan:
-			return
-		case <-ticker.C:
-			// Check if a month has passed since last run
-			if time.Since(zs.lastRunTime) >= 30*24*time.Hour {
-				zs.processMonthlyZakat(ctx)
-				zs.lastRunTime = time.Now()
-			}
-		}
-	}
+// zakatPeriod is the month a run charges Zakat for. A wallet is charged at
+// most once per period and asset, however often the job runs.
+func zakatPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
 }
 
 // processMonthlyZakat handles the monthly Zakat deduction for all wallets
-func (zs *ZakatScheduler) processMonthlyZakat(ctx context.Context) {
+func (zs *ZakatScheduler) processMonthlyZakat(ctx context.Context) (RunSummary, error) {
 	log.Println("⏰ Processing monthly Zakat deductions...")
+	summary := RunSummary{Deducted: map[string]int64{}, AssetDeducted: map[string]map[string]int64{}}
 
 	// If no database, skip processing
 	if zs.db == nil {
 		log.Println("  No database available, skipping Zakat processing")
-		return
+		return summary, nil
 	}
 
 	// Get all wallets from database
 	wallets, err := zs.db.GetAllWallets(ctx)
 	if err != nil {
-		log.Printf("Error fetching wallets: %v", err)
-		return
+		return summary, fmt.Errorf("fetch wallets: %w", err)
 	}
 
+	period := zakatPeriod(time.Now())
 	zakatTxIDs := []string{}
 	totalZakat := int64(0)
 
 	for _, wallet := range wallets {
 		// Skip system wallet (Zakat pool)
-		if wallet["wallet_id"] == zs.zakatPoolWallet {
+		if wallet.WalletID == zs.zakatPoolWallet {
 			continue
 		}
 
-		balance, ok := wallet["balance"].(int64)
-		if !ok {
-			continue
-		}
+		walletID := wallet.WalletID
 
-		// Calculate 2.5% Zakat
-		zakatAmount := int64(float64(balance) * zs.zakatRate)
-		if zakatAmount == 0 {
+		// Pay 2.5% of the spendable balance to the pool
+		zakatTx, zakatAmount, err := zs.deduct(ctx, walletID, "", period, func(balance int64) int64 {
+			return int64(float64(balance) * zs.zakatRate)
+		}, "Monthly Zakat deduction (2.5%)")
+		if errors.Is(err, db.ErrZakatDeducted) {
+			log.Printf("  Wallet %s already paid Zakat for %s", walletID, period)
 			continue
 		}
-
-		walletID, ok := wallet["wallet_id"].(string)
-		if !ok {
+		if err != nil {
+			log.Printf("  ✗ Zakat from wallet %s not deducted: %v", walletID, err)
 			continue
 		}
-
-		// Create Zakat transaction
-		zakatTx := &tx.Transaction{
-			SenderID:    walletID,
-			ReceiverID:  zs.zakatPoolWallet,
-			Amount:      zakatAmount,
-			Timestamp:   time.Now().Unix(),
-			Note:        "Monthly Zakat deduction (2.5%)",
+		if zakatTx == nil {
+			continue
 		}
 
-		// Compute transaction ID
-		zakatTx.ComputeID()
-
 		zakatTxIDs = append(zakatTxIDs, zakatTx.ID)
 		totalZakat += zakatAmount
+		summary.Deducted[walletID] = zakatAmount
 
 		// Log Zakat deduction
-		_ = zs.db.InsertLog(ctx, walletID, "zakat_deducted", fmt.Sprintf("Deducted %d coins as Zakat", zakatAmount), "success", "system")
+		_ = zs.db.InsertLog(ctx, walletID, db.ZakatDeductedAction, fmt.Sprintf("Deducted %d coins as Zakat", zakatAmount), "success", "system")
 
 		log.Printf("  → Deducted %d coins from wallet %s (2.5%% = %.2f%%)", zakatAmount, walletID[:16], zs.zakatRate*100)
 	}
 
+	assetTxIDs, err := zs.processAssetZakat(ctx, period, summary.AssetDeducted)
+	if err != nil {
+		return summary, err
+	}
+	zakatTxIDs = append(zakatTxIDs, assetTxIDs...)
+
 	if len(zakatTxIDs) == 0 {
 		log.Println("  No wallets eligible for Zakat this month")
-		return
+		return summary, nil
 	}
+	summary.Total = totalZakat
 
 	// Add Zakat transactions to pending pool
 	for _, txID := range zakatTxIDs {
 		zs.bc.AddPendingTransaction(txID)
 	}
 
-	log.Printf("  Total Zakat collected: %d coins from %d wallets", totalZakat, len(zakatTxIDs))
+	log.Printf("  Total Zakat collected: %d coins from %d wallets", totalZakat, len(summary.Deducted))
 
 	// Mine a block to confirm Zakat transactions
 	block, err := zs.bc.MinePendingTransactions(zs.zakatPoolWallet)
 	if err != nil {
-		log.Printf("Error mining Zakat block: %v", err)
-		return
+		return summary, fmt.Errorf("mine Zakat block: %w", err)
 	}
+	summary.Block = block
 	if block != nil {
 		log.Printf("  ✓ Zakat block mined: %s", block.Hash[:16])
 
@@ -186,13 +198,139 @@ func (zs *ZakatScheduler) processMonthlyZakat(ctx context.Context) {
 	}
 
 	log.Println("✓ Monthly Zakat processing complete")
+	return summary, nil
 }
 
-// TriggerZakatNow forces an immediate Zakat calculation (for testing)
-func (zs *ZakatScheduler) TriggerZakatNow(ctx context.Context) error {
-	zs.processMonthlyZakat(ctx)
-	zs.lastRunTime = time.Now()
-	return nil
+// processAssetZakat charges Zakat for the period on the holders of every
+// asset that sets a rate, at that asset's rate and in that asset, recording
+// the amounts in deducted. It returns the IDs of the Zakat transactions.
+func (zs *ZakatScheduler) processAssetZakat(ctx context.Context, period string, deducted map[string]map[string]int64) ([]string, error) {
+	assets, err := zs.db.GetZakatAssets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch assets: %w", err)
+	}
+
+	var txIDs []string
+	for _, a := range assets {
+		holders, err := zs.db.GetAssetHolders(ctx, a.ID)
+		if err != nil {
+			return nil, fmt.Errorf("fetch holders of %s: %w", a.Symbol, err)
+		}
+		walletIDs := make([]string, 0, len(holders))
+		for walletID := range holders {
+			walletIDs = append(walletIDs, walletID)
+		}
+		sort.Strings(walletIDs)
+
+		for _, walletID := range walletIDs {
+			if walletID == zs.zakatPoolWallet {
+				continue
+			}
+			note := fmt.Sprintf("Monthly Zakat deduction on %s (%.2f%%)", a.Symbol, float64(a.ZakatBPS)/100)
+			zakatTx, zakatAmount, err := zs.deduct(ctx, walletID, a.ID, period, a.Zakat, note)
+			if errors.Is(err, db.ErrZakatDeducted) {
+				log.Printf("  Wallet %s already paid %s Zakat for %s", walletID, a.Symbol, period)
+				continue
+			}
+			if err != nil {
+				log.Printf("  ✗ Zakat in %s from wallet %s not deducted: %v", a.Symbol, walletID, err)
+				continue
+			}
+			if zakatTx == nil {
+				continue
+			}
+
+			txIDs = append(txIDs, zakatTx.ID)
+			if deducted[a.ID] == nil {
+				deducted[a.ID] = map[string]int64{}
+			}
+			deducted[a.ID][walletID] = zakatAmount
+
+			_ = zs.db.InsertLog(ctx, walletID, db.ZakatDeductedAction, fmt.Sprintf("Deducted %d %s as Zakat", zakatAmount, a.Symbol), "success", "system")
+		}
+		if len(deducted[a.ID]) > 0 {
+			log.Printf("  → Charged Zakat on %d holders of %s (%.2f%%)", len(deducted[a.ID]), a.Symbol, float64(a.ZakatBPS)/100)
+		}
+	}
+	return txIDs, nil
+}
+
+// deduct pays the Zakat on a wallet's spendable balance of an asset (empty
+// for the native coin) to the pool, as zakat computes it from that balance.
+// It returns a nil transaction when nothing is due, and ErrZakatDeducted if
+// the wallet already paid for the period. The transaction spends spendable
+// outputs and returns the change like any transfer, and is recorded with the
+// zakat_deduction type that statements count as Zakat.
+func (zs *ZakatScheduler) deduct(ctx context.Context, walletID, assetID, period string, zakat func(balance int64) int64, note string) (*tx.Transaction, int64, error) {
+	zs.mu.Lock()
+	transferMu := zs.transferMu
+	zs.mu.Unlock()
+	if transferMu != nil {
+		transferMu.Lock()
+		defer transferMu.Unlock()
+	}
+
+	done, err := zs.db.ZakatDeducted(ctx, walletID, assetID, period)
+	if err != nil {
+		return nil, 0, fmt.Errorf("check period: %w", err)
+	}
+	if done {
+		return nil, 0, db.ErrZakatDeducted
+	}
+
+	utxos, err := zs.db.GetUnspentUTXOs(ctx, walletID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fetch outputs: %w", err)
+	}
+	height, now := int64(zs.bc.GetChainLength()-1), time.Now().Unix()
+	var spendable []db.UTXO
+	var balance int64
+	for _, u := range utxos {
+		if u.Asset != assetID || u.Lock.CheckSpend(height, now) != nil {
+			continue
+		}
+		spendable = append(spendable, u)
+		balance += u.Amount
+	}
+	amount := zakat(balance)
+	if amount <= 0 {
+		return nil, 0, nil
+	}
+
+	var inputs []string
+	var total int64
+	for _, u := range spendable {
+		if total >= amount {
+			break
+		}
+		inputs = append(inputs, u.UTXOID)
+		total += u.Amount
+	}
+
+	zakatTx := tx.NewTransaction(walletID, zs.zakatPoolWallet, amount, note, inputs)
+	if assetID != "" {
+		zakatTx.Asset = assetID
+		zakatTx.ID = zakatTx.ComputeID()
+	}
+	outputs := zakatTx.Outputs(total)
+	err = zs.db.ApplyTransfer(ctx, db.Transfer{
+		Record: db.TxRecord{TxID: zakatTx.ID, SenderWalletID: walletID, ReceiverWalletID: zs.zakatPoolWallet,
+			Amount: amount, Note: note, TxType: db.TxTypeZakat, Signature: []byte{}, IPAddress: "system", Asset: assetID},
+		Inputs:  inputs,
+		Outputs: outputs,
+		Height:  height,
+		Now:     now,
+		// The pool is a system wallet with no key
+		RegisterReceiver: true,
+		ZakatPeriod:      period,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, o := range outputs {
+		zs.um.AddAssetUTXO(o.Owner, o.Asset, o.Amount, o.Lock)
+	}
+	return zakatTx, amount, nil
 }
 
 // GetLastRunTime returns the timestamp of the last Zakat run
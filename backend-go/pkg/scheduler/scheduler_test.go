@@ -2,10 +2,14 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"blockchain-wallet/pkg/asset"
 	"blockchain-wallet/pkg/blockchain"
+	"blockchain-wallet/pkg/db"
 	"blockchain-wallet/pkg/utxo"
 )
 
@@ -28,50 +32,268 @@ func TestZakatSchedulerInit(t *testing.T) {
 	}
 }
 
-// TestTriggerZakatNow tests immediate Zakat triggering
-func TestTriggerZakatNow(t *testing.T) {
+// TestZakatRunWithoutDB tests that a run without a database is a no-op
+func TestZakatRunWithoutDB(t *testing.T) {
 	bc := blockchain.NewBlockchain(5)
 	um := utxo.NewManager()
 	zs := NewZakatScheduler(nil, bc, um, "zakat-pool")
 
-	ctx := context.Background()
-	before := zs.GetLastRunTime()
+	if err := zs.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
 
-	// Wait a tiny bit
-	time.Sleep(10 * time.Millisecond)
+	if len(bc.GetPendingTransactions()) != 0 {
+		t.Error("No Zakat transactions should be queued without a database")
+	}
+	if bc.GetChainLength() != 1 {
+		t.Error("No Zakat block should be mined without a database")
+	}
+}
 
-	// Trigger
-	err := zs.TriggerZakatNow(ctx)
-	if err != nil {
-		t.Fatalf("TriggerZakatNow failed: %v", err)
+// fakeStore records what the scheduler writes; unused methods panic via the nil embed
+type fakeStore struct {
+	Store
+	wallets []db.Wallet
+	assets  []asset.Asset
+	holders map[string]map[string]int64 // asset ID -> wallet ID -> balance
+	utxos   map[string][]db.UTXO        // wallet ID -> unspent outputs
+	applied []db.Transfer
+	blocks  []*blockchain.Block
+	logs    []string
+}
+
+// fund gives a wallet an unspent output of an asset
+func (f *fakeStore) fund(walletID, assetID string, amount int64) {
+	if f.utxos == nil {
+		f.utxos = map[string][]db.UTXO{}
 	}
+	id := fmt.Sprintf("%s-%d", walletID, len(f.utxos[walletID]))
+	f.utxos[walletID] = append(f.utxos[walletID], db.UTXO{UTXOID: id, Owner: walletID, Amount: amount, Asset: assetID})
+}
+
+func (f *fakeStore) GetUnspentUTXOs(ctx context.Context, walletID string) ([]db.UTXO, error) {
+	return f.utxos[walletID], nil
+}
 
-	after := zs.GetLastRunTime()
-	if after.Before(before) {
-		t.Error("Last run time was not updated")
+func (f *fakeStore) ZakatDeducted(ctx context.Context, walletID, assetID, period string) (bool, error) {
+	for _, t := range f.applied {
+		if t.Record.SenderWalletID == walletID && t.Record.Asset == assetID && t.ZakatPeriod == period {
+			return true, nil
+		}
 	}
+	return false, nil
 }
 
-// TestZakatStartStop tests scheduler start/stop lifecycle
-func TestZakatStartStop(t *testing.T) {
-	bc := blockchain.NewBlockchain(5)
-	um := utxo.NewManager()
-	zs := NewZakatScheduler(nil, bc, um, "zakat-pool")
+func (f *fakeStore) ApplyTransfer(ctx context.Context, t db.Transfer) error {
+	f.applied = append(f.applied, t)
+	return nil
+}
+
+func (f *fakeStore) GetZakatAssets(ctx context.Context) ([]asset.Asset, error) {
+	return f.assets, nil
+}
+
+func (f *fakeStore) GetAssetHolders(ctx context.Context, assetID string) (map[string]int64, error) {
+	return f.holders[assetID], nil
+}
+
+func (f *fakeStore) GetAllWallets(ctx context.Context) ([]db.Wallet, error) {
+	return f.wallets, nil
+}
+
+func (f *fakeStore) InsertBlock(ctx context.Context, b *blockchain.Block) error {
+	f.blocks = append(f.blocks, b)
+	return nil
+}
+
+func (f *fakeStore) InsertLog(ctx context.Context, walletID, action, details, status, ip string) error {
+	f.logs = append(f.logs, action)
+	return nil
+}
+
+// TestZakatDeductsFromWallets tests that eligible wallets are charged and a block is stored
+func TestZakatDeductsFromWallets(t *testing.T) {
+	bc := blockchain.NewBlockchain(1)
+	store := &fakeStore{
+		wallets: []db.Wallet{
+			{WalletID: "wallet-aaaaaaaaaaaaaaaa", Balance: 1000},
+			{WalletID: "wallet-bbbbbbbbbbbbbbbb", Balance: 10},  // 2.5% rounds to zero
+			{WalletID: "wallet-cccccccccccccccc", Balance: 400}, // all of it locked
+			{WalletID: "zakat-pool", Balance: 5000},
+		},
+		utxos: map[string][]db.UTXO{
+			"wallet-aaaaaaaaaaaaaaaa": {{UTXOID: "a-gold", Owner: "wallet-aaaaaaaaaaaaaaaa", Amount: 80, Asset: "gold"},
+				{UTXOID: "a-1", Owner: "wallet-aaaaaaaaaaaaaaaa", Amount: 600}, {UTXOID: "a-2", Owner: "wallet-aaaaaaaaaaaaaaaa", Amount: 400}},
+			"wallet-cccccccccccccccc": {{UTXOID: "c-1", Owner: "wallet-cccccccccccccccc", Amount: 400,
+				Lock: &utxo.Lock{Kind: utxo.LockTime, Height: 1000}}},
+		},
+	}
+	zs := NewZakatScheduler(store, bc, utxo.NewManager(), "zakat-pool")
+
+	if err := zs.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
 
-	ctx := context.Background()
+	// The Zakat is paid to the pool as a typed transaction, with change
+	if len(store.applied) != 1 {
+		t.Fatalf("expected one Zakat transaction, got %d", len(store.applied))
+	}
+	z := store.applied[0]
+	if z.Record.TxType != db.TxTypeZakat || z.Record.ReceiverWalletID != "zakat-pool" || z.Record.Amount != 25 || !z.RegisterReceiver {
+		t.Errorf("unexpected Zakat record: %+v", z)
+	}
+	if len(z.Inputs) != 1 || z.Inputs[0] != "a-1" {
+		t.Errorf("Zakat spent %v, want [a-1]", z.Inputs)
+	}
+	if len(z.Outputs) != 2 || z.Outputs[0].Owner != "zakat-pool" || z.Outputs[0].Amount != 25 || z.Outputs[1].Amount != 575 {
+		t.Errorf("unexpected Zakat outputs: %+v", z.Outputs)
+	}
 
-	// Start scheduler
-	zs.Start(ctx)
-	time.Sleep(100 * time.Millisecond)
+	if len(store.blocks) != 1 {
+		t.Fatalf("expected one Zakat block stored, got %d", len(store.blocks))
+	}
+	// One Zakat transaction plus the mining reward
+	if got := len(store.blocks[0].Transactions); got != 2 {
+		t.Errorf("expected 2 transactions in block, got %d", got)
+	} else if id := store.blocks[0].Transactions[0]; len(id) != 64 {
+		t.Errorf("Zakat transaction linked with ID %q", id)
+	}
+	if len(store.logs) != 2 || store.logs[0] != "zakat_deducted" || store.logs[1] != "zakat_block_mined" {
+		t.Errorf("unexpected log actions: %v", store.logs)
+	}
+}
 
-	// Stop scheduler
-	zs.Stop()
-	time.Sleep(100 * time.Millisecond)
+// TestOnRunReportsSummary tests that the run hook sees what was deducted
+func TestOnRunReportsSummary(t *testing.T) {
+	store := &fakeStore{wallets: []db.Wallet{
+		{WalletID: "wallet-aaaaaaaaaaaaaaaa", Balance: 1000},
+		{WalletID: "wallet-bbbbbbbbbbbbbbbb", Balance: 400},
+	}}
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "", 1000)
+	store.fund("wallet-bbbbbbbbbbbbbbbb", "", 400)
+	zs := NewZakatScheduler(store, blockchain.NewBlockchain(1), utxo.NewManager(), "zakat-pool")
 
-	// Verify stopped
-	zs.mu.Lock()
-	if zs.running {
-		t.Error("Scheduler should be stopped")
+	var got *RunSummary
+	zs.OnRun(func(ctx context.Context, s RunSummary) { got = &s })
+	if err := zs.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("OnRun hook not called")
+	}
+	if got.Total != 35 || got.Deducted["wallet-aaaaaaaaaaaaaaaa"] != 25 || got.Deducted["wallet-bbbbbbbbbbbbbbbb"] != 10 {
+		t.Errorf("unexpected summary: total=%d deducted=%v", got.Total, got.Deducted)
+	}
+	if got.Block == nil || got.Block != store.blocks[0] {
+		t.Error("summary should reference the stored Zakat block")
+	}
+	if !got.At.Equal(zs.GetLastRunTime()) {
+		t.Errorf("summary time %v, last run %v", got.At, zs.GetLastRunTime())
+	}
+}
+
+// TestZakatChargesAssetsAtTheirRate tests that assets are charged at their own rate, apart from the native coin
+func TestZakatChargesAssetsAtTheirRate(t *testing.T) {
+	store := &fakeStore{
+		wallets: []db.Wallet{{WalletID: "wallet-aaaaaaaaaaaaaaaa", Balance: 1000}},
+		assets:  []asset.Asset{{ID: "pts-id", Symbol: "PTS", ZakatBPS: 100}},
+		holders: map[string]map[string]int64{"pts-id": {
+			"wallet-aaaaaaaaaaaaaaaa": 5000,
+			"wallet-bbbbbbbbbbbbbbbb": 50, // 1% rounds to zero
+			"zakat-pool":              900,
+		}},
+	}
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "", 1000)
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "pts-id", 5000)
+	bc := blockchain.NewBlockchain(1)
+	zs := NewZakatScheduler(store, bc, utxo.NewManager(), "zakat-pool")
+
+	var got *RunSummary
+	zs.OnRun(func(ctx context.Context, s RunSummary) { got = &s })
+	if err := zs.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if got.Total != 25 || len(got.Deducted) != 1 {
+		t.Errorf("native Zakat should be unaffected: total=%d deducted=%v", got.Total, got.Deducted)
+	}
+	pts := got.AssetDeducted["pts-id"]
+	if len(pts) != 1 || pts["wallet-aaaaaaaaaaaaaaaa"] != 50 {
+		t.Errorf("unexpected PTS deductions: %v", got.AssetDeducted)
+	}
+	if len(store.applied) != 2 || store.applied[1].Record.Asset != "pts-id" || store.applied[1].Outputs[0].Asset != "pts-id" {
+		t.Errorf("PTS Zakat should be paid in PTS: %+v", store.applied)
+	}
+	// The native and PTS Zakat transactions plus the mining reward
+	if len(store.blocks) != 1 || len(store.blocks[0].Transactions) != 3 {
+		t.Fatalf("expected one block with 3 transactions, got %d blocks", len(store.blocks))
+	}
+}
+
+// TestZakatAssetsOnly tests that a block is mined when only asset Zakat is due
+func TestZakatAssetsOnly(t *testing.T) {
+	store := &fakeStore{
+		assets:  []asset.Asset{{ID: "pts-id", Symbol: "PTS", ZakatBPS: 250}},
+		holders: map[string]map[string]int64{"pts-id": {"wallet-aaaaaaaaaaaaaaaa": 400}},
+	}
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "pts-id", 400)
+	zs := NewZakatScheduler(store, blockchain.NewBlockchain(1), utxo.NewManager(), "zakat-pool")
+	if err := zs.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(store.blocks) != 1 || len(store.blocks[0].Transactions) != 2 {
+		t.Fatalf("expected a Zakat block for the asset deduction, got %d blocks", len(store.blocks))
+	}
+}
+
+// countingLock counts how often it is taken
+type countingLock struct {
+	sync.Mutex
+	locks int
+}
+
+func (l *countingLock) Lock() {
+	l.Mutex.Lock()
+	l.locks++
+}
+
+// TestZakatChargesOncePerPeriod tests that the base is the spendable balance, that deductions hold the transfer lock and
+// update the UTXO manager, and that running again in the same month charges nothing
+func TestZakatChargesOncePerPeriod(t *testing.T) {
+	store := &fakeStore{
+		// The cached balance is stale; only 400 is spendable
+		wallets: []db.Wallet{{WalletID: "wallet-aaaaaaaaaaaaaaaa", Balance: 1000}},
+		assets:  []asset.Asset{{ID: "pts-id", Symbol: "PTS", ZakatBPS: 100}},
+		holders: map[string]map[string]int64{"pts-id": {"wallet-aaaaaaaaaaaaaaaa": 5000}},
+	}
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "", 400)
+	store.fund("wallet-aaaaaaaaaaaaaaaa", "pts-id", 5000)
+	um := utxo.NewManager()
+	zs := NewZakatScheduler(store, blockchain.NewBlockchain(1), um, "zakat-pool")
+	lock := &countingLock{}
+	zs.SetTransferLock(lock)
+
+	for i := 0; i < 2; i++ {
+		if err := zs.Run(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	if len(store.applied) != 2 {
+		t.Fatalf("expected the native and PTS Zakat once each, got %d transfers", len(store.applied))
+	}
+	native := store.applied[0]
+	if native.Record.Amount != 10 || native.ZakatPeriod != zakatPeriod(time.Now()) {
+		t.Errorf("native Zakat %d for %q, want 10 for this month", native.Record.Amount, native.ZakatPeriod)
+	}
+	if lock.locks != 4 {
+		t.Errorf("transfer lock taken %d times, want 4", lock.locks)
+	}
+	if got := um.Balance("zakat-pool"); got != 10 {
+		t.Errorf("UTXO manager pool balance %d, want 10", got)
+	}
+	if len(store.blocks) != 1 {
+		t.Errorf("expected one Zakat block, got %d", len(store.blocks))
 	}
-	zs.mu.Unlock()
 }
@@ -0,0 +1,400 @@
+package script
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+)
+
+// Context is what a script can observe about the spending transaction and
+// the chain
+type Context struct {
+	SigHash   []byte // message CHECKSIG verifies signatures against
+	Height    int64  // latest block index
+	Time      int64  // unix seconds
+	CostLimit int    // 0 means DefaultCostLimit
+}
+
+// engine is the state of one verification
+type engine struct {
+	ctx   Context
+	stack [][]byte
+	cond  []bool // one entry per open IF; false while skipping a branch
+	cost  int
+	limit int
+}
+
+// Verify runs unlock and then lock on a shared stack. It succeeds when no
+// error occurs and exactly one true element is left.
+func Verify(unlock, lock Script, ctx Context) error {
+	if !unlock.IsPushOnly() {
+		return ErrUnlockNotPushOnly
+	}
+	e := &engine{ctx: ctx, limit: ctx.CostLimit}
+	if e.limit <= 0 {
+		e.limit = DefaultCostLimit
+	}
+	if err := e.run(unlock); err != nil {
+		return err
+	}
+	if err := e.run(lock); err != nil {
+		return err
+	}
+	if len(e.stack) == 0 || !truthy(e.stack[len(e.stack)-1]) {
+		return ErrEvalFalse
+	}
+	if len(e.stack) != 1 {
+		return ErrCleanStack
+	}
+	return nil
+}
+
+// executing reports whether the current branch runs
+func (e *engine) executing() bool {
+	for _, c := range e.cond {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *engine) charge(n int) error {
+	e.cost += n
+	if e.cost > e.limit {
+		return ErrCostExceeded
+	}
+	return nil
+}
+
+func (e *engine) push(b []byte) error {
+	if len(b) > MaxElementSize {
+		return ErrElementTooLarge
+	}
+	if len(e.stack) >= MaxStackSize {
+		return ErrStackOverflow
+	}
+	e.stack = append(e.stack, b)
+	return nil
+}
+
+func (e *engine) pop() ([]byte, error) {
+	if len(e.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	top := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+	return top, nil
+}
+
+func (e *engine) popNum() (int64, error) {
+	b, err := e.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNum(b)
+}
+
+func (e *engine) peek(depth int) ([]byte, error) {
+	if len(e.stack) <= depth {
+		return nil, ErrStackUnderflow
+	}
+	return e.stack[len(e.stack)-1-depth], nil
+}
+
+func (e *engine) pushBool(v bool) error {
+	if v {
+		return e.push([]byte{1})
+	}
+	return e.push(nil)
+}
+
+// truthy is false for empty, all-zero and negative-zero elements
+func truthy(b []byte) bool {
+	for i, c := range b {
+		if c != 0 && !(i == len(b)-1 && c == 0x80) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *engine) run(s Script) error {
+	ins, err := s.instructions()
+	if err != nil {
+		return err
+	}
+	e.cond = e.cond[:0]
+	for _, in := range ins {
+		if err := e.charge(opCost); err != nil {
+			return err
+		}
+		if err := e.step(in); err != nil {
+			return err
+		}
+	}
+	if len(e.cond) != 0 {
+		return ErrUnbalancedIf
+	}
+	return nil
+}
+
+func (e *engine) step(in instruction) error {
+	// Branch opcodes are tracked even in skipped branches
+	switch in.op {
+	case OP_IF, OP_NOTIF:
+		v := false
+		if e.executing() {
+			b, err := e.pop()
+			if err != nil {
+				return err
+			}
+			v = truthy(b) == (in.op == OP_IF)
+		}
+		e.cond = append(e.cond, v)
+		return nil
+	case OP_ELSE:
+		if len(e.cond) == 0 {
+			return ErrUnbalancedIf
+		}
+		// Only flip if the enclosing branches run
+		outer := e.cond[:len(e.cond)-1]
+		runs := true
+		for _, c := range outer {
+			runs = runs && c
+		}
+		if runs {
+			e.cond[len(e.cond)-1] = !e.cond[len(e.cond)-1]
+		}
+		return nil
+	case OP_ENDIF:
+		if len(e.cond) == 0 {
+			return ErrUnbalancedIf
+		}
+		e.cond = e.cond[:len(e.cond)-1]
+		return nil
+	}
+
+	if !e.executing() {
+		if _, known := opNames[in.op]; !known && !isPush(in.op) {
+			return ErrBadOpcode
+		}
+		return nil
+	}
+
+	switch {
+	case in.op == OP_0:
+		return e.push(nil)
+	case in.op > OP_0 && in.op <= OP_PUSHDATA2:
+		return e.push(in.data)
+	case in.op == OP_1NEGATE:
+		return e.push(encodeNum(-1))
+	case isSmallInt(in.op):
+		return e.push(encodeNum(int64(in.op - OP_1 + 1)))
+	}
+
+	switch in.op {
+	case OP_NOP:
+		return nil
+	case OP_VERIFY:
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		if !truthy(b) {
+			return ErrVerify
+		}
+		return nil
+	case OP_RETURN:
+		return ErrReturn
+
+	case OP_DROP:
+		_, err := e.pop()
+		return err
+	case OP_DUP:
+		b, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		return e.push(b)
+	case OP_OVER:
+		b, err := e.peek(1)
+		if err != nil {
+			return err
+		}
+		return e.push(b)
+	case OP_SWAP:
+		if len(e.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		n := len(e.stack)
+		e.stack[n-1], e.stack[n-2] = e.stack[n-2], e.stack[n-1]
+		return nil
+	case OP_SIZE:
+		b, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		return e.push(encodeNum(int64(len(b))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := e.pop()
+		if err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		eq := bytes.Equal(a, b)
+		if in.op == OP_EQUALVERIFY {
+			if !eq {
+				return ErrVerify
+			}
+			return nil
+		}
+		return e.pushBool(eq)
+
+	case OP_SHA256:
+		if err := e.charge(hashCost); err != nil {
+			return err
+		}
+		b, err := e.pop()
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(b)
+		return e.push(h[:])
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		if err := e.charge(checkSigCost); err != nil {
+			return err
+		}
+		pub, err := e.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := e.pop()
+		if err != nil {
+			return err
+		}
+		ok, err := e.checkSig(sig, pub)
+		if err != nil {
+			return err
+		}
+		if in.op == OP_CHECKSIGVERIFY {
+			if !ok {
+				return ErrVerify
+			}
+			return nil
+		}
+		return e.pushBool(ok)
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		ok, err := e.checkMultisig()
+		if err != nil {
+			return err
+		}
+		if in.op == OP_CHECKMULTISIGVERIFY {
+			if !ok {
+				return ErrVerify
+			}
+			return nil
+		}
+		return e.pushBool(ok)
+
+	case OP_CHECKHEIGHTVERIFY, OP_CHECKTIMEVERIFY:
+		// Like Bitcoin's CHECKLOCKTIMEVERIFY the operand stays on the stack
+		b, err := e.peek(0)
+		if err != nil {
+			return err
+		}
+		n, err := decodeNum(b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return ErrNegativeLocktime
+		}
+		now := e.ctx.Height
+		if in.op == OP_CHECKTIMEVERIFY {
+			now = e.ctx.Time
+		}
+		if now < n {
+			return ErrLocktimeNotReached
+		}
+		return nil
+	}
+	return ErrBadOpcode
+}
+
+func isPush(op byte) bool {
+	return op <= OP_PUSHDATA2 || op == OP_1NEGATE || isSmallInt(op)
+}
+
+// checkSig verifies an Ed25519 signature over the context's SigHash. An
+// empty signature is a clean false, so scripts can branch on it.
+func (e *engine) checkSig(sig, pub []byte) (bool, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return false, ErrBadPublicKey
+	}
+	if len(sig) == 0 {
+		return false, nil
+	}
+	return ed25519.Verify(pub, e.ctx.SigHash, sig), nil
+}
+
+// checkMultisig pops "<sig...> m <pub...> n" and reports whether the m
+// signatures match m of the n keys, in key order
+func (e *engine) checkMultisig() (bool, error) {
+	n, err := e.popNum()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxMultisigKeys {
+		return false, ErrTooManyKeys
+	}
+	if err := e.charge(checkSigCost * int(n)); err != nil {
+		return false, err
+	}
+	pubs := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubs[i], err = e.pop(); err != nil {
+			return false, err
+		}
+		if len(pubs[i]) != ed25519.PublicKeySize {
+			return false, ErrBadPublicKey
+		}
+	}
+	m, err := e.popNum()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, ErrNumberRange
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = e.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	// Each signature must match a later key than the previous one
+	k := 0
+	for _, sig := range sigs {
+		matched := false
+		for k < len(pubs) && !matched {
+			ok, err := e.checkSig(sig, pubs[k])
+			if err != nil {
+				return false, err
+			}
+			matched = ok
+			k++
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
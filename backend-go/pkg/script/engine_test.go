@@ -0,0 +1,260 @@
+package script
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testKeys are deterministic keys for the tables below
+var testKeys = func() []ed25519.PrivateKey {
+	keys := make([]ed25519.PrivateKey, 3)
+	for i := range keys {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("script-test-key-%d", i)))
+		keys[i] = ed25519.NewKeyFromSeed(seed[:])
+	}
+	return keys
+}()
+
+var sigHash = sha256.Sum256([]byte("spending transaction"))
+
+func pubHex(i int) string {
+	return hex.EncodeToString(testKeys[i].Public().(ed25519.PublicKey))
+}
+
+func pubHashHex(i int) string {
+	h := sha256.Sum256(testKeys[i].Public().(ed25519.PublicKey))
+	return hex.EncodeToString(h[:])
+}
+
+func sigHex(i int) string {
+	return hex.EncodeToString(ed25519.Sign(testKeys[i], sigHash[:]))
+}
+
+func TestVerify(t *testing.T) {
+	preimage := "68656c6c6f" // "hello"
+	digest := sha256.Sum256([]byte("hello"))
+	hashHex := hex.EncodeToString(digest[:])
+	wrongSig := hex.EncodeToString(ed25519.Sign(testKeys[0], []byte("another transaction")))
+
+	p2pkh := fmt.Sprintf("OP_DUP OP_SHA256 <%s> OP_EQUALVERIFY OP_CHECKSIG", pubHashHex(0))
+	multisig := fmt.Sprintf("2 <%s> <%s> <%s> 3 OP_CHECKMULTISIG", pubHex(0), pubHex(1), pubHex(2))
+	// Pays the key 1 holder with the preimage, or key 0 after height 100
+	htlc := fmt.Sprintf("OP_IF OP_SHA256 <%s> OP_EQUALVERIFY <%s> OP_ELSE 100 OP_CHECKHEIGHTVERIFY OP_DROP <%s> OP_ENDIF OP_CHECKSIG",
+		hashHex, pubHex(1), pubHex(0))
+
+	tests := []struct {
+		name   string
+		unlock string
+		lock   string
+		height int64
+		time   int64
+		want   error
+	}{
+		// Trivial scripts
+		{"true", "", "1", 0, 0, nil},
+		{"false", "", "0", 0, 0, ErrEvalFalse},
+		{"empty", "", "", 0, 0, ErrEvalFalse},
+		{"negative zero is false", "<80>", "", 0, 0, ErrEvalFalse},
+		{"unclean stack", "1", "1", 0, 0, ErrCleanStack},
+		{"return", "", "OP_RETURN 1", 0, 0, ErrReturn},
+		{"nop", "", "OP_NOP 1", 0, 0, nil},
+
+		// Stack operations
+		{"dup equal", "<aa>", "OP_DUP OP_EQUAL", 0, 0, nil},
+		{"swap", "1 2", "OP_SWAP 1 OP_EQUALVERIFY 2 OP_EQUAL", 0, 0, nil},
+		{"over", "1 2", "OP_OVER 1 OP_EQUALVERIFY 2 OP_EQUALVERIFY 1 OP_EQUAL", 0, 0, nil},
+		{"size", "<aabbcc>", "OP_SIZE 3 OP_EQUALVERIFY OP_DROP 1", 0, 0, nil},
+		{"drop underflow", "", "OP_DROP", 0, 0, ErrStackUnderflow},
+		{"swap underflow", "1", "OP_SWAP", 0, 0, ErrStackUnderflow},
+		{"equal underflow", "1", "OP_EQUAL", 0, 0, ErrStackUnderflow},
+		{"verify false", "0", "OP_VERIFY 1", 0, 0, ErrVerify},
+		{"equalverify mismatch", "1 2", "OP_EQUALVERIFY 1", 0, 0, ErrVerify},
+
+		// Conditionals
+		{"if taken", "1", "OP_IF 1 OP_ELSE 0 OP_ENDIF", 0, 0, nil},
+		{"else taken", "0", "OP_IF 0 OP_ELSE 1 OP_ENDIF", 0, 0, nil},
+		{"notif", "0", "OP_NOTIF 1 OP_ELSE 0 OP_ENDIF", 0, 0, nil},
+		{"nested skipped", "0", "OP_IF OP_IF OP_RETURN OP_ENDIF OP_ELSE 1 OP_ENDIF", 0, 0, nil},
+		{"nested else not flipped", "1 0", "OP_IF OP_RETURN OP_ELSE OP_IF 1 OP_ELSE OP_RETURN OP_ENDIF OP_ENDIF", 0, 0, nil},
+		{"skipped branch does not run", "", "0 OP_IF OP_RETURN OP_ENDIF 1", 0, 0, nil},
+		{"missing endif", "1", "OP_IF 1", 0, 0, ErrUnbalancedIf},
+		{"stray else", "", "OP_ELSE 1", 0, 0, ErrUnbalancedIf},
+		{"stray endif", "", "OP_ENDIF 1", 0, 0, ErrUnbalancedIf},
+		{"if underflow", "", "OP_IF 1 OP_ENDIF", 0, 0, ErrStackUnderflow},
+
+		// Hash locks
+		{"hash lock", "<" + preimage + ">", "OP_SHA256 <" + hashHex + "> OP_EQUAL", 0, 0, nil},
+		{"hash lock wrong preimage", "<6869>", "OP_SHA256 <" + hashHex + "> OP_EQUAL", 0, 0, ErrEvalFalse},
+
+		// Pay to public key hash
+		{"p2pkh", fmt.Sprintf("<%s> <%s>", sigHex(0), pubHex(0)), p2pkh, 0, 0, nil},
+		{"p2pkh wrong key", fmt.Sprintf("<%s> <%s>", sigHex(1), pubHex(1)), p2pkh, 0, 0, ErrVerify},
+		{"p2pkh signature over other data", fmt.Sprintf("<%s> <%s>", wrongSig, pubHex(0)), p2pkh, 0, 0, ErrEvalFalse},
+		{"p2pkh empty signature", fmt.Sprintf("0 <%s>", pubHex(0)), p2pkh, 0, 0, ErrEvalFalse},
+		{"checksig bad key", fmt.Sprintf("<%s> <abcd>", sigHex(0)), "OP_CHECKSIG", 0, 0, ErrBadPublicKey},
+		{"checksigverify", fmt.Sprintf("<%s>", sigHex(2)), fmt.Sprintf("<%s> OP_CHECKSIGVERIFY 1", pubHex(2)), 0, 0, nil},
+		{"checksigverify fails", fmt.Sprintf("<%s>", sigHex(1)), fmt.Sprintf("<%s> OP_CHECKSIGVERIFY 1", pubHex(2)), 0, 0, ErrVerify},
+
+		// Multisig
+		{"2-of-3 keys 0,1", fmt.Sprintf("<%s> <%s>", sigHex(0), sigHex(1)), multisig, 0, 0, nil},
+		{"2-of-3 keys 0,2", fmt.Sprintf("<%s> <%s>", sigHex(0), sigHex(2)), multisig, 0, 0, nil},
+		{"2-of-3 keys 1,2", fmt.Sprintf("<%s> <%s>", sigHex(1), sigHex(2)), multisig, 0, 0, nil},
+		{"2-of-3 out of order", fmt.Sprintf("<%s> <%s>", sigHex(1), sigHex(0)), multisig, 0, 0, ErrEvalFalse},
+		{"2-of-3 same key twice", fmt.Sprintf("<%s> <%s>", sigHex(0), sigHex(0)), multisig, 0, 0, ErrEvalFalse},
+		{"2-of-3 one signature", fmt.Sprintf("<%s>", sigHex(0)), multisig, 0, 0, ErrStackUnderflow},
+		{"2-of-3 one empty", fmt.Sprintf("<%s> 0", sigHex(0)), multisig, 0, 0, ErrEvalFalse},
+		{"multisig too many keys", "", "0 21 OP_CHECKMULTISIG", 0, 0, ErrTooManyKeys},
+		{"multisig m above n", fmt.Sprintf("2 <%s> 1 OP_CHECKMULTISIG", pubHex(0)), "", 0, 0, ErrUnlockNotPushOnly},
+		{"multisig threshold above keys", "", fmt.Sprintf("2 <%s> 1 OP_CHECKMULTISIG", pubHex(0)), 0, 0, ErrNumberRange},
+		{"multisig bad key", "", "1 <abcd> 1 OP_CHECKMULTISIG", 0, 0, ErrBadPublicKey},
+
+		// Time locks
+		{"height reached", "", "100 OP_CHECKHEIGHTVERIFY", 100, 0, nil},
+		{"height not reached", "", "100 OP_CHECKHEIGHTVERIFY", 99, 0, ErrLocktimeNotReached},
+		{"time reached", "", "1700000000 OP_CHECKTIMEVERIFY", 0, 1700000000, nil},
+		{"time not reached", "", "1700000000 OP_CHECKTIMEVERIFY", 0, 1699999999, ErrLocktimeNotReached},
+		{"negative lock", "", "-1 OP_CHECKHEIGHTVERIFY", 5, 0, ErrNegativeLocktime},
+		{"non-minimal lock", "", "<6400> OP_CHECKHEIGHTVERIFY", 500, 0, ErrNonMinimalNumber},
+		{"lock underflow", "", "OP_CHECKTIMEVERIFY", 0, 0, ErrStackUnderflow},
+
+		// HTLC built from the pieces above
+		{"htlc claim", fmt.Sprintf("<%s> <%s> 1", sigHex(1), preimage), htlc, 0, 0, nil},
+		{"htlc claim wrong preimage", fmt.Sprintf("<%s> <6869> 1", sigHex(1)), htlc, 0, 0, ErrVerify},
+		{"htlc claim by refund key", fmt.Sprintf("<%s> <%s> 1", sigHex(0), preimage), htlc, 0, 0, ErrEvalFalse},
+		{"htlc refund early", fmt.Sprintf("<%s> 0", sigHex(0)), htlc, 99, 0, ErrLocktimeNotReached},
+		{"htlc refund", fmt.Sprintf("<%s> 0", sigHex(0)), htlc, 100, 0, nil},
+		{"htlc refund by claim key", fmt.Sprintf("<%s> 0", sigHex(1)), htlc, 100, 0, ErrEvalFalse},
+
+		// Unlocking scripts and opcodes
+		{"unlock not push only", "1 OP_DUP", "OP_EQUAL", 0, 0, ErrUnlockNotPushOnly},
+		{"empty push is false", "", "1 <>", 0, 0, ErrEvalFalse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlock, err := Parse(tt.unlock)
+			if err != nil {
+				t.Fatalf("Parse(unlock): %v", err)
+			}
+			lock, err := Parse(tt.lock)
+			if err != nil {
+				t.Fatalf("Parse(lock): %v", err)
+			}
+			err = Verify(unlock, lock, Context{SigHash: sigHash[:], Height: tt.height, Time: tt.time})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRawOpcodes(t *testing.T) {
+	tests := []struct {
+		name string
+		lock string // hex
+		want error
+	}{
+		{"unknown opcode", "51ff", ErrBadOpcode},
+		{"unknown opcode in skipped branch", "0063ff6851", ErrBadOpcode},
+		{"pushdata4 unsupported", "4e00000000", ErrBadOpcode},
+		{"truncated push", "0501", ErrMalformed},
+		{"oversized script", strings.Repeat("61", MaxScriptSize) + "51", ErrScriptTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, _ := hex.DecodeString(tt.lock)
+			if err := Verify(nil, lock, Context{}); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("cost limit", func(t *testing.T) {
+		// Each SHA256 costs more than a plain opcode, so this many runs out
+		lock := "<aa>" + strings.Repeat(" OP_SHA256", 1000) + " OP_DROP 1"
+		s, err := Parse(lock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(nil, s, Context{}); !errors.Is(err, ErrCostExceeded) {
+			t.Fatalf("Verify = %v, want ErrCostExceeded", err)
+		}
+		if err := Verify(nil, s, Context{CostLimit: 100000}); err != nil {
+			t.Fatalf("Verify with a higher limit: %v", err)
+		}
+	})
+
+	t.Run("checksig cost", func(t *testing.T) {
+		lock := fmt.Sprintf("2 <%s> <%s> <%s> 3 OP_CHECKMULTISIG", pubHex(0), pubHex(1), pubHex(2))
+		s, _ := Parse(lock)
+		unlock, _ := Parse(fmt.Sprintf("<%s> <%s>", sigHex(0), sigHex(1)))
+		if err := Verify(unlock, s, Context{SigHash: sigHash[:], CostLimit: 3*checkSigCost - 1}); !errors.Is(err, ErrCostExceeded) {
+			t.Fatalf("Verify = %v, want ErrCostExceeded", err)
+		}
+	})
+
+	t.Run("stack size", func(t *testing.T) {
+		lock := "1" + strings.Repeat(" OP_DUP", MaxStackSize)
+		s, _ := Parse(lock)
+		if err := Verify(nil, s, Context{}); !errors.Is(err, ErrStackOverflow) {
+			t.Fatalf("Verify = %v, want ErrStackOverflow", err)
+		}
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	ctx := Context{SigHash: sigHash[:], Height: 50, Time: 1700000000}
+	sig := func(i int) []byte { return ed25519.Sign(testKeys[i], sigHash[:]) }
+	pub := func(i int) ed25519.PublicKey { return testKeys[i].Public().(ed25519.PublicKey) }
+	must := func(s Script, err error) Script {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	p2pkh := must(PayToWallet(pubHashHex(0)))
+	if err := Verify(must(UnlockPubKeyHash(sig(0), pub(0))), p2pkh, ctx); err != nil {
+		t.Errorf("PayToWallet: %v", err)
+	}
+	if _, err := PayToWallet("ms1234"); err == nil {
+		t.Error("PayToWallet accepted a non-hex wallet ID")
+	}
+
+	digest := sha256.Sum256([]byte("secret"))
+	if err := Verify(must(UnlockMultiSig([]byte("secret"))), must(HashLock(digest[:])), ctx); err != nil {
+		t.Errorf("HashLock: %v", err)
+	}
+
+	ms := must(MultiSig(2, []ed25519.PublicKey{pub(0), pub(1), pub(2)}))
+	if err := Verify(must(UnlockMultiSig(sig(1), sig(2))), ms, ctx); err != nil {
+		t.Errorf("MultiSig: %v", err)
+	}
+	if _, err := MultiSig(4, []ed25519.PublicKey{pub(0), pub(1), pub(2)}); err == nil {
+		t.Error("MultiSig accepted a threshold above the key count")
+	}
+
+	for _, tt := range []struct {
+		height, time int64
+		want         error
+	}{
+		{50, 0, nil},
+		{51, 0, ErrLocktimeNotReached},
+		{0, 1700000000, nil},
+		{0, 1700000001, ErrLocktimeNotReached},
+		{50, 1700000000, nil},
+	} {
+		s := must(TimeLocked(tt.height, tt.time, p2pkh))
+		if err := Verify(must(UnlockPubKeyHash(sig(0), pub(0))), s, ctx); !errors.Is(err, tt.want) {
+			t.Errorf("TimeLocked(%d, %d) = %v, want %v", tt.height, tt.time, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package script
+
+// Opcodes. Values follow Bitcoin Script where the meaning matches, so
+// scripts look familiar in hex; CHECKHEIGHTVERIFY and CHECKTIMEVERIFY take
+// the CHECKLOCKTIMEVERIFY and CHECKSEQUENCEVERIFY slots.
+const (
+	OP_0         byte = 0x00 // push an empty element (false)
+	OP_PUSHDATA1 byte = 0x4c // next byte is the length of the data to push
+	OP_PUSHDATA2 byte = 0x4d // next two bytes (little-endian) are the length
+	OP_1NEGATE   byte = 0x4f
+	OP_1         byte = 0x51 // OP_1 to OP_16 push the numbers 1 to 16
+	OP_16        byte = 0x60
+
+	OP_NOP    byte = 0x61
+	OP_IF     byte = 0x63
+	OP_NOTIF  byte = 0x64
+	OP_ELSE   byte = 0x67
+	OP_ENDIF  byte = 0x68
+	OP_VERIFY byte = 0x69
+	OP_RETURN byte = 0x6a
+
+	OP_DROP byte = 0x75
+	OP_DUP  byte = 0x76
+	OP_OVER byte = 0x78
+	OP_SWAP byte = 0x7c
+	OP_SIZE byte = 0x82
+
+	OP_EQUAL       byte = 0x87
+	OP_EQUALVERIFY byte = 0x88
+
+	OP_SHA256              byte = 0xa8
+	OP_CHECKSIG            byte = 0xac
+	OP_CHECKSIGVERIFY      byte = 0xad
+	OP_CHECKMULTISIG       byte = 0xae
+	OP_CHECKMULTISIGVERIFY byte = 0xaf
+
+	OP_CHECKHEIGHTVERIFY byte = 0xb1 // fail unless the chain has reached the height on top of the stack
+	OP_CHECKTIMEVERIFY   byte = 0xb2 // fail unless the clock has reached the unix time on top of the stack
+)
+
+// Execution costs. Every opcode costs opCost; hashing and signature checks
+// cost more, so the cost limit bounds the work a script can demand.
+const (
+	opCost       = 1
+	hashCost     = 10
+	checkSigCost = 100 // per key for CHECKMULTISIG
+)
+
+var opNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_OVER:                "OP_OVER",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKHEIGHTVERIFY:   "OP_CHECKHEIGHTVERIFY",
+	OP_CHECKTIMEVERIFY:     "OP_CHECKTIMEVERIFY",
+}
+
+var opCodes = func() map[string]byte {
+	m := make(map[string]byte, len(opNames))
+	for op, name := range opNames {
+		m[name] = op
+	}
+	return m
+}()
+
+// isSmallInt reports whether op pushes a number from 1 to 16
+func isSmallInt(op byte) bool {
+	return op >= OP_1 && op <= OP_16
+}
@@ -0,0 +1,345 @@
+// Package script implements a small, deterministic stack language for
+// output spending conditions. An output carries a locking script and the
+// input spending it carries an unlocking script; the input is valid when
+// running the unlocking script and then the locking script on the same
+// stack leaves a single true element.
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Limits on scripts and their execution
+const (
+	MaxScriptSize    = 10000
+	MaxElementSize   = 520
+	MaxStackSize     = 1000
+	MaxMultisigKeys  = 20
+	DefaultCostLimit = 10000
+	maxNumSize       = 8
+)
+
+// Script is a sequence of opcodes and data pushes
+type Script []byte
+
+// instruction is one decoded opcode with its push data
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+// decodeNext reads the instruction at s[pc:] and returns it with the
+// position of the next one
+func (s Script) decodeNext(pc int) (instruction, int, error) {
+	op := s[pc]
+	pc++
+	var n int
+	switch {
+	case op > OP_0 && op < OP_PUSHDATA1:
+		n = int(op)
+	case op == OP_PUSHDATA1:
+		if pc+1 > len(s) {
+			return instruction{}, 0, ErrMalformed
+		}
+		n = int(s[pc])
+		pc++
+	case op == OP_PUSHDATA2:
+		if pc+2 > len(s) {
+			return instruction{}, 0, ErrMalformed
+		}
+		n = int(binary.LittleEndian.Uint16(s[pc:]))
+		pc += 2
+	default:
+		return instruction{op: op}, pc, nil
+	}
+	if pc+n > len(s) {
+		return instruction{}, 0, ErrMalformed
+	}
+	return instruction{op: op, data: s[pc : pc+n]}, pc + n, nil
+}
+
+// instructions decodes the whole script
+func (s Script) instructions() ([]instruction, error) {
+	if len(s) > MaxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+	var ins []instruction
+	for pc := 0; pc < len(s); {
+		in, next, err := s.decodeNext(pc)
+		if err != nil {
+			return nil, err
+		}
+		ins = append(ins, in)
+		pc = next
+	}
+	return ins, nil
+}
+
+// Validate checks that the script decodes and is within the size limit
+func (s Script) Validate() error {
+	_, err := s.instructions()
+	return err
+}
+
+// MarshalText encodes the script as hex, its form in JSON
+func (s Script) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(s)), nil
+}
+
+// UnmarshalText decodes a hex script
+func (s *Script) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("script must be hex: %v", err)
+	}
+	*s = b
+	return nil
+}
+
+// IsPushOnly reports whether the script only pushes data, as unlocking
+// scripts must
+func (s Script) IsPushOnly() bool {
+	ins, err := s.instructions()
+	if err != nil {
+		return false
+	}
+	for _, in := range ins {
+		if in.op > OP_16 {
+			return false
+		}
+	}
+	return true
+}
+
+// PushedData returns the elements a push-only script leaves on the stack,
+// bottom first
+func (s Script) PushedData() ([][]byte, error) {
+	if !s.IsPushOnly() {
+		return nil, ErrUnlockNotPushOnly
+	}
+	ins, _ := s.instructions()
+	data := make([][]byte, len(ins))
+	for i, in := range ins {
+		switch {
+		case in.op == OP_1NEGATE:
+			data[i] = encodeNum(-1)
+		case isSmallInt(in.op):
+			data[i] = encodeNum(int64(in.op - OP_1 + 1))
+		default:
+			data[i] = in.data
+		}
+	}
+	return data, nil
+}
+
+// String disassembles the script, e.g.
+// "OP_DUP OP_SHA256 <ab12...> OP_EQUALVERIFY OP_CHECKSIG". Numbers pushed
+// with OP_0, OP_1NEGATE and OP_1 to OP_16 print as 0, -1 and 1 to 16.
+func (s Script) String() string {
+	ins, err := s.instructions()
+	if err != nil {
+		return "[invalid script: " + err.Error() + "]"
+	}
+	parts := make([]string, len(ins))
+	for i, in := range ins {
+		switch {
+		case in.op > OP_0 && in.op <= OP_PUSHDATA2:
+			parts[i] = "<" + hex.EncodeToString(in.data) + ">"
+		case in.op == OP_0:
+			parts[i] = "0"
+		case in.op == OP_1NEGATE:
+			parts[i] = "-1"
+		case isSmallInt(in.op):
+			parts[i] = strconv.Itoa(int(in.op - OP_1 + 1))
+		case opNames[in.op] != "":
+			parts[i] = opNames[in.op]
+		default:
+			parts[i] = fmt.Sprintf("OP_UNKNOWN_%#02x", in.op)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse assembles a script from its text form: opcode names (with or
+// without the OP_ prefix), decimal numbers and <hex> data pushes
+func Parse(asm string) (Script, error) {
+	var b Builder
+	for _, tok := range strings.Fields(asm) {
+		switch {
+		case strings.HasPrefix(tok, "<") && strings.HasSuffix(tok, ">"):
+			data, err := hex.DecodeString(tok[1 : len(tok)-1])
+			if err != nil {
+				return nil, fmt.Errorf("bad data push %s: %v", tok, err)
+			}
+			b.AddData(data)
+		case isNumber(tok):
+			n, err := strconv.ParseInt(tok, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %s: %v", tok, err)
+			}
+			b.AddInt(n)
+		default:
+			name := strings.ToUpper(tok)
+			if !strings.HasPrefix(name, "OP_") {
+				name = "OP_" + name
+			}
+			op, ok := opCodes[name]
+			if !ok || op == OP_PUSHDATA1 || op == OP_PUSHDATA2 {
+				return nil, fmt.Errorf("unknown opcode %s", tok)
+			}
+			b.AddOp(op)
+		}
+	}
+	return b.Script()
+}
+
+func isNumber(tok string) bool {
+	if strings.HasPrefix(tok, "-") {
+		tok = tok[1:]
+	}
+	if tok == "" {
+		return false
+	}
+	for _, c := range tok {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Builder assembles a script, keeping the first error
+type Builder struct {
+	s   Script
+	err error
+}
+
+// AddOp appends an opcode
+func (b *Builder) AddOp(op byte) *Builder {
+	b.s = append(b.s, op)
+	return b
+}
+
+// AddData appends the smallest push of data
+func (b *Builder) AddData(data []byte) *Builder {
+	switch n := len(data); {
+	case n > MaxElementSize:
+		if b.err == nil {
+			b.err = ErrElementTooLarge
+		}
+	case n == 0:
+		b.s = append(b.s, OP_0)
+	case n < int(OP_PUSHDATA1):
+		b.s = append(append(b.s, byte(n)), data...)
+	case n <= 0xff:
+		b.s = append(append(b.s, OP_PUSHDATA1, byte(n)), data...)
+	default:
+		b.s = append(append(b.s, OP_PUSHDATA2, byte(n), byte(n>>8)), data...)
+	}
+	return b
+}
+
+// AddInt appends the smallest push of the number n
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(OP_1 + byte(n-1))
+	}
+	return b.AddData(encodeNum(n))
+}
+
+// Script returns the assembled script
+func (b *Builder) Script() (Script, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.s) > MaxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+	return b.s, nil
+}
+
+// encodeNum encodes n as a minimal little-endian sign-magnitude number,
+// the stack representation of numbers
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	neg := n < 0
+	m := uint64(n)
+	if neg {
+		m = uint64(-n)
+	}
+	var b []byte
+	for m > 0 {
+		b = append(b, byte(m))
+		m >>= 8
+	}
+	// The top bit of the last byte is the sign; add a byte if it is taken
+	if b[len(b)-1]&0x80 != 0 {
+		if neg {
+			b = append(b, 0x80)
+		} else {
+			b = append(b, 0x00)
+		}
+	} else if neg {
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
+
+// decodeNum decodes a number pushed on the stack. Encodings must be minimal
+// so that every number has exactly one form.
+func decodeNum(b []byte) (int64, error) {
+	if len(b) > maxNumSize {
+		return 0, ErrNumberRange
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	// A top byte of 0x00 or 0x80 is only allowed to hold the sign
+	if b[len(b)-1]&0x7f == 0 && (len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+		return 0, ErrNonMinimalNumber
+	}
+	var m uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		m = m<<8 | uint64(b[i])
+	}
+	top := uint64(0x80) << (8 * uint(len(b)-1))
+	if m&top != 0 {
+		return -int64(m &^ top), nil
+	}
+	return int64(m), nil
+}
+
+// Errors returned by Verify
+var (
+	ErrMalformed          = errors.New("script: push runs past the end of the script")
+	ErrScriptTooLarge     = errors.New("script: script too large")
+	ErrElementTooLarge    = errors.New("script: element too large")
+	ErrStackOverflow      = errors.New("script: stack too large")
+	ErrStackUnderflow     = errors.New("script: not enough elements on the stack")
+	ErrCostExceeded       = errors.New("script: execution cost limit exceeded")
+	ErrUnlockNotPushOnly  = errors.New("script: unlocking script may only push data")
+	ErrUnbalancedIf       = errors.New("script: unbalanced IF/ELSE/ENDIF")
+	ErrBadOpcode          = errors.New("script: unknown or disabled opcode")
+	ErrReturn             = errors.New("script: OP_RETURN executed")
+	ErrVerify             = errors.New("script: VERIFY failed")
+	ErrEvalFalse          = errors.New("script: finished with false on the stack")
+	ErrCleanStack         = errors.New("script: finished with more than one element on the stack")
+	ErrNumberRange        = errors.New("script: number out of range")
+	ErrNonMinimalNumber   = errors.New("script: number not minimally encoded")
+	ErrBadPublicKey       = errors.New("script: public key must be 32 bytes")
+	ErrTooManyKeys        = errors.New("script: too many multisig keys")
+	ErrLocktimeNotReached = errors.New("script: lock height or time not reached")
+	ErrNegativeLocktime   = errors.New("script: negative lock height or time")
+)
@@ -0,0 +1,216 @@
+package script
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNumEncoding(t *testing.T) {
+	tests := []struct {
+		n   int64
+		hex string
+	}{
+		{0, ""},
+		{1, "01"},
+		{-1, "81"},
+		{16, "10"},
+		{127, "7f"},
+		{128, "8000"},
+		{-128, "8080"},
+		{255, "ff00"},
+		{256, "0001"},
+		{-256, "0081"},
+		{32767, "ff7f"},
+		{32768, "008000"},
+		{1700000000, "00f15365"},
+		{1 << 40, "000000000001"},
+		{1<<63 - 1, "ffffffffffffff7f"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(encodeNum(tt.n))
+		if got != tt.hex {
+			t.Errorf("encodeNum(%d) = %s, want %s", tt.n, got, tt.hex)
+		}
+		n, err := decodeNum(encodeNum(tt.n))
+		if err != nil || n != tt.n {
+			t.Errorf("decodeNum(encodeNum(%d)) = %d, %v", tt.n, n, err)
+		}
+	}
+}
+
+func TestDecodeNumRejects(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want error
+	}{
+		{"00", ErrNonMinimalNumber},
+		{"80", ErrNonMinimalNumber},
+		{"0100", ErrNonMinimalNumber},
+		{"0180", ErrNonMinimalNumber},
+		{"000000000000000001", ErrNumberRange},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		if _, err := decodeNum(b); !errors.Is(err, tt.want) {
+			t.Errorf("decodeNum(%s) = %v, want %v", tt.hex, err, tt.want)
+		}
+	}
+}
+
+func TestParseAndString(t *testing.T) {
+	tests := []struct {
+		asm  string
+		hex  string
+		want string // disassembly, when it differs from asm
+	}{
+		{"OP_DUP OP_SHA256 <abcd> OP_EQUALVERIFY OP_CHECKSIG", "76a802abcd88ac", ""},
+		{"dup sha256 <abcd> equalverify checksig", "76a802abcd88ac", "OP_DUP OP_SHA256 <abcd> OP_EQUALVERIFY OP_CHECKSIG"},
+		{"0 -1 1 16", "004f5160", ""},
+		{"17 1000 -1000", "011102e80302e883", "<11> <e803> <e883>"},
+		{"<> <01>", "000101", "0 <01>"},
+		{"OP_IF 1 OP_ELSE 0 OP_ENDIF", "6351670068", ""},
+		{"100 OP_CHECKHEIGHTVERIFY OP_DROP", "0164b175", "<64> OP_CHECKHEIGHTVERIFY OP_DROP"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.asm)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.asm, err)
+			continue
+		}
+		if got := hex.EncodeToString(s); got != tt.hex {
+			t.Errorf("Parse(%q) = %s, want %s", tt.asm, got, tt.hex)
+		}
+		want := tt.want
+		if want == "" {
+			want = tt.asm
+		}
+		if got := s.String(); got != want {
+			t.Errorf("String() of %q = %q, want %q", tt.asm, got, want)
+		}
+		// The disassembly assembles back to the same bytes
+		again, err := Parse(s.String())
+		if err != nil || !bytes.Equal(again, s) {
+			t.Errorf("round trip of %q = %x, %v", tt.asm, again, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, asm := range []string{
+		"OP_BOGUS",
+		"<zz>",
+		"<abc>",
+		"OP_PUSHDATA1",
+		"99999999999999999999",
+		"<" + strings.Repeat("00", MaxElementSize+1) + ">",
+	} {
+		if _, err := Parse(asm); err == nil {
+			t.Errorf("Parse(%.40q) succeeded", asm)
+		}
+	}
+}
+
+func TestBuilderPushSizes(t *testing.T) {
+	tests := []struct {
+		size   int
+		prefix string
+	}{
+		{1, "01"},
+		{75, "4b"},
+		{76, "4c4c"},
+		{255, "4cff"},
+		{256, "4d0001"},
+		{MaxElementSize, "4d0802"},
+	}
+	for _, tt := range tests {
+		var b Builder
+		s, err := b.AddData(make([]byte, tt.size)).Script()
+		if err != nil {
+			t.Fatalf("push of %d bytes: %v", tt.size, err)
+		}
+		if got := hex.EncodeToString(s[:len(tt.prefix)/2]); got != tt.prefix {
+			t.Errorf("push of %d bytes starts %s, want %s", tt.size, got, tt.prefix)
+		}
+		ins, err := s.instructions()
+		if err != nil || len(ins) != 1 || len(ins[0].data) != tt.size {
+			t.Errorf("push of %d bytes decodes to %+v, %v", tt.size, ins, err)
+		}
+	}
+}
+
+func TestMalformedScripts(t *testing.T) {
+	for _, h := range []string{"05aabb", "4c", "4c05aa", "4d01", "4d0500aa"} {
+		s, _ := hex.DecodeString(h)
+		if _, err := Script(s).instructions(); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: %v, want ErrMalformed", h, err)
+		}
+		if Script(s).IsPushOnly() {
+			t.Errorf("%s: malformed script reported push-only", h)
+		}
+		if !strings.HasPrefix(Script(s).String(), "[invalid script") {
+			t.Errorf("%s: String() = %q", h, Script(s).String())
+		}
+	}
+}
+
+func TestIsPushOnly(t *testing.T) {
+	tests := []struct {
+		asm  string
+		want bool
+	}{
+		{"", true},
+		{"<aa> <bb>", true},
+		{"0 -1 16 1000", true},
+		{"<aa> OP_DUP", false},
+		{"OP_NOP", false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.asm)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.asm, err)
+		}
+		if got := s.IsPushOnly(); got != tt.want {
+			t.Errorf("IsPushOnly(%q) = %v, want %v", tt.asm, got, tt.want)
+		}
+	}
+}
+
+func TestScriptJSON(t *testing.T) {
+	s, _ := Parse("OP_DUP OP_SHA256 <abcd> OP_EQUALVERIFY OP_CHECKSIG")
+	b, err := json.Marshal(struct{ S Script }{s})
+	if err != nil || string(b) != `{"S":"76a802abcd88ac"}` {
+		t.Fatalf("Marshal = %s, %v", b, err)
+	}
+	var v struct{ S Script }
+	if err := json.Unmarshal(b, &v); err != nil || !bytes.Equal(v.S, s) {
+		t.Fatalf("Unmarshal = %x, %v", v.S, err)
+	}
+	if err := json.Unmarshal([]byte(`{"S":"zz"}`), &v); err == nil {
+		t.Error("Unmarshal accepted non-hex")
+	}
+}
+
+func TestPushedData(t *testing.T) {
+	s, _ := Parse("<aabb> 0 -1 16 <01>")
+	data, err := s.PushedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"aabb", "", "81", "10", "01"}
+	if len(data) != len(want) {
+		t.Fatalf("PushedData = %x", data)
+	}
+	for i := range want {
+		if hex.EncodeToString(data[i]) != want[i] {
+			t.Errorf("element %d = %x, want %s", i, data[i], want[i])
+		}
+	}
+	if _, err := Script([]byte{OP_DUP}).PushedData(); !errors.Is(err, ErrUnlockNotPushOnly) {
+		t.Errorf("PushedData of a non-push script: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package script
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+)
+
+// PayToPubKeyHash locks an output to the key whose SHA-256 hash is
+// pubKeyHash: OP_DUP OP_SHA256 <hash> OP_EQUALVERIFY OP_CHECKSIG. A
+// wallet ID is the hex of such a hash.
+func PayToPubKeyHash(pubKeyHash []byte) (Script, error) {
+	var b Builder
+	b.AddOp(OP_DUP).AddOp(OP_SHA256).AddData(pubKeyHash).AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG)
+	return b.Script()
+}
+
+// PayToWallet is PayToPubKeyHash for a wallet ID
+func PayToWallet(walletID string) (Script, error) {
+	h, err := hex.DecodeString(walletID)
+	if err != nil || len(h) != 32 {
+		return nil, fmt.Errorf("not a single-key wallet ID: %s", walletID)
+	}
+	return PayToPubKeyHash(h)
+}
+
+// UnlockPubKeyHash spends a PayToPubKeyHash output: <sig> <pub>
+func UnlockPubKeyHash(sig []byte, pub ed25519.PublicKey) (Script, error) {
+	var b Builder
+	b.AddData(sig).AddData(pub)
+	return b.Script()
+}
+
+// HashLock locks an output to whoever reveals the preimage of a SHA-256
+// hash: OP_SHA256 <hash> OP_EQUAL. It is unlocked with <preimage>.
+func HashLock(hash []byte) (Script, error) {
+	var b Builder
+	b.AddOp(OP_SHA256).AddData(hash).AddOp(OP_EQUAL)
+	return b.Script()
+}
+
+// TimeLocked prefixes inner with checks that the chain has reached height
+// and the clock has reached t (unix seconds). Zero skips a check.
+func TimeLocked(height, t int64, inner Script) (Script, error) {
+	var b Builder
+	if height > 0 {
+		b.AddInt(height).AddOp(OP_CHECKHEIGHTVERIFY).AddOp(OP_DROP)
+	}
+	if t > 0 {
+		b.AddInt(t).AddOp(OP_CHECKTIMEVERIFY).AddOp(OP_DROP)
+	}
+	b.s = append(b.s, inner...)
+	return b.Script()
+}
+
+// MultiSig locks an output to m of the given keys:
+// m <pub...> n OP_CHECKMULTISIG. Signatures must be given in key order.
+func MultiSig(m int, keys []ed25519.PublicKey) (Script, error) {
+	if len(keys) == 0 || len(keys) > MaxMultisigKeys {
+		return nil, ErrTooManyKeys
+	}
+	if m < 1 || m > len(keys) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d", len(keys))
+	}
+	var b Builder
+	b.AddInt(int64(m))
+	for _, k := range keys {
+		if len(k) != ed25519.PublicKeySize {
+			return nil, ErrBadPublicKey
+		}
+		b.AddData(k)
+	}
+	b.AddInt(int64(len(keys))).AddOp(OP_CHECKMULTISIG)
+	return b.Script()
+}
+
+// UnlockMultiSig spends a MultiSig output with signatures in key order
+func UnlockMultiSig(sigs ...[]byte) (Script, error) {
+	var b Builder
+	for _, s := range sigs {
+		b.AddData(s)
+	}
+	return b.Script()
+}
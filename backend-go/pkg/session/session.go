@@ -0,0 +1,108 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed or was not
+	// issued with this manager's key
+	ErrInvalidToken = errors.New("invalid session token")
+	// ErrExpired is returned for a correctly signed token past its expiry
+	ErrExpired = errors.New("session expired")
+)
+
+// Claims identify the user behind a session and the wallets it may act on.
+// Admin sessions may also use the operator endpoints.
+type Claims struct {
+	UserID    string   `json:"uid"`
+	Wallets   []string `json:"wallets"`
+	Admin     bool     `json:"admin,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// HasWallet reports whether the session is authorised for walletID
+func (c *Claims) HasWallet(walletID string) bool {
+	return slices.Contains(c.Wallets, walletID)
+}
+
+// Manager issues and verifies stateless session tokens. A token is the
+// base64url JSON claims and their HMAC-SHA256, joined by a dot.
+type Manager struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewManager returns a manager that signs with key and issues tokens valid
+// for ttl
+func NewManager(key []byte, ttl time.Duration) (*Manager, error) {
+	if len(key) < 32 {
+		return nil, fmt.Errorf("session key must be at least 32 bytes")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("session ttl must be positive")
+	}
+	return &Manager{key: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Issue returns a token for userID authorised for the given wallets
+func (m *Manager) Issue(userID string, wallets []string) (string, *Claims, error) {
+	return m.issue(&Claims{UserID: userID, Wallets: wallets})
+}
+
+// IssueAdmin is Issue for an operator, whose session is also an admin one
+func (m *Manager) IssueAdmin(userID string, wallets []string) (string, *Claims, error) {
+	return m.issue(&Claims{UserID: userID, Wallets: wallets, Admin: true})
+}
+
+func (m *Manager) issue(c *Claims) (string, *Claims, error) {
+	now := m.now()
+	c.IssuedAt = now.Unix()
+	c.ExpiresAt = now.Add(m.ttl).Unix()
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", nil, err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(m.mac(body)), c, nil
+}
+
+// Verify checks a token's signature and expiry and returns its claims
+func (m *Manager) Verify(token string) (*Claims, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, m.mac(body)) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+	if m.now().Unix() >= c.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &c, nil
+}
+
+func (m *Manager) mac(body string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(body))
+	return h.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(bytes.Repeat([]byte{7}, 32), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestIssueVerify(t *testing.T) {
+	m := testManager(t)
+	token, issued, err := m.Issue("user-1", []string{"w1", "w2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := m.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if c.UserID != "user-1" || c.ExpiresAt != issued.ExpiresAt {
+		t.Fatalf("claims = %+v, issued %+v", c, issued)
+	}
+	if !c.HasWallet("w2") || c.HasWallet("w3") {
+		t.Fatalf("wallets = %v", c.Wallets)
+	}
+}
+
+func TestIssueAdmin(t *testing.T) {
+	m := testManager(t)
+	user, _, _ := m.Issue("user-1", nil)
+	admin, _, _ := m.IssueAdmin("user-2", nil)
+	if c, err := m.Verify(user); err != nil || c.Admin {
+		t.Fatalf("user session = %+v, %v", c, err)
+	}
+	if c, err := m.Verify(admin); err != nil || !c.Admin || c.UserID != "user-2" {
+		t.Fatalf("admin session = %+v, %v", c, err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	m := testManager(t)
+	token, _, _ := m.Issue("user-1", []string{"w1"})
+	body, sig, _ := strings.Cut(token, ".")
+
+	other, _ := NewManager(bytes.Repeat([]byte{8}, 32), time.Hour)
+	forged, _, _ := other.Issue("user-1", []string{"w1", "victim"})
+	forgedBody, _, _ := strings.Cut(forged, ".")
+
+	for name, tok := range map[string]string{
+		"no dot":        body,
+		"bad signature": body + ".AAAA",
+		"swapped body":  forgedBody + "." + sig,
+		"other key":     forged,
+		"empty":         "",
+	} {
+		if _, err := m.Verify(tok); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	m := testManager(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	token, _, _ := m.Issue("user-1", nil)
+
+	now = now.Add(59 * time.Minute)
+	if _, err := m.Verify(token); err != nil {
+		t.Fatalf("before expiry: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := m.Verify(token); !errors.Is(err, ErrExpired) {
+		t.Fatalf("after expiry: err = %v, want ErrExpired", err)
+	}
+}
+
+func TestNewManagerValidates(t *testing.T) {
+	if _, err := NewManager([]byte("short"), time.Hour); err == nil {
+		t.Error("short key accepted")
+	}
+	if _, err := NewManager(bytes.Repeat([]byte{1}, 32), 0); err == nil {
+		t.Error("zero ttl accepted")
+	}
+}
@@ -0,0 +1,87 @@
+package tx
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sort"
+
+	"blockchain-wallet/pkg/utxo"
+)
+
+// NewIssuance creates a transaction minting amount of an asset to receiver.
+// It has no inputs; its sender is the issuer's wallet and the issuer key
+// signs it.
+func NewIssuance(issuerID, assetID, receiver string, amount int64, note string) *Transaction {
+	t := NewTransaction(issuerID, receiver, amount, note, nil)
+	t.Asset = assetID
+	t.ID = t.ComputeID()
+	return t
+}
+
+// VerifyIssuance checks that t mints a positive amount of its asset and is
+// signed by issuer from the issuer's wallet
+func VerifyIssuance(t *Transaction, issuer ed25519.PublicKey) error {
+	if t.Asset == "" {
+		return errors.New("issuance must name the asset it mints")
+	}
+	if len(t.InputUTXOs) != 0 {
+		return errors.New("issuance cannot spend inputs")
+	}
+	if t.Lock != nil {
+		return errors.New("issued outputs cannot be locked")
+	}
+	if t.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !bytes.Equal(t.SenderPub, issuer) {
+		return errors.New("not signed by the asset's issuer key")
+	}
+	return t.VerifySigner()
+}
+
+// CheckConservation checks that, for every asset, the outputs of a
+// transaction add up to exactly its inputs, so a transfer neither creates
+// nor destroys units and cannot pay in one asset with another
+func CheckConservation(inputs, outputs []*utxo.UTXO) error {
+	totals := map[string]int64{}
+	for _, u := range inputs {
+		totals[u.Asset] += u.Amount
+	}
+	for _, u := range outputs {
+		if u.Amount <= 0 {
+			return errors.New("outputs must be positive")
+		}
+		totals[u.Asset] -= u.Amount
+	}
+
+	assets := make([]string, 0, len(totals))
+	for a, diff := range totals {
+		if diff != 0 {
+			assets = append(assets, a)
+		}
+	}
+	if len(assets) == 0 {
+		return nil
+	}
+	sort.Strings(assets)
+	name := assets[0]
+	if name == "" {
+		name = "native coin"
+	}
+	if totals[assets[0]] > 0 {
+		return fmt.Errorf("%s: inputs exceed outputs by %d", name, totals[assets[0]])
+	}
+	return fmt.Errorf("%s: outputs exceed inputs by %d", name, -totals[assets[0]])
+}
+
+// Outputs returns the outputs t creates when it spends inputs worth total
+// of its asset: the receiver's output and any change back to the sender
+func (t *Transaction) Outputs(total int64) []*utxo.UTXO {
+	outs := []*utxo.UTXO{{ID: t.ID + "_recv", Owner: t.ReceiverID, Amount: t.Amount, Lock: t.Lock, Asset: t.Asset}}
+	if change := total - t.Amount; change > 0 {
+		outs = append(outs, &utxo.UTXO{ID: t.ID + "_change", Owner: t.SenderID, Amount: change, Asset: t.Asset})
+	}
+	return outs
+}
@@ -0,0 +1,96 @@
+package tx
+
+import (
+	"strings"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/utxo"
+)
+
+func TestVerifyIssuance(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeypair()
+	otherPriv, otherPub, _ := crypto.GenerateKeypair()
+	issue := func() *Transaction {
+		t := NewIssuance(crypto.WalletIDFromPub(pub), "asset-1", "wallet-a", 500, "launch")
+		t.SenderPub = pub
+		t.Signature = crypto.SignPayload(priv, t.Payload())
+		return t
+	}
+	if err := VerifyIssuance(issue(), pub); err != nil {
+		t.Fatalf("valid issuance rejected: %v", err)
+	}
+	if native := NewTransaction(crypto.WalletIDFromPub(pub), "wallet-a", 500, "launch", nil); native.ID == issue().ID {
+		t.Error("the asset should be part of the transaction ID")
+	}
+
+	cases := map[string]func(t *Transaction){
+		"other key": func(t *Transaction) {
+			t.SenderPub = otherPub
+			t.Signature = crypto.SignPayload(otherPriv, t.Payload())
+		},
+		"tampered amount": func(t *Transaction) { t.Amount = 5000 },
+		"other sender":    func(t *Transaction) { t.SenderID = "wallet-b" },
+		"with inputs":     func(t *Transaction) { t.InputUTXOs = []string{"u1"} },
+		"native":          func(t *Transaction) { t.Asset = "" },
+		"zero amount":     func(t *Transaction) { t.Amount = 0 },
+		"locked":          func(t *Transaction) { t.Lock = &utxo.Lock{Kind: utxo.LockTime, Height: 5} },
+	}
+	for name, mutate := range cases {
+		txx := issue()
+		mutate(txx)
+		if VerifyIssuance(txx, pub) == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCheckConservation(t *testing.T) {
+	out := func(asset string, amount int64) *utxo.UTXO { return &utxo.UTXO{Asset: asset, Amount: amount} }
+	tests := []struct {
+		name    string
+		ins     []*utxo.UTXO
+		outs    []*utxo.UTXO
+		wantErr string
+	}{
+		{"native with change", []*utxo.UTXO{out("", 70), out("", 40)}, []*utxo.UTXO{out("", 100), out("", 10)}, ""},
+		{"token", []*utxo.UTXO{out("pts", 30)}, []*utxo.UTXO{out("pts", 30)}, ""},
+		{"mixed balanced", []*utxo.UTXO{out("", 5), out("pts", 30)}, []*utxo.UTXO{out("pts", 30), out("", 5)}, ""},
+		{"inflation", []*utxo.UTXO{out("", 10)}, []*utxo.UTXO{out("", 11)}, "native coin: outputs exceed inputs by 1"},
+		{"burn", []*utxo.UTXO{out("pts", 10)}, []*utxo.UTXO{out("pts", 9)}, "pts: inputs exceed outputs by 1"},
+		{"pay coin with token", []*utxo.UTXO{out("pts", 50)}, []*utxo.UTXO{out("", 50)}, "native coin: outputs exceed inputs by 50"},
+		{"negative output", []*utxo.UTXO{out("", 10)}, []*utxo.UTXO{out("", 20), out("", -10)}, "outputs must be positive"},
+	}
+	for _, tt := range tests {
+		err := CheckConservation(tt.ins, tt.outs)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOutputsCarryAsset(t *testing.T) {
+	txx := NewTransaction("wallet-a", "wallet-b", 30, "", []string{"u1"})
+	txx.Asset = "pts"
+	outs := txx.Outputs(45)
+	if len(outs) != 2 || outs[0].Owner != "wallet-b" || outs[1].Owner != "wallet-a" || outs[1].Amount != 15 {
+		t.Fatalf("unexpected outputs %+v %+v", outs[0], outs[len(outs)-1])
+	}
+	for _, o := range outs {
+		if o.Asset != "pts" {
+			t.Errorf("output %s holds %q, want pts", o.ID, o.Asset)
+		}
+	}
+	if err := CheckConservation([]*utxo.UTXO{{Asset: "pts", Amount: 45}}, outs); err != nil {
+		t.Error(err)
+	}
+	if len(txx.Outputs(30)) != 1 {
+		t.Error("no change output expected for an exact spend")
+	}
+}
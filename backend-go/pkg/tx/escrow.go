@@ -0,0 +1,71 @@
+package tx
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/utxo"
+)
+
+// Escrow actions
+const (
+	EscrowRelease = "release" // pay the escrow to its payee
+	EscrowRefund  = "refund"  // return the escrow to its payer
+)
+
+// Approval is one party's signature over an escrow action
+type Approval struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Signature []byte            `json:"signature"`
+}
+
+// EscrowPayload is what the parties sign to release or refund an escrow
+// output
+func EscrowPayload(action, utxoID string) []byte {
+	return []byte("escrow:" + action + ":" + utxoID)
+}
+
+// VerifyEscrowSpend checks that approvals authorise action on the escrow
+// output u at the given chain height and unix time. A release needs the
+// arbiter and either the payer or the payee; a refund needs the payer and
+// a matured lock. It returns the receiver of the spend.
+func VerifyEscrowSpend(action string, u *utxo.UTXO, approvals []Approval, height, now int64) (string, error) {
+	if u.Lock == nil || u.Lock.Kind != utxo.LockEscrow {
+		return "", errors.New("output is not an escrow")
+	}
+	if u.Spent {
+		return "", errors.New("escrow already settled")
+	}
+
+	payload := EscrowPayload(action, u.ID)
+	signed := make(map[string]bool, len(approvals))
+	for _, a := range approvals {
+		if len(a.PublicKey) != ed25519.PublicKeySize || !crypto.VerifySignature(a.PublicKey, payload, a.Signature) {
+			return "", errors.New("invalid escrow approval signature")
+		}
+		signed[crypto.WalletIDFromPub(a.PublicKey)] = true
+	}
+
+	switch action {
+	case EscrowRelease:
+		if !signed[u.Lock.Arbiter] {
+			return "", errors.New("release needs the arbiter's approval")
+		}
+		if !signed[u.Owner] && !signed[u.Lock.Payee] {
+			return "", errors.New("release needs the payer's or the payee's approval")
+		}
+		return u.Lock.Payee, nil
+	case EscrowRefund:
+		if !signed[u.Owner] {
+			return "", errors.New("refund needs the payer's approval")
+		}
+		if !u.Lock.Matured(height, now) {
+			return "", fmt.Errorf("escrow cannot be refunded until %s", u.Lock.Until())
+		}
+		return u.Owner, nil
+	default:
+		return "", fmt.Errorf("unknown escrow action %q", action)
+	}
+}
@@ -0,0 +1,69 @@
+package tx
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/utxo"
+)
+
+func TestVerifyEscrowSpend(t *testing.T) {
+	type party struct {
+		priv ed25519.PrivateKey
+		id   string
+	}
+	newParty := func() party {
+		priv, pub, err := crypto.GenerateKeypair()
+		if err != nil {
+			t.Fatalf("key gen: %v", err)
+		}
+		return party{priv, crypto.WalletIDFromPub(pub)}
+	}
+	payer, payee, arbiter, outsider := newParty(), newParty(), newParty(), newParty()
+
+	u := &utxo.UTXO{ID: "esc-1", Owner: payer.id, Amount: 30,
+		Lock: &utxo.Lock{Kind: utxo.LockEscrow, Height: 5, Payee: payee.id, Arbiter: arbiter.id}}
+	approve := func(action string, ps ...party) []Approval {
+		var as []Approval
+		for _, p := range ps {
+			as = append(as, Approval{
+				PublicKey: p.priv.Public().(ed25519.PublicKey),
+				Signature: crypto.SignPayload(p.priv, EscrowPayload(action, u.ID)),
+			})
+		}
+		return as
+	}
+
+	if to, err := VerifyEscrowSpend(EscrowRelease, u, approve(EscrowRelease, payee, arbiter), 0, 0); err != nil || to != payee.id {
+		t.Fatalf("release by payee and arbiter = %q, %v", to, err)
+	}
+	if _, err := VerifyEscrowSpend(EscrowRelease, u, approve(EscrowRelease, payer, arbiter), 0, 0); err != nil {
+		t.Fatalf("release by payer and arbiter: %v", err)
+	}
+	if _, err := VerifyEscrowSpend(EscrowRelease, u, approve(EscrowRelease, payer, payee), 0, 0); err == nil {
+		t.Fatal("release without the arbiter accepted")
+	}
+	if _, err := VerifyEscrowSpend(EscrowRelease, u, approve(EscrowRelease, arbiter, outsider), 0, 0); err == nil {
+		t.Fatal("release by the arbiter alone accepted")
+	}
+	// A signature over another action does not count
+	if _, err := VerifyEscrowSpend(EscrowRelease, u, approve(EscrowRefund, payee, arbiter), 0, 0); err == nil {
+		t.Fatal("refund approval accepted for a release")
+	}
+
+	if _, err := VerifyEscrowSpend(EscrowRefund, u, approve(EscrowRefund, payer), 4, 0); err == nil {
+		t.Fatal("refund before the timeout accepted")
+	}
+	if to, err := VerifyEscrowSpend(EscrowRefund, u, approve(EscrowRefund, payer), 5, 0); err != nil || to != payer.id {
+		t.Fatalf("refund after the timeout = %q, %v", to, err)
+	}
+	if _, err := VerifyEscrowSpend(EscrowRefund, u, approve(EscrowRefund, payee, arbiter), 5, 0); err == nil {
+		t.Fatal("refund without the payer accepted")
+	}
+
+	plain := &utxo.UTXO{ID: "u-1", Owner: payer.id, Amount: 30}
+	if _, err := VerifyEscrowSpend(EscrowRefund, plain, approve(EscrowRefund, payer), 5, 0); err == nil {
+		t.Fatal("escrow spend of an ordinary output accepted")
+	}
+}
@@ -0,0 +1,85 @@
+package tx
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"blockchain-wallet/pkg/script"
+	"blockchain-wallet/pkg/utxo"
+)
+
+// SigHash is the message unlocking scripts sign: the hash of the payload
+// and inputs, i.e. the transaction ID in binary
+func (t *Transaction) SigHash() []byte {
+	h := sha256.New()
+	h.Write(t.Payload())
+	for _, in := range t.InputUTXOs {
+		h.Write([]byte(in))
+	}
+	return h.Sum(nil)
+}
+
+// VerifyScriptSpend checks that each input of t is a script-locked output
+// and that the matching unlocking script satisfies it at the given chain
+// height and unix time. The inputs must all belong to t's sender and t must
+// spend them in full.
+func VerifyScriptSpend(t *Transaction, inputs []*utxo.UTXO, unlocks []script.Script, height, now int64) error {
+	if len(inputs) == 0 || len(inputs) != len(t.InputUTXOs) || len(unlocks) != len(inputs) {
+		return errors.New("need one unlocking script per input")
+	}
+	sigHash := t.SigHash()
+	var total int64
+	for i, u := range inputs {
+		if u.ID != t.InputUTXOs[i] {
+			return fmt.Errorf("input %d is not %s", i, t.InputUTXOs[i])
+		}
+		if u.Lock == nil || u.Lock.Kind != utxo.LockScript {
+			return fmt.Errorf("input %s is not script-locked", u.ID)
+		}
+		if u.Spent {
+			return fmt.Errorf("input %s already spent", u.ID)
+		}
+		if u.Owner != t.SenderID {
+			return fmt.Errorf("input %s does not belong to %s", u.ID, t.SenderID)
+		}
+		ctx := script.Context{SigHash: sigHash, Height: height, Time: now}
+		if err := script.Verify(unlocks[i], u.Lock.Script, ctx); err != nil {
+			return fmt.Errorf("input %s: %w", u.ID, err)
+		}
+		total += u.Amount
+	}
+	if total != t.Amount {
+		return fmt.Errorf("amount %d does not match inputs totalling %d", t.Amount, total)
+	}
+	return nil
+}
+
+// EncodeUnlockScripts packs per-input unlocking scripts for storage in a
+// transaction's Signature, each prefixed with its length as a uint16
+func EncodeUnlockScripts(unlocks []script.Script) []byte {
+	var b []byte
+	for _, s := range unlocks {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// DecodeUnlockScripts reverses EncodeUnlockScripts
+func DecodeUnlockScripts(b []byte) ([]script.Script, error) {
+	var unlocks []script.Script
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("truncated unlocking scripts")
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, errors.New("truncated unlocking scripts")
+		}
+		unlocks = append(unlocks, script.Script(b[2:2+n]))
+		b = b[2+n:]
+	}
+	return unlocks, nil
+}
@@ -0,0 +1,84 @@
+package tx
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"blockchain-wallet/pkg/crypto"
+	"blockchain-wallet/pkg/script"
+	"blockchain-wallet/pkg/utxo"
+)
+
+func TestVerifyScriptSpend(t *testing.T) {
+	priv, pub, err := crypto.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("key gen: %v", err)
+	}
+	owner := crypto.WalletIDFromPub(pub)
+	p2pkh, err := script.PayToWallet(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := script.TimeLocked(10, 0, p2pkh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := []*utxo.UTXO{
+		{ID: "a", Owner: owner, Amount: 30, Lock: &utxo.Lock{Kind: utxo.LockScript, Script: p2pkh}},
+		{ID: "b", Owner: owner, Amount: 20, Lock: &utxo.Lock{Kind: utxo.LockScript, Script: locked}},
+	}
+	txx := NewTransaction(owner, "receiver", 50, "", []string{"a", "b"})
+	unlock := func(tx *Transaction) []script.Script {
+		sig := ed25519.Sign(priv, tx.SigHash())
+		u, _ := script.UnlockPubKeyHash(sig, pub)
+		return []script.Script{u, u}
+	}
+
+	if got := hex.EncodeToString(txx.SigHash()); got != txx.ID {
+		t.Fatalf("SigHash %s is not the ID %s", got, txx.ID)
+	}
+	if err := VerifyScriptSpend(txx, inputs, unlock(txx), 10, 0); err != nil {
+		t.Fatalf("valid spend: %v", err)
+	}
+	if err := VerifyScriptSpend(txx, inputs, unlock(txx), 9, 0); !errors.Is(err, script.ErrLocktimeNotReached) {
+		t.Fatalf("spend before the lock height: %v", err)
+	}
+
+	// Signatures commit to the whole transaction
+	other := NewTransaction(owner, "someone else", 50, "", []string{"a", "b"})
+	if err := VerifyScriptSpend(other, inputs, unlock(txx), 10, 0); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("signature from another transaction: %v", err)
+	}
+
+	short := NewTransaction(owner, "receiver", 40, "", []string{"a", "b"})
+	if err := VerifyScriptSpend(short, inputs, unlock(short), 10, 0); err == nil {
+		t.Fatal("partial spend accepted")
+	}
+	if err := VerifyScriptSpend(txx, inputs, unlock(txx)[:1], 10, 0); err == nil {
+		t.Fatal("missing unlocking script accepted")
+	}
+	plain := []*utxo.UTXO{{ID: "a", Owner: owner, Amount: 30}, inputs[1]}
+	if err := VerifyScriptSpend(txx, plain, unlock(txx), 10, 0); err == nil {
+		t.Fatal("unlocked input accepted")
+	}
+}
+
+func TestUnlockScriptsEncoding(t *testing.T) {
+	unlocks := []script.Script{{0x51}, nil, bytes.Repeat([]byte{0xaa}, 300)}
+	got, err := DecodeUnlockScripts(EncodeUnlockScripts(unlocks))
+	if err != nil || len(got) != len(unlocks) {
+		t.Fatalf("round trip = %v, %v", got, err)
+	}
+	for i := range unlocks {
+		if !bytes.Equal(got[i], unlocks[i]) {
+			t.Errorf("script %d = %x, want %x", i, got[i], unlocks[i])
+		}
+	}
+	if _, err := DecodeUnlockScripts([]byte{0, 5, 1}); err == nil {
+		t.Error("truncated scripts decoded")
+	}
+}
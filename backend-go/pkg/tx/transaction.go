@@ -1,10 +1,14 @@
 package tx
 
 import (
-    "crypto/sha256"
+    "crypto/ed25519"
     "encoding/hex"
+    "errors"
     "fmt"
     "time"
+
+    "blockchain-wallet/pkg/crypto"
+    "blockchain-wallet/pkg/utxo"
 )
 
 // Transaction represents a UTXO-style transaction
@@ -18,22 +22,26 @@ type Transaction struct {
     SenderPub   []byte
     Signature   []byte
     InputUTXOs  []string // IDs of UTXOs being spent
+    Lock        *utxo.Lock // condition on the receiver's output, if any
+    Asset       string     // asset moved; empty for the native coin
 }
 
-// Payload returns the byte payload that should be signed: sender+receiver+amount+timestamp+note
+// Payload returns the byte payload that should be signed: sender+receiver+amount+timestamp+note,
+// followed by the output lock and asset when there are any
 func (t *Transaction) Payload() []byte {
     s := fmt.Sprintf("%s|%s|%d|%d|%s", t.SenderID, t.ReceiverID, t.Amount, t.Timestamp, t.Note)
+    if t.Lock != nil {
+        s += "|lock:" + t.Lock.String()
+    }
+    if t.Asset != "" {
+        s += "|asset:" + t.Asset
+    }
     return []byte(s)
 }
 
 // ComputeID computes a deterministic ID for the transaction from its payload and inputs
 func (t *Transaction) ComputeID() string {
-    h := sha256.New()
-    h.Write(t.Payload())
-    for _, in := range t.InputUTXOs {
-        h.Write([]byte(in))
-    }
-    return hex.EncodeToString(h.Sum(nil))
+    return hex.EncodeToString(t.SigHash())
 }
 
 // NewTransaction creates a transaction with timestamp and computes ID
@@ -49,3 +57,29 @@ func NewTransaction(sender, receiver string, amount int64, note string, inputs [
     t.ID = t.ComputeID()
     return t
 }
+
+// VerifySigner checks a single-key transaction: the signature must verify
+// against SenderPub and SenderID must be the wallet ID of that key, so a key
+// can only spend its own wallet's outputs
+func (t *Transaction) VerifySigner() error {
+    return t.verifySigner(t.Payload())
+}
+
+// VerifySigHashSigner is VerifySigner for a signature over the signature
+// hash, as made for signed packets (see pkg/psbt)
+func (t *Transaction) VerifySigHashSigner() error {
+    return t.verifySigner(t.SigHash())
+}
+
+func (t *Transaction) verifySigner(msg []byte) error {
+    if len(t.SenderPub) != ed25519.PublicKeySize {
+        return errors.New("invalid sender public key")
+    }
+    if crypto.WalletIDFromPub(t.SenderPub) != t.SenderID {
+        return errors.New("sender_id does not match public key")
+    }
+    if !crypto.VerifySignature(t.SenderPub, msg, t.Signature) {
+        return errors.New("signature invalid")
+    }
+    return nil
+}
@@ -2,8 +2,8 @@ package tx
 
 import (
     "testing"
-    "blockchain-wallet/backend/pkg/crypto"
-    "blockchain-wallet/backend/pkg/utxo"
+    "blockchain-wallet/pkg/crypto"
+    "blockchain-wallet/pkg/utxo"
 )
 
 func TestTransactionSignAndUTXOFlow(t *testing.T) {
@@ -54,3 +54,52 @@ func TestTransactionSignAndUTXOFlow(t *testing.T) {
         t.Fatalf("double-spend allowed")
     }
 }
+
+func TestVerifySigner(t *testing.T) {
+    priv, pub, _ := crypto.GenerateKeypair()
+    _, otherPub, _ := crypto.GenerateKeypair()
+
+    txx := NewTransaction(crypto.WalletIDFromPub(pub), "receiver", 5, "", nil)
+    txx.SenderPub = pub
+    txx.Signature = crypto.SignPayload(priv, txx.Payload())
+    if err := txx.VerifySigner(); err != nil {
+        t.Fatalf("valid transaction rejected: %v", err)
+    }
+
+    // A valid signature by a key that does not own the sender wallet
+    stolen := NewTransaction(crypto.WalletIDFromPub(otherPub), "receiver", 5, "", nil)
+    stolen.SenderPub = pub
+    stolen.Signature = crypto.SignPayload(priv, stolen.Payload())
+    if err := stolen.VerifySigner(); err == nil {
+        t.Fatalf("spend from another wallet accepted")
+    }
+
+    txx.Amount = 6
+    if err := txx.VerifySigner(); err == nil {
+        t.Fatalf("tampered transaction accepted")
+    }
+}
+
+func TestPayloadCoversLock(t *testing.T) {
+    priv, pub, err := crypto.GenerateKeypair()
+    if err != nil {
+        t.Fatalf("key gen: %v", err)
+    }
+    txx := NewTransaction(crypto.WalletIDFromPub(pub), "receiver", 10, "vesting", nil)
+    txx.Lock = &utxo.Lock{Kind: utxo.LockTime, Height: 100}
+    txx.SenderPub = pub
+    txx.Signature = crypto.SignPayload(priv, txx.Payload())
+    if err := txx.VerifySigner(); err != nil {
+        t.Fatalf("VerifySigner: %v", err)
+    }
+
+    // Shortening the lock invalidates the signature
+    txx.Lock.Height = 1
+    if err := txx.VerifySigner(); err == nil {
+        t.Fatal("tampered lock accepted")
+    }
+    txx.Lock = nil
+    if err := txx.VerifySigner(); err == nil {
+        t.Fatal("removed lock accepted")
+    }
+}
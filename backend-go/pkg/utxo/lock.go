@@ -0,0 +1,145 @@
+package utxo
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"blockchain-wallet/pkg/script"
+)
+
+// Lock kinds
+const (
+	LockTime   = "time"   // spendable by the owner once the height and time are reached
+	LockEscrow = "escrow" // held for a payee; see Lock.Payee and Lock.Arbiter
+	LockScript = "script" // spendable by whoever satisfies Lock.Script
+)
+
+// Escrow states, derived from whether and to whom the output was spent
+const (
+	EscrowHeld     = "held"
+	EscrowReleased = "released"
+	EscrowRefunded = "refunded"
+)
+
+var (
+	// ErrLocked is returned for a time-locked output that has not matured
+	ErrLocked = errors.New("output is time-locked")
+	// ErrEscrowed is returned when an escrow output is spent other than by
+	// release or refund
+	ErrEscrowed = errors.New("output is held in escrow")
+	// ErrScripted is returned when a script-locked output is spent without
+	// an unlocking script
+	ErrScripted = errors.New("output is locked by a script")
+)
+
+// Lock is a spending condition on an output.
+//
+// A time lock makes the output spendable once the chain has reached Height
+// and the clock has reached Time (unix seconds); either may be zero.
+//
+// An escrow output stays with the payer (its owner) until it is released to
+// Payee, which needs the Arbiter's co-signature, or refunded to the payer
+// once Height and Time are reached.
+//
+// A script-locked output is spent by an input whose unlocking script
+// satisfies Script; time conditions are part of the script.
+type Lock struct {
+	Kind    string        `json:"kind"`
+	Height  int64         `json:"height,omitempty"`
+	Time    int64         `json:"time,omitempty"`
+	Payee   string        `json:"payee,omitempty"`
+	Arbiter string        `json:"arbiter,omitempty"`
+	Script  script.Script `json:"script,omitempty"` // hex in JSON
+}
+
+// Validate checks that the lock is well formed
+func (l *Lock) Validate() error {
+	if l.Height < 0 || l.Time < 0 {
+		return errors.New("lock height and time must not be negative")
+	}
+	if l.Kind != LockScript && len(l.Script) > 0 {
+		return fmt.Errorf("%s lock takes no script", l.Kind)
+	}
+	switch l.Kind {
+	case LockTime:
+		if l.Height == 0 && l.Time == 0 {
+			return errors.New("time lock needs a height or a time")
+		}
+		if l.Payee != "" || l.Arbiter != "" {
+			return errors.New("time lock takes no payee or arbiter")
+		}
+	case LockEscrow:
+		if l.Payee == "" || l.Arbiter == "" {
+			return errors.New("escrow needs a payee and an arbiter")
+		}
+		if l.Payee == l.Arbiter {
+			return errors.New("escrow payee and arbiter must differ")
+		}
+		if l.Height == 0 && l.Time == 0 {
+			return errors.New("escrow needs a refund height or time")
+		}
+	case LockScript:
+		if len(l.Script) == 0 {
+			return errors.New("script lock needs a script")
+		}
+		if l.Height != 0 || l.Time != 0 || l.Payee != "" || l.Arbiter != "" {
+			return errors.New("script lock takes only a script")
+		}
+		return l.Script.Validate()
+	default:
+		return fmt.Errorf("unknown lock kind %q", l.Kind)
+	}
+	return nil
+}
+
+// Matured reports whether the chain height and unix time have reached the
+// lock's height and time
+func (l *Lock) Matured(height, now int64) bool {
+	return height >= l.Height && now >= l.Time
+}
+
+// CheckSpend reports whether an output with this lock can be spent by its
+// owner in an ordinary transfer. A nil lock never blocks.
+func (l *Lock) CheckSpend(height, now int64) error {
+	if l == nil {
+		return nil
+	}
+	switch l.Kind {
+	case LockEscrow:
+		return ErrEscrowed
+	case LockScript:
+		return ErrScripted
+	}
+	if !l.Matured(height, now) {
+		return fmt.Errorf("%w until %s", ErrLocked, l.Until())
+	}
+	return nil
+}
+
+// Until describes when the lock matures, e.g. "height 10 and time 1700000000"
+func (l *Lock) Until() string {
+	var parts []string
+	if l.Height > 0 {
+		parts = append(parts, "height "+strconv.FormatInt(l.Height, 10))
+	}
+	if l.Time > 0 {
+		parts = append(parts, "time "+strconv.FormatInt(l.Time, 10))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// String is the canonical form of the lock, covered by transaction
+// signatures. Script locks end with the script in hex.
+func (l *Lock) String() string {
+	if l == nil {
+		return ""
+	}
+	s := fmt.Sprintf("%s:%d:%d:%s:%s", l.Kind, l.Height, l.Time, l.Payee, l.Arbiter)
+	if l.Kind == LockScript {
+		s += ":" + hex.EncodeToString(l.Script)
+	}
+	return s
+}
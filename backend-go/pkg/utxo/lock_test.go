@@ -0,0 +1,61 @@
+package utxo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLockValidate(t *testing.T) {
+	valid := []Lock{
+		{Kind: LockTime, Height: 5},
+		{Kind: LockTime, Time: 1700000000},
+		{Kind: LockEscrow, Time: 1700000000, Payee: "b", Arbiter: "c"},
+		{Kind: LockScript, Script: []byte{0x51}},
+	}
+	for _, l := range valid {
+		if err := l.Validate(); err != nil {
+			t.Errorf("%+v: %v", l, err)
+		}
+	}
+	invalid := []Lock{
+		{Kind: LockTime},
+		{Kind: LockTime, Height: -1, Time: 5},
+		{Kind: LockTime, Height: 5, Payee: "b"},
+		{Kind: LockEscrow, Time: 5, Payee: "b"},
+		{Kind: LockEscrow, Time: 5, Payee: "b", Arbiter: "b"},
+		{Kind: LockEscrow, Payee: "b", Arbiter: "c"},
+		{Kind: "hash", Height: 5},
+		{Kind: LockScript},
+		{Kind: LockScript, Height: 5, Script: []byte{0x51}},
+		{Kind: LockScript, Script: []byte{0x05, 0x01}},
+		{Kind: LockTime, Height: 5, Script: []byte{0x51}},
+	}
+	for _, l := range invalid {
+		if err := l.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", l)
+		}
+	}
+}
+
+func TestLockedUTXOSpend(t *testing.T) {
+	m := NewManager()
+	vest := m.AddLockedUTXO("owner", 100, &Lock{Kind: LockTime, Height: 10, Time: 1000})
+	escrow := m.AddLockedUTXO("owner", 50, &Lock{Kind: LockEscrow, Time: 1000, Payee: "b", Arbiter: "c"})
+
+	if err := m.Spend(vest, "owner"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Spend of a time-locked UTXO: %v", err)
+	}
+	if err := m.SpendAt(vest, "owner", 9, 2000); !errors.Is(err, ErrLocked) {
+		t.Fatalf("SpendAt below the lock height: %v", err)
+	}
+	if err := m.SpendAt(vest, "owner", 10, 1000); err != nil {
+		t.Fatalf("SpendAt a matured UTXO: %v", err)
+	}
+	if err := m.SpendAt(escrow, "owner", 100, 5000); !errors.Is(err, ErrEscrowed) {
+		t.Fatalf("SpendAt of an escrow UTXO: %v", err)
+	}
+	scripted := m.AddLockedUTXO("owner", 10, &Lock{Kind: LockScript, Script: []byte{0x51}})
+	if err := m.SpendAt(scripted, "owner", 100, 5000); !errors.Is(err, ErrScripted) {
+		t.Fatalf("SpendAt of a script-locked UTXO: %v", err)
+	}
+}
@@ -14,6 +14,8 @@ type UTXO struct {
     Owner  string
     Amount int64
     Spent  bool
+    Lock   *Lock // nil for an ordinary output
+    Asset  string // empty for the native coin
 }
 
 // Manager holds UTXOs in-memory (not persistent). Safe for simple tests.
@@ -29,13 +31,24 @@ func NewManager() *Manager {
 
 // AddUTXO adds a UTXO and returns its ID
 func (m *Manager) AddUTXO(owner string, amount int64) string {
+    return m.AddLockedUTXO(owner, amount, nil)
+}
+
+// AddLockedUTXO adds a UTXO with a spending condition and returns its ID
+func (m *Manager) AddLockedUTXO(owner string, amount int64, lock *Lock) string {
+    return m.AddAssetUTXO(owner, "", amount, lock)
+}
+
+// AddAssetUTXO adds a UTXO holding amount of asset, with an optional
+// spending condition, and returns its ID
+func (m *Manager) AddAssetUTXO(owner, asset string, amount int64, lock *Lock) string {
     m.mu.Lock()
     defer m.mu.Unlock()
     // create id by hashing owner+amount+len
-    key := owner + ":" + fmt.Sprintf("%d", amount) + ":" + fmt.Sprintf("%d", len(m.set))
+    key := owner + ":" + asset + ":" + fmt.Sprintf("%d", amount) + ":" + fmt.Sprintf("%d", len(m.set))
     h := sha256.Sum256([]byte(key))
     id := hex.EncodeToString(h[:])
-    u := &UTXO{ID: id, Owner: owner, Amount: amount, Spent: false}
+    u := &UTXO{ID: id, Owner: owner, Amount: amount, Spent: false, Lock: lock, Asset: asset}
     m.set[id] = u
     return id
 }
@@ -53,21 +66,33 @@ func (m *Manager) GetUnspentByOwner(owner string) []*UTXO {
     return res
 }
 
-// Balance returns sum of unspent UTXOs for owner
+// Balance returns sum of unspent native-coin UTXOs for owner
 func (m *Manager) Balance(owner string) int64 {
+    return m.AssetBalance(owner, "")
+}
+
+// AssetBalance returns sum of unspent UTXOs of asset for owner
+func (m *Manager) AssetBalance(owner, asset string) int64 {
     m.mu.Lock()
     defer m.mu.Unlock()
     var sum int64
     for _, u := range m.set {
-        if !u.Spent && u.Owner == owner {
+        if !u.Spent && u.Owner == owner && u.Asset == asset {
             sum += u.Amount
         }
     }
     return sum
 }
 
-// Spend marks a UTXO as spent; returns error if already spent or not found
+// Spend marks a UTXO as spent; returns error if already spent or not found.
+// Locked UTXOs are refused; use SpendAt for those.
 func (m *Manager) Spend(utxoID, owner string) error {
+    return m.SpendAt(utxoID, owner, 0, 0)
+}
+
+// SpendAt is Spend at the given chain height and unix time, so time-locked
+// UTXOs that have matured can be spent
+func (m *Manager) SpendAt(utxoID, owner string, height, now int64) error {
     m.mu.Lock()
     defer m.mu.Unlock()
     u, ok := m.set[utxoID]
@@ -80,6 +105,9 @@ func (m *Manager) Spend(utxoID, owner string) error {
     if u.Spent {
         return errors.New("utxo already spent")
     }
+    if err := u.Lock.CheckSpend(height, now); err != nil {
+        return err
+    }
     u.Spent = true
     return nil
 }
@@ -29,3 +29,18 @@ func TestUTXOAddSpendBalance(t *testing.T) {
         t.Fatalf("expected double-spend to fail")
     }
 }
+
+func TestAssetBalancesAreSeparate(t *testing.T) {
+    m := NewManager()
+    owner := "alice"
+    m.AddUTXO(owner, 100)
+    m.AddAssetUTXO(owner, "pts", 40, nil)
+    m.AddAssetUTXO(owner, "pts", 2, nil)
+
+    if bal := m.Balance(owner); bal != 100 {
+        t.Fatalf("native balance should exclude tokens, got %d", bal)
+    }
+    if bal := m.AssetBalance(owner, "pts"); bal != 42 {
+        t.Fatalf("expected 42 pts, got %d", bal)
+    }
+}
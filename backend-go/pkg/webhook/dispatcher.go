@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"blockchain-wallet/pkg/jobs"
+)
+
+// Config tunes delivery
+type Config struct {
+	Client      *http.Client
+	MaxAttempts int           // attempts before a delivery is dead-lettered
+	BaseBackoff time.Duration // wait after the first failure, doubled each time
+	MaxBackoff  time.Duration
+	Lease       time.Duration // how long a claimed delivery is reserved
+	BatchSize   int
+}
+
+// DefaultConfig retries for roughly a day before dead-lettering. Its client
+// only delivers to public addresses (see NewClient).
+func DefaultConfig() Config {
+	return Config{
+		Client:      NewClient(10 * time.Second),
+		MaxAttempts: 10,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  6 * time.Hour,
+		Lease:       time.Minute,
+		BatchSize:   100,
+	}
+}
+
+// Backoff returns how long to wait after the given failed attempt (1-based)
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// maxErrorBody bounds how much of a failed response is kept in the log
+const maxErrorBody = 256
+
+// Dispatcher queues events in the outbox and delivers them. Its Run method
+// is registered with the job runner; Kick delivers new events right away.
+type Dispatcher struct {
+	store Store
+	cfg   Config
+	clock jobs.Clock
+
+	mu      sync.Mutex
+	running bool
+	again   bool
+}
+
+// NewDispatcher creates a dispatcher. Zero config fields take their defaults.
+func NewDispatcher(store Store, cfg Config, clock jobs.Clock) *Dispatcher {
+	def := DefaultConfig()
+	if cfg.Client == nil {
+		cfg.Client = def.Client
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = def.Lease
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if clock == nil {
+		clock = jobs.SystemClock
+	}
+	return &Dispatcher{store: store, cfg: cfg, clock: clock}
+}
+
+// Enqueue queues an event about subject (such as a transaction ID) for
+// every endpoint of walletID that subscribes to eventType, and returns how
+// many endpoints it was queued for
+func (d *Dispatcher) Enqueue(ctx context.Context, walletID, eventType, subject string, data interface{}) (int, error) {
+	endpoints, err := d.store.GetActiveWebhookEndpoints(ctx, walletID)
+	if err != nil {
+		return 0, fmt.Errorf("load webhook endpoints: %w", err)
+	}
+
+	now := d.clock.Now().UTC()
+	var body []byte
+	var ds []Delivery
+	for _, e := range endpoints {
+		if !e.Wants(eventType) {
+			continue
+		}
+		if body == nil {
+			raw, err := json.Marshal(data)
+			if err != nil {
+				return 0, fmt.Errorf("encode %s event: %w", eventType, err)
+			}
+			body, err = json.Marshal(Envelope{ID: EventID(eventType, subject), Type: eventType, CreatedAt: now, Data: raw})
+			if err != nil {
+				return 0, err
+			}
+		}
+		ds = append(ds, Delivery{
+			EndpointID:    e.ID,
+			EventID:       EventID(eventType, subject),
+			EventType:     eventType,
+			Payload:       body,
+			Status:        StatusPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(ds) == 0 {
+		return 0, nil
+	}
+	if err := d.store.InsertWebhookDeliveries(ctx, ds); err != nil {
+		return 0, fmt.Errorf("queue webhook deliveries: %w", err)
+	}
+	return len(ds), nil
+}
+
+// Run sends every delivery that is due. A failed delivery is rescheduled
+// or dead-lettered; it does not fail the run.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		now := d.clock.Now()
+		due, err := d.store.ClaimWebhookDeliveries(ctx, now, now.Add(d.cfg.Lease), d.cfg.BatchSize)
+		if err != nil {
+			return fmt.Errorf("claim webhook deliveries: %w", err)
+		}
+		for _, job := range due {
+			if err := d.deliver(ctx, job); err != nil {
+				return err
+			}
+		}
+		if len(due) < d.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+// Kick starts a Run in the background, or asks the one in progress to go
+// round again so newly queued events are not left for the next tick
+func (d *Dispatcher) Kick() {
+	d.mu.Lock()
+	if d.running {
+		d.again = true
+		d.mu.Unlock()
+		return
+	}
+	d.running = true
+	d.mu.Unlock()
+
+	go func() {
+		for {
+			if err := d.Run(context.Background()); err != nil {
+				log.Printf("Warning: webhook delivery failed: %v", err)
+			}
+			d.mu.Lock()
+			if !d.again {
+				d.running = false
+				d.mu.Unlock()
+				return
+			}
+			d.again = false
+			d.mu.Unlock()
+		}
+	}()
+}
+
+// deliver POSTs one delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, job Due) error {
+	del := job.Delivery
+	start := d.clock.Now()
+	status, sendErr := d.send(ctx, job.Endpoint, del, start)
+	finished := d.clock.Now()
+
+	del.Attempts++
+	att := Attempt{
+		DeliveryID:  del.ID,
+		Attempt:     del.Attempts,
+		AttemptedAt: start,
+		StatusCode:  status,
+		DurationMs:  finished.Sub(start).Milliseconds(),
+	}
+	del.LastAttemptAt = &start
+	del.LastStatusCode = status
+	del.LastError = ""
+
+	switch {
+	case sendErr == nil:
+		del.Status = StatusDelivered
+		del.DeliveredAt = &finished
+	case del.Attempts >= d.cfg.MaxAttempts:
+		del.Status = StatusDead
+	default:
+		del.Status = StatusPending
+		del.NextAttemptAt = finished.Add(Backoff(del.Attempts, d.cfg.BaseBackoff, d.cfg.MaxBackoff))
+	}
+	if sendErr != nil {
+		att.Error = sendErr.Error()
+		del.LastError = att.Error
+	}
+
+	if err := d.store.RecordWebhookAttempt(ctx, del, att); err != nil {
+		return fmt.Errorf("record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// send POSTs the payload and returns the response status; any non-2xx
+// response is an error
+func (d *Dispatcher) send(ctx context.Context, e Endpoint, del Delivery, ts time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blockchain-wallet-webhooks/1")
+	req.Header.Set(HeaderID, del.ID)
+	req.Header.Set(HeaderEvent, del.EventType)
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(ts.Unix()))
+	req.Header.Set(HeaderSignature, Sign(e.Secret, ts, del.Payload))
+
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	return resp.StatusCode, nil
+}
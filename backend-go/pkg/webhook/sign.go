@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request headers set on every delivery
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// DefaultTolerance is how old a signed timestamp receivers should accept
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrBadSignature is returned when a signature does not match the body
+	ErrBadSignature = errors.New("webhook signature mismatch")
+	// ErrStaleTimestamp is returned when the signed timestamp is outside
+	// the tolerance, which guards against replayed requests
+	ErrStaleTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign returns the signature header for body sent at ts: "t=<unix>,v1=<hex>"
+// where v1 is HMAC-SHA256 over "<unix>.<body>" keyed with the secret
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// VerifySignature checks a signature header as a receiver would. A zero
+// tolerance skips the timestamp check.
+func VerifySignature(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrBadSignature
+	}
+
+	want := mac(secret, t, body)
+	ok := false
+	for _, s := range sigs {
+		ok = ok || hmac.Equal(s, want)
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrStaleTimestamp
+		}
+	}
+	return nil
+}
+
+func mac(secret, t string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned when an endpoint resolves to an address on
+// the node's own network, such as loopback, a private range or the cloud
+// metadata service. Merchants' endpoints are on the public internet, and
+// letting users aim requests elsewhere would let them probe the node's
+// network.
+var ErrForbiddenTarget = errors.New("webhook target is not a public address")
+
+// blockedPrefixes are ranges netip has no predicate for
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can reach IPv4 private space
+}
+
+// PublicAddr reports whether ip may be the target of a webhook
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost refuses URL hosts that are plainly internal: localhost names
+// and non-public IP literals. Names are checked again when dialled, since
+// they may resolve anywhere.
+func checkHost(host string) error {
+	h := strings.TrimSuffix(strings.ToLower(host), ".")
+	if h == "localhost" || strings.HasSuffix(h, ".localhost") {
+		return ErrForbiddenTarget
+	}
+	if ip, err := netip.ParseAddr(strings.Trim(h, "[]")); err == nil && !PublicAddr(ip) {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
+
+// dialControl runs after a name is resolved and before connecting, so it
+// sees the address actually dialled even if DNS changes between checks
+func dialControl(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook dial %s: %w", address, err)
+	}
+	if !PublicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, ap.Addr())
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client deliveries are sent with. It only
+// connects to public addresses and does not use a proxy, which would
+// connect on its behalf.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        20,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Event types merchants can subscribe to
+const (
+	EventPaymentReceived  = "payment.received"
+	EventPaymentConfirmed = "payment.confirmed"
+)
+
+// EventTypes returns every event type in a stable order
+func EventTypes() []string {
+	return []string{EventPaymentReceived, EventPaymentConfirmed}
+}
+
+// ValidEventType reports whether t is a known event type
+func ValidEventType(t string) bool {
+	return slices.Contains(EventTypes(), t)
+}
+
+// Delivery statuses. A dead delivery has used up its attempts and sits in
+// the dead-letter queue until it is replayed.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Endpoint is a URL registered by a user to receive events for a wallet
+type Endpoint struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	WalletID  string    `json:"wallet_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the endpoint is created
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the endpoint subscribes to eventType
+func (e Endpoint) Wants(eventType string) bool {
+	return e.Active && slices.Contains(e.Events, eventType)
+}
+
+// Delivery is one event queued for one endpoint in the outbox
+type Delivery struct {
+	ID             string          `json:"id"`
+	EndpointID     string          `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Attempt is one POST of a delivery, kept as the delivery log
+type Attempt struct {
+	DeliveryID  string    `json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// Due is a claimed delivery together with the endpoint it goes to
+type Due struct {
+	Delivery Delivery
+	Endpoint Endpoint
+}
+
+// Store is the outbox persistence the dispatcher needs
+type Store interface {
+	// GetActiveWebhookEndpoints returns the active endpoints of a wallet
+	GetActiveWebhookEndpoints(ctx context.Context, walletID string) ([]Endpoint, error)
+	// InsertWebhookDeliveries queues deliveries, skipping any event an
+	// endpoint already has
+	InsertWebhookDeliveries(ctx context.Context, ds []Delivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at
+	// now and pushes their next attempt to leaseUntil, so a crashed sender
+	// does not strand them and concurrent senders do not double-send
+	ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Due, error)
+	// RecordWebhookAttempt saves the delivery's new state and logs the attempt
+	RecordWebhookAttempt(ctx context.Context, d Delivery, a Attempt) error
+}
+
+// Envelope is the JSON body POSTed to endpoints
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// EventID derives a stable ID for an event about subject, so the same
+// payment is never queued twice for an endpoint
+func EventID(eventType, subject string) string {
+	sum := sha256.Sum256([]byte(eventType + "\x00" + subject))
+	return "evt_" + hex.EncodeToString(sum[:16])
+}
+
+// NewSecret returns a random signing secret for a new endpoint
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ValidateEndpoint checks the user supplied fields of an endpoint
+func ValidateEndpoint(e Endpoint) error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if err := checkHost(u.Hostname()); err != nil {
+		return err
+	}
+	if len(e.Events) == 0 {
+		return fmt.Errorf("at least one event type required")
+	}
+	for _, t := range e.Events {
+		if !ValidEventType(t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
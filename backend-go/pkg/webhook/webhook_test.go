@@ -0,0 +1,380 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time                         { return c.now }
+func (c *fakeClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// memStore is an in-memory outbox
+type memStore struct {
+	mu         sync.Mutex
+	endpoints  []Endpoint
+	deliveries []*Delivery
+	attempts   []Attempt
+}
+
+func (m *memStore) GetActiveWebhookEndpoints(ctx context.Context, walletID string) ([]Endpoint, error) {
+	var out []Endpoint
+	for _, e := range m.endpoints {
+		if e.WalletID == walletID && e.Active {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) InsertWebhookDeliveries(ctx context.Context, ds []Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+next:
+	for _, d := range ds {
+		for _, have := range m.deliveries {
+			if have.EndpointID == d.EndpointID && have.EventID == d.EventID {
+				continue next
+			}
+		}
+		d.ID = fmt.Sprintf("d%d", len(m.deliveries)+1)
+		m.deliveries = append(m.deliveries, &d)
+	}
+	return nil
+}
+
+func (m *memStore) ClaimWebhookDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]Due, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Due
+	for _, d := range m.deliveries {
+		if len(out) == limit {
+			break
+		}
+		if d.Status != StatusPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		for _, e := range m.endpoints {
+			if e.ID == d.EndpointID && e.Active {
+				d.NextAttemptAt = leaseUntil
+				out = append(out, Due{Delivery: *d, Endpoint: e})
+			}
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) RecordWebhookAttempt(ctx context.Context, d Delivery, a Attempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, have := range m.deliveries {
+		if have.ID == d.ID {
+			m.deliveries[i] = &d
+		}
+	}
+	m.attempts = append(m.attempts, a)
+	return nil
+}
+
+// receiver is an httptest endpoint that verifies signatures and answers
+// with the queued status codes, then 200
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	got      []Envelope
+	sigErrs  []error
+	secret   string
+	clock    *fakeClock
+}
+
+func newReceiver(t *testing.T, secret string, clock *fakeClock, statuses ...int) *receiver {
+	rc := &receiver{statuses: statuses, secret: secret, clock: clock}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		rc.sigErrs = append(rc.sigErrs, VerifySignature(rc.secret, r.Header.Get(HeaderSignature), body, rc.clock.now, DefaultTolerance))
+		var env Envelope
+		json.Unmarshal(body, &env)
+		rc.got = append(rc.got, env)
+		status := http.StatusOK
+		if len(rc.statuses) > 0 {
+			status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, "receiver says hi")
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func setup(t *testing.T, statuses ...int) (*memStore, *receiver, *Dispatcher, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	rc := newReceiver(t, "whsec_test", clock, statuses...)
+	store := &memStore{endpoints: []Endpoint{
+		{ID: "e1", WalletID: "shop", URL: rc.URL, Secret: "whsec_test", Events: []string{EventPaymentReceived, EventPaymentConfirmed}, Active: true},
+		{ID: "e2", WalletID: "shop", URL: rc.URL, Secret: "whsec_test", Events: []string{EventPaymentConfirmed}, Active: true},
+		{ID: "e3", WalletID: "other", URL: rc.URL, Secret: "whsec_test", Events: EventTypes(), Active: true},
+	}}
+	// The receiver listens on loopback, which the default client refuses
+	d := NewDispatcher(store, Config{Client: rc.Client(), MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: 10 * time.Minute}, clock)
+	return store, rc, d, clock
+}
+
+func TestEnqueueFiltersEndpointsAndDeduplicates(t *testing.T) {
+	store, _, d, _ := setup(t)
+	ctx := context.Background()
+
+	n, err := d.Enqueue(ctx, "shop", EventPaymentReceived, "tx1", map[string]int64{"amount": 5})
+	if err != nil || n != 1 {
+		t.Fatalf("Enqueue = %d, %v; want 1 endpoint", n, err)
+	}
+	if n, _ := d.Enqueue(ctx, "shop", EventPaymentConfirmed, "tx1", nil); n != 2 {
+		t.Fatalf("confirmed queued for %d endpoints, want 2", n)
+	}
+	// Queuing the same event again is a no-op in the outbox
+	d.Enqueue(ctx, "shop", EventPaymentReceived, "tx1", map[string]int64{"amount": 5})
+	if len(store.deliveries) != 3 {
+		t.Fatalf("outbox has %d deliveries, want 3", len(store.deliveries))
+	}
+
+	var env Envelope
+	if err := json.Unmarshal(store.deliveries[0].Payload, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != EventID(EventPaymentReceived, "tx1") || env.Type != EventPaymentReceived || string(env.Data) != `{"amount":5}` {
+		t.Fatalf("envelope = %+v", env)
+	}
+}
+
+func TestRunDeliversSignedPayloads(t *testing.T) {
+	store, rc, d, _ := setup(t)
+	ctx := context.Background()
+	d.Enqueue(ctx, "shop", EventPaymentReceived, "tx1", map[string]string{"tx_id": "tx1"})
+
+	if err := d.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.got) != 1 || rc.got[0].Type != EventPaymentReceived {
+		t.Fatalf("receiver got %+v", rc.got)
+	}
+	if rc.sigErrs[0] != nil {
+		t.Fatalf("signature did not verify: %v", rc.sigErrs[0])
+	}
+	del := store.deliveries[0]
+	if del.Status != StatusDelivered || del.Attempts != 1 || del.DeliveredAt == nil || del.LastStatusCode != 200 {
+		t.Fatalf("delivery = %+v", del)
+	}
+	if len(store.attempts) != 1 || store.attempts[0].StatusCode != 200 || store.attempts[0].Error != "" {
+		t.Fatalf("attempts = %+v", store.attempts)
+	}
+
+	// Nothing left to send
+	d.Run(ctx)
+	if len(rc.got) != 1 {
+		t.Fatalf("delivered %d times", len(rc.got))
+	}
+}
+
+func TestRunRetriesWithBackoffThenDeadLetters(t *testing.T) {
+	store, rc, d, clock := setup(t, 500, 503, 502)
+	ctx := context.Background()
+	d.Enqueue(ctx, "shop", EventPaymentReceived, "tx1", nil)
+	start := clock.now
+
+	d.Run(ctx)
+	del := store.deliveries[0]
+	if del.Status != StatusPending || del.Attempts != 1 || !del.NextAttemptAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("after first failure: %+v", del)
+	}
+	if del.LastError != "HTTP 500: receiver says hi" {
+		t.Fatalf("last error = %q", del.LastError)
+	}
+
+	// Not due yet
+	clock.now = start.Add(59 * time.Second)
+	d.Run(ctx)
+	if len(rc.got) != 1 {
+		t.Fatalf("retried early: %d requests", len(rc.got))
+	}
+
+	clock.now = start.Add(time.Minute)
+	d.Run(ctx)
+	if del := store.deliveries[0]; del.Attempts != 2 || !del.NextAttemptAt.Equal(clock.now.Add(2*time.Minute)) {
+		t.Fatalf("after second failure: %+v", del)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	d.Run(ctx)
+	del = store.deliveries[0]
+	if del.Status != StatusDead || del.Attempts != 3 {
+		t.Fatalf("after last attempt: %+v", del)
+	}
+	if len(store.attempts) != 3 || store.attempts[2].StatusCode != 502 {
+		t.Fatalf("attempt log = %+v", store.attempts)
+	}
+
+	// Dead letters stay put
+	clock.now = clock.now.Add(time.Hour)
+	d.Run(ctx)
+	if len(rc.got) != 3 {
+		t.Fatalf("dead delivery was retried: %d requests", len(rc.got))
+	}
+}
+
+func TestRunRecordsConnectionErrors(t *testing.T) {
+	store, rc, d, _ := setup(t)
+	rc.Close()
+	d.Enqueue(context.Background(), "shop", EventPaymentReceived, "tx1", nil)
+
+	if err := d.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	del := store.deliveries[0]
+	if del.Status != StatusPending || del.LastStatusCode != 0 || del.LastError == "" {
+		t.Fatalf("delivery = %+v", del)
+	}
+}
+
+func TestKickDelivers(t *testing.T) {
+	store, _, d, _ := setup(t)
+	d.Enqueue(context.Background(), "other", EventPaymentConfirmed, "tx9", nil)
+	d.Kick()
+	d.Kick()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.Lock()
+		status := store.deliveries[0].Status
+		store.mu.Unlock()
+		if status == StatusDelivered {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("kicked delivery was not sent")
+}
+
+func TestBackoff(t *testing.T) {
+	var got []time.Duration
+	for i := 1; i <= 6; i++ {
+		got = append(got, Backoff(i, 30*time.Second, 5*time.Minute))
+	}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Backoff = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	header := Sign("s3cret", now, body)
+
+	if err := VerifySignature("s3cret", header, body, now.Add(time.Minute), DefaultTolerance); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := VerifySignature("s3cret", header, []byte(`{"id":"evt_2"}`), now, DefaultTolerance); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("tampered body: %v", err)
+	}
+	if err := VerifySignature("other", header, body, now, DefaultTolerance); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("wrong secret: %v", err)
+	}
+	if err := VerifySignature("s3cret", header, body, now.Add(time.Hour), DefaultTolerance); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("stale timestamp: %v", err)
+	}
+	if err := VerifySignature("s3cret", "v1=abcd", body, now, 0); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("missing timestamp: %v", err)
+	}
+	// Receivers accept any listed v1 so secrets can be rotated
+	rotated := Sign("old", now, body) + "," + header[len("t=1700000000,"):]
+	if err := VerifySignature("s3cret", rotated, body, now, DefaultTolerance); err != nil {
+		t.Errorf("rotated header rejected: %v", err)
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	ok := Endpoint{URL: "https://shop.example/hooks", Events: []string{EventPaymentReceived}}
+	if err := ValidateEndpoint(ok); err != nil {
+		t.Fatalf("valid endpoint rejected: %v", err)
+	}
+	bad := []Endpoint{
+		{URL: "ftp://shop.example", Events: ok.Events},
+		{URL: "/relative", Events: ok.Events},
+		{URL: ok.URL},
+		{URL: ok.URL, Events: []string{"payment.refunded"}},
+		{URL: "http://localhost:8080/hooks", Events: ok.Events},
+		{URL: "http://127.0.0.1/hooks", Events: ok.Events},
+		{URL: "http://10.1.2.3/hooks", Events: ok.Events},
+		{URL: "http://169.254.169.254/latest/meta-data", Events: ok.Events},
+		{URL: "http://[::1]:9000/", Events: ok.Events},
+		{URL: "http://[::ffff:192.168.0.1]/", Events: ok.Events},
+	}
+	for _, e := range bad {
+		if ValidateEndpoint(e) == nil {
+			t.Errorf("accepted %+v", e)
+		}
+	}
+
+	types := EventTypes()
+	sort.Strings(types)
+	if len(types) != 2 || !ValidEventType(types[0]) {
+		t.Fatalf("event types = %v", types)
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.0.0.8":        false,
+		"172.16.5.4":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.100.100.200": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+		"64:ff9b::a00:1":  false,
+	} {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestDefaultClientRefusesInternalTargets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	// The dialled address is checked, so a name resolving to loopback fails the same way
+	resp, err := DefaultConfig().Client.Post(srv.URL, "application/json", strings.NewReader("{}"))
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("delivery to loopback succeeded")
+	}
+	if !errors.Is(err, ErrForbiddenTarget) {
+		t.Fatalf("err = %v, want ErrForbiddenTarget", err)
+	}
+}
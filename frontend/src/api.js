@@ -52,8 +52,18 @@ export const walletAPI = {
 
   // FIX: Backend expects query param ?wallet=...
   getBalance: (walletId) => api.get(`/wallet/balance?wallet=${walletId}`),
-  getHistory: (walletId, limit = 10) =>
-    api.get(`/wallet/history?wallet=${walletId}&limit=${limit}`),
+  // Checks an address or legacy hex wallet ID for typos; no lookup
+  validateAddress: (address) =>
+    api.get("/address/validate", { params: { address } }),
+  // options: a page size, or { limit, cursor, direction, from, to,
+  // counterparty, min_amount, max_amount, type, status, q }
+  getHistory: (walletId, options = 10) =>
+    api.get("/wallet/history", {
+      params: {
+        wallet: walletId,
+        ...(typeof options === "number" ? { limit: options } : options),
+      },
+    }),
 
   signup: (email, fullName, cnic) =>
     api.post("/auth/signup", { email, full_name: fullName, cnic }),
@@ -68,6 +78,41 @@ export const walletAPI = {
     }),
 
   login: (email, password) => api.post("/auth/login", { email, password }),
+
+  // Keystore backups; sessionToken is the session_token from login
+  exportKeystore: (sessionToken, walletId, passphrase) =>
+    api.post(
+      "/wallet/export",
+      { wallet_id: walletId, passphrase },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  importKeystore: (sessionToken, keystore, passphrase) =>
+    api.post(
+      "/wallet/import",
+      { keystore, passphrase },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+};
+
+// Recipient directory; sessionToken is the session_token from login. q is
+// an address, a registered email or an @alias.
+export const directoryAPI = {
+  lookup: (sessionToken, q) =>
+    api.get("/directory/lookup", {
+      params: { q },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  setAlias: (sessionToken, walletId, alias) =>
+    api.post(
+      "/directory/alias",
+      { wallet_id: walletId, alias },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  removeAlias: (sessionToken, walletId) =>
+    api.delete("/directory/alias", {
+      params: { wallet_id: walletId },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
 };
 
 // Transaction endpoints
@@ -76,6 +121,9 @@ export const transactionAPI = {
   submit: (transaction) => api.post("/tx/sign-and-submit", transaction),
   // Legacy submit endpoint (requires pre-signed transaction)
   submitSigned: (transaction) => api.post("/tx/submit", transaction),
+  // Build an unsigned packet for offline signing, and submit it once signed
+  build: (transfer) => api.post("/tx/build", transfer),
+  submitPSBT: (psbt) => api.post("/tx/submit", { psbt }),
   getHistory: () => api.get("/tx/history"),
   // Get full transaction details including signature
   getDetails: (txId) => api.get(`/tx/details?tx_id=${txId}`),
@@ -90,6 +138,18 @@ export const blockchainAPI = {
   getPending: () => api.get("/blockchain/pending"),
 };
 
+// Explorer endpoints backed by the aggregate tables
+export const explorerAPI = {
+  getBlocks: (params) => api.get("/explorer/blocks", { params }),
+  getBlock: (params) => api.get("/explorer/block", { params }),
+  getAddress: (walletId) =>
+    api.get("/explorer/address", { params: { wallet: walletId } }),
+  getRichList: (limit = 20) =>
+    api.get("/explorer/richlist", { params: { limit } }),
+  getSeries: (days = 30) => api.get("/explorer/series", { params: { days } }),
+  getStats: () => api.get("/explorer/stats"),
+};
+
 // Profile endpoints
 export const profileAPI = {
   // FIX: Backend expects query param ?wallet_id=...
@@ -135,10 +195,357 @@ export const authAPI = {
     }),
 };
 
-// Zakat endpoints
+// Standing orders of the session's user; sessionToken is the token from
+// login
+export const ordersAPI = {
+  list: (sessionToken) =>
+    api.get("/orders/list", {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  runs: (sessionToken, orderId) =>
+    api.get("/orders/runs", {
+      params: { order_id: orderId },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  create: (sessionToken, order) =>
+    api.post("/orders/create", order, {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  update: (sessionToken, order) =>
+    api.post("/orders/update", order, {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  pause: (sessionToken, orderId) =>
+    api.post(
+      "/orders/pause",
+      { order_id: orderId },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  resume: (sessionToken, orderId) =>
+    api.post(
+      "/orders/resume",
+      { order_id: orderId },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  cancel: (sessionToken, orderId) =>
+    api.post(
+      "/orders/cancel",
+      { order_id: orderId },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+};
+
+// Merchant webhook endpoints of the session's user; sessionToken is the
+// session_token from login
+export const webhooksAPI = {
+  list: (sessionToken) =>
+    api.get("/webhooks/list", {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  create: (sessionToken, url, events) =>
+    api.post(
+      "/webhooks/create",
+      { url, events },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  remove: (sessionToken, endpointId) =>
+    api.post(
+      "/webhooks/delete",
+      { endpoint_id: endpointId },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  deliveries: (sessionToken, { endpointId, status, limit } = {}) =>
+    api.get("/webhooks/deliveries", {
+      params: { endpoint_id: endpointId, status, limit },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  attempts: (sessionToken, deliveryId) =>
+    api.get("/webhooks/attempts", {
+      params: { delivery_id: deliveryId },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  replay: (sessionToken, deliveryId) =>
+    api.post(
+      "/webhooks/replay",
+      { delivery_id: deliveryId },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+};
+
+// Invoice (payment request) endpoints of the session's user; sessionToken is
+// the session_token from login. qrUrl points an <img> at the invoice's
+// payment QR code.
+export const invoicesAPI = {
+  list: (sessionToken, { status, limit } = {}) =>
+    api.get("/invoices/list", {
+      params: { status, limit },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  get: (sessionToken, invoiceId) =>
+    api.get("/invoices/get", {
+      params: { invoice_id: invoiceId },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  create: (sessionToken, { amount, memo, expiresAt } = {}) =>
+    api.post(
+      "/invoices/create",
+      { amount, memo, expires_at: expiresAt },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  status: (ref) => api.get(`/invoices/status?ref=${encodeURIComponent(ref)}`),
+  qrUrl: (ref, size = 256) =>
+    `${API_BASE_URL}/invoices/qr?ref=${encodeURIComponent(ref)}&size=${size}`,
+};
+
+// Multisig (M-of-N) wallet endpoints. auth is either
+// { publicKey, signature } over the proposal payload or { privateKey }.
+const cosigner = ({ publicKey, signature, privateKey } = {}) => ({
+  public_key: publicKey,
+  signature,
+  private_key: privateKey,
+});
+
+export const multisigAPI = {
+  // sessionToken is the session_token from login
+  create: (sessionToken, { name, threshold, publicKeys }) =>
+    api.post(
+      "/multisig/create",
+      { name, threshold, public_keys: publicKeys },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  wallet: (address) =>
+    api.get(`/multisig/wallet?address=${encodeURIComponent(address)}`),
+  walletsForKey: (publicKey) =>
+    api.get("/multisig/wallet", { params: { public_key: publicKey } }),
+  propose: (walletId, { receiverId, amount, note, timestamp, inputs }, auth) =>
+    api.post("/multisig/propose", {
+      wallet_id: walletId,
+      receiver_id: receiverId,
+      amount,
+      note,
+      timestamp,
+      inputs,
+      ...cosigner(auth),
+    }),
+  sign: (proposalId, auth) =>
+    api.post("/multisig/sign", { proposal_id: proposalId, ...cosigner(auth) }),
+  execute: (proposalId) =>
+    api.post("/multisig/execute", { proposal_id: proposalId }),
+  cancel: (proposalId, auth) =>
+    api.post("/multisig/cancel", { proposal_id: proposalId, ...cosigner(auth) }),
+  proposals: (walletId, { status, limit } = {}) =>
+    api.get("/multisig/proposals", {
+      params: { wallet_id: walletId, status, limit },
+    }),
+  proposal: (proposalId) =>
+    api.get("/multisig/proposals", { params: { proposal_id: proposalId } }),
+};
+
+// Escrow endpoints. approvals is a list of { privateKey } or
+// { publicKey, signature } over "escrow:<release|refund>:<escrowId>".
+export const escrowAPI = {
+  create: (
+    { senderId, senderPub, senderPriv },
+    { payeeId, arbiterId, amount, note, refundHeight, refundTime },
+  ) =>
+    api.post("/escrow/create", {
+      sender_id: senderId,
+      sender_pub: senderPub,
+      sender_priv: senderPriv,
+      payee_id: payeeId,
+      arbiter_id: arbiterId,
+      amount,
+      note,
+      refund_height: refundHeight,
+      refund_time: refundTime,
+    }),
+  release: (escrowId, approvals) =>
+    api.post("/escrow/release", {
+      escrow_id: escrowId,
+      approvals: approvals.map(cosigner),
+    }),
+  refund: (escrowId, approvals) =>
+    api.post("/escrow/refund", {
+      escrow_id: escrowId,
+      approvals: approvals.map(cosigner),
+    }),
+  list: (walletId, { limit } = {}) =>
+    api.get("/escrow/list", { params: { wallet_id: walletId, limit } }),
+};
+
+// Locking scripts. Scripts are hex; inputs are [{ utxoId, unlockScript }]
+const scriptSpend = ({ senderId, receiverId, note, timestamp, inputs, lock }) => ({
+  sender_id: senderId,
+  receiver_id: receiverId,
+  note,
+  timestamp,
+  inputs: inputs.map(({ utxoId, unlockScript }) => ({
+    utxo_id: utxoId,
+    unlock_script: unlockScript,
+  })),
+  lock,
+});
+
+export const scriptAPI = {
+  compile: (asm) => api.post("/script/compile", { asm }),
+  sighash: (spend) => api.post("/script/sighash", scriptSpend(spend)),
+  spend: (spend) => api.post("/tx/spend-script", scriptSpend(spend)),
+};
+
+// Hash time-locked contracts. Hashes and secrets are hex; keys base64
+export const htlcAPI = {
+  create: (
+    { senderId, senderPub, senderPriv },
+    { receiverId, receiverPub, amount, hash, timeout, note },
+  ) =>
+    api.post("/htlc/create", {
+      sender_id: senderId,
+      sender_pub: senderPub,
+      sender_priv: senderPriv,
+      receiver_id: receiverId,
+      receiver_pub: receiverPub,
+      amount,
+      hash,
+      timeout,
+      note,
+    }),
+  claim: (htlcId, secret, auth, timestamp) =>
+    api.post("/htlc/claim", {
+      htlc_id: htlcId,
+      secret,
+      timestamp,
+      ...cosigner(auth),
+    }),
+  refund: (htlcId, auth, timestamp) =>
+    api.post("/htlc/refund", { htlc_id: htlcId, timestamp, ...cosigner(auth) }),
+  get: (htlcId) => api.get("/htlc/get", { params: { htlc_id: htlcId } }),
+  byHash: (hash) => api.get("/htlc/get", { params: { hash } }),
+  list: (walletId, { limit } = {}) =>
+    api.get("/htlc/list", { params: { wallet_id: walletId, limit } }),
+};
+
+// Custom tokens. auth is { privateKey } or { publicKey, signature } with
+// a timestamp; see the README for the signed payloads.
+export const assetAPI = {
+  create: ({ symbol, name, zakatBps }, auth, timestamp) =>
+    api.post("/assets/create", {
+      symbol,
+      name,
+      zakat_bps: zakatBps,
+      timestamp,
+      ...cosigner(auth),
+    }),
+  issue: ({ assetId, receiverId, amount, note }, auth, timestamp) =>
+    api.post("/assets/issue", {
+      asset_id: assetId,
+      receiver_id: receiverId,
+      amount,
+      note,
+      timestamp,
+      ...cosigner(auth),
+    }),
+  setZakat: (assetId, zakatBps, auth, timestamp) =>
+    api.post("/assets/zakat", {
+      asset_id: assetId,
+      zakat_bps: zakatBps,
+      timestamp,
+      ...cosigner(auth),
+    }),
+  get: (assetId) => api.get("/assets/get", { params: { asset_id: assetId } }),
+  list: ({ limit } = {}) => api.get("/assets/list", { params: { limit } }),
+};
+
+// Social key recovery; setup needs the session_token from login, the
+// recovery steps need no session
+export const recoveryAPI = {
+  setup: (sessionToken, { walletId, threshold, shares, guardians }) =>
+    api.post(
+      "/recovery/setup",
+      { wallet_id: walletId, threshold, shares, guardians },
+      { headers: { Authorization: `Bearer ${sessionToken}` } }
+    ),
+  getSetup: (sessionToken, walletId) =>
+    api.get("/recovery/setup", {
+      params: { wallet_id: walletId },
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  start: (walletId) => api.post("/recovery/start", { wallet_id: walletId }),
+  getRequest: (requestId) =>
+    api.get("/recovery/request", { params: { request_id: requestId } }),
+  submitShare: (requestId, share) =>
+    api.post("/recovery/share", { request_id: requestId, share }),
+  complete: (requestId, secret, newPassword) =>
+    api.post("/recovery/complete", {
+      request_id: requestId,
+      secret,
+      new_password: newPassword,
+    }),
+};
+
+// Signed account statements
+export const reportsAPI = {
+  statement: (walletId, params = {}, format = "json") =>
+    api.get("/reports/statement", {
+      params: { wallet: walletId, format, ...params },
+      responseType: format === "json" ? "json" : "blob",
+    }),
+  verify: (signedStatement) => api.post("/reports/verify", signedStatement),
+  publicKey: () => api.get("/reports/public-key"),
+};
+
+// System log and audit log endpoints; sessionToken is the session_token
+// from an admin login
+export const logsAPI = {
+  query: (sessionToken, params) =>
+    api.get("/admin/logs", {
+      params,
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  export: (sessionToken, params, format = "csv") =>
+    api.get("/admin/logs", {
+      params: { ...params, format },
+      responseType: "blob",
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  audit: (sessionToken, params) =>
+    api.get("/admin/audit", {
+      params,
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+  verifyAudit: (sessionToken) =>
+    api.get("/admin/audit/verify", {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
+};
+
+// Real-time events over Server-Sent Events. handlers maps topic names
+// (tx.accepted, tx.confirmed, block.mined, zakat.run, balance.changed,
+// security) to callbacks; "reset" fires when missed events could not be
+// replayed and state should be reloaded. EventSource resumes from the last
+// event ID on its own after a dropped connection. Returns a close function.
+export const eventsAPI = {
+  subscribe: (sessionToken, { topics, wallets } = {}, handlers = {}) => {
+    const params = new URLSearchParams({ token: sessionToken });
+    if (topics) params.set("topics", topics.join(","));
+    if (wallets) params.set("wallets", wallets.join(","));
+    const source = new EventSource(`${API_BASE_URL}/events?${params}`);
+    Object.entries(handlers).forEach(([topic, handler]) => {
+      source.addEventListener(topic, (e) =>
+        handler(e.data ? JSON.parse(e.data) : {})
+      );
+    });
+    source.addEventListener("expired", () => source.close());
+    return () => source.close();
+  },
+};
+
+// Zakat endpoints; trigger needs the session_token of an admin login
 export const zakatAPI = {
   getPool: () => api.get("/zakat/pool-balance"),
-  trigger: () => api.post("/zakat/trigger"),
+  trigger: (sessionToken) =>
+    api.post("/zakat/trigger", null, {
+      headers: { Authorization: `Bearer ${sessionToken}` },
+    }),
 };
 
 export const healthCheck = () => api.get("/health");
@@ -109,7 +109,7 @@ function AdminPanel({ adminData, onAdminLogout }) {
   const handleTriggerZakat = async () => {
     setLoading(true);
     try {
-      await zakatAPI.trigger();
+      await zakatAPI.trigger(adminData?.session_token);
       setMessage({
         type: "success",
         text: "Zakat deduction triggered successfully!",
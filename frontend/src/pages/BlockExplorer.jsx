@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from "react";
-import { blockchainAPI, transactionAPI } from "../api";
+import { blockchainAPI, transactionAPI, explorerAPI } from "../api";
 
 function BlockExplorer() {
   const [blocks, setBlocks] = useState([]);
@@ -8,6 +8,7 @@ function BlockExplorer() {
   const [expandedTx, setExpandedTx] = useState(null);
   const [txDetails, setTxDetails] = useState({});
   const [chainLength, setChainLength] = useState(0);
+  const [network, setNetwork] = useState(null);
 
   useEffect(() => {
     const fetchBlocks = async () => {
@@ -20,6 +21,14 @@ function BlockExplorer() {
       } finally {
         setLoading(false);
       }
+
+      // Network figures need the database and may be unavailable
+      try {
+        const stats = await explorerAPI.getStats();
+        setNetwork(stats.data);
+      } catch (error) {
+        setNetwork(null);
+      }
     };
 
     fetchBlocks();
@@ -85,6 +94,28 @@ function BlockExplorer() {
           </div>
         </div>
 
+        {network && (
+          <div className="grid grid-cols-2 md:grid-cols-4 gap-4 mb-8">
+            {[
+              { label: "Total Supply", value: network.total_supply },
+              { label: "Mempool", value: `${network.mempool_size} txs` },
+              {
+                label: "Avg Block Time",
+                value: `${Math.round(network.avg_block_time)}s`,
+              },
+              { label: "Stored Blocks", value: network.block_count },
+            ].map((stat) => (
+              <div
+                key={stat.label}
+                className="bg-slate-800/50 backdrop-blur-sm border border-slate-700/50 rounded-xl p-4"
+              >
+                <p className="text-slate-400 text-sm">{stat.label}</p>
+                <p className="text-2xl font-bold text-white">{stat.value}</p>
+              </div>
+            ))}
+          </div>
+        )}
+
         {/* Blockchain Visualization */}
         <div className="mb-8 overflow-x-auto pb-4">
           <div className="flex items-center gap-2 min-w-max">
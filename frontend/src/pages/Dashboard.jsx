@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from "react";
 import { Link } from "react-router-dom";
-import { walletAPI } from "../api";
+import { walletAPI, eventsAPI } from "../api";
 import api from "../api";
 
 function Dashboard({ walletData }) {
@@ -35,6 +35,21 @@ function Dashboard({ walletData }) {
 
     if (walletData) {
       fetchData();
+      // Refresh when something happens; older sessions without a token poll
+      if (walletData.session_token) {
+        const refresh = () => fetchData();
+        return eventsAPI.subscribe(
+          walletData.session_token,
+          { topics: ["balance.changed", "tx.accepted", "tx.confirmed", "zakat.run"] },
+          {
+            "balance.changed": refresh,
+            "tx.accepted": refresh,
+            "tx.confirmed": refresh,
+            "zakat.run": refresh,
+            reset: refresh,
+          }
+        );
+      }
       const interval = setInterval(fetchData, 10000);
       return () => clearInterval(interval);
     }
@@ -349,7 +364,7 @@ function Dashboard({ walletData }) {
             ) : (
               <div className="space-y-3">
                 {recentTxs.map((tx, idx) => {
-                  const isSent = tx.sender_id === walletData?.wallet_id;
+                  const isSent = tx.sender_wallet_id === walletData?.wallet_id;
                   return (
                     <div
                       key={idx}
@@ -398,8 +413,8 @@ function Dashboard({ walletData }) {
                             </p>
                             <p className="text-slate-500 text-xs font-mono">
                               {isSent
-                                ? tx.receiver_id?.substring(0, 12)
-                                : tx.sender_id?.substring(0, 12)}
+                                ? tx.receiver_wallet_id?.substring(0, 12)
+                                : tx.sender_wallet_id?.substring(0, 12)}
                               ...
                             </p>
                           </div>
@@ -415,6 +430,8 @@ function Dashboard({ walletData }) {
                           </p>
                           <p className="text-slate-500 text-xs">
                             {tx.status || "confirmed"}
+                            {tx.confirmations > 0 &&
+                              ` · ${tx.confirmations} conf.`}
                           </p>
                         </div>
                       </div>
@@ -540,14 +557,16 @@ function Dashboard({ walletData }) {
               </div>
             </div>
             <div>
-              <p className="text-slate-400 text-sm mb-2">Wallet ID</p>
+              <p className="text-slate-400 text-sm mb-2">Wallet Address</p>
               <div className="bg-slate-900/50 rounded-xl p-4">
                 <p className="text-slate-300 font-mono text-xs break-all">
-                  {walletData?.wallet_id}
+                  {walletData?.address || walletData?.wallet_id}
                 </p>
                 <button
                   onClick={() =>
-                    navigator.clipboard.writeText(walletData?.wallet_id)
+                    navigator.clipboard.writeText(
+                      walletData?.address || walletData?.wallet_id
+                    )
                   }
                   className="mt-3 text-blue-400 hover:text-blue-300 text-sm flex items-center gap-1"
                 >
@@ -26,6 +26,7 @@ function LoginEmail({ onLogin }) {
         full_name,
         cnic,
         balance,
+        session_token,
       } = res.data;
 
       if (!private_key) {
@@ -41,6 +42,7 @@ function LoginEmail({ onLogin }) {
         email,
         cnic,
         balance,
+        session_token,
       };
 
       localStorage.setItem("wallet", JSON.stringify(wallet));
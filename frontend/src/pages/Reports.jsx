@@ -1,7 +1,22 @@
 import React, { useState, useEffect, useCallback } from "react";
-import { walletAPI } from "../api";
+import { walletAPI, reportsAPI } from "../api";
 import api from "../api";
 
+// periodStart returns the first day (YYYY-MM-DD) of the selected period
+const periodStart = (period) => {
+  const now = new Date();
+  let start;
+  if (period === "month") {
+    start = new Date(now.getFullYear(), now.getMonth(), 1);
+  } else if (period === "week") {
+    start = new Date(now.getFullYear(), now.getMonth(), now.getDate() - now.getDay());
+  } else {
+    return undefined;
+  }
+  const pad = (n) => String(n).padStart(2, "0");
+  return `${start.getFullYear()}-${pad(start.getMonth() + 1)}-${pad(start.getDate())}`;
+};
+
 function Reports({ walletData }) {
   const [loading, setLoading] = useState(true);
   const [reportData, setReportData] = useState({
@@ -24,25 +39,21 @@ function Reports({ walletData }) {
       const balanceRes = await walletAPI.getBalance(walletData.wallet_id);
       const balance = balanceRes.data.balance || 0;
 
-      // Fetch transaction history
-      const historyRes = await walletAPI.getHistory(walletData.wallet_id, 100);
+      // Fetch transaction history for the selected period
+      const historyRes = await walletAPI.getHistory(walletData.wallet_id, {
+        limit: 200,
+        from: periodStart(selectedPeriod),
+      });
       const transactions = historyRes.data.transactions || [];
+      const totals = historyRes.data.totals || {};
 
-      // Calculate stats
-      let totalSent = 0;
-      let totalReceived = 0;
+      // Sent/received/count come from the server over the whole period
       let zakatPaid = 0;
 
       transactions.forEach((tx) => {
-        if (tx.sender_id === walletData.wallet_id) {
-          totalSent += tx.amount || 0;
-        }
-        if (tx.receiver_id === walletData.wallet_id) {
-          totalReceived += tx.amount || 0;
-        }
         if (
           tx.note?.toLowerCase().includes("zakat") ||
-          tx.type === "zakat_deduction"
+          tx.tx_type === "zakat_deduction"
         ) {
           zakatPaid += tx.amount || 0;
         }
@@ -56,10 +67,10 @@ function Reports({ walletData }) {
       }
 
       setReportData({
-        totalSent,
-        totalReceived,
+        totalSent: totals.sent || 0,
+        totalReceived: totals.received || 0,
         zakatPaid,
-        transactionCount: transactions.length,
+        transactionCount: totals.count ?? transactions.length,
         currentBalance: balance,
         monthlyStats: generateMonthlyStats(transactions, walletData.wallet_id),
       });
@@ -68,12 +79,36 @@ function Reports({ walletData }) {
     } finally {
       setLoading(false);
     }
-  }, [walletData]);
+  }, [walletData, selectedPeriod]);
 
   useEffect(() => {
     fetchReportData();
   }, [fetchReportData]);
 
+  const downloadStatement = async (format) => {
+    try {
+      const res = await reportsAPI.statement(
+        walletData.wallet_id,
+        { from: periodStart(selectedPeriod) },
+        format
+      );
+      const blob =
+        format === "json"
+          ? new Blob([JSON.stringify(res.data, null, 2)], {
+              type: "application/json",
+            })
+          : res.data;
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = `statement.${format}`;
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      console.error("Failed to download statement:", err);
+    }
+  };
+
   const generateMonthlyStats = (transactions, walletId) => {
     const months = {};
     const now = new Date();
@@ -103,10 +138,10 @@ function Reports({ walletData }) {
       )}`;
 
       if (months[key]) {
-        if (tx.sender_id === walletId) {
+        if (tx.sender_wallet_id === walletId) {
           months[key].sent += tx.amount || 0;
         }
-        if (tx.receiver_id === walletId) {
+        if (tx.receiver_wallet_id === walletId) {
           months[key].received += tx.amount || 0;
         }
       }
@@ -179,6 +214,17 @@ function Reports({ walletData }) {
             <option value="month">This Month</option>
             <option value="week">This Week</option>
           </select>
+          <div className="flex gap-2">
+            {["pdf", "csv", "json"].map((format) => (
+              <button
+                key={format}
+                onClick={() => downloadStatement(format)}
+                className="bg-slate-800/50 border border-slate-700 rounded-xl px-3 py-2.5 text-white text-sm uppercase hover:border-purple-500 transition-all"
+              >
+                {format}
+              </button>
+            ))}
+          </div>
         </div>
 
         {loading ? (
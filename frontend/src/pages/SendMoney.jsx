@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from "react";
 import { useSearchParams } from "react-router-dom";
-import { transactionAPI, profileAPI } from "../api";
+import { transactionAPI, profileAPI, directoryAPI } from "../api";
 
 function SendMoney({ walletData }) {
   const [searchParams] = useSearchParams();
@@ -12,6 +12,8 @@ function SendMoney({ walletData }) {
   const [messageType, setMessageType] = useState("");
   const [beneficiaries, setBeneficiaries] = useState([]);
   const [showBeneficiaries, setShowBeneficiaries] = useState(false);
+  const [recipient, setRecipient] = useState(null);
+  const [allowUnknown, setAllowUnknown] = useState(false);
 
   useEffect(() => {
     // Pre-fill receiver from URL params (from beneficiary quick send)
@@ -32,6 +34,19 @@ function SendMoney({ walletData }) {
     fetchBeneficiaries();
   }, [searchParams, walletData]);
 
+  // Resolve an address, registered email or @alias through the directory
+  const lookupRecipient = async (query) => {
+    const res = await directoryAPI.lookup(walletData.session_token, query.trim());
+    setRecipient(res.data);
+    return res.data;
+  };
+
+  const changeReceiver = (value) => {
+    setReceiverId(value);
+    setRecipient(null);
+    setAllowUnknown(false);
+  };
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     setLoading(true);
@@ -40,7 +55,7 @@ function SendMoney({ walletData }) {
     try {
       if (!receiverId || !amount) {
         setMessageType("error");
-        setMessage("Receiver ID and amount are required");
+        setMessage("Receiver and amount are required");
         setLoading(false);
         return;
       }
@@ -52,7 +67,38 @@ function SendMoney({ walletData }) {
         return;
       }
 
-      if (receiverId === walletData.wallet_id) {
+      // Resolve the receiver and catch typos before anything is signed
+      let found;
+      try {
+        found = await lookupRecipient(receiverId);
+      } catch (error) {
+        setMessageType("error");
+        setMessage(
+          error.response?.data?.error ||
+            error.response?.data ||
+            "Receiver is not a valid address, email or @alias"
+        );
+        setLoading(false);
+        return;
+      }
+
+      if (!found.wallet_id) {
+        setMessageType("error");
+        setMessage(`No wallet is registered under ${found.query}`);
+        setLoading(false);
+        return;
+      }
+
+      if (!found.exists && !allowUnknown) {
+        setMessageType("error");
+        setMessage(
+          'No registered wallet has this address. Check it, or tick "Send to an unregistered wallet".'
+        );
+        setLoading(false);
+        return;
+      }
+
+      if (found.wallet_id === walletData.wallet_id) {
         setMessageType("error");
         setMessage("Cannot send to your own wallet");
         setLoading(false);
@@ -61,7 +107,8 @@ function SendMoney({ walletData }) {
 
       const transaction = {
         sender_id: walletData.wallet_id,
-        receiver_id: receiverId,
+        receiver_id: found.wallet_id,
+        allow_unknown: allowUnknown,
         amount: parseInt(amount),
         note: note || "",
         sender_pub: walletData.public_key,
@@ -76,7 +123,7 @@ function SendMoney({ walletData }) {
           16
         )}...`
       );
-      setReceiverId("");
+      changeReceiver("");
       setAmount("");
       setNote("");
     } catch (error) {
@@ -165,7 +212,7 @@ function SendMoney({ walletData }) {
             <div>
               <div className="flex items-center justify-between mb-2">
                 <label className="block text-sm font-medium text-slate-300">
-                  Receiver Wallet ID
+                  Receiver
                 </label>
                 {beneficiaries.length > 0 && (
                   <button
@@ -198,7 +245,7 @@ function SendMoney({ walletData }) {
                       key={idx}
                       type="button"
                       onClick={() => {
-                        setReceiverId(ben.wallet_id);
+                        changeReceiver(ben.wallet_id);
                         setShowBeneficiaries(false);
                       }}
                       className="w-full flex items-center gap-3 p-2 rounded-lg hover:bg-slate-700/50 transition-all text-left"
@@ -222,10 +269,37 @@ function SendMoney({ walletData }) {
               <input
                 type="text"
                 value={receiverId}
-                onChange={(e) => setReceiverId(e.target.value)}
-                placeholder="Enter receiver's wallet ID"
+                onChange={(e) => changeReceiver(e.target.value)}
+                onBlur={() =>
+                  receiverId.trim() &&
+                  lookupRecipient(receiverId).catch(() => setRecipient(null))
+                }
+                placeholder="Address (cw1...), email or @alias"
                 className="w-full bg-slate-900/50 border border-slate-600 rounded-xl px-4 py-3 text-white placeholder-slate-500 focus:outline-none focus:border-blue-500 focus:ring-1 focus:ring-blue-500 transition-all font-mono text-sm"
               />
+              {recipient && (
+                <p
+                  className={`mt-2 text-sm ${
+                    recipient.exists ? "text-emerald-400" : "text-amber-400"
+                  }`}
+                >
+                  {recipient.exists
+                    ? `Sending to ${recipient.name || "a registered wallet"}${
+                        recipient.alias ? ` (${recipient.alias})` : ""
+                      }`
+                    : "No registered wallet found"}
+                </p>
+              )}
+              {recipient && !recipient.exists && recipient.wallet_id && (
+                <label className="mt-2 flex items-center gap-2 text-sm text-slate-300">
+                  <input
+                    type="checkbox"
+                    checked={allowUnknown}
+                    onChange={(e) => setAllowUnknown(e.target.checked)}
+                  />
+                  Send to an unregistered wallet
+                </label>
+              )}
             </div>
 
             {/* Amount */}
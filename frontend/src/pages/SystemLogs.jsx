@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useCallback } from "react";
-import api from "../api";
+import { logsAPI } from "../api";
 
 function SystemLogs({ walletData }) {
   const [logs, setLogs] = useState([]);
@@ -9,67 +9,36 @@ function SystemLogs({ walletData }) {
 
   const fetchLogs = useCallback(async () => {
     try {
-      const res = await api.get(`/admin/logs`, {
-        params: {
-          wallet_id: walletData?.wallet_id,
-          limit: 100,
-        },
+      const res = await logsAPI.query(walletData?.session_token, {
+        wallet_id: walletData?.wallet_id,
+        action: filter,
+        limit: 100,
       });
       setLogs(res.data.logs || []);
     } catch (err) {
       console.error("Failed to fetch logs:", err);
-      // Mock data for demo
-      setLogs([
-        {
-          id: 1,
-          action: "login_success",
-          wallet_id: walletData?.wallet_id,
-          details: "Successful login from browser",
-          status: "success",
-          ip_address: "192.168.1.1",
-          timestamp: new Date().toISOString(),
-        },
-        {
-          id: 2,
-          action: "tx_sent",
-          wallet_id: walletData?.wallet_id,
-          details: "Transaction sent: 100 coins",
-          status: "confirmed",
-          ip_address: "192.168.1.1",
-          timestamp: new Date(Date.now() - 3600000).toISOString(),
-        },
-        {
-          id: 3,
-          action: "tx_received",
-          wallet_id: walletData?.wallet_id,
-          details: "Transaction received: 50 coins",
-          status: "confirmed",
-          ip_address: "N/A",
-          timestamp: new Date(Date.now() - 7200000).toISOString(),
-        },
-        {
-          id: 4,
-          action: "zakat_deduction",
-          wallet_id: walletData?.wallet_id,
-          details: "Monthly Zakat: 25 coins (2.5%)",
-          status: "processed",
-          ip_address: "system",
-          timestamp: new Date(Date.now() - 86400000).toISOString(),
-        },
-        {
-          id: 5,
-          action: "failed_login",
-          wallet_id: walletData?.wallet_id,
-          details: "Invalid password attempt",
-          status: "failed",
-          ip_address: "192.168.1.5",
-          timestamp: new Date(Date.now() - 172800000).toISOString(),
-        },
-      ]);
+      setLogs([]);
     } finally {
       setLoading(false);
     }
-  }, [walletData]);
+  }, [walletData, filter]);
+
+  const exportLogs = async () => {
+    try {
+      const res = await logsAPI.export(walletData?.session_token, {
+        wallet_id: walletData?.wallet_id,
+        action: filter,
+      });
+      const url = URL.createObjectURL(res.data);
+      const link = document.createElement("a");
+      link.href = url;
+      link.download = "system-logs.csv";
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      console.error("Failed to export logs:", err);
+    }
+  };
 
   useEffect(() => {
     fetchLogs();
@@ -95,7 +64,7 @@ function SystemLogs({ walletData }) {
             </svg>
           </div>
         );
-      case "failed_login":
+      case "standing_order_failed":
         return (
           <div className="w-10 h-10 bg-red-500/20 rounded-xl flex items-center justify-center">
             <svg
@@ -149,7 +118,7 @@ function SystemLogs({ walletData }) {
             </svg>
           </div>
         );
-      case "zakat_deduction":
+      case "zakat_deducted":
         return (
           <div className="w-10 h-10 bg-purple-500/20 rounded-xl flex items-center justify-center">
             <svg
@@ -226,7 +195,6 @@ function SystemLogs({ walletData }) {
   };
 
   const filteredLogs = logs.filter((log) => {
-    if (filter !== "all" && log.action !== filter) return false;
     if (
       searchTerm &&
       !log.details.toLowerCase().includes(searchTerm.toLowerCase())
@@ -304,12 +272,17 @@ function SystemLogs({ walletData }) {
           >
             <option value="all">All Events</option>
             <option value="login_success">Login Success</option>
-            <option value="failed_login">Failed Login</option>
             <option value="tx_sent">Transactions Sent</option>
-            <option value="tx_received">Transactions Received</option>
-            <option value="zakat_deduction">Zakat Deductions</option>
-            <option value="mining">Mining Events</option>
+            <option value="zakat_deducted">Zakat Deductions</option>
+            <option value="zakat_block_mined">Mining Events</option>
+            <option value="standing_order_failed">Failed Standing Orders</option>
           </select>
+          <button
+            onClick={exportLogs}
+            className="bg-slate-800/50 border border-slate-700 rounded-xl px-4 py-3 text-white hover:border-blue-500 transition-all"
+          >
+            Export CSV
+          </button>
         </div>
 
         {/* Stats Cards */}
@@ -328,7 +301,7 @@ function SystemLogs({ walletData }) {
             },
             {
               label: "Zakat Events",
-              value: logs.filter((l) => l.action === "zakat_deduction").length,
+              value: logs.filter((l) => l.action.startsWith("zakat")).length,
               color: "amber",
             },
           ].map((stat, idx) => (
@@ -397,7 +370,7 @@ function SystemLogs({ walletData }) {
                         <div className="flex flex-col items-end gap-2">
                           {getStatusBadge(log.status)}
                           <span className="text-slate-500 text-xs">
-                            {formatDate(log.timestamp)}
+                            {formatDate(log.created_at)}
                           </span>
                         </div>
                       </div>
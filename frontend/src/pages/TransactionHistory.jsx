@@ -1,16 +1,47 @@
-import React, { useState, useEffect } from "react";
+import React, { useState, useEffect, useCallback, useRef } from "react";
 import { walletAPI } from "../api";
 
+const PAGE_SIZE = 25;
+
 function TransactionHistory({ walletData }) {
   const [transactions, setTransactions] = useState([]);
+  const [totals, setTotals] = useState({ count: 0, sent: 0, received: 0 });
+  const [nextCursor, setNextCursor] = useState("");
   const [loading, setLoading] = useState(true);
+  const [loadingMore, setLoadingMore] = useState(false);
   const [filter, setFilter] = useState("all");
+  const [search, setSearch] = useState("");
+  const [fromDate, setFromDate] = useState("");
+  const [toDate, setToDate] = useState("");
+  // Polling only refreshes the first page, so it pauses once more are loaded
+  const pagedRef = useRef(false);
+
+  // Filters are applied by the server; empty values are left out
+  const buildQuery = useCallback(
+    (cursor) => {
+      const query = { limit: PAGE_SIZE };
+      if (filter !== "all") query.direction = filter;
+      if (search.trim()) query.q = search.trim();
+      if (fromDate) query.from = fromDate;
+      if (toDate) query.to = toDate;
+      if (cursor) query.cursor = cursor;
+      return query;
+    },
+    [filter, search, fromDate, toDate]
+  );
 
   useEffect(() => {
+    pagedRef.current = false;
     const fetchHistory = async () => {
+      if (pagedRef.current) return;
       try {
-        const response = await walletAPI.getHistory(walletData.wallet_id, 50);
+        const response = await walletAPI.getHistory(
+          walletData.wallet_id,
+          buildQuery()
+        );
         setTransactions(response.data.transactions || []);
+        setTotals(response.data.totals || { count: 0, sent: 0, received: 0 });
+        setNextCursor(response.data.next_cursor || "");
       } catch (error) {
         console.error("Failed to fetch transaction history:", error);
       } finally {
@@ -23,13 +54,25 @@ function TransactionHistory({ walletData }) {
       const interval = setInterval(fetchHistory, 10000);
       return () => clearInterval(interval);
     }
-  }, [walletData]);
+  }, [walletData, buildQuery]);
 
-  const filteredTxs = transactions.filter((tx) => {
-    if (filter === "sent") return tx.sender_id === walletData?.wallet_id;
-    if (filter === "received") return tx.receiver_id === walletData?.wallet_id;
-    return true;
-  });
+  const loadMore = async () => {
+    if (!nextCursor) return;
+    setLoadingMore(true);
+    pagedRef.current = true;
+    try {
+      const response = await walletAPI.getHistory(
+        walletData.wallet_id,
+        buildQuery(nextCursor)
+      );
+      setTransactions((prev) => [...prev, ...(response.data.transactions || [])]);
+      setNextCursor(response.data.next_cursor || "");
+    } catch (error) {
+      console.error("Failed to load more transactions:", error);
+    } finally {
+      setLoadingMore(false);
+    }
+  };
 
   const formatDate = (timestamp) => {
     if (!timestamp) return "N/A";
@@ -43,13 +86,9 @@ function TransactionHistory({ walletData }) {
     });
   };
 
-  const totalSent = transactions
-    .filter((tx) => tx.sender_id === walletData?.wallet_id)
-    .reduce((sum, tx) => sum + (tx.amount || 0), 0);
-
-  const totalReceived = transactions
-    .filter((tx) => tx.receiver_id === walletData?.wallet_id)
-    .reduce((sum, tx) => sum + (tx.amount || 0), 0);
+  // Totals cover every transaction matching the filters, not just loaded pages
+  const totalSent = totals.sent;
+  const totalReceived = totals.received;
 
   return (
     <div className="min-h-screen bg-gradient-to-br from-slate-900 via-slate-800 to-slate-900">
@@ -84,7 +123,7 @@ function TransactionHistory({ walletData }) {
           <div className="bg-slate-800/50 backdrop-blur-sm border border-slate-700/50 rounded-xl p-4">
             <p className="text-slate-400 text-sm">Total Transactions</p>
             <p className="text-2xl font-bold text-white">
-              {transactions.length}
+              {totals.count}
             </p>
           </div>
           <div className="bg-slate-800/50 backdrop-blur-sm border border-slate-700/50 rounded-xl p-4">
@@ -115,7 +154,7 @@ function TransactionHistory({ walletData }) {
         </div>
 
         {/* Filters */}
-        <div className="mb-6 flex gap-2">
+        <div className="mb-6 flex flex-wrap gap-2">
           {[
             { id: "all", label: "All" },
             { id: "sent", label: "Sent" },
@@ -133,6 +172,25 @@ function TransactionHistory({ walletData }) {
               {f.label}
             </button>
           ))}
+          <input
+            type="text"
+            value={search}
+            onChange={(e) => setSearch(e.target.value)}
+            placeholder="Search notes"
+            className="px-4 py-2 rounded-lg text-sm bg-slate-800/50 border border-slate-700/50 text-white placeholder-slate-500 focus:outline-none focus:border-violet-500"
+          />
+          <input
+            type="date"
+            value={fromDate}
+            onChange={(e) => setFromDate(e.target.value)}
+            className="px-3 py-2 rounded-lg text-sm bg-slate-800/50 border border-slate-700/50 text-slate-300 focus:outline-none focus:border-violet-500"
+          />
+          <input
+            type="date"
+            value={toDate}
+            onChange={(e) => setToDate(e.target.value)}
+            className="px-3 py-2 rounded-lg text-sm bg-slate-800/50 border border-slate-700/50 text-slate-300 focus:outline-none focus:border-violet-500"
+          />
         </div>
 
         {/* Transactions List */}
@@ -142,7 +200,7 @@ function TransactionHistory({ walletData }) {
               <div className="animate-spin w-8 h-8 border-2 border-violet-500 border-t-transparent rounded-full mx-auto mb-4"></div>
               <p className="text-slate-400">Loading transactions...</p>
             </div>
-          ) : filteredTxs.length === 0 ? (
+          ) : transactions.length === 0 ? (
             <div className="p-12 text-center">
               <div className="w-16 h-16 bg-slate-700/50 rounded-full flex items-center justify-center mx-auto mb-4">
                 <svg
@@ -194,8 +252,8 @@ function TransactionHistory({ walletData }) {
                     </tr>
                   </thead>
                   <tbody className="divide-y divide-slate-700/50">
-                    {filteredTxs.map((tx, idx) => {
-                      const isSent = tx.sender_id === walletData?.wallet_id;
+                    {transactions.map((tx, idx) => {
+                      const isSent = tx.sender_wallet_id === walletData?.wallet_id;
                       return (
                         <tr
                           key={idx}
@@ -250,8 +308,8 @@ function TransactionHistory({ walletData }) {
                           <td className="py-4 px-6">
                             <p className="text-slate-300 font-mono text-sm">
                               {isSent
-                                ? tx.receiver_id?.substring(0, 16)
-                                : tx.sender_id?.substring(0, 16)}
+                                ? tx.receiver_wallet_id?.substring(0, 16)
+                                : tx.sender_wallet_id?.substring(0, 16)}
                               ...
                             </p>
                           </td>
@@ -273,12 +331,14 @@ function TransactionHistory({ walletData }) {
                           <td className="py-4 px-6">
                             <span
                               className={`inline-flex items-center px-2.5 py-1 rounded-lg text-xs font-medium ${
-                                tx.status === "confirmed"
+                                tx.status === "mined" || tx.status === "confirmed"
                                   ? "bg-emerald-500/20 text-emerald-400 border border-emerald-500/30"
                                   : "bg-yellow-500/20 text-yellow-400 border border-yellow-500/30"
                               }`}
                             >
                               {tx.status || "confirmed"}
+                              {tx.confirmations > 0 &&
+                                ` · ${tx.confirmations} conf.`}
                             </span>
                           </td>
                           <td className="py-4 px-6 text-right">
@@ -295,8 +355,8 @@ function TransactionHistory({ walletData }) {
 
               {/* Mobile Cards */}
               <div className="md:hidden divide-y divide-slate-700/50">
-                {filteredTxs.map((tx, idx) => {
-                  const isSent = tx.sender_id === walletData?.wallet_id;
+                {transactions.map((tx, idx) => {
+                  const isSent = tx.sender_wallet_id === walletData?.wallet_id;
                   return (
                     <div key={idx} className="p-4">
                       <div className="flex items-center justify-between mb-3">
@@ -356,20 +416,22 @@ function TransactionHistory({ walletData }) {
                           </p>
                           <span
                             className={`inline-flex items-center px-2 py-0.5 rounded text-xs ${
-                              tx.status === "confirmed"
+                              tx.status === "mined" || tx.status === "confirmed"
                                 ? "bg-emerald-500/20 text-emerald-400"
                                 : "bg-yellow-500/20 text-yellow-400"
                             }`}
                           >
                             {tx.status || "confirmed"}
+                            {tx.confirmations > 0 &&
+                              ` · ${tx.confirmations} conf.`}
                           </span>
                         </div>
                       </div>
                       <p className="text-slate-400 text-xs font-mono">
                         {isSent ? "To: " : "From: "}
                         {isSent
-                          ? tx.receiver_id?.substring(0, 24)
-                          : tx.sender_id?.substring(0, 24)}
+                          ? tx.receiver_wallet_id?.substring(0, 24)
+                          : tx.sender_wallet_id?.substring(0, 24)}
                         ...
                       </p>
                       {tx.note && (
@@ -384,6 +446,18 @@ function TransactionHistory({ walletData }) {
             </>
           )}
         </div>
+
+        {nextCursor && (
+          <div className="mt-6 text-center">
+            <button
+              onClick={loadMore}
+              disabled={loadingMore}
+              className="px-6 py-2 rounded-lg font-medium text-sm bg-slate-800/50 text-slate-300 hover:text-white hover:bg-slate-700/50 disabled:opacity-50"
+            >
+              {loadingMore ? "Loading..." : "Load more"}
+            </button>
+          </div>
+        )}
       </div>
     </div>
   );